@@ -0,0 +1,84 @@
+package api_audit_search
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dracory/api"
+	"github.com/dracory/weebase/shared/audit"
+	"github.com/dracory/weebase/shared/types"
+)
+
+// AuditSearch searches the audit log
+type AuditSearch struct {
+	config types.Config
+}
+
+// New creates a new AuditSearch handler
+func New(config types.Config) *AuditSearch {
+	return &AuditSearch{config: config}
+}
+
+// Handle processes the request. The optional "operator", "audit_action",
+// "outcome" and free-text "q" filters narrow the entries, "since" and
+// "until" (RFC 3339 or YYYY-MM-DD) bound their time, and "limit" caps how
+// many are returned, newest first.
+func (h *AuditSearch) Handle(w http.ResponseWriter, r *http.Request) {
+	searcher, ok := audit.AsSearcher(h.config.AuditSink)
+	if !ok {
+		api.Respond(w, r, api.Error("the audit log is not searchable: configure AUDIT_LOG_FILE or AUDIT_DB_DSN"))
+		return
+	}
+
+	params := r.URL.Query()
+	q := audit.Query{
+		Operator: strings.TrimSpace(params.Get("operator")),
+		Action:   strings.TrimSpace(params.Get("audit_action")),
+		Outcome:  strings.TrimSpace(params.Get("outcome")),
+		Text:     strings.TrimSpace(params.Get("q")),
+	}
+	var err error
+	if q.Since, err = parseTime(params.Get("since"), false); err != nil {
+		api.Respond(w, r, api.Error("invalid since: "+err.Error()))
+		return
+	}
+	if q.Until, err = parseTime(params.Get("until"), true); err != nil {
+		api.Respond(w, r, api.Error("invalid until: "+err.Error()))
+		return
+	}
+	if limit := strings.TrimSpace(params.Get("limit")); limit != "" {
+		if q.Limit, err = strconv.Atoi(limit); err != nil {
+			api.Respond(w, r, api.Error("invalid limit"))
+			return
+		}
+	}
+
+	entries, err := searcher.Search(r.Context(), q)
+	if err != nil {
+		api.Respond(w, r, api.Error("failed to search the audit log: "+err.Error()))
+		return
+	}
+	api.Respond(w, r, api.SuccessWithData("entries listed", map[string]any{"entries": entries}))
+}
+
+// parseTime reads an RFC 3339 time or a date; a date used as an upper
+// bound includes the whole day
+func parseTime(s string, endOfDay bool) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(time.DateOnly, s)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if endOfDay {
+		t = t.Add(24*time.Hour - time.Nanosecond)
+	}
+	return t, nil
+}
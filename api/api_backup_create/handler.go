@@ -0,0 +1,62 @@
+package api_backup_create
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/dracory/api"
+	"github.com/dracory/weebase/shared/backup"
+	"github.com/dracory/weebase/shared/jobs"
+	"github.com/dracory/weebase/shared/session"
+	"github.com/dracory/weebase/shared/types"
+)
+
+// BackupCreate takes a backup of a profile outside its schedule
+type BackupCreate struct {
+	config  types.Config
+	backups *backup.Scheduler
+	jobs    *jobs.Runner
+}
+
+// New creates a new BackupCreate handler
+func New(config types.Config, backups *backup.Scheduler, runner *jobs.Runner) *BackupCreate {
+	return &BackupCreate{config: config, backups: backups, jobs: runner}
+}
+
+// Handle processes the request. Parameters: profile. The backup runs in the
+// background; poll the job status with the returned job_id.
+func (h *BackupCreate) Handle(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		api.Respond(w, r, api.Error("method not allowed"))
+		return
+	}
+
+	sess := session.EnsureSession(w, r, h.config.SessionSecret)
+	if sess == nil {
+		api.Respond(w, r, api.Error("failed to get session"))
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		api.Respond(w, r, api.Error("failed to parse form"))
+		return
+	}
+
+	name := strings.TrimSpace(r.Form.Get("profile"))
+	if _, ok := h.backups.Profile(name); !ok {
+		api.Respond(w, r, api.Error("backup profile not found"))
+		return
+	}
+
+	id, err := h.jobs.Submit(jobs.Spec{Kind: jobs.KindBackup, Owner: sess.ID,
+		Run: func(ctx context.Context, t *jobs.Task) (any, error) {
+			progress := func(table string, rows int64) { t.Progress(map[string]any{"table": table, "rows": rows}) }
+			return h.backups.Backup(ctx, name, progress)
+		}})
+	if err != nil {
+		api.Respond(w, r, api.Error(err.Error()))
+		return
+	}
+	api.Respond(w, r, api.SuccessWithData("backup started", map[string]any{"job_id": id}))
+}
@@ -0,0 +1,104 @@
+package api_backup_restore
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/dracory/api"
+	"github.com/dracory/weebase/shared/audit"
+	"github.com/dracory/weebase/shared/backup"
+	"github.com/dracory/weebase/shared/jobs"
+	"github.com/dracory/weebase/shared/session"
+	"github.com/dracory/weebase/shared/sqlscript"
+	"github.com/dracory/weebase/shared/types"
+)
+
+// BackupRestore replays a backup on the database of its profile
+type BackupRestore struct {
+	config  types.Config
+	backups *backup.Scheduler
+	jobs    *jobs.Runner
+}
+
+// New creates a new BackupRestore handler
+func New(config types.Config, backups *backup.Scheduler, runner *jobs.Runner) *BackupRestore {
+	return &BackupRestore{config: config, backups: backups, jobs: runner}
+}
+
+// Handle processes the request.
+//
+// Parameters: profile and backup (a file name from the backups list). A
+// restore drops and recreates the backed up tables, so it needs confirm=yes
+// in safe mode and is refused in read-only mode. The backup is checked
+// against its checksum, then replayed in the background; poll the job
+// status with the returned job_id.
+func (h *BackupRestore) Handle(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		api.Respond(w, r, api.Error("method not allowed"))
+		return
+	}
+
+	sess := session.EnsureSession(w, r, h.config.SessionSecret)
+	if sess == nil {
+		api.Respond(w, r, api.Error("failed to get session"))
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		api.Respond(w, r, api.Error("failed to parse form"))
+		return
+	}
+
+	if h.config.ReadOnlyMode {
+		api.Respond(w, r, api.Error("write operations are not allowed in read-only mode"))
+		return
+	}
+	if h.config.SafeModeDefault && strings.TrimSpace(r.Form.Get("confirm")) != "yes" {
+		api.Respond(w, r, api.Error("confirmation required (set confirm=yes)"))
+		return
+	}
+
+	name := strings.TrimSpace(r.Form.Get("profile"))
+	file := strings.TrimSpace(r.Form.Get("backup"))
+	if file == "" {
+		api.Respond(w, r, api.Error("backup is required"))
+		return
+	}
+	list, err := h.backups.List(name)
+	if err != nil {
+		api.Respond(w, r, api.Error(err.Error()))
+		return
+	}
+	found := false
+	for _, b := range list {
+		found = found || b.Name == file
+	}
+	if !found {
+		api.Respond(w, r, api.Error("backup not found"))
+		return
+	}
+
+	audit.SetObject(r.Context(), name, file)
+	job := audit.StartJob(r.Context())
+	id, err := h.jobs.Submit(jobs.Spec{Kind: jobs.KindRestore, Owner: sess.ID,
+		Run: func(ctx context.Context, t *jobs.Task) (any, error) {
+			ctx = job.Context(ctx)
+			summary, err := h.backups.Restore(ctx, name, file, sqlscript.Options{
+				Progress:  func(s sqlscript.Summary) { t.Progress(s) },
+				Executing: func(sql string) { audit.AddSQL(ctx, sql) },
+			})
+			if err == nil && summary.Stopped {
+				err = fmt.Errorf("restore stopped at line %d: %s", summary.Errors[0].Line, summary.Errors[0].Message)
+			}
+			audit.AddRowsAffected(ctx, summary.RowsAffected)
+			job.Finish(ctx, err)
+			return summary, err
+		}})
+	if err != nil {
+		api.Respond(w, r, api.Error(err.Error()))
+		return
+	}
+	api.Respond(w, r, api.SuccessWithData("restore started", map[string]any{"job_id": id}))
+}
@@ -0,0 +1,193 @@
+package api_backup_restore_test
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dracory/weebase/api/api_backup_create"
+	"github.com/dracory/weebase/api/api_backup_restore"
+	"github.com/dracory/weebase/api/api_backups_list"
+	"github.com/dracory/weebase/api/api_job_status"
+	"github.com/dracory/weebase/shared/backup"
+	"github.com/dracory/weebase/shared/jobs"
+	"github.com/dracory/weebase/shared/session"
+	"github.com/dracory/weebase/shared/types"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+type fixture struct {
+	config  types.Config
+	db      *sql.DB
+	dir     string
+	backups *backup.Scheduler
+	runner  *jobs.Runner
+	cookie  *http.Cookie
+}
+
+func setup(t *testing.T, retain int) *fixture {
+	dir := t.TempDir()
+	dbPath := filepath.Join(dir, "app.db")
+	db, err := sql.Open("sqlite3", dbPath)
+	if err != nil {
+		t.Fatalf("failed to open SQLite database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	for _, stmt := range []string{
+		`CREATE TABLE items (id INTEGER PRIMARY KEY, name TEXT NOT NULL)`,
+		`INSERT INTO items (id, name) VALUES (1, 'apple'), (2, 'pear'), (3, 'plum')`,
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatalf("failed to execute %q: %v", stmt, err)
+		}
+	}
+
+	profile := types.BackupProfile{Name: "app", Driver: "sqlite", DSN: dbPath, Schedule: "@daily", Dir: filepath.Join(dir, "backups"), Retain: retain}
+	config := types.Config{SessionSecret: "test-secret", SafeModeDefault: true, BackupProfiles: []types.BackupProfile{profile}}
+	backups, err := backup.NewScheduler(config.BackupProfiles, nil)
+	if err != nil {
+		t.Fatalf("failed to create scheduler: %v", err)
+	}
+
+	sess := &session.Session{ID: "test-session", CreatedAt: time.Now()}
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	w := httptest.NewRecorder()
+	session.SaveSession(w, req, sess, "test-secret")
+
+	return &fixture{
+		config:  config,
+		db:      db,
+		dir:     profile.Dir,
+		backups: backups,
+		runner:  jobs.NewRunner(jobs.NewMemoryStore(), jobs.Options{ArtifactDir: filepath.Join(dir, "jobs")}),
+		cookie:  w.Result().Cookies()[0],
+	}
+}
+
+type response struct {
+	Status  string `json:"status"`
+	Message string `json:"message"`
+	Data    struct {
+		JobID    string           `json:"job_id"`
+		Job      jobs.Status      `json:"job"`
+		Profiles []backup.Profile `json:"profiles"`
+		Backups  []backup.Backup  `json:"backups"`
+	} `json:"data"`
+}
+
+func (f *fixture) call(t *testing.T, handle http.HandlerFunc, method string, form url.Values) response {
+	var req *http.Request
+	if method == http.MethodPost {
+		req = httptest.NewRequest(method, "/", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	} else {
+		req = httptest.NewRequest(method, "/?"+form.Encode(), nil)
+	}
+	req.AddCookie(f.cookie)
+	w := httptest.NewRecorder()
+	handle(w, req)
+
+	var resp response
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to decode response %q: %v", w.Body.String(), err)
+	}
+	return resp
+}
+
+// wait polls a job until it is finished
+func (f *fixture) wait(t *testing.T, started response) jobs.Status {
+	if started.Status != "success" || started.Data.JobID == "" {
+		t.Fatalf("failed to start job: %+v", started)
+	}
+	var job jobs.Status
+	for deadline := time.Now().Add(10 * time.Second); time.Now().Before(deadline); time.Sleep(20 * time.Millisecond) {
+		job = f.call(t, api_job_status.New(f.config, f.runner).Handle, http.MethodGet, url.Values{"job_id": {started.Data.JobID}}).Data.Job
+		if job.Done() {
+			break
+		}
+	}
+	return job
+}
+
+func TestBackup_TakeListRestore(t *testing.T) {
+	f := setup(t, 0)
+
+	profiles := f.call(t, api_backups_list.New(f.config, f.backups).Handle, http.MethodGet, nil).Data.Profiles
+	if len(profiles) != 1 || profiles[0].Name != "app" || profiles[0].NextRun == nil {
+		t.Fatalf("unexpected profiles: %+v", profiles)
+	}
+
+	job := f.wait(t, f.call(t, api_backup_create.New(f.config, f.backups, f.runner).Handle, http.MethodPost, url.Values{"profile": {"app"}}))
+	if job.State != jobs.StateDone || job.Kind != jobs.KindBackup {
+		t.Fatalf("backup failed: %+v", job)
+	}
+
+	list := f.call(t, api_backups_list.New(f.config, f.backups).Handle, http.MethodGet, url.Values{"profile": {"app"}}).Data.Backups
+	if len(list) != 1 || list[0].Size == 0 || len(list[0].Checksum) != 64 || !strings.HasPrefix(list[0].Name, "app-") {
+		t.Fatalf("unexpected backups: %+v", list)
+	}
+
+	if _, err := f.db.Exec(`DELETE FROM items WHERE id > 1`); err != nil {
+		t.Fatalf("failed to delete rows: %v", err)
+	}
+
+	restore := api_backup_restore.New(f.config, f.backups, f.runner).Handle
+	if resp := f.call(t, restore, http.MethodPost, url.Values{"profile": {"app"}, "backup": {list[0].Name}}); resp.Status != "error" || !strings.Contains(resp.Message, "confirm") {
+		t.Errorf("expected safe mode to require confirmation: %+v", resp)
+	}
+	if resp := f.call(t, restore, http.MethodPost, url.Values{"profile": {"app"}, "backup": {"../app.db"}, "confirm": {"yes"}}); resp.Status != "error" {
+		t.Errorf("expected an unknown backup to be rejected: %+v", resp)
+	}
+
+	job = f.wait(t, f.call(t, restore, http.MethodPost, url.Values{"profile": {"app"}, "backup": {list[0].Name}, "confirm": {"yes"}}))
+	if job.State != jobs.StateDone {
+		t.Fatalf("restore failed: %+v", job)
+	}
+	var count int
+	if err := f.db.QueryRow(`SELECT COUNT(*) FROM items`).Scan(&count); err != nil || count != 3 {
+		t.Errorf("expected 3 rows after the restore, got %d (%v)", count, err)
+	}
+
+	// a damaged backup is refused before anything is replayed
+	if err := os.WriteFile(filepath.Join(f.dir, list[0].Name), []byte("garbage"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	job = f.wait(t, f.call(t, restore, http.MethodPost, url.Values{"profile": {"app"}, "backup": {list[0].Name}, "confirm": {"yes"}}))
+	if job.State != jobs.StateFailed || !strings.Contains(job.Error, "checksum") {
+		t.Errorf("expected the damaged backup to be refused: %+v", job)
+	}
+}
+
+func TestBackup_Retention(t *testing.T) {
+	f := setup(t, 2)
+
+	// older backups from earlier runs
+	if err := os.MkdirAll(f.dir, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"app-20240101-030000.sql.gz", "app-20240102-030000.sql.gz", "other-20240101-030000.sql.gz"} {
+		if err := os.WriteFile(filepath.Join(f.dir, name), []byte("x"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	job := f.wait(t, f.call(t, api_backup_create.New(f.config, f.backups, f.runner).Handle, http.MethodPost, url.Values{"profile": {"app"}}))
+	if job.State != jobs.StateDone {
+		t.Fatalf("backup failed: %+v", job)
+	}
+
+	list := f.call(t, api_backups_list.New(f.config, f.backups).Handle, http.MethodGet, url.Values{"profile": {"app"}}).Data.Backups
+	if len(list) != 2 || list[1].Name != "app-20240102-030000.sql.gz" {
+		t.Errorf("expected the newest 2 backups to be kept: %+v", list)
+	}
+	if _, err := os.Stat(filepath.Join(f.dir, "other-20240101-030000.sql.gz")); err != nil {
+		t.Errorf("pruning touched a file of another profile: %v", err)
+	}
+}
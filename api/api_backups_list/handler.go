@@ -0,0 +1,46 @@
+package api_backups_list
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/dracory/api"
+	"github.com/dracory/weebase/shared/backup"
+	"github.com/dracory/weebase/shared/session"
+	"github.com/dracory/weebase/shared/types"
+)
+
+// BackupsList lists the backup profiles, or the backups of one profile
+type BackupsList struct {
+	config  types.Config
+	backups *backup.Scheduler
+}
+
+// New creates a new BackupsList handler
+func New(config types.Config, backups *backup.Scheduler) *BackupsList {
+	return &BackupsList{config: config, backups: backups}
+}
+
+// Handle processes the request. Without parameters the profiles are listed
+// with their schedule and next run; with "profile" its backups are listed,
+// newest first, with their size and SHA-256 checksum.
+func (h *BackupsList) Handle(w http.ResponseWriter, r *http.Request) {
+	sess := session.EnsureSession(w, r, h.config.SessionSecret)
+	if sess == nil {
+		api.Respond(w, r, api.Error("failed to get session"))
+		return
+	}
+
+	name := strings.TrimSpace(r.URL.Query().Get("profile"))
+	if name == "" {
+		api.Respond(w, r, api.SuccessWithData("profiles listed", map[string]any{"profiles": h.backups.Profiles()}))
+		return
+	}
+
+	list, err := h.backups.List(name)
+	if err != nil {
+		api.Respond(w, r, api.Error(err.Error()))
+		return
+	}
+	api.Respond(w, r, api.SuccessWithData("backups listed", map[string]any{"profile": name, "backups": list}))
+}
@@ -1,6 +1,7 @@
 package api_connect
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 	"net/url"
@@ -11,7 +12,14 @@ import (
 	"time"
 
 	"github.com/dracory/api"
+	"github.com/dracory/weebase/shared/auth"
+	"github.com/dracory/weebase/shared/connection"
+	"github.com/dracory/weebase/shared/connguard"
+	"github.com/dracory/weebase/shared/constants"
+	"github.com/dracory/weebase/shared/dialect"
 	"github.com/dracory/weebase/shared/driver"
+	"github.com/dracory/weebase/shared/ratelimit"
+	"github.com/dracory/weebase/shared/secrets"
 	"github.com/dracory/weebase/shared/session"
 	"github.com/dracory/weebase/shared/types"
 )
@@ -60,6 +68,13 @@ func (h *apiConnectController) ServeHTTP(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	// requests with a token have no session to connect: they name their
+	// connection on every request
+	if auth.BearerToken(r) != "" {
+		api.Respond(w, r, api.Error("requests with an API token name their connection in the "+auth.ProfileHeader+" header"))
+		return
+	}
+
 	// Verify CSRF token
 	csrfToken := r.FormValue("csrf_token")
 	if csrfToken == "" {
@@ -77,6 +92,11 @@ func (h *apiConnectController) ServeHTTP(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	if id := strings.TrimSpace(r.Form.Get("profile_id")); id != "" {
+		h.connectProfile(w, r, s, id)
+		return
+	}
+
 	// Get connection parameters
 	req := ConnectRequest{
 		Driver:   strings.TrimSpace(r.Form.Get("driver")),
@@ -94,6 +114,16 @@ func (h *apiConnectController) ServeHTTP(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	// Secrets are only resolved for server-configured profiles; the policy
+	// refuses references in the DSN, and the fields are refused here as
+	// the builder may encode them past it
+	for _, field := range []string{req.Server, req.Port, req.Username, req.Password, req.Database} {
+		if secrets.HasReference(field) {
+			api.Respond(w, r, api.Error("secret references are only resolved in server-configured profiles"))
+			return
+		}
+	}
+
 	// Build DSN if not provided
 	if req.DSN == "" {
 		dsn, err := buildDSNFromFields(req.Driver, req.Server, req.Port, req.Username, req.Password, req.Database)
@@ -104,12 +134,31 @@ func (h *apiConnectController) ServeHTTP(w http.ResponseWriter, r *http.Request)
 		req.DSN = dsn
 	}
 
-	// Test the connection
+	if err := h.cfg.ConnectPolicy.Check(r.Context(), req.Driver, req.DSN); err != nil {
+		api.Respond(w, r, api.Error(err.Error()))
+		return
+	}
+
+	// A new SQLite file may need its directory, created only inside the
+	// configured roots
+	if dialect.Normalize(req.Driver) == constants.DriverSQLite && h.cfg.ConnectPolicy != nil && len(h.cfg.ConnectPolicy.SQLiteRoots) > 0 {
+		if file := connguard.SQLiteFile(req.DSN); file != "" {
+			if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+				api.Respond(w, r, api.Error(fmt.Sprintf("failed to create directory for SQLite file: %v", err)))
+				return
+			}
+		}
+	}
+
+	// Test the connection; failures are counted by the server tried
+	target := connguard.Server(req.Driver, req.DSN)
 	db, err := driver.OpenDBWithDSN(req.Driver, req.DSN)
 	if err != nil {
+		ratelimit.Report(r.Context(), target, true)
 		api.Respond(w, r, api.Error(fmt.Sprintf("connection failed: %v", err)))
 		return
 	}
+	ratelimit.Report(r.Context(), target, false)
 
 	// Close the test connection
 	sqlDB, err := db.DB()
@@ -130,6 +179,7 @@ func (h *apiConnectController) ServeHTTP(w http.ResponseWriter, r *http.Request)
 		ID:        s.ID,
 		CreatedAt: s.CreatedAt,
 		Conn:      s.Conn,
+		User:      s.User,
 	}
 
 	// Save the updated session with proper cookie settings
@@ -140,8 +190,52 @@ func (h *apiConnectController) ServeHTTP(w http.ResponseWriter, r *http.Request)
 	}))
 }
 
+// connectProfile opens a server-configured profile. Its secrets are
+// resolved here only to test the connection: the session keeps the profile
+// ID, and the DSN is resolved again each time the session is read.
+func (h *apiConnectController) connectProfile(w http.ResponseWriter, r *http.Request, s *session.Session, id string) {
+	drv, dsn, err := connection.ResolveProfile(r.Context(), h.cfg, id)
+	if errors.Is(err, connection.ErrUnknownProfile) {
+		api.Respond(w, r, api.Error(err.Error()))
+		return
+	}
+	target := "profile:" + id
+	if err != nil {
+		ratelimit.Report(r.Context(), target, true)
+		api.Respond(w, r, api.Error("failed to resolve the profile"))
+		return
+	}
+
+	db, err := driver.OpenDBWithDSN(drv, dsn)
+	if err != nil {
+		ratelimit.Report(r.Context(), target, true)
+		api.Respond(w, r, api.Error("connection failed"))
+		return
+	}
+	ratelimit.Report(r.Context(), target, false)
+	if sqlDB, err := db.DB(); err == nil {
+		sqlDB.Close()
+	}
+
+	session.SaveSession(w, r, &session.Session{
+		ID:        s.ID,
+		CreatedAt: s.CreatedAt,
+		Conn: &session.ActiveConnection{
+			ID:        session.NewRandomID(),
+			Driver:    drv,
+			ProfileID: id,
+			LastUsed:  time.Now(),
+		},
+		User: s.User,
+	}, h.cfg.SessionSecret)
+
+	api.Respond(w, r, api.SuccessWithData("connected", map[string]any{
+		"driver":     drv,
+		"profile_id": id,
+	}))
+}
+
 // buildDSNFromFields constructs a DSN from discrete connection fields per driver.
-// For sqlite, if a file path is provided, ensures parent directory exists.
 func buildDSNFromFields(driver, host, port, user, pass, db string) (string, error) {
 	switch strings.ToLower(driver) {
 	case "postgres", "pg", "postgresql":
@@ -187,15 +281,6 @@ func buildDSNFromFields(driver, host, port, user, pass, db string) (string, erro
 		return dsn, nil
 
 	case "sqlite", "sqlite3":
-		// Ensure directory exists for SQLite file
-		if db != "" && db != ":memory:" {
-			dir := filepath.Dir(db)
-			if dir != "." {
-				if err := os.MkdirAll(dir, 0755); err != nil {
-					return "", fmt.Errorf("failed to create directory for SQLite file: %v", err)
-				}
-			}
-		}
 		return db, nil
 
 	case "sqlserver", "mssql":
@@ -1,14 +1,20 @@
 package api_connect_test
 
 import (
+	"context"
+	"crypto/sha256"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/dracory/weebase/api/api_connect"
+	"github.com/dracory/weebase/shared/connection"
+	"github.com/dracory/weebase/shared/secrets"
 	"github.com/dracory/weebase/shared/session"
 	"github.com/dracory/weebase/shared/types"
 )
@@ -139,3 +145,70 @@ func TestConnectRequest(t *testing.T) {
 		})
 	}
 }
+
+// TestApiConnect_Profile opens a server profile whose DSN is a secret
+// reference; the resolved path must reach neither the cookie nor the body
+func TestApiConnect_Profile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "secret-location.db")
+	cfg := types.Config{
+		SessionSecret:  "test-secret",
+		EnabledDrivers: []string{"sqlite"},
+		SecretResolver: secrets.Func(func(_ context.Context, ref string) (string, error) {
+			if ref != "vault:main" {
+				return "", secrets.ErrNotAllowed
+			}
+			return path, nil
+		}),
+		ConnectionProfiles: []types.ConnectionProfile{{ID: "main", Name: "Main", Driver: "sqlite", DSN: "${vault:main}"}},
+	}
+
+	post := func(profileID string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/connect", nil)
+		session.SaveSession(rr, req, &session.Session{ID: "s1", CreatedAt: time.Now(), CSRFToken: "tok"}, cfg.SessionSecret)
+
+		form := url.Values{"profile_id": {profileID}, "csrf_token": {"tok"}}
+		req = httptest.NewRequest(http.MethodPost, "/connect", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.AddCookie(rr.Result().Cookies()[0])
+		rr = httptest.NewRecorder()
+		api_connect.New(cfg).ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := post("main")
+	if !strings.Contains(rr.Body.String(), `"status":"success"`) {
+		t.Fatalf("expected the profile to connect, got %s", rr.Body.String())
+	}
+	if strings.Contains(rr.Body.String(), path) {
+		t.Errorf("the response must not hold the resolved DSN: %s", rr.Body.String())
+	}
+
+	cookies := rr.Result().Cookies()
+	if len(cookies) == 0 {
+		t.Fatal("no session cookie set")
+	}
+	key := sha256.Sum256([]byte(cfg.SessionSecret))
+	data, err := session.DecodeSessionData(cookies[0].Value, key[:])
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	raw, _ := json.Marshal(data)
+	if strings.Contains(string(raw), path) || !strings.Contains(string(raw), `"profile_id":"main"`) {
+		t.Errorf("expected the cookie to keep only the profile ID, got %s", raw)
+	}
+
+	// the session opens the profile again from its ID
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.AddCookie(cookies[0])
+	req = req.WithContext(session.WithProfileResolver(req.Context(), func(ctx context.Context, id string) (string, string, error) {
+		return connection.ResolveProfile(ctx, cfg, id)
+	}))
+	if s := session.EnsureSession(httptest.NewRecorder(), req, cfg.SessionSecret); s.Conn == nil || s.Conn.DSN != path {
+		t.Errorf("expected the session to resolve the profile to %s, got %+v", path, s.Conn)
+	}
+
+	if rr := post("other"); !strings.Contains(rr.Body.String(), "unknown connection profile") {
+		t.Errorf("expected an unknown profile to be refused, got %s", rr.Body.String())
+	}
+}
@@ -0,0 +1,205 @@
+package api_data_diff
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/dracory/api"
+	"github.com/dracory/weebase/shared/connection"
+	"github.com/dracory/weebase/shared/datadiff"
+	"github.com/dracory/weebase/shared/dialect"
+	"github.com/dracory/weebase/shared/jobs"
+	"github.com/dracory/weebase/shared/session"
+	"github.com/dracory/weebase/shared/types"
+)
+
+// DataDiff compares the rows of two tables with the same primary key (on one
+// connection or two) and produces the statements that reconcile the target
+type DataDiff struct {
+	config types.Config
+	jobs   *jobs.Runner
+}
+
+// New creates a new DataDiff handler; runner runs the comparisons started with async=yes
+func New(config types.Config, runner *jobs.Runner) *DataDiff {
+	return &DataDiff{config: config, jobs: runner}
+}
+
+// Handle processes the request.
+//
+// Both sides default to the session's connection; "source_driver"/"source_dsn"
+// and "target_driver"/"target_dsn" point a side elsewhere (ad-hoc connections
+// must be allowed). The tables are "source_schema"/"source_table" and
+// "target_schema"/"target_table", the target table defaulting to the source's.
+// "chunk_size" sets the rows per hashed key range and "max_rows" the row
+// differences listed. "format=sql" downloads the reconciling script instead
+// of returning JSON; async=yes runs the comparison in the background and
+// keeps the script as the job's download.
+func (h *DataDiff) Handle(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		api.Respond(w, r, api.Error("method not allowed"))
+		return
+	}
+
+	sess := session.EnsureSession(w, r, h.config.SessionSecret)
+	if sess == nil {
+		api.Respond(w, r, api.Error("failed to get session"))
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		api.Respond(w, r, api.Error("failed to parse form"))
+		return
+	}
+
+	source, err := connection.FromForm(r.Context(), h.config, sess, r.Form, "source_")
+	if err != nil {
+		api.Respond(w, r, api.Error(err.Error()))
+		return
+	}
+	target, err := connection.FromForm(r.Context(), h.config, sess, r.Form, "target_")
+	if err != nil {
+		api.Respond(w, r, api.Error(err.Error()))
+		return
+	}
+
+	src := datadiff.Endpoint{
+		Driver: source.Driver,
+		Schema: strings.TrimSpace(r.Form.Get("source_schema")),
+		Table:  strings.TrimSpace(r.Form.Get("source_table")),
+	}
+	dst := datadiff.Endpoint{
+		Driver: target.Driver,
+		Schema: strings.TrimSpace(r.Form.Get("target_schema")),
+		Table:  strings.TrimSpace(r.Form.Get("target_table")),
+	}
+	if src.Table == "" {
+		api.Respond(w, r, api.Error("source_table is required"))
+		return
+	}
+	if dst.Table == "" {
+		dst.Table = src.Table
+	}
+	for _, ident := range []string{src.Schema, src.Table, dst.Schema, dst.Table} {
+		if ident != "" && !dialect.SanitizeIdent(ident) {
+			api.Respond(w, r, api.Error("invalid table or schema identifier"))
+			return
+		}
+	}
+	if source == target && tableKey(src.Driver, src.Schema, src.Table) == tableKey(dst.Driver, dst.Schema, dst.Table) {
+		api.Respond(w, r, api.Error("source and target are the same table"))
+		return
+	}
+
+	opts := datadiff.Options{}
+	if opts.ChunkSize, err = positive(r.Form.Get("chunk_size")); err != nil {
+		api.Respond(w, r, api.Error("chunk_size must be a positive number"))
+		return
+	}
+	if opts.MaxRows, err = positive(r.Form.Get("max_rows")); err != nil {
+		api.Respond(w, r, api.Error("max_rows must be a positive number"))
+		return
+	}
+
+	if src.DB, err = source.Open(r.Context()); err != nil {
+		api.Respond(w, r, api.Error(fmt.Sprintf("source: failed to connect to database: %v", err)))
+		return
+	}
+	if dst.DB, err = target.Open(r.Context()); err != nil {
+		src.DB.Close()
+		api.Respond(w, r, api.Error(fmt.Sprintf("target: failed to connect to database: %v", err)))
+		return
+	}
+
+	if r.Form.Get("async") == "yes" {
+		id, err := h.jobs.Submit(jobs.Spec{Kind: jobs.KindDataDiff, Owner: sess.ID,
+			Run: func(ctx context.Context, t *jobs.Task) (any, error) {
+				defer src.DB.Close()
+				defer dst.DB.Close()
+				out, err := t.Artifact(dst.Table+"_reconcile.sql", "application/sql; charset=utf-8")
+				if err != nil {
+					return nil, err
+				}
+				opts.Script = out
+				opts.Progress = func(r datadiff.Result) { t.Progress(r) }
+				return datadiff.Run(ctx, src, dst, opts)
+			}})
+		if err != nil {
+			src.DB.Close()
+			dst.DB.Close()
+			api.Respond(w, r, api.Error(err.Error()))
+			return
+		}
+		api.Respond(w, r, api.SuccessWithData("data diff started", map[string]any{"job_id": id}))
+		return
+	}
+	defer src.DB.Close()
+	defer dst.DB.Close()
+
+	if r.Form.Get("format") == "sql" {
+		out := &download{w: w, name: dst.Table + "_reconcile.sql"}
+		opts.Script = out
+		if _, err := datadiff.Run(r.Context(), src, dst, opts); err != nil {
+			if !out.started {
+				api.Respond(w, r, api.Error(fmt.Sprintf("data diff failed: %v", err)))
+				return
+			}
+			// headers are gone; the truncated download is all the client gets
+			slog.Error("data diff failed", slog.String("table", src.Table), slog.String("error", err.Error()))
+		}
+		return
+	}
+
+	result, err := datadiff.Run(r.Context(), src, dst, opts)
+	if err != nil {
+		api.Respond(w, r, api.ErrorWithData(fmt.Sprintf("data diff failed: %v", err), map[string]any{"result": result}))
+		return
+	}
+	api.Respond(w, r, api.SuccessWithData("data_diff", map[string]any{
+		"result":    result,
+		"identical": result.Identical(),
+	}))
+}
+
+// download sends the script as an attachment, setting the headers on the
+// first write so errors found before any output can still go out as JSON
+type download struct {
+	w       http.ResponseWriter
+	name    string
+	started bool
+}
+
+func (d *download) Write(p []byte) (int, error) {
+	if !d.started {
+		d.started = true
+		d.w.Header().Set("Content-Type", "application/sql; charset=utf-8")
+		d.w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, d.name))
+		d.w.Header().Set("Cache-Control", "no-store")
+	}
+	return d.w.Write(p)
+}
+
+// positive parses an optional positive number; empty means 0, the default
+func positive(v string) (int, error) {
+	v = strings.TrimSpace(v)
+	if v == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 1 {
+		return 0, fmt.Errorf("not a positive number: %s", v)
+	}
+	return n, nil
+}
+
+// tableKey identifies a table on a connection, filling in the default schema
+func tableKey(drv, schema, table string) string {
+	if schema == "" {
+		schema = dialect.DefaultSchema(drv)
+	}
+	return schema + "." + table
+}
@@ -0,0 +1,292 @@
+package api_data_diff_test
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dracory/weebase/api/api_data_diff"
+	"github.com/dracory/weebase/api/api_job_status"
+	"github.com/dracory/weebase/shared/jobs"
+	"github.com/dracory/weebase/shared/testutil"
+	"github.com/dracory/weebase/shared/types"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// runner runs the jobs started by the handlers under test
+var runner = jobs.NewRunner(jobs.NewMemoryStore(), jobs.Options{})
+
+// createDB creates a file-backed SQLite database initialised with the given statements
+func createDB(t *testing.T, stmts ...string) (*sql.DB, string) {
+	tempFile, err := os.CreateTemp("", "testdb-*.db")
+	if err != nil {
+		t.Fatalf("failed to create temp file: %v", err)
+	}
+	tempFile.Close()
+	t.Cleanup(func() { os.Remove(tempFile.Name()) })
+
+	db, err := sql.Open("sqlite3", tempFile.Name())
+	if err != nil {
+		t.Fatalf("failed to open SQLite database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	for _, stmt := range stmts {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatalf("failed to execute %q: %v", stmt, err)
+		}
+	}
+	return db, tempFile.Name()
+}
+
+type diffResponse struct {
+	Status  string `json:"status"`
+	Message string `json:"message"`
+	Data    struct {
+		Identical bool   `json:"identical"`
+		JobID     string `json:"job_id"`
+		Result    struct {
+			Key        []string `json:"key"`
+			TargetOnly []string `json:"target_only"`
+			Ranges     int64    `json:"ranges"`
+			Differing  []struct {
+				From []any `json:"from"`
+				To   []any `json:"to"`
+			} `json:"differing_ranges"`
+			Added   int64 `json:"added"`
+			Removed int64 `json:"removed"`
+			Changed int64 `json:"changed"`
+			Rows    []struct {
+				Kind    string   `json:"kind"`
+				Key     []any    `json:"key"`
+				Changed []string `json:"changed"`
+				SQL     string   `json:"sql"`
+			} `json:"rows"`
+			Truncated bool `json:"truncated"`
+		} `json:"result"`
+	} `json:"data"`
+}
+
+var config = types.Config{
+	SessionSecret:         "test-secret",
+	EnabledDrivers:        []string{"sqlite"},
+	AllowAdHocConnections: true,
+}
+
+func post(t *testing.T, cookie *http.Cookie, form url.Values) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("POST", "/", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.AddCookie(cookie)
+	w := httptest.NewRecorder()
+	api_data_diff.New(config, runner).Handle(w, req)
+	return w
+}
+
+func diff(t *testing.T, cookie *http.Cookie, form url.Values) diffResponse {
+	w := post(t, cookie, form)
+	var response diffResponse
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	return response
+}
+
+func setup(t *testing.T) (*sql.DB, *http.Cookie, url.Values) {
+	source := []string{`CREATE TABLE items (id INTEGER PRIMARY KEY, name TEXT NOT NULL, price DECIMAL(10,2), note TEXT)`}
+	target := []string{`CREATE TABLE items (id INTEGER PRIMARY KEY, name TEXT NOT NULL, price DECIMAL(10,2), note TEXT, legacy TEXT)`}
+	for i := 1; i <= 20; i++ {
+		source = append(source, `INSERT INTO items (id, name, price) VALUES (`+strconv.Itoa(i)+`, 'item `+strconv.Itoa(i)+`', 1.5)`)
+		// the target misses 7, has a different name for 12 and keeps 25 that the source dropped
+		switch i {
+		case 7:
+		case 12:
+			target = append(target, `INSERT INTO items (id, name, price) VALUES (12, 'old name', 1.5)`)
+		default:
+			target = append(target, `INSERT INTO items (id, name, price) VALUES (`+strconv.Itoa(i)+`, 'item `+strconv.Itoa(i)+`', 1.5)`)
+		}
+	}
+	target = append(target, `INSERT INTO items (id, name, price) VALUES (25, 'gone', 3)`)
+
+	_, sourcePath := createDB(t, source...)
+	targetDB, targetPath := createDB(t, target...)
+	form := url.Values{
+		"target_driver": {"sqlite"},
+		"target_dsn":    {targetPath},
+		"source_table":  {"items"},
+		"chunk_size":    {"5"},
+	}
+	return targetDB, testutil.SessionCookie(t, sourcePath), form
+}
+
+func TestDataDiff_SQLiteToSQLite(t *testing.T) {
+	targetDB, cookie, form := setup(t)
+
+	response := diff(t, cookie, form)
+	if response.Status != "success" {
+		t.Fatalf("expected success, got %s: %s", response.Status, response.Message)
+	}
+	res := response.Data.Result
+	if response.Data.Identical || res.Added != 1 || res.Removed != 1 || res.Changed != 1 {
+		t.Fatalf("expected one added, removed and changed row, got %+v", res)
+	}
+	if len(res.Key) != 1 || res.Key[0] != "id" || len(res.TargetOnly) != 1 || res.TargetOnly[0] != "legacy" {
+		t.Errorf("unexpected key or columns: %+v", res)
+	}
+	// 4 chunks of 5 plus the tail; only the chunks holding 7 and 12 and the tail differ
+	if res.Ranges != 5 || len(res.Differing) != 3 {
+		t.Errorf("expected 3 of 5 ranges to differ, got %d of %d: %+v", len(res.Differing), res.Ranges, res.Differing)
+	}
+
+	want := map[string]string{
+		"added":   `INSERT INTO "items" ("id", "name", "price", "note") VALUES (7, 'item 7', 1.5, NULL);`,
+		"changed": `UPDATE "items" SET "name" = 'item 12' WHERE "id" = 12;`,
+		"removed": `DELETE FROM "items" WHERE "id" = 25;`,
+	}
+	var statements []string
+	for _, row := range res.Rows {
+		if row.SQL != want[row.Kind] {
+			t.Errorf("%s row: got %s, want %s", row.Kind, row.SQL, want[row.Kind])
+		}
+		statements = append(statements, row.SQL)
+	}
+	if len(statements) != 3 {
+		t.Fatalf("expected 3 rows, got %+v", res.Rows)
+	}
+
+	// the downloaded script reconciles the target
+	w := post(t, cookie, url.Values{"target_driver": form["target_driver"], "target_dsn": form["target_dsn"],
+		"source_table": {"items"}, "format": {"sql"}})
+	if got := w.Header().Get("Content-Disposition"); got != `attachment; filename="items_reconcile.sql"` {
+		t.Fatalf("Content-Disposition = %q (body %s)", got, w.Body.String())
+	}
+	for _, stmt := range statements {
+		if !strings.Contains(w.Body.String(), stmt) {
+			t.Errorf("script is missing %s:\n%s", stmt, w.Body.String())
+		}
+	}
+	if _, err := targetDB.Exec(w.Body.String()); err != nil {
+		t.Fatalf("failed to apply script: %v\n%s", err, w.Body.String())
+	}
+	response = diff(t, cookie, form)
+	if !response.Data.Identical {
+		t.Errorf("expected tables to be identical after reconciling, got %+v", response.Data.Result)
+	}
+}
+
+func TestDataDiff_MaxRowsAndCompositeKey(t *testing.T) {
+	_, sourcePath := createDB(t,
+		`CREATE TABLE grid (x INTEGER, y INTEGER, v TEXT, PRIMARY KEY (x, y))`,
+		`INSERT INTO grid VALUES (1, 1, 'a'), (1, 2, 'b'), (2, 1, 'c'), (2, 2, 'd'), (3, 1, 'e')`,
+	)
+	_, targetPath := createDB(t,
+		`CREATE TABLE grid (x INTEGER, y INTEGER, v TEXT, PRIMARY KEY (x, y))`,
+		`INSERT INTO grid VALUES (1, 1, 'a'), (2, 1, 'C'), (2, 2, 'd'), (3, 1, 'E')`,
+	)
+
+	response := diff(t, testutil.SessionCookie(t, sourcePath), url.Values{
+		"target_driver": {"sqlite"},
+		"target_dsn":    {targetPath},
+		"source_table":  {"grid"},
+		"chunk_size":    {"2"},
+		"max_rows":      {"2"},
+	})
+	if response.Status != "success" {
+		t.Fatalf("expected success, got %s: %s", response.Status, response.Message)
+	}
+	res := response.Data.Result
+	if res.Added != 1 || res.Changed != 2 || res.Removed != 0 {
+		t.Errorf("unexpected counts: %+v", res)
+	}
+	if !res.Truncated || len(res.Rows) != 2 {
+		t.Errorf("expected 2 listed rows and truncated, got %+v", res)
+	}
+	if len(res.Rows) > 0 && (res.Rows[0].Kind != "added" || len(res.Rows[0].Key) != 2) {
+		t.Errorf("unexpected first row: %+v", res.Rows[0])
+	}
+}
+
+func TestDataDiff_Async(t *testing.T) {
+	_, cookie, form := setup(t)
+	form.Set("async", "yes")
+
+	response := diff(t, cookie, form)
+	if response.Status != "success" || response.Data.JobID == "" {
+		t.Fatalf("expected a job, got %s: %s", response.Status, response.Message)
+	}
+
+	status := api_job_status.New(config, runner)
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		req := httptest.NewRequest("GET", "/?job_id="+response.Data.JobID, nil)
+		req.AddCookie(cookie)
+		w := httptest.NewRecorder()
+		status.Handle(w, req)
+		var job struct {
+			Data struct {
+				Job struct {
+					State    string `json:"state"`
+					Error    string `json:"error"`
+					Artifact *struct {
+						Name string `json:"name"`
+					} `json:"artifact"`
+					Result struct {
+						Added int64 `json:"added"`
+					} `json:"result"`
+				} `json:"job"`
+			} `json:"data"`
+		}
+		if err := json.NewDecoder(w.Body).Decode(&job); err != nil {
+			t.Fatalf("failed to decode job status: %v", err)
+		}
+		j := job.Data.Job
+		if j.State == "queued" || j.State == "running" {
+			if time.Now().After(deadline) {
+				t.Fatal("job did not finish")
+			}
+			time.Sleep(20 * time.Millisecond)
+			continue
+		}
+		if j.State != "done" || j.Result.Added != 1 || j.Artifact == nil || j.Artifact.Name != "items_reconcile.sql" {
+			t.Fatalf("unexpected job: %+v", j)
+		}
+		break
+	}
+}
+
+func TestDataDiff_Errors(t *testing.T) {
+	_, sourcePath := createDB(t,
+		`CREATE TABLE a (id INTEGER PRIMARY KEY, v TEXT)`,
+		`CREATE TABLE nokey (v TEXT)`,
+		`CREATE TABLE b (code TEXT PRIMARY KEY, v TEXT)`,
+	)
+	cookie := testutil.SessionCookie(t, sourcePath)
+
+	tests := []struct {
+		name    string
+		form    url.Values
+		message string
+	}{
+		{"missing table", url.Values{}, "source_table is required"},
+		{"same table", url.Values{"source_table": {"a"}}, "source and target are the same table"},
+		{"bad identifier", url.Values{"source_table": {"a; --"}}, "invalid table or schema identifier"},
+		{"bad chunk size", url.Values{"source_table": {"a"}, "target_table": {"b"}, "chunk_size": {"0"}}, "chunk_size must be a positive number"},
+		{"no primary key", url.Values{"source_table": {"nokey"}, "target_table": {"a"}}, "data diff failed: the source table has no primary key"},
+		{"different keys", url.Values{"source_table": {"a"}, "target_table": {"b"}}, "data diff failed: the tables have different primary keys"},
+		{"unknown table", url.Values{"source_table": {"a"}, "target_table": {"missing"}, "format": {"sql"}}, "data diff failed: target: table not found: missing"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response := diff(t, cookie, tt.form)
+			if response.Status != "error" || response.Message != tt.message {
+				t.Errorf("got %s %q, want error %q", response.Status, response.Message, tt.message)
+			}
+		})
+	}
+}
@@ -0,0 +1,216 @@
+package api_dump
+
+import (
+	"compress/gzip"
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dracory/api"
+	"github.com/dracory/weebase/shared/driver"
+	"github.com/dracory/weebase/shared/dump"
+	"github.com/dracory/weebase/shared/jobs"
+	"github.com/dracory/weebase/shared/masking"
+	"github.com/dracory/weebase/shared/session"
+	"github.com/dracory/weebase/shared/types"
+)
+
+// Dump streams a SQL script with the structure and data of the connected
+// database, or of selected tables, as a download
+type Dump struct {
+	config types.Config
+	jobs   *jobs.Runner
+}
+
+// New creates a new Dump handler; runner runs the dumps started with async=yes
+func New(config types.Config, runner *jobs.Runner) *Dump {
+	return &Dump{config: config, jobs: runner}
+}
+
+// Handle processes the request.
+//
+// Parameters: schema, tables[] (empty for everything), structure
+// (drop_create, create or none), data ("no" to skip rows), no_data[] (tables
+// dumped without rows), batch_size and gzip=yes. With async=yes the dump is
+// written in the background; poll the job status with the returned job_id
+// and fetch the file through the job download once it is done.
+func (h *Dump) Handle(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		api.Respond(w, r, api.Error("method not allowed"))
+		return
+	}
+
+	sess := session.EnsureSession(w, r, h.config.SessionSecret)
+	if sess == nil || sess.Conn == nil {
+		api.Respond(w, r, api.Error("not connected to database"))
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		api.Respond(w, r, api.Error("failed to parse form"))
+		return
+	}
+
+	opts, err := optionsFromForm(r)
+	if err != nil {
+		api.Respond(w, r, api.Error(err.Error()))
+		return
+	}
+	if masker := masking.FromContext(r.Context()); masker != nil {
+		opts.Mask = masker.Writer
+	}
+	compress := r.Form.Get("gzip") == "yes"
+
+	db, err := driver.OpenSQLDB(sess.Conn.Driver, sess.Conn.DSN)
+	if err != nil {
+		api.Respond(w, r, api.Error(fmt.Sprintf("failed to connect to database: %v", err)))
+		return
+	}
+
+	if r.Form.Get("async") == "yes" {
+		h.submit(w, r, sess, db, opts, compress)
+		return
+	}
+	defer db.Close()
+
+	rc := http.NewResponseController(w)
+	flush := func() { _ = rc.Flush() }
+	opts.Progress = func(string, int64) { flush() }
+
+	// Introspect before committing to a download so errors can still be reported as JSON
+	dumper, err := dump.Prepare(r.Context(), db, sess.Conn.Driver, opts)
+	if err != nil {
+		api.Respond(w, r, api.Error(fmt.Sprintf("failed to read schema: %v", err)))
+		return
+	}
+
+	name := fileName(opts, compress)
+	var out io.Writer = w
+	if compress {
+		w.Header().Set("Content-Type", "application/gzip")
+		gz := gzip.NewWriter(w)
+		defer gz.Close()
+		out = gz
+		flush = func() {
+			_ = gz.Flush()
+			_ = rc.Flush()
+		}
+	} else {
+		w.Header().Set("Content-Type", "application/sql; charset=utf-8")
+	}
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, name))
+	w.Header().Set("Cache-Control", "no-store")
+
+	stats, err := dumper.Write(r.Context(), out)
+	if err != nil {
+		// headers are gone; mark the script as incomplete so it isn't mistaken for a full dump
+		fmt.Fprintf(out, "\n-- ERROR: dump incomplete: %v\n", err)
+		slog.Error("dump failed", slog.String("schema", opts.Schema), slog.Int64("rows", stats.Rows), slog.String("error", err.Error()))
+	}
+}
+
+// submit queues the dump as a background job writing to an artifact. The
+// schema is introspected first so errors can still be reported as JSON.
+func (h *Dump) submit(w http.ResponseWriter, r *http.Request, sess *session.Session, db *sql.DB, opts dump.Options, compress bool) {
+	// the task is known once the job runs, before any rows are written
+	var task *jobs.Task
+	opts.Progress = func(table string, rows int64) {
+		task.Progress(map[string]any{"table": table, "rows": rows})
+	}
+
+	dumper, err := dump.Prepare(r.Context(), db, sess.Conn.Driver, opts)
+	if err != nil {
+		db.Close()
+		api.Respond(w, r, api.Error(fmt.Sprintf("failed to read schema: %v", err)))
+		return
+	}
+
+	name := fileName(opts, compress)
+	contentType := "application/sql; charset=utf-8"
+	if compress {
+		contentType = "application/gzip"
+	}
+
+	id, err := h.jobs.Submit(jobs.Spec{Kind: jobs.KindDump, Owner: sess.ID,
+		Run: func(ctx context.Context, t *jobs.Task) (any, error) {
+			defer db.Close()
+			task = t
+			artifact, err := t.Artifact(name, contentType)
+			if err != nil {
+				return nil, err
+			}
+			if !compress {
+				return dumper.Write(ctx, artifact)
+			}
+			gz := gzip.NewWriter(artifact)
+			stats, err := dumper.Write(ctx, gz)
+			if closeErr := gz.Close(); err == nil {
+				err = closeErr
+			}
+			return stats, err
+		}})
+	if err != nil {
+		db.Close()
+		api.Respond(w, r, api.Error(err.Error()))
+		return
+	}
+	api.Respond(w, r, api.SuccessWithData("dump started", map[string]any{"job_id": id}))
+}
+
+// fileName names the dump after its schema and the current time
+func fileName(opts dump.Options, compress bool) string {
+	name := "dump"
+	if opts.Schema != "" {
+		name = opts.Schema
+	}
+	name += "-" + time.Now().UTC().Format("20060102-150405") + ".sql"
+	if compress {
+		name += ".gz"
+	}
+	return name
+}
+
+func optionsFromForm(r *http.Request) (dump.Options, error) {
+	opts := dump.DefaultOptions()
+	opts.Schema = strings.TrimSpace(r.Form.Get("schema"))
+	opts.Tables = nonEmpty(r.Form["tables[]"])
+	opts.NoData = nonEmpty(r.Form["no_data[]"])
+	opts.Data = r.Form.Get("data") != "no"
+
+	switch s := r.Form.Get("structure"); s {
+	case "":
+	case dump.StructureDropCreate, dump.StructureCreate, dump.StructureNone:
+		opts.Structure = s
+	default:
+		return opts, fmt.Errorf("invalid structure option: %s", s)
+	}
+
+	if v := strings.TrimSpace(r.Form.Get("batch_size")); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return opts, fmt.Errorf("batch_size must be a positive number")
+		}
+		opts.BatchSize = n
+	}
+
+	if opts.Structure == dump.StructureNone && !opts.Data {
+		return opts, fmt.Errorf("nothing to dump: enable structure or data")
+	}
+	return opts, nil
+}
+
+func nonEmpty(values []string) []string {
+	out := []string{}
+	for _, v := range values {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
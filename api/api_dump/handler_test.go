@@ -0,0 +1,202 @@
+package api_dump_test
+
+import (
+	"compress/gzip"
+	"database/sql"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/dracory/weebase/api/api_dump"
+	"github.com/dracory/weebase/shared/jobs"
+	"github.com/dracory/weebase/shared/sqlsplit"
+	"github.com/dracory/weebase/shared/testutil"
+	"github.com/dracory/weebase/shared/types"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// runner runs the jobs started by the handlers under test
+var runner = jobs.NewRunner(jobs.NewMemoryStore(), jobs.Options{})
+
+// createDB creates a file-backed SQLite database initialised with the given statements
+func createDB(t *testing.T, stmts ...string) (*sql.DB, string) {
+	tempFile, err := os.CreateTemp("", "testdb-*.db")
+	if err != nil {
+		t.Fatalf("failed to create temp file: %v", err)
+	}
+	tempFile.Close()
+	t.Cleanup(func() { os.Remove(tempFile.Name()) })
+
+	db, err := sql.Open("sqlite3", tempFile.Name())
+	if err != nil {
+		t.Fatalf("failed to open SQLite database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	for _, stmt := range stmts {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatalf("failed to execute %q: %v", stmt, err)
+		}
+	}
+	return db, tempFile.Name()
+}
+
+func post(t *testing.T, dbPath string, form url.Values) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.AddCookie(testutil.SessionCookie(t, dbPath))
+	w := httptest.NewRecorder()
+	api_dump.New(types.Config{SessionSecret: "test-secret"}, runner).Handle(w, req)
+	return w
+}
+
+var fixture = []string{
+	`CREATE TABLE authors (id INTEGER PRIMARY KEY AUTOINCREMENT, name TEXT NOT NULL UNIQUE)`,
+	`CREATE TABLE books (id INTEGER PRIMARY KEY, author_id INTEGER NOT NULL REFERENCES authors(id), title TEXT, cover BLOB, price REAL)`,
+	`CREATE INDEX idx_books_title ON books (title)`,
+	`CREATE VIEW cheap_books AS SELECT title FROM books WHERE price < 10`,
+	`INSERT INTO authors (name) VALUES ('Ann'), ('O''Brien'), ('Zoë')`,
+	`INSERT INTO books VALUES (1, 1, 'First', X'00FF10', 9.5), (2, 2, 'It''s "quoted"', NULL, 12), (3, 3, NULL, NULL, NULL)`,
+}
+
+// load runs a dump script against a fresh database
+func load(t *testing.T, script string) *sql.DB {
+	db, _ := createDB(t)
+	for _, stmt := range sqlsplit.Split(script) {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatalf("failed to load %q: %v\n%s", stmt, err, script)
+		}
+	}
+	return db
+}
+
+func dumpRows(t *testing.T, db *sql.DB, query string) string {
+	rows, err := db.Query(query)
+	if err != nil {
+		t.Fatalf("query %q failed: %v", query, err)
+	}
+	defer rows.Close()
+	cols, _ := rows.Columns()
+	var sb strings.Builder
+	for rows.Next() {
+		values := make([]any, len(cols))
+		pointers := make([]any, len(cols))
+		for i := range values {
+			pointers[i] = &values[i]
+		}
+		rows.Scan(pointers...)
+		b, _ := json.Marshal(values)
+		sb.Write(b)
+		sb.WriteByte('\n')
+	}
+	return sb.String()
+}
+
+func TestDump_RoundTrip(t *testing.T) {
+	source, dbPath := createDB(t, fixture...)
+
+	w := post(t, dbPath, url.Values{"batch_size": {"2"}})
+	if got := w.Header().Get("Content-Type"); !strings.HasPrefix(got, "application/sql") {
+		t.Fatalf("Content-Type = %q, body %s", got, w.Body.String())
+	}
+	script := w.Body.String()
+
+	// structure first, indexes and views after the data
+	create := strings.Index(script, `CREATE TABLE "books"`)
+	insert := strings.Index(script, `INSERT INTO "books"`)
+	index := strings.Index(script, `CREATE INDEX "idx_books_title"`)
+	view := strings.Index(script, `CREATE VIEW "cheap_books"`)
+	if create < 0 || insert < create || index < insert || view < index {
+		t.Fatalf("unexpected statement order:\n%s", script)
+	}
+	if !strings.Contains(script, `DROP TABLE IF EXISTS "books"`) {
+		t.Errorf("expected DROP TABLE IF EXISTS:\n%s", script)
+	}
+	if strings.Count(script, `INSERT INTO "books"`) != 2 {
+		t.Errorf("expected 3 rows in batches of 2:\n%s", script)
+	}
+
+	target := load(t, script)
+	for _, query := range []string{
+		"SELECT * FROM authors ORDER BY id",
+		"SELECT id, author_id, title, hex(cover), price FROM books ORDER BY id",
+		"SELECT * FROM cheap_books",
+	} {
+		if want, got := dumpRows(t, source, query), dumpRows(t, target, query); want != got {
+			t.Errorf("%s:\nwant %s\ngot  %s", query, want, got)
+		}
+	}
+
+	// loading the same dump again replaces the tables
+	for _, stmt := range sqlsplit.Split(script) {
+		if _, err := target.Exec(stmt); err != nil {
+			t.Fatalf("failed to reload %q: %v", stmt, err)
+		}
+	}
+}
+
+func TestDump_SelectedTablesGzip(t *testing.T) {
+	_, dbPath := createDB(t, fixture...)
+
+	w := post(t, dbPath, url.Values{
+		"tables[]":  {"authors"},
+		"structure": {"create"},
+		"gzip":      {"yes"},
+	})
+	if got := w.Header().Get("Content-Disposition"); !strings.HasSuffix(got, `.sql.gz"`) {
+		t.Fatalf("Content-Disposition = %q", got)
+	}
+	gz, err := gzip.NewReader(w.Body)
+	if err != nil {
+		t.Fatalf("response is not gzip: %v", err)
+	}
+	b, err := io.ReadAll(gz)
+	if err != nil {
+		t.Fatalf("failed to read gzip: %v", err)
+	}
+	script := string(b)
+
+	if strings.Contains(script, "books") || strings.Contains(script, "DROP") {
+		t.Errorf("dump should hold only authors without drops:\n%s", script)
+	}
+	target := load(t, script)
+	var count int
+	target.QueryRow("SELECT COUNT(*) FROM authors").Scan(&count)
+	if count != 3 {
+		t.Errorf("expected 3 authors, got %d", count)
+	}
+}
+
+func TestDump_Errors(t *testing.T) {
+	_, dbPath := createDB(t, fixture...)
+
+	tests := []struct {
+		name    string
+		form    url.Values
+		message string
+	}{
+		{"unknown table", url.Values{"tables[]": {"missing"}}, "failed to read schema: table not found: missing"},
+		{"bad batch size", url.Values{"batch_size": {"0"}}, "batch_size must be a positive number"},
+		{"nothing selected", url.Values{"structure": {"none"}, "data": {"no"}}, "nothing to dump: enable structure or data"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := post(t, dbPath, tt.form)
+			var resp struct {
+				Status  string `json:"status"`
+				Message string `json:"message"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("failed to decode response %q: %v", w.Body.String(), err)
+			}
+			if resp.Status != "error" || resp.Message != tt.message {
+				t.Errorf("got %s %q, want error %q", resp.Status, resp.Message, tt.message)
+			}
+		})
+	}
+}
@@ -0,0 +1,123 @@
+package api_enum_add_value
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/dracory/api"
+	"github.com/dracory/weebase/shared/audit"
+	"github.com/dracory/weebase/shared/constants"
+	"github.com/dracory/weebase/shared/dialect"
+	"github.com/dracory/weebase/shared/driver"
+	"github.com/dracory/weebase/shared/session"
+	"github.com/dracory/weebase/shared/types"
+)
+
+// EnumAddValue adds a label to a PostgreSQL enum type
+type EnumAddValue struct {
+	config types.Config
+}
+
+// New creates a new EnumAddValue handler
+func New(config types.Config) *EnumAddValue {
+	return &EnumAddValue{config: config}
+}
+
+// Handle processes the request.
+// Optional "before" or "after" place the new label relative to an existing one.
+func (h *EnumAddValue) Handle(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		api.Respond(w, r, api.Error("method not allowed"))
+		return
+	}
+
+	sess := session.EnsureSession(w, r, h.config.SessionSecret)
+	if sess == nil || sess.Conn == nil {
+		api.Respond(w, r, api.Error("not connected to database"))
+		return
+	}
+
+	if dialect.Normalize(sess.Conn.Driver) != constants.DriverPostgres {
+		api.Respond(w, r, api.Error("enum types are only supported on PostgreSQL"))
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		api.Respond(w, r, api.Error("failed to parse form"))
+		return
+	}
+
+	schema := strings.TrimSpace(r.Form.Get("schema"))
+	typeName := strings.TrimSpace(r.Form.Get("type"))
+	value := r.Form.Get("value")
+	before := r.Form.Get("before")
+	after := r.Form.Get("after")
+
+	if typeName == "" || value == "" {
+		api.Respond(w, r, api.Error("type and value are required"))
+		return
+	}
+	if !dialect.SanitizeIdent(typeName) || (schema != "" && !dialect.SanitizeIdent(schema)) {
+		api.Respond(w, r, api.Error("invalid type or schema name"))
+		return
+	}
+	if before != "" && after != "" {
+		api.Respond(w, r, api.Error("only one of before and after may be given"))
+		return
+	}
+
+	// Check for confirmation in safe mode
+	if h.config.SafeModeDefault && strings.TrimSpace(r.Form.Get("confirm")) != "yes" {
+		api.Respond(w, r, api.Error("confirmation required (set confirm=yes)"))
+		return
+	}
+
+	stmt := statement(schema, typeName, value, before, after)
+
+	db, err := driver.OpenSQLDB(sess.Conn.Driver, sess.Conn.DSN)
+	if err != nil {
+		api.Respond(w, r, api.Error(fmt.Sprintf("failed to connect to database: %v", err)))
+		return
+	}
+	defer db.Close()
+
+	audit.SetObject(r.Context(), schema, typeName)
+	audit.SetSQL(r.Context(), stmt)
+	result, err := db.ExecContext(r.Context(), stmt)
+	if err != nil {
+		api.Respond(w, r, api.Error(fmt.Sprintf("error adding enum value: %v", err)))
+		return
+	}
+	if n, err := result.RowsAffected(); err == nil {
+		audit.AddRowsAffected(r.Context(), n)
+	}
+
+	api.Respond(w, r, api.SuccessWithData("enum_value_added", map[string]any{
+		"sql":     stmt,
+		"type":    typeName,
+		"schema":  schema,
+		"value":   value,
+		"message": "Enum value added successfully",
+	}))
+}
+
+// statement builds the ALTER TYPE statement adding value, placed before or
+// after an existing label when one is given.
+// ALTER TYPE does not accept bind parameters, so labels are quoted as literals
+func statement(schema, typeName, value, before, after string) string {
+	stmt := "ALTER TYPE " + dialect.QualifiedName(constants.DriverPostgres, schema, typeName) +
+		" ADD VALUE IF NOT EXISTS " + quoteLiteral(value)
+	if before != "" {
+		stmt += " BEFORE " + quoteLiteral(before)
+	}
+	if after != "" {
+		stmt += " AFTER " + quoteLiteral(after)
+	}
+	return stmt
+}
+
+// quoteLiteral quotes a string as a SQL literal
+func quoteLiteral(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
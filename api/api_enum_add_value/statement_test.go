@@ -0,0 +1,20 @@
+package api_enum_add_value
+
+import "testing"
+
+func TestStatement(t *testing.T) {
+	tests := []struct {
+		schema, typeName, value, before, after string
+		want                                   string
+	}{
+		{"public", "mood", "ok", "", "", `ALTER TYPE "public"."mood" ADD VALUE IF NOT EXISTS 'ok'`},
+		{"", "mood", "ok", "happy", "", `ALTER TYPE "mood" ADD VALUE IF NOT EXISTS 'ok' BEFORE 'happy'`},
+		{"public", "mood", "ok", "", "sad", `ALTER TYPE "public"."mood" ADD VALUE IF NOT EXISTS 'ok' AFTER 'sad'`},
+		{"public", "mood", "it's', 'x", "", "", `ALTER TYPE "public"."mood" ADD VALUE IF NOT EXISTS 'it''s'', ''x'`},
+	}
+	for _, tt := range tests {
+		if got := statement(tt.schema, tt.typeName, tt.value, tt.before, tt.after); got != tt.want {
+			t.Errorf("expected %s, got %s", tt.want, got)
+		}
+	}
+}
@@ -0,0 +1,338 @@
+package api_export
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/dracory/api"
+	"github.com/dracory/weebase/shared/dialect"
+	"github.com/dracory/weebase/shared/driver"
+	"github.com/dracory/weebase/shared/export"
+	"github.com/dracory/weebase/shared/jobs"
+	"github.com/dracory/weebase/shared/masking"
+	"github.com/dracory/weebase/shared/session"
+	"github.com/dracory/weebase/shared/sqlguard"
+	"github.com/dracory/weebase/shared/types"
+)
+
+// Export streams a table, a filtered selection of it, or the result of a
+// read-only query as a downloadable file
+type Export struct {
+	config types.Config
+	jobs   *jobs.Runner
+}
+
+// New creates a new Export handler; runner runs the exports started with async=yes
+func New(config types.Config, runner *jobs.Runner) *Export {
+	return &Export{config: config, jobs: runner}
+}
+
+// Handle processes the request.
+//
+// The source is either "sql" (a read-only query) or a table selection
+// (schema, table, columns, filter_column[]/filter_op[]/filter_value[], order,
+// order_dir, limit, offset). "format" picks the output, see newWriter.
+// With format=xlsx, "tables[]" exports several whole tables of the schema
+// into one workbook, a sheet each, and "sheet_rows" caps the rows per sheet.
+// With async=yes the file is written in the background; poll the job status
+// with the returned job_id and fetch the file through the job download.
+func (h *Export) Handle(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		api.Respond(w, r, api.Error("method not allowed"))
+		return
+	}
+
+	sess := session.EnsureSession(w, r, h.config.SessionSecret)
+	if sess == nil || sess.Conn == nil {
+		api.Respond(w, r, api.Error("not connected to database"))
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		api.Respond(w, r, api.Error("failed to parse form"))
+		return
+	}
+
+	format := strings.ToLower(strings.TrimSpace(r.Form.Get("format")))
+	if format == "" {
+		format = "csv"
+	}
+	if format == "xlsx" && len(r.Form["tables[]"]) > 0 {
+		h.workbook(w, r, sess)
+		return
+	}
+
+	drv := dialect.Normalize(sess.Conn.Driver)
+	query, args, name, err := source(drv, r.Form)
+	if err != nil {
+		api.Respond(w, r, api.Error(err.Error()))
+		return
+	}
+
+	db, err := driver.OpenSQLDB(sess.Conn.Driver, sess.Conn.DSN)
+	if err != nil {
+		api.Respond(w, r, api.Error(fmt.Sprintf("failed to connect to database: %v", err)))
+		return
+	}
+
+	// a table selection is masked by its table, a query by column only
+	masker := masking.FromContext(r.Context())
+	var schema, table string
+	if strings.TrimSpace(r.Form.Get("sql")) == "" {
+		selection := export.SelectionFromForm(r.Form)
+		schema, table = selection.Schema, selection.Table
+	}
+	mask := func(w export.RowWriter) export.RowWriter { return masker.Writer(schema, table, w) }
+
+	if r.Form.Get("async") == "yes" {
+		h.submit(w, r, sess, db, drv, format, name, query, args, mask)
+		return
+	}
+	defer db.Close()
+
+	// Run the query before committing to a download so errors can still be reported as JSON
+	rows, done, err := sqlguard.QueryReadOnly(r.Context(), db, drv, query, args...)
+	if err != nil {
+		api.Respond(w, r, api.Error(fmt.Sprintf("query failed: %v", err)))
+		return
+	}
+	defer done()
+
+	writer, contentType, ext, err := newWriter(format, name, w, r.Form)
+	if err != nil {
+		api.Respond(w, r, api.Error(err.Error()))
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.%s"`, name, ext))
+	w.Header().Set("Cache-Control", "no-store")
+
+	rc := http.NewResponseController(w)
+	count, err := export.Stream(r.Context(), rows, mask(writer), func(int64) { _ = rc.Flush() })
+	if err != nil {
+		// headers are gone; the truncated download is all the client gets
+		slog.Error("export failed", slog.String("source", name), slog.Int64("rows", count), slog.String("error", err.Error()))
+	}
+}
+
+// workbook exports the tables[] of the schema into one XLSX file, one sheet
+// per table. The first table is queried before the download starts so a bad
+// name is still reported as JSON.
+func (h *Export) workbook(w http.ResponseWriter, r *http.Request, sess *session.Session) {
+	drv := dialect.Normalize(sess.Conn.Driver)
+	schema := strings.TrimSpace(r.Form.Get("schema"))
+	tables := r.Form["tables[]"]
+	queries := make([]string, len(tables))
+	for i, table := range tables {
+		query, _, err := export.Selection{Schema: schema, Table: strings.TrimSpace(table)}.SQL(drv)
+		if err != nil {
+			api.Respond(w, r, api.Error(err.Error()))
+			return
+		}
+		queries[i] = query
+	}
+	opts, err := xlsxOptions(r.Form)
+	if err != nil {
+		api.Respond(w, r, api.Error(err.Error()))
+		return
+	}
+
+	db, err := driver.OpenSQLDB(sess.Conn.Driver, sess.Conn.DSN)
+	if err != nil {
+		api.Respond(w, r, api.Error(fmt.Sprintf("failed to connect to database: %v", err)))
+		return
+	}
+
+	masker := masking.FromContext(r.Context())
+	name := "tables"
+	if schema != "" {
+		name = schema
+	}
+
+	if r.Form.Get("async") == "yes" {
+		id, err := h.jobs.Submit(jobs.Spec{Kind: jobs.KindExport, Owner: sess.ID,
+			Run: func(ctx context.Context, t *jobs.Task) (any, error) {
+				defer db.Close()
+				out, err := t.Artifact(name+".xlsx", xlsxContentType)
+				if err != nil {
+					return nil, err
+				}
+				var total int64
+				wb := export.NewXLSXWorkbook(out, opts)
+				for i, table := range tables {
+					done := total
+					progress := func(n int64) { t.Progress(map[string]any{"table": table, "rows": done + n}) }
+					count, err := writeSheet(ctx, db, masker.Writer(schema, table, wb.Sheet(table)), queries[i], progress)
+					total += count
+					if err != nil {
+						return map[string]any{"rows": total}, fmt.Errorf("%s: %v", table, err)
+					}
+				}
+				return map[string]any{"rows": total}, wb.Close()
+			}})
+		if err != nil {
+			db.Close()
+			api.Respond(w, r, api.Error(err.Error()))
+			return
+		}
+		api.Respond(w, r, api.SuccessWithData("export started", map[string]any{"job_id": id}))
+		return
+	}
+	defer db.Close()
+
+	rows, err := db.QueryContext(r.Context(), queries[0])
+	if err != nil {
+		api.Respond(w, r, api.Error(fmt.Sprintf("query failed: %v", err)))
+		return
+	}
+
+	w.Header().Set("Content-Type", xlsxContentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.xlsx"`, name))
+	w.Header().Set("Cache-Control", "no-store")
+
+	rc := http.NewResponseController(w)
+	wb := export.NewXLSXWorkbook(w, opts)
+	for i, table := range tables {
+		if i > 0 {
+			if rows, err = db.QueryContext(r.Context(), queries[i]); err != nil {
+				slog.Error("export failed", slog.String("source", table), slog.String("error", err.Error()))
+				return
+			}
+		}
+		count, err := export.Stream(r.Context(), rows, masker.Writer(schema, table, wb.Sheet(table)), func(int64) { _ = rc.Flush() })
+		rows.Close()
+		if err != nil {
+			// headers are gone; the truncated download is all the client gets
+			slog.Error("export failed", slog.String("source", table), slog.Int64("rows", count), slog.String("error", err.Error()))
+			return
+		}
+	}
+	if err := wb.Close(); err != nil {
+		slog.Error("export failed", slog.String("source", name), slog.String("error", err.Error()))
+	}
+}
+
+// writeSheet streams the rows of one table into a sheet of a workbook
+// written in the background
+func writeSheet(ctx context.Context, db *sql.DB, sheet export.RowWriter, query string, progress export.ProgressFunc) (int64, error) {
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+	return export.Stream(ctx, rows, sheet, progress)
+}
+
+// submit queues the export of a query as a background job writing to an
+// artifact, its rows going through mask. The options are checked first so
+// errors are reported as JSON.
+func (h *Export) submit(w http.ResponseWriter, r *http.Request, sess *session.Session, db *sql.DB, drv, format, name, query string, args []any, mask func(export.RowWriter) export.RowWriter) {
+	form := r.Form
+	_, contentType, ext, err := newWriter(format, name, io.Discard, form)
+	if err != nil {
+		db.Close()
+		api.Respond(w, r, api.Error(err.Error()))
+		return
+	}
+
+	id, err := h.jobs.Submit(jobs.Spec{Kind: jobs.KindExport, Owner: sess.ID,
+		Run: func(ctx context.Context, t *jobs.Task) (any, error) {
+			defer db.Close()
+			rows, done, err := sqlguard.QueryReadOnly(ctx, db, drv, query, args...)
+			if err != nil {
+				return nil, fmt.Errorf("query failed: %v", err)
+			}
+			defer done()
+
+			out, err := t.Artifact(name+"."+ext, contentType)
+			if err != nil {
+				return nil, err
+			}
+			writer, _, _, err := newWriter(format, name, out, form)
+			if err != nil {
+				return nil, err
+			}
+			count, err := export.Stream(ctx, rows, mask(writer), func(n int64) { t.Progress(map[string]any{"rows": n}) })
+			return map[string]any{"rows": count}, err
+		}})
+	if err != nil {
+		db.Close()
+		api.Respond(w, r, api.Error(err.Error()))
+		return
+	}
+	api.Respond(w, r, api.SuccessWithData("export started", map[string]any{"job_id": id}))
+}
+
+// xlsxContentType is the media type of XLSX workbooks
+const xlsxContentType = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+
+// xlsxOptions reads sheet_rows, the data rows per sheet before a new sheet starts
+func xlsxOptions(form url.Values) (export.XLSXOptions, error) {
+	opts := export.XLSXOptions{}
+	if v := strings.TrimSpace(form.Get("sheet_rows")); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return opts, fmt.Errorf("sheet_rows must be a positive number")
+		}
+		opts.SheetRows = n
+	}
+	return opts, nil
+}
+
+// source resolves the query to export and a file name for it
+func source(drv string, form url.Values) (string, []any, string, error) {
+	if q := strings.TrimSpace(form.Get("sql")); q != "" {
+		stmt, err := sqlguard.SingleReadOnly(drv, q)
+		if err != nil {
+			return "", nil, "", fmt.Errorf("only a single read-only query can be exported")
+		}
+		return stmt, nil, "query", nil
+	}
+
+	selection := export.SelectionFromForm(form)
+	if selection.Table == "" {
+		return "", nil, "", fmt.Errorf("table or sql is required")
+	}
+	query, args, err := selection.SQL(drv)
+	if err != nil {
+		return "", nil, "", err
+	}
+	return query, args, selection.Table, nil
+}
+
+// newWriter creates the row writer for a format along with its content type
+// and file extension; name titles the sheet of an XLSX file
+func newWriter(format, name string, w io.Writer, form url.Values) (export.RowWriter, string, string, error) {
+	switch format {
+	case "csv":
+		opts := export.CSVOptionsFromForm(form)
+		writer, err := export.NewCSVWriter(w, opts)
+		if err != nil {
+			return nil, "", "", err
+		}
+		charset := opts.Encoding
+		if charset == export.EncodingUTF8BOM {
+			charset = export.EncodingUTF8
+		}
+		return writer, "text/csv; charset=" + charset, "csv", nil
+	case "json":
+		return export.NewJSONWriter(w, false), "application/json", "json", nil
+	case "ndjson":
+		return export.NewJSONWriter(w, true), "application/x-ndjson", "ndjson", nil
+	case "xlsx":
+		opts, err := xlsxOptions(form)
+		if err != nil {
+			return nil, "", "", err
+		}
+		return export.NewXLSXWriter(w, name, opts), xlsxContentType, "xlsx", nil
+	}
+	return nil, "", "", fmt.Errorf("unsupported export format: %s", format)
+}
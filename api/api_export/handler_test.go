@@ -0,0 +1,297 @@
+package api_export_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/dracory/weebase/api/api_export"
+	"github.com/dracory/weebase/shared/jobs"
+	"github.com/dracory/weebase/shared/masking"
+	"github.com/dracory/weebase/shared/testutil"
+	"github.com/dracory/weebase/shared/types"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// runner runs the jobs started by the handlers under test
+var runner = jobs.NewRunner(jobs.NewMemoryStore(), jobs.Options{})
+
+func setupTestDB(t *testing.T) string {
+	tempFile, err := os.CreateTemp("", "testdb-*.db")
+	if err != nil {
+		t.Fatalf("failed to create temp file: %v", err)
+	}
+	tempFile.Close()
+	t.Cleanup(func() { os.Remove(tempFile.Name()) })
+
+	db, err := sql.Open("sqlite3", tempFile.Name())
+	if err != nil {
+		t.Fatalf("failed to open SQLite database: %v", err)
+	}
+	defer db.Close()
+
+	stmts := []string{
+		`CREATE TABLE people (id INTEGER PRIMARY KEY, name TEXT, city TEXT)`,
+		`INSERT INTO people (id, name, city) VALUES (1, 'Alice', 'Paris'), (2, 'Bob, Jr.', NULL), (3, 'Carol "CJ"', ''), (4, 'Dave', 'Paris')`,
+	}
+	for _, stmt := range stmts {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatalf("failed to execute %q: %v", stmt, err)
+		}
+	}
+	return tempFile.Name()
+}
+
+func TestExport_CSV(t *testing.T) {
+	dbPath := setupTestDB(t)
+	cookie := testutil.SessionCookie(t, dbPath)
+	handler := api_export.New(types.Config{SessionSecret: "test-secret"}, runner)
+
+	tests := []struct {
+		name        string
+		form        url.Values
+		want        string
+		disposition string
+	}{
+		{
+			name:        "whole table",
+			form:        url.Values{"table": {"people"}, "order": {"id"}},
+			want:        "id,name,city\n1,Alice,Paris\n2,\"Bob, Jr.\",\n3,\"Carol \"\"CJ\"\"\",\"\"\n4,Dave,Paris\n",
+			disposition: `attachment; filename="people.csv"`,
+		},
+		{
+			name: "filtered selection with options",
+			form: url.Values{
+				"table":           {"people"},
+				"columns":         {"id,name"},
+				"filter_column[]": {"city"},
+				"filter_op[]":     {"="},
+				"filter_value[]":  {"Paris"},
+				"order":           {"id"},
+				"order_dir":       {"desc"},
+				"delimiter":       {"tab"},
+				"quoting":         {"all"},
+				"header":          {"no"},
+			},
+			want:        "\"4\"\t\"Dave\"\n\"1\"\t\"Alice\"\n",
+			disposition: `attachment; filename="people.csv"`,
+		},
+		{
+			name:        "json array",
+			form:        url.Values{"table": {"people"}, "format": {"json"}, "order": {"id"}, "limit": {"2"}},
+			want:        "[\n{\"id\":1,\"name\":\"Alice\",\"city\":\"Paris\"},\n{\"id\":2,\"name\":\"Bob, Jr.\",\"city\":null}\n]\n",
+			disposition: `attachment; filename="people.json"`,
+		},
+		{
+			name:        "ndjson query",
+			form:        url.Values{"sql": {"SELECT id, city FROM people WHERE id > 2 ORDER BY id"}, "format": {"ndjson"}},
+			want:        "{\"id\":3,\"city\":\"\"}\n{\"id\":4,\"city\":\"Paris\"}\n",
+			disposition: `attachment; filename="query.ndjson"`,
+		},
+		{
+			name:        "query with null marker",
+			form:        url.Values{"sql": {"SELECT name, city FROM people WHERE id IN (2, 3) ORDER BY id"}, "null": {`\N`}},
+			want:        "name,city\n\"Bob, Jr.\",\\N\n\"Carol \"\"CJ\"\"\",\n",
+			disposition: `attachment; filename="query.csv"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(tt.form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			req.AddCookie(cookie)
+			w := httptest.NewRecorder()
+
+			handler.Handle(w, req)
+
+			if got := w.Header().Get("Content-Disposition"); got != tt.disposition {
+				t.Fatalf("Content-Disposition = %q, want %q (body %s)", got, tt.disposition, w.Body.String())
+			}
+			if got := w.Body.String(); got != tt.want {
+				t.Errorf("body = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExport_Masked(t *testing.T) {
+	dbPath := setupTestDB(t)
+	cookie := testutil.SessionCookie(t, dbPath)
+	handler := api_export.New(types.Config{SessionSecret: "test-secret"}, runner)
+	rules, err := masking.Parse([]byte(`{"rules": [{"tables": ["people"], "columns": ["name"], "method": "partial"}, {"columns": ["city"], "method": "null"}]}`))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		form url.Values
+		want string
+	}{
+		{"table", url.Values{"table": {"people"}, "order": {"id"}, "limit": {"2"}}, "id,name,city\n1,*lice,\n2,**** Jr.,\n"},
+		{"query", url.Values{"sql": {"SELECT name, city FROM people WHERE id = 1"}}, "name,city\n*lice,\n"},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(tt.form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.AddCookie(cookie)
+		req = req.WithContext(masking.WithMasker(req.Context(), masking.NewMasker(rules, "", nil)))
+		w := httptest.NewRecorder()
+
+		handler.Handle(w, req)
+
+		if got := w.Body.String(); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+func TestExport_Errors(t *testing.T) {
+	dbPath := setupTestDB(t)
+	cookie := testutil.SessionCookie(t, dbPath)
+	handler := api_export.New(types.Config{SessionSecret: "test-secret"}, runner)
+
+	tests := []struct {
+		name    string
+		form    url.Values
+		message string
+	}{
+		{"write query", url.Values{"sql": {"DELETE FROM people"}}, "only a single read-only query can be exported"},
+		// the SQLite driver would run every statement of the text
+		{"stacked write", url.Values{"sql": {"SELECT 1; DELETE FROM people"}}, "only a single read-only query can be exported"},
+		{"stacked write in the background", url.Values{"sql": {"SELECT * FROM people;\nDROP TABLE people;"}, "async": {"yes"}}, "only a single read-only query can be exported"},
+		{"write hidden after a quote", url.Values{"sql": {`SELECT 'a\'; DELETE FROM people; --'`}}, "only a single read-only query can be exported"},
+		{"missing source", url.Values{}, "table or sql is required"},
+		{"unknown format", url.Values{"table": {"people"}, "format": {"pdf"}}, "unsupported export format: pdf"},
+		{"bad sheet rows", url.Values{"table": {"people"}, "format": {"xlsx"}, "sheet_rows": {"0"}}, "sheet_rows must be a positive number"},
+		{"invalid workbook table", url.Values{"tables[]": {"people; --"}, "format": {"xlsx"}}, "invalid table or schema identifier"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(tt.form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			req.AddCookie(cookie)
+			w := httptest.NewRecorder()
+
+			handler.Handle(w, req)
+
+			var resp struct {
+				Status  string `json:"status"`
+				Message string `json:"message"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("failed to decode response %q: %v", w.Body.String(), err)
+			}
+			if resp.Status != "error" || resp.Message != tt.message {
+				t.Errorf("got %s %q, want error %q", resp.Status, resp.Message, tt.message)
+			}
+		})
+	}
+
+	var count int
+	db, _ := sql.Open("sqlite3", dbPath)
+	defer db.Close()
+	db.QueryRow("SELECT COUNT(*) FROM people").Scan(&count)
+	if count != 4 {
+		t.Errorf("rows were modified: %d left", count)
+	}
+}
+
+// xlsxParts unzips a workbook into its parts
+func xlsxParts(t *testing.T, body []byte) map[string]string {
+	zr, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+	if err != nil {
+		t.Fatalf("not a zip file: %v (%q)", err, body)
+	}
+	parts := map[string]string{}
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatalf("failed to open %s: %v", f.Name, err)
+		}
+		b, _ := io.ReadAll(rc)
+		rc.Close()
+		parts[f.Name] = string(b)
+	}
+	return parts
+}
+
+func TestExport_XLSX(t *testing.T) {
+	dbPath := setupTestDB(t)
+	db, _ := sql.Open("sqlite3", dbPath)
+	defer db.Close()
+	for _, stmt := range []string{
+		`CREATE TABLE events (id INTEGER PRIMARY KEY, big INTEGER, price DECIMAL(10,2), happened DATETIME, day DATE, note TEXT)`,
+		`INSERT INTO events VALUES (1, 12345678901234567, 9.99, '2024-03-01 12:30:00', '2024-03-01', 'a < b & c')`,
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatalf("failed to execute %q: %v", stmt, err)
+		}
+	}
+	cookie := testutil.SessionCookie(t, dbPath)
+	handler := api_export.New(types.Config{SessionSecret: "test-secret"}, runner)
+
+	export := func(form url.Values) (*httptest.ResponseRecorder, map[string]string) {
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.AddCookie(cookie)
+		w := httptest.NewRecorder()
+		handler.Handle(w, req)
+		return w, xlsxParts(t, w.Body.Bytes())
+	}
+
+	w, parts := export(url.Values{"table": {"events"}, "format": {"xlsx"}})
+	if got := w.Header().Get("Content-Disposition"); got != `attachment; filename="events.xlsx"` {
+		t.Fatalf("Content-Disposition = %q", got)
+	}
+	sheet := parts["xl/worksheets/sheet1.xml"]
+	for _, want := range []string{
+		`<pane ySplit="1" topLeftCell="A2" activePane="bottomLeft" state="frozen"/>`,
+		`<c r="A1" s="1" t="inlineStr"><is><t xml:space="preserve">id</t></is></c>`,
+		`<c r="A2"><v>1</v></c>`,
+		`<c r="B2" t="inlineStr"><is><t xml:space="preserve">12345678901234567</t></is></c>`,
+		`<c r="C2"><v>9.99</v></c>`,
+		`<c r="D2" s="3"><v>45352.520833333336</v></c>`,
+		`<c r="E2" s="2"><v>45352</v></c>`,
+		`<t xml:space="preserve">a &lt; b &amp; c</t>`,
+	} {
+		if !strings.Contains(sheet, want) {
+			t.Errorf("sheet is missing %s:\n%s", want, sheet)
+		}
+	}
+	if !strings.Contains(parts["xl/workbook.xml"], `<sheet name="events" sheetId="1" r:id="rId1"/>`) {
+		t.Errorf("unexpected workbook: %s", parts["xl/workbook.xml"])
+	}
+
+	// rows past sheet_rows continue on another sheet with its own header
+	_, parts = export(url.Values{"sql": {"SELECT name FROM people ORDER BY id"}, "format": {"xlsx"}, "sheet_rows": {"3"}})
+	if !strings.Contains(parts["xl/workbook.xml"], `<sheet name="query (2)" sheetId="2" r:id="rId2"/>`) {
+		t.Errorf("expected a second sheet: %s", parts["xl/workbook.xml"])
+	}
+	second := parts["xl/worksheets/sheet2.xml"]
+	if !strings.Contains(second, `<c r="A1" s="1" t="inlineStr"><is><t xml:space="preserve">name</t>`) ||
+		!strings.Contains(second, `<c r="A2" t="inlineStr"><is><t xml:space="preserve">Dave</t>`) {
+		t.Errorf("unexpected second sheet: %s", second)
+	}
+
+	// one sheet per table
+	w, parts = export(url.Values{"tables[]": {"people", "events"}, "format": {"xlsx"}})
+	if got := w.Header().Get("Content-Disposition"); got != `attachment; filename="tables.xlsx"` {
+		t.Fatalf("Content-Disposition = %q", got)
+	}
+	if !strings.Contains(parts["xl/workbook.xml"], `<sheet name="people" sheetId="1" r:id="rId1"/><sheet name="events" sheetId="2" r:id="rId2"/>`) {
+		t.Errorf("unexpected workbook: %s", parts["xl/workbook.xml"])
+	}
+	if !strings.Contains(parts["xl/worksheets/sheet1.xml"], `Carol &quot;CJ&quot;`) {
+		t.Errorf("unexpected people sheet: %s", parts["xl/worksheets/sheet1.xml"])
+	}
+}
@@ -0,0 +1,387 @@
+package api_import
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/dracory/api"
+	"github.com/dracory/weebase/api/api_table_create"
+	"github.com/dracory/weebase/shared/audit"
+	"github.com/dracory/weebase/shared/auth"
+	"github.com/dracory/weebase/shared/constants"
+	"github.com/dracory/weebase/shared/dataimport"
+	"github.com/dracory/weebase/shared/ddl"
+	"github.com/dracory/weebase/shared/dialect"
+	"github.com/dracory/weebase/shared/driver"
+	"github.com/dracory/weebase/shared/introspect"
+	"github.com/dracory/weebase/shared/jobs"
+	"github.com/dracory/weebase/shared/rbac"
+	"github.com/dracory/weebase/shared/session"
+	"github.com/dracory/weebase/shared/types"
+)
+
+// maxMemory is how much of an upload is held in memory before spilling to a temp file
+const maxMemory = 32 << 20
+
+// Import loads an uploaded file into an existing table
+type Import struct {
+	config types.Config
+	jobs   *jobs.Runner
+}
+
+// New creates a new Import handler; runner runs the imports started with async=yes
+func New(config types.Config, runner *jobs.Runner) *Import {
+	return &Import{config: config, jobs: runner}
+}
+
+// Handle processes the request.
+//
+// Parameters: upload_id (from the import preview), file (multipart upload)
+// or data (inline text), format (csv, json or ndjson, guessed from the file
+// name when empty), the CSV options delimiter, header, null and encoding,
+// schema, table, mapping (a JSON object of source field to column), mode
+// (insert, upsert or replace), batch_size, skip_errors=yes and dry_run=yes.
+// Replace deletes every row first: it needs confirm_replace set to the
+// table's name and, under an RBAC policy, the edit permission on the table.
+//
+// With create_table=yes the table is created first from col_name[],
+// col_type[], col_length[], col_nullable[] and col_pk[] as in table create,
+// or from the types inferred from the file when no columns are given; the
+// table is dropped again when the import doesn't commit. With async=yes the
+// import runs in the background and its job_id can be polled for progress.
+func (h *Import) Handle(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		api.Respond(w, r, api.Error("method not allowed"))
+		return
+	}
+
+	sess := session.EnsureSession(w, r, h.config.SessionSecret)
+	if sess == nil || sess.Conn == nil {
+		api.Respond(w, r, api.Error("not connected to database"))
+		return
+	}
+
+	if err := parseForm(r); err != nil {
+		api.Respond(w, r, api.Error("failed to parse form"))
+		return
+	}
+
+	opts := dataimport.Options{
+		Driver:     sess.Conn.Driver,
+		Mode:       strings.TrimSpace(r.Form.Get("mode")),
+		SkipErrors: r.Form.Get("skip_errors") == "yes",
+		DryRun:     r.Form.Get("dry_run") == "yes",
+	}
+
+	if h.config.ReadOnlyMode && !opts.DryRun {
+		api.Respond(w, r, api.Error("write operations are not allowed in read-only mode"))
+		return
+	}
+
+	if h.config.SafeModeDefault && !opts.DryRun && strings.TrimSpace(r.Form.Get("confirm")) != "yes" {
+		api.Respond(w, r, api.Error("confirmation required (set confirm=yes)"))
+		return
+	}
+
+	schema := strings.TrimSpace(r.Form.Get("schema"))
+	table := strings.TrimSpace(r.Form.Get("table"))
+	if table == "" {
+		api.Respond(w, r, api.Error("table is required"))
+		return
+	}
+	if !dialect.SanitizeIdent(table) || (schema != "" && !dialect.SanitizeIdent(schema)) {
+		api.Respond(w, r, api.Error("invalid table or schema identifier"))
+		return
+	}
+
+	if opts.Mode == dataimport.ModeReplace {
+		if err := h.checkReplace(r, sess, schema, table); err != nil {
+			api.Respond(w, r, api.Error(err.Error()))
+			return
+		}
+	}
+
+	if v := strings.TrimSpace(r.Form.Get("batch_size")); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			api.Respond(w, r, api.Error("batch_size must be a positive number"))
+			return
+		}
+		opts.BatchSize = n
+	}
+	if m := strings.TrimSpace(r.Form.Get("mapping")); m != "" {
+		if err := json.Unmarshal([]byte(m), &opts.Mapping); err != nil {
+			api.Respond(w, r, api.Error("mapping must be a JSON object of field to column"))
+			return
+		}
+	}
+
+	async := r.Form.Get("async") == "yes"
+	if async && strings.TrimSpace(r.Form.Get("upload_id")) == "" {
+		// a request's own upload is gone once the request ends
+		api.Respond(w, r, api.Error("async imports need an upload_id from the preview"))
+		return
+	}
+
+	in, err := openInput(r, sess.ID)
+	if err != nil {
+		api.Respond(w, r, api.Error(err.Error()))
+		return
+	}
+	format := strings.ToLower(strings.TrimSpace(r.Form.Get("format")))
+	if format == "" {
+		format = dataimport.FormatFromName(in.name)
+	}
+	csvOpts := dataimport.CSVOptionsFromForm(r.Form)
+	newReader := func(input io.Reader) (dataimport.Reader, error) {
+		if format == dataimport.FormatCSV {
+			return dataimport.NewCSVReader(input, csvOpts)
+		}
+		return dataimport.NewReader(format, input)
+	}
+
+	db, err := driver.OpenSQLDB(sess.Conn.Driver, sess.Conn.DSN)
+	if err != nil {
+		in.Close()
+		api.Respond(w, r, api.Error(fmt.Sprintf("failed to connect to database: %v", err)))
+		return
+	}
+
+	drv := dialect.Normalize(sess.Conn.Driver)
+	audit.SetObject(r.Context(), schema, table)
+	var target introspect.Table
+	createSQL := ""
+	if r.Form.Get("create_table") == "yes" {
+		target, createSQL, err = newTable(r, in, drv, schema, table, format, csvOpts)
+		if err == nil && !opts.DryRun {
+			audit.AddSQL(r.Context(), createSQL)
+			if _, execErr := db.ExecContext(r.Context(), createSQL); execErr != nil {
+				err = fmt.Errorf("error creating table: %v", execErr)
+			} else {
+				target, err = introspect.DescribeTable(r.Context(), db, drv, schema, table)
+			}
+		}
+	} else {
+		target, err = introspect.DescribeTable(r.Context(), db, drv, schema, table)
+		if err != nil {
+			err = fmt.Errorf("failed to read table: %v", err)
+		}
+	}
+	if err != nil {
+		in.Close()
+		db.Close()
+		api.Respond(w, r, api.Error(err.Error()))
+		return
+	}
+
+	// run is shared by foreground and background imports; a table created
+	// for the import is dropped again when nothing was committed
+	run := func(ctx context.Context, input io.Reader, progress func(dataimport.Result)) (dataimport.Result, error) {
+		reader, err := newReader(input)
+		if err != nil {
+			return dataimport.Result{}, err
+		}
+		opts.Progress = progress
+		if createSQL != "" && opts.DryRun {
+			return dataimport.Validate(ctx, target, reader, opts)
+		}
+		result, err := dataimport.Run(ctx, db, target, reader, opts)
+		if createSQL != "" && !result.Committed {
+			dropTable(db, drv, schema, table)
+		}
+		if result.Committed && !result.DryRun {
+			audit.AddRowsAffected(ctx, result.Inserted+result.Deleted)
+		} else {
+			audit.AddRowsAffected(ctx, 0)
+		}
+		return result, err
+	}
+
+	data := map[string]any{}
+	if createSQL != "" {
+		data["sql"] = createSQL
+	}
+
+	if async {
+		job := audit.StartJob(r.Context())
+		id, err := h.jobs.Submit(jobs.Spec{Kind: jobs.KindImport, Owner: sess.ID, Input: in, Size: in.size,
+			Run: func(ctx context.Context, t *jobs.Task) (any, error) {
+				defer db.Close()
+				ctx = job.Context(ctx)
+				result, err := run(ctx, t.Input, func(r dataimport.Result) { t.Progress(r) })
+				if err == nil && !result.DryRun && !result.Committed {
+					job.Finish(ctx, fmt.Errorf("import rolled back: %d rows rejected", result.Failed))
+				} else {
+					job.Finish(ctx, err)
+				}
+				return result, err
+			}})
+		if err != nil {
+			db.Close()
+			api.Respond(w, r, api.Error(err.Error()))
+			return
+		}
+		data["job_id"] = id
+		api.Respond(w, r, api.SuccessWithData("import started", data))
+		return
+	}
+	defer in.Close()
+	defer db.Close()
+
+	result, err := run(r.Context(), in, nil)
+	data["result"] = result
+	switch {
+	case err != nil:
+		api.Respond(w, r, api.ErrorWithData(fmt.Sprintf("import failed: %v", err), data))
+	case result.DryRun:
+		api.Respond(w, r, api.SuccessWithData(fmt.Sprintf("dry run: %d of %d rows would be imported", result.Inserted, result.Rows), data))
+	case !result.Committed:
+		api.Respond(w, r, api.ErrorWithData(fmt.Sprintf("import rolled back: %d rows rejected", result.Failed), data))
+	default:
+		api.Respond(w, r, api.SuccessWithData(fmt.Sprintf("imported %d rows", result.Inserted), data))
+	}
+}
+
+// checkReplace guards replace mode, which deletes every row of the table
+// first: the operator confirms it by typing the table's name, and must be
+// allowed to delete rows, which the import permission alone doesn't grant
+func (h *Import) checkReplace(r *http.Request, sess *session.Session, schema, table string) error {
+	if r.Form.Get("dry_run") != "yes" && strings.TrimSpace(r.Form.Get("confirm_replace")) != table {
+		return fmt.Errorf("replace deletes every row of %s first: confirm by setting confirm_replace to the table name", table)
+	}
+	policy := h.config.Policy
+	if policy == nil {
+		return nil
+	}
+	user, _ := auth.FromContext(r.Context())
+	drv := dialect.Normalize(sess.Conn.Driver)
+	if schema == "" {
+		schema = dialect.DefaultSchema(drv)
+	}
+	req := rbac.Request{Permission: rbac.PermEdit, Profile: policy.Profile(drv, sess.Conn.DSN), Schema: schema, Table: table}
+	if !policy.Allowed(user, req) {
+		return fmt.Errorf("permission denied: %s on %s, which replace needs to delete its rows", rbac.PermEdit, table)
+	}
+	return nil
+}
+
+// input is the file being imported; it can be rewound to sample it for type inference
+type input struct {
+	io.ReadSeekCloser
+	name string
+	size int64
+}
+
+// parseForm accepts both multipart uploads and urlencoded bodies
+func parseForm(r *http.Request) error {
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		return r.ParseMultipartForm(maxMemory)
+	}
+	return r.ParseForm()
+}
+
+// openInput returns the previewed upload, the uploaded file or the inline data field
+func openInput(r *http.Request, owner string) (*input, error) {
+	if id := strings.TrimSpace(r.Form.Get("upload_id")); id != "" {
+		f, u, err := jobs.OpenUpload(owner, id)
+		if err != nil {
+			return nil, err
+		}
+		return &input{ReadSeekCloser: f, name: u.Name, size: u.Size}, nil
+	}
+	if r.MultipartForm != nil {
+		if file, header, err := r.FormFile("file"); err == nil {
+			return &input{ReadSeekCloser: file, name: header.Filename, size: header.Size}, nil
+		}
+	}
+	if data := r.Form.Get("data"); data != "" {
+		return &input{ReadSeekCloser: nopCloser{strings.NewReader(data)}, size: int64(len(data))}, nil
+	}
+	return nil, fmt.Errorf("file is required")
+}
+
+type nopCloser struct{ io.ReadSeeker }
+
+func (nopCloser) Close() error { return nil }
+
+// newTable builds the CREATE TABLE statement for create_table=yes and the
+// table it will produce. Without column fields the columns are inferred from
+// the input, which is rewound afterwards.
+func newTable(r *http.Request, in *input, drv, schema, table, format string, csvOpts dataimport.CSVOptions) (introspect.Table, string, error) {
+	names := r.Form["col_name[]"]
+	types := r.Form["col_type[]"]
+	lens := r.Form["col_length[]"]
+	nullable := indexSet(r.Form["col_nullable[]"])
+	pkset := indexSet(r.Form["col_pk[]"])
+
+	if len(names) == 0 {
+		preview, err := dataimport.NewPreview(drv, format, in, csvOpts, 0)
+		if err != nil {
+			return introspect.Table{}, "", err
+		}
+		if _, err := in.Seek(0, io.SeekStart); err != nil {
+			return introspect.Table{}, "", err
+		}
+		types = nil
+		for i, c := range preview.Columns {
+			names = append(names, c.Name)
+			types = append(types, c.Type)
+			if c.Nullable {
+				nullable[strconv.Itoa(i+1)] = true
+			}
+		}
+	}
+
+	stmt, errMsg := api_table_create.BuildSQL(drv, schema, table, names, types, lens, nullable, pkset, map[string]bool{})
+	if errMsg != "" {
+		return introspect.Table{}, "", fmt.Errorf("%s", errMsg)
+	}
+
+	// what DescribeTable will report once the table exists, for dry runs
+	t := introspect.Table{Schema: schema, Name: table}
+	pk := introspect.Constraint{Type: introspect.ConstraintPrimaryKey}
+	for i, name := range names {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		typ := ""
+		if i < len(types) {
+			typ = strings.TrimSpace(types[i])
+		}
+		if i < len(lens) && strings.TrimSpace(lens[i]) != "" && !strings.Contains(typ, "(") {
+			typ += "(" + strings.TrimSpace(lens[i]) + ")"
+		}
+		position := strconv.Itoa(i + 1)
+		t.Columns = append(t.Columns, introspect.Column{Name: name, Position: i + 1, Type: typ, Nullable: nullable[position]})
+		if pkset[position] {
+			pk.Columns = append(pk.Columns, name)
+		}
+	}
+	if len(pk.Columns) > 0 {
+		t.Constraints = append(t.Constraints, pk)
+	}
+	return t, stmt, nil
+}
+
+// dropTable removes a table created for an import that didn't commit
+func dropTable(db *sql.DB, drv, schema, table string) {
+	if drv == constants.DriverSQLite {
+		schema = ""
+	}
+	db.ExecContext(context.Background(), ddl.New(drv, drv).DropTableIfExists(schema, table))
+}
+
+func indexSet(vals []string) map[string]bool {
+	m := map[string]bool{}
+	for _, v := range vals {
+		m[v] = true
+	}
+	return m
+}
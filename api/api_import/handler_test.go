@@ -0,0 +1,404 @@
+package api_import_test
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dracory/weebase/api/api_import"
+	"github.com/dracory/weebase/api/api_job_status"
+	"github.com/dracory/weebase/shared/audit"
+	"github.com/dracory/weebase/shared/auth"
+	"github.com/dracory/weebase/shared/jobs"
+	"github.com/dracory/weebase/shared/rbac"
+	"github.com/dracory/weebase/shared/testutil"
+	"github.com/dracory/weebase/shared/types"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// runner runs the jobs started by the handlers under test
+var runner = jobs.NewRunner(jobs.NewMemoryStore(), jobs.Options{})
+
+func setupTestDB(t *testing.T) (*sql.DB, string) {
+	tempFile, err := os.CreateTemp("", "testdb-*.db")
+	if err != nil {
+		t.Fatalf("failed to create temp file: %v", err)
+	}
+	tempFile.Close()
+	t.Cleanup(func() { os.Remove(tempFile.Name()) })
+
+	db, err := sql.Open("sqlite3", tempFile.Name())
+	if err != nil {
+		t.Fatalf("failed to open SQLite database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	_, err = db.Exec(`CREATE TABLE items (
+		id INTEGER PRIMARY KEY,
+		name VARCHAR(10) NOT NULL UNIQUE,
+		qty INTEGER,
+		active BOOLEAN,
+		added DATE
+	)`)
+	if err != nil {
+		t.Fatalf("failed to create table: %v", err)
+	}
+	return db, tempFile.Name()
+}
+
+type importResponse struct {
+	Status  string `json:"status"`
+	Message string `json:"message"`
+	Data    struct {
+		Result struct {
+			Rows      int64 `json:"rows"`
+			Inserted  int64 `json:"inserted"`
+			Failed    int64 `json:"failed"`
+			Committed bool  `json:"committed"`
+			Errors    []struct {
+				Row     int64  `json:"row"`
+				Column  string `json:"column"`
+				Message string `json:"message"`
+			} `json:"errors"`
+			Ignored []string `json:"ignored_fields"`
+		} `json:"result"`
+	} `json:"data"`
+}
+
+// upload posts a file with extra form fields to the import handler
+func upload(t *testing.T, dbPath, filename, content string, fields map[string]string) importResponse {
+	return uploadAs(t, types.Config{SessionSecret: "test-secret"}, auth.User{}, dbPath, filename, content, fields)
+}
+
+// uploadAs posts like upload, with config and as user
+func uploadAs(t *testing.T, config types.Config, user auth.User, dbPath, filename, content string, fields map[string]string) importResponse {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	for k, v := range fields {
+		mw.WriteField(k, v)
+	}
+	fw, _ := mw.CreateFormFile("file", filename)
+	fw.Write([]byte(content))
+	mw.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/", &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	req.AddCookie(testutil.SessionCookie(t, dbPath))
+	req = req.WithContext(auth.WithUser(req.Context(), user))
+	w := httptest.NewRecorder()
+	api_import.New(config, runner).Handle(w, req)
+
+	var resp importResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to decode response %q: %v", w.Body.String(), err)
+	}
+	return resp
+}
+
+func count(t *testing.T, db *sql.DB) int {
+	var n int
+	if err := db.QueryRow("SELECT COUNT(*) FROM items").Scan(&n); err != nil {
+		t.Fatalf("count failed: %v", err)
+	}
+	return n
+}
+
+func TestImport_JSONArray(t *testing.T) {
+	db, dbPath := setupTestDB(t)
+
+	resp := upload(t, dbPath, "items.json", `[
+		{"id": 1, "name": "apple", "qty": "3", "active": "yes", "added": "2024-05-01T10:00:00Z", "extra": 1},
+		{"id": 2, "name": "pear", "qty": 4.0, "active": false, "added": null}
+	]`, map[string]string{"table": "items", "batch_size": "1"})
+
+	if resp.Status != "success" || resp.Data.Result.Inserted != 2 || !resp.Data.Result.Committed {
+		t.Fatalf("unexpected response: %+v", resp)
+	}
+	if len(resp.Data.Result.Ignored) != 1 || resp.Data.Result.Ignored[0] != "extra" {
+		t.Errorf("expected extra to be ignored, got %v", resp.Data.Result.Ignored)
+	}
+
+	var (
+		qty    int
+		active bool
+		added  string
+	)
+	db.QueryRow("SELECT qty, active, added FROM items WHERE id = 1").Scan(&qty, &active, &added)
+	if qty != 3 || !active || added[:10] != "2024-05-01" {
+		t.Errorf("unexpected coerced values: %d %v %q", qty, active, added)
+	}
+}
+
+func TestImport_NDJSONErrorsRollBack(t *testing.T) {
+	db, dbPath := setupTestDB(t)
+
+	content := `{"id": 1, "name": "apple"}
+not json
+{"id": 3, "name": "a name that is too long"}
+{"id": 4, "name": "apple"}
+{"id": 5, "name": "plum", "qty": "many"}
+{"id": 6, "name": "fig"}
+`
+	resp := upload(t, dbPath, "items.ndjson", content, map[string]string{"table": "items"})
+	if resp.Status != "error" || resp.Data.Result.Committed {
+		t.Fatalf("expected the import to roll back: %+v", resp)
+	}
+	if count(t, db) != 0 {
+		t.Errorf("rows were committed despite errors")
+	}
+
+	rows := map[int64]string{}
+	for _, e := range resp.Data.Result.Errors {
+		rows[e.Row] = e.Column
+	}
+	// row 4 only fails in the database, on the unique name
+	for _, row := range []int64{2, 3, 4, 5} {
+		if _, ok := rows[row]; !ok {
+			t.Errorf("expected an error for row %d, got %+v", row, resp.Data.Result.Errors)
+		}
+	}
+	if rows[5] != "qty" {
+		t.Errorf("row 5 should fail on qty, got %q", rows[5])
+	}
+
+	// the same file with skip_errors keeps the good rows
+	resp = upload(t, dbPath, "items.ndjson", content, map[string]string{"table": "items", "skip_errors": "yes"})
+	if !resp.Data.Result.Committed || resp.Data.Result.Inserted != 2 || resp.Data.Result.Failed != 4 {
+		t.Fatalf("unexpected skip_errors result: %+v", resp.Data.Result)
+	}
+	if count(t, db) != 2 {
+		t.Errorf("expected 2 rows, got %d", count(t, db))
+	}
+}
+
+func TestImport_MappingAndDryRun(t *testing.T) {
+	db, dbPath := setupTestDB(t)
+
+	resp := upload(t, dbPath, "items.json", `[{"Label": "kiwi", "Amount": 7, "skip": "x"}]`, map[string]string{
+		"table":   "items",
+		"mapping": `{"Label": "name", "Amount": "qty", "skip": ""}`,
+		"dry_run": "yes",
+	})
+	if resp.Status != "success" || resp.Data.Result.Inserted != 1 || resp.Data.Result.Committed {
+		t.Fatalf("unexpected dry run response: %+v", resp)
+	}
+	if count(t, db) != 0 {
+		t.Errorf("dry run committed rows")
+	}
+
+	resp = upload(t, dbPath, "items.json", `[]`, map[string]string{"table": "items", "mapping": `{"Label": "nope"}`})
+	if resp.Status != "error" || resp.Message != "import failed: field Label is mapped to unknown column nope" {
+		t.Errorf("unexpected response for a bad mapping: %+v", resp)
+	}
+}
+
+func TestImport_CSVModes(t *testing.T) {
+	db, dbPath := setupTestDB(t)
+
+	// the semicolon is detected, and the NULL marker honoured
+	resp := upload(t, dbPath, "items.csv", "id;name;qty\n1;apple;3\n2;pear;\\N\n", map[string]string{"table": "items", "null": `\N`})
+	if resp.Status != "success" || resp.Data.Result.Inserted != 2 {
+		t.Fatalf("unexpected insert response: %+v", resp)
+	}
+	var qty sql.NullInt64
+	db.QueryRow("SELECT qty FROM items WHERE id = 2").Scan(&qty)
+	if qty.Valid {
+		t.Errorf("expected NULL qty, got %v", qty.Int64)
+	}
+
+	resp = upload(t, dbPath, "items.csv", "id,name,qty\n1,apple,3\n", map[string]string{"table": "items"})
+	if resp.Status != "error" || resp.Data.Result.Failed != 1 {
+		t.Errorf("expected a duplicate key to be rejected: %+v", resp)
+	}
+
+	resp = upload(t, dbPath, "items.csv", "id,name,qty\n1,apple,10\n3,plum,1\n", map[string]string{"table": "items", "mode": "upsert"})
+	if resp.Status != "success" || resp.Data.Result.Inserted != 2 {
+		t.Fatalf("unexpected upsert response: %+v", resp)
+	}
+	var n int
+	db.QueryRow("SELECT qty FROM items WHERE id = 1").Scan(&n)
+	if n != 10 || count(t, db) != 3 {
+		t.Errorf("upsert did not update: qty %d, %d rows", n, count(t, db))
+	}
+
+	resp = upload(t, dbPath, "items.csv", "name\nkiwi\n", map[string]string{"table": "items", "mode": "upsert"})
+	if resp.Status != "error" || len(resp.Data.Result.Errors) != 1 || resp.Data.Result.Errors[0].Column != "id" {
+		t.Errorf("expected upsert without the key to be rejected: %+v", resp)
+	}
+
+	replace := map[string]string{"table": "items", "mode": "replace", "header": "no",
+		"mapping": `{"column_1": "id", "column_2": "name", "column_3": "qty"}`}
+	resp = upload(t, dbPath, "items.csv", "7,fig,2\n", replace)
+	if resp.Status != "error" || !strings.Contains(resp.Message, "confirm_replace") || count(t, db) != 3 {
+		t.Errorf("expected replace to need its own confirmation: %+v, %d rows", resp, count(t, db))
+	}
+
+	replace["confirm_replace"] = "items"
+	resp = upload(t, dbPath, "items.csv", "7,fig,2\n", replace)
+	if resp.Status != "success" || count(t, db) != 1 {
+		t.Errorf("replace should leave only the imported row: %+v, %d rows", resp, count(t, db))
+	}
+}
+
+func TestImport_ReplaceGuards(t *testing.T) {
+	db, dbPath := setupTestDB(t)
+	db.Exec("INSERT INTO items (id, name) VALUES (1, 'apple')")
+	fields := map[string]string{"table": "items", "mode": "replace", "confirm_replace": "items"}
+
+	policy, err := rbac.Parse([]byte(`{
+		"roles": {"loader": [{"permissions": ["import"]}], "editor": [{"permissions": ["import", "edit"]}]},
+		"users": {"ann": ["loader"], "eve": ["editor"]}
+	}`))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	config := types.Config{SessionSecret: "test-secret", Policy: policy}
+
+	resp := uploadAs(t, config, auth.User{Name: "ann"}, dbPath, "items.csv", "id,name\n2,pear\n", fields)
+	if resp.Status != "error" || !strings.Contains(resp.Message, "permission denied: edit") || count(t, db) != 1 {
+		t.Errorf("expected replace to need the edit permission: %+v", resp)
+	}
+	resp = uploadAs(t, config, auth.User{Name: "ann"}, dbPath, "items.csv", "id,name\n2,pear\n", map[string]string{"table": "items"})
+	if resp.Status != "success" || count(t, db) != 2 {
+		t.Errorf("expected inserts with the import permission alone: %+v", resp)
+	}
+	resp = uploadAs(t, config, auth.User{Name: "eve"}, dbPath, "items.csv", "id,name\n3,plum\n", fields)
+	if resp.Status != "success" || count(t, db) != 1 {
+		t.Errorf("expected replace with the edit permission: %+v, %d rows", resp, count(t, db))
+	}
+
+	readOnly := types.Config{SessionSecret: "test-secret", ReadOnlyMode: true}
+	resp = uploadAs(t, readOnly, auth.User{}, dbPath, "items.csv", "id,name\n4,fig\n", fields)
+	if resp.Status != "error" || count(t, db) != 1 {
+		t.Errorf("expected imports refused in read-only mode: %+v", resp)
+	}
+}
+
+func TestImport_CreateTable(t *testing.T) {
+	db, dbPath := setupTestDB(t)
+	content := "code,price,seen,note\n001,1.50,2024-01-02,\n002,12.25,2024-02-03,hello\n"
+
+	resp := upload(t, dbPath, "products.csv", content, map[string]string{"table": "products", "create_table": "yes", "dry_run": "yes"})
+	if resp.Status != "success" || resp.Data.Result.Inserted != 2 {
+		t.Fatalf("unexpected dry run response: %+v", resp)
+	}
+	var name string
+	if err := db.QueryRow("SELECT name FROM sqlite_master WHERE name = 'products'").Scan(&name); err != sql.ErrNoRows {
+		t.Fatalf("dry run created the table")
+	}
+
+	resp = upload(t, dbPath, "products.csv", content, map[string]string{"table": "products", "create_table": "yes"})
+	if resp.Status != "success" || resp.Data.Result.Inserted != 2 {
+		t.Fatalf("unexpected import response: %+v", resp)
+	}
+	var (
+		code  string
+		price float64
+		note  sql.NullString
+	)
+	db.QueryRow("SELECT code, price, note FROM products WHERE seen = '2024-01-02'").Scan(&code, &price, &note)
+	if code != "001" || price != 1.5 || note.String != "" {
+		t.Errorf("unexpected row: %q %v %v", code, price, note)
+	}
+
+	// a rolled back import leaves no table behind
+	resp = upload(t, dbPath, "other.csv", "id,qty\n1,2\n1,3\n", map[string]string{"table": "other", "create_table": "yes",
+		"col_name[]": "id", "col_type[]": "INTEGER", "col_pk[]": "1"})
+	if resp.Status != "error" {
+		t.Fatalf("expected the duplicate key to roll back: %+v", resp)
+	}
+	if err := db.QueryRow("SELECT name FROM sqlite_master WHERE name = 'other'").Scan(&name); err != sql.ErrNoRows {
+		t.Errorf("the table of a rolled back import was kept")
+	}
+}
+
+func TestImport_AsyncProgress(t *testing.T) {
+	db, dbPath := setupTestDB(t)
+	u, err := jobs.SaveUpload("test-session", "items.csv", strings.NewReader("id,name\n1,apple\n2,pear\n"))
+	if err != nil {
+		t.Fatalf("failed to save upload: %v", err)
+	}
+
+	form := url.Values{"upload_id": {u.ID}, "table": {"items"}, "async": {"yes"}}
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.AddCookie(testutil.SessionCookie(t, dbPath))
+	w := httptest.NewRecorder()
+	api_import.New(types.Config{SessionSecret: "test-secret"}, runner).Handle(w, req)
+
+	var started struct {
+		Status string `json:"status"`
+		Data   struct {
+			JobID string `json:"job_id"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &started); err != nil || started.Status != "success" || started.Data.JobID == "" {
+		t.Fatalf("unexpected response: %s", w.Body.String())
+	}
+
+	var progress struct {
+		Status string `json:"status"`
+		Data   struct {
+			Job struct {
+				State     string `json:"state"`
+				BytesRead int64  `json:"bytes_read"`
+				Size      int64  `json:"size"`
+				Result    struct {
+					Inserted  int64 `json:"inserted"`
+					Committed bool  `json:"committed"`
+				} `json:"result"`
+			} `json:"job"`
+		} `json:"data"`
+	}
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(20 * time.Millisecond) {
+		req := httptest.NewRequest(http.MethodGet, "/?job_id="+started.Data.JobID, nil)
+		req.AddCookie(testutil.SessionCookie(t, dbPath))
+		w := httptest.NewRecorder()
+		api_job_status.New(types.Config{SessionSecret: "test-secret"}, runner).Handle(w, req)
+		if err := json.Unmarshal(w.Body.Bytes(), &progress); err != nil {
+			t.Fatalf("failed to decode progress %q: %v", w.Body.String(), err)
+		}
+		if state := progress.Data.Job.State; state != jobs.StateQueued && state != jobs.StateRunning {
+			break
+		}
+	}
+
+	job := progress.Data.Job
+	if job.State != jobs.StateDone || !job.Result.Committed || job.Result.Inserted != 2 || job.BytesRead != job.Size {
+		t.Fatalf("unexpected job status: %+v", job)
+	}
+	if count(t, db) != 2 {
+		t.Errorf("expected 2 rows, got %d", count(t, db))
+	}
+}
+
+func TestImport_Audit(t *testing.T) {
+	_, dbPath := setupTestDB(t)
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	mw.WriteField("table", "items")
+	fw, _ := mw.CreateFormFile("file", "items.csv")
+	fw.Write([]byte("id,name\n1,apple\n2,pear\n"))
+	mw.Close()
+
+	entry := &audit.Entry{RowsAffected: -1}
+	req := httptest.NewRequest(http.MethodPost, "/", &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	req.AddCookie(testutil.SessionCookie(t, dbPath))
+	req = req.WithContext(audit.WithEntry(req.Context(), entry))
+	w := httptest.NewRecorder()
+	api_import.New(types.Config{SessionSecret: "test-secret"}, runner).Handle(w, req)
+
+	if entry.Object != "items" || entry.RowsAffected != 2 {
+		t.Errorf("expected the table and rows imported in the audit entry, got %+v (%s)", entry, w.Body.String())
+	}
+}
@@ -0,0 +1,177 @@
+package api_import_preview
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/dracory/api"
+	"github.com/dracory/weebase/shared/dataimport"
+	"github.com/dracory/weebase/shared/dialect"
+	"github.com/dracory/weebase/shared/driver"
+	"github.com/dracory/weebase/shared/introspect"
+	"github.com/dracory/weebase/shared/jobs"
+	"github.com/dracory/weebase/shared/session"
+	"github.com/dracory/weebase/shared/types"
+)
+
+// maxMemory is how much of an upload is held in memory before spilling to a temp file
+const maxMemory = 32 << 20
+
+// defaultSample is the number of rows returned for display
+const defaultSample = 20
+
+// ImportPreview stores an upload for a following import and describes its
+// headers, first rows and inferred column types
+type ImportPreview struct {
+	config types.Config
+}
+
+// New creates a new ImportPreview handler
+func New(config types.Config) *ImportPreview {
+	return &ImportPreview{config: config}
+}
+
+// Handle processes the request.
+//
+// Parameters: file (multipart upload) or data (inline text), or upload_id to
+// preview an earlier upload again with other options; format, the CSV
+// options delimiter, header, null and encoding, sample (rows to return) and
+// optionally schema and table, in which case the table's columns and a
+// suggested mapping of header to column are included.
+func (h *ImportPreview) Handle(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		api.Respond(w, r, api.Error("method not allowed"))
+		return
+	}
+
+	sess := session.EnsureSession(w, r, h.config.SessionSecret)
+	if sess == nil || sess.Conn == nil {
+		api.Respond(w, r, api.Error("not connected to database"))
+		return
+	}
+
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		if err := r.ParseMultipartForm(maxMemory); err != nil {
+			api.Respond(w, r, api.Error("failed to parse form"))
+			return
+		}
+	} else if err := r.ParseForm(); err != nil {
+		api.Respond(w, r, api.Error("failed to parse form"))
+		return
+	}
+
+	sample := defaultSample
+	if v := strings.TrimSpace(r.Form.Get("sample")); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			api.Respond(w, r, api.Error("sample must be a non-negative number"))
+			return
+		}
+		sample = min(n, dataimport.InferRows)
+	}
+
+	schema := strings.TrimSpace(r.Form.Get("schema"))
+	table := strings.TrimSpace(r.Form.Get("table"))
+	if (table != "" && !dialect.SanitizeIdent(table)) || (schema != "" && !dialect.SanitizeIdent(schema)) {
+		api.Respond(w, r, api.Error("invalid table or schema identifier"))
+		return
+	}
+
+	upload, err := store(r, sess.ID)
+	if err != nil {
+		api.Respond(w, r, api.Error(err.Error()))
+		return
+	}
+	f, upload, err := jobs.OpenUpload(sess.ID, upload.ID)
+	if err != nil {
+		api.Respond(w, r, api.Error(err.Error()))
+		return
+	}
+	defer f.Close()
+
+	format := strings.ToLower(strings.TrimSpace(r.Form.Get("format")))
+	if format == "" {
+		format = dataimport.FormatFromName(upload.Name)
+	}
+	drv := dialect.Normalize(sess.Conn.Driver)
+	preview, err := dataimport.NewPreview(drv, format, f, dataimport.CSVOptionsFromForm(r.Form), sample)
+	if err != nil {
+		api.Respond(w, r, api.Error(fmt.Sprintf("failed to read file: %v", err)))
+		return
+	}
+
+	data := map[string]any{
+		"upload":  upload,
+		"preview": preview,
+	}
+
+	if table != "" {
+		db, err := driver.OpenSQLDB(sess.Conn.Driver, sess.Conn.DSN)
+		if err != nil {
+			api.Respond(w, r, api.Error(fmt.Sprintf("failed to connect to database: %v", err)))
+			return
+		}
+		defer db.Close()
+
+		target, err := introspect.DescribeTable(r.Context(), db, drv, schema, table)
+		if err != nil {
+			api.Respond(w, r, api.Error(fmt.Sprintf("failed to read table: %v", err)))
+			return
+		}
+		data["columns"] = target.Columns
+		data["mapping"] = suggestMapping(preview.Headers, target)
+	}
+
+	api.Respond(w, r, api.SuccessWithData("preview ready", data))
+}
+
+// store keeps the uploaded file, or returns the upload named by upload_id
+func store(r *http.Request, owner string) (jobs.Upload, error) {
+	if id := strings.TrimSpace(r.Form.Get("upload_id")); id != "" {
+		f, u, err := jobs.OpenUpload(owner, id)
+		if err != nil {
+			return u, err
+		}
+		f.Close()
+		return u, nil
+	}
+
+	var src io.Reader
+	name := ""
+	if r.MultipartForm != nil {
+		if file, header, err := r.FormFile("file"); err == nil {
+			defer file.Close()
+			src, name = file, header.Filename
+		}
+	}
+	if src == nil {
+		data := r.Form.Get("data")
+		if data == "" {
+			return jobs.Upload{}, fmt.Errorf("file is required")
+		}
+		src = strings.NewReader(data)
+	}
+	return jobs.SaveUpload(owner, name, src)
+}
+
+// suggestMapping pairs headers with columns of the same name, ignoring case
+// and treating spaces and dashes as underscores; unmatched headers map to ""
+func suggestMapping(headers []string, table introspect.Table) map[string]string {
+	normalize := func(s string) string {
+		return strings.ToLower(strings.NewReplacer(" ", "_", "-", "_").Replace(strings.TrimSpace(s)))
+	}
+	mapping := map[string]string{}
+	for _, h := range headers {
+		mapping[h] = ""
+		for _, c := range table.Columns {
+			if normalize(c.Name) == normalize(h) {
+				mapping[h] = c.Name
+				break
+			}
+		}
+	}
+	return mapping
+}
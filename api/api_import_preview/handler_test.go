@@ -0,0 +1,146 @@
+package api_import_preview_test
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/dracory/weebase/api/api_import_preview"
+	"github.com/dracory/weebase/shared/testutil"
+	"github.com/dracory/weebase/shared/types"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func setupTestDB(t *testing.T) string {
+	tempFile, err := os.CreateTemp("", "testdb-*.db")
+	if err != nil {
+		t.Fatalf("failed to create temp file: %v", err)
+	}
+	tempFile.Close()
+	t.Cleanup(func() { os.Remove(tempFile.Name()) })
+
+	db, err := sql.Open("sqlite3", tempFile.Name())
+	if err != nil {
+		t.Fatalf("failed to open SQLite database: %v", err)
+	}
+	defer db.Close()
+
+	if _, err := db.Exec(`CREATE TABLE people (id INTEGER PRIMARY KEY, full_name TEXT, born DATE)`); err != nil {
+		t.Fatalf("failed to create table: %v", err)
+	}
+	return tempFile.Name()
+}
+
+type previewResponse struct {
+	Status  string `json:"status"`
+	Message string `json:"message"`
+	Data    struct {
+		Upload struct {
+			ID   string `json:"id"`
+			Name string `json:"name"`
+			Size int64  `json:"size"`
+		} `json:"upload"`
+		Preview struct {
+			Format    string     `json:"format"`
+			Delimiter string     `json:"delimiter"`
+			Headers   []string   `json:"headers"`
+			Rows      [][]string `json:"rows"`
+			Columns   []struct {
+				Name     string `json:"name"`
+				Type     string `json:"type"`
+				Nullable bool   `json:"nullable"`
+			} `json:"columns"`
+		} `json:"preview"`
+		Mapping map[string]string `json:"mapping"`
+	} `json:"data"`
+}
+
+func post(t *testing.T, req *http.Request, dbPath string) previewResponse {
+	req.AddCookie(testutil.SessionCookie(t, dbPath))
+	w := httptest.NewRecorder()
+	api_import_preview.New(types.Config{SessionSecret: "test-secret"}).Handle(w, req)
+
+	var resp previewResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to decode response %q: %v", w.Body.String(), err)
+	}
+	return resp
+}
+
+func TestPreview_CSV(t *testing.T) {
+	dbPath := setupTestDB(t)
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	mw.WriteField("table", "people")
+	mw.WriteField("sample", "2")
+	fw, _ := mw.CreateFormFile("file", "people.csv")
+	fw.Write([]byte("ID\tFull Name\tBorn\tScore\n1\tAda\t1815-12-10\t9.5\n2\tAlan\t1912-06-23\t\n3\tGrace\t1906-12-09\t10\n"))
+	mw.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/", &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	resp := post(t, req, dbPath)
+
+	if resp.Status != "success" {
+		t.Fatalf("unexpected response: %+v", resp)
+	}
+	p := resp.Data.Preview
+	if p.Format != "csv" || p.Delimiter != "\t" || strings.Join(p.Headers, ",") != "ID,Full Name,Born,Score" {
+		t.Errorf("unexpected preview: %+v", p)
+	}
+	if len(p.Rows) != 2 || p.Rows[1][1] != "Alan" {
+		t.Errorf("expected 2 sample rows, got %v", p.Rows)
+	}
+
+	typeOf := map[string]string{}
+	for _, c := range p.Columns {
+		typeOf[c.Name] = c.Type
+	}
+	if typeOf["ID"] != "INTEGER" || typeOf["Born"] != "DATE" || typeOf["Score"] != "NUMERIC" || typeOf["Full Name"] != "VARCHAR(255)" {
+		t.Errorf("unexpected inferred types: %v", typeOf)
+	}
+	if !p.Columns[3].Nullable || p.Columns[0].Nullable {
+		t.Errorf("unexpected nullability: %+v", p.Columns)
+	}
+
+	want := map[string]string{"ID": "id", "Full Name": "full_name", "Born": "born", "Score": ""}
+	for field, column := range want {
+		if resp.Data.Mapping[field] != column {
+			t.Errorf("expected %s to map to %q, got %q", field, column, resp.Data.Mapping[field])
+		}
+	}
+
+	// the stored upload can be previewed again with other options
+	form := url.Values{"upload_id": {resp.Data.Upload.ID}, "header": {"no"}, "delimiter": {"tab"}}
+	req = httptest.NewRequest(http.MethodPost, "/", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	again := post(t, req, dbPath)
+	if again.Status != "success" || again.Data.Preview.Headers[0] != "column_1" || len(again.Data.Preview.Rows) != 4 {
+		t.Errorf("unexpected preview without header: %+v", again.Data.Preview)
+	}
+}
+
+func TestPreview_Errors(t *testing.T) {
+	dbPath := setupTestDB(t)
+
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(""))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if resp := post(t, req, dbPath); resp.Message != "file is required" {
+		t.Errorf("unexpected response: %+v", resp)
+	}
+
+	form := url.Values{"upload_id": {"nope"}}
+	req = httptest.NewRequest(http.MethodPost, "/", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if resp := post(t, req, dbPath); resp.Message != "upload not found or expired" {
+		t.Errorf("unexpected response: %+v", resp)
+	}
+}
@@ -0,0 +1,59 @@
+package api_job_download
+
+import (
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/dracory/api"
+	"github.com/dracory/weebase/shared/jobs"
+	"github.com/dracory/weebase/shared/session"
+	"github.com/dracory/weebase/shared/types"
+)
+
+// JobDownload serves the output file of a finished background job, such as
+// an export or dump started with async=yes
+type JobDownload struct {
+	config types.Config
+	jobs   *jobs.Runner
+}
+
+// New creates a new JobDownload handler
+func New(config types.Config, runner *jobs.Runner) *JobDownload {
+	return &JobDownload{config: config, jobs: runner}
+}
+
+// Handle processes the request. Parameters: job_id. The file can be
+// downloaded any number of times until the job expires.
+func (h *JobDownload) Handle(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		api.Respond(w, r, api.Error("method not allowed"))
+		return
+	}
+
+	sess := session.EnsureSession(w, r, h.config.SessionSecret)
+	if sess == nil {
+		api.Respond(w, r, api.Error("failed to get session"))
+		return
+	}
+
+	id := strings.TrimSpace(r.URL.Query().Get("job_id"))
+	if id == "" {
+		api.Respond(w, r, api.Error("job_id is required"))
+		return
+	}
+
+	f, artifact, err := h.jobs.OpenArtifact(sess.ID, id)
+	if err != nil {
+		api.Respond(w, r, api.Error(err.Error()))
+		return
+	}
+	defer f.Close()
+
+	w.Header().Set("Content-Type", artifact.ContentType)
+	// the name may hold quotes or non-ASCII characters, which need escaping
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": artifact.Name}))
+	w.Header().Set("Cache-Control", "no-store")
+	http.ServeContent(w, r, artifact.Name, time.Time{}, f)
+}
@@ -0,0 +1,179 @@
+package api_job_download_test
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"io"
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dracory/weebase/api/api_export"
+	"github.com/dracory/weebase/api/api_job_download"
+	"github.com/dracory/weebase/api/api_job_status"
+	"github.com/dracory/weebase/api/api_jobs_list"
+	"github.com/dracory/weebase/shared/jobs"
+	"github.com/dracory/weebase/shared/testutil"
+	"github.com/dracory/weebase/shared/types"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+var config = types.Config{SessionSecret: "test-secret"}
+
+func setupTestDB(t *testing.T) string {
+	tempFile, err := os.CreateTemp("", "testdb-*.db")
+	if err != nil {
+		t.Fatalf("failed to create temp file: %v", err)
+	}
+	tempFile.Close()
+	t.Cleanup(func() { os.Remove(tempFile.Name()) })
+
+	db, err := sql.Open("sqlite3", tempFile.Name())
+	if err != nil {
+		t.Fatalf("failed to open SQLite database: %v", err)
+	}
+	defer db.Close()
+
+	stmts := []string{
+		`CREATE TABLE people (id INTEGER PRIMARY KEY, name TEXT)`,
+		`INSERT INTO people (id, name) VALUES (1, 'Alice'), (2, 'Bob')`,
+	}
+	for _, stmt := range stmts {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatalf("failed to execute %q: %v", stmt, err)
+		}
+	}
+	return tempFile.Name()
+}
+
+// call runs a handler with the session cookie and returns the recorder
+func call(handle http.HandlerFunc, cookie *http.Cookie, method, query string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, "/?"+query, nil)
+	req.AddCookie(cookie)
+	w := httptest.NewRecorder()
+	handle(w, req)
+	return w
+}
+
+type jobResponse struct {
+	Status  string `json:"status"`
+	Message string `json:"message"`
+	Data    struct {
+		JobID string        `json:"job_id"`
+		Job   jobs.Status   `json:"job"`
+		Jobs  []jobs.Status `json:"jobs"`
+	} `json:"data"`
+}
+
+func decode(t *testing.T, w *httptest.ResponseRecorder) jobResponse {
+	var resp jobResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to decode response %q: %v", w.Body.String(), err)
+	}
+	return resp
+}
+
+func TestJobDownload_AsyncExport(t *testing.T) {
+	dbPath := setupTestDB(t)
+	cookie := testutil.SessionCookieWithID(t, "test-session", dbPath)
+	runner := jobs.NewRunner(jobs.NewMemoryStore(), jobs.Options{ArtifactDir: t.TempDir()})
+
+	form := url.Values{"table": {"people"}, "order": {"id"}, "async": {"yes"}}
+	started := decode(t, call(api_export.New(config, runner).Handle, cookie, http.MethodGet, form.Encode()))
+	if started.Status != "success" || started.Data.JobID == "" {
+		t.Fatalf("unexpected response: %+v", started)
+	}
+	id := url.Values{"job_id": {started.Data.JobID}}.Encode()
+
+	var job jobs.Status
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(20 * time.Millisecond) {
+		job = decode(t, call(api_job_status.New(config, runner).Handle, cookie, http.MethodGet, id)).Data.Job
+		if job.Done() {
+			break
+		}
+	}
+	if job.State != jobs.StateDone || job.Kind != jobs.KindExport || job.Artifact == nil || job.Artifact.Name != "people.csv" {
+		t.Fatalf("unexpected job status: %+v", job)
+	}
+
+	w := call(api_job_download.New(config, runner).Handle, cookie, http.MethodGet, id)
+	body, _ := io.ReadAll(w.Body)
+	if string(body) != "id,name\n1,Alice\n2,Bob\n" {
+		t.Errorf("unexpected artifact %q", body)
+	}
+	if got := w.Header().Get("Content-Disposition"); got != `attachment; filename=people.csv` {
+		t.Errorf("unexpected disposition %q", got)
+	}
+
+	list := decode(t, call(api_jobs_list.New(config, runner).Handle, cookie, http.MethodGet, ""))
+	if len(list.Data.Jobs) != 1 || list.Data.Jobs[0].ID != started.Data.JobID {
+		t.Errorf("unexpected job list: %+v", list.Data.Jobs)
+	}
+
+	// another session sees neither the job nor its file
+	other := testutil.SessionCookieWithID(t, "other-session", dbPath)
+	resp := decode(t, call(api_job_download.New(config, runner).Handle, other, http.MethodGet, id))
+	if resp.Status != "error" || !strings.Contains(resp.Message, "not found") {
+		t.Errorf("expected the job to be hidden from other sessions: %+v", resp)
+	}
+	if list := decode(t, call(api_jobs_list.New(config, runner).Handle, other, http.MethodGet, "")); len(list.Data.Jobs) != 0 {
+		t.Errorf("unexpected jobs for another session: %+v", list.Data.Jobs)
+	}
+}
+
+func TestJobDownload_Errors(t *testing.T) {
+	dbPath := setupTestDB(t)
+	cookie := testutil.SessionCookieWithID(t, "test-session", dbPath)
+	runner := jobs.NewRunner(jobs.NewMemoryStore(), jobs.Options{ArtifactDir: t.TempDir()})
+
+	if resp := decode(t, call(api_job_download.New(config, runner).Handle, cookie, http.MethodGet, "")); resp.Message != "job_id is required" {
+		t.Errorf("unexpected response: %+v", resp)
+	}
+	if resp := decode(t, call(api_job_download.New(config, runner).Handle, cookie, http.MethodPost, "job_id=x")); resp.Message != "method not allowed" {
+		t.Errorf("unexpected response: %+v", resp)
+	}
+
+	// a bad format is reported before anything is queued
+	form := url.Values{"table": {"people"}, "format": {"pdf"}, "async": {"yes"}}
+	if resp := decode(t, call(api_export.New(config, runner).Handle, cookie, http.MethodGet, form.Encode())); resp.Status != "error" || resp.Data.JobID != "" {
+		t.Errorf("expected an invalid format to be rejected: %+v", resp)
+	}
+}
+
+func TestJobDownload_Filename(t *testing.T) {
+	dbPath := setupTestDB(t)
+	cookie := testutil.SessionCookieWithID(t, "test-session", dbPath)
+	runner := jobs.NewRunner(jobs.NewMemoryStore(), jobs.Options{ArtifactDir: t.TempDir()})
+
+	for _, name := range []string{`odd "name"; x=1.csv`, "données.csv"} {
+		id, err := runner.Submit(jobs.Spec{Kind: jobs.KindExport, Owner: "test-session",
+			Run: func(ctx context.Context, task *jobs.Task) (any, error) {
+				out, err := task.Artifact(name, "text/csv")
+				if err != nil {
+					return nil, err
+				}
+				_, err = io.WriteString(out, "id\n")
+				return nil, err
+			}})
+		if err != nil {
+			t.Fatalf("Submit: %v", err)
+		}
+		for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(20 * time.Millisecond) {
+			if status, _ := runner.Get("test-session", id); status.Done() {
+				break
+			}
+		}
+
+		w := call(api_job_download.New(config, runner).Handle, cookie, http.MethodGet, url.Values{"job_id": {id}}.Encode())
+		disposition, params, err := mime.ParseMediaType(w.Header().Get("Content-Disposition"))
+		if err != nil || disposition != "attachment" || params["filename"] != name {
+			t.Errorf("%q: unexpected disposition %q (%v)", name, w.Header().Get("Content-Disposition"), err)
+		}
+	}
+}
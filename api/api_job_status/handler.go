@@ -0,0 +1,63 @@
+package api_job_status
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/dracory/api"
+	"github.com/dracory/weebase/shared/jobs"
+	"github.com/dracory/weebase/shared/session"
+	"github.com/dracory/weebase/shared/types"
+)
+
+// JobStatus reports on, or cancels, a background job such as an export,
+// dump, data import, SQL script or table copy started with async=yes
+type JobStatus struct {
+	config types.Config
+	jobs   *jobs.Runner
+}
+
+// New creates a new JobStatus handler
+func New(config types.Config, runner *jobs.Runner) *JobStatus {
+	return &JobStatus{config: config, jobs: runner}
+}
+
+// Handle processes the request.
+//
+// Parameters: job_id, and cancel=yes (POST only) to stop the job; a queued
+// job never starts, a data import or table copy is rolled back, a script
+// stops after the current statement and an export or dump drops its partial
+// file. The job status is returned either way.
+func (h *JobStatus) Handle(w http.ResponseWriter, r *http.Request) {
+	sess := session.EnsureSession(w, r, h.config.SessionSecret)
+	if sess == nil {
+		api.Respond(w, r, api.Error("failed to get session"))
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		api.Respond(w, r, api.Error("failed to parse form"))
+		return
+	}
+
+	id := strings.TrimSpace(r.Form.Get("job_id"))
+	if id == "" {
+		api.Respond(w, r, api.Error("job_id is required"))
+		return
+	}
+
+	if r.Form.Get("cancel") == "yes" {
+		if r.Method != http.MethodPost {
+			api.Respond(w, r, api.Error("method not allowed"))
+			return
+		}
+		h.jobs.Cancel(sess.ID, id)
+	}
+
+	status, ok := h.jobs.Get(sess.ID, id)
+	if !ok {
+		api.Respond(w, r, api.Error("job not found"))
+		return
+	}
+	api.Respond(w, r, api.SuccessWithData(status.State, map[string]any{"job": status}))
+}
@@ -0,0 +1,38 @@
+package api_jobs_list
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/dracory/api"
+	"github.com/dracory/weebase/shared/jobs"
+	"github.com/dracory/weebase/shared/session"
+	"github.com/dracory/weebase/shared/types"
+)
+
+// JobsList lists the background jobs of the session that haven't expired
+type JobsList struct {
+	config types.Config
+	jobs   *jobs.Runner
+}
+
+// New creates a new JobsList handler
+func New(config types.Config, runner *jobs.Runner) *JobsList {
+	return &JobsList{config: config, jobs: runner}
+}
+
+// Handle processes the request, returning the jobs newest first
+func (h *JobsList) Handle(w http.ResponseWriter, r *http.Request) {
+	sess := session.EnsureSession(w, r, h.config.SessionSecret)
+	if sess == nil {
+		api.Respond(w, r, api.Error("failed to get session"))
+		return
+	}
+
+	list, err := h.jobs.List(sess.ID)
+	if err != nil {
+		api.Respond(w, r, api.Error(fmt.Sprintf("failed to list jobs: %v", err)))
+		return
+	}
+	api.Respond(w, r, api.SuccessWithData("jobs listed", map[string]any{"jobs": list}))
+}
@@ -0,0 +1,134 @@
+package api_migration_generate
+
+import (
+	"archive/zip"
+	"net/http"
+	"strings"
+
+	"github.com/dracory/api"
+	"github.com/dracory/weebase/shared/constants"
+	"github.com/dracory/weebase/shared/dialect"
+	"github.com/dracory/weebase/shared/migrations"
+	"github.com/dracory/weebase/shared/session"
+	"github.com/dracory/weebase/shared/sqlsplit"
+	"github.com/dracory/weebase/shared/types"
+)
+
+// MigrationGenerate turns arbitrary DDL (e.g. a schema diff script or
+// statements run in the SQL editor) into versioned migration files.
+// Nothing is executed against the database.
+type MigrationGenerate struct {
+	config types.Config
+}
+
+// New creates a new MigrationGenerate handler
+func New(config types.Config) *MigrationGenerate {
+	return &MigrationGenerate{config: config}
+}
+
+// Handle processes the request.
+//
+// Parameters: "up" (required SQL script), "down" (optional; derived from up
+// when empty), "name", "format" (golang-migrate or goose) and "driver" (the
+// dialect for down derivation, defaulting to the active connection's).
+// With download=yes the files are streamed back (a zip for golang-migrate)
+// instead of being written to the migrations directory.
+func (h *MigrationGenerate) Handle(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		api.Respond(w, r, api.Error("method not allowed"))
+		return
+	}
+
+	sess := session.EnsureSession(w, r, h.config.SessionSecret)
+	if sess == nil {
+		api.Respond(w, r, api.Error("failed to get session"))
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		api.Respond(w, r, api.Error("failed to parse form"))
+		return
+	}
+
+	drv := dialect.Normalize(strings.TrimSpace(r.Form.Get("driver")))
+	if drv == "" && sess.Conn != nil {
+		drv = dialect.Normalize(sess.Conn.Driver)
+	}
+	if drv == "" {
+		api.Respond(w, r, api.Error("driver is required when not connected to a database"))
+		return
+	}
+
+	up := splitScript(drv, r.Form.Get("up"))
+	if len(up) == 0 {
+		api.Respond(w, r, api.Error("up SQL is required"))
+		return
+	}
+	down := splitScript(drv, r.Form.Get("down"))
+
+	format := strings.TrimSpace(r.Form.Get("format"))
+	if format == "" {
+		format = h.config.MigrationsFormat
+	}
+	if format != "" && !migrations.ValidFormat(format) {
+		api.Respond(w, r, api.Error("unsupported migration format"))
+		return
+	}
+
+	name := strings.TrimSpace(r.Form.Get("name"))
+
+	if r.Form.Get("download") == "yes" {
+		result, err := migrations.Capture("", format, drv, name, up, down)
+		if err != nil {
+			api.Respond(w, r, api.Error(err.Error()))
+			return
+		}
+		writeDownload(w, result)
+		return
+	}
+
+	result, err := migrations.Capture(h.config.MigrationsDir, format, drv, name, up, down)
+	if err != nil {
+		api.Respond(w, r, api.Error(err.Error()))
+		return
+	}
+
+	api.Respond(w, r, api.SuccessWithData("migration_generated", map[string]any{
+		"migration": result,
+	}))
+}
+
+// splitScript splits a script into statements, honouring backslash escapes on MySQL only
+func splitScript(drv, script string) []string {
+	sc := sqlsplit.NewScanner(strings.NewReader(script))
+	sc.BackslashEscapes = drv == constants.DriverMySQL
+	stmts := []string{}
+	for sc.Scan() {
+		stmts = append(stmts, sc.Statement().SQL)
+	}
+	return stmts
+}
+
+// writeDownload sends a single file as is and several files as a zip archive
+func writeDownload(w http.ResponseWriter, result migrations.Result) {
+	if len(result.Files) == 1 {
+		w.Header().Set("Content-Type", "application/sql; charset=utf-8")
+		w.Header().Set("Content-Disposition", `attachment; filename="`+result.Files[0].Name+`"`)
+		_, _ = w.Write([]byte(result.Files[0].Content))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+result.Version+"_"+result.Name+`.zip"`)
+	zw := zip.NewWriter(w)
+	for _, f := range result.Files {
+		fw, err := zw.Create(f.Name)
+		if err != nil {
+			return
+		}
+		if _, err := fw.Write([]byte(f.Content)); err != nil {
+			return
+		}
+	}
+	_ = zw.Close()
+}
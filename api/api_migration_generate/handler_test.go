@@ -0,0 +1,126 @@
+package api_migration_generate_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/dracory/weebase/api/api_migration_generate"
+	"github.com/dracory/weebase/shared/types"
+)
+
+func post(config types.Config, form url.Values) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("POST", "/", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	api_migration_generate.New(config).Handle(w, req)
+	return w
+}
+
+func TestMigrationGenerate_WritesGolangMigrateFiles(t *testing.T) {
+	dir := t.TempDir()
+	config := types.Config{SessionSecret: "test-secret", MigrationsDir: dir}
+
+	w := post(config, url.Values{
+		"driver": {"postgres"},
+		"name":   {"Add orders"},
+		"up": {`CREATE TABLE "public"."orders" (id serial PRIMARY KEY);
+			CREATE INDEX idx_orders_id ON "public"."orders" (id);
+			ALTER TABLE "public"."orders" ADD COLUMN note text;`},
+	})
+
+	var response struct {
+		Status  string `json:"status"`
+		Message string `json:"message"`
+		Data    struct {
+			Migration struct {
+				Name         string   `json:"name"`
+				Down         []string `json:"down"`
+				DownComplete bool     `json:"down_complete"`
+				Written      bool     `json:"written"`
+				Files        []struct {
+					Name string `json:"name"`
+					Path string `json:"path"`
+				} `json:"files"`
+			} `json:"migration"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if response.Status != "success" {
+		t.Fatalf("expected success, got %s: %s", response.Status, response.Message)
+	}
+
+	m := response.Data.Migration
+	if m.Name != "add_orders" || !m.Written || !m.DownComplete {
+		t.Errorf("unexpected migration metadata: %+v", m)
+	}
+	wantDown := []string{
+		`ALTER TABLE "public"."orders" DROP COLUMN note`,
+		`DROP INDEX "public".idx_orders_id`,
+		`DROP TABLE "public"."orders"`,
+	}
+	if strings.Join(m.Down, "\n") != strings.Join(wantDown, "\n") {
+		t.Errorf("unexpected down statements:\n%s", strings.Join(m.Down, "\n"))
+	}
+
+	if len(m.Files) != 2 || !strings.HasSuffix(m.Files[0].Name, "_add_orders.up.sql") || !strings.HasSuffix(m.Files[1].Name, "_add_orders.down.sql") {
+		t.Fatalf("unexpected files: %+v", m.Files)
+	}
+	content, err := os.ReadFile(filepath.Join(dir, m.Files[1].Name))
+	if err != nil {
+		t.Fatalf("down file not written: %v", err)
+	}
+	if !strings.Contains(string(content), `DROP TABLE "public"."orders";`) {
+		t.Errorf("unexpected down file content:\n%s", content)
+	}
+}
+
+func TestMigrationGenerate_GooseDownloadAndManualDown(t *testing.T) {
+	config := types.Config{SessionSecret: "test-secret"}
+
+	w := post(config, url.Values{
+		"driver":   {"mysql"},
+		"format":   {"goose"},
+		"download": {"yes"},
+		"up":       {"UPDATE settings SET v = 1;"},
+	})
+
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "application/sql") {
+		t.Fatalf("expected a single SQL file download, got %q: %s", ct, w.Body.String())
+	}
+	body := w.Body.String()
+	for _, want := range []string{"-- +goose Up", "UPDATE settings SET v = 1;", "-- +goose Down", "-- TODO: no automatic down migration"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("expected %q in goose file:\n%s", want, body)
+		}
+	}
+}
+
+func TestMigrationGenerate_ZipDownload(t *testing.T) {
+	config := types.Config{SessionSecret: "test-secret", MigrationsFormat: "golang-migrate"}
+
+	w := post(config, url.Values{
+		"driver":   {"sqlite"},
+		"download": {"yes"},
+		"up":       {"CREATE TABLE t (id INTEGER PRIMARY KEY)"},
+	})
+
+	if ct := w.Header().Get("Content-Type"); ct != "application/zip" {
+		t.Fatalf("expected a zip download, got %q: %s", ct, w.Body.String())
+	}
+	zr, err := zip.NewReader(bytes.NewReader(w.Body.Bytes()), int64(w.Body.Len()))
+	if err != nil {
+		t.Fatalf("invalid zip: %v", err)
+	}
+	if len(zr.File) != 2 {
+		t.Errorf("expected up and down files, got %d", len(zr.File))
+	}
+}
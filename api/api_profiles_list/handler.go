@@ -21,6 +21,8 @@ type Profile struct {
 	Port     string `json:"port,omitempty"`
 	Username string `json:"username,omitempty"`
 	Database string `json:"database,omitempty"`
+	// Managed marks a profile configured on the server, opened by its ID
+	Managed bool `json:"managed,omitempty"`
 }
 
 // Handler handles the profiles list API requests
@@ -54,6 +56,11 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// server profiles are listed without their DSN
+	for _, p := range h.config.ConnectionProfiles {
+		profiles = append(profiles, Profile{ID: p.ID, Name: p.Name, Driver: p.Driver, Managed: true})
+	}
+
 	api.Respond(w, r, api.SuccessWithData("", map[string]interface{}{
 		"profiles": profiles,
 	}))
@@ -0,0 +1,126 @@
+package api_routine_execute
+
+import (
+	"database/sql"
+	"reflect"
+	"testing"
+
+	"github.com/dracory/weebase/shared/introspect"
+)
+
+func TestCheckValues(t *testing.T) {
+	routine := introspect.Routine{Arguments: []introspect.Argument{
+		{Position: 1, Name: "a", Mode: "IN"},
+		{Position: 2, Name: "b", Mode: "INOUT"},
+		{Position: 3, Name: "c", Mode: "OUT"},
+	}}
+	if err := checkValues(routine, []any{"1", nil}); err != nil {
+		t.Errorf("expected one value per input argument to pass, got %v", err)
+	}
+	err := checkValues(routine, []any{"1", "2", "3"})
+	if err == nil || err.Error() != "routine expects 2 parameters, got 3" {
+		t.Errorf("expected a count error, got %v", err)
+	}
+	if _, err := buildCall("postgres", routine, []any{"1"}); err == nil {
+		t.Error("expected buildCall to check the values")
+	}
+}
+
+func TestBuildCall_Postgres(t *testing.T) {
+	args := []introspect.Argument{
+		{Position: 1, Name: "a", Mode: "IN"},
+		{Position: 2, Name: "total", Mode: "OUT"},
+		{Position: 3, Name: "b", Mode: "INOUT"},
+	}
+	values := []any{"1", "2"}
+
+	procedure := introspect.Routine{Schema: "public", Name: "recalc", Kind: introspect.RoutineProcedure, Arguments: args}
+	c, err := buildCall("postgres", procedure, values)
+	if err != nil {
+		t.Fatalf("buildCall: %v", err)
+	}
+	if want := `CALL "public"."recalc"($1, NULL, $2)`; c.sql != want {
+		t.Errorf("expected %s, got %s", want, c.sql)
+	}
+	if !reflect.DeepEqual(c.args, values) {
+		t.Errorf("expected args %v, got %v", values, c.args)
+	}
+
+	function := introspect.Routine{Schema: "public", Name: "totals", Kind: introspect.RoutineFunction, Arguments: args}
+	c, err = buildCall("postgres", function, values)
+	if err != nil {
+		t.Fatalf("buildCall: %v", err)
+	}
+	if want := `SELECT * FROM "public"."totals"($1, $2)`; c.sql != want {
+		t.Errorf("expected %s, got %s", want, c.sql)
+	}
+}
+
+func TestBuildCall_MySQL(t *testing.T) {
+	function := introspect.Routine{Schema: "shop", Name: "price", Kind: introspect.RoutineFunction,
+		Arguments: []introspect.Argument{{Position: 1, Name: "id", Mode: "IN"}}}
+	c, err := buildCall("mysql", function, []any{"7"})
+	if err != nil {
+		t.Fatalf("buildCall: %v", err)
+	}
+	if want := "SELECT `shop`.`price`(?) AS `result`"; c.sql != want {
+		t.Errorf("expected %s, got %s", want, c.sql)
+	}
+
+	procedure := introspect.Routine{Schema: "shop", Name: "restock", Kind: introspect.RoutineProcedure,
+		Arguments: []introspect.Argument{
+			{Position: 1, Name: "id", Mode: "IN"},
+			{Position: 2, Name: "qty", Mode: "INOUT"},
+			{Position: 3, Name: "total", Mode: "OUT"},
+		}}
+	c, err = buildCall("mysql", procedure, []any{"7", "3"})
+	if err != nil {
+		t.Fatalf("buildCall: %v", err)
+	}
+	if want := "CALL `shop`.`restock`(?, @wb_out_2, @wb_out_3)"; c.sql != want {
+		t.Errorf("expected %s, got %s", want, c.sql)
+	}
+	if !reflect.DeepEqual(c.args, []any{"7"}) {
+		t.Errorf("expected only the IN value bound, got %v", c.args)
+	}
+	if want := []inoutValue{{name: "qty", variable: "@wb_out_2", value: "3"}}; !reflect.DeepEqual(c.inout, want) {
+		t.Errorf("expected %v, got %v", want, c.inout)
+	}
+	if want := map[string]string{"qty": "@wb_out_2", "total": "@wb_out_3"}; !reflect.DeepEqual(c.variables, want) {
+		t.Errorf("expected %v, got %v", want, c.variables)
+	}
+}
+
+func TestBuildCall_SQLServer(t *testing.T) {
+	procedure := introspect.Routine{Schema: "dbo", Name: "restock", Kind: introspect.RoutineProcedure,
+		Arguments: []introspect.Argument{
+			{Position: 1, Name: "id", Mode: "IN"},
+			{Position: 2, Name: "qty", Mode: "INOUT"},
+		}}
+	c, err := buildCall("sqlserver", procedure, []any{"7", "3"})
+	if err != nil {
+		t.Fatalf("buildCall: %v", err)
+	}
+	if want := "EXEC [dbo].[restock] @id = @id, @qty = @qty OUTPUT"; c.sql != want {
+		t.Errorf("expected %s, got %s", want, c.sql)
+	}
+	if len(c.args) != 2 {
+		t.Fatalf("expected two args, got %v", c.args)
+	}
+	if want := sql.Named("id", "7"); !reflect.DeepEqual(c.args[0], want) {
+		t.Errorf("expected %v, got %v", want, c.args[0])
+	}
+	out, ok := c.args[1].(sql.NamedArg).Value.(sql.Out)
+	if !ok || !out.In || c.args[1].(sql.NamedArg).Name != "qty" {
+		t.Fatalf("expected qty bound as an INOUT sql.Out, got %#v", c.args[1])
+	}
+	if dest := c.dests["qty"]; dest == nil || out.Dest != dest || *dest != "3" {
+		t.Errorf("expected the output destination to hold the input value, got %#v", c.dests)
+	}
+}
+
+func TestBuildCall_Unsupported(t *testing.T) {
+	if _, err := buildCall("sqlite", introspect.Routine{Name: "f"}, nil); err == nil {
+		t.Error("expected an error for SQLite")
+	}
+}
@@ -0,0 +1,326 @@
+package api_routine_execute
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/dracory/api"
+	"github.com/dracory/weebase/api/api_sql_execute"
+	"github.com/dracory/weebase/shared/audit"
+	"github.com/dracory/weebase/shared/constants"
+	"github.com/dracory/weebase/shared/dialect"
+	"github.com/dracory/weebase/shared/driver"
+	"github.com/dracory/weebase/shared/introspect"
+	"github.com/dracory/weebase/shared/masking"
+	"github.com/dracory/weebase/shared/session"
+	"github.com/dracory/weebase/shared/types"
+)
+
+// RoutineExecute calls a stored function or procedure with bound parameters
+type RoutineExecute struct {
+	config types.Config
+}
+
+// New creates a new RoutineExecute handler
+func New(config types.Config) *RoutineExecute {
+	return &RoutineExecute{config: config}
+}
+
+// Handle processes the request.
+//
+// Form fields:
+//   - schema, routine: the routine to call
+//   - specific_name: optional, selects an overload
+//   - params[]: values for the input arguments, in signature order
+//   - param_null[]: 0-based indexes into params[] that should be sent as NULL
+func (h *RoutineExecute) Handle(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		api.Respond(w, r, api.Error("routine_execute must be POST"))
+		return
+	}
+
+	sess := session.EnsureSession(w, r, h.config.SessionSecret)
+	if sess == nil || sess.Conn == nil {
+		api.Respond(w, r, api.Error("not connected to database"))
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		api.Respond(w, r, api.Error("failed to parse form"))
+		return
+	}
+
+	schema := strings.TrimSpace(r.Form.Get("schema"))
+	name := strings.TrimSpace(r.Form.Get("routine"))
+	specificName := strings.TrimSpace(r.Form.Get("specific_name"))
+
+	if name == "" {
+		api.Respond(w, r, api.Error("routine is required"))
+		return
+	}
+
+	if !dialect.SanitizeIdent(name) || (schema != "" && !dialect.SanitizeIdent(schema)) {
+		api.Respond(w, r, api.Error("invalid schema or routine name"))
+		return
+	}
+
+	// Routines can modify data, so they go through the same guard as destructive SQL
+	if h.config.SafeModeDefault && strings.TrimSpace(r.Form.Get("confirm")) != "yes" {
+		api.Respond(w, r, api.Error("confirmation required (set confirm=yes)"))
+		return
+	}
+
+	db, err := driver.OpenSQLDB(sess.Conn.Driver, sess.Conn.DSN)
+	if err != nil {
+		api.Respond(w, r, api.Error(fmt.Sprintf("failed to connect to database: %v", err)))
+		return
+	}
+	defer db.Close()
+
+	drv := dialect.Normalize(sess.Conn.Driver)
+	routine, err := introspect.FindRoutine(r.Context(), db, drv, schema, name, specificName)
+	if err != nil {
+		api.Respond(w, r, api.Error(err.Error()))
+		return
+	}
+
+	values := formValues(r.Form["params[]"], r.Form["param_null[]"])
+	if err := checkValues(routine, values); err != nil {
+		api.Respond(w, r, api.Error(err.Error()))
+		return
+	}
+
+	audit.SetObject(r.Context(), routine.Schema, routine.Name)
+	result, err := Execute(r.Context(), db, drv, routine, values)
+	if err != nil {
+		api.Respond(w, r, api.Error(err.Error()))
+		return
+	}
+
+	api.Respond(w, r, api.SuccessWithData("routine_executed", map[string]any{
+		"sql":         result.SQL,
+		"result_sets": result.ResultSets,
+		"out_params":  result.OutParams,
+		"message":     "Routine executed successfully",
+	}))
+}
+
+// Result holds everything a routine call returned
+type Result struct {
+	SQL        string                      `json:"sql"`
+	ResultSets []api_sql_execute.ResultSet `json:"result_sets"`
+	OutParams  map[string]any              `json:"out_params"`
+}
+
+// Execute calls the routine with the given input values (one per input
+// argument), recording the call in the audit entry of ctx.
+func Execute(ctx context.Context, db *sql.DB, drv string, routine introspect.Routine, values []any) (Result, error) {
+	c, err := buildCall(drv, routine, values)
+	if err != nil {
+		return Result{}, err
+	}
+
+	// Pin one connection so MySQL session variables survive between statements
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return Result{}, fmt.Errorf("failed to acquire connection: %v", err)
+	}
+	defer conn.Close()
+
+	for _, v := range c.inout {
+		if _, err := conn.ExecContext(ctx, "SET "+v.variable+" = ?", v.value); err != nil {
+			return Result{}, fmt.Errorf("failed to bind INOUT parameter %s: %v", v.name, err)
+		}
+	}
+
+	audit.SetStatement(ctx, c.sql, c.args...)
+	result := Result{SQL: c.sql, ResultSets: []api_sql_execute.ResultSet{}, OutParams: map[string]any{}}
+	if err := queryAll(ctx, conn, &result, c.sql, c.args...); err != nil {
+		return Result{}, fmt.Errorf("execution failed: %v", err)
+	}
+	for argName, variable := range c.variables {
+		var v any
+		if err := conn.QueryRowContext(ctx, "SELECT "+variable).Scan(&v); err != nil {
+			return Result{}, fmt.Errorf("execution failed: %v", err)
+		}
+		if b, ok := v.([]byte); ok {
+			v = string(b)
+		}
+		result.OutParams[argName] = v
+	}
+	for argName, dest := range c.dests {
+		result.OutParams[argName] = *dest
+	}
+	return result, nil
+}
+
+// call is the statement calling a routine, with where its output
+// arguments end up
+type call struct {
+	sql  string
+	args []any
+	// inout are the MySQL session variables to set before the call
+	inout []inoutValue
+	// variables maps MySQL output arguments to their session variables
+	variables map[string]string
+	// dests maps SQL Server output arguments to their destinations
+	dests map[string]*any
+}
+
+type inoutValue struct {
+	name     string
+	variable string
+	value    any
+}
+
+// checkValues checks that one value is given per input argument
+func checkValues(routine introspect.Routine, values []any) error {
+	inputs := 0
+	for _, arg := range routine.Arguments {
+		if arg.IsInput() {
+			inputs++
+		}
+	}
+	if len(values) != inputs {
+		return fmt.Errorf("routine expects %d parameters, got %d", inputs, len(values))
+	}
+	return nil
+}
+
+// buildCall builds the statement calling the routine in the given dialect
+func buildCall(drv string, routine introspect.Routine, values []any) (call, error) {
+	if err := checkValues(routine, values); err != nil {
+		return call{}, err
+	}
+	c := call{}
+	name := dialect.QualifiedName(drv, routine.Schema, routine.Name)
+
+	switch drv {
+	case constants.DriverPostgres:
+		placeholders := []string{}
+		n := 0
+		for _, arg := range routine.Arguments {
+			if !arg.IsInput() {
+				// Procedures still take OUT arguments positionally; NULL is the convention
+				if routine.Kind == introspect.RoutineProcedure {
+					placeholders = append(placeholders, "NULL")
+				}
+				continue
+			}
+			n++
+			placeholders = append(placeholders, "$"+strconv.Itoa(n))
+		}
+		if routine.Kind == introspect.RoutineProcedure {
+			c.sql = "CALL " + name + "(" + strings.Join(placeholders, ", ") + ")"
+		} else {
+			c.sql = "SELECT * FROM " + name + "(" + strings.Join(placeholders, ", ") + ")"
+		}
+		c.args = values
+
+	case constants.DriverMySQL:
+		if routine.Kind == introspect.RoutineFunction {
+			c.sql = "SELECT " + name + "(" + placeholders(len(values), "?") + ") AS " + dialect.QuoteIdent(drv, "result")
+			c.args = values
+			break
+		}
+
+		parts := []string{}
+		c.variables = map[string]string{}
+		i := 0
+		for _, arg := range routine.Arguments {
+			if !arg.IsOutput() {
+				parts = append(parts, "?")
+				c.args = append(c.args, values[i])
+				i++
+				continue
+			}
+			variable := "@wb_out_" + strconv.Itoa(arg.Position)
+			if arg.IsInput() {
+				c.inout = append(c.inout, inoutValue{name: arg.Name, variable: variable, value: values[i]})
+				i++
+			}
+			parts = append(parts, variable)
+			c.variables[arg.Name] = variable
+		}
+		c.sql = "CALL " + name + "(" + strings.Join(parts, ", ") + ")"
+
+	case constants.DriverSQLServer:
+		parts := []string{}
+		c.dests = map[string]*any{}
+		i := 0
+		for _, arg := range routine.Arguments {
+			param := "@" + arg.Name
+			if arg.IsOutput() {
+				dest := new(any)
+				*dest = values[i]
+				c.dests[arg.Name] = dest
+				c.args = append(c.args, sql.Named(arg.Name, sql.Out{Dest: dest, In: true}))
+				parts = append(parts, param+" = "+param+" OUTPUT")
+			} else {
+				c.args = append(c.args, sql.Named(arg.Name, values[i]))
+				parts = append(parts, param+" = "+param)
+			}
+			i++
+		}
+		c.sql = "EXEC " + name + " " + strings.Join(parts, ", ")
+
+	default:
+		return call{}, fmt.Errorf("routines are not supported for this database driver")
+	}
+	return c, nil
+}
+
+// queryAll runs the statement and collects every result set it produces
+func queryAll(ctx context.Context, conn *sql.Conn, result *Result, query string, args ...any) error {
+	rows, err := conn.QueryContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for {
+		set, err := api_sql_execute.ScanRows(rows, api_sql_execute.MaxRows, masking.FromContext(ctx))
+		if err != nil {
+			return err
+		}
+		if len(set.Columns) > 0 {
+			result.ResultSets = append(result.ResultSets, set)
+		}
+		if !rows.NextResultSet() {
+			break
+		}
+	}
+	return rows.Err()
+}
+
+// formValues converts submitted parameter strings into driver arguments,
+// turning the indexes listed in nulls into NULL values
+func formValues(params, nulls []string) []any {
+	isNull := map[int]bool{}
+	for _, n := range nulls {
+		if i, err := strconv.Atoi(n); err == nil {
+			isNull[i] = true
+		}
+	}
+	values := make([]any, len(params))
+	for i, p := range params {
+		if isNull[i] {
+			values[i] = nil
+			continue
+		}
+		values[i] = p
+	}
+	return values
+}
+
+func placeholders(n int, p string) string {
+	out := make([]string, n)
+	for i := range out {
+		out[i] = p
+	}
+	return strings.Join(out, ", ")
+}
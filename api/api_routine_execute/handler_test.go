@@ -0,0 +1,88 @@
+package api_routine_execute_test
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/dracory/weebase/api/api_routine_execute"
+	"github.com/dracory/weebase/shared/testutil"
+	"github.com/dracory/weebase/shared/types"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func setupTestDB(t *testing.T) string {
+	tempFile, err := os.CreateTemp("", "testdb-*.db")
+	if err != nil {
+		t.Fatalf("failed to create temp file: %v", err)
+	}
+	tempFile.Close()
+	t.Cleanup(func() { os.Remove(tempFile.Name()) })
+
+	db, err := sql.Open("sqlite3", tempFile.Name())
+	if err != nil {
+		t.Fatalf("failed to open SQLite database: %v", err)
+	}
+	defer db.Close()
+
+	if _, err := db.Exec(`CREATE TABLE people (id INTEGER PRIMARY KEY, name TEXT)`); err != nil {
+		t.Fatalf("failed to create table: %v", err)
+	}
+	return tempFile.Name()
+}
+
+func TestRoutineExecute_Validation(t *testing.T) {
+	cookie := testutil.SessionCookie(t, setupTestDB(t))
+
+	tests := []struct {
+		name     string
+		method   string
+		form     url.Values
+		cookie   bool
+		safeMode bool
+		want     string
+	}{
+		{name: "GET", method: http.MethodGet, cookie: true, want: "routine_execute must be POST"},
+		{name: "not connected", form: url.Values{"routine": {"f"}}, want: "not connected to database"},
+		{name: "missing routine", form: url.Values{"schema": {"main"}}, cookie: true, want: "routine is required"},
+		{name: "invalid routine", form: url.Values{"routine": {"f; DROP TABLE people"}}, cookie: true, want: "invalid schema or routine name"},
+		{name: "invalid schema", form: url.Values{"schema": {"a'b"}, "routine": {"f"}}, cookie: true, want: "invalid schema or routine name"},
+		{name: "unconfirmed in safe mode", form: url.Values{"routine": {"f"}}, cookie: true, safeMode: true, want: "confirmation required (set confirm=yes)"},
+		{name: "confirmed in safe mode", form: url.Values{"routine": {"f"}, "confirm": {"yes"}}, cookie: true, safeMode: true, want: "routine not found: f"},
+		// SQLite has no routines
+		{name: "unknown routine", form: url.Values{"routine": {"f"}, "params[]": {"1"}}, cookie: true, want: "routine not found: f"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := api_routine_execute.New(types.Config{SessionSecret: "test-secret", SafeModeDefault: tt.safeMode})
+			method := tt.method
+			if method == "" {
+				method = http.MethodPost
+			}
+			req := httptest.NewRequest(method, "/", strings.NewReader(tt.form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			if tt.cookie {
+				req.AddCookie(cookie)
+			}
+			w := httptest.NewRecorder()
+			handler.Handle(w, req)
+
+			var resp struct {
+				Status  string `json:"status"`
+				Message string `json:"message"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("failed to decode %q: %v", w.Body.String(), err)
+			}
+			if resp.Status != "error" || resp.Message != tt.want {
+				t.Errorf("expected error %q, got %s %q", tt.want, resp.Status, resp.Message)
+			}
+		})
+	}
+}
@@ -0,0 +1,78 @@
+package api_routines_list
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/dracory/api"
+	"github.com/dracory/weebase/shared/dialect"
+	"github.com/dracory/weebase/shared/driver"
+	"github.com/dracory/weebase/shared/introspect"
+	"github.com/dracory/weebase/shared/session"
+	"github.com/dracory/weebase/shared/types"
+)
+
+// RoutinesList lists stored functions and procedures with their signatures and source
+type RoutinesList struct {
+	config types.Config
+}
+
+// New creates a new RoutinesList handler
+func New(config types.Config) *RoutinesList {
+	return &RoutinesList{config: config}
+}
+
+// Handle processes the request to list routines.
+// An optional "routine" parameter narrows the result to routines with that name.
+func (h *RoutinesList) Handle(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		api.Respond(w, r, api.Error("method not allowed"))
+		return
+	}
+
+	sess := session.EnsureSession(w, r, h.config.SessionSecret)
+	if sess == nil || sess.Conn == nil {
+		api.Respond(w, r, api.Error("not connected to database"))
+		return
+	}
+
+	schema := strings.TrimSpace(r.URL.Query().Get("schema"))
+	name := strings.TrimSpace(r.URL.Query().Get("routine"))
+
+	if (schema != "" && !dialect.SanitizeIdent(schema)) || (name != "" && !dialect.SanitizeIdent(name)) {
+		api.Respond(w, r, api.Error("invalid schema or routine name"))
+		return
+	}
+
+	db, err := driver.OpenSQLDB(sess.Conn.Driver, sess.Conn.DSN)
+	if err != nil {
+		api.Respond(w, r, api.Error(fmt.Sprintf("failed to connect to database: %v", err)))
+		return
+	}
+	defer db.Close()
+
+	drv := dialect.Normalize(sess.Conn.Driver)
+	routines, err := introspect.Routines(r.Context(), db, drv, schema)
+	if err != nil {
+		api.Respond(w, r, api.Error(fmt.Sprintf("error listing routines: %v", err)))
+		return
+	}
+
+	if name != "" {
+		filtered := []introspect.Routine{}
+		for _, rt := range routines {
+			if rt.Name == name {
+				filtered = append(filtered, rt)
+			}
+		}
+		routines = filtered
+	}
+
+	api.Respond(w, r, api.SuccessWithData("routines_listed", map[string]any{
+		"routines": routines,
+		"count":    len(routines),
+		"schema":   schema,
+		"driver":   drv,
+	}))
+}
@@ -0,0 +1,186 @@
+package api_row_changes
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/dracory/api"
+	"github.com/dracory/weebase/shared/auth"
+	"github.com/dracory/weebase/shared/dialect"
+	"github.com/dracory/weebase/shared/driver"
+	"github.com/dracory/weebase/shared/export"
+	"github.com/dracory/weebase/shared/journal"
+	"github.com/dracory/weebase/shared/masking"
+	"github.com/dracory/weebase/shared/rbac"
+	"github.com/dracory/weebase/shared/session"
+	"github.com/dracory/weebase/shared/types"
+)
+
+// RowChanges lists the row change journal of the session's connection
+type RowChanges struct {
+	config types.Config
+}
+
+// New creates a new RowChanges handler
+func New(config types.Config) *RowChanges {
+	return &RowChanges{config: config}
+}
+
+// Handle processes the request. The optional "schema" and "table" narrow
+// the list and "limit" caps it; changes are listed newest first with
+// their before and after images.
+func (h *RowChanges) Handle(w http.ResponseWriter, r *http.Request) {
+	sess := session.EnsureSession(w, r, h.config.SessionSecret)
+	if sess == nil || sess.Conn == nil {
+		api.Respond(w, r, api.Error("not connected to database"))
+		return
+	}
+
+	params := r.URL.Query()
+	filter := journal.Filter{
+		Connection: journal.Fingerprint(sess.Conn.Driver, sess.Conn.DSN),
+		Schema:     strings.TrimSpace(params.Get("schema")),
+		Table:      strings.TrimSpace(params.Get("table")),
+	}
+	if limit := strings.TrimSpace(params.Get("limit")); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil {
+			api.Respond(w, r, api.Error("invalid limit"))
+			return
+		}
+		filter.Limit = n
+	}
+
+	changes, err := h.config.Journal.List(r.Context(), filter)
+	if err != nil {
+		api.Respond(w, r, api.Error("failed to read the journal: "+err.Error()))
+		return
+	}
+
+	// row images are table data, so only tables the operator may browse
+	// are listed
+	if policy := h.config.Policy; policy != nil {
+		user, _ := auth.FromContext(r.Context())
+		profile := policy.Profile(dialect.Normalize(sess.Conn.Driver), sess.Conn.DSN)
+		visible := changes[:0]
+		for _, c := range changes {
+			schema := c.Schema
+			if schema == "" {
+				schema = dialect.DefaultSchema(c.Driver)
+			}
+			if policy.Allowed(user, rbac.Request{Permission: rbac.PermBrowse, Profile: profile, Schema: schema, Table: c.Table}) {
+				visible = append(visible, c)
+			}
+		}
+		changes = visible
+	}
+
+	if masker := masking.FromContext(r.Context()); masker != nil && len(changes) > 0 {
+		types := &columnTypes{driver: sess.Conn.Driver, dsn: sess.Conn.DSN}
+		defer types.close()
+		for i, c := range changes {
+			changes[i] = maskChange(masker, c, types.lookup(r.Context(), c.Schema, c.Table))
+		}
+	}
+
+	api.Respond(w, r, api.SuccessWithData("changes listed", map[string]any{"changes": changes}))
+}
+
+// columnTypes looks up the database type of each column of the tables
+// changes were made to, read like the rows the masks were written for.
+// The connection is opened on the first lookup.
+type columnTypes struct {
+	driver, dsn string
+	db          *sql.DB
+	err         error
+	tables      map[[2]string]map[string]string
+}
+
+// lookup returns the column types of a table, or nil when it can't be
+// read, such as when it has been dropped
+func (ct *columnTypes) lookup(ctx context.Context, schema, table string) map[string]string {
+	key := [2]string{schema, table}
+	if types, ok := ct.tables[key]; ok {
+		return types
+	}
+	if ct.db == nil && ct.err == nil {
+		ct.db, ct.err = driver.OpenSQLDB(ct.driver, ct.dsn)
+	}
+	var types map[string]string
+	if ct.err == nil && dialect.SanitizeIdent(table) && (schema == "" || dialect.SanitizeIdent(schema)) {
+		types = readColumnTypes(ctx, ct.db, dialect.QualifiedName(dialect.Normalize(ct.driver), schema, table))
+	}
+	if ct.tables == nil {
+		ct.tables = map[[2]string]map[string]string{}
+	}
+	ct.tables[key] = types
+	return types
+}
+
+func (ct *columnTypes) close() {
+	if ct.db != nil {
+		ct.db.Close()
+	}
+}
+
+func readColumnTypes(ctx context.Context, db *sql.DB, table string) map[string]string {
+	rows, err := db.QueryContext(ctx, "SELECT * FROM "+table+" WHERE 1 = 0")
+	if err != nil {
+		return nil
+	}
+	defer rows.Close()
+	columns, err := export.Columns(rows)
+	if err != nil {
+		return nil
+	}
+	types := make(map[string]string, len(columns))
+	for _, c := range columns {
+		types[c.Name] = c.DatabaseType
+	}
+	return types
+}
+
+// maskChange masks the row images of a change like the rows they were read
+// from, using the table's current column types. When those can't be read
+// and a rule may mask the table, the images and key value are withheld as
+// a type rule might have masked any of them. The images are copied as a
+// store may share them.
+func maskChange(m *masking.Masker, c journal.Change, types map[string]string) journal.Change {
+	if types == nil && m.Covers(c.Schema, c.Table) {
+		c.Before, c.After, c.KeyValue = nil, nil, ""
+		return c
+	}
+	names := c.Before.Columns()
+	columns := make([]export.Column, len(names))
+	for i, name := range names {
+		columns[i] = export.Column{Name: name, DatabaseType: types[name]}
+	}
+	masks := m.Columns(c.Schema, c.Table, columns)
+	if masks == nil {
+		return c
+	}
+	c.Before, c.After = maskRow(c.Before, names, masks), maskRow(c.After, names, masks)
+	if i := slices.Index(names, c.KeyColumn); i >= 0 && masks[i] != nil {
+		c.KeyValue = fmt.Sprint(masks[i](c.KeyValue))
+	}
+	return c
+}
+
+func maskRow(row journal.Row, names []string, masks []masking.Func) journal.Row {
+	if row == nil {
+		return nil
+	}
+	out := maps.Clone(row)
+	for i, name := range names {
+		if _, ok := out[name]; ok && masks[i] != nil {
+			out[name] = masks[i](out[name])
+		}
+	}
+	return out
+}
@@ -0,0 +1,90 @@
+package api_row_changes_test
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/dracory/weebase/api/api_row_changes"
+	"github.com/dracory/weebase/shared/journal"
+	"github.com/dracory/weebase/shared/masking"
+	"github.com/dracory/weebase/shared/testutil"
+	"github.com/dracory/weebase/shared/types"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func TestRowChanges_MasksByType(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "data.db")
+	db, err := sql.Open("sqlite3", dbPath)
+	if err != nil {
+		t.Fatalf("failed to open SQLite database: %v", err)
+	}
+	defer db.Close()
+	if _, err := db.Exec(`CREATE TABLE people (id INTEGER PRIMARY KEY, ssn CHAR(11), name TEXT)`); err != nil {
+		t.Fatalf("failed to create test table: %v", err)
+	}
+
+	store := journal.NewMemoryStore()
+	people := journal.NewChange(journal.OpUpdate, "sqlite3", dbPath, "", "people", "id", "1")
+	people.Before = journal.Row{"id": int64(1), "ssn": "123-45-6789", "name": "alice"}
+	people.After = journal.Row{"id": int64(1), "ssn": "987-65-4321", "name": "alice"}
+	dropped := journal.NewChange(journal.OpDelete, "sqlite3", dbPath, "", "gone", "ssn", "123-45-6789")
+	dropped.Before = journal.Row{"ssn": "123-45-6789"}
+	for _, c := range []journal.Change{people, dropped} {
+		if err := store.Add(context.Background(), c); err != nil {
+			t.Fatalf("failed to journal a change: %v", err)
+		}
+	}
+
+	// the rule picks columns by type only, so it needs the table's types
+	rules, err := masking.Parse([]byte(`{"rules": [{"types": ["char*"], "method": "redact"}]}`))
+	if err != nil {
+		t.Fatalf("failed to parse rules: %v", err)
+	}
+
+	handler := api_row_changes.New(types.Config{SessionSecret: testutil.SessionSecret, Journal: store})
+	req := httptest.NewRequest("GET", "/", nil)
+	req = req.WithContext(masking.WithMasker(req.Context(), masking.NewMasker(rules, "", nil)))
+	req.AddCookie(testutil.SessionCookie(t, dbPath))
+	w := httptest.NewRecorder()
+	handler.Handle(w, req)
+
+	var response struct {
+		Status  string `json:"status"`
+		Message string `json:"message"`
+		Data    struct {
+			Changes []journal.Change `json:"changes"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("failed to parse response: %v", err)
+	}
+	if response.Status != "success" || len(response.Data.Changes) != 2 {
+		t.Fatalf("unexpected response: %s", w.Body.String())
+	}
+
+	for _, c := range response.Data.Changes {
+		switch c.Table {
+		case "people":
+			if c.Before["ssn"] != masking.Redacted || c.After["ssn"] != masking.Redacted {
+				t.Errorf("expected the CHAR column to be masked, got %v and %v", c.Before["ssn"], c.After["ssn"])
+			}
+			if c.Before["name"] != "alice" {
+				t.Errorf("expected the TEXT column to be left alone, got %v", c.Before["name"])
+			}
+		case "gone":
+			// the types of a dropped table can't be read, so nothing is shown
+			if c.Before != nil || c.After != nil || c.KeyValue != "" {
+				t.Errorf("expected the images of a dropped table to be withheld, got %+v", c)
+			}
+		}
+	}
+
+	stored, err := store.Get(context.Background(), people.ID)
+	if err != nil || stored.Before["ssn"] != "123-45-6789" {
+		t.Errorf("expected the journal to keep the original images, got %v (%v)", stored.Before, err)
+	}
+}
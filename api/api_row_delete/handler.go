@@ -8,7 +8,9 @@ import (
 	"gorm.io/gorm"
 
 	"github.com/dracory/api"
+	"github.com/dracory/weebase/shared/audit"
 	"github.com/dracory/weebase/shared/driver"
+	"github.com/dracory/weebase/shared/journal"
 	"github.com/dracory/weebase/shared/session"
 	"github.com/dracory/weebase/shared/types"
 )
@@ -67,28 +69,30 @@ func (h *rowDeleteController) Handle(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Execute the delete operation
-	if err := h.deleteRow(schema, table, col, val); err != nil {
+	changeID, err := h.deleteRow(w, r, schema, table, col, val)
+	if err != nil {
 		api.Respond(w, r, api.Error(err.Error()))
 		return
 	}
 
-	api.Respond(w, r, api.Success("deleted"))
+	api.Respond(w, r, api.SuccessWithData("deleted", map[string]any{"change_id": changeID}))
 }
 
-// deleteRow performs the actual row deletion with safety checks
-func (h *rowDeleteController) deleteRow(schema, table, col, val string) error {
-	sess := session.EnsureSession(nil, nil, h.config.SessionSecret)
+// deleteRow performs the actual row deletion with safety checks and
+// returns the id of its journal entry
+func (h *rowDeleteController) deleteRow(w http.ResponseWriter, r *http.Request, schema, table, col, val string) (string, error) {
+	sess := session.EnsureSession(w, r, h.config.SessionSecret)
 	if sess == nil || sess.Conn == nil {
-		return fmt.Errorf("not connected to database")
+		return "", fmt.Errorf("not connected to database")
 	}
 
 	db, err := driver.OpenDBWithDSN(sess.Conn.Driver, sess.Conn.DSN)
 	if err != nil {
-		return fmt.Errorf("failed to connect to database: %v", err)
+		return "", fmt.Errorf("failed to connect to database: %v", err)
 	}
 	sqlDB, err := db.DB()
 	if err != nil {
-		return fmt.Errorf("failed to get database instance: %v", err)
+		return "", fmt.Errorf("failed to get database instance: %v", err)
 	}
 	defer sqlDB.Close()
 
@@ -99,9 +103,13 @@ func (h *rowDeleteController) deleteRow(schema, table, col, val string) error {
 	}
 	qtable = quoteIdent(driverName, qtable)
 	qcol := quoteIdent(driverName, col)
+	audit.SetObject(r.Context(), schema, table)
+
+	change := journal.NewChange(journal.OpDelete, sess.Conn.Driver, sess.Conn.DSN, schema, table, col, val)
+	change.Operator, change.SessionID = sess.User, sess.ID
 
 	// Transactional safety check + delete
-	return db.Transaction(func(tx *gorm.DB) error {
+	err = db.Transaction(func(tx *gorm.DB) error {
 		// Safety check: ensure exactly one row matches
 		countSQL := "SELECT COUNT(*) FROM " + qtable + " WHERE " + qcol + " = ?"
 		var cnt int64
@@ -112,6 +120,15 @@ func (h *rowDeleteController) deleteRow(schema, table, col, val string) error {
 			return fmt.Errorf("refusing to delete: match count != 1")
 		}
 
+		// the deleted row goes to the journal so it can be put back
+		rows, err := tx.Raw("SELECT * FROM "+qtable+" WHERE "+qcol+" = ?", val).Rows()
+		if err != nil {
+			return err
+		}
+		if change.Before, err = journal.ScanRow(rows); err != nil {
+			return err
+		}
+
 		// Perform delete with dialect-specific single-row hints where available
 		var delSQL string
 		switch driverName {
@@ -123,8 +140,18 @@ func (h *rowDeleteController) deleteRow(schema, table, col, val string) error {
 			delSQL = "DELETE FROM " + qtable + " WHERE " + qcol + " = ?"
 		}
 
-		return tx.Exec(delSQL, val).Error
+		audit.SetStatement(r.Context(), delSQL, val)
+		result := tx.Exec(delSQL, val)
+		audit.AddRowsAffected(r.Context(), result.RowsAffected)
+		if result.Error != nil {
+			return result.Error
+		}
+		return h.config.Journal.Add(r.Context(), change)
 	})
+	if err != nil {
+		return "", err
+	}
+	return change.ID, nil
 }
 
 // sanitizeIdent checks if an identifier contains only safe characters
@@ -6,6 +6,7 @@ import (
 	"strings"
 
 	"github.com/dracory/api"
+	"github.com/dracory/weebase/shared/audit"
 	"github.com/dracory/weebase/shared/driver"
 	"github.com/dracory/weebase/shared/session"
 	"github.com/dracory/weebase/shared/types"
@@ -33,7 +34,7 @@ func (h *RowInsert) Handle(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	sess := session.EnsureSession(nil, nil, h.config.SessionSecret)
+	sess := session.EnsureSession(w, r, h.config.SessionSecret)
 	if sess == nil || sess.Conn == nil {
 		api.Respond(w, r, api.Error("not connected to database"))
 		return
@@ -110,10 +111,14 @@ func (h *RowInsert) Handle(w http.ResponseWriter, r *http.Request) {
 	}
 
 	sqlStr := "INSERT INTO " + qtable + " (" + strings.Join(qcols, ", ") + ") VALUES (" + strings.Join(ph, ", ") + ")"
+	audit.SetObject(r.Context(), schema, table)
+	audit.SetStatement(r.Context(), sqlStr, args...)
 
 	// Execute the insert in a transaction
 	err = db.Transaction(func(tx *gorm.DB) error {
-		return tx.Exec(sqlStr, args...).Error
+		result := tx.Exec(sqlStr, args...)
+		audit.AddRowsAffected(r.Context(), result.RowsAffected)
+		return result.Error
 	})
 
 	if err != nil {
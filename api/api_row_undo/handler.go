@@ -0,0 +1,100 @@
+package api_row_undo
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/dracory/api"
+	"github.com/dracory/weebase/shared/audit"
+	"github.com/dracory/weebase/shared/driver"
+	"github.com/dracory/weebase/shared/journal"
+	"github.com/dracory/weebase/shared/session"
+	"github.com/dracory/weebase/shared/types"
+)
+
+// RowUndo restores the before image of a journaled row change
+type RowUndo struct {
+	config types.Config
+}
+
+// New creates a new RowUndo handler
+func New(config types.Config) *RowUndo {
+	return &RowUndo{config: config}
+}
+
+// Handle processes the request. "change_id" names the change; "table" and
+// "schema" must name its table, so the permission check applies to it.
+// The undo is refused when the row changed since the edit.
+func (h *RowUndo) Handle(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		api.Respond(w, r, api.Error("row_undo must be POST"))
+		return
+	}
+
+	sess := session.EnsureSession(w, r, h.config.SessionSecret)
+	if sess == nil || sess.Conn == nil {
+		api.Respond(w, r, api.Error("not connected to database"))
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		api.Respond(w, r, api.Error("failed to parse form"))
+		return
+	}
+
+	if h.config.ReadOnlyMode {
+		api.Respond(w, r, api.Error("write operations are not allowed in read-only mode"))
+		return
+	}
+
+	change, err := h.config.Journal.Get(r.Context(), strings.TrimSpace(r.Form.Get("change_id")))
+	if err != nil {
+		api.Respond(w, r, api.Error(err.Error()))
+		return
+	}
+	audit.SetObject(r.Context(), change.Schema, change.Table)
+
+	if change.Connection != journal.Fingerprint(sess.Conn.Driver, sess.Conn.DSN) {
+		api.Respond(w, r, api.Error("the change was made on another connection"))
+		return
+	}
+	if strings.TrimSpace(r.Form.Get("table")) != change.Table || strings.TrimSpace(r.Form.Get("schema")) != change.Schema {
+		api.Respond(w, r, api.Error("table and schema must name the table of the change"))
+		return
+	}
+	if h.config.SafeModeDefault && strings.TrimSpace(r.Form.Get("confirm")) != "yes" {
+		api.Respond(w, r, api.Error("confirmation required (set confirm=yes)"))
+		return
+	}
+
+	db, err := driver.OpenSQLDB(sess.Conn.Driver, sess.Conn.DSN)
+	if err != nil {
+		api.Respond(w, r, api.Error(fmt.Sprintf("failed to connect to database: %v", err)))
+		return
+	}
+	defer db.Close()
+
+	statement, args, err := journal.Undo(r.Context(), db, change)
+	if statement != "" {
+		audit.SetStatement(r.Context(), statement, args...)
+	}
+	if errors.Is(err, journal.ErrConflict) {
+		api.Respond(w, r, api.Error("refusing to undo: "+err.Error()))
+		return
+	}
+	if err != nil {
+		api.Respond(w, r, api.Error("undo failed: "+err.Error()))
+		return
+	}
+	audit.AddRowsAffected(r.Context(), 1)
+
+	if err := h.config.Journal.MarkUndone(r.Context(), change.ID, sess.User, time.Now().UTC()); err != nil {
+		// the row is restored; a second undo fails the row check anyway
+		slog.Error("failed to mark change undone", slog.String("change", change.ID), slog.String("error", err.Error()))
+	}
+	api.Respond(w, r, api.Success("change undone"))
+}
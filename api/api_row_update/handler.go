@@ -6,7 +6,9 @@ import (
 	"strings"
 
 	"github.com/dracory/api"
+	"github.com/dracory/weebase/shared/audit"
 	"github.com/dracory/weebase/shared/driver"
+	"github.com/dracory/weebase/shared/journal"
 	"github.com/dracory/weebase/shared/session"
 	"github.com/dracory/weebase/shared/types"
 	"gorm.io/gorm"
@@ -31,7 +33,7 @@ func (h *RowUpdate) Handle(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	sess := session.EnsureSession(nil, nil, h.config.SessionSecret)
+	sess := session.EnsureSession(w, r, h.config.SessionSecret)
 	if sess == nil || sess.Conn == nil {
 		api.Respond(w, r, api.Error("not connected to database"))
 		return
@@ -102,6 +104,10 @@ func (h *RowUpdate) Handle(w http.ResponseWriter, r *http.Request) {
 	}
 	qtable = quoteIdent(driverName, qtable)
 	qkey := quoteIdent(driverName, keyColumn)
+	audit.SetObject(r.Context(), schema, table)
+
+	change := journal.NewChange(journal.OpUpdate, sess.Conn.Driver, sess.Conn.DSN, schema, table, keyColumn, keyValue)
+	change.Operator, change.SessionID = sess.User, sess.ID
 
 	// Execute the update in a transaction
 	err = db.Transaction(func(tx *gorm.DB) error {
@@ -116,6 +122,16 @@ func (h *RowUpdate) Handle(w http.ResponseWriter, r *http.Request) {
 			return fmt.Errorf("refusing to update: match count (%d) != 1", cnt)
 		}
 
+		// the before image goes to the journal so the update can be undone
+		selectSQL := "SELECT * FROM " + qtable + " WHERE " + qkey + " = ?"
+		rows, err := tx.Raw(selectSQL, keyValue).Rows()
+		if err != nil {
+			return fmt.Errorf("failed to read the row: %w", err)
+		}
+		if change.Before, err = journal.ScanRow(rows); err != nil {
+			return fmt.Errorf("failed to read the row: %w", err)
+		}
+
 		// Build the SET clause
 		sets := make([]string, len(setCols))
 		args := make([]any, 0, len(setCols)+1)
@@ -128,10 +144,29 @@ func (h *RowUpdate) Handle(w http.ResponseWriter, r *http.Request) {
 
 		// Build and execute the UPDATE query
 		sqlStr := "UPDATE " + qtable + " SET " + strings.Join(sets, ", ") + " WHERE " + qkey + " = ?"
-		if err := tx.Exec(sqlStr, args...).Error; err != nil {
-			return fmt.Errorf("update failed: %w", err)
+		audit.SetStatement(r.Context(), sqlStr, args...)
+		result := tx.Exec(sqlStr, args...)
+		if result.Error != nil {
+			return fmt.Errorf("update failed: %w", result.Error)
 		}
+		audit.AddRowsAffected(r.Context(), result.RowsAffected)
 
+		// the key column may be among those updated
+		afterKey := keyValue
+		for i, c := range setCols {
+			if c == keyColumn {
+				afterKey = setVals[i]
+			}
+		}
+		if rows, err = tx.Raw(selectSQL, afterKey).Rows(); err != nil {
+			return fmt.Errorf("failed to read the updated row: %w", err)
+		}
+		if change.After, err = journal.ScanRow(rows); err != nil {
+			return fmt.Errorf("failed to read the updated row: %w", err)
+		}
+		if err := h.config.Journal.Add(r.Context(), change); err != nil {
+			return fmt.Errorf("failed to record the change: %w", err)
+		}
 		return nil
 	})
 
@@ -140,7 +175,7 @@ func (h *RowUpdate) Handle(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	api.Respond(w, r, api.Success("row updated"))
+	api.Respond(w, r, api.SuccessWithData("row updated", map[string]any{"change_id": change.ID}))
 }
 
 // Helper functions
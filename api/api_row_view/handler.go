@@ -1,12 +1,15 @@
 package api_row_view
 
 import (
-	"database/sql"
 	"fmt"
 	"net/http"
 	"strings"
 
 	"github.com/dracory/api"
+	"github.com/dracory/weebase/shared/dialect"
+	"github.com/dracory/weebase/shared/driver"
+	"github.com/dracory/weebase/shared/export"
+	"github.com/dracory/weebase/shared/masking"
 	"github.com/dracory/weebase/shared/session"
 	"github.com/dracory/weebase/shared/types"
 )
@@ -28,7 +31,7 @@ func (h *RowView) Handle(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	sess := session.EnsureSession(nil, nil, h.config.SessionSecret)
+	sess := session.EnsureSession(w, r, h.config.SessionSecret)
 	if sess == nil || sess.Conn == nil {
 		api.Respond(w, r, api.Error("not connected to database"))
 		return
@@ -57,7 +60,7 @@ func (h *RowView) Handle(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Open database connection
-	db, err := sql.Open(sess.Conn.Driver, sess.Conn.DSN)
+	db, err := driver.OpenSQLDB(sess.Conn.Driver, sess.Conn.DSN)
 	if err != nil {
 		api.Respond(w, r, api.Error(fmt.Sprintf("failed to connect to database: %v", err)))
 		return
@@ -73,18 +76,18 @@ func (h *RowView) Handle(w http.ResponseWriter, r *http.Request) {
 	qcol := quoteIdent(sess.Conn.Driver, keyColumn)
 
 	// Execute query
-	query := "SELECT * FROM " + qtable + " WHERE " + qcol + " = ?"
-	rows, err := db.Query(query, keyValue)
+	query := "SELECT * FROM " + qtable + " WHERE " + qcol + " = " + dialect.Placeholder(sess.Conn.Driver, 1)
+	rows, err := db.Query(query, dialect.BindArg(sess.Conn.Driver, 1, keyValue))
 	if err != nil {
 		api.Respond(w, r, api.Error(fmt.Sprintf("query failed: %v", err)))
 		return
 	}
 	defer rows.Close()
 
-	// Get column names
-	cols, err := rows.Columns()
+	// Get columns
+	cols, err := export.Columns(rows)
 	if err != nil {
-		api.Respond(w, r, api.Error(fmt.Sprintf("failed to get columns: %v", err)))
+		api.Respond(w, r, api.Error(err.Error()))
 		return
 	}
 
@@ -105,11 +108,12 @@ func (h *RowView) Handle(w http.ResponseWriter, r *http.Request) {
 		api.Respond(w, r, api.Error(fmt.Sprintf("failed to scan row: %v", err)))
 		return
 	}
+	masking.Apply(masking.FromContext(r.Context()).Columns(schema, table, cols), vals)
 
 	// Convert to map
 	out := make(map[string]any, len(cols))
 	for i, c := range cols {
-		out[c] = vals[i]
+		out[c.Name] = export.JSONValue(vals[i], c)
 	}
 
 	api.Respond(w, r, api.SuccessWithData("row", map[string]any{"row": out}))
@@ -1,13 +1,15 @@
 package api_rows_browse
 
 import (
-	"database/sql"
 	"fmt"
 	"net/http"
 	"strconv"
 	"strings"
 
 	"github.com/dracory/api"
+	"github.com/dracory/weebase/shared/driver"
+	"github.com/dracory/weebase/shared/export"
+	"github.com/dracory/weebase/shared/masking"
 	"github.com/dracory/weebase/shared/session"
 	"github.com/dracory/weebase/shared/types"
 )
@@ -72,7 +74,7 @@ func (h *RowsBrowse) Handle(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	sess := session.EnsureSession(nil, nil, h.config.SessionSecret)
+	sess := session.EnsureSession(w, r, h.config.SessionSecret)
 	if sess == nil || sess.Conn == nil {
 		api.Respond(w, r, api.Error("not connected to database"))
 		return
@@ -107,7 +109,7 @@ func (h *RowsBrowse) Handle(w http.ResponseWriter, r *http.Request) {
 	offset := (page - 1) * limit
 
 	// Open database connection
-	db, err := sql.Open(sess.Conn.Driver, sess.Conn.DSN)
+	db, err := driver.OpenSQLDB(sess.Conn.Driver, sess.Conn.DSN)
 	if err != nil {
 		api.Respond(w, r, api.Error(fmt.Sprintf("failed to connect to database: %v", err)))
 		return
@@ -153,38 +155,39 @@ func (h *RowsBrowse) Handle(w http.ResponseWriter, r *http.Request) {
 	}
 	defer rows.Close()
 
-	// Get column names
-	cols, err := rows.Columns()
+	// Get columns
+	columns, err := export.Columns(rows)
 	if err != nil {
-		api.Respond(w, r, api.Error(fmt.Sprintf("failed to get columns: %v", err)))
+		api.Respond(w, r, api.Error(err.Error()))
 		return
 	}
+	masks := masking.FromContext(r.Context()).Columns(schema, table, columns)
 
 	// Process rows
 	var results []map[string]interface{}
 	for rows.Next() {
 		// Create slice to hold column values
-		values := make([]interface{}, len(cols))
+		values := make([]interface{}, len(columns))
+		pointers := make([]interface{}, len(columns))
 		for i := range values {
-			var v interface{}
-			values[i] = &v
+			pointers[i] = &values[i]
 		}
 
 		// Scan row into values
-		if err := rows.Scan(values...); err != nil {
+		if err := rows.Scan(pointers...); err != nil {
 			api.Respond(w, r, api.Error(fmt.Sprintf("failed to scan row: %v", err)))
 			return
 		}
+		masking.Apply(masks, values)
 
 		// Convert values to proper types
 		row := make(map[string]interface{})
-		for i, col := range cols {
-			val := *(values[i].(*interface{}))
+		for i, col := range columns {
 			// Convert []byte to string for better JSON serialization
-			if b, ok := val.([]byte); ok {
-				val = string(b)
+			if b, ok := values[i].([]byte); ok {
+				values[i] = string(b)
 			}
-			row[col] = val
+			row[col.Name] = values[i]
 		}
 
 		results = append(results, row)
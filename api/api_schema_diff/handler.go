@@ -0,0 +1,124 @@
+package api_schema_diff
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/dracory/api"
+	"github.com/dracory/weebase/shared/connection"
+	"github.com/dracory/weebase/shared/ddl"
+	"github.com/dracory/weebase/shared/dialect"
+	"github.com/dracory/weebase/shared/introspect"
+	"github.com/dracory/weebase/shared/schemadiff"
+	"github.com/dracory/weebase/shared/session"
+	"github.com/dracory/weebase/shared/types"
+)
+
+// SchemaDiff compares two schemas (on one connection or two) and produces
+// the migration script that brings the target in line with the source
+type SchemaDiff struct {
+	config types.Config
+}
+
+// New creates a new SchemaDiff handler
+func New(config types.Config) *SchemaDiff {
+	return &SchemaDiff{config: config}
+}
+
+// Handle processes the request.
+//
+// Both sides default to the session's connection; "source_driver"/"source_dsn"
+// and "target_driver"/"target_dsn" point a side elsewhere (ad-hoc connections
+// must be allowed). "source_schema" and "target_schema" pick the schemas.
+// "drop_removed=yes" emits DROP statements for target-only objects and
+// "format=sql" downloads the script instead of returning JSON.
+// "unresolved" lists the steps the script leaves to be done by hand.
+func (h *SchemaDiff) Handle(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		api.Respond(w, r, api.Error("method not allowed"))
+		return
+	}
+
+	sess := session.EnsureSession(w, r, h.config.SessionSecret)
+	if sess == nil {
+		api.Respond(w, r, api.Error("failed to get session"))
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		api.Respond(w, r, api.Error("failed to parse form"))
+		return
+	}
+
+	source, err := connection.FromForm(r.Context(), h.config, sess, r.Form, "source_")
+	if err != nil {
+		api.Respond(w, r, api.Error(err.Error()))
+		return
+	}
+	target, err := connection.FromForm(r.Context(), h.config, sess, r.Form, "target_")
+	if err != nil {
+		api.Respond(w, r, api.Error(err.Error()))
+		return
+	}
+
+	sourceSchema := strings.TrimSpace(r.Form.Get("source_schema"))
+	targetSchema := strings.TrimSpace(r.Form.Get("target_schema"))
+	if (sourceSchema != "" && !dialect.SanitizeIdent(sourceSchema)) || (targetSchema != "" && !dialect.SanitizeIdent(targetSchema)) {
+		api.Respond(w, r, api.Error("invalid schema name"))
+		return
+	}
+	if sourceSchema == "" {
+		sourceSchema = dialect.DefaultSchema(source.Driver)
+	}
+	if targetSchema == "" {
+		targetSchema = dialect.DefaultSchema(target.Driver)
+	}
+	if source == target && sourceSchema == targetSchema {
+		api.Respond(w, r, api.Error("source and target are the same schema"))
+		return
+	}
+
+	sourceSnapshot, err := h.snapshot(r, source, sourceSchema)
+	if err != nil {
+		api.Respond(w, r, api.Error(fmt.Sprintf("source: %v", err)))
+		return
+	}
+	targetSnapshot, err := h.snapshot(r, target, targetSchema)
+	if err != nil {
+		api.Respond(w, r, api.Error(fmt.Sprintf("target: %v", err)))
+		return
+	}
+
+	diff := schemadiff.Compare(sourceSnapshot, targetSnapshot)
+	stmts, unresolved := schemadiff.Migration(diff, sourceSnapshot, targetSnapshot, schemadiff.Options{
+		DropRemoved: r.Form.Get("drop_removed") == "yes",
+	})
+	script := ddl.Script(stmts)
+
+	if r.Form.Get("format") == "sql" {
+		w.Header().Set("Content-Type", "application/sql; charset=utf-8")
+		w.Header().Set("Content-Disposition", `attachment; filename="schema_migration.sql"`)
+		_, _ = w.Write([]byte(script))
+		return
+	}
+
+	api.Respond(w, r, api.SuccessWithData("schema_diff", map[string]any{
+		"diff":          diff,
+		"identical":     diff.Empty(),
+		"sql":           script,
+		"unresolved":    unresolved,
+		"source_schema": sourceSchema,
+		"target_schema": targetSchema,
+	}))
+}
+
+func (h *SchemaDiff) snapshot(r *http.Request, t connection.Target, schema string) (introspect.Schema, error) {
+	db, err := t.Open(r.Context())
+	if err != nil {
+		return introspect.Schema{}, fmt.Errorf("failed to connect to database: %v", err)
+	}
+	defer db.Close()
+
+	return introspect.Snapshot(r.Context(), db, t.Driver, schema)
+}
@@ -0,0 +1,216 @@
+package api_schema_diff_test
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dracory/weebase/api/api_schema_diff"
+	"github.com/dracory/weebase/shared/ratelimit"
+	"github.com/dracory/weebase/shared/testutil"
+	"github.com/dracory/weebase/shared/types"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// createDB creates a file-backed SQLite database initialised with the given statements
+func createDB(t *testing.T, stmts ...string) (*sql.DB, string) {
+	tempFile, err := os.CreateTemp("", "testdb-*.db")
+	if err != nil {
+		t.Fatalf("failed to create temp file: %v", err)
+	}
+	tempFile.Close()
+	t.Cleanup(func() { os.Remove(tempFile.Name()) })
+
+	db, err := sql.Open("sqlite3", tempFile.Name())
+	if err != nil {
+		t.Fatalf("failed to open SQLite database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	for _, stmt := range stmts {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatalf("failed to execute %q: %v", stmt, err)
+		}
+	}
+	return db, tempFile.Name()
+}
+
+type diffResponse struct {
+	Status  string `json:"status"`
+	Message string `json:"message"`
+	Data    struct {
+		Identical  bool     `json:"identical"`
+		SQL        string   `json:"sql"`
+		Unresolved []string `json:"unresolved"`
+		Diff       struct {
+			TablesAdded   []string `json:"tables_added"`
+			TablesRemoved []string `json:"tables_removed"`
+			TablesChanged []struct {
+				Name         string `json:"name"`
+				ColumnsAdded []struct {
+					Name string `json:"name"`
+				} `json:"columns_added"`
+				IndexesAdded []struct {
+					Name string `json:"name"`
+				} `json:"indexes_added"`
+			} `json:"tables_changed"`
+			ViewsAdded []string `json:"views_added"`
+		} `json:"diff"`
+	} `json:"data"`
+}
+
+func diff(t *testing.T, config types.Config, cookie *http.Cookie, form url.Values) diffResponse {
+	req := httptest.NewRequest("POST", "/", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.AddCookie(cookie)
+	w := httptest.NewRecorder()
+	api_schema_diff.New(config).Handle(w, req)
+
+	var response diffResponse
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	return response
+}
+
+func TestSchemaDiff_SQLiteToSQLite(t *testing.T) {
+	_, sourcePath := createDB(t,
+		`CREATE TABLE customers (id INTEGER PRIMARY KEY AUTOINCREMENT, name TEXT NOT NULL, email VARCHAR(255))`,
+		`CREATE INDEX idx_customers_email ON customers (email)`,
+		`CREATE TABLE orders (id INTEGER PRIMARY KEY, customer_id INTEGER REFERENCES customers (id), total REAL)`,
+		`CREATE VIEW big_orders AS SELECT * FROM orders WHERE total > 100`,
+	)
+	targetDB, targetPath := createDB(t,
+		`CREATE TABLE customers (id INTEGER PRIMARY KEY AUTOINCREMENT, name TEXT NOT NULL)`,
+		`CREATE TABLE legacy (id INTEGER PRIMARY KEY)`,
+	)
+
+	config := types.Config{
+		SessionSecret:         "test-secret",
+		EnabledDrivers:        []string{"sqlite"},
+		AllowAdHocConnections: true,
+	}
+	cookie := testutil.SessionCookie(t, sourcePath)
+	form := url.Values{
+		"target_driver": {"sqlite"},
+		"target_dsn":    {targetPath},
+		"drop_removed":  {"yes"},
+	}
+
+	response := diff(t, config, cookie, form)
+	if response.Status != "success" {
+		t.Fatalf("expected success, got %s: %s", response.Status, response.Message)
+	}
+
+	d := response.Data.Diff
+	if len(d.TablesAdded) != 1 || d.TablesAdded[0] != "orders" {
+		t.Errorf("expected orders to be added, got %v", d.TablesAdded)
+	}
+	if len(d.TablesRemoved) != 1 || d.TablesRemoved[0] != "legacy" {
+		t.Errorf("expected legacy to be removed, got %v", d.TablesRemoved)
+	}
+	if len(d.TablesChanged) != 1 || d.TablesChanged[0].Name != "customers" {
+		t.Fatalf("expected customers to change, got %+v", d.TablesChanged)
+	}
+	if cols := d.TablesChanged[0].ColumnsAdded; len(cols) != 1 || cols[0].Name != "email" {
+		t.Errorf("expected email column to be added, got %+v", cols)
+	}
+	if ix := d.TablesChanged[0].IndexesAdded; len(ix) != 1 || ix[0].Name != "idx_customers_email" {
+		t.Errorf("expected idx_customers_email to be added, got %+v", ix)
+	}
+	if len(d.ViewsAdded) != 1 || d.ViewsAdded[0] != "big_orders" {
+		t.Errorf("expected big_orders view to be added, got %v", d.ViewsAdded)
+	}
+
+	if len(response.Data.Unresolved) != 0 {
+		t.Errorf("expected no unresolved steps, got %v", response.Data.Unresolved)
+	}
+
+	// applying the migration must leave nothing to diff
+	if _, err := targetDB.Exec(response.Data.SQL); err != nil {
+		t.Fatalf("failed to apply migration: %v\n%s", err, response.Data.SQL)
+	}
+	response = diff(t, config, cookie, form)
+	if !response.Data.Identical {
+		t.Errorf("expected schemas to be identical after migration, got:\n%s", response.Data.SQL)
+	}
+}
+
+func TestSchemaDiff_Unresolved(t *testing.T) {
+	_, sourcePath := createDB(t, `CREATE TABLE items (id INTEGER PRIMARY KEY, qty INTEGER)`)
+	_, targetPath := createDB(t, `CREATE TABLE items (id INTEGER PRIMARY KEY, qty TEXT)`)
+
+	config := types.Config{
+		SessionSecret:         "test-secret",
+		EnabledDrivers:        []string{"sqlite"},
+		AllowAdHocConnections: true,
+	}
+	response := diff(t, config, testutil.SessionCookie(t, sourcePath), url.Values{
+		"target_driver": {"sqlite"},
+		"target_dsn":    {targetPath},
+	})
+	if response.Status != "success" {
+		t.Fatalf("expected success, got %s: %s", response.Status, response.Message)
+	}
+	// SQLite can't alter a column, so the script can't settle the difference
+	if response.Data.Identical || len(response.Data.Unresolved) != 1 || !strings.HasPrefix(response.Data.Unresolved[0], "alter column items.qty") {
+		t.Errorf("expected the column change to be unresolved, got %v", response.Data.Unresolved)
+	}
+	if !strings.Contains(response.Data.SQL, "-- manual step required: alter column items.qty") {
+		t.Errorf("expected the script to mention the manual step, got:\n%s", response.Data.SQL)
+	}
+}
+
+func TestSchemaDiff_AdHocDisabled(t *testing.T) {
+	_, sourcePath := createDB(t, `CREATE TABLE a (id INTEGER PRIMARY KEY)`)
+
+	config := types.Config{SessionSecret: "test-secret", EnabledDrivers: []string{"sqlite"}}
+	response := diff(t, config, testutil.SessionCookie(t, sourcePath), url.Values{
+		"target_driver": {"sqlite"},
+		"target_dsn":    {sourcePath},
+	})
+	if response.Status != "error" || !strings.Contains(response.Message, "ad-hoc") {
+		t.Errorf("expected ad-hoc connection error, got %s: %s", response.Status, response.Message)
+	}
+}
+
+func TestSchemaDiff_AdHocLimited(t *testing.T) {
+	_, sourcePath := createDB(t, `CREATE TABLE a (id INTEGER PRIMARY KEY)`)
+	_, targetPath := createDB(t)
+	missing := filepath.Join(t.TempDir(), "missing", "x.db")
+
+	config := types.Config{SessionSecret: "test-secret", EnabledDrivers: []string{"sqlite"}, AllowAdHocConnections: true}
+	limiter := ratelimit.New(ratelimit.Config{LockoutAfter: 2, Lockout: time.Minute})
+	post := func(dsn string) diffResponse {
+		form := url.Values{"target_driver": {"sqlite"}, "target_dsn": {dsn}}
+		req := httptest.NewRequest("POST", "/", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.AddCookie(testutil.SessionCookie(t, sourcePath))
+		req = req.WithContext(ratelimit.WithClient(req.Context(), limiter, "1.2.3.4"))
+		w := httptest.NewRecorder()
+		api_schema_diff.New(config).Handle(w, req)
+
+		var response diffResponse
+		if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+			t.Fatalf("failed to decode response: %v", err)
+		}
+		return response
+	}
+
+	for range 2 {
+		if response := post(missing); response.Status != "error" {
+			t.Fatalf("expected the missing database to fail, got %s", response.Status)
+		}
+	}
+	// the ad-hoc failures lock the client out of further connects
+	if response := post(targetPath); response.Status != "error" || !strings.Contains(response.Message, "too many connect attempts") {
+		t.Errorf("expected the client to be locked out, got %s: %s", response.Status, response.Message)
+	}
+}
@@ -0,0 +1,116 @@
+package api_sequence_restart
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/dracory/api"
+	"github.com/dracory/weebase/shared/audit"
+	"github.com/dracory/weebase/shared/constants"
+	"github.com/dracory/weebase/shared/dialect"
+	"github.com/dracory/weebase/shared/driver"
+	"github.com/dracory/weebase/shared/session"
+	"github.com/dracory/weebase/shared/types"
+)
+
+// SequenceRestart restarts a PostgreSQL sequence
+type SequenceRestart struct {
+	config types.Config
+}
+
+// New creates a new SequenceRestart handler
+func New(config types.Config) *SequenceRestart {
+	return &SequenceRestart{config: config}
+}
+
+// Handle processes the restart request.
+// Without a value the sequence restarts at its configured start value.
+func (h *SequenceRestart) Handle(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		api.Respond(w, r, api.Error("method not allowed"))
+		return
+	}
+
+	sess := session.EnsureSession(w, r, h.config.SessionSecret)
+	if sess == nil || sess.Conn == nil {
+		api.Respond(w, r, api.Error("not connected to database"))
+		return
+	}
+
+	if dialect.Normalize(sess.Conn.Driver) != constants.DriverPostgres {
+		api.Respond(w, r, api.Error("sequences are only supported on PostgreSQL"))
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		api.Respond(w, r, api.Error("failed to parse form"))
+		return
+	}
+
+	schema := strings.TrimSpace(r.Form.Get("schema"))
+	sequence := strings.TrimSpace(r.Form.Get("sequence"))
+	restartWith := strings.TrimSpace(r.Form.Get("value"))
+
+	if sequence == "" {
+		api.Respond(w, r, api.Error("sequence name is required"))
+		return
+	}
+	if !dialect.SanitizeIdent(sequence) || (schema != "" && !dialect.SanitizeIdent(schema)) {
+		api.Respond(w, r, api.Error("invalid sequence or schema name"))
+		return
+	}
+
+	stmt, err := statement(schema, sequence, restartWith)
+	if err != nil {
+		api.Respond(w, r, api.Error(err.Error()))
+		return
+	}
+
+	// Check for confirmation in safe mode
+	if h.config.SafeModeDefault && strings.TrimSpace(r.Form.Get("confirm")) != "yes" {
+		api.Respond(w, r, api.Error("confirmation required (set confirm=yes)"))
+		return
+	}
+
+	db, err := driver.OpenSQLDB(sess.Conn.Driver, sess.Conn.DSN)
+	if err != nil {
+		api.Respond(w, r, api.Error(fmt.Sprintf("failed to connect to database: %v", err)))
+		return
+	}
+	defer db.Close()
+
+	audit.SetObject(r.Context(), schema, sequence)
+	audit.SetSQL(r.Context(), stmt)
+	result, err := db.ExecContext(r.Context(), stmt)
+	if err != nil {
+		api.Respond(w, r, api.Error(fmt.Sprintf("error restarting sequence: %v", err)))
+		return
+	}
+	if n, err := result.RowsAffected(); err == nil {
+		audit.AddRowsAffected(r.Context(), n)
+	}
+
+	api.Respond(w, r, api.SuccessWithData("sequence_restarted", map[string]any{
+		"sql":      stmt,
+		"sequence": sequence,
+		"schema":   schema,
+		"message":  "Sequence restarted successfully",
+	}))
+}
+
+// statement builds the ALTER SEQUENCE statement, restarting at value or,
+// when it is empty, at the sequence's start value
+func statement(schema, sequence, value string) (string, error) {
+	stmt := "ALTER SEQUENCE " + dialect.QualifiedName(constants.DriverPostgres, schema, sequence) + " RESTART"
+	if value == "" {
+		return stmt, nil
+	}
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return "", errors.New("value must be an integer")
+	}
+	return stmt + " WITH " + strconv.FormatInt(n, 10), nil
+}
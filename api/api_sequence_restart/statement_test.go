@@ -0,0 +1,27 @@
+package api_sequence_restart
+
+import "testing"
+
+func TestStatement(t *testing.T) {
+	tests := []struct {
+		schema, sequence, value string
+		want                    string
+	}{
+		{"public", "ids", "", `ALTER SEQUENCE "public"."ids" RESTART`},
+		{"", "ids", "100", `ALTER SEQUENCE "ids" RESTART WITH 100`},
+		{"public", "ids", "-5", `ALTER SEQUENCE "public"."ids" RESTART WITH -5`},
+		{"public", "ids", "007", `ALTER SEQUENCE "public"."ids" RESTART WITH 7`},
+	}
+	for _, tt := range tests {
+		got, err := statement(tt.schema, tt.sequence, tt.value)
+		if err != nil || got != tt.want {
+			t.Errorf("statement(%q, %q, %q) = %q, %v, want %q", tt.schema, tt.sequence, tt.value, got, err, tt.want)
+		}
+	}
+
+	for _, value := range []string{"1.5", "1; DROP TABLE t", "99999999999999999999"} {
+		if _, err := statement("public", "ids", value); err == nil {
+			t.Errorf("expected %q to be refused", value)
+		}
+	}
+}
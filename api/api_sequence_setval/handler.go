@@ -0,0 +1,108 @@
+package api_sequence_setval
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/dracory/api"
+	"github.com/dracory/weebase/shared/audit"
+	"github.com/dracory/weebase/shared/constants"
+	"github.com/dracory/weebase/shared/dialect"
+	"github.com/dracory/weebase/shared/driver"
+	"github.com/dracory/weebase/shared/session"
+	"github.com/dracory/weebase/shared/types"
+)
+
+// SequenceSetval sets the current value of a PostgreSQL sequence
+type SequenceSetval struct {
+	config types.Config
+}
+
+// New creates a new SequenceSetval handler
+func New(config types.Config) *SequenceSetval {
+	return &SequenceSetval{config: config}
+}
+
+// Handle processes the setval request.
+// With is_called=false the next nextval() returns value itself instead of value+increment.
+func (h *SequenceSetval) Handle(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		api.Respond(w, r, api.Error("method not allowed"))
+		return
+	}
+
+	sess := session.EnsureSession(w, r, h.config.SessionSecret)
+	if sess == nil || sess.Conn == nil {
+		api.Respond(w, r, api.Error("not connected to database"))
+		return
+	}
+
+	if dialect.Normalize(sess.Conn.Driver) != constants.DriverPostgres {
+		api.Respond(w, r, api.Error("sequences are only supported on PostgreSQL"))
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		api.Respond(w, r, api.Error("failed to parse form"))
+		return
+	}
+
+	schema := strings.TrimSpace(r.Form.Get("schema"))
+	sequence := strings.TrimSpace(r.Form.Get("sequence"))
+	isCalled := r.Form.Get("is_called") != "false"
+
+	if sequence == "" {
+		api.Respond(w, r, api.Error("sequence name is required"))
+		return
+	}
+	if !dialect.SanitizeIdent(sequence) || (schema != "" && !dialect.SanitizeIdent(schema)) {
+		api.Respond(w, r, api.Error("invalid sequence or schema name"))
+		return
+	}
+
+	value, err := strconv.ParseInt(strings.TrimSpace(r.Form.Get("value")), 10, 64)
+	if err != nil {
+		api.Respond(w, r, api.Error("value must be an integer"))
+		return
+	}
+
+	// Check for confirmation in safe mode
+	if h.config.SafeModeDefault && strings.TrimSpace(r.Form.Get("confirm")) != "yes" {
+		api.Respond(w, r, api.Error("confirmation required (set confirm=yes)"))
+		return
+	}
+
+	db, err := driver.OpenSQLDB(sess.Conn.Driver, sess.Conn.DSN)
+	if err != nil {
+		api.Respond(w, r, api.Error(fmt.Sprintf("failed to connect to database: %v", err)))
+		return
+	}
+	defer db.Close()
+
+	query, args := statement(schema, sequence, value, isCalled)
+	audit.SetObject(r.Context(), schema, sequence)
+	audit.SetStatement(r.Context(), query, args...)
+	var current int64
+	if err := db.QueryRowContext(r.Context(), query, args...).Scan(&current); err != nil {
+		api.Respond(w, r, api.Error(fmt.Sprintf("error setting sequence value: %v", err)))
+		return
+	}
+	audit.AddRowsAffected(r.Context(), 0)
+
+	api.Respond(w, r, api.SuccessWithData("sequence_updated", map[string]any{
+		"sequence":      sequence,
+		"schema":        schema,
+		"current_value": current,
+		"is_called":     isCalled,
+		"message":       "Sequence value set successfully",
+	}))
+}
+
+// statement builds the setval query; the sequence is passed as a regclass
+// so its quoted name is resolved by PostgreSQL
+func statement(schema, sequence string, value int64, isCalled bool) (string, []any) {
+	name := dialect.QualifiedName(constants.DriverPostgres, schema, sequence)
+	return "SELECT pg_catalog.setval($1::regclass, $2, $3)", []any{name, value, isCalled}
+}
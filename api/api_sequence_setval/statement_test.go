@@ -0,0 +1,20 @@
+package api_sequence_setval
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestStatement(t *testing.T) {
+	query, args := statement("billing", `Order"Seq`, 42, false)
+	if want := "SELECT pg_catalog.setval($1::regclass, $2, $3)"; query != want {
+		t.Errorf("expected %s, got %s", want, query)
+	}
+	if want := []any{`"billing"."Order""Seq"`, int64(42), false}; !reflect.DeepEqual(args, want) {
+		t.Errorf("expected %v, got %v", want, args)
+	}
+
+	if _, args := statement("", "ids", 1, true); args[0] != `"ids"` {
+		t.Errorf("expected an unqualified name without a schema, got %v", args[0])
+	}
+}
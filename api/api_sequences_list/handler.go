@@ -0,0 +1,72 @@
+package api_sequences_list
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/dracory/api"
+	"github.com/dracory/weebase/shared/constants"
+	"github.com/dracory/weebase/shared/dialect"
+	"github.com/dracory/weebase/shared/driver"
+	"github.com/dracory/weebase/shared/introspect"
+	"github.com/dracory/weebase/shared/session"
+	"github.com/dracory/weebase/shared/types"
+)
+
+// SequencesList lists PostgreSQL sequences with their current value and owner column
+type SequencesList struct {
+	config types.Config
+}
+
+// New creates a new SequencesList handler
+func New(config types.Config) *SequencesList {
+	return &SequencesList{config: config}
+}
+
+// Handle processes the request to list sequences
+func (h *SequencesList) Handle(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		api.Respond(w, r, api.Error("method not allowed"))
+		return
+	}
+
+	sess := session.EnsureSession(w, r, h.config.SessionSecret)
+	if sess == nil || sess.Conn == nil {
+		api.Respond(w, r, api.Error("not connected to database"))
+		return
+	}
+
+	if dialect.Normalize(sess.Conn.Driver) != constants.DriverPostgres {
+		api.Respond(w, r, api.Error("sequences are only supported on PostgreSQL"))
+		return
+	}
+
+	schema := strings.TrimSpace(r.URL.Query().Get("schema"))
+	if schema == "" {
+		schema = "public"
+	}
+	if !dialect.SanitizeIdent(schema) {
+		api.Respond(w, r, api.Error("invalid schema name"))
+		return
+	}
+
+	db, err := driver.OpenSQLDB(sess.Conn.Driver, sess.Conn.DSN)
+	if err != nil {
+		api.Respond(w, r, api.Error(fmt.Sprintf("failed to connect to database: %v", err)))
+		return
+	}
+	defer db.Close()
+
+	sequences, err := introspect.PostgresSequences(r.Context(), db, schema)
+	if err != nil {
+		api.Respond(w, r, api.Error(fmt.Sprintf("error listing sequences: %v", err)))
+		return
+	}
+
+	api.Respond(w, r, api.SuccessWithData("sequences_listed", map[string]any{
+		"sequences": sequences,
+		"count":     len(sequences),
+		"schema":    schema,
+	}))
+}
@@ -7,6 +7,10 @@ import (
 	"strings"
 
 	"github.com/dracory/api"
+	"github.com/dracory/weebase/shared/audit"
+	"github.com/dracory/weebase/shared/driver"
+	"github.com/dracory/weebase/shared/export"
+	"github.com/dracory/weebase/shared/masking"
 	"github.com/dracory/weebase/shared/session"
 	"github.com/dracory/weebase/shared/types"
 )
@@ -58,7 +62,7 @@ func (h *SQLExecute) Handle(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	sess := session.EnsureSession(nil, nil, h.config.SessionSecret)
+	sess := session.EnsureSession(w, r, h.config.SessionSecret)
 	if sess == nil || sess.Conn == nil {
 		api.Respond(w, r, api.Error("not connected to database"))
 		return
@@ -74,6 +78,7 @@ func (h *SQLExecute) Handle(w http.ResponseWriter, r *http.Request) {
 		api.Respond(w, r, api.Error("sql is required"))
 		return
 	}
+	audit.SetSQL(r.Context(), sqlText)
 
 	// Safe mode guard for destructive DDL
 	if h.safeModeDefault && isDestructiveQuery(sqlText) && r.Form.Get("confirm") != "yes" {
@@ -90,7 +95,7 @@ func (h *SQLExecute) Handle(w http.ResponseWriter, r *http.Request) {
 	transactional := r.Form.Get("transactional") == "true"
 
 	// Open database connection
-	db, err := sql.Open(sess.Conn.Driver, sess.Conn.DSN)
+	db, err := driver.OpenSQLDB(sess.Conn.Driver, sess.Conn.DSN)
 	if err != nil {
 		api.Respond(w, r, api.Error(fmt.Sprintf("failed to connect to database: %v", err)))
 		return
@@ -176,6 +181,7 @@ func (h *SQLExecute) executeQuery(db SQLExecutor, query string, w http.ResponseW
 		// Some databases/drivers might not support RowsAffected
 		rowsAffected = -1
 	}
+	audit.AddRowsAffected(r.Context(), rowsAffected)
 
 	api.Respond(w, r, api.SuccessWithData("result", map[string]any{
 		"rows_affected": rowsAffected,
@@ -190,18 +196,43 @@ type SQLExecutor interface {
 	Exec(query string, args ...interface{}) (sql.Result, error)
 }
 
-// writeRowsResult scans sql.Rows into a JSON-friendly structure with a sane row cap
-func writeRowsResult(w http.ResponseWriter, r *http.Request, rows *sql.Rows) error {
-	cols, err := rows.Columns()
+// MaxRows is the safety limit on rows returned for a single result set
+const MaxRows = 1000
+
+// ResultSet is the JSON-friendly form of a single query result
+type ResultSet struct {
+	Columns  []string         `json:"columns"`
+	Rows     []map[string]any `json:"rows"`
+	RowCount int              `json:"row_count"`
+	HasMore  bool             `json:"has_more"`
+	Limit    int              `json:"limit"`
+}
+
+// ScanRows scans the current result set of rows into a ResultSet, capped at maxRows,
+// masking its columns with masker. It is exported so other actions (e.g. routine
+// execution) serialize results the same way.
+func ScanRows(rows *sql.Rows, maxRows int, masker *masking.Masker) (ResultSet, error) {
+	columnTypes, err := export.Columns(rows)
 	if err != nil {
-		return fmt.Errorf("failed to get columns: %v", err)
+		return ResultSet{}, err
+	}
+	// the rows of a query come from no known table
+	masks := masker.Columns("", "", columnTypes)
+	cols := make([]string, len(columnTypes))
+	for i, c := range columnTypes {
+		cols[i] = c.Name
 	}
 
 	var results []map[string]any
 	rowCount := 0
-	maxRows := 1000 // Safety limit
+	hasMore := false
+
+	for rows.Next() {
+		if rowCount >= maxRows {
+			hasMore = true
+			break
+		}
 
-	for rows.Next() && rowCount < maxRows {
 		// Create slices to hold column values and pointers
 		columns := make([]interface{}, len(cols))
 		columnPointers := make([]interface{}, len(cols))
@@ -211,22 +242,15 @@ func writeRowsResult(w http.ResponseWriter, r *http.Request, rows *sql.Rows) err
 
 		// Scan the row into the column pointers
 		if err := rows.Scan(columnPointers...); err != nil {
-			return fmt.Errorf("failed to scan row: %v", err)
+			return ResultSet{}, fmt.Errorf("failed to scan row: %v", err)
 		}
+		masking.Apply(masks, columns)
 
 		// Convert the row to a map with proper type handling
 		row := make(map[string]any)
 		for i, colName := range cols {
-			val := columnPointers[i].(*interface{})
-			switch v := (*val).(type) {
-			case []byte:
-				// Convert []byte to string for better JSON serialization
-				row[colName] = string(v)
-			case nil:
-				row[colName] = nil
-			default:
-				row[colName] = v
-			}
+			// shared with the JSON exports so both encode values the same way
+			row[colName] = export.JSONValue(columns[i], columnTypes[i])
 		}
 
 		results = append(results, row)
@@ -235,22 +259,32 @@ func writeRowsResult(w http.ResponseWriter, r *http.Request, rows *sql.Rows) err
 
 	// Check for errors during iteration
 	if err := rows.Err(); err != nil {
-		return fmt.Errorf("error iterating rows: %v", err)
+		return ResultSet{}, fmt.Errorf("error iterating rows: %v", err)
 	}
 
-	// Check if there are more rows than the limit
-	hasMore := false
-	if rowCount >= maxRows && rows.Next() {
-		hasMore = true
+	return ResultSet{
+		Columns:  cols,
+		Rows:     results,
+		RowCount: rowCount,
+		HasMore:  hasMore,
+		Limit:    maxRows,
+	}, nil
+}
+
+// writeRowsResult scans sql.Rows into a JSON-friendly structure with a sane row cap
+func writeRowsResult(w http.ResponseWriter, r *http.Request, rows *sql.Rows) error {
+	result, err := ScanRows(rows, MaxRows, masking.FromContext(r.Context()))
+	if err != nil {
+		return err
 	}
 
 	// Return the results
 	api.Respond(w, r, api.SuccessWithData("rows", map[string]any{
-		"rows":       results,
-		"row_count":  rowCount,
-		"has_more":   hasMore,
-		"limit":      maxRows,
-		"message":    "Query executed successfully",
+		"rows":      result.Rows,
+		"row_count": result.RowCount,
+		"has_more":  result.HasMore,
+		"limit":     result.Limit,
+		"message":   "Query executed successfully",
 	}))
 	return nil
 }
@@ -0,0 +1,39 @@
+package api_sql_execute
+
+import "testing"
+
+// The console keeps its own prefix classification; the export and script
+// runners use the wider one of the sqlguard package.
+func TestQueryClassification(t *testing.T) {
+	cases := []struct {
+		query       string
+		readOnly    bool
+		destructive bool
+	}{
+		{"SELECT 1", true, false},
+		{"  show tables", true, false},
+		{"EXPLAIN SELECT * FROM users", true, false},
+		{"WITH t AS (SELECT 1) SELECT * FROM t", false, false},
+		{"WITH gone AS (DELETE FROM users RETURNING *) SELECT * FROM gone", false, false},
+		{"VALUES (1)", false, false},
+		{"DESCRIBE users", false, false},
+		{"PRAGMA table_info(users)", false, false},
+		{"-- note\nSELECT 1", false, false},
+		{"DROP TABLE users", false, true},
+		{"alter table users add x int", false, true},
+		{"TRUNCATE users", false, true},
+		{"DELETE FROM users", false, true},
+		{"UPDATE users SET a = 1", false, true},
+		{"INSERT INTO users VALUES (1)", false, true},
+		{"REPLACE INTO users VALUES (1)", false, false},
+		{"MERGE INTO users USING src ON 1 = 1", false, false},
+	}
+	for _, c := range cases {
+		if got := isReadOnlyQuery(c.query); got != c.readOnly {
+			t.Errorf("isReadOnlyQuery(%q) = %v, want %v", c.query, got, c.readOnly)
+		}
+		if got := isDestructiveQuery(c.query); got != c.destructive {
+			t.Errorf("isDestructiveQuery(%q) = %v, want %v", c.query, got, c.destructive)
+		}
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"strings"
 
 	"github.com/dracory/api"
+	"github.com/dracory/weebase/shared/driver"
 	"github.com/dracory/weebase/shared/session"
 	"github.com/dracory/weebase/shared/types"
 )
@@ -100,7 +101,7 @@ func (h *SQLExplain) Handle(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Open database connection
-	db, err := sql.Open(sess.Conn.Driver, sess.Conn.DSN)
+	db, err := driver.OpenSQLDB(sess.Conn.Driver, sess.Conn.DSN)
 	if err != nil {
 		api.Respond(w, r, api.Error(fmt.Sprintf("failed to connect to database: %v", err)))
 		return
@@ -0,0 +1,169 @@
+package api_sql_import
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/dracory/api"
+	"github.com/dracory/weebase/shared/audit"
+	"github.com/dracory/weebase/shared/driver"
+	"github.com/dracory/weebase/shared/jobs"
+	"github.com/dracory/weebase/shared/session"
+	"github.com/dracory/weebase/shared/sqlscript"
+	"github.com/dracory/weebase/shared/types"
+)
+
+// maxMemory is how much of an upload is held in memory before spilling to a temp file
+const maxMemory = 32 << 20
+
+// SQLImport runs an uploaded .sql or .sql.gz script against the current connection
+type SQLImport struct {
+	config types.Config
+	jobs   *jobs.Runner
+}
+
+// New creates a new SQLImport handler; runner runs the scripts started with async=yes
+func New(config types.Config, runner *jobs.Runner) *SQLImport {
+	return &SQLImport{config: config, jobs: runner}
+}
+
+// Handle processes the request.
+//
+// Parameters: file (multipart upload, gzip is detected), upload_id or sql
+// (inline text), continue_on_error=yes to run past failed statements and
+// async=yes to run in the background and poll the job status with the
+// returned job_id. In safe mode destructive statements are rejected unless
+// confirm=yes; in read-only mode every writing statement is rejected.
+func (h *SQLImport) Handle(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		api.Respond(w, r, api.Error("method not allowed"))
+		return
+	}
+
+	sess := session.EnsureSession(w, r, h.config.SessionSecret)
+	if sess == nil || sess.Conn == nil {
+		api.Respond(w, r, api.Error("not connected to database"))
+		return
+	}
+
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		if err := r.ParseMultipartForm(maxMemory); err != nil {
+			api.Respond(w, r, api.Error("failed to parse form"))
+			return
+		}
+	} else if err := r.ParseForm(); err != nil {
+		api.Respond(w, r, api.Error("failed to parse form"))
+		return
+	}
+
+	opts := sqlscript.Options{
+		Driver:          sess.Conn.Driver,
+		ContinueOnError: r.Form.Get("continue_on_error") == "yes",
+		ReadOnly:        h.config.ReadOnlyMode,
+		SafeMode:        h.config.SafeModeDefault && strings.TrimSpace(r.Form.Get("confirm")) != "yes",
+	}
+
+	script, size, stored, err := open(r, sess.ID)
+	if err != nil {
+		api.Respond(w, r, api.Error(err.Error()))
+		return
+	}
+
+	db, err := driver.OpenSQLDB(sess.Conn.Driver, sess.Conn.DSN)
+	if err != nil {
+		script.Close()
+		api.Respond(w, r, api.Error(fmt.Sprintf("failed to connect to database: %v", err)))
+		return
+	}
+
+	if r.Form.Get("async") == "yes" {
+		// the request's own upload is gone once the request ends
+		kept := ""
+		if !stored {
+			if script, kept, err = keep(script, sess.ID); err != nil {
+				db.Close()
+				api.Respond(w, r, api.Error(err.Error()))
+				return
+			}
+		}
+		job := audit.StartJob(r.Context())
+		id, err := h.jobs.Submit(jobs.Spec{Kind: jobs.KindSQLImport, Owner: sess.ID, Input: script, Size: size,
+			Run: func(ctx context.Context, t *jobs.Task) (any, error) {
+				defer db.Close()
+				if kept != "" {
+					defer jobs.RemoveUpload(sess.ID, kept)
+				}
+				ctx = job.Context(ctx)
+				opts.Progress = func(s sqlscript.Summary) { t.Progress(s) }
+				opts.Executing = func(sql string) { audit.AddSQL(ctx, sql) }
+				summary, err := sqlscript.Run(ctx, db, t.Input, opts)
+				audit.AddRowsAffected(ctx, summary.RowsAffected)
+				job.Finish(ctx, outcome(summary, err))
+				return summary, err
+			}})
+		if err != nil {
+			db.Close()
+			api.Respond(w, r, api.Error(err.Error()))
+			return
+		}
+		api.Respond(w, r, api.SuccessWithData("script started", map[string]any{"job_id": id}))
+		return
+	}
+	defer script.Close()
+	defer db.Close()
+
+	opts.Executing = func(sql string) { audit.AddSQL(r.Context(), sql) }
+	summary, err := sqlscript.Run(r.Context(), db, script, opts)
+	audit.AddRowsAffected(r.Context(), summary.RowsAffected)
+	data := map[string]any{"summary": summary}
+	if err := outcome(summary, err); err != nil {
+		api.Respond(w, r, api.ErrorWithData(err.Error(), data))
+		return
+	}
+	api.Respond(w, r, api.SuccessWithData(fmt.Sprintf("executed %d statements", summary.Executed), data))
+}
+
+// outcome describes how a run went wrong, nil when every statement ran
+func outcome(summary sqlscript.Summary, err error) error {
+	switch {
+	case err != nil:
+		return fmt.Errorf("script failed: %v", err)
+	case summary.Stopped:
+		return fmt.Errorf("script stopped at line %d after %d statements", summary.Errors[0].Line, summary.Executed)
+	case summary.Failed > 0:
+		return fmt.Errorf("executed %d statements, %d failed", summary.Executed, summary.Failed)
+	}
+	return nil
+}
+
+// open returns the script from the upload_id, the uploaded file or the sql
+// field, with its size and whether it is a stored upload
+func open(r *http.Request, owner string) (io.ReadCloser, int64, bool, error) {
+	if id := strings.TrimSpace(r.Form.Get("upload_id")); id != "" {
+		f, u, err := jobs.OpenUpload(owner, id)
+		return f, u.Size, true, err
+	}
+	if r.MultipartForm != nil {
+		if file, header, err := r.FormFile("file"); err == nil {
+			return file, header.Size, false, nil
+		}
+	}
+	if text := r.Form.Get("sql"); strings.TrimSpace(text) != "" {
+		return io.NopCloser(strings.NewReader(text)), int64(len(text)), false, nil
+	}
+	return nil, 0, false, fmt.Errorf("file is required")
+}
+
+// keep copies a script into an upload that outlives the request
+func keep(script io.ReadCloser, owner string) (io.ReadCloser, string, error) {
+	defer script.Close()
+	u, err := jobs.SaveUpload(owner, "", script)
+	if err != nil {
+		return nil, "", err
+	}
+	f, _, err := jobs.OpenUpload(owner, u.ID)
+	return f, u.ID, err
+}
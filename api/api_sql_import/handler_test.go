@@ -0,0 +1,253 @@
+package api_sql_import_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dracory/weebase/api/api_job_status"
+	"github.com/dracory/weebase/api/api_sql_import"
+	"github.com/dracory/weebase/shared/audit"
+	"github.com/dracory/weebase/shared/jobs"
+	"github.com/dracory/weebase/shared/testutil"
+	"github.com/dracory/weebase/shared/types"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// runner runs the jobs started by the handlers under test
+var runner = jobs.NewRunner(jobs.NewMemoryStore(), jobs.Options{})
+
+const script = `-- a small dump
+CREATE TABLE notes (id INTEGER PRIMARY KEY, body TEXT);
+INSERT INTO notes VALUES (1, 'one; with a semicolon');
+INSERT INTO notes VALUES (2, 'two');
+INSERT INTO missing VALUES (3);
+INSERT INTO notes VALUES (4, 'four');
+`
+
+func setupTestDB(t *testing.T) (*sql.DB, string) {
+	tempFile, err := os.CreateTemp("", "testdb-*.db")
+	if err != nil {
+		t.Fatalf("failed to create temp file: %v", err)
+	}
+	tempFile.Close()
+	t.Cleanup(func() { os.Remove(tempFile.Name()) })
+
+	db, err := sql.Open("sqlite3", tempFile.Name())
+	if err != nil {
+		t.Fatalf("failed to open SQLite database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db, tempFile.Name()
+}
+
+type summary struct {
+	Executed     int64 `json:"executed"`
+	Failed       int64 `json:"failed"`
+	RowsAffected int64 `json:"rows_affected"`
+	Stopped      bool  `json:"stopped"`
+	BytesRead    int64 `json:"bytes_read"`
+	Errors       []struct {
+		Line    int    `json:"line"`
+		Message string `json:"message"`
+	} `json:"errors"`
+}
+
+type response struct {
+	Status  string `json:"status"`
+	Message string `json:"message"`
+	Data    struct {
+		Summary summary `json:"summary"`
+		JobID   string  `json:"job_id"`
+	} `json:"data"`
+}
+
+func run(t *testing.T, config types.Config, dbPath string, form url.Values) response {
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return send(t, config, dbPath, req)
+}
+
+func send(t *testing.T, config types.Config, dbPath string, req *http.Request) response {
+	config.SessionSecret = "test-secret"
+	req.AddCookie(testutil.SessionCookie(t, dbPath))
+	w := httptest.NewRecorder()
+	api_sql_import.New(config, runner).Handle(w, req)
+
+	var resp response
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to decode response %q: %v", w.Body.String(), err)
+	}
+	return resp
+}
+
+func count(t *testing.T, db *sql.DB) int {
+	var n int
+	if err := db.QueryRow("SELECT COUNT(*) FROM notes").Scan(&n); err != nil {
+		t.Fatalf("count failed: %v", err)
+	}
+	return n
+}
+
+func TestSQLImport_StopAndContinue(t *testing.T) {
+	db, dbPath := setupTestDB(t)
+
+	resp := run(t, types.Config{}, dbPath, url.Values{"sql": {script}})
+	s := resp.Data.Summary
+	if resp.Status != "error" || !s.Stopped || s.Executed != 3 || s.Failed != 1 || s.Errors[0].Line != 5 {
+		t.Fatalf("expected the script to stop at line 5: %+v", resp)
+	}
+	if resp.Message != "script stopped at line 5 after 3 statements" {
+		t.Errorf("unexpected message: %s", resp.Message)
+	}
+	if count(t, db) != 2 {
+		t.Errorf("expected 2 rows, got %d", count(t, db))
+	}
+
+	db.Exec("DROP TABLE notes")
+	resp = run(t, types.Config{}, dbPath, url.Values{"sql": {script}, "continue_on_error": {"yes"}})
+	s = resp.Data.Summary
+	if s.Stopped || s.Executed != 4 || s.Failed != 1 || s.RowsAffected != 3 {
+		t.Fatalf("unexpected summary: %+v", s)
+	}
+	if count(t, db) != 3 {
+		t.Errorf("expected 3 rows, got %d", count(t, db))
+	}
+}
+
+func TestSQLImport_GzipUpload(t *testing.T) {
+	db, dbPath := setupTestDB(t)
+
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	zw.Write([]byte("CREATE TABLE notes (id INTEGER, body TEXT);\nINSERT INTO notes VALUES (1, 'a'), (2, 'b');\n"))
+	zw.Close()
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	fw, _ := mw.CreateFormFile("file", "dump.sql.gz")
+	fw.Write(gz.Bytes())
+	mw.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/", &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	resp := send(t, types.Config{}, dbPath, req)
+	if resp.Status != "success" || resp.Data.Summary.Executed != 2 || resp.Data.Summary.BytesRead != int64(gz.Len()) {
+		t.Fatalf("unexpected response: %+v", resp)
+	}
+	if count(t, db) != 2 {
+		t.Errorf("expected 2 rows, got %d", count(t, db))
+	}
+}
+
+func TestSQLImport_SafeModeAndReadOnly(t *testing.T) {
+	db, dbPath := setupTestDB(t)
+	db.Exec("CREATE TABLE notes (id INTEGER, body TEXT)")
+
+	// CREATE passes safe mode, INSERT needs confirmation
+	resp := run(t, types.Config{SafeModeDefault: true}, dbPath, url.Values{"sql": {"CREATE TABLE other (id INTEGER);\nINSERT INTO notes VALUES (1, 'a');"}})
+	if resp.Data.Summary.Executed != 1 || len(resp.Data.Summary.Errors) != 1 ||
+		resp.Data.Summary.Errors[0].Message != "confirmation required for destructive operation" {
+		t.Fatalf("unexpected safe mode response: %+v", resp)
+	}
+	resp = run(t, types.Config{SafeModeDefault: true}, dbPath, url.Values{"sql": {"INSERT INTO notes VALUES (1, 'a');"}, "confirm": {"yes"}})
+	if resp.Status != "success" || count(t, db) != 1 {
+		t.Fatalf("confirmed script did not run: %+v", resp)
+	}
+
+	resp = run(t, types.Config{ReadOnlyMode: true}, dbPath, url.Values{"sql": {"SELECT * FROM notes;\nDELETE FROM notes;"}, "continue_on_error": {"yes"}})
+	if resp.Data.Summary.Executed != 1 || resp.Data.Summary.Failed != 1 ||
+		resp.Data.Summary.Errors[0].Message != "write operations are not allowed in read-only mode" {
+		t.Fatalf("unexpected read-only response: %+v", resp)
+	}
+	if count(t, db) != 1 {
+		t.Errorf("read-only mode let a DELETE through")
+	}
+}
+
+func TestSQLImport_AsyncProgress(t *testing.T) {
+	db, dbPath := setupTestDB(t)
+
+	resp := run(t, types.Config{}, dbPath, url.Values{"sql": {script}, "async": {"yes"}, "continue_on_error": {"yes"}})
+	if resp.Status != "success" || resp.Data.JobID == "" {
+		t.Fatalf("unexpected response: %+v", resp)
+	}
+
+	var progress struct {
+		Data struct {
+			Job struct {
+				State  string  `json:"state"`
+				Size   int64   `json:"size"`
+				Result summary `json:"result"`
+			} `json:"job"`
+		} `json:"data"`
+	}
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(20 * time.Millisecond) {
+		req := httptest.NewRequest(http.MethodGet, "/?job_id="+resp.Data.JobID, nil)
+		req.AddCookie(testutil.SessionCookie(t, dbPath))
+		w := httptest.NewRecorder()
+		api_job_status.New(types.Config{SessionSecret: "test-secret"}, runner).Handle(w, req)
+		if err := json.Unmarshal(w.Body.Bytes(), &progress); err != nil {
+			t.Fatalf("failed to decode progress %q: %v", w.Body.String(), err)
+		}
+		if state := progress.Data.Job.State; state != jobs.StateQueued && state != jobs.StateRunning {
+			break
+		}
+	}
+
+	job := progress.Data.Job
+	if job.State != jobs.StateDone || job.Result.Executed != 4 || job.Result.Failed != 1 || job.Size != int64(len(script)) {
+		t.Fatalf("unexpected job status: %+v", job)
+	}
+	if count(t, db) != 3 {
+		t.Errorf("expected 3 rows, got %d", count(t, db))
+	}
+}
+
+// sink hands the audit entries written to it to the test
+type sink chan audit.Entry
+
+func (s sink) Write(_ context.Context, e audit.Entry) error {
+	s <- e
+	return nil
+}
+
+func TestSQLImport_AsyncAudit(t *testing.T) {
+	_, dbPath := setupTestDB(t)
+
+	entry := &audit.Entry{Action: "api_sql_import", RowsAffected: -1}
+	entries := make(sink, 1)
+	form := url.Values{"sql": {script}, "async": {"yes"}, "continue_on_error": {"yes"}}
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req = req.WithContext(audit.WithSink(audit.WithEntry(req.Context(), entry), entries))
+	if resp := send(t, types.Config{}, dbPath, req); resp.Status != "success" {
+		t.Fatalf("unexpected response: %+v", resp)
+	}
+	if entry.Outcome != audit.OutcomeSubmitted {
+		t.Errorf("expected the request to be recorded as submitted, got %q", entry.Outcome)
+	}
+
+	select {
+	case got := <-entries:
+		// one statement of the script failed, so the job did too
+		if got.Outcome != audit.OutcomeError || got.RowsAffected != 3 || !strings.Contains(got.Error, "1 failed") {
+			t.Errorf("expected the job's outcome and row count, got %+v", got)
+		}
+		if !strings.Contains(got.Statement, "INSERT INTO notes VALUES (?, ?)") || strings.Contains(got.Statement, "semicolon") {
+			t.Errorf("expected the redacted statements, got %q", got.Statement)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the job wrote no audit entry")
+	}
+}
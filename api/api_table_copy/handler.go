@@ -0,0 +1,200 @@
+package api_table_copy
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/dracory/api"
+	"github.com/dracory/weebase/shared/audit"
+	"github.com/dracory/weebase/shared/connection"
+	"github.com/dracory/weebase/shared/dialect"
+	"github.com/dracory/weebase/shared/jobs"
+	"github.com/dracory/weebase/shared/session"
+	"github.com/dracory/weebase/shared/tablecopy"
+	"github.com/dracory/weebase/shared/types"
+)
+
+// TableCopy copies a table or query result from one connection to another
+type TableCopy struct {
+	config types.Config
+	jobs   *jobs.Runner
+}
+
+// New creates a new TableCopy handler; runner runs the copies started with async=yes
+func New(config types.Config, runner *jobs.Runner) *TableCopy {
+	return &TableCopy{config: config, jobs: runner}
+}
+
+// Handle processes the request.
+//
+// Both sides default to the session's connection; "source_driver"/"source_dsn"
+// and "target_driver"/"target_dsn" point a side elsewhere (ad-hoc connections
+// must be allowed). The source is "source_schema" and "source_table", or a
+// read-only "query"; the target is "target_schema" and "target_table", which
+// defaults to the source table and is created when missing. "mode" is append
+// or truncate, "batch_size" sets the rows per INSERT and async=yes runs the
+// copy in the background, polled through the job status with the
+// returned job_id.
+func (h *TableCopy) Handle(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		api.Respond(w, r, api.Error("method not allowed"))
+		return
+	}
+
+	sess := session.EnsureSession(w, r, h.config.SessionSecret)
+	if sess == nil {
+		api.Respond(w, r, api.Error("failed to get session"))
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		api.Respond(w, r, api.Error("failed to parse form"))
+		return
+	}
+
+	if h.config.ReadOnlyMode {
+		api.Respond(w, r, api.Error("write operations are not allowed in read-only mode"))
+		return
+	}
+	if h.config.SafeModeDefault && strings.TrimSpace(r.Form.Get("confirm")) != "yes" {
+		api.Respond(w, r, api.Error("confirmation required (set confirm=yes)"))
+		return
+	}
+
+	source, err := connection.FromForm(r.Context(), h.config, sess, r.Form, "source_")
+	if err != nil {
+		api.Respond(w, r, api.Error(err.Error()))
+		return
+	}
+	target, err := connection.FromForm(r.Context(), h.config, sess, r.Form, "target_")
+	if err != nil {
+		api.Respond(w, r, api.Error(err.Error()))
+		return
+	}
+
+	src := tablecopy.Endpoint{
+		Driver: source.Driver,
+		Schema: strings.TrimSpace(r.Form.Get("source_schema")),
+		Table:  strings.TrimSpace(r.Form.Get("source_table")),
+	}
+	dst := tablecopy.Endpoint{
+		Driver: target.Driver,
+		Schema: strings.TrimSpace(r.Form.Get("target_schema")),
+		Table:  strings.TrimSpace(r.Form.Get("target_table")),
+	}
+	opts := tablecopy.Options{
+		Query: strings.TrimSpace(r.Form.Get("query")),
+		Mode:  strings.TrimSpace(r.Form.Get("mode")),
+	}
+
+	if opts.Query == "" && src.Table == "" {
+		api.Respond(w, r, api.Error("source_table or query is required"))
+		return
+	}
+	if dst.Table == "" {
+		dst.Table = src.Table
+	}
+	if dst.Table == "" {
+		api.Respond(w, r, api.Error("target_table is required"))
+		return
+	}
+	for _, ident := range []string{src.Schema, src.Table, dst.Schema, dst.Table} {
+		if ident != "" && !dialect.SanitizeIdent(ident) {
+			api.Respond(w, r, api.Error("invalid table or schema identifier"))
+			return
+		}
+	}
+	if opts.Query == "" && source == target &&
+		tableKey(src.Driver, src.Schema, src.Table) == tableKey(dst.Driver, dst.Schema, dst.Table) {
+		api.Respond(w, r, api.Error("source and target are the same table"))
+		return
+	}
+	if v := strings.TrimSpace(r.Form.Get("batch_size")); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			api.Respond(w, r, api.Error("batch_size must be a positive number"))
+			return
+		}
+		opts.BatchSize = n
+	}
+
+	if src.DB, err = source.Open(r.Context()); err != nil {
+		api.Respond(w, r, api.Error(fmt.Sprintf("source: failed to connect to database: %v", err)))
+		return
+	}
+	if dst.DB, err = target.Open(r.Context()); err != nil {
+		src.DB.Close()
+		api.Respond(w, r, api.Error(fmt.Sprintf("target: failed to connect to database: %v", err)))
+		return
+	}
+
+	audit.SetObject(r.Context(), dst.Schema, dst.Table)
+	if opts.Query != "" {
+		audit.AddSQL(r.Context(), opts.Query)
+	}
+
+	if r.Form.Get("async") == "yes" {
+		job := audit.StartJob(r.Context())
+		id, err := h.jobs.Submit(jobs.Spec{Kind: jobs.KindTableCopy, Owner: sess.ID,
+			Run: func(ctx context.Context, t *jobs.Task) (any, error) {
+				defer src.DB.Close()
+				defer dst.DB.Close()
+				ctx = job.Context(ctx)
+				opts.Progress = func(r tablecopy.Result) { t.Progress(r) }
+				result, err := tablecopy.Run(ctx, src, dst, opts)
+				record(ctx, result)
+				if err == nil && !result.Committed {
+					job.Finish(ctx, fmt.Errorf("copy rolled back: %d rows rejected", result.Failed))
+				} else {
+					job.Finish(ctx, err)
+				}
+				return result, err
+			}})
+		if err != nil {
+			src.DB.Close()
+			dst.DB.Close()
+			api.Respond(w, r, api.Error(err.Error()))
+			return
+		}
+		api.Respond(w, r, api.SuccessWithData("copy started", map[string]any{"job_id": id}))
+		return
+	}
+	defer src.DB.Close()
+	defer dst.DB.Close()
+
+	result, err := tablecopy.Run(r.Context(), src, dst, opts)
+	record(r.Context(), result)
+	data := map[string]any{"result": result}
+	switch {
+	case err != nil:
+		api.Respond(w, r, api.ErrorWithData(fmt.Sprintf("copy failed: %v", err), data))
+	case !result.Committed:
+		api.Respond(w, r, api.ErrorWithData(fmt.Sprintf("copy rolled back: %d rows rejected", result.Failed), data))
+	default:
+		api.Respond(w, r, api.SuccessWithData(fmt.Sprintf("copied %d rows", result.Copied), data))
+	}
+}
+
+// record adds the table a copy created and the rows it committed to the
+// audit entry of ctx
+func record(ctx context.Context, result tablecopy.Result) {
+	if result.Created {
+		audit.AddSQL(ctx, result.SQL)
+	}
+	if result.Committed {
+		audit.AddRowsAffected(ctx, result.Copied)
+	} else {
+		audit.AddRowsAffected(ctx, 0)
+	}
+}
+
+// tableKey identifies a table on a connection, filling in the default schema
+func tableKey(drv, schema, table string) string {
+	if schema == "" {
+		schema = dialect.DefaultSchema(drv)
+	}
+	return schema + "." + table
+}
@@ -0,0 +1,295 @@
+package api_table_copy_test
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dracory/weebase/api/api_job_status"
+	"github.com/dracory/weebase/api/api_table_copy"
+	"github.com/dracory/weebase/shared/jobs"
+	"github.com/dracory/weebase/shared/testutil"
+	"github.com/dracory/weebase/shared/types"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// runner runs the jobs started by the handlers under test
+var runner = jobs.NewRunner(jobs.NewMemoryStore(), jobs.Options{})
+
+// createDB creates a file-backed SQLite database initialised with the given statements
+func createDB(t *testing.T, stmts ...string) (*sql.DB, string) {
+	tempFile, err := os.CreateTemp("", "testdb-*.db")
+	if err != nil {
+		t.Fatalf("failed to create temp file: %v", err)
+	}
+	tempFile.Close()
+	t.Cleanup(func() { os.Remove(tempFile.Name()) })
+
+	db, err := sql.Open("sqlite3", tempFile.Name())
+	if err != nil {
+		t.Fatalf("failed to open SQLite database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	for _, stmt := range stmts {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatalf("failed to execute %q: %v", stmt, err)
+		}
+	}
+	return db, tempFile.Name()
+}
+
+type copyResult struct {
+	Total     int64  `json:"total"`
+	Rows      int64  `json:"rows"`
+	Copied    int64  `json:"copied"`
+	Failed    int64  `json:"failed"`
+	Method    string `json:"method"`
+	Created   bool   `json:"created"`
+	SQL       string `json:"sql"`
+	Committed bool   `json:"committed"`
+	Errors    []struct {
+		Row     int64  `json:"row"`
+		Column  string `json:"column"`
+		Message string `json:"message"`
+	} `json:"errors"`
+}
+
+type copyResponse struct {
+	Status  string `json:"status"`
+	Message string `json:"message"`
+	Data    struct {
+		Result copyResult `json:"result"`
+		JobID  string     `json:"job_id"`
+	} `json:"data"`
+}
+
+var adHoc = types.Config{
+	SessionSecret:         "test-secret",
+	EnabledDrivers:        []string{"sqlite"},
+	AllowAdHocConnections: true,
+}
+
+func copyTable(t *testing.T, config types.Config, dbPath string, form url.Values) copyResponse {
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.AddCookie(testutil.SessionCookie(t, dbPath))
+	w := httptest.NewRecorder()
+	api_table_copy.New(config, runner).Handle(w, req)
+
+	var response copyResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("failed to decode response %q: %v", w.Body.String(), err)
+	}
+	return response
+}
+
+func sourceDB(t *testing.T) (*sql.DB, string) {
+	return createDB(t,
+		`CREATE TABLE customers (id INTEGER PRIMARY KEY AUTOINCREMENT, name TEXT NOT NULL, email VARCHAR(255) UNIQUE, balance DECIMAL(10,2), active BOOLEAN, joined DATETIME, photo BLOB)`,
+		`INSERT INTO customers (name, email, balance, active, joined, photo) VALUES
+			('Ann', 'ann@example.com', 10.50, 1, '2024-01-02 03:04:05', X'CAFE'),
+			('Bob', NULL, NULL, 0, NULL, NULL),
+			('Cy', 'cy@example.com', 3, 1, '2024-02-03 00:00:00', NULL)`,
+	)
+}
+
+func TestTableCopy_CreatesTargetTable(t *testing.T) {
+	_, sourcePath := sourceDB(t)
+	targetDB, targetPath := createDB(t)
+
+	response := copyTable(t, adHoc, sourcePath, url.Values{
+		"source_table":  {"customers"},
+		"target_driver": {"sqlite"},
+		"target_dsn":    {targetPath},
+	})
+	if response.Status != "success" {
+		t.Fatalf("expected success, got %s: %s", response.Status, response.Message)
+	}
+	r := response.Data.Result
+	if !r.Created || !r.Committed || r.Total != 3 || r.Copied != 3 || r.Method != "insert" {
+		t.Fatalf("unexpected result: %+v", r)
+	}
+	if !strings.Contains(r.SQL, `CREATE TABLE "customers"`) {
+		t.Errorf("expected the CREATE TABLE statement, got %s", r.SQL)
+	}
+
+	var name string
+	var email sql.NullString
+	var photo []byte
+	if err := targetDB.QueryRow(`SELECT name, email, photo FROM customers WHERE id = 1`).Scan(&name, &email, &photo); err != nil {
+		t.Fatalf("failed to read copied row: %v", err)
+	}
+	if name != "Ann" || email.String != "ann@example.com" || string(photo) != "\xca\xfe" {
+		t.Errorf("unexpected copied row: %s %v %x", name, email, photo)
+	}
+	if _, err := targetDB.Exec(`INSERT INTO customers (name, email) VALUES ('Dee', 'ann@example.com')`); err == nil {
+		t.Error("expected the unique constraint to be copied")
+	}
+}
+
+func TestTableCopy_AppendAndTruncate(t *testing.T) {
+	_, sourcePath := sourceDB(t)
+	targetDB, targetPath := createDB(t,
+		`CREATE TABLE people (id INTEGER PRIMARY KEY, name TEXT)`,
+		`INSERT INTO people VALUES (100, 'existing')`,
+	)
+	form := url.Values{
+		"query":         {"SELECT id, name FROM customers WHERE active = 1"},
+		"target_driver": {"sqlite"},
+		"target_dsn":    {targetPath},
+		"target_table":  {"people"},
+		"batch_size":    {"1"},
+	}
+
+	response := copyTable(t, adHoc, sourcePath, form)
+	if response.Status != "success" || response.Data.Result.Created || response.Data.Result.Copied != 2 {
+		t.Fatalf("unexpected append response: %+v", response)
+	}
+
+	// the same ids again conflict with the rows just copied
+	response = copyTable(t, adHoc, sourcePath, form)
+	if response.Status != "error" || response.Data.Result.Committed || response.Data.Result.Failed != 2 {
+		t.Fatalf("expected the second append to roll back: %+v", response)
+	}
+
+	form.Set("mode", "truncate")
+	response = copyTable(t, adHoc, sourcePath, form)
+	if response.Status != "success" || response.Data.Result.Copied != 2 {
+		t.Fatalf("unexpected truncate response: %+v", response)
+	}
+	var n int
+	targetDB.QueryRow(`SELECT COUNT(*) FROM people`).Scan(&n)
+	if n != 2 {
+		t.Errorf("expected 2 rows after truncate, got %d", n)
+	}
+}
+
+func TestTableCopy_RejectedRowsRollBack(t *testing.T) {
+	_, sourcePath := createDB(t,
+		`CREATE TABLE readings (sensor TEXT, value TEXT)`,
+		`INSERT INTO readings VALUES ('a', '1'), ('b', 'broken')`,
+	)
+	targetDB, targetPath := createDB(t, `CREATE TABLE readings (sensor TEXT, value INTEGER)`)
+
+	response := copyTable(t, adHoc, sourcePath, url.Values{
+		"source_table":  {"readings"},
+		"target_driver": {"sqlite"},
+		"target_dsn":    {targetPath},
+	})
+	r := response.Data.Result
+	if response.Status != "error" || r.Committed || len(r.Errors) != 1 || r.Errors[0].Row != 2 || r.Errors[0].Column != "value" {
+		t.Fatalf("expected row 2 to be rejected: %+v", response)
+	}
+	var n int
+	targetDB.QueryRow(`SELECT COUNT(*) FROM readings`).Scan(&n)
+	if n != 0 {
+		t.Errorf("expected nothing to be committed, got %d rows", n)
+	}
+}
+
+func TestTableCopy_WithinConnection(t *testing.T) {
+	db, path := sourceDB(t)
+
+	response := copyTable(t, types.Config{SessionSecret: "test-secret"}, path, url.Values{
+		"source_table": {"customers"},
+		"target_table": {"customers_copy"},
+	})
+	if response.Status != "success" || response.Data.Result.Copied != 3 {
+		t.Fatalf("unexpected response: %+v", response)
+	}
+	var n int
+	db.QueryRow(`SELECT COUNT(*) FROM customers_copy`).Scan(&n)
+	if n != 3 {
+		t.Errorf("expected 3 copied rows, got %d", n)
+	}
+}
+
+func TestTableCopy_Errors(t *testing.T) {
+	db, path := sourceDB(t)
+	base := types.Config{SessionSecret: "test-secret"}
+
+	tests := []struct {
+		name    string
+		config  types.Config
+		form    url.Values
+		message string
+	}{
+		{"no source", base, url.Values{}, "source_table or query is required"},
+		{"same table", base, url.Values{"source_table": {"customers"}}, "source and target are the same table"},
+		{"query needs target", base, url.Values{"query": {"SELECT 1"}}, "target_table is required"},
+		{"writing query", base, url.Values{"query": {"DELETE FROM customers"}, "target_table": {"x"}}, "copy failed: the source query must be a single read-only statement"},
+		{"stacked writing query", base, url.Values{"query": {"SELECT 1; DROP TABLE customers"}, "target_table": {"x"}}, "copy failed: the source query must be a single read-only statement"},
+		{"missing table", base, url.Values{"source_table": {"nope"}, "target_table": {"x"}}, "copy failed: failed to read source table: table not found: nope"},
+		{"bad mode", base, url.Values{"source_table": {"customers"}, "target_table": {"x"}, "mode": {"merge"}}, "copy failed: unsupported copy mode: merge"},
+		{"ad-hoc disabled", base, url.Values{"source_table": {"customers"}, "target_driver": {"sqlite"}, "target_dsn": {"other.db"}}, "ad-hoc connections are disabled"},
+		{"read-only", types.Config{SessionSecret: "test-secret", ReadOnlyMode: true}, url.Values{"source_table": {"customers"}, "target_table": {"x"}}, "write operations are not allowed in read-only mode"},
+		{"safe mode", types.Config{SessionSecret: "test-secret", SafeModeDefault: true}, url.Values{"source_table": {"customers"}, "target_table": {"x"}}, "confirmation required (set confirm=yes)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response := copyTable(t, tt.config, path, tt.form)
+			if response.Status != "error" || response.Message != tt.message {
+				t.Errorf("expected error %q, got %s: %s", tt.message, response.Status, response.Message)
+			}
+		})
+	}
+
+	var count int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM customers`).Scan(&count); err != nil || count != 3 {
+		t.Errorf("the source must be left alone, got %d rows, %v", count, err)
+	}
+}
+
+func TestTableCopy_Async(t *testing.T) {
+	_, sourcePath := sourceDB(t)
+	targetDB, targetPath := createDB(t)
+
+	response := copyTable(t, adHoc, sourcePath, url.Values{
+		"source_table":  {"customers"},
+		"target_driver": {"sqlite"},
+		"target_dsn":    {targetPath},
+		"target_table":  {"clients"},
+		"async":         {"yes"},
+	})
+	if response.Status != "success" || response.Data.JobID == "" {
+		t.Fatalf("unexpected response: %+v", response)
+	}
+
+	var progress struct {
+		Data struct {
+			Job struct {
+				State  string     `json:"state"`
+				Result copyResult `json:"result"`
+			} `json:"job"`
+		} `json:"data"`
+	}
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(20 * time.Millisecond) {
+		req := httptest.NewRequest(http.MethodGet, "/?job_id="+response.Data.JobID, nil)
+		req.AddCookie(testutil.SessionCookie(t, sourcePath))
+		w := httptest.NewRecorder()
+		api_job_status.New(types.Config{SessionSecret: "test-secret"}, runner).Handle(w, req)
+		if err := json.Unmarshal(w.Body.Bytes(), &progress); err != nil {
+			t.Fatalf("failed to decode progress %q: %v", w.Body.String(), err)
+		}
+		if state := progress.Data.Job.State; state != jobs.StateQueued && state != jobs.StateRunning {
+			break
+		}
+	}
+
+	job := progress.Data.Job
+	if job.State != jobs.StateDone || !job.Result.Committed || job.Result.Copied != 3 {
+		t.Fatalf("unexpected job status: %+v", job)
+	}
+	var n int
+	targetDB.QueryRow(`SELECT COUNT(*) FROM clients`).Scan(&n)
+	if n != 3 {
+		t.Errorf("expected 3 copied rows, got %d", n)
+	}
+}
@@ -1,12 +1,13 @@
 package api_table_create
 
 import (
-	"database/sql"
 	"fmt"
 	"net/http"
 	"strings"
 
 	"github.com/dracory/api"
+	"github.com/dracory/weebase/shared/driver"
+	"github.com/dracory/weebase/shared/migrations"
 	"github.com/dracory/weebase/shared/session"
 	"github.com/dracory/weebase/shared/types"
 )
@@ -26,7 +27,9 @@ func New(config types.Config, safeModeDefault bool) *TableCreate {
 	}
 }
 
-// Handle validates, builds SQL, and executes table creation
+// Handle validates, builds SQL, and executes table creation.
+// With migration=yes the executed DDL is also captured as a migration
+// (format from migration_format or the configured default).
 func (tc *TableCreate) Handle(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		api.Respond(w, r, api.Error("method not allowed"))
@@ -71,8 +74,18 @@ func (tc *TableCreate) Handle(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	captureMigration := r.Form.Get("migration") == "yes"
+	migrationFormat := strings.TrimSpace(r.Form.Get("migration_format"))
+	if migrationFormat == "" {
+		migrationFormat = tc.config.MigrationsFormat
+	}
+	if captureMigration && migrationFormat != "" && !migrations.ValidFormat(migrationFormat) {
+		api.Respond(w, r, api.Error("unsupported migration format"))
+		return
+	}
+
 	// Open database connection
-	db, err := sql.Open(sess.Conn.Driver, sess.Conn.DSN)
+	db, err := driver.OpenSQLDB(sess.Conn.Driver, sess.Conn.DSN)
 	if err != nil {
 		api.Respond(w, r, api.Error(fmt.Sprintf("failed to connect to database: %v", err)))
 		return
@@ -80,8 +93,8 @@ func (tc *TableCreate) Handle(w http.ResponseWriter, r *http.Request) {
 	defer db.Close()
 
 	// Build the SQL statement
-	driver := normalizeDriver(sess.Conn.Driver)
-	stmt, errMsg := buildSQL(driver, schema, table, names, types, lens, nullable, pkset, aiset)
+	drv := normalizeDriver(sess.Conn.Driver)
+	stmt, errMsg := BuildSQL(drv, schema, table, names, types, lens, nullable, pkset, aiset)
 	if errMsg != "" {
 		api.Respond(w, r, api.Error(errMsg))
 		return
@@ -94,16 +107,32 @@ func (tc *TableCreate) Handle(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Return success response with the executed SQL
-	api.Respond(w, r, api.SuccessWithData("created", map[string]any{
+	data := map[string]any{
 		"sql":     stmt,
 		"table":   table,
 		"schema":  schema,
 		"message": "Table created successfully",
-	}))
+	}
+
+	// The table exists at this point, so a capture failure is reported
+	// alongside the success rather than as an error
+	if captureMigration {
+		migration, err := migrations.Capture(tc.config.MigrationsDir, migrationFormat, drv, "create_"+table, []string{stmt}, nil)
+		if err != nil {
+			data["migration_error"] = err.Error()
+		} else {
+			data["migration"] = migration
+		}
+	}
+
+	// Return success response with the executed SQL
+	api.Respond(w, r, api.SuccessWithData("created", data))
 }
 
-func buildSQL(driver, schema, table string, names, types, lens []string, nullable, pkset, aiset map[string]bool) (string, string) {
+// BuildSQL renders the CREATE TABLE statement for the column form fields.
+// The nullable, primary key and auto increment sets hold 1-based column
+// positions. The second result is an error message, empty on success.
+func BuildSQL(driver, schema, table string, names, types, lens []string, nullable, pkset, aiset map[string]bool) (string, string) {
 	var defs []string
 	var pks []string
 	for i := range names {
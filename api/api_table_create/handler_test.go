@@ -7,12 +7,15 @@ import (
 	"net/http/httptest"
 	"net/url"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 	"time"
 
 	"github.com/dracory/weebase/api/api_table_create"
+	"github.com/dracory/weebase/shared/migrations"
 	"github.com/dracory/weebase/shared/session"
+	"github.com/dracory/weebase/shared/testutil"
 	"github.com/dracory/weebase/shared/types"
 	_ "github.com/mattn/go-sqlite3"
 )
@@ -215,3 +218,66 @@ func TestTableCreate_Handle(t *testing.T) {
 		}
 	})
 }
+
+func TestTableCreate_Migration(t *testing.T) {
+	db, dbPath := setupTestDB(t)
+	defer os.Remove(dbPath)
+	defer db.Close()
+
+	dir := t.TempDir()
+	handler := api_table_create.New(types.Config{SessionSecret: "test-secret", MigrationsDir: dir}, false)
+
+	form := url.Values{
+		"table":        {"orders"},
+		"col_name[]":   {"id", "total"},
+		"col_type[]":   {"INTEGER", "REAL"},
+		"col_length[]": {"", ""},
+		"col_pk[]":     {"1"},
+		"migration":    {"yes"},
+	}
+	req := httptest.NewRequest("POST", "/tables", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.AddCookie(testutil.SessionCookie(t, dbPath))
+	w := httptest.NewRecorder()
+	handler.Handle(w, req)
+
+	var response struct {
+		Status string `json:"status"`
+		Data   struct {
+			SQL       string            `json:"sql"`
+			Migration migrations.Result `json:"migration"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("failed to parse response: %v", err)
+	}
+	if response.Status != "success" || response.Data.SQL == "" {
+		t.Fatalf("unexpected response: %s", w.Body.String())
+	}
+
+	migration := response.Data.Migration
+	wantDown, _ := migrations.DeriveDown("sqlite", []string{response.Data.SQL})
+	if len(migration.Up) != 1 || migration.Up[0] != response.Data.SQL {
+		t.Errorf("expected the executed statement as the up migration, got %q", migration.Up)
+	}
+	if len(migration.Down) != 1 || migration.Down[0] != wantDown[0] || migration.Down[0] != "DROP TABLE `orders`" || !migration.DownComplete {
+		t.Errorf("expected the table to be dropped by the down migration, got %q", migration.Down)
+	}
+	if !migration.Written || len(migration.Files) != 2 {
+		t.Fatalf("expected up and down files written to the migrations directory, got %+v", migration.Files)
+	}
+
+	for _, file := range migration.Files {
+		content, err := os.ReadFile(filepath.Join(dir, file.Name))
+		if err != nil {
+			t.Fatalf("failed to read %s: %v", file.Name, err)
+		}
+		want := migration.Up[0]
+		if strings.HasSuffix(file.Name, ".down.sql") {
+			want = migration.Down[0]
+		}
+		if !strings.Contains(string(content), want+";") {
+			t.Errorf("%s: expected %q, got %q", file.Name, want, content)
+		}
+	}
+}
@@ -8,6 +8,8 @@ import (
 	"strings"
 
 	"github.com/dracory/api"
+	"github.com/dracory/weebase/shared/driver"
+	"github.com/dracory/weebase/shared/introspect"
 	"github.com/dracory/weebase/shared/session"
 	"github.com/dracory/weebase/shared/types"
 )
@@ -30,6 +32,13 @@ type Column struct {
 	DataType      string `json:"data_type"`
 	IsNullable    string `json:"is_nullable"`
 	ColumnDefault any    `json:"column_default"`
+
+	// UDTName is the underlying PostgreSQL type name (e.g. "mood", "_int4")
+	UDTName string `json:"udt_name,omitempty"`
+	// DomainName is set when the column is declared with a PostgreSQL domain
+	DomainName string `json:"domain_name,omitempty"`
+	// EnumValues lists the allowed labels when the column is a PostgreSQL enum
+	EnumValues []string `json:"enum_values,omitempty"`
 }
 
 // Handle processes the request for table information
@@ -39,7 +48,7 @@ func (h *TableInfo) Handle(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	sess := session.EnsureSession(nil, nil, h.config.SessionSecret)
+	sess := session.EnsureSession(w, r, h.config.SessionSecret)
 	if sess == nil || sess.Conn == nil {
 		api.Respond(w, r, api.Error("not connected to database"))
 		return
@@ -64,7 +73,7 @@ func (h *TableInfo) Handle(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Open database connection
-	db, err := sql.Open(sess.Conn.Driver, sess.Conn.DSN)
+	db, err := driver.OpenSQLDB(sess.Conn.Driver, sess.Conn.DSN)
 	if err != nil {
 		api.Respond(w, r, api.Error(fmt.Sprintf("failed to connect to database: %v", err)))
 		return
@@ -72,10 +81,10 @@ func (h *TableInfo) Handle(w http.ResponseWriter, r *http.Request) {
 	defer db.Close()
 
 	// Get table information based on database type
-	driver := normalizeDriver(sess.Conn.Driver)
+	drv := normalizeDriver(sess.Conn.Driver)
 	var columns []Column
 
-	switch driver {
+	switch drv {
 	case "postgres":
 		columns, err = h.handlePostgres(db, schema, table)
 	case "mysql":
@@ -98,12 +107,26 @@ func (h *TableInfo) Handle(w http.ResponseWriter, r *http.Request) {
 		"columns":    columns,
 		"table":      table,
 		"schema":     schema,
-		"driver":     driver,
+		"driver":     drv,
 		"row_count":  len(columns),
 	}))
 }
 
-// handlePostgres handles PostgreSQL table info
+// resolveDataType names USER-DEFINED columns by their udt_name and ARRAY
+// columns by their element type, which PostgreSQL prefixes with "_"
+func resolveDataType(dataType, udtName string) string {
+	switch dataType {
+	case "USER-DEFINED":
+		return udtName
+	case "ARRAY":
+		return strings.TrimPrefix(udtName, "_") + "[]"
+	}
+	return dataType
+}
+
+// handlePostgres handles PostgreSQL table info.
+// USER-DEFINED and ARRAY columns are resolved through udt_name, and enum
+// columns carry their labels so the UI can offer a dropdown.
 func (h *TableInfo) handlePostgres(db *sql.DB, schema, table string) ([]Column, error) {
 	if schema == "" {
 		schema = "public"
@@ -112,9 +135,12 @@ func (h *TableInfo) handlePostgres(db *sql.DB, schema, table string) ([]Column,
 	query := `
 		SELECT 
 			column_name, 
-			data_type, 
+			data_type,
 			is_nullable, 
-			column_default
+			column_default,
+			udt_schema,
+			udt_name,
+			COALESCE(domain_name, '')
 		FROM information_schema.columns 
 		WHERE table_schema = $1 AND table_name = $2 
 		ORDER BY ordinal_position`
@@ -126,16 +152,25 @@ func (h *TableInfo) handlePostgres(db *sql.DB, schema, table string) ([]Column,
 	defer rows.Close()
 
 	var columns []Column
+	udtSchemas := map[int]string{}
 	for rows.Next() {
-		var col Column
+		var (
+			col       Column
+			udtSchema string
+		)
 		if err := rows.Scan(
 			&col.Name,
 			&col.DataType,
 			&col.IsNullable,
 			&col.ColumnDefault,
+			&udtSchema,
+			&col.UDTName,
+			&col.DomainName,
 		); err != nil {
 			return nil, fmt.Errorf("scan failed: %v", err)
 		}
+		col.DataType = resolveDataType(col.DataType, col.UDTName)
+		udtSchemas[len(columns)] = udtSchema
 		columns = append(columns, col)
 	}
 
@@ -143,9 +178,41 @@ func (h *TableInfo) handlePostgres(db *sql.DB, schema, table string) ([]Column,
 		return nil, fmt.Errorf("rows error: %v", err)
 	}
 
+	err = attachEnumValues(columns, udtSchemas, func(schema string) ([]introspect.EnumType, error) {
+		return introspect.PostgresEnums(context.Background(), db, schema)
+	})
+	if err != nil {
+		return nil, err
+	}
+
 	return columns, nil
 }
 
+// attachEnumValues sets the labels of the enum columns, by the udt_name
+// and udt_schema of each column, loading each referenced schema's enums
+// once. Built-in types in pg_catalog are never enums.
+func attachEnumValues(columns []Column, udtSchemas map[int]string, load func(schema string) ([]introspect.EnumType, error)) error {
+	enumsBySchema := map[string]map[string][]string{}
+	for i := range columns {
+		udtSchema := udtSchemas[i]
+		if udtSchema == "pg_catalog" {
+			continue
+		}
+		if _, ok := enumsBySchema[udtSchema]; !ok {
+			enums, err := load(udtSchema)
+			if err != nil {
+				return err
+			}
+			enumsBySchema[udtSchema] = map[string][]string{}
+			for _, e := range enums {
+				enumsBySchema[udtSchema][e.Name] = e.Labels
+			}
+		}
+		columns[i].EnumValues = enumsBySchema[udtSchema][columns[i].UDTName]
+	}
+	return nil
+}
+
 // handleMySQL handles MySQL table info
 func (h *TableInfo) handleMySQL(db *sql.DB, schema, table string) ([]Column, error) {
 	if schema == "" {
@@ -0,0 +1,67 @@
+package api_table_info
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/dracory/weebase/shared/introspect"
+)
+
+func TestResolveDataType(t *testing.T) {
+	tests := []struct {
+		dataType, udtName, want string
+	}{
+		{"integer", "int4", "integer"},
+		{"character varying", "varchar", "character varying"},
+		{"USER-DEFINED", "mood", "mood"},
+		{"USER-DEFINED", "geometry", "geometry"},
+		{"ARRAY", "_int4", "int4[]"},
+		{"ARRAY", "_mood", "mood[]"},
+		// an array of a type whose own name starts with "_"
+		{"ARRAY", "__tag", "_tag[]"},
+	}
+	for _, tt := range tests {
+		if got := resolveDataType(tt.dataType, tt.udtName); got != tt.want {
+			t.Errorf("resolveDataType(%q, %q) = %q, want %q", tt.dataType, tt.udtName, got, tt.want)
+		}
+	}
+}
+
+func TestAttachEnumValues(t *testing.T) {
+	columns := []Column{
+		{Name: "id", DataType: "integer", UDTName: "int4"},
+		{Name: "mood", DataType: resolveDataType("USER-DEFINED", "mood"), UDTName: "mood"},
+		{Name: "level", DataType: resolveDataType("USER-DEFINED", "level"), UDTName: "level"},
+		{Name: "shape", DataType: resolveDataType("USER-DEFINED", "geometry"), UDTName: "geometry"},
+	}
+	udtSchemas := map[int]string{0: "pg_catalog", 1: "public", 2: "audit", 3: "public"}
+	enums := map[string][]introspect.EnumType{
+		"public": {{Schema: "public", Name: "mood", Labels: []string{"sad", "ok", "happy"}}},
+		// an enum of the same name in another schema must not be picked up
+		"audit": {{Schema: "audit", Name: "level", Labels: []string{"info", "warn"}}, {Schema: "audit", Name: "mood", Labels: []string{"x"}}},
+	}
+	loaded := map[string]int{}
+	err := attachEnumValues(columns, udtSchemas, func(schema string) ([]introspect.EnumType, error) {
+		loaded[schema]++
+		return enums[schema], nil
+	})
+	if err != nil {
+		t.Fatalf("attachEnumValues: %v", err)
+	}
+
+	want := map[string][]string{"mood": {"sad", "ok", "happy"}, "level": {"info", "warn"}}
+	for _, col := range columns {
+		if !reflect.DeepEqual(col.EnumValues, want[col.Name]) {
+			t.Errorf("%s: expected labels %v, got %v", col.Name, want[col.Name], col.EnumValues)
+		}
+	}
+	if !reflect.DeepEqual(loaded, map[string]int{"public": 1, "audit": 1}) {
+		t.Errorf("expected each user schema loaded once, got %v", loaded)
+	}
+
+	failing := func(string) ([]introspect.EnumType, error) { return nil, errors.New("permission denied") }
+	if err := attachEnumValues(columns, udtSchemas, failing); err == nil {
+		t.Error("expected the load error to be returned")
+	}
+}
@@ -2,12 +2,14 @@ package api_tables_list
 
 import (
 	"context"
-	"database/sql"
 	"fmt"
 	"net/http"
 	"strings"
 
 	"github.com/dracory/api"
+	"github.com/dracory/weebase/shared/constants"
+	"github.com/dracory/weebase/shared/driver"
+	"github.com/dracory/weebase/shared/introspect"
 	"github.com/dracory/weebase/shared/session"
 	"github.com/dracory/weebase/shared/types"
 )
@@ -28,6 +30,10 @@ func New(cfg types.Config) *TablesList {
 	return &TablesList{config: cfg}
 }
 
+// Table is a listed database object together with its kind
+// (table, view, materialized_view, foreign_table or system)
+type Table = introspect.Object
+
 // Handle processes the request to list database tables
 // It supports multiple database backends including PostgreSQL, MySQL, SQLite, and SQL Server
 func (h *TablesList) Handle(w http.ResponseWriter, r *http.Request) {
@@ -43,7 +49,7 @@ func (h *TablesList) Handle(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Open database connection
-	db, err := sql.Open(sess.Conn.Driver, sess.Conn.DSN)
+	db, err := driver.OpenSQLDB(sess.Conn.Driver, sess.Conn.DSN)
 	if err != nil {
 		api.Respond(w, r, api.Error(fmt.Sprintf("failed to connect to database: %v", err)))
 		return
@@ -52,100 +58,42 @@ func (h *TablesList) Handle(w http.ResponseWriter, r *http.Request) {
 
 	// Get tables based on database type
 	driver := normalizeDriver(sess.Conn.Driver)
-	var tables []string
-
-	ctx := context.Background()
+	schema := strings.TrimSpace(r.URL.Query().Get("schema"))
+	includeSystem := r.URL.Query().Get("include_system") == "true"
 	switch driver {
-	case "postgres":
-		tables, err = listPostgresTables(ctx, db)
-	case "mysql":
-		tables, err = listMySQLTables(ctx, db)
-	case "sqlite":
-		tables, err = listSQLiteTables(ctx, db)
-	case "sqlserver":
-		tables, err = listSQLServerTables(ctx, db)
+	case "postgres", "mysql", "sqlite", "sqlserver":
 	default:
 		api.Respond(w, r, api.Error("unsupported database driver"))
 		return
 	}
 
+	tables, err := introspect.Objects(context.Background(), db, driver, schema)
 	if err != nil {
 		api.Respond(w, r, api.Error(fmt.Sprintf("error listing tables: %v", err)))
 		return
 	}
 
+	if !includeSystem {
+		tables = withoutSystem(tables)
+	}
+
 	api.Respond(w, r, api.SuccessWithData("tables_listed", map[string]any{
-		"tables":    tables,
-		"count":     len(tables),
-		"driver":    driver,
-		"message":   "Tables listed successfully",
+		"tables":  tables,
+		"count":   len(tables),
+		"driver":  driver,
+		"message": "Tables listed successfully",
 	}))
 }
 
-// listPostgresTables lists all tables in a PostgreSQL database
-func listPostgresTables(ctx context.Context, db *sql.DB) ([]string, error) {
-	query := `
-		SELECT table_name 
-		FROM information_schema.tables 
-		WHERE table_schema = 'public' 
-		ORDER BY table_name`
-
-	return queryStringList(ctx, db, query)
-}
-
-// listMySQLTables lists all tables in a MySQL database
-func listMySQLTables(ctx context.Context, db *sql.DB) ([]string, error) {
-	query := `SHOW TABLES`
-	return queryStringList(ctx, db, query)
-}
-
-// listSQLiteTables lists all tables in a SQLite database
-func listSQLiteTables(ctx context.Context, db *sql.DB) ([]string, error) {
-	query := `
-		SELECT name 
-		FROM sqlite_master 
-		WHERE type='table' 
-		AND name NOT LIKE 'sqlite_%' 
-		AND name != 'migrations' 
-		ORDER BY name`
-
-	return queryStringList(ctx, db, query)
-}
-
-// listSQLServerTables lists all tables in a SQL Server database
-func listSQLServerTables(ctx context.Context, db *sql.DB) ([]string, error) {
-	query := `
-		SELECT table_name 
-		FROM information_schema.tables 
-		WHERE table_type = 'BASE TABLE' 
-		AND table_catalog = DB_NAME()
-		ORDER BY table_name`
-
-	return queryStringList(ctx, db, query)
-}
-
-// queryStringList executes a query that returns a single column of strings
-func queryStringList(ctx context.Context, db *sql.DB, query string, args ...interface{}) ([]string, error) {
-	rows, err := db.QueryContext(ctx, query, args...)
-	if err != nil {
-		return nil, fmt.Errorf("query failed: %v", err)
-	}
-	defer rows.Close()
-
-	var result []string
-	for rows.Next() {
-		var name string
-		if err := rows.Scan(&name); err != nil {
-			return nil, fmt.Errorf("scan failed: %v", err)
+// withoutSystem filters out objects of the system kind
+func withoutSystem(tables []Table) []Table {
+	out := make([]Table, 0, len(tables))
+	for _, t := range tables {
+		if t.Kind != constants.ObjectKindSystem {
+			out = append(out, t)
 		}
-		result = append(result, name)
 	}
-
-	if err = rows.Err(); err != nil {
-		return nil, fmt.Errorf("rows error: %v", err)
-	}
-
-	return result, nil
+	return out
 }
 
 // normalizeDriver normalizes the database driver name
@@ -32,6 +32,7 @@ func setupTestDB(t *testing.T) (*sql.DB, string) {
 	_, err = db.Exec(`
 		CREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT);
 		CREATE TABLE products (id INTEGER PRIMARY KEY, name TEXT, price REAL);
+		CREATE VIEW cheap_products AS SELECT * FROM products WHERE price < 10;
 	`)
 	if err != nil {
 		t.Fatalf("failed to create test tables: %v", err)
@@ -101,11 +102,24 @@ func TestTablesList_Handle(t *testing.T) {
 		}
 
 		// Check if tables are in the response
-		_, ok := response.Data["tables"].([]interface{})
+		tables, ok := response.Data["tables"].([]interface{})
 		if !ok {
 			t.Fatal("invalid response format: tables not found")
 		}
 
+		// Check that each object carries its kind
+		kinds := map[string]string{}
+		for _, item := range tables {
+			obj := item.(map[string]interface{})
+			kinds[obj["name"].(string)] = obj["kind"].(string)
+		}
+		if kinds["users"] != "table" || kinds["products"] != "table" {
+			t.Errorf("expected users and products to be tables, got %v", kinds)
+		}
+		if kinds["cheap_products"] != "view" {
+			t.Errorf("expected cheap_products to be a view, got %v", kinds)
+		}
+
 		// Check additional response fields
 		if response.Data["driver"].(string) != "sqlite" {
 			t.Errorf("expected driver=sqlite, got %v", response.Data["driver"])
@@ -0,0 +1,143 @@
+package api_token_create
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/dracory/api"
+	"github.com/dracory/weebase/shared/apitoken"
+	"github.com/dracory/weebase/shared/auth"
+	"github.com/dracory/weebase/shared/session"
+	"github.com/dracory/weebase/shared/types"
+)
+
+// TokenCreate creates a personal API token of the operator
+type TokenCreate struct {
+	config types.Config
+}
+
+// New creates a new TokenCreate handler
+func New(config types.Config) *TokenCreate {
+	return &TokenCreate{config: config}
+}
+
+// Handle processes the request. "name" labels the token, "roles" and
+// "profiles" (repeatable) narrow it to some of the operator's roles and
+// some connection profiles, and "expires_at" (RFC 3339, or a date the
+// token stays valid through) ends it, within the maximum lifetime it
+// defaults to. The secret is returned this once.
+func (h *TokenCreate) Handle(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		api.Respond(w, r, api.Error("token_create must be POST"))
+		return
+	}
+
+	user, err := apitoken.Owner(r.Context())
+	if err != nil {
+		api.Respond(w, r, api.Error(err.Error()))
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		api.Respond(w, r, api.Error("failed to parse form"))
+		return
+	}
+
+	sess := session.EnsureSession(w, r, h.config.SessionSecret)
+	if token := r.Form.Get("csrf_token"); token == "" || token != sess.CSRFToken {
+		api.Respond(w, r, api.Error("invalid or missing CSRF token"))
+		return
+	}
+
+	name := strings.TrimSpace(r.Form.Get("name"))
+	if name == "" {
+		api.Respond(w, r, api.Error("name is required"))
+		return
+	}
+	roles, profiles := values(r.Form["roles"]), values(r.Form["profiles"])
+	if err := h.checkScope(user, roles, profiles); err != nil {
+		api.Respond(w, r, api.Error(err.Error()))
+		return
+	}
+	expiresAt, err := parseExpiry(r.Form.Get("expires_at"), apitoken.MaxLifetime(h.config.APITokenMaxLifetime))
+	if err != nil {
+		api.Respond(w, r, api.Error("invalid expires_at: "+err.Error()))
+		return
+	}
+
+	token, secret := apitoken.New(user.Name, name, roles, profiles, user.Roles, expiresAt)
+	if err := h.config.APITokens.Add(r.Context(), token); err != nil {
+		api.Respond(w, r, api.Error("failed to save API token: "+err.Error()))
+		return
+	}
+	api.Respond(w, r, api.SuccessWithData("token created", map[string]any{
+		"token":  token,
+		"secret": secret,
+	}))
+}
+
+// checkScope makes sure the token is narrowed to roles the operator holds
+// and to profiles the policy defines
+func (h *TokenCreate) checkScope(user auth.User, roles, profiles []string) error {
+	policy := h.config.Policy
+	if policy == nil {
+		if len(roles) > 0 || len(profiles) > 0 {
+			return errors.New("roles and profiles need an RBAC policy")
+		}
+		return nil
+	}
+	held := policy.RolesOf(user)
+	for _, role := range roles {
+		if !slices.Contains(held, role) {
+			return errors.New("you don't hold role " + role)
+		}
+	}
+	for _, profile := range profiles {
+		if _, ok := policy.Profiles[profile]; !ok {
+			return errors.New("unknown profile " + profile)
+		}
+	}
+	return nil
+}
+
+// values trims the form values, leaving out empty and repeated ones
+func values(in []string) []string {
+	var out []string
+	for _, v := range in {
+		if v = strings.TrimSpace(v); v != "" && !slices.Contains(out, v) {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// parseExpiry reads an RFC 3339 time or a date, which the token stays
+// valid through, no further away than maxLifetime; the expiry is
+// maxLifetime from now when s is empty
+func parseExpiry(s string, maxLifetime time.Duration) (*time.Time, error) {
+	now := time.Now()
+	latest := now.Add(maxLifetime).UTC()
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return &latest, nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		if t, err = time.Parse(time.DateOnly, s); err != nil {
+			return nil, err
+		}
+		t = t.Add(24 * time.Hour)
+	}
+	if !t.After(now) {
+		return nil, errors.New("must be in the future")
+	}
+	if t.After(latest) {
+		return nil, fmt.Errorf("tokens last at most %d days", int(maxLifetime/(24*time.Hour)))
+	}
+	t = t.UTC()
+	return &t, nil
+}
@@ -0,0 +1,58 @@
+package api_token_revoke
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/dracory/api"
+	"github.com/dracory/weebase/shared/apitoken"
+	"github.com/dracory/weebase/shared/session"
+	"github.com/dracory/weebase/shared/types"
+)
+
+// TokenRevoke revokes a personal API token of the operator
+type TokenRevoke struct {
+	config types.Config
+}
+
+// New creates a new TokenRevoke handler
+func New(config types.Config) *TokenRevoke {
+	return &TokenRevoke{config: config}
+}
+
+// Handle processes the request; "id" names the token
+func (h *TokenRevoke) Handle(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		api.Respond(w, r, api.Error("token_revoke must be POST"))
+		return
+	}
+
+	user, err := apitoken.Owner(r.Context())
+	if err != nil {
+		api.Respond(w, r, api.Error(err.Error()))
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		api.Respond(w, r, api.Error("failed to parse form"))
+		return
+	}
+
+	sess := session.EnsureSession(w, r, h.config.SessionSecret)
+	if token := r.Form.Get("csrf_token"); token == "" || token != sess.CSRFToken {
+		api.Respond(w, r, api.Error("invalid or missing CSRF token"))
+		return
+	}
+
+	err = h.config.APITokens.Delete(r.Context(), user.Name, strings.TrimSpace(r.Form.Get("id")))
+	if errors.Is(err, apitoken.ErrNotFound) {
+		api.Respond(w, r, api.Error(err.Error()))
+		return
+	}
+	if err != nil {
+		api.Respond(w, r, api.Error("failed to revoke API token: "+err.Error()))
+		return
+	}
+	api.Respond(w, r, api.Success("token revoked"))
+}
@@ -0,0 +1,60 @@
+package api_tokens_list
+
+import (
+	"net/http"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/dracory/api"
+	"github.com/dracory/weebase/shared/apitoken"
+	"github.com/dracory/weebase/shared/types"
+)
+
+// TokensList lists the personal API tokens of the operator
+type TokensList struct {
+	config types.Config
+}
+
+// New creates a new TokensList handler
+func New(config types.Config) *TokensList {
+	return &TokensList{config: config}
+}
+
+// Handle processes the request. Besides the tokens it returns the roles
+// and profiles a new token may be narrowed to, empty without an RBAC
+// policy, and the most days a new token may last.
+func (h *TokensList) Handle(w http.ResponseWriter, r *http.Request) {
+	user, err := apitoken.Owner(r.Context())
+	if err != nil {
+		api.Respond(w, r, api.Error(err.Error()))
+		return
+	}
+
+	tokens, err := h.config.APITokens.List(r.Context(), user.Name)
+	if err != nil {
+		api.Respond(w, r, api.Error("failed to list API tokens: "+err.Error()))
+		return
+	}
+
+	roles, profiles := []string{}, []string{}
+	if policy := h.config.Policy; policy != nil {
+		for _, role := range policy.RolesOf(user) {
+			if !slices.Contains(roles, role) {
+				roles = append(roles, role)
+			}
+		}
+		for name := range policy.Profiles {
+			profiles = append(profiles, name)
+		}
+		sort.Strings(roles)
+		sort.Strings(profiles)
+	}
+
+	api.Respond(w, r, api.SuccessWithData("tokens listed", map[string]any{
+		"tokens":   tokens,
+		"roles":    roles,
+		"profiles": profiles,
+		"max_days": int(apitoken.MaxLifetime(h.config.APITokenMaxLifetime) / (24 * time.Hour)),
+	}))
+}
@@ -0,0 +1,85 @@
+package api_types_list
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/dracory/api"
+	"github.com/dracory/weebase/shared/constants"
+	"github.com/dracory/weebase/shared/dialect"
+	"github.com/dracory/weebase/shared/driver"
+	"github.com/dracory/weebase/shared/introspect"
+	"github.com/dracory/weebase/shared/session"
+	"github.com/dracory/weebase/shared/types"
+)
+
+// TypesList lists PostgreSQL user-defined types: enums, composites and domains
+type TypesList struct {
+	config types.Config
+}
+
+// New creates a new TypesList handler
+func New(config types.Config) *TypesList {
+	return &TypesList{config: config}
+}
+
+// Handle processes the request to list user-defined types
+func (h *TypesList) Handle(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		api.Respond(w, r, api.Error("method not allowed"))
+		return
+	}
+
+	sess := session.EnsureSession(w, r, h.config.SessionSecret)
+	if sess == nil || sess.Conn == nil {
+		api.Respond(w, r, api.Error("not connected to database"))
+		return
+	}
+
+	if dialect.Normalize(sess.Conn.Driver) != constants.DriverPostgres {
+		api.Respond(w, r, api.Error("user-defined types are only supported on PostgreSQL"))
+		return
+	}
+
+	schema := strings.TrimSpace(r.URL.Query().Get("schema"))
+	if schema == "" {
+		schema = "public"
+	}
+	if !dialect.SanitizeIdent(schema) {
+		api.Respond(w, r, api.Error("invalid schema name"))
+		return
+	}
+
+	db, err := driver.OpenSQLDB(sess.Conn.Driver, sess.Conn.DSN)
+	if err != nil {
+		api.Respond(w, r, api.Error(fmt.Sprintf("failed to connect to database: %v", err)))
+		return
+	}
+	defer db.Close()
+
+	enums, err := introspect.PostgresEnums(r.Context(), db, schema)
+	if err != nil {
+		api.Respond(w, r, api.Error(fmt.Sprintf("error listing enum types: %v", err)))
+		return
+	}
+
+	composites, err := introspect.PostgresComposites(r.Context(), db, schema)
+	if err != nil {
+		api.Respond(w, r, api.Error(fmt.Sprintf("error listing composite types: %v", err)))
+		return
+	}
+
+	domains, err := introspect.PostgresDomains(r.Context(), db, schema)
+	if err != nil {
+		api.Respond(w, r, api.Error(fmt.Sprintf("error listing domains: %v", err)))
+		return
+	}
+
+	api.Respond(w, r, api.SuccessWithData("types_listed", map[string]any{
+		"enums":      enums,
+		"composites": composites,
+		"domains":    domains,
+		"schema":     schema,
+	}))
+}
@@ -0,0 +1,152 @@
+package api_view_create
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/dracory/api"
+	"github.com/dracory/weebase/shared/audit"
+	"github.com/dracory/weebase/shared/constants"
+	"github.com/dracory/weebase/shared/dialect"
+	"github.com/dracory/weebase/shared/driver"
+	"github.com/dracory/weebase/shared/session"
+	"github.com/dracory/weebase/shared/sqlguard"
+	"github.com/dracory/weebase/shared/types"
+)
+
+// ViewCreate handles creating and replacing views
+type ViewCreate struct {
+	config types.Config
+}
+
+// New creates a new ViewCreate handler
+func New(config types.Config) *ViewCreate {
+	return &ViewCreate{config: config}
+}
+
+// Handle validates, builds SQL, and executes view creation
+func (h *ViewCreate) Handle(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		api.Respond(w, r, api.Error("method not allowed"))
+		return
+	}
+
+	sess := session.EnsureSession(w, r, h.config.SessionSecret)
+	if sess == nil || sess.Conn == nil {
+		api.Respond(w, r, api.Error("not connected to database"))
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		api.Respond(w, r, api.Error("failed to parse form"))
+		return
+	}
+
+	schema := strings.TrimSpace(r.Form.Get("schema"))
+	view := strings.TrimSpace(r.Form.Get("view"))
+	definition := strings.TrimRight(strings.TrimSpace(r.Form.Get("definition")), ";")
+	replace := r.Form.Get("replace") == "yes"
+	materialized := r.Form.Get("materialized") == "yes"
+
+	if view == "" || definition == "" {
+		api.Respond(w, r, api.Error("view and definition are required"))
+		return
+	}
+
+	if !dialect.SanitizeIdent(view) || (schema != "" && !dialect.SanitizeIdent(schema)) {
+		api.Respond(w, r, api.Error("invalid view or schema name"))
+		return
+	}
+
+	// the definition is spliced into CREATE VIEW, so it must be exactly one
+	// read-only statement, split as the database would
+	drv := dialect.Normalize(sess.Conn.Driver)
+	definition, err := sqlguard.SingleReadOnly(drv, definition)
+	lower := strings.ToLower(definition)
+	if err != nil || (!strings.HasPrefix(lower, "select") && !strings.HasPrefix(lower, "with")) {
+		api.Respond(w, r, api.Error("definition must be a single SELECT statement"))
+		return
+	}
+
+	// Check for confirmation in safe mode
+	if h.config.SafeModeDefault && strings.TrimSpace(r.Form.Get("confirm")) != "yes" {
+		api.Respond(w, r, api.Error("confirmation required (set confirm=yes)"))
+		return
+	}
+
+	stmts, err := BuildSQL(drv, schema, view, definition, replace, materialized)
+	if err != nil {
+		api.Respond(w, r, api.Error(err.Error()))
+		return
+	}
+
+	db, err := driver.OpenSQLDB(sess.Conn.Driver, sess.Conn.DSN)
+	if err != nil {
+		api.Respond(w, r, api.Error(fmt.Sprintf("failed to connect to database: %v", err)))
+		return
+	}
+	defer db.Close()
+
+	tx, err := db.BeginTx(r.Context(), nil)
+	if err != nil {
+		api.Respond(w, r, api.Error(fmt.Sprintf("failed to begin transaction: %v", err)))
+		return
+	}
+	audit.SetObject(r.Context(), schema, view)
+	for _, stmt := range stmts {
+		audit.AddSQL(r.Context(), stmt)
+		if _, err := tx.ExecContext(r.Context(), stmt); err != nil {
+			tx.Rollback()
+			api.Respond(w, r, api.Error(fmt.Sprintf("error creating view: %v", err)))
+			return
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		api.Respond(w, r, api.Error(fmt.Sprintf("failed to commit transaction: %v", err)))
+		return
+	}
+	audit.AddRowsAffected(r.Context(), 0)
+
+	api.Respond(w, r, api.SuccessWithData("created", map[string]any{
+		"sql":     strings.Join(stmts, ";\n"),
+		"view":    view,
+		"schema":  schema,
+		"message": "View saved successfully",
+	}))
+}
+
+// BuildSQL returns the statements that create (or replace) a view.
+// Dialects without CREATE OR REPLACE get a DROP IF EXISTS followed by CREATE.
+func BuildSQL(drv, schema, view, definition string, replace, materialized bool) ([]string, error) {
+	name := dialect.QualifiedName(drv, schema, view)
+
+	if materialized {
+		if drv != constants.DriverPostgres {
+			return nil, fmt.Errorf("materialized views are only supported on PostgreSQL")
+		}
+		stmts := []string{}
+		if replace {
+			stmts = append(stmts, "DROP MATERIALIZED VIEW IF EXISTS "+name)
+		}
+		return append(stmts, "CREATE MATERIALIZED VIEW "+name+" AS "+definition), nil
+	}
+
+	if !replace {
+		return []string{"CREATE VIEW " + name + " AS " + definition}, nil
+	}
+
+	switch drv {
+	case constants.DriverPostgres, constants.DriverMySQL:
+		return []string{"CREATE OR REPLACE VIEW " + name + " AS " + definition}, nil
+	case constants.DriverSQLServer:
+		return []string{"CREATE OR ALTER VIEW " + name + " AS " + definition}, nil
+	case constants.DriverSQLite:
+		return []string{
+			"DROP VIEW IF EXISTS " + name,
+			"CREATE VIEW " + name + " AS " + definition,
+		}, nil
+	default:
+		return nil, fmt.Errorf("unsupported database driver")
+	}
+}
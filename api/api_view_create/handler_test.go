@@ -0,0 +1,172 @@
+package api_view_create_test
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/dracory/weebase/api/api_view_create"
+	"github.com/dracory/weebase/shared/testutil"
+	"github.com/dracory/weebase/shared/types"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// setupTestDB creates a file-backed SQLite database with a products table
+func setupTestDB(t *testing.T) (*sql.DB, string) {
+	tempFile, err := os.CreateTemp("", "testdb-*.db")
+	if err != nil {
+		t.Fatalf("failed to create temp file: %v", err)
+	}
+	tempFile.Close()
+
+	db, err := sql.Open("sqlite3", tempFile.Name())
+	if err != nil {
+		t.Fatalf("failed to open SQLite database: %v", err)
+	}
+
+	if _, err := db.Exec(`CREATE TABLE products (id INTEGER PRIMARY KEY, name TEXT, price REAL)`); err != nil {
+		t.Fatalf("failed to create test table: %v", err)
+	}
+
+	return db, tempFile.Name()
+}
+
+func post(t *testing.T, handler *api_view_create.ViewCreate, cookie *http.Cookie, form url.Values) (string, string) {
+	req := httptest.NewRequest("POST", "/", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.AddCookie(cookie)
+	w := httptest.NewRecorder()
+	handler.Handle(w, req)
+
+	var response struct {
+		Status  string `json:"status"`
+		Message string `json:"message"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("failed to parse response: %v", err)
+	}
+	return response.Status, response.Message
+}
+
+func TestViewCreate_Handle(t *testing.T) {
+	t.Run("create and replace view", func(t *testing.T) {
+		db, dbPath := setupTestDB(t)
+		defer os.Remove(dbPath)
+		defer db.Close()
+
+		handler := api_view_create.New(types.Config{SessionSecret: "test-secret"})
+		cookie := testutil.SessionCookie(t, dbPath)
+
+		status, message := post(t, handler, cookie, url.Values{
+			"view":       {"cheap_products"},
+			"definition": {"SELECT * FROM products WHERE price < 10"},
+		})
+		if status != "success" {
+			t.Fatalf("expected success, got %s: %s", status, message)
+		}
+
+		status, message = post(t, handler, cookie, url.Values{
+			"view":       {"cheap_products"},
+			"definition": {"SELECT id, name FROM products WHERE price < 5"},
+			"replace":    {"yes"},
+		})
+		if status != "success" {
+			t.Fatalf("expected success on replace, got %s: %s", status, message)
+		}
+
+		var definition string
+		if err := db.QueryRow(`SELECT sql FROM sqlite_master WHERE type = 'view' AND name = 'cheap_products'`).Scan(&definition); err != nil {
+			t.Fatalf("failed to read view definition: %v", err)
+		}
+		if !strings.Contains(definition, "price < 5") {
+			t.Errorf("view was not replaced, definition: %s", definition)
+		}
+	})
+
+	t.Run("safe mode requires confirmation", func(t *testing.T) {
+		db, dbPath := setupTestDB(t)
+		defer os.Remove(dbPath)
+		defer db.Close()
+
+		handler := api_view_create.New(types.Config{SessionSecret: "test-secret", SafeModeDefault: true})
+		status, message := post(t, handler, testutil.SessionCookie(t, dbPath), url.Values{
+			"view":       {"cheap_products"},
+			"definition": {"SELECT * FROM products"},
+		})
+		if status != "error" || !strings.Contains(message, "confirmation required") {
+			t.Errorf("unexpected response: %s %s", status, message)
+		}
+	})
+
+	t.Run("rejects non-select definition", func(t *testing.T) {
+		db, dbPath := setupTestDB(t)
+		defer os.Remove(dbPath)
+		defer db.Close()
+
+		handler := api_view_create.New(types.Config{SessionSecret: "test-secret"})
+		status, message := post(t, handler, testutil.SessionCookie(t, dbPath), url.Values{
+			"view":       {"bad"},
+			"definition": {"DELETE FROM products"},
+		})
+		if status != "error" || message != "definition must be a single SELECT statement" {
+			t.Errorf("unexpected response: %s %s", status, message)
+		}
+	})
+
+	t.Run("rejects statements stacked after the select", func(t *testing.T) {
+		db, dbPath := setupTestDB(t)
+		defer os.Remove(dbPath)
+		defer db.Close()
+		db.Exec(`INSERT INTO products (name, price) VALUES ('pen', 2)`)
+
+		handler := api_view_create.New(types.Config{SessionSecret: "test-secret"})
+		for _, definition := range []string{
+			"SELECT * FROM products; DELETE FROM products",
+			"SELECT 'a;' AS x FROM products;\nDROP TABLE products;",
+			"WITH p AS (SELECT 1) SELECT * FROM p; UPDATE products SET price = 0",
+		} {
+			status, message := post(t, handler, testutil.SessionCookie(t, dbPath), url.Values{
+				"view":       {"stacked"},
+				"definition": {definition},
+			})
+			if status != "error" || message != "definition must be a single SELECT statement" {
+				t.Errorf("%q: unexpected response: %s %s", definition, status, message)
+			}
+		}
+
+		var n int
+		if err := db.QueryRow(`SELECT COUNT(*) FROM products WHERE price = 2`).Scan(&n); err != nil || n != 1 {
+			t.Errorf("expected the products to be left alone, got %d rows (%v)", n, err)
+		}
+	})
+
+	t.Run("accepts one select with a trailing semicolon", func(t *testing.T) {
+		db, dbPath := setupTestDB(t)
+		defer os.Remove(dbPath)
+		defer db.Close()
+
+		handler := api_view_create.New(types.Config{SessionSecret: "test-secret"})
+		status, message := post(t, handler, testutil.SessionCookie(t, dbPath), url.Values{
+			"view":       {"named"},
+			"definition": {"SELECT name FROM products WHERE name <> ';' ;"},
+		})
+		if status != "success" {
+			t.Errorf("expected success, got %s: %s", status, message)
+		}
+	})
+
+	t.Run("materialized views are postgres only", func(t *testing.T) {
+		if _, err := api_view_create.BuildSQL("sqlite", "", "v", "SELECT 1", false, true); err == nil {
+			t.Error("expected error for materialized view on sqlite")
+		}
+		stmts, err := api_view_create.BuildSQL("postgres", "public", "v", "SELECT 1", true, true)
+		if err != nil || len(stmts) != 2 || !strings.HasPrefix(stmts[1], "CREATE MATERIALIZED VIEW") {
+			t.Errorf("unexpected statements: %v %v", stmts, err)
+		}
+	})
+}
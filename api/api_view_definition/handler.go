@@ -0,0 +1,73 @@
+package api_view_definition
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/dracory/api"
+	"github.com/dracory/weebase/shared/dialect"
+	"github.com/dracory/weebase/shared/driver"
+	"github.com/dracory/weebase/shared/introspect"
+	"github.com/dracory/weebase/shared/session"
+	"github.com/dracory/weebase/shared/types"
+)
+
+// ViewDefinition returns the SELECT statement behind a view or materialized view
+type ViewDefinition struct {
+	config types.Config
+}
+
+// New creates a new ViewDefinition handler
+func New(config types.Config) *ViewDefinition {
+	return &ViewDefinition{config: config}
+}
+
+// Handle processes the request for a view definition
+func (h *ViewDefinition) Handle(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		api.Respond(w, r, api.Error("method not allowed"))
+		return
+	}
+
+	sess := session.EnsureSession(w, r, h.config.SessionSecret)
+	if sess == nil || sess.Conn == nil {
+		api.Respond(w, r, api.Error("not connected to database"))
+		return
+	}
+
+	schema := strings.TrimSpace(r.URL.Query().Get("schema"))
+	view := strings.TrimSpace(r.URL.Query().Get("view"))
+
+	if view == "" {
+		api.Respond(w, r, api.Error("view name is required"))
+		return
+	}
+
+	if !dialect.SanitizeIdent(view) || (schema != "" && !dialect.SanitizeIdent(schema)) {
+		api.Respond(w, r, api.Error("invalid view or schema name"))
+		return
+	}
+
+	db, err := driver.OpenSQLDB(sess.Conn.Driver, sess.Conn.DSN)
+	if err != nil {
+		api.Respond(w, r, api.Error(fmt.Sprintf("failed to connect to database: %v", err)))
+		return
+	}
+	defer db.Close()
+
+	drv := dialect.Normalize(sess.Conn.Driver)
+	definition, kind, err := introspect.ViewDefinition(r.Context(), db, drv, schema, view)
+	if err != nil {
+		api.Respond(w, r, api.Error(fmt.Sprintf("error getting view definition: %v", err)))
+		return
+	}
+
+	api.Respond(w, r, api.SuccessWithData("view_definition", map[string]any{
+		"view":       view,
+		"schema":     schema,
+		"kind":       kind,
+		"definition": definition,
+		"driver":     drv,
+	}))
+}
@@ -0,0 +1,78 @@
+package api_view_definition_test
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/dracory/weebase/api/api_view_definition"
+	"github.com/dracory/weebase/shared/testutil"
+	"github.com/dracory/weebase/shared/types"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func TestViewDefinition_Handle(t *testing.T) {
+	tempFile, err := os.CreateTemp("", "testdb-*.db")
+	if err != nil {
+		t.Fatalf("failed to create temp file: %v", err)
+	}
+	tempFile.Close()
+	defer os.Remove(tempFile.Name())
+
+	db, err := sql.Open("sqlite3", tempFile.Name())
+	if err != nil {
+		t.Fatalf("failed to open SQLite database: %v", err)
+	}
+	defer db.Close()
+	if _, err := db.Exec(`CREATE TABLE products (id INTEGER PRIMARY KEY, price REAL);
+		CREATE VIEW cheap_products AS SELECT id FROM products WHERE price < 10`); err != nil {
+		t.Fatalf("failed to create test view: %v", err)
+	}
+
+	handler := api_view_definition.New(types.Config{SessionSecret: "test-secret"})
+	get := func(query string) (status, message string, data map[string]any) {
+		req := httptest.NewRequest("GET", "/?"+query, nil)
+		req.AddCookie(testutil.SessionCookie(t, tempFile.Name()))
+		w := httptest.NewRecorder()
+		handler.Handle(w, req)
+
+		var response struct {
+			Status  string         `json:"status"`
+			Message string         `json:"message"`
+			Data    map[string]any `json:"data"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+			t.Fatalf("failed to parse response: %v", err)
+		}
+		return response.Status, response.Message, response.Data
+	}
+
+	t.Run("returns the definition", func(t *testing.T) {
+		status, message, data := get("view=cheap_products")
+		if status != "success" {
+			t.Fatalf("expected success, got %s: %s", status, message)
+		}
+		definition, _ := data["definition"].(string)
+		if !strings.Contains(definition, "price < 10") {
+			t.Errorf("unexpected definition: %q", definition)
+		}
+	})
+
+	t.Run("requires a valid view name", func(t *testing.T) {
+		if status, message, _ := get(""); status != "error" || message != "view name is required" {
+			t.Errorf("unexpected response: %s %s", status, message)
+		}
+		if status, message, _ := get("view=a%22b"); status != "error" || message != "invalid view or schema name" {
+			t.Errorf("unexpected response: %s %s", status, message)
+		}
+	})
+
+	t.Run("reports a missing view", func(t *testing.T) {
+		if status, _, _ := get("view=missing"); status != "error" {
+			t.Errorf("expected an error for a missing view, got %s", status)
+		}
+	})
+}
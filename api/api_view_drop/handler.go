@@ -0,0 +1,100 @@
+package api_view_drop
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/dracory/api"
+	"github.com/dracory/weebase/shared/audit"
+	"github.com/dracory/weebase/shared/constants"
+	"github.com/dracory/weebase/shared/dialect"
+	"github.com/dracory/weebase/shared/driver"
+	"github.com/dracory/weebase/shared/session"
+	"github.com/dracory/weebase/shared/types"
+)
+
+// ViewDrop handles dropping views and materialized views
+type ViewDrop struct {
+	config types.Config
+}
+
+// New creates a new ViewDrop handler
+func New(config types.Config) *ViewDrop {
+	return &ViewDrop{config: config}
+}
+
+// Handle processes the drop view request
+func (h *ViewDrop) Handle(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		api.Respond(w, r, api.Error("method not allowed"))
+		return
+	}
+
+	sess := session.EnsureSession(w, r, h.config.SessionSecret)
+	if sess == nil || sess.Conn == nil {
+		api.Respond(w, r, api.Error("not connected to database"))
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		api.Respond(w, r, api.Error("failed to parse form"))
+		return
+	}
+
+	schema := strings.TrimSpace(r.Form.Get("schema"))
+	view := strings.TrimSpace(r.Form.Get("view"))
+	materialized := r.Form.Get("materialized") == "yes"
+
+	if view == "" {
+		api.Respond(w, r, api.Error("view name is required"))
+		return
+	}
+
+	if !dialect.SanitizeIdent(view) || (schema != "" && !dialect.SanitizeIdent(schema)) {
+		api.Respond(w, r, api.Error("invalid view or schema name"))
+		return
+	}
+
+	// Check for confirmation in safe mode
+	if h.config.SafeModeDefault && strings.TrimSpace(r.Form.Get("confirm")) != "yes" {
+		api.Respond(w, r, api.Error("confirmation required (set confirm=yes)"))
+		return
+	}
+
+	drv := dialect.Normalize(sess.Conn.Driver)
+	if materialized && drv != constants.DriverPostgres {
+		api.Respond(w, r, api.Error("materialized views are only supported on PostgreSQL"))
+		return
+	}
+
+	stmt := "DROP VIEW IF EXISTS " + dialect.QualifiedName(drv, schema, view)
+	if materialized {
+		stmt = "DROP MATERIALIZED VIEW IF EXISTS " + dialect.QualifiedName(drv, schema, view)
+	}
+
+	db, err := driver.OpenSQLDB(sess.Conn.Driver, sess.Conn.DSN)
+	if err != nil {
+		api.Respond(w, r, api.Error(fmt.Sprintf("failed to connect to database: %v", err)))
+		return
+	}
+	defer db.Close()
+
+	audit.SetObject(r.Context(), schema, view)
+	audit.SetSQL(r.Context(), stmt)
+	result, err := db.ExecContext(r.Context(), stmt)
+	if err != nil {
+		api.Respond(w, r, api.Error(fmt.Sprintf("error dropping view: %v", err)))
+		return
+	}
+	if n, err := result.RowsAffected(); err == nil {
+		audit.AddRowsAffected(r.Context(), n)
+	}
+
+	api.Respond(w, r, api.SuccessWithData("dropped", map[string]any{
+		"sql":     stmt,
+		"view":    view,
+		"schema":  schema,
+		"message": "View dropped successfully",
+	}))
+}
@@ -0,0 +1,96 @@
+package api_view_drop_test
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/dracory/weebase/api/api_view_drop"
+	"github.com/dracory/weebase/shared/testutil"
+	"github.com/dracory/weebase/shared/types"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func TestViewDrop_Handle(t *testing.T) {
+	tempFile, err := os.CreateTemp("", "testdb-*.db")
+	if err != nil {
+		t.Fatalf("failed to create temp file: %v", err)
+	}
+	tempFile.Close()
+	defer os.Remove(tempFile.Name())
+
+	db, err := sql.Open("sqlite3", tempFile.Name())
+	if err != nil {
+		t.Fatalf("failed to open SQLite database: %v", err)
+	}
+	defer db.Close()
+	if _, err := db.Exec(`CREATE TABLE products (id INTEGER PRIMARY KEY, price REAL);
+		CREATE VIEW cheap_products AS SELECT id FROM products WHERE price < 10`); err != nil {
+		t.Fatalf("failed to create test view: %v", err)
+	}
+
+	viewExists := func() bool {
+		var n int
+		if err := db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'view' AND name = 'cheap_products'`).Scan(&n); err != nil {
+			t.Fatalf("failed to look up the view: %v", err)
+		}
+		return n == 1
+	}
+
+	post := func(handler *api_view_drop.ViewDrop, form url.Values) (string, string) {
+		req := httptest.NewRequest("POST", "/", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.AddCookie(testutil.SessionCookie(t, tempFile.Name()))
+		w := httptest.NewRecorder()
+		handler.Handle(w, req)
+
+		var response struct {
+			Status  string `json:"status"`
+			Message string `json:"message"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+			t.Fatalf("failed to parse response: %v", err)
+		}
+		return response.Status, response.Message
+	}
+
+	safe := api_view_drop.New(types.Config{SessionSecret: "test-secret", SafeModeDefault: true})
+
+	t.Run("safe mode requires confirmation", func(t *testing.T) {
+		status, message := post(safe, url.Values{"view": {"cheap_products"}})
+		if status != "error" || message != "confirmation required (set confirm=yes)" {
+			t.Errorf("unexpected response: %s %s", status, message)
+		}
+		if !viewExists() {
+			t.Error("expected the view to survive an unconfirmed drop")
+		}
+	})
+
+	t.Run("materialized is refused on sqlite", func(t *testing.T) {
+		status, message := post(safe, url.Values{"view": {"cheap_products"}, "materialized": {"yes"}, "confirm": {"yes"}})
+		if status != "error" || message != "materialized views are only supported on PostgreSQL" {
+			t.Errorf("unexpected response: %s %s", status, message)
+		}
+	})
+
+	t.Run("invalid name is refused", func(t *testing.T) {
+		status, message := post(safe, url.Values{"view": {"cheap; DROP TABLE products"}, "confirm": {"yes"}})
+		if status != "error" || message != "invalid view or schema name" {
+			t.Errorf("unexpected response: %s %s", status, message)
+		}
+	})
+
+	t.Run("drops the view", func(t *testing.T) {
+		status, message := post(safe, url.Values{"view": {"cheap_products"}, "confirm": {"yes"}})
+		if status != "success" {
+			t.Fatalf("expected success, got %s: %s", status, message)
+		}
+		if viewExists() {
+			t.Error("expected the view to be dropped")
+		}
+	})
+}
@@ -0,0 +1,105 @@
+package api_view_refresh
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/dracory/api"
+	"github.com/dracory/weebase/shared/audit"
+	"github.com/dracory/weebase/shared/constants"
+	"github.com/dracory/weebase/shared/dialect"
+	"github.com/dracory/weebase/shared/driver"
+	"github.com/dracory/weebase/shared/session"
+	"github.com/dracory/weebase/shared/types"
+)
+
+// ViewRefresh handles REFRESH MATERIALIZED VIEW on PostgreSQL
+type ViewRefresh struct {
+	config types.Config
+}
+
+// New creates a new ViewRefresh handler
+func New(config types.Config) *ViewRefresh {
+	return &ViewRefresh{config: config}
+}
+
+// Handle processes the refresh request
+func (h *ViewRefresh) Handle(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		api.Respond(w, r, api.Error("method not allowed"))
+		return
+	}
+
+	sess := session.EnsureSession(w, r, h.config.SessionSecret)
+	if sess == nil || sess.Conn == nil {
+		api.Respond(w, r, api.Error("not connected to database"))
+		return
+	}
+
+	if dialect.Normalize(sess.Conn.Driver) != constants.DriverPostgres {
+		api.Respond(w, r, api.Error("materialized views are only supported on PostgreSQL"))
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		api.Respond(w, r, api.Error("failed to parse form"))
+		return
+	}
+
+	schema := strings.TrimSpace(r.Form.Get("schema"))
+	view := strings.TrimSpace(r.Form.Get("view"))
+
+	if view == "" {
+		api.Respond(w, r, api.Error("view name is required"))
+		return
+	}
+
+	if !dialect.SanitizeIdent(view) || (schema != "" && !dialect.SanitizeIdent(schema)) {
+		api.Respond(w, r, api.Error("invalid view or schema name"))
+		return
+	}
+
+	// Check for confirmation in safe mode
+	if h.config.SafeModeDefault && strings.TrimSpace(r.Form.Get("confirm")) != "yes" {
+		api.Respond(w, r, api.Error("confirmation required (set confirm=yes)"))
+		return
+	}
+
+	stmt := statement(schema, view, r.Form.Get("concurrently") == "yes")
+
+	db, err := driver.OpenSQLDB(sess.Conn.Driver, sess.Conn.DSN)
+	if err != nil {
+		api.Respond(w, r, api.Error(fmt.Sprintf("failed to connect to database: %v", err)))
+		return
+	}
+	defer db.Close()
+
+	audit.SetObject(r.Context(), schema, view)
+	audit.SetSQL(r.Context(), stmt)
+	result, err := db.ExecContext(r.Context(), stmt)
+	if err != nil {
+		api.Respond(w, r, api.Error(fmt.Sprintf("error refreshing view: %v", err)))
+		return
+	}
+	if n, err := result.RowsAffected(); err == nil {
+		audit.AddRowsAffected(r.Context(), n)
+	}
+
+	api.Respond(w, r, api.SuccessWithData("refreshed", map[string]any{
+		"sql":     stmt,
+		"view":    view,
+		"schema":  schema,
+		"message": "Materialized view refreshed successfully",
+	}))
+}
+
+// statement builds the REFRESH MATERIALIZED VIEW statement
+func statement(schema, view string, concurrently bool) string {
+	stmt := "REFRESH MATERIALIZED VIEW "
+	if concurrently {
+		// Requires a unique index on the view; PostgreSQL reports it otherwise
+		stmt += "CONCURRENTLY "
+	}
+	return stmt + dialect.QualifiedName(constants.DriverPostgres, schema, view)
+}
@@ -0,0 +1,55 @@
+package api_view_refresh_test
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/dracory/weebase/api/api_view_refresh"
+	"github.com/dracory/weebase/shared/testutil"
+	"github.com/dracory/weebase/shared/types"
+)
+
+func TestViewRefresh_Handle(t *testing.T) {
+	tempFile, err := os.CreateTemp("", "testdb-*.db")
+	if err != nil {
+		t.Fatalf("failed to create temp file: %v", err)
+	}
+	tempFile.Close()
+	defer os.Remove(tempFile.Name())
+
+	handler := api_view_refresh.New(types.Config{SessionSecret: "test-secret"})
+
+	tests := []struct {
+		name    string
+		method  string
+		form    url.Values
+		message string
+	}{
+		{"get is refused", "GET", nil, "method not allowed"},
+		{"sqlite is refused", "POST", url.Values{"view": {"totals"}}, "materialized views are only supported on PostgreSQL"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/", strings.NewReader(tt.form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			req.AddCookie(testutil.SessionCookie(t, tempFile.Name()))
+			w := httptest.NewRecorder()
+			handler.Handle(w, req)
+
+			var response struct {
+				Status  string `json:"status"`
+				Message string `json:"message"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+				t.Fatalf("failed to parse response: %v", err)
+			}
+			if response.Status != "error" || response.Message != tt.message {
+				t.Errorf("unexpected response: %s %s", response.Status, response.Message)
+			}
+		})
+	}
+}
@@ -0,0 +1,20 @@
+package api_view_refresh
+
+import "testing"
+
+func TestStatement(t *testing.T) {
+	tests := []struct {
+		schema, view string
+		concurrently bool
+		want         string
+	}{
+		{"public", "totals", false, `REFRESH MATERIALIZED VIEW "public"."totals"`},
+		{"", "totals", false, `REFRESH MATERIALIZED VIEW "totals"`},
+		{"public", "totals", true, `REFRESH MATERIALIZED VIEW CONCURRENTLY "public"."totals"`},
+	}
+	for _, tt := range tests {
+		if got := statement(tt.schema, tt.view, tt.concurrently); got != tt.want {
+			t.Errorf("statement(%q, %q, %v) = %q, want %q", tt.schema, tt.view, tt.concurrently, got, tt.want)
+		}
+	}
+}
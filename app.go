@@ -3,19 +3,91 @@
 package weebase
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/dracory/api"
+	"github.com/dracory/weebase/api/api_audit_search"
+	"github.com/dracory/weebase/api/api_backup_create"
+	"github.com/dracory/weebase/api/api_backup_restore"
+	"github.com/dracory/weebase/api/api_backups_list"
 	"github.com/dracory/weebase/api/api_connect"
+	"github.com/dracory/weebase/api/api_data_diff"
 	"github.com/dracory/weebase/api/api_databases_list"
+	"github.com/dracory/weebase/api/api_dump"
+	"github.com/dracory/weebase/api/api_enum_add_value"
+	"github.com/dracory/weebase/api/api_export"
+	"github.com/dracory/weebase/api/api_import"
+	"github.com/dracory/weebase/api/api_import_preview"
+	"github.com/dracory/weebase/api/api_job_download"
+	"github.com/dracory/weebase/api/api_job_status"
+	"github.com/dracory/weebase/api/api_jobs_list"
+	"github.com/dracory/weebase/api/api_migration_generate"
 	"github.com/dracory/weebase/api/api_profiles_list"
+	"github.com/dracory/weebase/api/api_routine_execute"
+	"github.com/dracory/weebase/api/api_routines_list"
+	"github.com/dracory/weebase/api/api_row_changes"
+	"github.com/dracory/weebase/api/api_row_delete"
+	"github.com/dracory/weebase/api/api_row_insert"
+	"github.com/dracory/weebase/api/api_row_undo"
+	"github.com/dracory/weebase/api/api_row_update"
+	"github.com/dracory/weebase/api/api_row_view"
+	"github.com/dracory/weebase/api/api_rows_browse"
+	"github.com/dracory/weebase/api/api_schema_diff"
+	"github.com/dracory/weebase/api/api_sequence_restart"
+	"github.com/dracory/weebase/api/api_sequence_setval"
+	"github.com/dracory/weebase/api/api_sequences_list"
+	"github.com/dracory/weebase/api/api_sql_execute"
+	"github.com/dracory/weebase/api/api_sql_import"
+	"github.com/dracory/weebase/api/api_table_copy"
+	"github.com/dracory/weebase/api/api_table_create"
+	"github.com/dracory/weebase/api/api_table_info"
 	"github.com/dracory/weebase/api/api_tables_list"
+	"github.com/dracory/weebase/api/api_token_create"
+	"github.com/dracory/weebase/api/api_token_revoke"
+	"github.com/dracory/weebase/api/api_tokens_list"
+	"github.com/dracory/weebase/api/api_types_list"
+	"github.com/dracory/weebase/api/api_view_create"
+	"github.com/dracory/weebase/api/api_view_definition"
+	"github.com/dracory/weebase/api/api_view_drop"
+	"github.com/dracory/weebase/api/api_view_refresh"
+	"github.com/dracory/weebase/pages/page_audit"
+	"github.com/dracory/weebase/pages/page_backups"
+	"github.com/dracory/weebase/pages/page_changes"
+	"github.com/dracory/weebase/pages/page_copy"
 	"github.com/dracory/weebase/pages/page_database"
+	"github.com/dracory/weebase/pages/page_export"
 	"github.com/dracory/weebase/pages/page_home"
+	"github.com/dracory/weebase/pages/page_import"
 	"github.com/dracory/weebase/pages/page_login"
 	"github.com/dracory/weebase/pages/page_logout"
+	"github.com/dracory/weebase/pages/page_routines"
 	"github.com/dracory/weebase/pages/page_table"
+	"github.com/dracory/weebase/pages/page_table_create"
+	"github.com/dracory/weebase/pages/page_tokens"
+	"github.com/dracory/weebase/shared/apitoken"
+	"github.com/dracory/weebase/shared/audit"
+	"github.com/dracory/weebase/shared/auth"
+	"github.com/dracory/weebase/shared/backup"
+	"github.com/dracory/weebase/shared/connection"
 	"github.com/dracory/weebase/shared/constants"
+	"github.com/dracory/weebase/shared/dialect"
+	"github.com/dracory/weebase/shared/jobs"
+	"github.com/dracory/weebase/shared/journal"
+	"github.com/dracory/weebase/shared/masking"
+	"github.com/dracory/weebase/shared/ratelimit"
+	"github.com/dracory/weebase/shared/rbac"
+	"github.com/dracory/weebase/shared/session"
 	"github.com/dracory/weebase/shared/types"
 	"github.com/samber/lo"
 
@@ -44,6 +116,11 @@ type App struct {
 	config  types.Config
 	db      *gorm.DB
 	drivers map[string]driverConfig
+	jobs    *jobs.Runner
+	backups *backup.Scheduler
+	limiter *ratelimit.Limiter
+	// stop ends the background work started by New
+	stop context.CancelFunc
 }
 
 type driverConfig struct {
@@ -64,10 +141,99 @@ func New(cfg types.Config, options ...func(*types.Config)) *App {
 		cfg.EnabledDrivers = []string{MYSQL, POSTGRES, SQLITE, SQLSRV}
 	}
 
+	if cfg.AuditSink == nil {
+		cfg.AuditSink = audit.NewSlog(nil)
+	}
+	if cfg.Journal == nil {
+		cfg.Journal = newJournal(cfg)
+	}
+	if cfg.APITokens == nil {
+		cfg.APITokens = newTokenStore(cfg)
+	}
+	// personal API tokens stand in for the configured authenticator,
+	// which looks their owners up when it can
+	if cfg.Authenticator != nil {
+		tokens := apitoken.NewAuthenticator(cfg.APITokens, apitoken.Options{
+			Owners:      cfg.Authenticator,
+			MaxLifetime: cfg.APITokenMaxLifetime,
+		})
+		cfg.Authenticator = auth.Chain{tokens, cfg.Authenticator}
+	}
+
+	if cfg.RateLimit == nil {
+		limits := ratelimit.DefaultConfig()
+		cfg.RateLimit = &limits
+	}
+
+	ctx, stop := context.WithCancel(context.Background())
 	return &App{
 		config:  cfg,
 		drivers: make(map[string]driverConfig),
+		jobs:    newJobRunner(cfg),
+		backups: newBackupScheduler(ctx, cfg),
+		limiter: ratelimit.New(*cfg.RateLimit),
+		stop:    stop,
+	}
+}
+
+// newBackupScheduler starts the scheduled backups of the configured
+// profiles until ctx is cancelled. Invalid profiles are logged and left out.
+func newBackupScheduler(ctx context.Context, cfg types.Config) *backup.Scheduler {
+	scheduler, err := backup.NewScheduler(cfg.BackupProfiles, cfg.SecretResolver)
+	if err != nil {
+		slog.Error("invalid backup profiles", slog.String("error", err.Error()))
+	}
+	scheduler.Start(ctx)
+	return scheduler
+}
+
+// newJournal opens the row change journal. A journal that can't be opened
+// is logged and replaced by one in memory, so edits keep working.
+func newJournal(cfg types.Config) journal.Store {
+	if cfg.JournalStorePath != "" {
+		store, err := journal.NewSQLiteStore(cfg.JournalStorePath)
+		if err == nil {
+			return store
+		}
+		slog.Error("falling back to an in-memory journal", slog.String("error", err.Error()))
 	}
+	return journal.NewMemoryStore()
+}
+
+// newTokenStore opens the personal API token store. A store that can't be
+// opened is logged and replaced by one in memory, so sign-ins keep working.
+func newTokenStore(cfg types.Config) apitoken.Store {
+	if cfg.APITokenStorePath != "" {
+		store, err := apitoken.NewSQLiteStore(cfg.APITokenStorePath)
+		if err == nil {
+			return store
+		}
+		slog.Error("falling back to an in-memory API token store", slog.String("error", err.Error()))
+	}
+	return apitoken.NewMemoryStore()
+}
+
+// newJobRunner creates the runner for background jobs. A job store that
+// can't be opened is logged and replaced by one in memory, so the UI keeps
+// working without persistence.
+func newJobRunner(cfg types.Config) *jobs.Runner {
+	store := cfg.JobStore
+	if store == nil && cfg.JobStorePath != "" {
+		sqliteStore, err := jobs.NewSQLiteStore(cfg.JobStorePath)
+		if err != nil {
+			slog.Error("falling back to an in-memory job store", slog.String("error", err.Error()))
+		} else {
+			store = sqliteStore
+		}
+	}
+	if store == nil {
+		store = jobs.NewMemoryStore()
+	}
+	return jobs.NewRunner(store, jobs.Options{
+		Workers:     cfg.JobWorkers,
+		ArtifactTTL: cfg.JobArtifactTTL,
+		ArtifactDir: cfg.JobArtifactDir,
+	})
 }
 
 // Handler returns an http.Handler that serves the App UI and API
@@ -80,6 +246,22 @@ func (g *App) Handler() http.Handler {
 	return g.middleware(mux)
 }
 
+// Close stops the scheduled backups and cancels a scheduled backup in
+// progress. Embedding applications call it when they drop the App; requests
+// already being served are not affected.
+func (g *App) Close() error {
+	g.stop()
+	return nil
+}
+
+// RevokeAPITokens revokes every personal API token of an operator, for
+// embedding applications to call when the operator is removed or demoted
+// in an identity provider weebase can't look operators up in. It returns
+// how many tokens were revoked.
+func (g *App) RevokeAPITokens(ctx context.Context, owner string) (int, error) {
+	return g.config.APITokens.DeleteOwner(ctx, owner)
+}
+
 // handleRequest routes requests to the appropriate handler
 func (g *App) handleRequest(w http.ResponseWriter, r *http.Request) {
 	action := r.URL.Query().Get(g.config.ActionParam)
@@ -100,26 +282,189 @@ func (g *App) handleRequest(w http.ResponseWriter, r *http.Request) {
 		handler = pageActionMap[action]
 	}
 
+	// connect attempts have a stricter limit, and failed ones lock the
+	// client out for longer and longer; other actions opening a DSN of
+	// their own take their attempts through ratelimit.Connect
+	if action == constants.ActionApiConnect {
+		if ok, retry := g.limiter.AllowConnect(g.limiter.ClientAddress(r)); !ok {
+			tooManyRequests(w, r, retry)
+			return
+		}
+	}
+
+	if lo.HasKey(apiActionMap, action) || lo.HasKey(pageActionMap, action) {
+		var entry *audit.Entry
+		if !lo.HasKey(pageActionMap, action) && auditedPermissions[rbac.ActionRule(action).Permission] {
+			entry = g.auditEntry(w, r, action)
+		}
+
+		var err error
+		if g.config.ReadOnlyMode && !lo.HasKey(pageActionMap, action) && rbac.ActionRule(action).Writes() {
+			err = errors.New("read-only mode: changing data or structure is disabled")
+		} else {
+			r, err = g.authorize(w, r, action)
+		}
+		if err != nil {
+			if entry != nil {
+				entry.Outcome, entry.Error = audit.OutcomeDenied, err.Error()
+				g.writeAudit(r, entry)
+			}
+			api.Respond(w, r, api.Error(err.Error()))
+			return
+		}
+
+		if g.config.Masking != nil {
+			r = r.WithContext(masking.WithMasker(r.Context(), g.masker(w, r)))
+		}
+
+		if entry != nil {
+			r = r.WithContext(audit.WithSink(audit.WithEntry(r.Context(), entry), g.config.AuditSink))
+			rec := audit.NewRecorder(w)
+			handler(rec, r)
+			outcome, message := rec.Result()
+			// a job started by the action writes its own outcome when it ends
+			if outcome == audit.OutcomeSuccess && entry.Outcome == audit.OutcomeSubmitted {
+				outcome = audit.OutcomeSubmitted
+			}
+			entry.Outcome, entry.Error = outcome, message
+			g.writeAudit(r, entry)
+			return
+		}
+	}
+
 	handler(w, r)
 }
 
+// auditedPermissions are the permissions of the actions recorded in the
+// audit log: everything that changes data or structure or runs SQL
+var auditedPermissions = map[string]bool{
+	rbac.PermEdit:    true,
+	rbac.PermSQL:     true,
+	rbac.PermDDL:     true,
+	rbac.PermImport:  true,
+	rbac.PermRestore: true,
+	rbac.PermAll:     true,
+}
+
+// auditEntry opens the audit entry of an action with who runs it and on
+// which connection; the handler adds what it ran
+func (g *App) auditEntry(w http.ResponseWriter, r *http.Request, action string) *audit.Entry {
+	sess := session.EnsureSession(w, r, g.config.SessionSecret)
+	entry := &audit.Entry{
+		Time:         time.Now().UTC(),
+		Operator:     sess.User,
+		SessionID:    sess.ID,
+		RequestID:    GetRequestID(r.Context()),
+		Action:       action,
+		RowsAffected: -1,
+	}
+	if user, ok := auth.FromContext(r.Context()); ok && user.Name != "" {
+		entry.Operator = user.Name
+	}
+	if entry.RequestID == "" {
+		entry.RequestID = r.Header.Get("X-Request-Id")
+	}
+	if entry.RequestID == "" {
+		entry.RequestID = newReqID()
+	}
+	if sess.Conn != nil {
+		entry.Database = connection.DatabaseName(sess.Conn.Driver, sess.Conn.DSN)
+		if g.config.Policy != nil {
+			entry.Profile = g.sessionProfile(sess)
+		}
+	}
+	return entry
+}
+
+// writeAudit completes the entry from the request form for handlers that
+// don't describe what they ran, then writes it to the audit sink
+func (g *App) writeAudit(r *http.Request, entry *audit.Entry) {
+	ctx := audit.WithEntry(r.Context(), entry)
+	// handlers turning the request away early may not have read the form
+	if r.Form == nil {
+		r.ParseForm()
+	}
+	if entry.Statement == "" {
+		if sql := strings.TrimSpace(r.Form.Get("sql")); sql != "" {
+			audit.SetSQL(ctx, sql)
+		}
+	}
+	if entry.Object == "" {
+		if table := strings.TrimSpace(r.Form.Get("table")); table != "" {
+			audit.SetObject(ctx, strings.TrimSpace(r.Form.Get("schema")), table)
+		}
+	}
+	if err := g.config.AuditSink.Write(context.WithoutCancel(r.Context()), *entry); err != nil {
+		slog.Error("failed to write audit entry", slog.String("action", entry.Action), slog.String("error", err.Error()))
+	}
+}
+
 func (g *App) apiActions() map[string]func(w http.ResponseWriter, r *http.Request) {
 	return map[string]func(w http.ResponseWriter, r *http.Request){
-		constants.ActionApiConnect:       api_connect.New(g.config).ServeHTTP,
-		constants.ActionApiDatabasesList: api_databases_list.New(g.config).ServeHTTP,
-		constants.ActionApiProfilesList:  api_profiles_list.New(g.config).ServeHTTP,
-		constants.ActionApiTablesList:    api_tables_list.New(g.config).Handle,
+		constants.ActionApiConnect:           api_connect.New(g.config).ServeHTTP,
+		constants.ActionApiDatabasesList:     api_databases_list.New(g.config).ServeHTTP,
+		constants.ActionApiProfilesList:      api_profiles_list.New(g.config).ServeHTTP,
+		constants.ActionApiTablesList:        api_tables_list.New(g.config).Handle,
+		constants.ActionApiTableInfo:         api_table_info.New(g.config).Handle,
+		constants.ActionApiViewDefinition:    api_view_definition.New(g.config).Handle,
+		constants.ActionApiViewCreate:        api_view_create.New(g.config).Handle,
+		constants.ActionApiViewDrop:          api_view_drop.New(g.config).Handle,
+		constants.ActionApiViewRefresh:       api_view_refresh.New(g.config).Handle,
+		constants.ActionApiRoutinesList:      api_routines_list.New(g.config).Handle,
+		constants.ActionApiRoutineExecute:    api_routine_execute.New(g.config).Handle,
+		constants.ActionApiSequencesList:     api_sequences_list.New(g.config).Handle,
+		constants.ActionApiSequenceSetval:    api_sequence_setval.New(g.config).Handle,
+		constants.ActionApiSequenceRestart:   api_sequence_restart.New(g.config).Handle,
+		constants.ActionApiTypesList:         api_types_list.New(g.config).Handle,
+		constants.ActionApiEnumAddValue:      api_enum_add_value.New(g.config).Handle,
+		constants.ActionApiSchemaDiff:        api_schema_diff.New(g.config).Handle,
+		constants.ActionApiDataDiff:          api_data_diff.New(g.config, g.jobs).Handle,
+		constants.ActionApiMigrationGenerate: api_migration_generate.New(g.config).Handle,
+		constants.ActionApiTableCreate:       api_table_create.New(g.config, g.config.SafeModeDefault).Handle,
+		constants.ActionApiExport:            api_export.New(g.config, g.jobs).Handle,
+		constants.ActionApiDump:              api_dump.New(g.config, g.jobs).Handle,
+		constants.ActionApiImport:            api_import.New(g.config, g.jobs).Handle,
+		constants.ActionApiImportPreview:     api_import_preview.New(g.config).Handle,
+		constants.ActionApiSQLImport:         api_sql_import.New(g.config, g.jobs).Handle,
+		constants.ActionApiTableCopy:         api_table_copy.New(g.config, g.jobs).Handle,
+		constants.ActionApiJobsList:          api_jobs_list.New(g.config, g.jobs).Handle,
+		constants.ActionApiJobStatus:         api_job_status.New(g.config, g.jobs).Handle,
+		constants.ActionApiJobDownload:       api_job_download.New(g.config, g.jobs).Handle,
+		constants.ActionApiBackupsList:       api_backups_list.New(g.config, g.backups).Handle,
+		constants.ActionApiBackupCreate:      api_backup_create.New(g.config, g.backups, g.jobs).Handle,
+		constants.ActionApiBackupRestore:     api_backup_restore.New(g.config, g.backups, g.jobs).Handle,
+		constants.ActionApiBrowseRows:        api_rows_browse.New(g.config).Handle,
+		constants.ActionApiRowView:           api_row_view.New(g.config).Handle,
+		constants.ActionApiInsertRow:         api_row_insert.New(g.config, g.config.SafeModeDefault).Handle,
+		constants.ActionApiUpdateRow:         api_row_update.New(g.config).Handle,
+		constants.ActionApiDeleteRow:         api_row_delete.New(g.config).Handle,
+		constants.ActionApiRowChanges:        api_row_changes.New(g.config).Handle,
+		constants.ActionApiRowUndo:           api_row_undo.New(g.config).Handle,
+		constants.ActionApiSQLExecute:        api_sql_execute.New(g.config, g.config.SafeModeDefault, g.config.ReadOnlyMode).Handle,
+		constants.ActionApiAuditSearch:       api_audit_search.New(g.config).Handle,
+		constants.ActionApiTokensList:        api_tokens_list.New(g.config).Handle,
+		constants.ActionApiTokenCreate:       api_token_create.New(g.config).Handle,
+		constants.ActionApiTokenRevoke:       api_token_revoke.New(g.config).Handle,
 	}
 }
 
 func (g *App) pageActions() map[string]func(w http.ResponseWriter, r *http.Request) {
 	return map[string]func(w http.ResponseWriter, r *http.Request){
-		constants.ActionPageHome:     page_home.New(g.config).ServeHTTP,
-		constants.ActionPageServer:   page_home.New(g.config).ServeHTTP,
-		constants.ActionPageLogin:    page_login.New(g.config).ServeHTTP,
-		constants.ActionPageLogout:   page_logout.New(g.config).ServeHTTP,
-		constants.ActionPageDatabase: page_database.New(g.config).ServeHTTP,
-		constants.ActionPageTable:    page_table.New(g.config).ServeHTTP,
+		constants.ActionPageHome:        page_home.New(g.config).ServeHTTP,
+		constants.ActionPageServer:      page_home.New(g.config).ServeHTTP,
+		constants.ActionPageLogin:       page_login.New(g.config).ServeHTTP,
+		constants.ActionPageLogout:      page_logout.New(g.config).ServeHTTP,
+		constants.ActionPageDatabase:    page_database.New(g.config).ServeHTTP,
+		constants.ActionPageTable:       page_table.New(g.config).ServeHTTP,
+		constants.ActionPageRoutines:    page_routines.New(g.config).ServeHTTP,
+		constants.ActionPageTableCreate: page_table_create.New(g.config).ServeHTTP,
+		constants.ActionPageExport:      page_export.New(g.config).ServeHTTP,
+		constants.ActionPageImport:      page_import.New(g.config).ServeHTTP,
+		constants.ActionPageCopy:        page_copy.New(g.config).ServeHTTP,
+		constants.ActionPageBackups:     page_backups.New(g.config).ServeHTTP,
+		constants.ActionPageAudit:       page_audit.New(g.config).ServeHTTP,
+		constants.ActionPageChanges:     page_changes.New(g.config).ServeHTTP,
+		constants.ActionPageTokens:      page_tokens.New(g.config).ServeHTTP,
 	}
 }
 
@@ -133,6 +478,285 @@ func (g *App) middleware(next http.Handler) http.Handler {
 		w.Header().Set("Referrer-Policy", "same-origin")
 		w.Header().Set("Content-Security-Policy", "default-src 'self'; script-src 'self' 'unsafe-inline' 'unsafe-eval' cdn.jsdelivr.net cdn.tailwindcss.com unpkg.com; style-src 'self' 'unsafe-inline' cdn.jsdelivr.net cdn.tailwindcss.com unpkg.com; font-src 'self' cdn.jsdelivr.net; img-src 'self' data:;")
 
+		// profile connections are resolved each time the session is read
+		r = r.WithContext(session.WithProfileResolver(r.Context(), func(ctx context.Context, id string) (string, string, error) {
+			return connection.ResolveProfile(ctx, g.config, id)
+		}))
+		// connects of the request are limited as those of its client
+		client := g.limiter.ClientAddress(r)
+		r = r.WithContext(ratelimit.WithClient(r.Context(), g.limiter, client))
+
+		if ok, retry := g.limiter.Allow(client, session.ID(r, g.config.SessionSecret)); !ok {
+			tooManyRequests(w, r, retry)
+			return
+		}
+
+		r, ok := g.authenticate(w, r)
+		if !ok {
+			return
+		}
 		next.ServeHTTP(w, r)
 	})
 }
+
+// tooManyRequests turns a request away with 429, telling the client how
+// many seconds to wait
+func tooManyRequests(w http.ResponseWriter, r *http.Request, retry time.Duration) {
+	seconds := max(1, int(math.Ceil(retry.Seconds())))
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	api.RespondWithStatusCode(w, r, api.Error(fmt.Sprintf("too many requests, retry in %d seconds", seconds)), http.StatusTooManyRequests)
+}
+
+// authenticate identifies the operator with the configured Authenticator,
+// turning the request away with 401 when that fails, or for pages of an
+// interactive authenticator starting its login. The operator is kept
+// in the session and the request context. An operator signing in gets a
+// new session ID and CSRF token, so the jobs and uploads keyed by the one
+// before stay with whoever had it; a session started by another operator
+// also loses its connection. Requests with a token get a session of their
+// own instead, see tokenSession.
+func (g *App) authenticate(w http.ResponseWriter, r *http.Request) (*http.Request, bool) {
+	if g.config.Authenticator == nil {
+		return r, true
+	}
+
+	action := r.URL.Query().Get(g.config.ActionParam)
+	interactive, isInteractive := auth.AsInteractive(g.config.Authenticator)
+	if isInteractive && action == constants.ActionAuthCallback {
+		interactive.Callback(w, r)
+		return r, false
+	}
+
+	user, err := g.config.Authenticator.Authenticate(r)
+	if err != nil {
+		if !errors.Is(err, auth.ErrUnauthenticated) {
+			slog.Error("authentication failed", slog.String("error", err.Error()))
+		}
+		// browsers asking for a page sign in through the provider
+		if isInteractive && r.Method == http.MethodGet && !strings.HasPrefix(action, "api_") {
+			interactive.Login(w, r)
+			return r, false
+		}
+		if c, ok := g.config.Authenticator.(auth.Challenger); ok {
+			c.Challenge(w)
+		}
+		api.RespondWithStatusCode(w, r, api.Unauthenticated("authentication required"), http.StatusUnauthorized)
+		return r, false
+	}
+
+	r = r.WithContext(auth.WithUser(r.Context(), user))
+	if token := auth.BearerToken(r); token != "" {
+		r, err = g.tokenSession(r, user, token)
+		if err != nil {
+			api.Respond(w, r, api.Error(err.Error()))
+			return r, false
+		}
+		return r, true
+	}
+	sess := session.EnsureSession(w, r, g.config.SessionSecret)
+	if sess.User != user.Name {
+		if sess.User != "" {
+			sess.Conn = nil
+		}
+		sess.ID, sess.CSRFToken = session.NewRandomID(), ""
+		sess.User = user.Name
+		r = session.SaveSessionForRequest(w, r, sess, g.config.SessionSecret)
+	}
+	return r, true
+}
+
+// tokenSession gives a request authenticated with a token the session it
+// lasts for: the connection its headers name, never one of a session
+// cookie, which a browser would send whoever made the request. The ID
+// derives from the token so its jobs can be followed up with it.
+func (g *App) tokenSession(r *http.Request, user auth.User, token string) (*http.Request, error) {
+	sum := sha256.Sum256([]byte(token))
+	sess := &session.Session{
+		ID:        "token:" + hex.EncodeToString(sum[:16]),
+		CreatedAt: time.Now(),
+		User:      user.Name,
+	}
+
+	form := url.Values{
+		"profile_id": {strings.TrimSpace(r.Header.Get(auth.ProfileHeader))},
+		"driver":     {strings.TrimSpace(r.Header.Get(auth.DriverHeader))},
+		"dsn":        {strings.TrimSpace(r.Header.Get(auth.DSNHeader))},
+	}
+	if form.Get("profile_id") != "" || form.Get("driver") != "" || form.Get("dsn") != "" {
+		target, err := connection.FromForm(r.Context(), g.config, nil, form, "")
+		if err != nil {
+			return r, err
+		}
+		// an ad-hoc DSN is opened once here so it is limited and its
+		// failures counted like a connect
+		if target.AdHoc() {
+			db, err := target.Open(r.Context())
+			if err != nil {
+				return r, fmt.Errorf("failed to connect to database: %v", err)
+			}
+			db.Close()
+		}
+		sess.Conn = &session.ActiveConnection{
+			ID:        session.NewRandomID(),
+			Driver:    target.Driver,
+			DSN:       target.DSN,
+			LastUsed:  time.Now(),
+			ProfileID: form.Get("profile_id"),
+		}
+	}
+	return session.ForRequest(r, sess, g.config.SessionSecret), nil
+}
+
+// authorize checks the action against the RBAC policy before it is
+// dispatched: the rule of the action is checked on the connection profile,
+// schema and tables the request names. The permissions the operator holds
+// on the session's connection are put in the context so pages can hide
+// controls it can't use. Actions that write rows out unmasked also need
+// the unmask permission on whatever the masking rules cover.
+func (g *App) authorize(w http.ResponseWriter, r *http.Request, action string) (*http.Request, error) {
+	policy := g.config.Policy
+	if policy == nil {
+		// nobody may unmask without a policy
+		if rbac.ActionRule(action).Unmasked && g.config.Masking.Covers("", "", "") {
+			return r, fmt.Errorf("permission denied: %s, masking rules apply", rbac.PermUnmask)
+		}
+		return r, nil
+	}
+
+	user, _ := auth.FromContext(r.Context())
+	sess := session.EnsureSession(w, r, g.config.SessionSecret)
+	r = r.WithContext(rbac.WithGranted(r.Context(), policy.Granted(user, g.sessionProfile(sess))))
+
+	rule := rbac.ActionRule(action)
+	if rule.Permission == "" {
+		return r, nil
+	}
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		if err := r.ParseMultipartForm(32 << 20); err != nil {
+			return r, errors.New("failed to parse form")
+		}
+	} else if err := r.ParseForm(); err != nil {
+		return r, errors.New("failed to parse form")
+	}
+
+	var requests []rbac.Request
+	switch {
+	case rule.Global:
+		if !policy.Holds(user, rule.Permission) {
+			return r, fmt.Errorf("permission denied: %s", rule.Permission)
+		}
+		return r, nil
+	case rule.Backup:
+		name := strings.TrimSpace(r.Form.Get("profile"))
+		if name == "" {
+			if !policy.Holds(user, rule.Permission) {
+				return r, fmt.Errorf("permission denied: %s", rule.Permission)
+			}
+			return r, nil
+		}
+		requests = []rbac.Request{{Permission: rule.Permission, Profile: name}}
+	case rule.Source != "":
+		// the target table defaults to the source's
+		target := r.Form
+		if target.Get("target_table") == "" && target.Get("source_table") != "" {
+			target = url.Values{"target_table": {target.Get("source_table")}}
+			for _, key := range []string{"target_profile_id", "target_driver", "target_dsn", "target_schema", "target_query"} {
+				target[key] = r.Form[key]
+			}
+		}
+		requests = append(g.scopeRequests(sess, r.Form, "source_", rule.Source), g.scopeRequests(sess, target, "target_", rule.Permission)...)
+	default:
+		requests = g.scopeRequests(sess, r.Form, "", rule.Permission)
+	}
+
+	if rule.Unmasked {
+		for _, req := range requests {
+			if g.config.Masking.Covers(req.Profile, req.Schema, req.Table) {
+				requests = append(requests, rbac.Request{Permission: rbac.PermUnmask, Profile: req.Profile, Schema: req.Schema, Table: req.Table})
+			}
+		}
+	}
+
+	for _, req := range requests {
+		if policy.Allowed(user, req) {
+			continue
+		}
+		if req.Table != "" {
+			return r, fmt.Errorf("permission denied: %s on %s", req.Permission, req.Table)
+		}
+		return r, fmt.Errorf("permission denied: %s", req.Permission)
+	}
+	return r, nil
+}
+
+// sessionProfile names the policy profile of the session's connection
+func (g *App) sessionProfile(sess *session.Session) string {
+	if sess == nil || sess.Conn == nil {
+		return ""
+	}
+	return g.config.Policy.Profile(dialect.Normalize(sess.Conn.Driver), sess.Conn.DSN)
+}
+
+// masker returns the Masker of the request's connection; operators granted
+// unmask on a table see it unmasked
+func (g *App) masker(w http.ResponseWriter, r *http.Request) *masking.Masker {
+	policy := g.config.Policy
+	if policy == nil {
+		return masking.NewMasker(g.config.Masking, "", nil)
+	}
+	user, _ := auth.FromContext(r.Context())
+	sess := session.EnsureSession(w, r, g.config.SessionSecret)
+	profile := g.sessionProfile(sess)
+	return masking.NewMasker(g.config.Masking, profile, func(schema, table string) bool {
+		if schema == "" && table != "" && sess.Conn != nil {
+			schema = dialect.DefaultSchema(sess.Conn.Driver)
+		}
+		return policy.Allowed(user, rbac.Request{Permission: rbac.PermUnmask, Profile: profile, Schema: schema, Table: table})
+	})
+}
+
+// scopeRequests lists the checks for one side of a request: its
+// connection's profile, its schema (the driver's default when empty) and
+// every table or view it names. Free-form queries are checked as
+// requests naming no table.
+func (g *App) scopeRequests(sess *session.Session, form url.Values, prefix, permission string) []rbac.Request {
+	profile := g.sessionProfile(sess)
+	drv := ""
+	if sess != nil && sess.Conn != nil {
+		drv = sess.Conn.Driver
+	}
+	if prefix != "" {
+		if id := strings.TrimSpace(form.Get(prefix + "profile_id")); id != "" {
+			// a profile that can't be resolved is checked as no profile
+			d, dsn, _ := connection.ResolveProfile(context.Background(), g.config, id)
+			drv = d
+			profile = g.config.Policy.Profile(d, dsn)
+		} else if d, dsn := strings.TrimSpace(form.Get(prefix+"driver")), strings.TrimSpace(form.Get(prefix+"dsn")); d != "" || dsn != "" {
+			drv = d
+			profile = g.config.Policy.Profile(dialect.Normalize(d), dsn)
+		}
+	}
+
+	schema := strings.TrimSpace(form.Get(prefix + "schema"))
+	if schema == "" {
+		schema = dialect.DefaultSchema(drv)
+	}
+
+	var tables []string
+	for _, key := range []string{prefix + "table", prefix + "view", prefix + "tables[]"} {
+		for _, table := range form[key] {
+			if table = strings.TrimSpace(table); table != "" {
+				tables = append(tables, table)
+			}
+		}
+	}
+	if len(tables) == 0 || strings.TrimSpace(form.Get(prefix+"query")) != "" || strings.TrimSpace(form.Get(prefix+"sql")) != "" {
+		tables = append(tables, "")
+	}
+
+	requests := make([]rbac.Request, len(tables))
+	for i, table := range tables {
+		requests[i] = rbac.Request{Permission: permission, Profile: profile, Schema: schema, Table: table}
+	}
+	return requests
+}
@@ -0,0 +1,188 @@
+package weebase_test
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/dracory/weebase"
+	"github.com/dracory/weebase/shared/apitoken"
+	"github.com/dracory/weebase/shared/auth"
+	"github.com/dracory/weebase/shared/session"
+	"github.com/dracory/weebase/shared/testutil"
+	"github.com/dracory/weebase/shared/types"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func TestTokenRequestNamesItsConnection(t *testing.T) {
+	dir := t.TempDir()
+	dbPath := filepath.Join(dir, "main.db")
+	db, err := sql.Open("sqlite3", dbPath)
+	if err != nil {
+		t.Fatalf("failed to open SQLite database: %v", err)
+	}
+	defer db.Close()
+	if _, err := db.Exec(`CREATE TABLE products (id INTEGER PRIMARY KEY, name TEXT)`); err != nil {
+		t.Fatalf("failed to create test table: %v", err)
+	}
+
+	tokens := apitoken.NewMemoryStore()
+	token, secret := apitoken.New("alice", "ci", nil, nil, nil, nil)
+	if err := tokens.Add(t.Context(), token); err != nil {
+		t.Fatalf("failed to add token: %v", err)
+	}
+
+	app := weebase.New(types.Config{
+		BasePath:           "/",
+		ActionParam:        "action",
+		SessionSecret:      testutil.SessionSecret,
+		EnabledDrivers:     []string{"sqlite"},
+		Authenticator:      auth.NewToken("static", auth.User{Name: "alice"}),
+		APITokens:          tokens,
+		ConnectionProfiles: []types.ConnectionProfile{{ID: "main", Name: "Main", Driver: "sqlite", DSN: dbPath}},
+	})
+	defer app.Close()
+	handler := app.Handler()
+
+	do := func(method, action string, headers map[string]string, cookies ...string) (string, string, *httptest.ResponseRecorder) {
+		req := httptest.NewRequest(method, "/?action="+action, nil)
+		req.Header.Set("Authorization", "Bearer "+secret)
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		for _, path := range cookies {
+			req.AddCookie(testutil.SessionCookie(t, path))
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+
+		var response struct {
+			Status  string `json:"status"`
+			Message string `json:"message"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+			t.Fatalf("failed to parse response %q: %v", w.Body.String(), err)
+		}
+		return response.Status, response.Message, w
+	}
+
+	t.Run("profile header", func(t *testing.T) {
+		status, message, w := do("GET", "api_tables_list", map[string]string{auth.ProfileHeader: "main"})
+		if status != "success" || !strings.Contains(w.Body.String(), `"products"`) {
+			t.Fatalf("expected the tables of the profile, got %s: %s", status, message)
+		}
+		for _, c := range w.Result().Cookies() {
+			if c.Name == session.SessionCookieName {
+				t.Error("expected no session cookie for a token request")
+			}
+		}
+	})
+
+	t.Run("session cookie is ignored", func(t *testing.T) {
+		other := filepath.Join(dir, "other.db")
+		status, message, _ := do("GET", "api_tables_list", nil, other)
+		if status != "error" || message != "not connected to database" {
+			t.Errorf("expected the cookie's connection to be ignored, got %s: %s", status, message)
+		}
+	})
+
+	t.Run("unknown profile", func(t *testing.T) {
+		status, _, _ := do("GET", "api_tables_list", map[string]string{auth.ProfileHeader: "missing"})
+		if status != "error" {
+			t.Errorf("expected an unknown profile to be refused, got %s", status)
+		}
+	})
+
+	t.Run("ad-hoc connections stay disabled", func(t *testing.T) {
+		status, message, _ := do("GET", "api_tables_list", map[string]string{auth.DriverHeader: "sqlite", auth.DSNHeader: dbPath})
+		if status != "error" || message != "ad-hoc connections are disabled" {
+			t.Errorf("unexpected response: %s %s", status, message)
+		}
+	})
+
+	t.Run("connect is refused", func(t *testing.T) {
+		status, message, _ := do("POST", "api_connect", nil)
+		if status != "error" || !strings.Contains(message, auth.ProfileHeader) {
+			t.Errorf("unexpected response: %s %s", status, message)
+		}
+	})
+}
+
+func TestSignInRotatesSession(t *testing.T) {
+	dir := t.TempDir()
+	dbPath := filepath.Join(dir, "main.db")
+	db, err := sql.Open("sqlite3", dbPath)
+	if err != nil {
+		t.Fatalf("failed to open SQLite database: %v", err)
+	}
+	defer db.Close()
+	if _, err := db.Exec(`CREATE TABLE people (id INTEGER PRIMARY KEY, name TEXT)`); err != nil {
+		t.Fatalf("failed to create test table: %v", err)
+	}
+
+	app := weebase.New(types.Config{
+		BasePath:       "/",
+		ActionParam:    "action",
+		SessionSecret:  testutil.SessionSecret,
+		JobArtifactDir: dir,
+		Authenticator: auth.Func(func(r *http.Request) (auth.User, error) {
+			if name := r.Header.Get("X-Test-User"); name != "" {
+				return auth.User{Name: name}, nil
+			}
+			return auth.User{}, auth.ErrUnauthenticated
+		}),
+	})
+	defer app.Close()
+	handler := app.Handler()
+
+	// do runs a request as user and returns the response and the session
+	// cookie to send next
+	do := func(user, query string, cookie *http.Cookie) (map[string]any, *http.Cookie) {
+		req := httptest.NewRequest("GET", "/?"+query, nil)
+		req.Header.Set("X-Test-User", user)
+		req.AddCookie(cookie)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		for _, c := range w.Result().Cookies() {
+			if c.Name == session.SessionCookieName {
+				cookie = c
+			}
+		}
+		var response map[string]any
+		if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+			t.Fatalf("failed to parse response %q: %v", w.Body.String(), err)
+		}
+		return response, cookie
+	}
+
+	cookie := testutil.SessionCookie(t, dbPath)
+	started, cookie := do("alice", "action=api_export&table=people&async=yes", cookie)
+	data, _ := started["data"].(map[string]any)
+	jobID, _ := data["job_id"].(string)
+	if started["status"] != "success" || jobID == "" {
+		t.Fatalf("unexpected response: %v", started)
+	}
+	if session.ID(&http.Request{Header: http.Header{"Cookie": {cookie.String()}}}, testutil.SessionSecret) == "test-session" {
+		t.Error("expected signing in to rotate the session ID")
+	}
+
+	status, cookie := do("alice", "action=api_job_status&job_id="+jobID, cookie)
+	if status["status"] == "error" {
+		t.Fatalf("expected alice to see her job, got %v", status)
+	}
+
+	// bob signing in to alice's session gets neither her job nor its file
+	status, cookie = do("bob", "action=api_job_status&job_id="+jobID, cookie)
+	if status["status"] != "error" {
+		t.Errorf("expected the job to be hidden from another operator, got %v", status)
+	}
+	list, _ := do("bob", "action=api_jobs_list", cookie)
+	data, _ = list["data"].(map[string]any)
+	if jobs, _ := data["jobs"].([]any); len(jobs) != 0 {
+		t.Errorf("unexpected jobs for another operator: %v", list)
+	}
+}
@@ -1,10 +1,23 @@
 package weebase
 
 import (
+	"encoding/json"
 	"flag"
 	"fmt"
+	"os"
+	"strings"
+	"time"
 
 	"github.com/dracory/env"
+	"github.com/dracory/weebase/shared/apitoken"
+	"github.com/dracory/weebase/shared/audit"
+	"github.com/dracory/weebase/shared/auth"
+	"github.com/dracory/weebase/shared/connguard"
+	"github.com/dracory/weebase/shared/jobs"
+	"github.com/dracory/weebase/shared/masking"
+	"github.com/dracory/weebase/shared/ratelimit"
+	"github.com/dracory/weebase/shared/rbac"
+	"github.com/dracory/weebase/shared/secrets"
 	"github.com/dracory/weebase/shared/types"
 )
 
@@ -52,7 +65,88 @@ func LoadConfig() (types.Config, error) {
 	cfg.SessionSecret = env.GetStringOrDefault("SESSION_SECRET", "dev-insecure-change-me")
 	cfg.AllowAdHocConnections = env.GetBoolOrDefault("ALLOW_ADHOC_CONNECTIONS", true)
 	cfg.SafeModeDefault = env.GetBoolOrDefault("SAFE_MODE_DEFAULT", true)
+	cfg.ReadOnlyMode = env.GetBoolOrDefault("READ_ONLY_MODE", false)
 	cfg.ActionParam = env.GetStringOrDefault("ACTION_PARAM", "action")
+	cfg.MigrationsDir = env.GetStringOrDefault("MIGRATIONS_DIR", "")
+	cfg.MigrationsFormat = env.GetStringOrDefault("MIGRATIONS_FORMAT", "golang-migrate")
+	cfg.JobWorkers = env.GetIntOrDefault("JOB_WORKERS", jobs.DefaultWorkers)
+	cfg.JobArtifactTTL = time.Duration(env.GetIntOrDefault("JOB_ARTIFACT_TTL_MINUTES", int(jobs.DefaultArtifactTTL/time.Minute))) * time.Minute
+	cfg.JobArtifactDir = env.GetStringOrDefault("JOB_ARTIFACT_DIR", "")
+	cfg.JobStorePath = env.GetStringOrDefault("JOB_STORE_PATH", "")
+	cfg.JournalStorePath = env.GetStringOrDefault("JOURNAL_STORE_PATH", "")
+	cfg.APITokenStorePath = env.GetStringOrDefault("API_TOKEN_STORE_PATH", "")
+	cfg.APITokenMaxLifetime = time.Duration(env.GetIntOrDefault("API_TOKEN_MAX_LIFETIME_DAYS", int(apitoken.DefaultMaxLifetime/(24*time.Hour)))) * 24 * time.Hour
+
+	cfg.ConnectPolicy = &connguard.Policy{
+		AllowHosts:  splitList(env.GetStringOrDefault("CONNECT_ALLOW_HOSTS", "")),
+		DenyHosts:   splitList(env.GetStringOrDefault("CONNECT_DENY_HOSTS", "")),
+		AllowPorts:  splitList(env.GetStringOrDefault("CONNECT_ALLOW_PORTS", "")),
+		DenyPorts:   splitList(env.GetStringOrDefault("CONNECT_DENY_PORTS", "")),
+		DenyPrivate: env.GetBoolOrDefault("CONNECT_DENY_PRIVATE", false),
+		SQLiteRoots: splitList(env.GetStringOrDefault("SQLITE_ROOTS", "")),
+	}
+	if err := cfg.ConnectPolicy.Validate(); err != nil {
+		return cfg, err
+	}
+
+	cfg.SecretResolver = loadSecretResolver()
+
+	limits := ratelimit.DefaultConfig()
+	limits.IP.Requests = env.GetIntOrDefault("RATE_LIMIT_IP_PER_MINUTE", limits.IP.Requests)
+	limits.Session.Requests = env.GetIntOrDefault("RATE_LIMIT_SESSION_PER_MINUTE", limits.Session.Requests)
+	limits.Connect.Requests = env.GetIntOrDefault("RATE_LIMIT_CONNECT_PER_MINUTE", limits.Connect.Requests)
+	limits.LockoutAfter = env.GetIntOrDefault("CONNECT_LOCKOUT_AFTER", limits.LockoutAfter)
+	limits.Lockout = time.Duration(env.GetIntOrDefault("CONNECT_LOCKOUT_SECONDS", int(limits.Lockout/time.Second))) * time.Second
+	limits.MaxLockout = time.Duration(env.GetIntOrDefault("CONNECT_LOCKOUT_MAX_SECONDS", int(limits.MaxLockout/time.Second))) * time.Second
+	limits.TrustProxy = env.GetBoolOrDefault("TRUST_PROXY_HEADERS", false)
+	cfg.RateLimit = &limits
+
+	authenticator, err := loadAuthenticator(cfg.SessionSecret)
+	if err != nil {
+		return cfg, err
+	}
+	cfg.Authenticator = authenticator
+
+	if path := env.GetStringOrDefault("RBAC_POLICY_FILE", ""); path != "" {
+		policy, err := rbac.Load(path)
+		if err != nil {
+			return cfg, err
+		}
+		cfg.Policy = policy
+	}
+
+	if path := env.GetStringOrDefault("MASKING_RULES_FILE", ""); path != "" {
+		rules, err := masking.Load(path)
+		if err != nil {
+			return cfg, err
+		}
+		if rules.HashKey == "" {
+			rules.HashKey = env.GetStringOrDefault("MASKING_HASH_KEY", cfg.SessionSecret)
+		}
+		cfg.Masking = rules
+	}
+
+	sink, err := loadAuditSink()
+	if err != nil {
+		return cfg, err
+	}
+	cfg.AuditSink = sink
+
+	if path := env.GetStringOrDefault("CONNECTION_PROFILES_FILE", ""); path != "" {
+		profiles, err := loadConnectionProfiles(path)
+		if err != nil {
+			return cfg, err
+		}
+		cfg.ConnectionProfiles = profiles
+	}
+
+	if path := env.GetStringOrDefault("BACKUP_PROFILES_FILE", ""); path != "" {
+		profiles, err := loadBackupProfiles(path)
+		if err != nil {
+			return cfg, err
+		}
+		cfg.BackupProfiles = profiles
+	}
 
 	// Flags
 	port := flag.Int("port", cfg.HTTPPort, "HTTP port to listen on")
@@ -71,3 +165,163 @@ func LoadConfig() (types.Config, error) {
 	}
 	return cfg, nil
 }
+
+// loadAuthenticator sets up single sign-on with the OIDC_* provider, basic
+// auth against AUTH_HTPASSWD_FILE and a static AUTH_TOKEN, in any
+// combination. Nil means no authentication.
+func loadAuthenticator(secret string) (auth.Authenticator, error) {
+	var chain auth.Chain
+	if issuer := env.GetStringOrDefault("OIDC_ISSUER", ""); issuer != "" {
+		oidc, err := auth.NewOIDC(auth.OIDCConfig{
+			Issuer:                issuer,
+			ClientID:              env.GetStringOrDefault("OIDC_CLIENT_ID", ""),
+			ClientSecret:          env.GetStringOrDefault("OIDC_CLIENT_SECRET", ""),
+			RedirectURL:           env.GetStringOrDefault("OIDC_REDIRECT_URL", ""),
+			PostLogoutRedirectURL: env.GetStringOrDefault("OIDC_POST_LOGOUT_REDIRECT_URL", ""),
+			Scopes:                strings.Fields(env.GetStringOrDefault("OIDC_SCOPES", "")),
+			UsernameClaim:         env.GetStringOrDefault("OIDC_USERNAME_CLAIM", ""),
+			RolesClaim:            env.GetStringOrDefault("OIDC_ROLES_CLAIM", ""),
+			RoleMap:               parseRoleMap(env.GetStringOrDefault("OIDC_ROLE_MAP", "")),
+			Secret:                secret,
+		})
+		if err != nil {
+			return nil, err
+		}
+		chain = append(chain, oidc)
+	}
+	if path := env.GetStringOrDefault("AUTH_HTPASSWD_FILE", ""); path != "" {
+		htpasswd, err := auth.NewHtpasswd(path, env.GetStringOrDefault("AUTH_REALM", auth.DefaultRealm))
+		if err != nil {
+			return nil, err
+		}
+		chain = append(chain, htpasswd)
+	}
+	if token := env.GetStringOrDefault("AUTH_TOKEN", ""); token != "" {
+		chain = append(chain, auth.NewToken(token, auth.User{Name: env.GetStringOrDefault("AUTH_TOKEN_USER", "api")}))
+	}
+	switch len(chain) {
+	case 0:
+		return nil, nil
+	case 1:
+		return chain[0], nil
+	}
+	return chain, nil
+}
+
+// loadSecretResolver resolves env: references to the variables matching
+// SECRETS_ENV_ALLOW, file: references to files in SECRETS_FILE_DIRS and
+// cmd: references with the SECRETS_COMMAND helper, in any combination.
+// Nil means secret references are refused.
+func loadSecretResolver() secrets.Resolver {
+	schemes := secrets.Schemes{}
+	if allow := splitList(env.GetStringOrDefault("SECRETS_ENV_ALLOW", "")); len(allow) > 0 {
+		schemes["env"] = secrets.Env{Allow: allow}
+	}
+	if dirs := splitList(env.GetStringOrDefault("SECRETS_FILE_DIRS", "")); len(dirs) > 0 {
+		schemes["file"] = secrets.Files{Dirs: dirs}
+	}
+	if command := strings.Fields(env.GetStringOrDefault("SECRETS_COMMAND", "")); len(command) > 0 {
+		schemes["cmd"] = secrets.Command{
+			Path:    command[0],
+			Args:    command[1:],
+			Timeout: time.Duration(env.GetIntOrDefault("SECRETS_COMMAND_TIMEOUT_SECONDS", int(secrets.DefaultCommandTimeout/time.Second))) * time.Second,
+		}
+	}
+	if len(schemes) == 0 {
+		return nil
+	}
+	return schemes
+}
+
+// loadAuditSink writes the audit log to slog (unless AUDIT_SLOG is false),
+// the JSON-lines AUDIT_LOG_FILE and the AUDIT_DB_TABLE table of the
+// AUDIT_DB_DRIVER/AUDIT_DB_DSN database, in any combination
+func loadAuditSink() (audit.Sink, error) {
+	var sinks audit.Multi
+	// searchable sinks first, so the audit page reads from them
+	if dsn := env.GetStringOrDefault("AUDIT_DB_DSN", ""); dsn != "" {
+		db, err := audit.NewSQL(env.GetStringOrDefault("AUDIT_DB_DRIVER", "sqlite"), dsn, env.GetStringOrDefault("AUDIT_DB_TABLE", audit.DefaultTable))
+		if err != nil {
+			return nil, err
+		}
+		sinks = append(sinks, db)
+	}
+	if path := env.GetStringOrDefault("AUDIT_LOG_FILE", ""); path != "" {
+		file, err := audit.NewFile(path)
+		if err != nil {
+			return nil, err
+		}
+		sinks = append(sinks, file)
+	}
+	if env.GetBoolOrDefault("AUDIT_SLOG", true) {
+		sinks = append(sinks, audit.NewSlog(nil))
+	}
+	if len(sinks) == 1 {
+		return sinks[0], nil
+	}
+	return sinks, nil
+}
+
+// splitList reads a comma separated list, leaving out empty items
+func splitList(s string) []string {
+	var out []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+// parseRoleMap reads "group:role" pairs separated by commas; a group listed
+// more than once gets every role. Nil when s is empty.
+func parseRoleMap(s string) map[string][]string {
+	if strings.TrimSpace(s) == "" {
+		return nil
+	}
+	roles := map[string][]string{}
+	for _, pair := range strings.Split(s, ",") {
+		group, role, ok := strings.Cut(pair, ":")
+		if group, role = strings.TrimSpace(group), strings.TrimSpace(role); ok && group != "" && role != "" {
+			roles[group] = append(roles[group], role)
+		}
+	}
+	return roles
+}
+
+// loadBackupProfiles reads a JSON array of backup profiles
+func loadBackupProfiles(path string) ([]types.BackupProfile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read backup profiles: %v", err)
+	}
+	var profiles []types.BackupProfile
+	if err := json.Unmarshal(data, &profiles); err != nil {
+		return nil, fmt.Errorf("invalid backup profiles file %s: %v", path, err)
+	}
+	return profiles, nil
+}
+
+// loadConnectionProfiles reads the JSON array of server-side connection
+// profiles at path. IDs must be present and unique.
+func loadConnectionProfiles(path string) ([]types.ConnectionProfile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read connection profiles: %v", err)
+	}
+	var profiles []types.ConnectionProfile
+	if err := json.Unmarshal(data, &profiles); err != nil {
+		return nil, fmt.Errorf("invalid connection profiles file %s: %v", path, err)
+	}
+	seen := map[string]bool{}
+	for _, p := range profiles {
+		if p.ID == "" || p.Driver == "" || p.DSN == "" {
+			return nil, fmt.Errorf("invalid connection profiles file %s: id, driver and dsn are required", path)
+		}
+		if seen[p.ID] {
+			return nil, fmt.Errorf("invalid connection profiles file %s: duplicate id %q", path, p.ID)
+		}
+		seen[p.ID] = true
+	}
+	return profiles, nil
+}
@@ -0,0 +1,102 @@
+package page_audit
+
+import (
+	"embed"
+	"encoding/json"
+	"html/template"
+	"net/http"
+
+	"github.com/dracory/weebase/shared"
+	layout "github.com/dracory/weebase/shared/layout"
+	"github.com/dracory/weebase/shared/session"
+	"github.com/dracory/weebase/shared/types"
+	"github.com/dracory/weebase/shared/urls"
+	"github.com/gouniverse/cdn"
+	hb "github.com/gouniverse/hb"
+)
+
+const (
+	// DefaultTitle is the default page title
+	DefaultTitle = "Audit log"
+)
+
+//go:embed view.html script.js styles.css
+var embeddedFS embed.FS
+
+type pageAuditController struct {
+	config types.Config
+	// user is the signed-in operator shown in the navbar
+	user string
+}
+
+// New creates a new audit log page controller
+func New(config types.Config) *pageAuditController {
+	return &pageAuditController{config: config}
+}
+
+// ServeHTTP handles the HTTP request for the audit log page
+func (c *pageAuditController) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// the audit log spans every connection, so no connection is needed
+	c.user = session.EnsureSession(w, r, c.config.SessionSecret).User
+	html, err := c.pageHtml()
+	if err != nil {
+		http.Error(w, "Failed to render audit log page: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(html))
+}
+
+// pageHtml renders the audit log page and returns the full HTML
+func (c *pageAuditController) pageHtml() (template.HTML, error) {
+	pageCSS, err := shared.EmbeddedFileToString(embeddedFS, "styles.css")
+	if err != nil {
+		return "", err
+	}
+	pageJS, err := shared.EmbeddedFileToString(embeddedFS, "script.js")
+	if err != nil {
+		return "", err
+	}
+	pageHTML, err := shared.EmbeddedFileToString(embeddedFS, "view.html")
+	if err != nil {
+		return "", err
+	}
+
+	apiURLs := map[string]string{
+		"search": urls.ApiAuditSearch(c.config.BasePath),
+	}
+
+	extraHead := []hb.TagInterface{
+		hb.Style(pageCSS),
+	}
+
+	extraBody := []hb.TagInterface{
+		hb.ScriptURL(cdn.VueJs_3()),
+		hb.Script(`
+			window.appConfig = {
+				api: ` + string(toJSON(apiURLs)) + `
+			};
+		`),
+		hb.Script(pageJS),
+	}
+
+	return layout.RenderWith(layout.Options{
+		Title:           DefaultTitle,
+		BasePath:        c.config.BasePath,
+		SafeModeDefault: c.config.SafeModeDefault,
+		User:            c.user,
+		MainHTML:        pageHTML,
+		ExtraHead:       extraHead,
+		ExtraBodyEnd:    extraBody,
+	}), nil
+}
+
+// Helper function to convert Go values to JSON for JavaScript
+func toJSON(v interface{}) template.JS {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return template.JS("{}")
+	}
+	return template.JS(b)
+}
@@ -0,0 +1,40 @@
+// Audit log page Vue app
+(function () {
+  if (!window.Vue) return; // Vue must be injected by the page handler
+  const { createApp, ref, reactive, onMounted } = window.Vue;
+
+  createApp({
+    setup() {
+      const config = window.appConfig || { api: {} };
+      const error = ref('');
+      const busy = ref(false);
+      const entries = ref([]);
+      const filters = reactive({ operator: '', audit_action: '', outcome: '', since: '', until: '', q: '' });
+
+      const formatTime = (t) => t ? new Date(t).toLocaleString() : '';
+      const outcomeClass = (o) => o === 'success' ? 'bg-success' : o === 'denied' ? 'bg-secondary' : 'bg-danger';
+
+      const search = async () => {
+        error.value = '';
+        busy.value = true;
+        try {
+          const params = new URLSearchParams();
+          Object.entries(filters).forEach(([k, v]) => { if (v) params.append(k, v); });
+          const sep = config.api.search.includes('?') ? '&' : '?';
+          const response = await fetch(config.api.search + sep + params, { credentials: 'same-origin' });
+          const data = await response.json();
+          if (data.status !== 'success') throw new Error(data.message || 'Request failed');
+          entries.value = data.data.entries || [];
+        } catch (err) {
+          error.value = err.message || String(err);
+          entries.value = [];
+        }
+        busy.value = false;
+      };
+
+      onMounted(search);
+
+      return { error, busy, entries, filters, formatTime, outcomeClass, search };
+    }
+  }).mount('.audit-page');
+})();
@@ -0,0 +1,108 @@
+package page_backups
+
+import (
+	"embed"
+	"encoding/json"
+	"html/template"
+	"net/http"
+
+	"github.com/dracory/weebase/shared"
+	layout "github.com/dracory/weebase/shared/layout"
+	"github.com/dracory/weebase/shared/session"
+	"github.com/dracory/weebase/shared/types"
+	"github.com/dracory/weebase/shared/urls"
+	"github.com/gouniverse/cdn"
+	hb "github.com/gouniverse/hb"
+)
+
+const (
+	// DefaultTitle is the default page title
+	DefaultTitle = "Backups"
+)
+
+//go:embed view.html script.js styles.css
+var embeddedFS embed.FS
+
+type pageBackupsController struct {
+	config types.Config
+	// user is the signed-in operator shown in the navbar
+	user string
+}
+
+// New creates a new backups page controller
+func New(config types.Config) *pageBackupsController {
+	return &pageBackupsController{config: config}
+}
+
+// ServeHTTP handles the HTTP request for the backups page
+func (c *pageBackupsController) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// backups belong to server-side profiles, so no connection is needed
+	c.user = session.EnsureSession(w, r, c.config.SessionSecret).User
+	html, err := c.pageHtml()
+	if err != nil {
+		http.Error(w, "Failed to render backups page: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(html))
+}
+
+// pageHtml renders the backups page and returns the full HTML
+func (c *pageBackupsController) pageHtml() (template.HTML, error) {
+	pageCSS, err := shared.EmbeddedFileToString(embeddedFS, "styles.css")
+	if err != nil {
+		return "", err
+	}
+	pageJS, err := shared.EmbeddedFileToString(embeddedFS, "script.js")
+	if err != nil {
+		return "", err
+	}
+	pageHTML, err := shared.EmbeddedFileToString(embeddedFS, "view.html")
+	if err != nil {
+		return "", err
+	}
+
+	apiURLs := map[string]string{
+		"list":     urls.ApiBackupsList(c.config.BasePath),
+		"create":   urls.ApiBackupCreate(c.config.BasePath),
+		"restore":  urls.ApiBackupRestore(c.config.BasePath),
+		"progress": urls.ApiJobStatus(c.config.BasePath),
+	}
+
+	extraHead := []hb.TagInterface{
+		hb.Style(pageCSS),
+	}
+
+	extraBody := []hb.TagInterface{
+		hb.ScriptURL(cdn.VueJs_3()),
+		hb.Script(`
+			window.appConfig = {
+				api: ` + string(toJSON(apiURLs)) + `,
+				readOnly: ` + string(toJSON(c.config.ReadOnlyMode)) + `,
+				safeMode: ` + string(toJSON(c.config.SafeModeDefault)) + `,
+				csrfToken: "` + template.JSEscapeString(session.GenerateCSRFToken(c.config.SessionSecret)) + `"
+			};
+		`),
+		hb.Script(pageJS),
+	}
+
+	return layout.RenderWith(layout.Options{
+		Title:           DefaultTitle,
+		BasePath:        c.config.BasePath,
+		SafeModeDefault: c.config.SafeModeDefault,
+		User:            c.user,
+		MainHTML:        pageHTML,
+		ExtraHead:       extraHead,
+		ExtraBodyEnd:    extraBody,
+	}), nil
+}
+
+// Helper function to convert Go values to JSON for JavaScript
+func toJSON(v interface{}) template.JS {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return template.JS("{}")
+	}
+	return template.JS(b)
+}
@@ -0,0 +1,111 @@
+// Backups page Vue app
+(function () {
+  if (!window.Vue) return; // Vue must be injected by the page handler
+  const { createApp, ref, onMounted } = window.Vue;
+
+  createApp({
+    setup() {
+      const config = window.appConfig || { api: {} };
+      const error = ref('');
+      const message = ref('');
+      const messageOK = ref(false);
+      const busy = ref(false);
+      const profiles = ref([]);
+      const selected = ref('');
+      const backups = ref([]);
+      const job = ref(null);
+
+      const formatBytes = (n) => n < 1024 ? n + ' B' : n < 1048576 ? (n / 1024).toFixed(1) + ' KB' : (n / 1048576).toFixed(1) + ' MB';
+      const formatTime = (t) => t ? new Date(t).toLocaleString() : '';
+
+      const get = async (url, params) => {
+        const sep = url.includes('?') ? '&' : '?';
+        const response = await fetch(url + (params ? sep + new URLSearchParams(params) : ''), { credentials: 'same-origin' });
+        const data = await response.json();
+        if (data.status !== 'success') throw new Error(data.message || 'Request failed');
+        return data.data;
+      };
+
+      const post = async (url, form) => {
+        form.append('csrf_token', config.csrfToken);
+        const response = await fetch(url, { method: 'POST', body: form, credentials: 'same-origin' });
+        return response.json();
+      };
+
+      const loadProfiles = async () => {
+        try {
+          profiles.value = (await get(config.api.list)).profiles || [];
+        } catch (err) {
+          error.value = err.message || String(err);
+        }
+      };
+
+      const select = async (name) => {
+        selected.value = name;
+        try {
+          backups.value = (await get(config.api.list, { profile: name })).backups || [];
+        } catch (err) {
+          error.value = err.message || String(err);
+        }
+      };
+
+      const poll = async (id) => {
+        try {
+          job.value = (await get(config.api.progress, { job_id: id })).job;
+          if (job.value.state === 'queued' || job.value.state === 'running') {
+            setTimeout(() => poll(id), 1000);
+            return;
+          }
+          messageOK.value = job.value.state === 'done';
+          if (job.value.kind === 'backup') {
+            message.value = messageOK.value ? 'Backup ' + job.value.result.name + ' taken' : 'Backup failed: ' + job.value.error;
+          } else {
+            message.value = messageOK.value ? 'Restored ' + job.value.result.executed + ' statements' : 'Restore failed: ' + job.value.error;
+          }
+          await loadProfiles();
+          if (selected.value) await select(selected.value);
+        } catch (err) {
+          error.value = err.message || String(err);
+        }
+        busy.value = false;
+      };
+
+      const submit = async (url, form) => {
+        error.value = '';
+        message.value = '';
+        busy.value = true;
+        try {
+          const data = await post(url, form);
+          if (data.status !== 'success') throw new Error(data.message || 'Failed to start');
+          poll(data.data.job_id);
+        } catch (err) {
+          error.value = err.message || String(err);
+          busy.value = false;
+        }
+      };
+
+      const backupNow = (name) => {
+        const form = new FormData();
+        form.append('profile', name);
+        selected.value = selected.value || name;
+        submit(config.api.create, form);
+      };
+
+      const restore = (name) => {
+        if (!confirm('Restore ' + name + '? Tables in the backup are dropped and recreated.')) return;
+        const form = new FormData();
+        form.append('profile', selected.value);
+        form.append('backup', name);
+        if (config.safeMode) form.append('confirm', 'yes');
+        submit(config.api.restore, form);
+      };
+
+      onMounted(loadProfiles);
+
+      return {
+        config, error, message, messageOK, busy, profiles, selected, backups, job,
+        formatBytes, formatTime, select, backupNow, restore
+      };
+    }
+  }).mount('.backups-page');
+})();
@@ -0,0 +1,116 @@
+package page_changes
+
+import (
+	"embed"
+	"encoding/json"
+	"html/template"
+	"net/http"
+
+	"github.com/dracory/weebase/shared"
+	layout "github.com/dracory/weebase/shared/layout"
+	"github.com/dracory/weebase/shared/rbac"
+	"github.com/dracory/weebase/shared/session"
+	"github.com/dracory/weebase/shared/types"
+	"github.com/dracory/weebase/shared/urls"
+	"github.com/gouniverse/cdn"
+	hb "github.com/gouniverse/hb"
+)
+
+const (
+	// DefaultTitle is the default page title
+	DefaultTitle = "Row changes"
+)
+
+//go:embed view.html script.js styles.css
+var embeddedFS embed.FS
+
+type pageChangesController struct {
+	config types.Config
+	// user is the signed-in operator shown in the navbar
+	user string
+	// denied are the permissions the operator lacks, whose controls are hidden
+	denied []string
+}
+
+// New creates a new row changes page controller
+func New(config types.Config) *pageChangesController {
+	return &pageChangesController{config: config}
+}
+
+// ServeHTTP handles the HTTP request for the row changes page
+func (c *pageChangesController) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	sess := session.EnsureSession(w, r, c.config.SessionSecret)
+	if sess.Conn == nil || sess.Conn.Driver == "" {
+		http.Redirect(w, r, urls.PageLogin(c.config.BasePath), http.StatusFound)
+		return
+	}
+	c.user = sess.User
+	c.denied = rbac.Denied(r.Context())
+
+	html, err := c.pageHtml()
+	if err != nil {
+		http.Error(w, "Failed to render row changes page: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(html))
+}
+
+// pageHtml renders the row changes page and returns the full HTML
+func (c *pageChangesController) pageHtml() (template.HTML, error) {
+	pageCSS, err := shared.EmbeddedFileToString(embeddedFS, "styles.css")
+	if err != nil {
+		return "", err
+	}
+	pageJS, err := shared.EmbeddedFileToString(embeddedFS, "script.js")
+	if err != nil {
+		return "", err
+	}
+	pageHTML, err := shared.EmbeddedFileToString(embeddedFS, "view.html")
+	if err != nil {
+		return "", err
+	}
+
+	apiURLs := map[string]string{
+		"list": urls.ApiRowChanges(c.config.BasePath),
+		"undo": urls.ApiRowUndo(c.config.BasePath),
+	}
+
+	extraHead := []hb.TagInterface{
+		hb.Style(pageCSS),
+	}
+
+	extraBody := []hb.TagInterface{
+		hb.ScriptURL(cdn.VueJs_3()),
+		hb.Script(`
+			window.appConfig = {
+				api: ` + string(toJSON(apiURLs)) + `,
+				readOnly: ` + string(toJSON(c.config.ReadOnlyMode)) + `,
+				safeMode: ` + string(toJSON(c.config.SafeModeDefault)) + `,
+				csrfToken: "` + template.JSEscapeString(session.GenerateCSRFToken(c.config.SessionSecret)) + `"
+			};
+		`),
+		hb.Script(pageJS),
+	}
+
+	return layout.RenderWith(layout.Options{
+		Title:           DefaultTitle,
+		BasePath:        c.config.BasePath,
+		SafeModeDefault: c.config.SafeModeDefault,
+		User:            c.user,
+		Denied:          c.denied,
+		MainHTML:        pageHTML,
+		ExtraHead:       extraHead,
+		ExtraBodyEnd:    extraBody,
+	}), nil
+}
+
+// Helper function to convert Go values to JSON for JavaScript
+func toJSON(v interface{}) template.JS {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return template.JS("{}")
+	}
+	return template.JS(b)
+}
@@ -0,0 +1,69 @@
+// Row changes page Vue app
+(function () {
+  if (!window.Vue) return; // Vue must be injected by the page handler
+  const { createApp, ref, reactive, onMounted } = window.Vue;
+
+  createApp({
+    setup() {
+      const config = window.appConfig || { api: {} };
+      const error = ref('');
+      const message = ref('');
+      const busy = ref(false);
+      const changes = ref([]);
+      const params = new URLSearchParams(window.location.search);
+      const filters = reactive({ schema: params.get('schema') || '', table: params.get('table') || '' });
+
+      const formatTime = (t) => t ? new Date(t).toLocaleString() : '';
+      const show = (v) => v === null || v === undefined ? 'NULL' : typeof v === 'object' ? JSON.stringify(v) : String(v);
+
+      // an update shows the columns it changed, a delete the whole row
+      const diff = (c) => Object.keys(c.before || {})
+        .filter((col) => c.op !== 'update' || show(c.before[col]) !== show((c.after || {})[col]))
+        .map((col) => ({ column: col, before: show(c.before[col]), after: show((c.after || {})[col]) }));
+
+      const load = async () => {
+        error.value = '';
+        busy.value = true;
+        try {
+          const query = new URLSearchParams();
+          Object.entries(filters).forEach(([k, v]) => { if (v) query.append(k, v); });
+          const sep = config.api.list.includes('?') ? '&' : '?';
+          const response = await fetch(config.api.list + sep + query, { credentials: 'same-origin' });
+          const data = await response.json();
+          if (data.status !== 'success') throw new Error(data.message || 'Request failed');
+          changes.value = data.data.changes || [];
+        } catch (err) {
+          error.value = err.message || String(err);
+        }
+        busy.value = false;
+      };
+
+      const undo = async (c) => {
+        if (!confirm('Undo this ' + c.op + ' of ' + c.table + ' where ' + c.key_column + ' = ' + c.key_value + '?')) return;
+        error.value = '';
+        message.value = '';
+        busy.value = true;
+        try {
+          const form = new FormData();
+          form.append('change_id', c.id);
+          form.append('schema', c.schema || '');
+          form.append('table', c.table);
+          form.append('csrf_token', config.csrfToken);
+          if (config.safeMode) form.append('confirm', 'yes');
+          const response = await fetch(config.api.undo, { method: 'POST', body: form, credentials: 'same-origin' });
+          const data = await response.json();
+          if (data.status !== 'success') throw new Error(data.message || 'Undo failed');
+          message.value = 'The ' + c.op + ' was undone';
+        } catch (err) {
+          error.value = err.message || String(err);
+        }
+        busy.value = false;
+        await load();
+      };
+
+      onMounted(load);
+
+      return { config, error, message, busy, changes, filters, formatTime, diff, load, undo };
+    }
+  }).mount('.changes-page');
+})();
@@ -0,0 +1,116 @@
+package page_copy
+
+import (
+	"embed"
+	"encoding/json"
+	"html/template"
+	"net/http"
+
+	"github.com/dracory/weebase/shared"
+	layout "github.com/dracory/weebase/shared/layout"
+	"github.com/dracory/weebase/shared/session"
+	"github.com/dracory/weebase/shared/types"
+	"github.com/dracory/weebase/shared/urls"
+	"github.com/gouniverse/cdn"
+	hb "github.com/gouniverse/hb"
+)
+
+const (
+	// DefaultTitle is the default page title
+	DefaultTitle = "Copy table"
+)
+
+//go:embed view.html script.js styles.css
+var embeddedFS embed.FS
+
+type pageCopyController struct {
+	config types.Config
+	// user is the signed-in operator shown in the navbar
+	user string
+}
+
+// New creates a new table copy page controller
+func New(config types.Config) *pageCopyController {
+	return &pageCopyController{config: config}
+}
+
+// ServeHTTP handles the HTTP request for the table copy page
+func (c *pageCopyController) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	sess := session.EnsureSession(w, r, c.config.SessionSecret)
+	if sess.Conn == nil || sess.Conn.Driver == "" {
+		http.Redirect(w, r, urls.PageLogin(c.config.BasePath), http.StatusFound)
+		return
+	}
+	c.user = sess.User
+
+	html, err := c.pageHtml(r.URL.Query().Get("table"), r.URL.Query().Get("schema"))
+	if err != nil {
+		http.Error(w, "Failed to render copy page: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(html))
+}
+
+// pageHtml renders the copy page and returns the full HTML.
+// The table and schema preselect the copy source.
+func (c *pageCopyController) pageHtml(table, schema string) (template.HTML, error) {
+	pageCSS, err := shared.EmbeddedFileToString(embeddedFS, "styles.css")
+	if err != nil {
+		return "", err
+	}
+	pageJS, err := shared.EmbeddedFileToString(embeddedFS, "script.js")
+	if err != nil {
+		return "", err
+	}
+	pageHTML, err := shared.EmbeddedFileToString(embeddedFS, "view.html")
+	if err != nil {
+		return "", err
+	}
+
+	apiURLs := map[string]string{
+		"tables":   urls.ApiTablesList(c.config.BasePath),
+		"copy":     urls.ApiTableCopy(c.config.BasePath),
+		"progress": urls.ApiJobStatus(c.config.BasePath),
+	}
+
+	extraHead := []hb.TagInterface{
+		hb.Style(pageCSS),
+	}
+
+	extraBody := []hb.TagInterface{
+		hb.ScriptURL(cdn.VueJs_3()),
+		hb.Script(`
+			window.appConfig = {
+				api: ` + string(toJSON(apiURLs)) + `,
+				table: ` + string(toJSON(table)) + `,
+				schema: ` + string(toJSON(schema)) + `,
+				drivers: ` + string(toJSON(c.config.EnabledDrivers)) + `,
+				adHoc: ` + string(toJSON(c.config.AllowAdHocConnections)) + `,
+				safeMode: ` + string(toJSON(c.config.SafeModeDefault)) + `,
+				csrfToken: "` + template.JSEscapeString(session.GenerateCSRFToken(c.config.SessionSecret)) + `"
+			};
+		`),
+		hb.Script(pageJS),
+	}
+
+	return layout.RenderWith(layout.Options{
+		Title:           DefaultTitle,
+		BasePath:        c.config.BasePath,
+		SafeModeDefault: c.config.SafeModeDefault,
+		User:            c.user,
+		MainHTML:        pageHTML,
+		ExtraHead:       extraHead,
+		ExtraBodyEnd:    extraBody,
+	}), nil
+}
+
+// Helper function to convert Go values to JSON for JavaScript
+func toJSON(v interface{}) template.JS {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return template.JS("{}")
+	}
+	return template.JS(b)
+}
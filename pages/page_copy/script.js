@@ -0,0 +1,161 @@
+// Copy page Vue app
+(function () {
+  if (!window.Vue) return; // Vue must be injected by the page handler
+  const { createApp, ref, reactive, computed, onMounted } = window.Vue;
+
+  createApp({
+    setup() {
+      const config = window.appConfig || { api: {}, drivers: [] };
+      const error = ref('');
+      const busy = ref(false);
+      const direction = ref('push');
+      const other = reactive({ driver: '', dsn: '' });
+      const sourceKind = ref('table');
+      const source = reactive({ schema: config.schema || '', table: config.table || '' });
+      const target = reactive({ schema: '', table: '' });
+      const query = ref('');
+      const tables = ref([]);
+      const mode = ref('append');
+      const batchSize = ref(500);
+      const job = ref(null);
+      const result = ref(null);
+      const message = ref('');
+      const resultOK = ref(false);
+
+      // the session's connection is the source unless copying into it from elsewhere
+      const sourceIsSession = computed(() => direction.value === 'push' || !other.driver);
+
+      const percent = computed(() => {
+        if (!job.value) return 0;
+        if (job.value.state === 'queued') return 0;
+        if (job.value.state !== 'running') return 100;
+        const r = job.value.result;
+        return r && r.total ? Math.min(100, Math.floor(r.rows * 100 / r.total)) : 100;
+      });
+
+      const loadTables = async () => {
+        try {
+          const sep = config.api.tables.includes('?') ? '&' : '?';
+          const response = await fetch(config.api.tables + sep + 'schema=' + encodeURIComponent(source.schema), {
+            credentials: 'same-origin'
+          });
+          const data = await response.json();
+          if (data.status !== 'success') throw new Error(data.message || 'Failed to load tables');
+          tables.value = (data.data.tables || []).filter(t => !t.kind || t.kind === 'table');
+        } catch (err) {
+          error.value = err.message || String(err);
+        }
+      };
+
+      const post = async (url, form) => {
+        form.append('csrf_token', config.csrfToken);
+        const response = await fetch(url, { method: 'POST', body: form, credentials: 'same-origin' });
+        return response.json();
+      };
+
+      const start = async () => {
+        error.value = '';
+        result.value = null;
+        job.value = null;
+        const targetTable = target.table || source.table;
+        if (config.safeMode && !confirm('Copy rows into ' + targetTable + '?')) return;
+        busy.value = true;
+        try {
+          const form = new FormData();
+          if (other.driver) {
+            const prefix = direction.value === 'push' ? 'target_' : 'source_';
+            form.append(prefix + 'driver', other.driver);
+            form.append(prefix + 'dsn', other.dsn);
+          }
+          if (sourceKind.value === 'query') {
+            form.append('query', query.value);
+          } else {
+            form.append('source_schema', source.schema);
+            form.append('source_table', source.table);
+          }
+          form.append('target_schema', target.schema);
+          form.append('target_table', targetTable);
+          form.append('mode', mode.value);
+          form.append('batch_size', String(batchSize.value));
+          form.append('async', 'yes');
+          if (config.safeMode) form.append('confirm', 'yes');
+
+          const data = await post(config.api.copy, form);
+          if (data.status !== 'success') throw new Error(data.message || 'Failed to start the copy');
+          poll(data.data.job_id);
+        } catch (err) {
+          error.value = err.message || String(err);
+          busy.value = false;
+        }
+      };
+
+      const poll = async (id) => {
+        try {
+          const sep = config.api.progress.includes('?') ? '&' : '?';
+          const response = await fetch(config.api.progress + sep + 'job_id=' + encodeURIComponent(id), {
+            credentials: 'same-origin'
+          });
+          const data = await response.json();
+          if (data.status !== 'success') throw new Error(data.message || 'Failed to read progress');
+          job.value = data.data.job;
+          if (job.value.state === 'queued' || job.value.state === 'running') {
+            setTimeout(() => poll(id), 1000);
+            return;
+          }
+          report(job.value);
+        } catch (err) {
+          error.value = err.message || String(err);
+        }
+        busy.value = false;
+      };
+
+      const report = (j) => {
+        const r = j.result || { copied: 0, failed: 0, errors: [] };
+        result.value = r;
+        resultOK.value = j.state === 'done' && r.committed;
+        if (j.state === 'failed') message.value = 'Copy failed: ' + j.error;
+        else if (j.state === 'cancelled') message.value = 'Copy stopped; nothing was committed';
+        else if (!r.committed) message.value = 'Copy rolled back: ' + r.failed + ' rows rejected';
+        else message.value = 'Copied ' + r.copied + ' rows' + (r.created ? ' into a new table' : '');
+      };
+
+      const cancel = async () => {
+        if (!job.value) return;
+        const form = new FormData();
+        form.append('job_id', job.value.id);
+        form.append('cancel', 'yes');
+        try {
+          await post(config.api.progress, form);
+        } catch (err) {
+          error.value = err.message || String(err);
+        }
+      };
+
+      onMounted(loadTables);
+
+      return {
+        config,
+        error,
+        busy,
+        direction,
+        other,
+        sourceKind,
+        source,
+        target,
+        query,
+        tables,
+        mode,
+        batchSize,
+        job,
+        result,
+        message,
+        resultOK,
+        sourceIsSession,
+        percent,
+        loadTables,
+        start,
+        cancel
+      };
+    }
+  }).mount('.copy-page');
+})();
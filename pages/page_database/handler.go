@@ -26,6 +26,8 @@ var embeddedFS embed.FS
 
 type pageDatabaseController struct {
 	config types.Config
+	// user is the signed-in operator shown in the navbar
+	user string
 }
 
 func New(config types.Config) *pageDatabaseController {
@@ -34,6 +36,7 @@ func New(config types.Config) *pageDatabaseController {
 
 // ServeHTTP handles the HTTP request for the database browser page
 func (c *pageDatabaseController) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	c.user = session.EnsureSession(w, r, c.config.SessionSecret).User
 	html, err := c.pageHtml()
 	if err != nil {
 		http.Error(w, "Failed to render database page: "+err.Error(), http.StatusInternalServerError)
@@ -107,6 +110,7 @@ func (c pageDatabaseController) pageHtml() (template.HTML, error) {
 		Title:           DefaultTitle,
 		BasePath:        c.config.BasePath,
 		SafeModeDefault: c.config.SafeModeDefault,
+		User:            c.user,
 		MainHTML:        pageHTML,
 		ExtraHead:       extraHead,
 		ExtraBodyEnd:    extraBody,
@@ -0,0 +1,113 @@
+package page_export
+
+import (
+	"embed"
+	"encoding/json"
+	"html/template"
+	"net/http"
+
+	"github.com/dracory/weebase/shared"
+	layout "github.com/dracory/weebase/shared/layout"
+	"github.com/dracory/weebase/shared/session"
+	"github.com/dracory/weebase/shared/types"
+	"github.com/dracory/weebase/shared/urls"
+	"github.com/gouniverse/cdn"
+	hb "github.com/gouniverse/hb"
+)
+
+const (
+	// DefaultTitle is the default page title
+	DefaultTitle = "Export"
+)
+
+//go:embed view.html script.js styles.css
+var embeddedFS embed.FS
+
+type pageExportController struct {
+	config types.Config
+	// user is the signed-in operator shown in the navbar
+	user string
+}
+
+// New creates a new export page controller
+func New(config types.Config) *pageExportController {
+	return &pageExportController{config: config}
+}
+
+// ServeHTTP handles the HTTP request for the export page
+func (c *pageExportController) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	sess := session.EnsureSession(w, r, c.config.SessionSecret)
+	if sess.Conn == nil || sess.Conn.Driver == "" {
+		http.Redirect(w, r, urls.PageLogin(c.config.BasePath), http.StatusFound)
+		return
+	}
+	c.user = sess.User
+
+	html, err := c.pageHtml(r.URL.Query().Get("table"), r.URL.Query().Get("schema"))
+	if err != nil {
+		http.Error(w, "Failed to render export page: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(html))
+}
+
+// pageHtml renders the export page and returns the full HTML.
+// The table and schema preselect the export source.
+func (c *pageExportController) pageHtml(table, schema string) (template.HTML, error) {
+	pageCSS, err := shared.EmbeddedFileToString(embeddedFS, "styles.css")
+	if err != nil {
+		return "", err
+	}
+	pageJS, err := shared.EmbeddedFileToString(embeddedFS, "script.js")
+	if err != nil {
+		return "", err
+	}
+	pageHTML, err := shared.EmbeddedFileToString(embeddedFS, "view.html")
+	if err != nil {
+		return "", err
+	}
+
+	apiURLs := map[string]string{
+		"tables": urls.ApiTablesList(c.config.BasePath),
+		"export": urls.ApiExport(c.config.BasePath),
+		"dump":   urls.ApiDump(c.config.BasePath),
+	}
+
+	extraHead := []hb.TagInterface{
+		hb.Style(pageCSS),
+	}
+
+	extraBody := []hb.TagInterface{
+		hb.ScriptURL(cdn.VueJs_3()),
+		hb.Script(`
+			window.appConfig = {
+				api: ` + string(toJSON(apiURLs)) + `,
+				table: ` + string(toJSON(table)) + `,
+				schema: ` + string(toJSON(schema)) + `,
+				csrfToken: "` + template.JSEscapeString(session.GenerateCSRFToken(c.config.SessionSecret)) + `"
+			};
+		`),
+		hb.Script(pageJS),
+	}
+
+	return layout.RenderWith(layout.Options{
+		Title:           DefaultTitle,
+		BasePath:        c.config.BasePath,
+		SafeModeDefault: c.config.SafeModeDefault,
+		User:            c.user,
+		MainHTML:        pageHTML,
+		ExtraHead:       extraHead,
+		ExtraBodyEnd:    extraBody,
+	}), nil
+}
+
+// Helper function to convert Go values to JSON for JavaScript
+func toJSON(v interface{}) template.JS {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return template.JS("{}")
+	}
+	return template.JS(b)
+}
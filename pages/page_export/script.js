@@ -0,0 +1,160 @@
+// Export page Vue app
+(function () {
+  if (!window.Vue) return; // Vue must be injected by the page handler
+  const { createApp, ref, reactive, computed, onMounted } = window.Vue;
+
+  createApp({
+    setup() {
+      const config = window.appConfig || { api: {} };
+      const error = ref('');
+      const source = ref('table');
+      const schema = ref(config.schema || '');
+      const table = ref(config.table || '');
+      const tables = ref([]);
+      const columns = ref('');
+      const filters = ref([]);
+      const order = ref('');
+      const orderDir = ref('asc');
+      const limit = ref('');
+      const offset = ref('');
+      const sql = ref('');
+      const format = ref('csv');
+      const csv = reactive({ delimiter: ',', quoting: 'minimal', null: '', encoding: 'utf-8', header: true });
+      const dump = reactive({ tables: [], data: [], structure: 'drop_create', batchSize: 100, gzip: false, output: 'sql' });
+      const sheetRows = ref('');
+      const isXLSX = computed(() => source.value === 'dump' ? dump.output === 'xlsx' : format.value === 'xlsx');
+      const operators = ['=', '!=', '<', '<=', '>', '>=', 'like', 'not like', 'is null', 'is not null'];
+
+      const loadTables = async () => {
+        error.value = '';
+        try {
+          const sep = config.api.tables.includes('?') ? '&' : '?';
+          const response = await fetch(config.api.tables + sep + 'schema=' + encodeURIComponent(schema.value), {
+            credentials: 'same-origin'
+          });
+          const data = await response.json();
+          if (data.status !== 'success') throw new Error(data.message || 'Failed to load tables');
+          tables.value = data.data.tables || [];
+          dump.tables = tables.value.map(t => t.name);
+          dump.data = tables.value.filter(t => !t.kind || t.kind === 'table').map(t => t.name);
+        } catch (err) {
+          error.value = err.message || String(err);
+        }
+      };
+
+      // The dump table list has a select-all checkbox per column
+      const selectable = (key) => key === 'data'
+        ? tables.value.filter(t => !t.kind || t.kind === 'table').map(t => t.name)
+        : tables.value.map(t => t.name);
+      const allSelected = (key) => selectable(key).length > 0 && selectable(key).every(name => dump[key].includes(name));
+      const selectAll = (key, checked) => { dump[key] = checked ? selectable(key) : []; };
+
+      const addFilter = () => filters.value.push({ column: '', op: '=', value: '' });
+
+      // Builds the dump parameters; leaving tables[] out dumps everything
+      const dumpParams = () => {
+        const p = [['schema', schema.value], ['structure', dump.structure], ['batch_size', String(dump.batchSize)], ['csrf_token', config.csrfToken]];
+        if (!allSelected('tables')) dump.tables.forEach(name => p.push(['tables[]', name]));
+        selectable('data').filter(name => dump.tables.includes(name) && !dump.data.includes(name))
+          .forEach(name => p.push(['no_data[]', name]));
+        if (dump.gzip) p.push(['gzip', 'yes']);
+        return p;
+      };
+
+      // A workbook of the selected tables goes through the export API, one sheet each
+      const workbookParams = () => {
+        const p = [['format', 'xlsx'], ['schema', schema.value], ['csrf_token', config.csrfToken]];
+        dump.tables.forEach(name => p.push(['tables[]', name]));
+        if (sheetRows.value !== '') p.push(['sheet_rows', String(sheetRows.value)]);
+        return p;
+      };
+
+      // Builds the export parameters for the chosen source and format
+      const params = () => {
+        const p = [['format', format.value], ['csrf_token', config.csrfToken]];
+        if (source.value === 'sql') {
+          p.push(['sql', sql.value]);
+        } else {
+          p.push(['schema', schema.value], ['table', table.value], ['columns', columns.value]);
+          filters.value.filter(f => f.column).forEach(f => {
+            p.push(['filter_column[]', f.column], ['filter_op[]', f.op], ['filter_value[]', f.value]);
+          });
+          if (order.value) p.push(['order', order.value], ['order_dir', orderDir.value]);
+          if (limit.value !== '') p.push(['limit', String(limit.value)]);
+          if (offset.value !== '') p.push(['offset', String(offset.value)]);
+        }
+        if (format.value === 'csv') {
+          p.push(['delimiter', csv.delimiter], ['quoting', csv.quoting], ['null', csv.null], ['encoding', csv.encoding]);
+          p.push(['header', csv.header ? 'yes' : 'no']);
+        }
+        if (format.value === 'xlsx' && sheetRows.value !== '') p.push(['sheet_rows', String(sheetRows.value)]);
+        return p;
+      };
+
+      // A real form post lets the browser stream the download instead of buffering it in memory
+      const submit = () => {
+        error.value = '';
+        if (source.value === 'table' && !table.value) { error.value = 'Select a table'; return; }
+        if (source.value === 'sql' && !sql.value.trim()) { error.value = 'Enter a query'; return; }
+        if (source.value === 'dump' && dump.tables.length === 0) { error.value = 'Select at least one table'; return; }
+
+        const form = document.createElement('form');
+        form.method = 'POST';
+        const sqlDump = source.value === 'dump' && dump.output === 'sql';
+        form.action = sqlDump ? config.api.dump : config.api.export;
+        form.target = 'export-frame';
+        (sqlDump ? dumpParams() : source.value === 'dump' ? workbookParams() : params()).forEach(([name, value]) => {
+          const input = document.createElement('input');
+          input.type = 'hidden';
+          input.name = name;
+          input.value = value;
+          form.appendChild(input);
+        });
+        document.body.appendChild(form);
+        form.submit();
+        form.remove();
+      };
+
+      // Attachments never load into the frame, so a load means the API answered with an error
+      const frameLoaded = (event) => {
+        try {
+          const text = event.target.contentDocument && event.target.contentDocument.body.textContent;
+          if (!text) return;
+          const data = JSON.parse(text);
+          if (data.status !== 'success') error.value = data.message || 'Export failed';
+        } catch (err) {
+          // not a JSON answer; nothing to report
+        }
+      };
+
+      onMounted(loadTables);
+
+      return {
+        error,
+        source,
+        schema,
+        table,
+        tables,
+        columns,
+        filters,
+        order,
+        orderDir,
+        limit,
+        offset,
+        sql,
+        format,
+        csv,
+        dump,
+        sheetRows,
+        isXLSX,
+        operators,
+        loadTables,
+        allSelected,
+        selectAll,
+        addFilter,
+        submit,
+        frameLoaded
+      };
+    }
+  }).mount('.export-page');
+})();
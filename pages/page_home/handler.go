@@ -7,6 +7,7 @@ import (
 
 	"github.com/dracory/weebase/shared"
 	layout "github.com/dracory/weebase/shared/layout"
+	"github.com/dracory/weebase/shared/rbac"
 	"github.com/dracory/weebase/shared/session"
 	"github.com/dracory/weebase/shared/types"
 	"github.com/dracory/weebase/shared/urls"
@@ -18,6 +19,10 @@ var embeddedFS embed.FS
 
 type pageHomeController struct {
 	cfg types.Config
+	// user is the signed-in operator shown in the navbar
+	user string
+	// denied are the permissions the operator lacks, whose controls are hidden
+	denied []string
 }
 
 // New creates a new page home controller
@@ -46,6 +51,8 @@ func (h *pageHomeController) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Connection is valid, continue processing the home page
+	h.user = sess.User
+	h.denied = rbac.Denied(r.Context())
 
 	html, err := h.Handle()
 	if err != nil {
@@ -62,12 +69,24 @@ func (h *pageHomeController) buildSidebar() string {
 	urlSQLExecute := urls.PageSQLExecute(h.cfg.BasePath)
 	urlImport := urls.PageImport(h.cfg.BasePath)
 	urlExport := urls.PageExport(h.cfg.BasePath)
+	urlCopy := urls.PageCopy(h.cfg.BasePath)
+	urlBackups := urls.PageBackups(h.cfg.BasePath)
+	urlAudit := urls.PageAudit(h.cfg.BasePath)
+	urlChanges := urls.PageChanges(h.cfg.BasePath)
+	urlTokens := urls.PageTokens(h.cfg.BasePath)
 	urlPageTableCreate := urls.PageTableCreate(h.cfg.BasePath)
+	urlRoutines := urls.PageRoutines(h.cfg.BasePath)
 
 	linkSQLExecute := hb.A().Class("nav-link text-dark").Href(urlSQLExecute).Text("SQL command").Attr("title", "Open SQL console")
 	linkImport := hb.A().Class("nav-link text-dark").Href(urlImport).Text("Import").Attr("title", "Import data")
 	linkExport := hb.A().Class("nav-link text-dark").Href(urlExport).Text("Export").Attr("title", "Export data")
+	linkCopy := hb.A().Class("nav-link text-dark").Href(urlCopy).Text("Copy table").Attr("title", "Copy a table to another connection")
+	linkBackups := hb.A().Class("nav-link text-dark").Href(urlBackups).Text("Backups").Attr("title", "Scheduled backups of configured profiles")
+	linkChanges := hb.A().Class("nav-link text-dark").Href(urlChanges).Text("Row changes").Attr("title", "Edits made through the UI, with undo")
+	linkTokens := hb.A().Class("nav-link text-dark").Href(urlTokens).Text("API tokens").Attr("title", "Tokens for scripts calling the JSON API")
+	linkAudit := hb.A().Class("nav-link text-dark").Href(urlAudit).Text("Audit log").Attr("title", "Who changed data or ran SQL")
 	linkTableCreate := hb.A().Class("nav-link text-dark").Href(urlPageTableCreate).Attr("title", "Create table").Text("Create table")
+	linkRoutines := hb.A().Class("nav-link text-dark").Href(urlRoutines).Attr("title", "Browse stored procedures and functions").Text("Routines")
 
 	// Quick actions links
 	quickLinks := hb.UL().
@@ -76,7 +95,13 @@ func (h *pageHomeController) buildSidebar() string {
 			hb.LI().Class("nav-item").Child(linkSQLExecute),
 			hb.LI().Class("nav-item").Child(linkImport),
 			hb.LI().Class("nav-item").Child(linkExport),
+			hb.LI().Class("nav-item").Child(linkCopy),
+			hb.LI().Class("nav-item").Child(linkBackups),
+			hb.LI().Class("nav-item").Child(linkChanges),
+			hb.LI().Class("nav-item").Attr("data-permission", "audit").Child(linkAudit),
+			hb.LI().Class("nav-item").Child(linkTokens),
 			hb.LI().Class("nav-item").Child(linkTableCreate),
+			hb.LI().Class("nav-item").Child(linkRoutines),
 		})
 
 	// Database objects section
@@ -127,6 +152,8 @@ func (h *pageHomeController) Handle() (template.HTML, error) {
 		Title:           "WeeBase - Home",
 		BasePath:        h.cfg.BasePath,
 		SafeModeDefault: false,
+		User:            h.user,
+		Denied:          h.denied,
 		MainHTML:        "<div id='main-app'></div>",
 		SidebarHTML:     "<div id='sidebar-app'></div>",
 		ExtraHead: []hb.TagInterface{
@@ -21,39 +21,41 @@ export default {
             <thead class="bg-gray-50">
               <tr>
                 <th class="px-4 py-2 text-left">Table</th>
+                <th class="px-4 py-2 text-left">Type</th>
                 <th class="px-4 py-2 text-left">Rows</th>
                 <th class="px-4 py-2">Actions</th>
               </tr>
             </thead>
             <tbody class="divide-y divide-gray-200">
               <tr v-if="loading">
-                <td colspan="3" class="px-4 py-4 text-center text-gray-500">
+                <td colspan="4" class="px-4 py-4 text-center text-gray-500">
                   Loading tables...
                 </td>
               </tr>
               <tr v-else-if="error">
-                <td colspan="3" class="px-4 py-4 text-center text-red-600">
+                <td colspan="4" class="px-4 py-4 text-center text-red-600">
                   {{ error }}
                 </td>
               </tr>
               <tr v-else-if="filteredTables.length === 0">
-                <td colspan="3" class="px-4 py-4 text-center text-gray-500">
+                <td colspan="4" class="px-4 py-4 text-center text-gray-500">
                   No tables found
                 </td>
               </tr>
-              <tr v-else v-for="table in filteredTables" :key="table" class="hover:bg-gray-50">
+              <tr v-else v-for="table in filteredTables" :key="table.name" class="hover:bg-gray-50">
                 <td class="px-4 py-3">
                   <a 
-                    :href="getTableUrl(table)" 
+                    :href="getTableUrl(table.name)" 
                     class="text-blue-600 hover:underline"
                   >
-                    {{ table }}
+                    {{ table.name }}
                   </a>
                 </td>
+                <td class="px-4 py-3 text-gray-500">{{ kindLabel(table.kind) }}</td>
                 <td class="px-4 py-3 text-gray-500">—</td>
                 <td class="px-4 py-3 text-center">
                   <a 
-                    :href="getTableUrl(table)" 
+                    :href="getTableUrl(table.name)" 
                     class="text-blue-600 hover:underline"
                   >
                     View
@@ -79,7 +81,7 @@ export default {
       if (!this.searchQuery) return this.tables;
       const query = this.searchQuery.toLowerCase();
       return this.tables.filter(table => 
-        table.toLowerCase().includes(query)
+        table.name.toLowerCase().includes(query)
       );
     }
   },
@@ -101,6 +103,16 @@ export default {
         this.loading = false;
       }
     },
+    kindLabel(kind) {
+      const labels = {
+        table: 'Table',
+        view: 'View',
+        materialized_view: 'Materialized view',
+        foreign_table: 'Foreign table',
+        system: 'System'
+      };
+      return labels[kind] || kind;
+    },
     getTableUrl(table) {
       const base = window.urlTable || window.urlBrowseBase || '';
       const separator = base.includes('?') ? '&' : '?';
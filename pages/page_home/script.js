@@ -35,8 +35,8 @@
         this.tables.forEach(function(t){
           var li = document.createElement('li');
           var a = document.createElement('a');
-          a.textContent = 'select ' + t;
-          a.href = base + (base.indexOf('?') > -1 ? '&' : '?') + 'table=' + encodeURIComponent(t);
+          a.textContent = 'select ' + t.name;
+          a.href = base + (base.indexOf('?') > -1 ? '&' : '?') + 'table=' + encodeURIComponent(t.name);
           a.className = 'hover:underline';
           li.appendChild(a);
           el.appendChild(li);
@@ -79,13 +79,13 @@
         function renderRows(filter){
           tbody.innerHTML='';
           rows.forEach(function(t){
-            if (filter && t.toLowerCase().indexOf(filter.toLowerCase()) === -1) return;
+            if (filter && t.name.toLowerCase().indexOf(filter.toLowerCase()) === -1) return;
             var tr = document.createElement('tr');
             var tdName = document.createElement('td'); tdName.className='px-2 py-1 border';
             var a = document.createElement('a'); 
             a.className = 'text-blue-700 hover:underline'; 
-            a.textContent = t; 
-            a.href = base + (base.indexOf('?') > -1 ? '&' : '?') + 'table=' + encodeURIComponent(t);
+            a.textContent = t.name; 
+            a.href = base + (base.indexOf('?') > -1 ? '&' : '?') + 'table=' + encodeURIComponent(t.name);
             tdName.appendChild(a);
             var tdRows = document.createElement('td'); tdRows.className='px-2 py-1 border'; tdRows.textContent='—';
             var tdAct = document.createElement('td'); tdAct.className='px-2 py-1 border text-center';
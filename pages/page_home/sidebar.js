@@ -12,13 +12,14 @@ export default {
         <li v-else-if="tables.length === 0" class="nav-item">
           <span class="nav-link text-muted">No tables</span>
         </li>
-        <li v-else v-for="table in tables" :key="table" class="nav-item">
+        <li v-else v-for="table in tables" :key="table.name" class="nav-item">
           <a 
-            :href="getTableUrl(table)" 
+            :href="getTableUrl(table.name)" 
             class="nav-link text-dark hover:underline"
-            :title="'Select ' + table"
+            :title="'Select ' + table.name"
           >
-            {{ table }}
+            <i v-if="table.kind !== 'table'" class="bi bi-eye me-1" :title="table.kind"></i>
+            {{ table.name }}
           </a>
         </li>
       </ul>
@@ -0,0 +1,302 @@
+// Import page Vue app
+(function () {
+  if (!window.Vue) return; // Vue must be injected by the page handler
+  const { createApp, ref, reactive, computed, watch, onMounted } = window.Vue;
+
+  createApp({
+    setup() {
+      const config = window.appConfig || { api: {} };
+      const error = ref('');
+      const busy = ref(false);
+      const kind = ref('data');
+      const file = ref(null);
+      const upload = ref(null);
+      const format = ref('');
+      const csv = reactive({ delimiter: 'auto', encoding: 'utf-8', null: '', header: true });
+      const sample = reactive({ format: '', delimiter: '', headers: [], rows: [], columns: [] });
+      const schema = ref(config.schema || '');
+      const table = ref(config.table || '');
+      const tables = ref([]);
+      const columns = ref([]);
+      const mapping = ref({});
+      const createTable = ref(false);
+      const newColumns = ref([]);
+      const mode = ref('insert');
+      const batchSize = ref(100);
+      const skipErrors = ref(false);
+      const job = ref(null);
+      const result = ref(null);
+      const message = ref('');
+      const resultOK = ref(false);
+      const script = ref(null);
+      const continueOnError = ref(false);
+      const summary = ref(null);
+
+      const isCSV = computed(() => format.value === 'csv' ||
+        (format.value === '' && (sample.format === 'csv' || (file.value && /\.(csv|tsv|txt)$/i.test(file.value.name)))));
+
+      const percent = computed(() => {
+        if (!job.value) return 0;
+        if (job.value.state === 'queued') return 0;
+        if (job.value.state !== 'running') return 100;
+        return job.value.size ? Math.min(100, Math.floor(job.value.bytes_read * 100 / job.value.size)) : 0;
+      });
+
+      const formatBytes = (n) => n < 1024 ? n + ' B' : n < 1048576 ? (n / 1024).toFixed(1) + ' KB' : (n / 1048576).toFixed(1) + ' MB';
+
+      const post = async (url, form) => {
+        form.append('csrf_token', config.csrfToken);
+        const response = await fetch(url, { method: 'POST', body: form, credentials: 'same-origin' });
+        return response.json();
+      };
+
+      const loadTables = async () => {
+        try {
+          const sep = config.api.tables.includes('?') ? '&' : '?';
+          const response = await fetch(config.api.tables + sep + 'schema=' + encodeURIComponent(schema.value), {
+            credentials: 'same-origin'
+          });
+          const data = await response.json();
+          if (data.status !== 'success') throw new Error(data.message || 'Failed to load tables');
+          tables.value = (data.data.tables || []).filter(t => !t.kind || t.kind === 'table');
+        } catch (err) {
+          error.value = err.message || String(err);
+        }
+      };
+
+      const fileChosen = (event) => {
+        file.value = event.target.files[0] || null;
+        upload.value = null;
+      };
+
+      // The first preview uploads the file; later ones reuse it with the current options
+      const preview = async () => {
+        error.value = '';
+        busy.value = true;
+        try {
+          const form = new FormData();
+          if (upload.value) {
+            form.append('upload_id', upload.value.id);
+          } else {
+            form.append('file', file.value);
+          }
+          form.append('format', format.value);
+          Object.entries(csvParams()).forEach(([k, v]) => form.append(k, v));
+          form.append('schema', schema.value);
+          if (!createTable.value) form.append('table', table.value);
+
+          const data = await post(config.api.preview, form);
+          if (data.status !== 'success') throw new Error(data.message || 'Preview failed');
+          upload.value = data.data.upload;
+          Object.assign(sample, data.data.preview);
+          columns.value = data.data.columns || [];
+          mapping.value = data.data.mapping || Object.fromEntries(sample.headers.map(h => [h, '']));
+          newColumns.value = sample.columns.map(c => ({
+            field: c.name, include: true, name: c.name, type: c.type, nullable: c.nullable, pk: false
+          }));
+        } catch (err) {
+          error.value = err.message || String(err);
+        } finally {
+          busy.value = false;
+        }
+      };
+
+      const csvParams = () => ({
+        delimiter: csv.delimiter,
+        encoding: csv.encoding,
+        null: csv.null,
+        header: csv.header ? 'yes' : 'no'
+      });
+
+      const importForm = (dryRun) => {
+        const form = new FormData();
+        form.append('upload_id', upload.value.id);
+        form.append('format', sample.format);
+        Object.entries(csvParams()).forEach(([k, v]) => form.append(k, v));
+        form.append('schema', schema.value);
+        form.append('table', table.value);
+        form.append('mode', mode.value);
+        form.append('batch_size', String(batchSize.value));
+        if (skipErrors.value) form.append('skip_errors', 'yes');
+        if (dryRun) form.append('dry_run', 'yes');
+
+        if (createTable.value) {
+          const included = newColumns.value.filter(c => c.include);
+          form.append('create_table', 'yes');
+          form.append('mapping', JSON.stringify(Object.fromEntries(newColumns.value.map(c => [c.field, c.include ? c.name : '']))));
+          included.forEach((c, i) => {
+            form.append('col_name[]', c.name);
+            form.append('col_type[]', c.type);
+            if (c.nullable) form.append('col_nullable[]', String(i + 1));
+            if (c.pk) form.append('col_pk[]', String(i + 1));
+          });
+        } else {
+          form.append('mapping', JSON.stringify(mapping.value));
+        }
+        return form;
+      };
+
+      const finish = (data) => {
+        result.value = (data.data && (data.data.result || (data.data.job && data.data.job.result))) || null;
+        message.value = data.message;
+        resultOK.value = data.status === 'success';
+      };
+
+      // Dry runs answer straight away; real imports run in the background and are polled
+      const start = async (dryRun) => {
+        error.value = '';
+        result.value = null;
+        job.value = null;
+        let confirmReplace = '';
+        if (!dryRun && mode.value === 'replace') {
+          confirmReplace = prompt('Replace deletes every row of ' + table.value + ' first. Type the table name to confirm:') || '';
+          if (confirmReplace !== table.value) return;
+        } else if (!dryRun && config.safeMode && !confirm('Import into ' + table.value + '?')) return;
+        busy.value = true;
+        try {
+          const form = importForm(dryRun);
+          if (!dryRun) {
+            form.append('async', 'yes');
+            if (config.safeMode) form.append('confirm', 'yes');
+            if (confirmReplace) form.append('confirm_replace', confirmReplace);
+          }
+          const data = await post(config.api.import, form);
+          if (dryRun || data.status !== 'success') {
+            finish(data);
+            busy.value = false;
+            return;
+          }
+          poll(data.data.job_id, reportJob);
+        } catch (err) {
+          error.value = err.message || String(err);
+          busy.value = false;
+        }
+      };
+
+      const scriptChosen = (event) => {
+        script.value = event.target.files[0] || null;
+      };
+
+      // Scripts always run in the background; every statement is checked against safe mode on the server
+      const runScript = async () => {
+        error.value = '';
+        summary.value = null;
+        job.value = null;
+        if (config.safeMode && !confirm('Run ' + script.value.name + ' against the current database?')) return;
+        busy.value = true;
+        try {
+          const form = new FormData();
+          form.append('file', script.value);
+          form.append('async', 'yes');
+          if (continueOnError.value) form.append('continue_on_error', 'yes');
+          if (config.safeMode) form.append('confirm', 'yes');
+          const data = await post(config.api.sqlImport, form);
+          if (data.status !== 'success') throw new Error(data.message || 'Failed to start the script');
+          poll(data.data.job_id, reportScript);
+        } catch (err) {
+          error.value = err.message || String(err);
+          busy.value = false;
+        }
+      };
+
+      const reportScript = (j) => {
+        const s = j.result || { executed: 0, failed: 0, errors: [] };
+        summary.value = s;
+        resultOK.value = j.state === 'done' && s.failed === 0;
+        if (j.state === 'failed') message.value = 'Script failed: ' + j.error;
+        else if (j.state === 'cancelled') message.value = 'Stopped after ' + s.executed + ' statements';
+        else if (s.stopped) message.value = 'Stopped at the first failed statement after ' + s.executed + ' statements';
+        else message.value = 'Executed ' + s.executed + ' statements' + (s.failed ? ', ' + s.failed + ' failed' : '');
+      };
+
+      const poll = async (id, done) => {
+        try {
+          const sep = config.api.progress.includes('?') ? '&' : '?';
+          const response = await fetch(config.api.progress + sep + 'job_id=' + encodeURIComponent(id), {
+            credentials: 'same-origin'
+          });
+          const data = await response.json();
+          if (data.status !== 'success') throw new Error(data.message || 'Failed to read progress');
+          job.value = data.data.job;
+          if (job.value.state === 'queued' || job.value.state === 'running') {
+            setTimeout(() => poll(id, done), 1000);
+            return;
+          }
+          done(job.value);
+        } catch (err) {
+          error.value = err.message || String(err);
+        }
+        busy.value = false;
+      };
+
+      const reportJob = (j) => {
+        const r = j.result;
+        result.value = r;
+        resultOK.value = j.state === 'done' && r.committed;
+        if (j.state === 'failed') message.value = 'Import failed: ' + j.error;
+        else if (j.state === 'cancelled') message.value = 'Import stopped; nothing was committed';
+        else if (!r.committed) message.value = 'Import rolled back: ' + r.failed + ' rows rejected';
+        else message.value = 'Imported ' + r.inserted + ' rows' + (r.failed ? ', skipped ' + r.failed : '');
+      };
+
+      const cancel = async () => {
+        if (!job.value) return;
+        const form = new FormData();
+        form.append('job_id', job.value.id);
+        form.append('cancel', 'yes');
+        try {
+          await post(config.api.progress, form);
+        } catch (err) {
+          error.value = err.message || String(err);
+        }
+      };
+
+      // the two kinds of import share the job display
+      watch(kind, () => {
+        job.value = null;
+        result.value = null;
+        summary.value = null;
+      });
+
+      onMounted(loadTables);
+
+      return {
+        error,
+        busy,
+        kind,
+        file,
+        upload,
+        format,
+        csv,
+        sample,
+        schema,
+        table,
+        tables,
+        columns,
+        mapping,
+        createTable,
+        newColumns,
+        mode,
+        batchSize,
+        skipErrors,
+        job,
+        result,
+        message,
+        resultOK,
+        script,
+        continueOnError,
+        summary,
+        isCSV,
+        percent,
+        formatBytes,
+        loadTables,
+        fileChosen,
+        preview,
+        start,
+        scriptChosen,
+        runScript,
+        cancel
+      };
+    }
+  }).mount('.import-page');
+})();
@@ -28,6 +28,8 @@ var embeddedFS embed.FS
 // Handler handles login page requests
 type Handler struct {
 	config types.Config
+	// user is the signed-in operator shown in the navbar
+	user string
 }
 
 func New(config types.Config) *Handler {
@@ -55,6 +57,7 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	// Save the session with the CSRF token
 	session.SaveSession(w, r, sess, h.config.SessionSecret)
 
+	h.user = sess.User
 	html, err := h.GenerateHTML(csrfToken)
 	if err != nil {
 		http.Error(w, "Failed to render login page: "+err.Error(), http.StatusInternalServerError)
@@ -121,6 +124,7 @@ func (h *Handler) GenerateHTML(csrfToken string) (template.HTML, error) {
 		Title:           DefaultTitle,
 		BasePath:        h.config.BasePath,
 		SafeModeDefault: h.config.SafeModeDefault,
+		User:            h.user,
 		MainHTML:        pageHTML,
 		ExtraHead:       extraHead,
 		ExtraBodyEnd:    extraBody,
@@ -22,6 +22,7 @@
       const isLoading = ref(false);
       const error = ref('');
       const profiles = ref([]);
+      const profileId = ref(''); // a server-configured profile, opened by ID
 
       // Set default ports based on selected driver
       const defaultPorts = {
@@ -44,6 +45,9 @@
 
       // Form validation
       const isFormValid = computed(() => {
+        if (profileId.value) {
+          return true;
+        }
         if (driver.value === 'sqlite') {
           return database.value.trim() !== '';
         }
@@ -66,8 +70,11 @@
         const params = new URLSearchParams();
         params.set('driver', driver.value);
         
-        // Only include non-SQLite fields when not using SQLite
-        if (driver.value !== 'sqlite') {
+        // Server profiles are resolved on the server from their ID alone
+        if (profileId.value) {
+          params.set('profile_id', profileId.value);
+        } else if (driver.value !== 'sqlite') {
+          // Only include non-SQLite fields when not using SQLite
           params.set('server', server.value.trim());
           if (port.value) params.set('port', port.value);
           params.set('username', username.value.trim());
@@ -148,6 +155,7 @@
       const applyProfile = (profile) => {
         if (!profile) return;
         
+        profileId.value = profile.managed ? profile.id : '';
         driver.value = profile.driver || 'sqlite';
         server.value = profile.server || '';
         port.value = profile.port || defaultPorts[driver.value] || '';
@@ -177,6 +185,7 @@
         isLoading,
         error,
         profiles,
+        profileId,
         isFormValid,
         submit,
         applyProfile
@@ -6,6 +6,7 @@ import (
 	"net/http"
 
 	"github.com/dracory/weebase/shared"
+	"github.com/dracory/weebase/shared/auth"
 	layout "github.com/dracory/weebase/shared/layout"
 	"github.com/dracory/weebase/shared/session"
 	"github.com/dracory/weebase/shared/types"
@@ -27,6 +28,14 @@ func (c *pageLogoutController) ServeHTTP(w http.ResponseWriter, r *http.Request)
 	// Clear the session cookie
 	session.DeleteSession(w, r)
 
+	// End the single sign-on too, at the provider when it supports that
+	if interactive, ok := auth.AsInteractive(c.config.Authenticator); ok {
+		if to := interactive.Logout(w, r); to != "" {
+			http.Redirect(w, r, to, http.StatusFound)
+			return
+		}
+	}
+
 	// Redirect to login page
 	http.Redirect(w, r, urls.PageLogin(c.config.BasePath), http.StatusFound)
 }
@@ -0,0 +1,110 @@
+// Routines browser Vue app
+(function () {
+  if (!window.Vue) return; // Vue must be injected by the page handler
+  const { createApp, ref, computed, onMounted } = window.Vue;
+
+  createApp({
+    setup() {
+      const config = window.appConfig || { api: {} };
+      const loading = ref(true);
+      const running = ref(false);
+      const error = ref('');
+      const schema = ref('');
+      const routines = ref([]);
+      const selected = ref(null);
+      const values = ref([]);
+      const nulls = ref([]);
+      const result = ref(null);
+
+      // Only arguments the caller must supply appear in the parameter form
+      const inputs = computed(() => {
+        if (!selected.value) return [];
+        return (selected.value.arguments || []).filter(arg => arg.mode !== 'OUT');
+      });
+
+      const signature = (routine) => (routine.arguments || [])
+        .map(arg => [arg.mode !== 'IN' ? arg.mode : '', arg.name, arg.type].filter(Boolean).join(' '))
+        .join(', ');
+
+      const loadRoutines = async () => {
+        loading.value = true;
+        error.value = '';
+        try {
+          const sep = config.api.routines.includes('?') ? '&' : '?';
+          const response = await fetch(config.api.routines + sep + 'schema=' + encodeURIComponent(schema.value), {
+            credentials: 'same-origin'
+          });
+          const data = await response.json();
+          if (data.status !== 'success') throw new Error(data.message || 'Failed to load routines');
+          routines.value = data.data.routines || [];
+        } catch (err) {
+          error.value = err.message || String(err);
+        } finally {
+          loading.value = false;
+        }
+      };
+
+      const select = (routine) => {
+        selected.value = routine;
+        result.value = null;
+        error.value = '';
+        values.value = inputs.value.map(() => '');
+        nulls.value = inputs.value.map(() => false);
+      };
+
+      const execute = async () => {
+        if (!selected.value) return;
+        if (config.safeMode && !confirm('Execute ' + selected.value.name + '?')) return;
+
+        running.value = true;
+        error.value = '';
+        result.value = null;
+        try {
+          const form = new URLSearchParams();
+          form.append('schema', selected.value.schema);
+          form.append('routine', selected.value.name);
+          form.append('specific_name', selected.value.specific_name);
+          form.append('csrf_token', config.csrfToken);
+          if (config.safeMode) form.append('confirm', 'yes');
+          values.value.forEach((value, i) => {
+            form.append('params[]', value);
+            if (nulls.value[i]) form.append('param_null[]', String(i));
+          });
+
+          const response = await fetch(config.api.execute, {
+            method: 'POST',
+            credentials: 'same-origin',
+            headers: { 'Content-Type': 'application/x-www-form-urlencoded' },
+            body: form.toString()
+          });
+          const data = await response.json();
+          if (data.status !== 'success') throw new Error(data.message || 'Execution failed');
+          result.value = data.data;
+        } catch (err) {
+          error.value = err.message || String(err);
+        } finally {
+          running.value = false;
+        }
+      };
+
+      onMounted(loadRoutines);
+
+      return {
+        loading,
+        running,
+        error,
+        schema,
+        routines,
+        selected,
+        inputs,
+        values,
+        nulls,
+        result,
+        signature,
+        loadRoutines,
+        select,
+        execute
+      };
+    }
+  }).mount('.routines-browser');
+})();
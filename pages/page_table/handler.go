@@ -8,6 +8,7 @@ import (
 
 	"github.com/dracory/weebase/shared"
 	layout "github.com/dracory/weebase/shared/layout"
+	"github.com/dracory/weebase/shared/rbac"
 	"github.com/dracory/weebase/shared/session"
 	"github.com/dracory/weebase/shared/types"
 	"github.com/gouniverse/cdn"
@@ -48,13 +49,13 @@ func (h *pageTableController) ServeHTTP(w http.ResponseWriter, r *http.Request)
 	}
 
 	// Ensure session exists (this will set the session cookie if needed)
-	session.EnsureSession(w, r, h.config.SessionSecret)
+	sess := session.EnsureSession(w, r, h.config.SessionSecret)
 
 	// Generate CSRF token
 	csrfToken := session.GenerateCSRFToken(h.config.SessionSecret)
 
 	// Render the page
-	html, err := Handle(nil, h.config.BasePath, dbName, tableName, h.config.SafeModeDefault, csrfToken)
+	html, err := Handle(nil, h.config.BasePath, dbName, tableName, h.config.SafeModeDefault, csrfToken, sess.User, rbac.Denied(r.Context()))
 	if err != nil {
 		http.Error(w, "Failed to render table page: "+err.Error(), http.StatusInternalServerError)
 		return
@@ -73,6 +74,8 @@ func Handle(
 	tableName string,
 	safeModeDefault bool,
 	csrfToken string,
+	user string,
+	denied []string,
 ) (template.HTML, error) {
 	// Ensure base path has a trailing slash
 	if basePath != "" && basePath[len(basePath)-1] != '/' {
@@ -139,6 +142,8 @@ func Handle(
 		Title:           pageTitle,
 		BasePath:        basePath,
 		SafeModeDefault: safeModeDefault,
+		User:            user,
+		Denied:          denied,
 		MainHTML:        pageHTML,
 		ExtraHead:       extraHead,
 		ExtraBodyEnd:    extraBody,
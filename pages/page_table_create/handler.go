@@ -3,9 +3,12 @@ package page_table_create
 import (
 	"embed"
 	"html/template"
+	"net/http"
 
 	"github.com/dracory/weebase/shared"
 	layout "github.com/dracory/weebase/shared/layout"
+	"github.com/dracory/weebase/shared/session"
+	"github.com/dracory/weebase/shared/types"
 	"github.com/dracory/weebase/shared/urls"
 	"github.com/gouniverse/cdn"
 	hb "github.com/gouniverse/hb"
@@ -14,8 +17,35 @@ import (
 //go:embed view.html script.js styles.css
 var embeddedFS embed.FS
 
+type pageTableCreateController struct {
+	config types.Config
+}
+
+// New creates a new Create Table page controller
+func New(config types.Config) *pageTableCreateController {
+	return &pageTableCreateController{config: config}
+}
+
+// ServeHTTP renders the Create Table page for the active connection
+func (c *pageTableCreateController) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	sess := session.EnsureSession(w, r, c.config.SessionSecret)
+	if sess.Conn == nil || sess.Conn.Driver == "" {
+		http.Redirect(w, r, urls.PageLogin(c.config.BasePath), http.StatusFound)
+		return
+	}
+
+	html, err := Handle(c.config.BasePath, c.config.ActionParam, sess.CSRFToken, c.config.SafeModeDefault, sess.User)
+	if err != nil {
+		http.Error(w, "Failed to render create table page: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(html))
+}
+
 // Handle renders the Create Table page following the pages/login pattern and returns full HTML.
-func Handle(basePath, actionParam, csrfToken string, safeModeDefault bool) (template.HTML, error) {
+func Handle(basePath, actionParam, csrfToken string, safeModeDefault bool, user string) (template.HTML, error) {
 	pageCSS, err := shared.EmbeddedFileToString(embeddedFS, "styles.css")
 	if err != nil {
 		return "", err
@@ -50,6 +80,7 @@ func Handle(basePath, actionParam, csrfToken string, safeModeDefault bool) (temp
 		Title:           "Create table",
 		BasePath:        basePath,
 		SafeModeDefault: safeModeDefault,
+		User:            user,
 		MainHTML:        pageHTML,
 		ExtraHead:       extraHead,
 		ExtraBodyEnd:    extraBody,
@@ -27,6 +27,35 @@
         state.columns.splice(idx, 1);
       }
 
+      // Saves captured migration files locally unless the server already wrote them
+      async function reportMigration(result) {
+        if (result.migration_error) {
+          if (window.Swal && window.Swal.fire) await window.Swal.fire({ icon: 'warning', title: 'Table created, migration not saved', text: result.migration_error });
+          else alert('Table created, migration not saved: ' + result.migration_error);
+          return;
+        }
+        const migration = result.migration;
+        if (!migration || !Array.isArray(migration.files)) return;
+
+        if (!migration.written) {
+          migration.files.forEach(function (f) {
+            const blob = new Blob([f.content], { type: 'application/sql' });
+            const a = document.createElement('a');
+            a.href = URL.createObjectURL(blob);
+            a.download = f.name;
+            document.body.appendChild(a);
+            a.click();
+            setTimeout(function () { URL.revokeObjectURL(a.href); a.remove(); }, 0);
+          });
+        }
+
+        const names = migration.files.map(function (f) { return f.path || f.name; }).join('\n');
+        const note = migration.down_complete ? '' : '\nThe down migration needs manual review.';
+        const title = migration.written ? 'Migration written' : 'Migration downloaded';
+        if (window.Swal && window.Swal.fire) await window.Swal.fire({ icon: 'success', title: title, text: names + note });
+        else alert(title + ':\n' + names + note);
+      }
+
       async function onSubmit(ev) {
         if (ev && ev.preventDefault) ev.preventDefault();
         try {
@@ -47,6 +76,7 @@
           const text = await resp.text();
           let data = null; try { data = text ? JSON.parse(text) : null; } catch (_) {}
           if (resp.ok && data && (data.status === 'success' || data.ok)) {
+            await reportMigration(data.data || {});
             window.location.href = window.urlRedirect || urlAction;
             return;
           }
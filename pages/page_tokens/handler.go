@@ -0,0 +1,114 @@
+package page_tokens
+
+import (
+	"embed"
+	"encoding/json"
+	"html/template"
+	"net/http"
+
+	"github.com/dracory/weebase/shared"
+	layout "github.com/dracory/weebase/shared/layout"
+	"github.com/dracory/weebase/shared/session"
+	"github.com/dracory/weebase/shared/types"
+	"github.com/dracory/weebase/shared/urls"
+	"github.com/gouniverse/cdn"
+	hb "github.com/gouniverse/hb"
+)
+
+const (
+	// DefaultTitle is the default page title
+	DefaultTitle = "API tokens"
+)
+
+//go:embed view.html script.js styles.css
+var embeddedFS embed.FS
+
+type pageTokensController struct {
+	config types.Config
+	// user is the signed-in operator shown in the navbar
+	user string
+	// csrfToken guards creating and revoking tokens
+	csrfToken string
+}
+
+// New creates a new API tokens page controller
+func New(config types.Config) *pageTokensController {
+	return &pageTokensController{config: config}
+}
+
+// ServeHTTP handles the HTTP request for the API tokens page
+func (c *pageTokensController) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// tokens belong to the operator, so no connection is needed
+	sess := session.EnsureSession(w, r, c.config.SessionSecret)
+	if sess.CSRFToken == "" {
+		sess.CSRFToken = session.GenerateCSRFToken(c.config.SessionSecret)
+		session.SaveSession(w, r, sess, c.config.SessionSecret)
+	}
+	c.user = sess.User
+	c.csrfToken = sess.CSRFToken
+
+	html, err := c.pageHtml()
+	if err != nil {
+		http.Error(w, "Failed to render API tokens page: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(html))
+}
+
+// pageHtml renders the API tokens page and returns the full HTML
+func (c *pageTokensController) pageHtml() (template.HTML, error) {
+	pageCSS, err := shared.EmbeddedFileToString(embeddedFS, "styles.css")
+	if err != nil {
+		return "", err
+	}
+	pageJS, err := shared.EmbeddedFileToString(embeddedFS, "script.js")
+	if err != nil {
+		return "", err
+	}
+	pageHTML, err := shared.EmbeddedFileToString(embeddedFS, "view.html")
+	if err != nil {
+		return "", err
+	}
+
+	apiURLs := map[string]string{
+		"list":   urls.ApiTokensList(c.config.BasePath),
+		"create": urls.ApiTokenCreate(c.config.BasePath),
+		"revoke": urls.ApiTokenRevoke(c.config.BasePath),
+	}
+
+	extraHead := []hb.TagInterface{
+		hb.Style(pageCSS),
+	}
+
+	extraBody := []hb.TagInterface{
+		hb.ScriptURL(cdn.VueJs_3()),
+		hb.Script(`
+			window.appConfig = {
+				api: ` + string(toJSON(apiURLs)) + `,
+				csrfToken: "` + template.JSEscapeString(c.csrfToken) + `"
+			};
+		`),
+		hb.Script(pageJS),
+	}
+
+	return layout.RenderWith(layout.Options{
+		Title:           DefaultTitle,
+		BasePath:        c.config.BasePath,
+		SafeModeDefault: c.config.SafeModeDefault,
+		User:            c.user,
+		MainHTML:        pageHTML,
+		ExtraHead:       extraHead,
+		ExtraBodyEnd:    extraBody,
+	}), nil
+}
+
+// Helper function to convert Go values to JSON for JavaScript
+func toJSON(v interface{}) template.JS {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return template.JS("{}")
+	}
+	return template.JS(b)
+}
@@ -0,0 +1,85 @@
+// API tokens page Vue app
+(function () {
+  if (!window.Vue) return; // Vue must be injected by the page handler
+  const { createApp, ref, reactive, onMounted } = window.Vue;
+
+  createApp({
+    setup() {
+      const config = window.appConfig || { api: {} };
+      const error = ref('');
+      const secret = ref('');
+      const busy = ref(false);
+      const tokens = ref([]);
+      const roles = ref([]);
+      const profiles = ref([]);
+      const maxDays = ref(0);
+      const form = reactive({ name: '', roles: [], profiles: [], expires_at: '' });
+
+      const formatTime = (t) => t ? new Date(t).toLocaleString() : '';
+      const expired = (t) => t.expires_at && new Date(t.expires_at) <= new Date();
+
+      const post = async (url, fields) => {
+        const body = new FormData();
+        Object.entries(fields).forEach(([k, v]) => {
+          (Array.isArray(v) ? v : [v]).forEach((item) => body.append(k, item));
+        });
+        body.append('csrf_token', config.csrfToken);
+        const response = await fetch(url, { method: 'POST', body, credentials: 'same-origin' });
+        const data = await response.json();
+        if (data.status !== 'success') throw new Error(data.message || 'Request failed');
+        return data.data;
+      };
+
+      const load = async () => {
+        error.value = '';
+        busy.value = true;
+        try {
+          const response = await fetch(config.api.list, { credentials: 'same-origin' });
+          const data = await response.json();
+          if (data.status !== 'success') throw new Error(data.message || 'Request failed');
+          tokens.value = data.data.tokens || [];
+          roles.value = data.data.roles || [];
+          profiles.value = data.data.profiles || [];
+          maxDays.value = data.data.max_days || 0;
+        } catch (err) {
+          error.value = err.message || String(err);
+        }
+        busy.value = false;
+      };
+
+      const create = async () => {
+        error.value = '';
+        secret.value = '';
+        busy.value = true;
+        try {
+          const data = await post(config.api.create, form);
+          secret.value = data.secret;
+          Object.assign(form, { name: '', roles: [], profiles: [], expires_at: '' });
+        } catch (err) {
+          error.value = err.message || String(err);
+        }
+        busy.value = false;
+        await load();
+      };
+
+      const revoke = async (t) => {
+        if (!confirm('Revoke the token "' + t.name + '"? Scripts using it will stop working.')) return;
+        error.value = '';
+        busy.value = true;
+        try {
+          await post(config.api.revoke, { id: t.id });
+        } catch (err) {
+          error.value = err.message || String(err);
+        }
+        busy.value = false;
+        await load();
+      };
+
+      const copySecret = () => navigator.clipboard && navigator.clipboard.writeText(secret.value);
+
+      onMounted(load);
+
+      return { error, secret, busy, tokens, roles, profiles, maxDays, form, formatTime, expired, create, revoke, copySecret };
+    }
+  }).mount('.tokens-page');
+})();
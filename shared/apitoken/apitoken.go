@@ -0,0 +1,191 @@
+// Package apitoken issues personal API tokens, so scripts can call the JSON
+// API as an operator without a browser session. Only a hash of each token
+// is stored; a token expires, at the latest after a maximum lifetime, and
+// may be narrowed to some of its owner's roles and to some connection
+// profiles.
+package apitoken
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Prefix starts every personal API token, telling them apart from the
+// static AUTH_TOKEN
+const Prefix = "wbt_"
+
+// DefaultMaxLifetime is how long a token lasts at most when no maximum is
+// configured
+const DefaultMaxLifetime = 90 * 24 * time.Hour
+
+// ErrNotFound is returned by a Store for an unknown token
+var ErrNotFound = errors.New("token not found")
+
+// MaxLifetime returns the configured maximum lifetime of tokens, or
+// DefaultMaxLifetime when none is
+func MaxLifetime(configured time.Duration) time.Duration {
+	if configured <= 0 {
+		return DefaultMaxLifetime
+	}
+	return configured
+}
+
+// Token is a personal API token. The secret is only known when the token
+// is created; the store keeps its hash.
+type Token struct {
+	ID    string `json:"id"`
+	Name  string `json:"name"`
+	Owner string `json:"owner"`
+	// Hash is the hex SHA-256 of the secret
+	Hash string `json:"-"`
+	// Roles and Profiles narrow what the token may do; empty narrows
+	// nothing
+	Roles    []string `json:"roles,omitempty"`
+	Profiles []string `json:"profiles,omitempty"`
+	// OwnerRoles are the roles the authenticator gave the owner when the
+	// token was created, used when that authenticator can't look the owner
+	// up as requests with the token don't go through it
+	OwnerRoles []string   `json:"owner_roles,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+}
+
+// New creates a token of owner and returns it with its secret, which is
+// shown to the owner once and never stored
+func New(owner, name string, roles, profiles, ownerRoles []string, expiresAt *time.Time) (Token, string) {
+	id := make([]byte, 8)
+	rand.Read(id)
+	secret := make([]byte, 32)
+	rand.Read(secret)
+	plain := Prefix + hex.EncodeToString(secret)
+	return Token{
+		ID:         hex.EncodeToString(id),
+		Name:       name,
+		Owner:      owner,
+		Hash:       Hash(plain),
+		Roles:      roles,
+		Profiles:   profiles,
+		OwnerRoles: ownerRoles,
+		CreatedAt:  time.Now().UTC(),
+		ExpiresAt:  expiresAt,
+	}, plain
+}
+
+// Hash returns the hex SHA-256 of a token secret. Secrets are random, so
+// a plain hash is enough to keep them from being read back.
+func Hash(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// Expired reports whether the token has expired at now
+func (t Token) Expired(now time.Time) bool {
+	return t.ExpiresAt != nil && !now.Before(*t.ExpiresAt)
+}
+
+// Store keeps the tokens
+type Store interface {
+	// Add records a token
+	Add(ctx context.Context, t Token) error
+	// Lookup returns the token with the hash, or ErrNotFound
+	Lookup(ctx context.Context, hash string) (Token, error)
+	// List returns the tokens of owner, newest first
+	List(ctx context.Context, owner string) ([]Token, error)
+	// Delete revokes a token of owner, or returns ErrNotFound
+	Delete(ctx context.Context, owner, id string) error
+	// DeleteOwner revokes every token of owner and returns how many there
+	// were
+	DeleteOwner(ctx context.Context, owner string) (int, error)
+	// Touch records when a token was last used
+	Touch(ctx context.Context, id string, at time.Time) error
+}
+
+// MemoryStore keeps the tokens in memory; they are lost on restart
+type MemoryStore struct {
+	mu     sync.Mutex
+	tokens map[string]Token
+}
+
+var _ Store = (*MemoryStore)(nil)
+
+// NewMemoryStore creates an empty MemoryStore
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{tokens: map[string]Token{}}
+}
+
+// Add implements Store
+func (s *MemoryStore) Add(_ context.Context, t Token) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tokens[t.ID] = t
+	return nil
+}
+
+// Lookup implements Store
+func (s *MemoryStore) Lookup(_ context.Context, hash string) (Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, t := range s.tokens {
+		if t.Hash == hash {
+			return t, nil
+		}
+	}
+	return Token{}, ErrNotFound
+}
+
+// List implements Store
+func (s *MemoryStore) List(_ context.Context, owner string) ([]Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := []Token{}
+	for _, t := range s.tokens {
+		if t.Owner == owner {
+			out = append(out, t)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].CreatedAt.After(out[j].CreatedAt) })
+	return out, nil
+}
+
+// Delete implements Store
+func (s *MemoryStore) Delete(_ context.Context, owner, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if t, ok := s.tokens[id]; !ok || t.Owner != owner {
+		return ErrNotFound
+	}
+	delete(s.tokens, id)
+	return nil
+}
+
+// DeleteOwner implements Store
+func (s *MemoryStore) DeleteOwner(_ context.Context, owner string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	for id, t := range s.tokens {
+		if t.Owner == owner {
+			delete(s.tokens, id)
+			n++
+		}
+	}
+	return n, nil
+}
+
+// Touch implements Store
+func (s *MemoryStore) Touch(_ context.Context, id string, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if t, ok := s.tokens[id]; ok {
+		t.LastUsedAt = &at
+		s.tokens[id] = t
+	}
+	return nil
+}
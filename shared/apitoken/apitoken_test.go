@@ -0,0 +1,141 @@
+package apitoken
+
+import (
+	"errors"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dracory/weebase/shared/auth"
+)
+
+func testStores(t *testing.T) map[string]Store {
+	sqlite, err := NewSQLiteStore(filepath.Join(t.TempDir(), "tokens.db"))
+	if err != nil {
+		t.Fatalf("NewSQLiteStore: %v", err)
+	}
+	t.Cleanup(func() { sqlite.Close() })
+	return map[string]Store{"memory": NewMemoryStore(), "sqlite": sqlite}
+}
+
+func TestStores(t *testing.T) {
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := t.Context()
+			first, _ := New("alice", "ci", nil, nil, nil, nil)
+			first.CreatedAt = first.CreatedAt.Add(-time.Hour)
+			second, secret := New("alice", "deploy", []string{"support"}, []string{"staging"}, nil, nil)
+			other, _ := New("bob", "ci", nil, nil, nil, nil)
+			for _, tok := range []Token{first, second, other} {
+				if err := store.Add(ctx, tok); err != nil {
+					t.Fatalf("Add: %v", err)
+				}
+			}
+
+			got, err := store.Lookup(ctx, Hash(secret))
+			if err != nil || got.ID != second.ID || got.Hash != second.Hash || got.Profiles[0] != "staging" {
+				t.Fatalf("Lookup = %+v, %v", got, err)
+			}
+			if _, err := store.Lookup(ctx, Hash("wbt_unknown")); !errors.Is(err, ErrNotFound) {
+				t.Errorf("expected ErrNotFound, got %v", err)
+			}
+
+			list, err := store.List(ctx, "alice")
+			if err != nil || len(list) != 2 || list[0].ID != second.ID {
+				t.Fatalf("List = %+v, %v", list, err)
+			}
+
+			used := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+			if err := store.Touch(ctx, second.ID, used); err != nil {
+				t.Fatalf("Touch: %v", err)
+			}
+			if got, _ := store.Lookup(ctx, second.Hash); got.LastUsedAt == nil || !got.LastUsedAt.Equal(used) {
+				t.Errorf("expected last use %v, got %v", used, got.LastUsedAt)
+			}
+
+			if err := store.Delete(ctx, "bob", second.ID); !errors.Is(err, ErrNotFound) {
+				t.Errorf("expected another owner's token to be left alone, got %v", err)
+			}
+			if err := store.Delete(ctx, "alice", second.ID); err != nil {
+				t.Fatalf("Delete: %v", err)
+			}
+			if _, err := store.Lookup(ctx, second.Hash); !errors.Is(err, ErrNotFound) {
+				t.Errorf("expected the revoked token gone, got %v", err)
+			}
+
+			if n, err := store.DeleteOwner(ctx, "alice"); err != nil || n != 1 {
+				t.Errorf("DeleteOwner = %d, %v; want 1", n, err)
+			}
+			if list, _ := store.List(ctx, "bob"); len(list) != 1 {
+				t.Errorf("expected bob's token kept, got %+v", list)
+			}
+		})
+	}
+}
+
+func TestAuthenticator(t *testing.T) {
+	store := NewMemoryStore()
+	expired := time.Now().Add(-time.Minute)
+	valid, secret := New("alice", "ci", []string{"support"}, []string{"staging"}, []string{"sso-dba"}, nil)
+	old, oldSecret := New("alice", "old", nil, nil, nil, &expired)
+	stale, staleSecret := New("alice", "stale", nil, nil, nil, nil)
+	stale.CreatedAt = time.Now().Add(-DefaultMaxLifetime)
+	for _, tok := range []Token{valid, old, stale} {
+		store.Add(t.Context(), tok)
+	}
+	a := NewAuthenticator(store, Options{})
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("Authorization", "Bearer "+secret)
+	user, err := a.Authenticate(r)
+	if err != nil {
+		t.Fatalf("Authenticate: %v", err)
+	}
+	if user.Name != "alice" || user.Roles[0] != "sso-dba" || user.Scope == nil || user.Scope.TokenID != valid.ID || user.Scope.Profiles[0] != "staging" {
+		t.Errorf("unexpected user %+v", user)
+	}
+	if got, _ := store.Lookup(t.Context(), valid.Hash); got.LastUsedAt == nil {
+		t.Error("expected the use to be recorded")
+	}
+
+	for name, token := range map[string]string{
+		"expired":      oldSecret,
+		"too old":      staleSecret,
+		"unknown":      Prefix + strings.Repeat("0", 64),
+		"static token": "s3cret",
+		"none":         "",
+	} {
+		r := httptest.NewRequest("GET", "/", nil)
+		if token != "" {
+			r.Header.Set(auth.TokenHeader, token)
+		}
+		if _, err := a.Authenticate(r); !errors.Is(err, auth.ErrUnauthenticated) {
+			t.Errorf("%s: expected ErrUnauthenticated, got %v", name, err)
+		}
+	}
+}
+
+func TestAuthenticatorOwners(t *testing.T) {
+	store := NewMemoryStore()
+	alice, aliceSecret := New("alice", "ci", nil, nil, []string{"dba"}, nil)
+	carol, carolSecret := New("carol", "ci", nil, nil, []string{"dba"}, nil)
+	store.Add(t.Context(), alice)
+	store.Add(t.Context(), carol)
+	owners := auth.NewToken("static", auth.User{Name: "alice", Roles: []string{"support"}})
+	a := NewAuthenticator(store, Options{Owners: owners})
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("Authorization", "Bearer "+aliceSecret)
+	user, err := a.Authenticate(r)
+	if err != nil || len(user.Roles) != 1 || user.Roles[0] != "support" {
+		t.Errorf("expected the owner's current roles, got %+v, %v", user, err)
+	}
+
+	r = httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("Authorization", "Bearer "+carolSecret)
+	if _, err := a.Authenticate(r); !errors.Is(err, auth.ErrUnauthenticated) {
+		t.Errorf("expected the token of a removed owner refused, got %v", err)
+	}
+}
@@ -0,0 +1,105 @@
+package apitoken
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/dracory/weebase/shared/auth"
+)
+
+// touchInterval is how stale the last use of a token may get before it is
+// recorded again, so busy scripts don't write on every request
+const touchInterval = time.Minute
+
+// Options configure an Authenticator
+type Options struct {
+	// Owners authenticates the operators who own the tokens. When it can
+	// look them up (see auth.Directory), every request checks the owner
+	// still exists and takes their current roles. Otherwise the roles the
+	// owner had when the token was created apply, and the tokens of a
+	// removed operator must be revoked with Store.DeleteOwner.
+	Owners auth.Authenticator
+	// MaxLifetime is how long after its creation a token is accepted at
+	// most, whatever its expiry; zero means DefaultMaxLifetime
+	MaxLifetime time.Duration
+}
+
+// Authenticator accepts the personal API tokens of a Store as bearer
+// tokens. Requests with other credentials are left to the rest of the
+// chain.
+type Authenticator struct {
+	store       Store
+	owners      auth.Directory
+	maxLifetime time.Duration
+	now         func() time.Time
+}
+
+// NewAuthenticator creates an Authenticator for the tokens of store
+func NewAuthenticator(store Store, opts Options) *Authenticator {
+	a := &Authenticator{store: store, maxLifetime: MaxLifetime(opts.MaxLifetime), now: time.Now}
+	if opts.Owners != nil {
+		a.owners, _ = auth.AsDirectory(opts.Owners)
+	}
+	return a
+}
+
+// Authenticate returns the owner of the request's token, carrying the
+// token's scope
+func (a *Authenticator) Authenticate(r *http.Request) (auth.User, error) {
+	token := auth.BearerToken(r)
+	if !strings.HasPrefix(token, Prefix) {
+		return auth.User{}, auth.ErrUnauthenticated
+	}
+	t, err := a.store.Lookup(r.Context(), Hash(token))
+	if errors.Is(err, ErrNotFound) {
+		return auth.User{}, auth.ErrUnauthenticated
+	}
+	if err != nil {
+		return auth.User{}, err
+	}
+	now := a.now().UTC()
+	if t.Expired(now) || !now.Before(t.CreatedAt.Add(a.maxLifetime)) {
+		return auth.User{}, auth.ErrUnauthenticated
+	}
+
+	user := auth.User{
+		Name:  t.Owner,
+		Roles: t.OwnerRoles,
+		Scope: &auth.Scope{TokenID: t.ID, Roles: t.Roles, Profiles: t.Profiles},
+	}
+	if a.owners != nil {
+		owner, err := a.owners.Lookup(r.Context(), t.Owner)
+		if errors.Is(err, auth.ErrUnknownUser) {
+			return auth.User{}, auth.ErrUnauthenticated
+		}
+		if err != nil {
+			return auth.User{}, err
+		}
+		user.Roles = owner.Roles
+	}
+
+	if t.LastUsedAt == nil || now.Sub(*t.LastUsedAt) >= touchInterval {
+		if err := a.store.Touch(context.WithoutCancel(r.Context()), t.ID, now); err != nil {
+			slog.Error("failed to record API token use", slog.String("token", t.ID), slog.String("error", err.Error()))
+		}
+	}
+	return user, nil
+}
+
+// Owner returns the operator of a request who may manage API tokens: one
+// identified by the authenticator, not by a token, so a token can't be used
+// to create broader ones
+func Owner(ctx context.Context) (auth.User, error) {
+	user, ok := auth.FromContext(ctx)
+	switch {
+	case !ok || user.Name == "":
+		return auth.User{}, errors.New("API tokens need a signed-in operator: configure an authenticator")
+	case user.Scope != nil:
+		return auth.User{}, errors.New("API tokens can't be managed with an API token")
+	}
+	return user, nil
+}
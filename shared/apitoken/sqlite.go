@@ -0,0 +1,129 @@
+package apitoken
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/dracory/weebase/shared/driver"
+)
+
+// SQLiteStore keeps the tokens in a SQLite database so they survive a
+// restart
+type SQLiteStore struct {
+	db *sql.DB
+}
+
+var _ Store = (*SQLiteStore)(nil)
+
+// NewSQLiteStore opens, and if needed creates, the token database at path
+func NewSQLiteStore(path string) (*SQLiteStore, error) {
+	db, err := driver.OpenSQLDB("sqlite", path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open token store: %v", err)
+	}
+	// one writer at a time keeps SQLite from reporting a locked database
+	db.SetMaxOpenConns(1)
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS weebase_api_tokens (
+		id TEXT PRIMARY KEY,
+		hash TEXT NOT NULL UNIQUE,
+		owner TEXT NOT NULL,
+		ts INTEGER NOT NULL,
+		token TEXT NOT NULL
+	)`)
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create token table: %v", err)
+	}
+	return &SQLiteStore{db: db}, nil
+}
+
+// Close closes the database
+func (s *SQLiteStore) Close() error {
+	return s.db.Close()
+}
+
+// Add implements Store
+func (s *SQLiteStore) Add(ctx context.Context, t Token) error {
+	data, err := json.Marshal(t)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.ExecContext(ctx, `INSERT INTO weebase_api_tokens (id, hash, owner, ts, token) VALUES (?, ?, ?, ?, ?)`,
+		t.ID, t.Hash, t.Owner, t.CreatedAt.UnixNano(), string(data))
+	return err
+}
+
+// Lookup implements Store
+func (s *SQLiteStore) Lookup(ctx context.Context, hash string) (Token, error) {
+	t, err := scanToken(s.db.QueryRowContext(ctx, `SELECT hash, token FROM weebase_api_tokens WHERE hash = ?`, hash))
+	if errors.Is(err, sql.ErrNoRows) {
+		return Token{}, ErrNotFound
+	}
+	return t, err
+}
+
+// List implements Store
+func (s *SQLiteStore) List(ctx context.Context, owner string) ([]Token, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT hash, token FROM weebase_api_tokens WHERE owner = ? ORDER BY ts DESC`, owner)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []Token{}
+	for rows.Next() {
+		t, err := scanToken(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, t)
+	}
+	return out, rows.Err()
+}
+
+// Delete implements Store
+func (s *SQLiteStore) Delete(ctx context.Context, owner, id string) error {
+	result, err := s.db.ExecContext(ctx, `DELETE FROM weebase_api_tokens WHERE id = ? AND owner = ?`, id, owner)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// DeleteOwner implements Store
+func (s *SQLiteStore) DeleteOwner(ctx context.Context, owner string) (int, error) {
+	result, err := s.db.ExecContext(ctx, `DELETE FROM weebase_api_tokens WHERE owner = ?`, owner)
+	if err != nil {
+		return 0, err
+	}
+	n, err := result.RowsAffected()
+	return int(n), err
+}
+
+// Touch implements Store
+func (s *SQLiteStore) Touch(ctx context.Context, id string, at time.Time) error {
+	_, err := s.db.ExecContext(ctx, `UPDATE weebase_api_tokens SET token = json_set(token, '$.last_used_at', ?) WHERE id = ?`,
+		at.UTC().Format(time.RFC3339Nano), id)
+	return err
+}
+
+// scanToken reads a token stored as JSON next to its hash
+func scanToken(row interface{ Scan(...any) error }) (Token, error) {
+	var hash, data string
+	if err := row.Scan(&hash, &data); err != nil {
+		return Token{}, err
+	}
+	var t Token
+	if err := json.Unmarshal([]byte(data), &t); err != nil {
+		return Token{}, fmt.Errorf("invalid token record: %v", err)
+	}
+	t.Hash = hash
+	return t, nil
+}
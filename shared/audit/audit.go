@@ -0,0 +1,342 @@
+// Package audit records who changed data or ran SQL through weebase. The app
+// opens an Entry for every audited action and puts it in the request
+// context; handlers add the statement they ran and the rows it affected, and
+// the entry is written to the configured Sink once the action finished. An
+// action running as a background job is written as submitted, and the job
+// writes a second entry with its own outcome when it ends.
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+// Outcomes of an audited action
+const (
+	OutcomeSuccess = "success"
+	OutcomeError   = "error"
+	OutcomeDenied  = "denied"
+	// OutcomeSubmitted is the outcome of an action that started a job
+	OutcomeSubmitted = "submitted"
+)
+
+// statementLimit is how much SQL an entry keeps of an action running many
+// statements
+const statementLimit = 16 << 10
+
+// Search limits
+const (
+	DefaultLimit = 100
+	MaxLimit     = 1000
+)
+
+// Entry is one audited action. Values never appear in it: Statement is
+// parameterized SQL, or SQL with its literals redacted, and Params only
+// names the types of the bound values.
+type Entry struct {
+	Time         time.Time `json:"time"`
+	Operator     string    `json:"operator,omitempty"`
+	SessionID    string    `json:"session_id,omitempty"`
+	RequestID    string    `json:"request_id,omitempty"`
+	Profile      string    `json:"profile,omitempty"`
+	Database     string    `json:"database,omitempty"`
+	Action       string    `json:"action"`
+	Object       string    `json:"object,omitempty"`
+	Statement    string    `json:"statement,omitempty"`
+	Params       []string  `json:"params,omitempty"`
+	RowsAffected int64     `json:"rows_affected"`
+	Outcome      string    `json:"outcome"`
+	Error        string    `json:"error,omitempty"`
+}
+
+// Sink stores audit entries
+type Sink interface {
+	Write(ctx context.Context, e Entry) error
+}
+
+// Searcher is implemented by sinks that can be searched from the audit page
+type Searcher interface {
+	// Search returns the entries matching q, newest first
+	Search(ctx context.Context, q Query) ([]Entry, error)
+}
+
+// Query filters entries; empty fields match anything. Text is looked up,
+// case-insensitively, in the object, statement and error.
+type Query struct {
+	Operator string
+	Action   string
+	Outcome  string
+	Text     string
+	Since    time.Time
+	Until    time.Time
+	Limit    int
+}
+
+// Matches reports whether e passes the filters of q
+func (q Query) Matches(e Entry) bool {
+	switch {
+	case q.Operator != "" && !strings.EqualFold(q.Operator, e.Operator),
+		q.Action != "" && q.Action != e.Action,
+		q.Outcome != "" && q.Outcome != e.Outcome,
+		!q.Since.IsZero() && e.Time.Before(q.Since),
+		!q.Until.IsZero() && e.Time.After(q.Until):
+		return false
+	}
+	if q.Text == "" {
+		return true
+	}
+	text := strings.ToLower(q.Text)
+	return strings.Contains(strings.ToLower(e.Object), text) ||
+		strings.Contains(strings.ToLower(e.Statement), text) ||
+		strings.Contains(strings.ToLower(e.Error), text)
+}
+
+// limit returns the number of entries to return, within MaxLimit
+func (q Query) limit() int {
+	switch {
+	case q.Limit <= 0:
+		return DefaultLimit
+	case q.Limit > MaxLimit:
+		return MaxLimit
+	}
+	return q.Limit
+}
+
+// Multi writes every entry to all of its sinks
+type Multi []Sink
+
+// Write writes e to every sink, returning their errors joined
+func (m Multi) Write(ctx context.Context, e Entry) error {
+	var errs []error
+	for _, s := range m {
+		if err := s.Write(ctx, e); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// AsSearcher returns the searchable sink of s, looking into Multi for its
+// first searchable member
+func AsSearcher(s Sink) (Searcher, bool) {
+	if m, ok := s.(Multi); ok {
+		for _, member := range m {
+			if searcher, ok := AsSearcher(member); ok {
+				return searcher, true
+			}
+		}
+		return nil, false
+	}
+	searcher, ok := s.(Searcher)
+	return searcher, ok
+}
+
+// Slog writes entries as structured log records
+type Slog struct {
+	logger *slog.Logger
+}
+
+// NewSlog logs entries to logger, or to the default logger when nil
+func NewSlog(logger *slog.Logger) *Slog {
+	return &Slog{logger: logger}
+}
+
+// Write logs e at info level, or warn when the action failed
+func (s *Slog) Write(ctx context.Context, e Entry) error {
+	logger := s.logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+	level := slog.LevelInfo
+	if e.Outcome != OutcomeSuccess {
+		level = slog.LevelWarn
+	}
+	logger.LogAttrs(ctx, level, "audit",
+		slog.Time("time", e.Time),
+		slog.String("operator", e.Operator),
+		slog.String("session_id", e.SessionID),
+		slog.String("request_id", e.RequestID),
+		slog.String("profile", e.Profile),
+		slog.String("database", e.Database),
+		slog.String("action", e.Action),
+		slog.String("object", e.Object),
+		slog.String("statement", e.Statement),
+		slog.Any("params", e.Params),
+		slog.Int64("rows_affected", e.RowsAffected),
+		slog.String("outcome", e.Outcome),
+		slog.String("error", e.Error),
+	)
+	return nil
+}
+
+type ctxKey struct{}
+
+type sinkKey struct{}
+
+// WithEntry returns a copy of ctx carrying the entry of the current action
+func WithEntry(ctx context.Context, e *Entry) context.Context {
+	return context.WithValue(ctx, ctxKey{}, e)
+}
+
+// WithSink returns a copy of ctx carrying the sink the entries of jobs
+// started by the action are written to
+func WithSink(ctx context.Context, s Sink) context.Context {
+	return context.WithValue(ctx, sinkKey{}, s)
+}
+
+// FromContext returns the entry of the current action, nil when the action
+// isn't audited
+func FromContext(ctx context.Context) *Entry {
+	e, _ := ctx.Value(ctxKey{}).(*Entry)
+	return e
+}
+
+// SetStatement records the parameterized statement an action ran and the
+// types of its arguments
+func SetStatement(ctx context.Context, statement string, args ...any) {
+	e := FromContext(ctx)
+	if e == nil {
+		return
+	}
+	e.Statement = statement
+	e.Params = make([]string, len(args))
+	for i, arg := range args {
+		e.Params[i] = paramType(arg)
+	}
+}
+
+// SetSQL records free-form SQL with its literals redacted
+func SetSQL(ctx context.Context, sql string) {
+	if e := FromContext(ctx); e != nil {
+		e.Statement = RedactSQL(sql)
+		e.Params = nil
+	}
+}
+
+// AddSQL appends free-form SQL, with its literals redacted, to the
+// statements of an action running several. Past statementLimit the rest is
+// left out.
+func AddSQL(ctx context.Context, sql string) {
+	e := FromContext(ctx)
+	if e == nil || strings.HasSuffix(e.Statement, "...") {
+		return
+	}
+	e.Params = nil
+	next := strings.TrimSpace(RedactSQL(sql))
+	if e.Statement != "" {
+		next = ";\n" + next
+	}
+	if len(e.Statement)+len(next) > statementLimit {
+		e.Statement += ";\n..."
+		return
+	}
+	e.Statement += next
+}
+
+// SetObject records the table, view or routine the action is about
+func SetObject(ctx context.Context, schema, name string) {
+	if e := FromContext(ctx); e != nil {
+		e.Object = name
+		if schema != "" {
+			e.Object = schema + "." + name
+		}
+	}
+}
+
+// AddRowsAffected counts rows changed by the action
+func AddRowsAffected(ctx context.Context, n int64) {
+	e := FromContext(ctx)
+	if e == nil || n < 0 {
+		return
+	}
+	if e.RowsAffected < 0 {
+		e.RowsAffected = 0
+	}
+	e.RowsAffected += n
+}
+
+// Job is the entry of a background job started by an audited action
+type Job struct {
+	entry Entry
+	sink  Sink
+}
+
+// StartJob marks the action's entry as submitted and returns the entry of
+// the job it starts, a copy of the action's as recorded so far. It returns
+// nil, which records nothing, when the action isn't audited.
+func StartJob(ctx context.Context) *Job {
+	e := FromContext(ctx)
+	s, _ := ctx.Value(sinkKey{}).(Sink)
+	if e == nil || s == nil {
+		return nil
+	}
+	e.Outcome = OutcomeSubmitted
+	return &Job{entry: *e, sink: s}
+}
+
+// Context returns a copy of ctx carrying the job's entry, for the job to
+// record what it ran
+func (j *Job) Context(ctx context.Context) context.Context {
+	if j == nil {
+		return ctx
+	}
+	return WithEntry(ctx, &j.entry)
+}
+
+// Finish writes the job's entry with the outcome of err
+func (j *Job) Finish(ctx context.Context, err error) {
+	if j == nil {
+		return
+	}
+	j.entry.Time = time.Now().UTC()
+	j.entry.Outcome, j.entry.Error = OutcomeSuccess, ""
+	if err != nil {
+		j.entry.Outcome, j.entry.Error = OutcomeError, err.Error()
+	}
+	if err := j.sink.Write(context.WithoutCancel(ctx), j.entry); err != nil {
+		slog.Error("failed to write audit entry", slog.String("action", j.entry.Action), slog.String("error", err.Error()))
+	}
+}
+
+// paramType names the type of a bound value without revealing it
+func paramType(v any) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case string:
+		return "string"
+	case []byte:
+		return "bytes"
+	case bool:
+		return "bool"
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return "int"
+	case float32, float64:
+		return "float"
+	case time.Time:
+		return "time"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+// marshalParams stores Params in a single column
+func marshalParams(params []string) string {
+	if len(params) == 0 {
+		return ""
+	}
+	b, _ := json.Marshal(params)
+	return string(b)
+}
+
+func unmarshalParams(s string) []string {
+	var params []string
+	if s != "" {
+		json.Unmarshal([]byte(s), &params)
+	}
+	return params
+}
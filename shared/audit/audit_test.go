@@ -0,0 +1,212 @@
+package audit
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dracory/api"
+)
+
+func TestRedactSQL(t *testing.T) {
+	tests := map[string]string{
+		"UPDATE users SET name = 'O''Brien' WHERE id = 42":     "UPDATE users SET name = ? WHERE id = ?",
+		`SELECT "col1", t2.x FROM [my table] WHERE a = -1.5e3`: `SELECT "col1", t2.x FROM [my table] WHERE a = -?`,
+		"DELETE FROM t -- secret 123\nWHERE k = $1":            "DELETE FROM t  \nWHERE k = $1",
+		"SELECT /* 'x' */ $tag$ body $tag$, $$ 7 $$":           "SELECT   ?, ?",
+		"INSERT INTO `log2` VALUES (0x1F, 'a')":                "INSERT INTO `log2` VALUES (?, ?)",
+		// MySQL escapes, where the quote after a backslash doesn't end the text
+		`UPDATE t SET a = 'it\'s', b = 'secret' WHERE id = 1`: "UPDATE t SET a = ?",
+		`SELECT "a\" secret" FROM t`:                          "SELECT ?",
+		// standard strings, where it does
+		`SELECT 'C:\', 'secret', 7`: "SELECT ?",
+		"SELECT `a\\b` FROM t":      "SELECT `a\\b` FROM t",
+	}
+	for in, want := range tests {
+		if got := RedactSQL(in); got != want {
+			t.Errorf("RedactSQL(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestContextHelpers(t *testing.T) {
+	e := &Entry{RowsAffected: -1}
+	ctx := WithEntry(t.Context(), e)
+	SetObject(ctx, "public", "users")
+	SetStatement(ctx, "UPDATE users SET name = ? WHERE id = ?", "alice", 7)
+	AddRowsAffected(ctx, 1)
+
+	if e.Object != "public.users" || e.RowsAffected != 1 {
+		t.Errorf("unexpected entry %+v", e)
+	}
+	if len(e.Params) != 2 || e.Params[0] != "string" || e.Params[1] != "int" {
+		t.Errorf("expected param types only, got %v", e.Params)
+	}
+
+	// unaudited requests are left alone
+	SetSQL(t.Context(), "DELETE FROM t")
+}
+
+func TestAddSQL(t *testing.T) {
+	e := &Entry{}
+	ctx := WithEntry(t.Context(), e)
+	AddSQL(ctx, "CREATE TABLE t (id INT)")
+	AddSQL(ctx, "INSERT INTO t VALUES (42)")
+	if e.Statement != "CREATE TABLE t (id INT);\nINSERT INTO t VALUES (?)" {
+		t.Errorf("unexpected statements %q", e.Statement)
+	}
+
+	for range statementLimit {
+		AddSQL(ctx, "DELETE FROM t")
+	}
+	if len(e.Statement) > statementLimit+5 || !strings.HasSuffix(e.Statement, ";\n...") {
+		t.Errorf("expected the statements cut at the limit, got %d bytes", len(e.Statement))
+	}
+}
+
+// memorySink keeps the entries written to it
+type memorySink []Entry
+
+func (m *memorySink) Write(_ context.Context, e Entry) error {
+	*m = append(*m, e)
+	return nil
+}
+
+func TestJob(t *testing.T) {
+	var written memorySink
+	e := &Entry{Action: "api_import", Object: "public.users", RowsAffected: -1}
+	ctx := WithSink(WithEntry(t.Context(), e), &written)
+
+	job := StartJob(ctx)
+	if e.Outcome != OutcomeSubmitted {
+		t.Errorf("expected the action to be submitted, got %q", e.Outcome)
+	}
+	jobCtx := job.Context(t.Context())
+	AddRowsAffected(jobCtx, 5)
+	job.Finish(jobCtx, errors.New("import rolled back"))
+
+	if len(written) != 1 {
+		t.Fatalf("expected one entry, got %d", len(written))
+	}
+	got := written[0]
+	if got.Object != "public.users" || got.RowsAffected != 5 || got.Outcome != OutcomeError || got.Error != "import rolled back" {
+		t.Errorf("unexpected job entry %+v", got)
+	}
+	if e.RowsAffected != -1 {
+		t.Errorf("the job must not change the action's entry, got %+v", e)
+	}
+
+	// unaudited actions start jobs that record nothing
+	StartJob(t.Context()).Finish(t.Context(), nil)
+}
+
+// testSearch writes three entries to s and checks the searches of a sink
+func testSearch(t *testing.T, s interface {
+	Sink
+	Searcher
+}) {
+	base := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	entries := []Entry{
+		{Time: base, Operator: "alice", Action: "api_sql_execute", Statement: "DELETE FROM orders WHERE id = ?", RowsAffected: 3, Outcome: OutcomeSuccess},
+		{Time: base.Add(time.Hour), Operator: "bob", Action: "api_delete_row", Object: "public.users", Params: []string{"string"}, RowsAffected: -1, Outcome: OutcomeDenied, Error: "permission denied: edit"},
+		{Time: base.Add(2 * time.Hour), Operator: "Alice", Action: "api_update_row", Object: "public.orders", RowsAffected: 1, Outcome: OutcomeSuccess},
+	}
+	for _, e := range entries {
+		if err := s.Write(t.Context(), e); err != nil {
+			t.Fatalf("Write: %v", err)
+		}
+	}
+
+	all, err := s.Search(t.Context(), Query{})
+	if err != nil {
+		t.Fatalf("Search: %v", err)
+	}
+	if len(all) != 3 || all[0].Action != "api_update_row" || all[2].Action != "api_sql_execute" {
+		t.Fatalf("expected all entries newest first, got %+v", all)
+	}
+	if got := all[1]; got.Object != "public.users" || len(got.Params) != 1 || got.RowsAffected != -1 || got.Error != "permission denied: edit" || !got.Time.Equal(base.Add(time.Hour)) {
+		t.Errorf("entry did not round trip: %+v", got)
+	}
+
+	tests := []struct {
+		name string
+		q    Query
+		want int
+	}{
+		{"operator ignores case", Query{Operator: "ALICE"}, 2},
+		{"outcome", Query{Outcome: OutcomeDenied}, 1},
+		{"text", Query{Text: "orders"}, 2},
+		{"since", Query{Since: base.Add(30 * time.Minute)}, 2},
+		{"until", Query{Until: base.Add(30 * time.Minute)}, 1},
+		{"limit", Query{Limit: 2}, 2},
+	}
+	for _, tt := range tests {
+		got, err := s.Search(t.Context(), tt.q)
+		if err != nil || len(got) != tt.want {
+			t.Errorf("%s: expected %d entries, got %d (%v)", tt.name, tt.want, len(got), err)
+		}
+	}
+}
+
+func TestFile(t *testing.T) {
+	s, err := NewFile(filepath.Join(t.TempDir(), "audit.jsonl"))
+	if err != nil {
+		t.Fatalf("NewFile: %v", err)
+	}
+	defer s.Close()
+	testSearch(t, s)
+}
+
+func TestSQL(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.db")
+	s, err := NewSQL("sqlite", path, "")
+	if err != nil {
+		t.Fatalf("NewSQL: %v", err)
+	}
+	testSearch(t, s)
+	s.Close()
+
+	// reopening finds the existing table
+	s, err = NewSQL("sqlite", path, "")
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	defer s.Close()
+	if got, _ := s.Search(t.Context(), Query{}); len(got) != 3 {
+		t.Errorf("expected the entries to persist, got %d", len(got))
+	}
+}
+
+func TestRecorder(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		outcome string
+		message string
+	}{
+		{"api success", func(w http.ResponseWriter, r *http.Request) {
+			api.Respond(w, r, api.Success("row updated"))
+		}, OutcomeSuccess, ""},
+		{"api error", func(w http.ResponseWriter, r *http.Request) {
+			api.Respond(w, r, api.Error("refusing to update: match count (2) != 1"))
+		}, OutcomeError, "refusing to update: match count (2) != 1"},
+		{"http error", func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "boom", http.StatusInternalServerError)
+		}, OutcomeError, "Internal Server Error"},
+		{"download", func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("id,name\n1,alice\n"))
+		}, OutcomeSuccess, ""},
+	}
+	for _, tt := range tests {
+		rec := NewRecorder(httptest.NewRecorder())
+		tt.handler(rec, httptest.NewRequest("POST", "/db", nil))
+		if outcome, message := rec.Result(); outcome != tt.outcome || message != tt.message {
+			t.Errorf("%s: got %q %q, want %q %q", tt.name, outcome, message, tt.outcome, tt.message)
+		}
+	}
+}
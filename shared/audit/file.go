@@ -0,0 +1,81 @@
+package audit
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"sync"
+)
+
+// File appends entries to a JSON-lines file, one entry per line. Searches
+// read the whole file, so rotate it with an external tool when it grows.
+type File struct {
+	path string
+
+	mu sync.Mutex
+	f  *os.File
+}
+
+var _ Searcher = (*File)(nil)
+
+// NewFile opens, and if needed creates, the log file at path
+func NewFile(path string) (*File, error) {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log: %v", err)
+	}
+	return &File{path: path, f: f}, nil
+}
+
+// Close closes the file
+func (s *File) Close() error {
+	return s.f.Close()
+}
+
+// Write appends e as one line
+func (s *File) Write(ctx context.Context, e Entry) error {
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err = s.f.Write(append(line, '\n'))
+	return err
+}
+
+// Search scans the file and returns the newest matching entries
+func (s *File) Search(ctx context.Context, q Query) ([]Entry, error) {
+	f, err := os.Open(s.path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read audit log: %v", err)
+	}
+	defer f.Close()
+
+	limit := q.limit()
+	entries := []Entry{}
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var e Entry
+		if json.Unmarshal(scanner.Bytes(), &e) != nil || !q.Matches(e) {
+			continue
+		}
+		entries = append(entries, e)
+		// keep only the newest, the file being in time order
+		if len(entries) > 2*limit {
+			entries = slices.Delete(entries, 0, len(entries)-limit)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(entries) > limit {
+		entries = entries[len(entries)-limit:]
+	}
+	slices.Reverse(entries)
+	return entries, nil
+}
@@ -0,0 +1,101 @@
+package audit
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+)
+
+// recordLimit is how much of the response body Recorder keeps
+const recordLimit = 4096
+
+// Recorder wraps a ResponseWriter to learn how an action ended: it keeps
+// the status code and the start of the body, where API responses carry
+// their status and message.
+type Recorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+// NewRecorder wraps w
+func NewRecorder(w http.ResponseWriter) *Recorder {
+	return &Recorder{ResponseWriter: w}
+}
+
+// WriteHeader records the status code
+func (r *Recorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// Write keeps the start of the body
+func (r *Recorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	if room := recordLimit - r.body.Len(); room > 0 {
+		r.body.Write(b[:min(room, len(b))])
+	}
+	return r.ResponseWriter.Write(b)
+}
+
+// Flush passes through to the wrapped writer for streamed responses
+func (r *Recorder) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap exposes the wrapped writer to http.ResponseController
+func (r *Recorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// Result returns the outcome of the response and, for failures, its
+// message. An HTTP error status or a JSON status other than "success" is
+// an error; any other response, like a file download, is a success.
+func (r *Recorder) Result() (outcome, message string) {
+	status, message := responseStatus(r.body.Bytes())
+	switch {
+	case r.status >= http.StatusBadRequest:
+		if message == "" {
+			message = http.StatusText(r.status)
+		}
+		return OutcomeError, message
+	case status != "" && status != "success":
+		return OutcomeError, message
+	}
+	return OutcomeSuccess, ""
+}
+
+// responseStatus reads the top-level "status" and "message" of a JSON
+// object, tolerating a body cut off after them
+func responseStatus(body []byte) (status, message string) {
+	dec := json.NewDecoder(bytes.NewReader(body))
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('{') {
+		return "", ""
+	}
+	for dec.More() {
+		key, err := dec.Token()
+		if err != nil {
+			break
+		}
+		var value json.RawMessage
+		if err := dec.Decode(&value); err != nil {
+			break
+		}
+		switch key {
+		case "status":
+			json.Unmarshal(value, &status)
+		case "message":
+			json.Unmarshal(value, &message)
+		}
+		if status != "" && message != "" {
+			break
+		}
+	}
+	return status, message
+}
@@ -0,0 +1,119 @@
+package audit
+
+import "strings"
+
+// RedactSQL replaces the literals of a SQL text with ?, so the audit log
+// shows what ran without the values: string, dollar-quoted and numeric
+// literals are redacted, comments dropped, and quoted identifiers kept.
+// Whether a backslash escapes the quote after it depends on the database
+// and its settings, so from a quoted text holding one to the end everything
+// is redacted.
+func RedactSQL(sql string) string {
+	var b strings.Builder
+	b.Grow(len(sql))
+	for i := 0; i < len(sql); {
+		c := sql[i]
+		switch {
+		case c == '\'':
+			end, backslash := skipQuoted(sql, i, '\'')
+			b.WriteByte('?')
+			if backslash {
+				return b.String()
+			}
+			i = end
+		case c == '"' || c == '`':
+			end, backslash := skipQuoted(sql, i, c)
+			// MySQL reads a double-quoted text as a string literal
+			if backslash && c == '"' {
+				b.WriteByte('?')
+				return b.String()
+			}
+			b.WriteString(sql[i:end])
+			i = end
+		case c == '[':
+			end := strings.IndexByte(sql[i:], ']')
+			if end < 0 {
+				end = len(sql) - i - 1
+			}
+			b.WriteString(sql[i : i+end+1])
+			i += end + 1
+		case c == '-' && strings.HasPrefix(sql[i:], "--"):
+			end := strings.IndexByte(sql[i:], '\n')
+			if end < 0 {
+				end = len(sql) - i
+			}
+			b.WriteByte(' ')
+			i += end
+		case c == '/' && strings.HasPrefix(sql[i:], "/*"):
+			end := strings.Index(sql[i+2:], "*/")
+			if end < 0 {
+				i = len(sql)
+			} else {
+				i += end + 4
+			}
+			b.WriteByte(' ')
+		case c == '$' && dollarTag(sql[i:]) != "":
+			tag := dollarTag(sql[i:])
+			end := strings.Index(sql[i+len(tag):], tag)
+			if end < 0 {
+				i = len(sql)
+			} else {
+				i += len(tag) + end + len(tag)
+			}
+			b.WriteByte('?')
+		case isDigit(c) && (i == 0 || !isIdentByte(sql[i-1]) && sql[i-1] != '$'):
+			i++
+			for i < len(sql) && (isIdentByte(sql[i]) || sql[i] == '.' ||
+				((sql[i] == '+' || sql[i] == '-') && (sql[i-1] == 'e' || sql[i-1] == 'E'))) {
+				i++
+			}
+			b.WriteByte('?')
+		default:
+			b.WriteByte(c)
+			i++
+		}
+	}
+	return b.String()
+}
+
+// skipQuoted returns the index after the quoted text starting at i, where
+// a doubled quote escapes itself, and whether the text holds a backslash
+func skipQuoted(sql string, i int, quote byte) (int, bool) {
+	backslash := false
+	for j := i + 1; j < len(sql); j++ {
+		if sql[j] == '\\' {
+			backslash = true
+		}
+		if sql[j] != quote {
+			continue
+		}
+		if j+1 < len(sql) && sql[j+1] == quote {
+			j++
+			continue
+		}
+		return j + 1, backslash
+	}
+	return len(sql), backslash
+}
+
+// dollarTag returns the opening tag of a PostgreSQL dollar-quoted string,
+// "$$" or "$name$", or "" when s doesn't start with one
+func dollarTag(s string) string {
+	for j := 1; j < len(s); j++ {
+		if s[j] == '$' {
+			return s[:j+1]
+		}
+		if !isIdentByte(s[j]) || (j == 1 && isDigit(s[j])) {
+			return ""
+		}
+	}
+	return ""
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isIdentByte(c byte) bool {
+	return c == '_' || isDigit(c) || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || c >= 0x80
+}
@@ -0,0 +1,198 @@
+package audit
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dracory/weebase/shared/constants"
+	"github.com/dracory/weebase/shared/dialect"
+	"github.com/dracory/weebase/shared/driver"
+)
+
+// DefaultTable is the table the SQL sink writes to when none is configured
+const DefaultTable = "weebase_audit"
+
+// timeLayout stores times as fixed-width UTC text, so they sort as strings
+// on every dialect
+const timeLayout = "2006-01-02T15:04:05.000000Z"
+
+// auditColumns are the columns of the audit table in insert order
+var auditColumns = []string{
+	"ts", "operator", "session_id", "request_id", "profile", "database_name",
+	"action", "object_name", "statement", "params", "rows_affected", "outcome", "error",
+}
+
+// SQL writes entries to a table of any supported database, creating the
+// table on first use
+type SQL struct {
+	db     *sql.DB
+	driver string
+	table  string
+}
+
+var _ Searcher = (*SQL)(nil)
+
+// NewSQL opens the audit database and makes sure table exists; an empty
+// table name uses DefaultTable
+func NewSQL(driverName, dsn, table string) (*SQL, error) {
+	if table == "" {
+		table = DefaultTable
+	}
+	if !dialect.SanitizeIdent(table) {
+		return nil, fmt.Errorf("invalid audit table name %q", table)
+	}
+	db, err := driver.OpenSQLDB(driverName, dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit database: %v", err)
+	}
+	s := &SQL{db: db, driver: dialect.Normalize(driverName), table: table}
+	if s.driver == constants.DriverSQLite {
+		// one writer at a time keeps SQLite from reporting a locked database
+		db.SetMaxOpenConns(1)
+	}
+	if err := s.ensureTable(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create audit table: %v", err)
+	}
+	return s, nil
+}
+
+// Close closes the database
+func (s *SQL) Close() error {
+	return s.db.Close()
+}
+
+func (s *SQL) quotedTable() string {
+	return dialect.QuoteIdent(s.driver, s.table)
+}
+
+// ensureTable creates the audit table unless it can already be queried
+func (s *SQL) ensureTable() error {
+	if _, err := s.db.Exec("SELECT 1 FROM " + s.quotedTable() + " WHERE 1 = 0"); err == nil {
+		return nil
+	}
+	varchar := func(n int) string {
+		return dialect.RenderType(s.driver, dialect.TypeVarchar+"("+strconv.Itoa(n)+")")
+	}
+	text := dialect.RenderType(s.driver, dialect.TypeText)
+	types := map[string]string{
+		"ts":            varchar(40) + " NOT NULL",
+		"operator":      varchar(255),
+		"session_id":    varchar(255),
+		"request_id":    varchar(255),
+		"profile":       varchar(255),
+		"database_name": varchar(255),
+		"action":        varchar(100) + " NOT NULL",
+		"object_name":   varchar(255),
+		"statement":     text,
+		"params":        text,
+		"rows_affected": dialect.RenderType(s.driver, dialect.TypeBigInt),
+		"outcome":       varchar(20) + " NOT NULL",
+		"error":         text,
+	}
+	defs := make([]string, len(auditColumns))
+	for i, col := range auditColumns {
+		defs[i] = dialect.QuoteIdent(s.driver, col) + " " + types[col]
+	}
+	_, err := s.db.Exec("CREATE TABLE " + s.quotedTable() + " (" + strings.Join(defs, ", ") + ")")
+	return err
+}
+
+// Write inserts e
+func (s *SQL) Write(ctx context.Context, e Entry) error {
+	cols := make([]string, len(auditColumns))
+	marks := make([]string, len(auditColumns))
+	for i, col := range auditColumns {
+		cols[i] = dialect.QuoteIdent(s.driver, col)
+		marks[i] = dialect.Placeholder(s.driver, i+1)
+	}
+	values := []any{
+		e.Time.UTC().Format(timeLayout), e.Operator, e.SessionID, e.RequestID, e.Profile, e.Database,
+		e.Action, e.Object, e.Statement, marshalParams(e.Params), e.RowsAffected, e.Outcome, e.Error,
+	}
+	args := make([]any, len(values))
+	for i, v := range values {
+		args[i] = dialect.BindArg(s.driver, i+1, v)
+	}
+	_, err := s.db.ExecContext(ctx, "INSERT INTO "+s.quotedTable()+" ("+strings.Join(cols, ", ")+") VALUES ("+strings.Join(marks, ", ")+")", args...)
+	return err
+}
+
+// Search returns the newest entries matching q
+func (s *SQL) Search(ctx context.Context, q Query) ([]Entry, error) {
+	var where []string
+	var args []any
+	add := func(cond string, value any) {
+		n := len(args) + 1
+		where = append(where, strings.ReplaceAll(cond, "?", dialect.Placeholder(s.driver, n)))
+		args = append(args, dialect.BindArg(s.driver, n, value))
+	}
+	col := func(name string) string { return dialect.QuoteIdent(s.driver, name) }
+
+	if q.Operator != "" {
+		add("LOWER("+col("operator")+") = ?", strings.ToLower(q.Operator))
+	}
+	if q.Action != "" {
+		add(col("action")+" = ?", q.Action)
+	}
+	if q.Outcome != "" {
+		add(col("outcome")+" = ?", q.Outcome)
+	}
+	if !q.Since.IsZero() {
+		add(col("ts")+" >= ?", q.Since.UTC().Format(timeLayout))
+	}
+	if !q.Until.IsZero() {
+		add(col("ts")+" <= ?", q.Until.UTC().Format(timeLayout))
+	}
+
+	cols := make([]string, len(auditColumns))
+	for i, c := range auditColumns {
+		cols[i] = col(c)
+	}
+	query := "SELECT " + strings.Join(cols, ", ") + " FROM " + s.quotedTable()
+	if s.driver == constants.DriverSQLServer {
+		query = "SELECT TOP " + strconv.Itoa(MaxLimit*10) + " " + strings.Join(cols, ", ") + " FROM " + s.quotedTable()
+	}
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	query += " ORDER BY " + col("ts") + " DESC"
+	if s.driver != constants.DriverSQLServer {
+		query += " LIMIT " + strconv.Itoa(MaxLimit*10)
+	}
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	// the free-text filter runs here, so it means the same on every dialect
+	limit := q.limit()
+	entries := []Entry{}
+	for rows.Next() && len(entries) < limit {
+		var e Entry
+		var ts string
+		var operator, sessionID, requestID, profile, database, object, statement, params, errText sql.NullString
+		var rowsAffected sql.NullInt64
+		err := rows.Scan(&ts, &operator, &sessionID, &requestID, &profile, &database,
+			&e.Action, &object, &statement, &params, &rowsAffected, &e.Outcome, &errText)
+		if err != nil {
+			return nil, err
+		}
+		e.Time, _ = time.Parse(timeLayout, ts)
+		e.Operator, e.SessionID, e.RequestID = operator.String, sessionID.String, requestID.String
+		e.Profile, e.Database, e.Object = profile.String, database.String, object.String
+		e.Statement, e.Error = statement.String, errText.String
+		e.Params = unmarshalParams(params.String)
+		e.RowsAffected = rowsAffected.Int64
+		if q.Matches(e) {
+			entries = append(entries, e)
+		}
+	}
+	return entries, rows.Err()
+}
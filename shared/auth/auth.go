@@ -0,0 +1,171 @@
+// Package auth identifies the operator in front of weebase before any action
+// runs. An Authenticator checks every request; the built-ins cover HTTP basic
+// against an htpasswd file, a static API token, OpenID Connect single sign-on
+// and a callback so an embedding application can reuse its own
+// authentication.
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+)
+
+// ErrUnauthenticated is returned when a request carries no valid credentials
+var ErrUnauthenticated = errors.New("authentication required")
+
+// ErrUnknownUser is returned by a Directory for operators it doesn't know
+var ErrUnknownUser = errors.New("unknown user")
+
+// User is the operator behind a request
+type User struct {
+	Name string `json:"name"`
+	// Roles are RBAC roles given by the authenticator itself, e.g. from the
+	// embedding application's own user directory
+	Roles []string `json:"roles,omitempty"`
+	// Scope is set for requests authenticated with a personal API token
+	Scope *Scope `json:"scope,omitempty"`
+}
+
+// Scope narrows what a request authenticated with a personal API token may
+// do to some of its owner's roles and some connection profiles; empty
+// lists narrow nothing
+type Scope struct {
+	TokenID  string   `json:"token_id"`
+	Roles    []string `json:"roles,omitempty"`
+	Profiles []string `json:"profiles,omitempty"`
+}
+
+// Authenticator identifies the operator of a request. It returns
+// ErrUnauthenticated when the request has no valid credentials; other errors
+// mean the check itself failed and are logged.
+type Authenticator interface {
+	Authenticate(r *http.Request) (User, error)
+}
+
+// Challenger is implemented by authenticators that tell the client how to
+// authenticate when a request is turned away, e.g. with WWW-Authenticate
+type Challenger interface {
+	Challenge(w http.ResponseWriter)
+}
+
+// Interactive is implemented by authenticators that sign browsers in through
+// a flow of their own, e.g. a redirect to an identity provider. Login starts
+// the flow for an unauthenticated page request, Callback serves the return
+// from the provider and Logout ends the sign-in, returning where to send the
+// browser next ("" to stay in weebase).
+type Interactive interface {
+	Login(w http.ResponseWriter, r *http.Request)
+	Callback(w http.ResponseWriter, r *http.Request)
+	Logout(w http.ResponseWriter, r *http.Request) string
+}
+
+// AsInteractive returns the interactive authenticator of a, looking into
+// chains for their first interactive member
+func AsInteractive(a Authenticator) (Interactive, bool) {
+	if chain, ok := a.(Chain); ok {
+		for _, member := range chain {
+			if i, ok := AsInteractive(member); ok {
+				return i, true
+			}
+		}
+		return nil, false
+	}
+	i, ok := a.(Interactive)
+	return i, ok
+}
+
+// Directory is implemented by authenticators that can look an operator up
+// by name, without their credentials. Requests made on an operator's
+// behalf, such as with a personal API token, are then checked against the
+// operator as they are now: removed operators are refused and their roles
+// are current.
+type Directory interface {
+	Lookup(ctx context.Context, name string) (User, error)
+}
+
+// AsDirectory returns the directory of a. A chain is one only when all its
+// members are, as an operator one member can't look up may still be known
+// to it.
+func AsDirectory(a Authenticator) (Directory, bool) {
+	chain, ok := a.(Chain)
+	if !ok {
+		d, ok := a.(Directory)
+		return d, ok
+	}
+	var dirs directories
+	for _, member := range chain {
+		d, ok := AsDirectory(member)
+		if !ok {
+			return nil, false
+		}
+		dirs = append(dirs, d)
+	}
+	return dirs, len(dirs) > 0
+}
+
+// directories looks an operator up in each directory in turn
+type directories []Directory
+
+// Lookup returns the operator from the first directory that knows them
+func (ds directories) Lookup(ctx context.Context, name string) (User, error) {
+	for _, d := range ds {
+		user, err := d.Lookup(ctx, name)
+		if !errors.Is(err, ErrUnknownUser) {
+			return user, err
+		}
+	}
+	return User{}, ErrUnknownUser
+}
+
+// Func adapts a callback of the embedding application to an Authenticator
+type Func func(r *http.Request) (User, error)
+
+// Authenticate calls f
+func (f Func) Authenticate(r *http.Request) (User, error) {
+	return f(r)
+}
+
+// Chain tries its authenticators in order and accepts the first that
+// identifies the operator, e.g. basic auth for people and a token for scripts
+type Chain []Authenticator
+
+// Authenticate returns the user of the first authenticator that succeeds
+func (c Chain) Authenticate(r *http.Request) (User, error) {
+	var errs []error
+	for _, a := range c {
+		user, err := a.Authenticate(r)
+		if err == nil {
+			return user, nil
+		}
+		if !errors.Is(err, ErrUnauthenticated) {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		return User{}, errors.Join(errs...)
+	}
+	return User{}, ErrUnauthenticated
+}
+
+// Challenge sends the challenges of every authenticator in the chain
+func (c Chain) Challenge(w http.ResponseWriter) {
+	for _, a := range c {
+		if ch, ok := a.(Challenger); ok {
+			ch.Challenge(w)
+		}
+	}
+}
+
+type ctxKey struct{}
+
+// WithUser returns a copy of ctx carrying the operator
+func WithUser(ctx context.Context, user User) context.Context {
+	return context.WithValue(ctx, ctxKey{}, user)
+}
+
+// FromContext returns the operator of a request, if one was identified
+func FromContext(ctx context.Context) (User, bool) {
+	user, ok := ctx.Value(ctxKey{}).(User)
+	return user, ok
+}
@@ -0,0 +1,171 @@
+package auth
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func writeHtpasswd(t *testing.T, path string, users map[string]string) {
+	content := "# operators\n"
+	for name, password := range users {
+		hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+		if err != nil {
+			t.Fatalf("failed to hash password: %v", err)
+		}
+		content += name + ":" + string(hash) + "\n"
+	}
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("failed to write htpasswd file: %v", err)
+	}
+}
+
+func basicRequest(name, password string) *http.Request {
+	r := httptest.NewRequest("GET", "/", nil)
+	if name != "" {
+		r.SetBasicAuth(name, password)
+	}
+	return r
+}
+
+func TestHtpasswd(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "htpasswd")
+	writeHtpasswd(t, path, map[string]string{"alice": "secret"})
+
+	h, err := NewHtpasswd(path, "")
+	if err != nil {
+		t.Fatalf("NewHtpasswd: %v", err)
+	}
+
+	user, err := h.Authenticate(basicRequest("alice", "secret"))
+	if err != nil || user.Name != "alice" {
+		t.Fatalf("expected alice, got %+v, %v", user, err)
+	}
+	for _, r := range []*http.Request{basicRequest("alice", "wrong"), basicRequest("bob", "secret"), basicRequest("", "")} {
+		if _, err := h.Authenticate(r); !errors.Is(err, ErrUnauthenticated) {
+			t.Errorf("expected ErrUnauthenticated, got %v", err)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	h.Challenge(w)
+	if got := w.Header().Get("WWW-Authenticate"); got != `Basic realm="weebase", charset="UTF-8"` {
+		t.Errorf("unexpected challenge %q", got)
+	}
+
+	// users added to the file are picked up without a restart
+	writeHtpasswd(t, path, map[string]string{"alice": "secret", "bob": "hunter2"})
+	later := time.Now().Add(time.Second)
+	os.Chtimes(path, later, later)
+	if user, err := h.Authenticate(basicRequest("bob", "hunter2")); err != nil || user.Name != "bob" {
+		t.Errorf("expected bob after reload, got %+v, %v", user, err)
+	}
+
+	// users removed from the file are no longer known
+	writeHtpasswd(t, path, map[string]string{"bob": "hunter2"})
+	later = later.Add(time.Second)
+	os.Chtimes(path, later, later)
+	if _, err := h.Lookup(t.Context(), "alice"); !errors.Is(err, ErrUnknownUser) {
+		t.Errorf("expected alice unknown after removal, got %v", err)
+	}
+	if user, err := h.Lookup(t.Context(), "bob"); err != nil || user.Name != "bob" {
+		t.Errorf("expected bob, got %+v, %v", user, err)
+	}
+}
+
+func TestHtpasswd_RejectsOtherHashes(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "htpasswd")
+	os.WriteFile(path, []byte("alice:$apr1$abc$def\n"), 0o600)
+	if _, err := NewHtpasswd(path, ""); err == nil {
+		t.Fatal("expected an error for a non-bcrypt entry")
+	}
+}
+
+func TestToken(t *testing.T) {
+	token := NewToken("s3cret", User{Name: "ci"})
+
+	tests := []struct {
+		name   string
+		header string
+		value  string
+		ok     bool
+	}{
+		{"bearer", "Authorization", "Bearer s3cret", true},
+		{"header", TokenHeader, "s3cret", true},
+		{"wrong token", "Authorization", "Bearer nope", false},
+		{"basic scheme", "Authorization", "Basic s3cret", false},
+		{"missing", "", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			if tt.header != "" {
+				r.Header.Set(tt.header, tt.value)
+			}
+			user, err := token.Authenticate(r)
+			if tt.ok && (err != nil || user.Name != "ci") {
+				t.Errorf("expected ci, got %+v, %v", user, err)
+			}
+			if !tt.ok && !errors.Is(err, ErrUnauthenticated) {
+				t.Errorf("expected ErrUnauthenticated, got %v", err)
+			}
+		})
+	}
+}
+
+func TestChainAndFunc(t *testing.T) {
+	failing := errors.New("directory unavailable")
+	chain := Chain{
+		NewToken("s3cret", User{Name: "ci"}),
+		Func(func(r *http.Request) (User, error) {
+			switch r.Header.Get("X-User") {
+			case "":
+				return User{}, ErrUnauthenticated
+			case "error":
+				return User{}, failing
+			}
+			return User{Name: r.Header.Get("X-User")}, nil
+		}),
+	}
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("X-User", "carol")
+	if user, err := chain.Authenticate(r); err != nil || user.Name != "carol" {
+		t.Errorf("expected carol, got %+v, %v", user, err)
+	}
+
+	r = httptest.NewRequest("GET", "/", nil)
+	if _, err := chain.Authenticate(r); !errors.Is(err, ErrUnauthenticated) {
+		t.Errorf("expected ErrUnauthenticated, got %v", err)
+	}
+
+	r.Header.Set("X-User", "error")
+	if _, err := chain.Authenticate(r); !errors.Is(err, failing) {
+		t.Errorf("expected the callback's error, got %v", err)
+	}
+
+	if _, ok := AsDirectory(chain); ok {
+		t.Error("a chain with a callback can't look users up")
+	}
+	dir, ok := AsDirectory(Chain{NewToken("a", User{Name: "ci"}), NewToken("b", User{Name: "deploy"})})
+	if !ok {
+		t.Fatal("expected a chain of tokens to be a directory")
+	}
+	if user, err := dir.Lookup(t.Context(), "deploy"); err != nil || user.Name != "deploy" {
+		t.Errorf("expected deploy, got %+v, %v", user, err)
+	}
+	if _, err := dir.Lookup(t.Context(), "carol"); !errors.Is(err, ErrUnknownUser) {
+		t.Errorf("expected ErrUnknownUser, got %v", err)
+	}
+
+	user, ok := FromContext(WithUser(r.Context(), User{Name: "dave"}))
+	if !ok || user.Name != "dave" {
+		t.Errorf("expected dave from context, got %+v", user)
+	}
+}
@@ -0,0 +1,138 @@
+package auth
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// DefaultRealm is the realm sent with basic auth challenges when none is given
+const DefaultRealm = "weebase"
+
+// dummyHash is compared against for unknown users so that a missing user
+// takes as long to reject as a wrong password
+var dummyHash = sync.OnceValue(func() []byte {
+	hash, _ := bcrypt.GenerateFromPassword([]byte("weebase"), bcrypt.DefaultCost)
+	return hash
+})
+
+// Htpasswd authenticates HTTP basic credentials against an htpasswd file.
+// Only bcrypt entries are accepted (htpasswd -B). The file is read again when
+// it changes, so users can be added without a restart.
+type Htpasswd struct {
+	path  string
+	realm string
+
+	mu       sync.Mutex
+	modified time.Time
+	users    map[string][]byte
+}
+
+// NewHtpasswd loads an htpasswd file; realm names the protection space shown
+// by browsers and defaults to DefaultRealm
+func NewHtpasswd(path, realm string) (*Htpasswd, error) {
+	if realm == "" {
+		realm = DefaultRealm
+	}
+	h := &Htpasswd{path: path, realm: realm}
+	if err := h.reload(); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// Authenticate checks the basic credentials of the request
+func (h *Htpasswd) Authenticate(r *http.Request) (User, error) {
+	name, password, ok := r.BasicAuth()
+	if !ok {
+		return User{}, ErrUnauthenticated
+	}
+
+	h.mu.Lock()
+	if err := h.reload(); err != nil {
+		h.mu.Unlock()
+		return User{}, err
+	}
+	hash, found := h.users[name]
+	h.mu.Unlock()
+
+	if !found {
+		bcrypt.CompareHashAndPassword(dummyHash(), []byte(password))
+		return User{}, ErrUnauthenticated
+	}
+	if bcrypt.CompareHashAndPassword(hash, []byte(password)) != nil {
+		return User{}, ErrUnauthenticated
+	}
+	return User{Name: name}, nil
+}
+
+// Lookup implements Directory: users removed from the file are unknown
+func (h *Htpasswd) Lookup(_ context.Context, name string) (User, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if err := h.reload(); err != nil {
+		return User{}, err
+	}
+	if _, ok := h.users[name]; !ok {
+		return User{}, ErrUnknownUser
+	}
+	return User{Name: name}, nil
+}
+
+// Challenge asks the client for basic credentials
+func (h *Htpasswd) Challenge(w http.ResponseWriter) {
+	w.Header().Add("WWW-Authenticate", fmt.Sprintf(`Basic realm=%q, charset="UTF-8"`, h.realm))
+}
+
+// reload reads the file when it changed since the last read
+func (h *Htpasswd) reload() error {
+	info, err := os.Stat(h.path)
+	if err != nil {
+		return fmt.Errorf("failed to read htpasswd file: %v", err)
+	}
+	if h.users != nil && info.ModTime().Equal(h.modified) {
+		return nil
+	}
+	data, err := os.ReadFile(h.path)
+	if err != nil {
+		return fmt.Errorf("failed to read htpasswd file: %v", err)
+	}
+	users, err := parseHtpasswd(data)
+	if err != nil {
+		return fmt.Errorf("invalid htpasswd file %s: %v", h.path, err)
+	}
+	h.users = users
+	h.modified = info.ModTime()
+	return nil
+}
+
+// parseHtpasswd reads "user:hash" lines, skipping blanks and # comments
+func parseHtpasswd(data []byte) (map[string][]byte, error) {
+	users := map[string][]byte{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		name, hash, ok := strings.Cut(text, ":")
+		if !ok || name == "" {
+			return nil, fmt.Errorf("line %d: expected user:hash", line)
+		}
+		if _, err := bcrypt.Cost([]byte(hash)); err != nil {
+			return nil, fmt.Errorf("line %d: only bcrypt hashes are supported (htpasswd -B)", line)
+		}
+		users[name] = []byte(hash)
+	}
+	return users, scanner.Err()
+}
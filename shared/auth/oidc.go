@@ -0,0 +1,547 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Cookies of the OIDC sign-in
+const (
+	// OIDCCookie holds the signed-in operator
+	OIDCCookie = "wb_oidc"
+	// OIDCStateCookie holds the state, nonce and PKCE verifier of a login
+	// in progress
+	OIDCStateCookie = "wb_oidc_state"
+)
+
+const (
+	// DefaultOIDCSessionTTL is how long an OIDC sign-in lasts by default
+	DefaultOIDCSessionTTL = 8 * time.Hour
+	// oidcLoginTTL bounds the round trip through the provider
+	oidcLoginTTL = 10 * time.Minute
+	// oidcClockSkew is tolerated when checking token expiry
+	oidcClockSkew = time.Minute
+	// jwksRefreshInterval limits refetching the key set for unknown key ids
+	jwksRefreshInterval = time.Minute
+)
+
+// OIDCConfig configures single sign-on through an OpenID Connect provider
+type OIDCConfig struct {
+	// Issuer is the provider's issuer URL; its discovery document is read
+	// from Issuer + "/.well-known/openid-configuration"
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	// RedirectURL is the absolute URL of the auth_callback action, as
+	// registered with the provider
+	RedirectURL string
+	// PostLogoutRedirectURL is where the provider sends the browser after
+	// signing out, when it supports RP-initiated logout
+	PostLogoutRedirectURL string
+	// Scopes are requested besides "openid"; defaults to profile and email
+	Scopes []string
+	// UsernameClaim names the operator; defaults to preferred_username,
+	// falling back to email and sub
+	UsernameClaim string
+	// RolesClaim holds the groups mapped to RBAC roles, dots reaching into
+	// nested claims (e.g. realm_access.roles); defaults to "groups"
+	RolesClaim string
+	// RoleMap maps values of the roles claim to RBAC roles. Without it the
+	// values are used as role names.
+	RoleMap map[string][]string
+	// Secret signs the sign-in cookies
+	Secret string
+	// SessionTTL is how long a sign-in lasts; defaults to DefaultOIDCSessionTTL
+	SessionTTL time.Duration
+	// HTTPClient talks to the provider; defaults to a client with a timeout
+	HTTPClient *http.Client
+}
+
+// OIDC signs operators in with the authorization code flow and PKCE. The
+// ID token is verified against the provider's JWKS, then the operator is
+// kept in a signed cookie for SessionTTL. The discovery document and keys
+// are fetched on first use, so weebase starts while the provider is down.
+type OIDC struct {
+	cfg OIDCConfig
+	key []byte
+
+	mu          sync.Mutex
+	provider    *oidcProvider
+	keys        map[string]crypto.PublicKey
+	keysFetched time.Time
+}
+
+// oidcProvider is the part of the discovery document weebase uses
+type oidcProvider struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+	EndSessionEndpoint    string `json:"end_session_endpoint"`
+}
+
+// oidcSignIn is the payload of OIDCCookie
+type oidcSignIn struct {
+	Name    string   `json:"name"`
+	Roles   []string `json:"roles,omitempty"`
+	Expires int64    `json:"exp"`
+}
+
+// oidcLogin is the payload of OIDCStateCookie
+type oidcLogin struct {
+	State    string `json:"state"`
+	Nonce    string `json:"nonce"`
+	Verifier string `json:"verifier"`
+	Return   string `json:"return"`
+	Expires  int64  `json:"exp"`
+}
+
+// NewOIDC checks the configuration and fills in defaults
+func NewOIDC(cfg OIDCConfig) (*OIDC, error) {
+	switch {
+	case cfg.Issuer == "":
+		return nil, errors.New("oidc: issuer is required")
+	case cfg.ClientID == "":
+		return nil, errors.New("oidc: client id is required")
+	case cfg.RedirectURL == "":
+		return nil, errors.New("oidc: redirect url is required")
+	case cfg.Secret == "":
+		return nil, errors.New("oidc: secret is required")
+	}
+	if len(cfg.Scopes) == 0 {
+		cfg.Scopes = []string{"profile", "email"}
+	}
+	if cfg.RolesClaim == "" {
+		cfg.RolesClaim = "groups"
+	}
+	if cfg.SessionTTL <= 0 {
+		cfg.SessionTTL = DefaultOIDCSessionTTL
+	}
+	if cfg.HTTPClient == nil {
+		cfg.HTTPClient = &http.Client{Timeout: 10 * time.Second}
+	}
+	key := sha256.Sum256([]byte("weebase-oidc:" + cfg.Secret))
+	return &OIDC{cfg: cfg, key: key[:]}, nil
+}
+
+// Authenticate accepts requests carrying a valid sign-in cookie
+func (o *OIDC) Authenticate(r *http.Request) (User, error) {
+	c, err := r.Cookie(OIDCCookie)
+	if err != nil {
+		return User{}, ErrUnauthenticated
+	}
+	var signIn oidcSignIn
+	if !o.open(c.Value, &signIn) || time.Now().Unix() > signIn.Expires {
+		return User{}, ErrUnauthenticated
+	}
+	return User{Name: signIn.Name, Roles: signIn.Roles}, nil
+}
+
+// Login redirects the browser to the provider, remembering the page it
+// asked for
+func (o *OIDC) Login(w http.ResponseWriter, r *http.Request) {
+	provider, err := o.discover(r.Context())
+	if err != nil {
+		slog.Error("oidc discovery failed", slog.String("error", err.Error()))
+		http.Error(w, "sign-in is unavailable", http.StatusBadGateway)
+		return
+	}
+
+	login := oidcLogin{
+		State:    randomToken(),
+		Nonce:    randomToken(),
+		Verifier: randomToken(),
+		Return:   r.URL.RequestURI(),
+		Expires:  time.Now().Add(oidcLoginTTL).Unix(),
+	}
+	http.SetCookie(w, o.cookie(r, OIDCStateCookie, o.seal(login), oidcLoginTTL))
+
+	challenge := sha256.Sum256([]byte(login.Verifier))
+	query := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {o.cfg.ClientID},
+		"redirect_uri":          {o.cfg.RedirectURL},
+		"scope":                 {strings.Join(append([]string{"openid"}, o.cfg.Scopes...), " ")},
+		"state":                 {login.State},
+		"nonce":                 {login.Nonce},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+		"code_challenge_method": {"S256"},
+	}
+	http.Redirect(w, r, withQuery(provider.AuthorizationEndpoint, query), http.StatusFound)
+}
+
+// Callback completes the login: the code is exchanged for an ID token,
+// which is verified before the operator is signed in and sent back to the
+// page it asked for
+func (o *OIDC) Callback(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	if e := query.Get("error"); e != "" {
+		http.Error(w, "sign-in failed: "+e+" "+query.Get("error_description"), http.StatusUnauthorized)
+		return
+	}
+
+	var login oidcLogin
+	c, err := r.Cookie(OIDCStateCookie)
+	if err != nil || !o.open(c.Value, &login) || time.Now().Unix() > login.Expires {
+		http.Error(w, "sign-in expired, please try again", http.StatusBadRequest)
+		return
+	}
+	if subtle.ConstantTimeCompare([]byte(query.Get("state")), []byte(login.State)) != 1 {
+		http.Error(w, "sign-in state mismatch", http.StatusBadRequest)
+		return
+	}
+	http.SetCookie(w, o.cookie(r, OIDCStateCookie, "", -1))
+
+	user, err := o.exchange(r.Context(), query.Get("code"), login)
+	if err != nil {
+		slog.Error("oidc sign-in failed", slog.String("error", err.Error()))
+		http.Error(w, "sign-in failed", http.StatusUnauthorized)
+		return
+	}
+
+	signIn := oidcSignIn{Name: user.Name, Roles: user.Roles, Expires: time.Now().Add(o.cfg.SessionTTL).Unix()}
+	http.SetCookie(w, o.cookie(r, OIDCCookie, o.seal(signIn), o.cfg.SessionTTL))
+	http.Redirect(w, r, localPath(login.Return), http.StatusFound)
+}
+
+// Logout clears the sign-in and returns the provider's end-session URL,
+// if it has one
+func (o *OIDC) Logout(w http.ResponseWriter, r *http.Request) string {
+	http.SetCookie(w, o.cookie(r, OIDCCookie, "", -1))
+	provider, err := o.discover(r.Context())
+	if err != nil || provider.EndSessionEndpoint == "" {
+		return ""
+	}
+	query := url.Values{"client_id": {o.cfg.ClientID}}
+	if o.cfg.PostLogoutRedirectURL != "" {
+		query.Set("post_logout_redirect_uri", o.cfg.PostLogoutRedirectURL)
+	}
+	return withQuery(provider.EndSessionEndpoint, query)
+}
+
+// exchange redeems the authorization code and verifies the ID token
+func (o *OIDC) exchange(ctx context.Context, code string, login oidcLogin) (User, error) {
+	if code == "" {
+		return User{}, errors.New("missing authorization code")
+	}
+	provider, err := o.discover(ctx)
+	if err != nil {
+		return User{}, err
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {o.cfg.RedirectURL},
+		"client_id":     {o.cfg.ClientID},
+		"code_verifier": {login.Verifier},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, provider.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return User{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if o.cfg.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(o.cfg.ClientID), url.QueryEscape(o.cfg.ClientSecret))
+	}
+
+	var token struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	status, err := o.fetchJSON(req, &token)
+	if err != nil {
+		return User{}, fmt.Errorf("token request failed: %v", err)
+	}
+	if token.Error != "" {
+		return User{}, fmt.Errorf("token request failed: %s %s", token.Error, token.ErrorDescription)
+	}
+	if status != http.StatusOK || token.IDToken == "" {
+		return User{}, fmt.Errorf("token request failed with status %d", status)
+	}
+
+	claims, err := o.verifyIDToken(ctx, token.IDToken, login.Nonce)
+	if err != nil {
+		return User{}, err
+	}
+	return o.userOf(claims)
+}
+
+// verifyIDToken checks the signature, issuer, audience, expiry and nonce
+// of an ID token and returns its claims
+func (o *OIDC) verifyIDToken(ctx context.Context, raw, nonce string) (map[string]any, error) {
+	provider, err := o.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+	header, claims, signed, sig, err := splitJWT(raw)
+	if err != nil {
+		return nil, err
+	}
+	key, err := o.signingKey(ctx, header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	if err := verifySignature(header.Alg, key, signed, sig); err != nil {
+		return nil, fmt.Errorf("id token: %v", err)
+	}
+
+	if iss, _ := claims["iss"].(string); iss != provider.Issuer {
+		return nil, fmt.Errorf("id token: unexpected issuer %q", iss)
+	}
+	if !audienceContains(claims["aud"], o.cfg.ClientID) {
+		return nil, errors.New("id token: not issued for this client")
+	}
+	exp, ok := claims["exp"].(float64)
+	if !ok || time.Now().Add(-oidcClockSkew).After(time.Unix(int64(exp), 0)) {
+		return nil, errors.New("id token: expired")
+	}
+	if n, _ := claims["nonce"].(string); subtle.ConstantTimeCompare([]byte(n), []byte(nonce)) != 1 {
+		return nil, errors.New("id token: nonce mismatch")
+	}
+	return claims, nil
+}
+
+// userOf names the operator and maps its groups to roles
+func (o *OIDC) userOf(claims map[string]any) (User, error) {
+	var name string
+	for _, claim := range []string{o.cfg.UsernameClaim, "preferred_username", "email", "sub"} {
+		if claim == "" {
+			continue
+		}
+		if name, _ = claims[claim].(string); name != "" {
+			break
+		}
+	}
+	if name == "" {
+		return User{}, errors.New("id token names no user")
+	}
+
+	var roles []string
+	for _, group := range claimStrings(lookupClaim(claims, o.cfg.RolesClaim)) {
+		mapped := []string{group}
+		if o.cfg.RoleMap != nil {
+			mapped = o.cfg.RoleMap[group]
+		}
+		for _, role := range mapped {
+			if !slices.Contains(roles, role) {
+				roles = append(roles, role)
+			}
+		}
+	}
+	return User{Name: name, Roles: roles}, nil
+}
+
+// discover fetches the discovery document once; failures are retried on
+// the next call
+func (o *OIDC) discover(ctx context.Context) (*oidcProvider, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.provider != nil {
+		return o.provider, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(o.cfg.Issuer, "/")+"/.well-known/openid-configuration", nil)
+	if err != nil {
+		return nil, err
+	}
+	var provider oidcProvider
+	status, err := o.fetchJSON(req, &provider)
+	if err != nil {
+		return nil, fmt.Errorf("oidc discovery: %v", err)
+	}
+	if status != http.StatusOK {
+		return nil, fmt.Errorf("oidc discovery: status %d", status)
+	}
+	if strings.TrimSuffix(provider.Issuer, "/") != strings.TrimSuffix(o.cfg.Issuer, "/") {
+		return nil, fmt.Errorf("oidc discovery: issuer %q does not match %q", provider.Issuer, o.cfg.Issuer)
+	}
+	if provider.AuthorizationEndpoint == "" || provider.TokenEndpoint == "" || provider.JWKSURI == "" {
+		return nil, errors.New("oidc discovery: incomplete provider metadata")
+	}
+	o.provider = &provider
+	return o.provider, nil
+}
+
+// signingKey returns the key with the given id, refetching the key set
+// when the provider rotated its keys
+func (o *OIDC) signingKey(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if key, ok := o.keys[kid]; ok {
+		return key, nil
+	}
+	if time.Since(o.keysFetched) < jwksRefreshInterval && o.keys != nil {
+		return nil, fmt.Errorf("id token: unknown key %q", kid)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, o.provider.JWKSURI, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := o.cfg.HTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("jwks: %v", err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil || resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("jwks: status %d", resp.StatusCode)
+	}
+	keys, err := parseJWKS(data)
+	if err != nil {
+		return nil, err
+	}
+	o.keys = keys
+	o.keysFetched = time.Now()
+
+	if key, ok := keys[kid]; ok {
+		return key, nil
+	}
+	// tokens may omit the key id when the set holds a single key
+	if kid == "" && len(keys) == 1 {
+		for _, key := range keys {
+			return key, nil
+		}
+	}
+	return nil, fmt.Errorf("id token: unknown key %q", kid)
+}
+
+// fetchJSON sends req and decodes the JSON answer into v, returning the
+// status code
+func (o *OIDC) fetchJSON(req *http.Request, v any) (int, error) {
+	resp, err := o.cfg.HTTPClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(v); err != nil && resp.StatusCode == http.StatusOK {
+		return resp.StatusCode, err
+	}
+	return resp.StatusCode, nil
+}
+
+// seal encodes v as a signed cookie value
+func (o *OIDC) seal(v any) string {
+	payload, _ := json.Marshal(v)
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	return encoded + "." + base64.RawURLEncoding.EncodeToString(o.mac(encoded))
+}
+
+// open checks the signature of a cookie value and decodes it into v
+func (o *OIDC) open(value string, v any) bool {
+	encoded, sig, ok := strings.Cut(value, ".")
+	if !ok {
+		return false
+	}
+	mac, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil || !hmac.Equal(mac, o.mac(encoded)) {
+		return false
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	return err == nil && json.Unmarshal(payload, v) == nil
+}
+
+func (o *OIDC) mac(s string) []byte {
+	h := hmac.New(sha256.New, o.key)
+	h.Write([]byte(s))
+	return h.Sum(nil)
+}
+
+// cookie builds a sign-in cookie; a negative ttl deletes it. SameSite=Lax
+// lets the state cookie come back with the provider's redirect.
+func (o *OIDC) cookie(r *http.Request, name, value string, ttl time.Duration) *http.Cookie {
+	maxAge := int(ttl / time.Second)
+	if ttl < 0 {
+		maxAge = -1
+	}
+	return &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     "/",
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   r.TLS != nil || strings.HasPrefix(o.cfg.RedirectURL, "https://"),
+		SameSite: http.SameSiteLaxMode,
+	}
+}
+
+// randomToken returns 256 random bits, URL-safe
+func randomToken() string {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// withQuery appends query to an endpoint that may already carry one
+func withQuery(endpoint string, query url.Values) string {
+	sep := "?"
+	if strings.Contains(endpoint, "?") {
+		sep = "&"
+	}
+	return endpoint + sep + query.Encode()
+}
+
+// localPath keeps redirects after sign-in on this site
+func localPath(p string) string {
+	if !strings.HasPrefix(p, "/") || strings.HasPrefix(p, "//") || strings.HasPrefix(p, "/\\") {
+		return "/"
+	}
+	return p
+}
+
+// audienceContains reports whether the aud claim, a string or an array,
+// names the client
+func audienceContains(aud any, clientID string) bool {
+	return slices.Contains(claimStrings(aud), clientID)
+}
+
+// lookupClaim follows a dotted path into nested claims
+func lookupClaim(claims map[string]any, path string) any {
+	var v any = claims
+	for _, part := range strings.Split(path, ".") {
+		m, ok := v.(map[string]any)
+		if !ok {
+			return nil
+		}
+		v = m[part]
+	}
+	return v
+}
+
+// claimStrings reads a claim holding a string or an array of strings
+func claimStrings(v any) []string {
+	switch v := v.(type) {
+	case string:
+		return []string{v}
+	case []any:
+		values := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	}
+	return nil
+}
@@ -0,0 +1,283 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeIdP is an in-process stand-in identity provider. It approves every
+// authorization request and issues ID tokens carrying claims.
+type fakeIdP struct {
+	*httptest.Server
+	key    *rsa.PrivateKey
+	claims map[string]any
+
+	mu     sync.Mutex
+	grants map[string]url.Values // authorization requests by code
+}
+
+func newFakeIdP(t *testing.T) *fakeIdP {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	idp := &fakeIdP{key: key, grants: map[string]url.Values{}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 idp.URL,
+			"authorization_endpoint": idp.URL + "/authorize",
+			"token_endpoint":         idp.URL + "/token",
+			"jwks_uri":               idp.URL + "/jwks",
+			"end_session_endpoint":   idp.URL + "/logout",
+		})
+	})
+	mux.HandleFunc("/authorize", func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		code := randomToken()
+		idp.mu.Lock()
+		idp.grants[code] = q
+		idp.mu.Unlock()
+		http.Redirect(w, r, q.Get("redirect_uri")+"&code="+code+"&state="+url.QueryEscape(q.Get("state")), http.StatusFound)
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		idp.mu.Lock()
+		grant, ok := idp.grants[r.Form.Get("code")]
+		delete(idp.grants, r.Form.Get("code"))
+		idp.mu.Unlock()
+
+		verifier := sha256.Sum256([]byte(r.Form.Get("code_verifier")))
+		client, secret, _ := r.BasicAuth()
+		switch {
+		case !ok:
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		case base64.RawURLEncoding.EncodeToString(verifier[:]) != grant.Get("code_challenge"):
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant", "error_description": "PKCE verification failed"})
+			return
+		case client != "weebase" || secret != "s3cret":
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_client"})
+			return
+		}
+		claims := map[string]any{
+			"iss":   idp.URL,
+			"aud":   "weebase",
+			"exp":   time.Now().Add(time.Hour).Unix(),
+			"nonce": grant.Get("nonce"),
+		}
+		for k, v := range idp.claims {
+			claims[k] = v
+		}
+		json.NewEncoder(w).Encode(map[string]string{"id_token": idp.sign(t, "RS256", "k1", claims)})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "k1",
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	idp.Server = httptest.NewServer(mux)
+	t.Cleanup(idp.Close)
+	return idp
+}
+
+// sign issues a compact JWT
+func (idp *fakeIdP) sign(t *testing.T, alg, kid string, claims map[string]any) string {
+	header, _ := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signed))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, idp.key, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatalf("failed to sign token: %v", err)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func newTestOIDC(t *testing.T, idp *fakeIdP) *OIDC {
+	o, err := NewOIDC(OIDCConfig{
+		Issuer:       idp.URL,
+		ClientID:     "weebase",
+		ClientSecret: "s3cret",
+		RedirectURL:  "http://weebase.test/db?action=auth_callback",
+		RoleMap:      map[string][]string{"db-admins": {"dba"}, "support-team": {"support"}},
+		Secret:       "session-secret",
+	})
+	if err != nil {
+		t.Fatalf("NewOIDC: %v", err)
+	}
+	return o
+}
+
+// signIn runs the whole authorization code flow and returns the sign-in
+// cookie and the page the browser is sent back to
+func signIn(t *testing.T, o *OIDC) (*http.Cookie, string) {
+	w := httptest.NewRecorder()
+	o.Login(w, httptest.NewRequest("GET", "/db?action=page_table&table=orders", nil))
+	if w.Code != http.StatusFound {
+		t.Fatalf("expected a redirect to the provider, got %d: %s", w.Code, w.Body.String())
+	}
+	authorize, _ := url.Parse(w.Header().Get("Location"))
+	if q := authorize.Query(); q.Get("code_challenge_method") != "S256" || q.Get("scope") != "openid profile email" {
+		t.Fatalf("unexpected authorization request %s", authorize)
+	}
+	state := w.Result().Cookies()[0]
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err := client.Get(authorize.String())
+	if err != nil {
+		t.Fatalf("authorize: %v", err)
+	}
+	resp.Body.Close()
+
+	r := httptest.NewRequest("GET", resp.Header.Get("Location"), nil)
+	r.AddCookie(state)
+	w = httptest.NewRecorder()
+	o.Callback(w, r)
+	if w.Code != http.StatusFound {
+		t.Fatalf("callback failed with %d: %s", w.Code, w.Body.String())
+	}
+	for _, c := range w.Result().Cookies() {
+		if c.Name == OIDCCookie {
+			return c, w.Header().Get("Location")
+		}
+	}
+	t.Fatal("callback set no sign-in cookie")
+	return nil, ""
+}
+
+func TestOIDC_SignIn(t *testing.T) {
+	idp := newFakeIdP(t)
+	idp.claims = map[string]any{"sub": "u-1", "preferred_username": "alice", "groups": []string{"db-admins", "staff"}}
+	o := newTestOIDC(t, idp)
+
+	cookie, back := signIn(t, o)
+	if back != "/db?action=page_table&table=orders" {
+		t.Errorf("expected to return to the requested page, got %q", back)
+	}
+
+	r := httptest.NewRequest("GET", "/db", nil)
+	r.AddCookie(cookie)
+	user, err := o.Authenticate(r)
+	if err != nil || user.Name != "alice" || len(user.Roles) != 1 || user.Roles[0] != "dba" {
+		t.Fatalf("expected alice with the dba role, got %+v, %v", user, err)
+	}
+
+	// a cookie naming someone else under alice's signature is rejected
+	_, sig, _ := strings.Cut(cookie.Value, ".")
+	forged, _ := json.Marshal(oidcSignIn{Name: "mallory", Roles: []string{"dba"}, Expires: time.Now().Add(time.Hour).Unix()})
+	r = httptest.NewRequest("GET", "/db", nil)
+	r.AddCookie(&http.Cookie{Name: OIDCCookie, Value: base64.RawURLEncoding.EncodeToString(forged) + "." + sig})
+	if _, err := o.Authenticate(r); err != ErrUnauthenticated {
+		t.Errorf("expected ErrUnauthenticated for a tampered cookie, got %v", err)
+	}
+}
+
+func TestOIDC_CallbackRejectsForeignState(t *testing.T) {
+	idp := newFakeIdP(t)
+	o := newTestOIDC(t, idp)
+
+	w := httptest.NewRecorder()
+	o.Login(w, httptest.NewRequest("GET", "/db", nil))
+	r := httptest.NewRequest("GET", "/db?action=auth_callback&code=x&state=forged", nil)
+	r.AddCookie(w.Result().Cookies()[0])
+	w = httptest.NewRecorder()
+	o.Callback(w, r)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for a forged state, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	o.Callback(w, httptest.NewRequest("GET", "/db?action=auth_callback&code=x&state=forged", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 without a login in progress, got %d", w.Code)
+	}
+}
+
+func TestOIDC_VerifyIDToken(t *testing.T) {
+	idp := newFakeIdP(t)
+	o := newTestOIDC(t, idp)
+	valid := func() map[string]any {
+		return map[string]any{"iss": idp.URL, "aud": []string{"other", "weebase"}, "exp": time.Now().Add(time.Hour).Unix(), "nonce": "n1", "sub": "u-1"}
+	}
+
+	if _, err := o.verifyIDToken(t.Context(), idp.sign(t, "RS256", "k1", valid()), "n1"); err != nil {
+		t.Fatalf("expected a valid token, got %v", err)
+	}
+
+	tests := map[string]func() string{
+		"wrong nonce": func() string { return idp.sign(t, "RS256", "k1", valid()) },
+		"wrong audience": func() string {
+			c := valid()
+			c["aud"] = "other"
+			return idp.sign(t, "RS256", "k1", c)
+		},
+		"wrong issuer": func() string {
+			c := valid()
+			c["iss"] = "https://evil.test"
+			return idp.sign(t, "RS256", "k1", c)
+		},
+		"expired": func() string {
+			c := valid()
+			c["exp"] = time.Now().Add(-time.Hour).Unix()
+			return idp.sign(t, "RS256", "k1", c)
+		},
+		"unknown key":   func() string { return idp.sign(t, "RS256", "k2", valid()) },
+		"alg none":      func() string { return idp.sign(t, "none", "k1", valid()) },
+		"bad signature": func() string { return idp.sign(t, "RS256", "k1", valid())[:40] + "x" },
+	}
+	for name, token := range tests {
+		nonce := "n1"
+		if name == "wrong nonce" {
+			nonce = "n2"
+		}
+		if _, err := o.verifyIDToken(t.Context(), token(), nonce); err == nil {
+			t.Errorf("%s: expected the token to be rejected", name)
+		}
+	}
+}
+
+func TestOIDC_Logout(t *testing.T) {
+	idp := newFakeIdP(t)
+	o := newTestOIDC(t, idp)
+
+	w := httptest.NewRecorder()
+	to := o.Logout(w, httptest.NewRequest("GET", "/db?action=page_logout", nil))
+	if !strings.HasPrefix(to, idp.URL+"/logout?client_id=weebase") {
+		t.Errorf("expected the provider's end session endpoint, got %q", to)
+	}
+	if c := w.Result().Cookies(); len(c) != 1 || c[0].Name != OIDCCookie || c[0].MaxAge >= 0 {
+		t.Errorf("expected the sign-in cookie to be cleared, got %+v", c)
+	}
+}
+
+func TestAsInteractive(t *testing.T) {
+	idp := newFakeIdP(t)
+	o := newTestOIDC(t, idp)
+
+	if i, ok := AsInteractive(Chain{NewToken("t", User{Name: "ci"}), o}); !ok || i != o {
+		t.Error("expected the chain's OIDC authenticator")
+	}
+	if _, ok := AsInteractive(NewToken("t", User{Name: "ci"})); ok {
+		t.Error("a token authenticator is not interactive")
+	}
+}
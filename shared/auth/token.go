@@ -0,0 +1,69 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"net/http"
+	"strings"
+)
+
+// TokenHeader carries a static API token for clients that can't set
+// an Authorization header
+const TokenHeader = "X-Weebase-Token"
+
+// Requests authenticated with a token carry no session cookie, so they
+// name their connection in these headers: a server-side connection
+// profile, or a driver and DSN where ad-hoc connections are allowed
+const (
+	ProfileHeader = "X-Weebase-Profile"
+	DriverHeader  = "X-Weebase-Driver"
+	DSNHeader     = "X-Weebase-DSN"
+)
+
+// Token authenticates requests carrying a static API token, either as
+// "Authorization: Bearer <token>" or in TokenHeader
+type Token struct {
+	sum  [sha256.Size]byte
+	user User
+}
+
+// NewToken accepts token on behalf of user
+func NewToken(token string, user User) *Token {
+	return &Token{sum: sha256.Sum256([]byte(token)), user: user}
+}
+
+// Authenticate compares the token of the request in constant time
+func (t *Token) Authenticate(r *http.Request) (User, error) {
+	token := BearerToken(r)
+	if token == "" {
+		return User{}, ErrUnauthenticated
+	}
+	sum := sha256.Sum256([]byte(token))
+	if subtle.ConstantTimeCompare(sum[:], t.sum[:]) != 1 {
+		return User{}, ErrUnauthenticated
+	}
+	return t.user, nil
+}
+
+// Lookup implements Directory for the token's one user
+func (t *Token) Lookup(_ context.Context, name string) (User, error) {
+	if name != t.user.Name {
+		return User{}, ErrUnknownUser
+	}
+	return t.user, nil
+}
+
+// BearerToken returns the token a request carries as "Authorization:
+// Bearer <token>" or in TokenHeader, "" when it carries none
+func BearerToken(r *http.Request) string {
+	if bearer, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		return strings.TrimSpace(bearer)
+	}
+	return strings.TrimSpace(r.Header.Get(TokenHeader))
+}
+
+// Challenge tells the client a bearer token is expected
+func (t *Token) Challenge(w http.ResponseWriter) {
+	w.Header().Add("WWW-Authenticate", `Bearer realm="`+DefaultRealm+`"`)
+}
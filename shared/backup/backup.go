@@ -0,0 +1,237 @@
+// Package backup takes logical backups of configured profiles with the SQL
+// dump writer, keeps a set number of them on local disk and replays one on
+// request. A Scheduler runs the backups in-process on each profile's cron
+// schedule.
+package backup
+
+import (
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dracory/weebase/shared/driver"
+	"github.com/dracory/weebase/shared/dump"
+	"github.com/dracory/weebase/shared/secrets"
+	"github.com/dracory/weebase/shared/sqlscript"
+	"github.com/dracory/weebase/shared/types"
+)
+
+// fileSuffix ends every backup file; backups are gzipped SQL scripts
+const fileSuffix = ".sql.gz"
+
+// checksumSuffix ends the sidecar holding a backup's SHA-256, in the format
+// of sha256sum so it can be checked from a shell
+const checksumSuffix = ".sha256"
+
+// timeLayout stamps backup file names, sorting in time order
+const timeLayout = "20060102-150405"
+
+// Backup is a backup file of a profile
+type Backup struct {
+	Name     string    `json:"name"`
+	Size     int64     `json:"size"`
+	Checksum string    `json:"checksum"`
+	Created  time.Time `json:"created"`
+}
+
+// Take dumps the structure and data of the profile into a new backup file
+// and then prunes the backups beyond the retention count. Secret references
+// in the profile's DSN are resolved with r.
+func Take(ctx context.Context, r secrets.Resolver, p types.BackupProfile, progress func(table string, rows int64)) (Backup, error) {
+	if err := os.MkdirAll(p.Dir, 0o700); err != nil {
+		return Backup{}, fmt.Errorf("failed to create backup directory: %v", err)
+	}
+
+	db, err := driver.OpenSQLDBWithSecrets(ctx, r, p.Driver, p.DSN)
+	if err != nil {
+		return Backup{}, fmt.Errorf("failed to connect to database: %v", err)
+	}
+	defer db.Close()
+
+	// write under a temporary name so a failed backup never shows up in the list
+	f, err := os.CreateTemp(p.Dir, ".backup-*")
+	if err != nil {
+		return Backup{}, fmt.Errorf("failed to create backup file: %v", err)
+	}
+	defer os.Remove(f.Name())
+
+	hash := sha256.New()
+	counter := &countingWriter{w: io.MultiWriter(f, hash)}
+	gz := gzip.NewWriter(counter)
+	opts := dump.DefaultOptions()
+	opts.Schema = p.Schema
+	opts.Progress = progress
+	_, err = dump.Write(ctx, db, p.Driver, gz, opts)
+	if closeErr := gz.Close(); err == nil {
+		err = closeErr
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return Backup{}, fmt.Errorf("backup failed: %v", err)
+	}
+
+	created := time.Now().UTC()
+	b := Backup{
+		Name:     p.Name + "-" + created.Format(timeLayout) + fileSuffix,
+		Size:     counter.n,
+		Checksum: hex.EncodeToString(hash.Sum(nil)),
+		Created:  created,
+	}
+	path := filepath.Join(p.Dir, b.Name)
+	if _, err := os.Stat(path); err == nil {
+		return Backup{}, errors.New("a backup of this profile was taken less than a second ago")
+	}
+	if err := os.Rename(f.Name(), path); err != nil {
+		return Backup{}, fmt.Errorf("failed to store backup: %v", err)
+	}
+	if err := os.WriteFile(path+checksumSuffix, []byte(b.Checksum+"  "+b.Name+"\n"), 0o600); err != nil {
+		return Backup{}, fmt.Errorf("failed to store backup checksum: %v", err)
+	}
+	return b, Prune(p)
+}
+
+// List returns the backups of a profile, newest first
+func List(p types.BackupProfile) ([]Backup, error) {
+	entries, err := os.ReadDir(p.Dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return []Backup{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read backup directory: %v", err)
+	}
+
+	out := []Backup{}
+	for _, e := range entries {
+		created, ok := parseName(p, e.Name())
+		if !ok || e.IsDir() {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		out = append(out, Backup{
+			Name:     e.Name(),
+			Size:     info.Size(),
+			Checksum: readChecksum(filepath.Join(p.Dir, e.Name())),
+			Created:  created,
+		})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Created.After(out[j].Created) })
+	return out, nil
+}
+
+// Prune deletes the oldest backups of a profile beyond its retention count
+func Prune(p types.BackupProfile) error {
+	if p.Retain <= 0 {
+		return nil
+	}
+	backups, err := List(p)
+	if err != nil {
+		return err
+	}
+	for _, b := range backups[min(p.Retain, len(backups)):] {
+		path := filepath.Join(p.Dir, b.Name)
+		if err := os.Remove(path); err != nil {
+			return fmt.Errorf("failed to delete old backup: %v", err)
+		}
+		os.Remove(path + checksumSuffix)
+	}
+	return nil
+}
+
+// Restore verifies a backup against its checksum and replays it on the
+// profile's database, stopping at the first failed statement; opts sets
+// the callbacks of the run. Secret references in the profile's DSN are
+// resolved with r.
+func Restore(ctx context.Context, r secrets.Resolver, p types.BackupProfile, name string, opts sqlscript.Options) (sqlscript.Summary, error) {
+	if _, ok := parseName(p, name); !ok {
+		return sqlscript.Summary{}, errors.New("backup not found")
+	}
+	path := filepath.Join(p.Dir, name)
+	if err := verify(path); err != nil {
+		return sqlscript.Summary{}, err
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return sqlscript.Summary{}, fmt.Errorf("failed to open backup: %v", err)
+	}
+	defer f.Close()
+
+	db, err := driver.OpenSQLDBWithSecrets(ctx, r, p.Driver, p.DSN)
+	if err != nil {
+		return sqlscript.Summary{}, fmt.Errorf("failed to connect to database: %v", err)
+	}
+	defer db.Close()
+
+	return sqlscript.Run(ctx, db, f, sqlscript.Options{Driver: p.Driver, Progress: opts.Progress, Executing: opts.Executing})
+}
+
+// verify compares a backup file with its recorded checksum
+func verify(path string) error {
+	want := readChecksum(path)
+	if want == "" {
+		return errors.New("backup has no checksum to verify")
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open backup: %v", err)
+	}
+	defer f.Close()
+	hash := sha256.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return fmt.Errorf("failed to read backup: %v", err)
+	}
+	if hex.EncodeToString(hash.Sum(nil)) != want {
+		return errors.New("backup checksum mismatch: the file is damaged")
+	}
+	return nil
+}
+
+// readChecksum returns the recorded checksum of a backup, or "" when missing
+func readChecksum(path string) string {
+	data, err := os.ReadFile(path + checksumSuffix)
+	if err != nil {
+		return ""
+	}
+	sum, _, _ := strings.Cut(string(data), " ")
+	return strings.TrimSpace(sum)
+}
+
+// parseName checks that name is a backup file of the profile, which also
+// keeps restore requests from reaching outside the backup directory
+func parseName(p types.BackupProfile, name string) (time.Time, bool) {
+	stamp, ok := strings.CutPrefix(name, p.Name+"-")
+	if !ok {
+		return time.Time{}, false
+	}
+	stamp, ok = strings.CutSuffix(stamp, fileSuffix)
+	if !ok {
+		return time.Time{}, false
+	}
+	created, err := time.ParseInLocation(timeLayout, stamp, time.UTC)
+	return created, err == nil
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,229 @@
+package backup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/dracory/weebase/shared/cron"
+	"github.com/dracory/weebase/shared/secrets"
+	"github.com/dracory/weebase/shared/sqlscript"
+	"github.com/dracory/weebase/shared/types"
+)
+
+// ErrBusy is returned when a backup or restore of the profile is already running
+var ErrBusy = errors.New("a backup or restore of this profile is already running")
+
+// Profile is a backup profile as listed to users, without its DSN
+type Profile struct {
+	Name     string     `json:"name"`
+	Driver   string     `json:"driver"`
+	Schema   string     `json:"schema,omitempty"`
+	Schedule string     `json:"schedule,omitempty"`
+	Dir      string     `json:"dir"`
+	Retain   int        `json:"retain"`
+	NextRun  *time.Time `json:"next_run,omitempty"`
+	LastRun  *time.Time `json:"last_run,omitempty"`
+	LastErr  string     `json:"last_error,omitempty"`
+}
+
+type entry struct {
+	profile  types.BackupProfile
+	schedule *cron.Schedule
+	// busy serialises backups and restores of the profile
+	busy    sync.Mutex
+	mu      sync.Mutex
+	next    time.Time
+	lastRun time.Time
+	lastErr string
+}
+
+// Scheduler backs up profiles on their schedules
+type Scheduler struct {
+	entries  map[string]*entry
+	order    []string
+	resolver secrets.Resolver
+}
+
+// NewScheduler prepares the given profiles. Profiles with a missing name,
+// driver, DSN or directory, a duplicate name or an invalid schedule are left
+// out and reported in the error; the scheduler still runs the others.
+// Secret references in the profiles' DSNs are resolved with resolver, which
+// may be nil when they have none.
+func NewScheduler(profiles []types.BackupProfile, resolver secrets.Resolver) (*Scheduler, error) {
+	s := &Scheduler{entries: map[string]*entry{}, resolver: resolver}
+	var errs []error
+	for _, p := range profiles {
+		switch {
+		case p.Name == "" || p.Driver == "" || p.DSN == "" || p.Dir == "":
+			errs = append(errs, fmt.Errorf("backup profile %q: name, driver, dsn and dir are required", p.Name))
+			continue
+		case s.entries[p.Name] != nil:
+			errs = append(errs, fmt.Errorf("backup profile %q: duplicate name", p.Name))
+			continue
+		}
+		e := &entry{profile: p}
+		if p.Schedule != "" {
+			schedule, err := cron.Parse(p.Schedule)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("backup profile %q: %v", p.Name, err))
+				continue
+			}
+			e.schedule = &schedule
+		}
+		s.entries[p.Name] = e
+		s.order = append(s.order, p.Name)
+	}
+	return s, errors.Join(errs...)
+}
+
+// Start runs the scheduled backups until ctx is cancelled
+func (s *Scheduler) Start(ctx context.Context) {
+	scheduled := false
+	for _, e := range s.entries {
+		scheduled = scheduled || e.schedule != nil
+	}
+	if !scheduled {
+		return
+	}
+	go func() {
+		for {
+			now := time.Now()
+			wake := now.Add(time.Hour)
+			for _, name := range s.order {
+				e := s.entries[name]
+				if e.schedule == nil {
+					continue
+				}
+				e.mu.Lock()
+				if e.next.IsZero() {
+					e.next = e.schedule.Next(now)
+				}
+				next := e.next
+				e.mu.Unlock()
+				if next.IsZero() {
+					continue
+				}
+				if !next.After(now) {
+					s.runScheduled(ctx, e)
+					continue
+				}
+				if next.Before(wake) {
+					wake = next
+				}
+			}
+
+			timer := time.NewTimer(time.Until(wake))
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			case <-timer.C:
+			}
+		}
+	}()
+}
+
+// runScheduled takes a due backup and moves the profile to its next run
+func (s *Scheduler) runScheduled(ctx context.Context, e *entry) {
+	e.mu.Lock()
+	e.next = e.schedule.Next(time.Now())
+	e.mu.Unlock()
+
+	b, err := s.Backup(ctx, e.profile.Name, nil)
+	if err != nil {
+		slog.Error("scheduled backup failed", slog.String("profile", e.profile.Name), slog.String("error", err.Error()))
+		return
+	}
+	slog.Info("scheduled backup taken", slog.String("profile", e.profile.Name), slog.String("file", b.Name), slog.Int64("size", b.Size))
+}
+
+// Profiles lists the profiles in configuration order
+func (s *Scheduler) Profiles() []Profile {
+	out := make([]Profile, 0, len(s.order))
+	for _, name := range s.order {
+		e := s.entries[name]
+		p := Profile{
+			Name:     e.profile.Name,
+			Driver:   e.profile.Driver,
+			Schema:   e.profile.Schema,
+			Schedule: e.profile.Schedule,
+			Dir:      e.profile.Dir,
+			Retain:   e.profile.Retain,
+		}
+		e.mu.Lock()
+		if e.schedule != nil {
+			next := e.next
+			if next.IsZero() {
+				next = e.schedule.Next(time.Now())
+			}
+			if !next.IsZero() {
+				p.NextRun = &next
+			}
+		}
+		if !e.lastRun.IsZero() {
+			last := e.lastRun
+			p.LastRun = &last
+		}
+		p.LastErr = e.lastErr
+		e.mu.Unlock()
+		out = append(out, p)
+	}
+	return out
+}
+
+// Profile returns a configured profile by name
+func (s *Scheduler) Profile(name string) (types.BackupProfile, bool) {
+	e, ok := s.entries[name]
+	if !ok {
+		return types.BackupProfile{}, false
+	}
+	return e.profile, true
+}
+
+// Backup takes a backup of the named profile now
+func (s *Scheduler) Backup(ctx context.Context, name string, progress func(table string, rows int64)) (Backup, error) {
+	e, ok := s.entries[name]
+	if !ok {
+		return Backup{}, errors.New("backup profile not found")
+	}
+	if !e.busy.TryLock() {
+		return Backup{}, ErrBusy
+	}
+	defer e.busy.Unlock()
+
+	b, err := Take(ctx, s.resolver, e.profile, progress)
+	e.mu.Lock()
+	e.lastRun = time.Now()
+	e.lastErr = ""
+	if err != nil {
+		e.lastErr = err.Error()
+	}
+	e.mu.Unlock()
+	return b, err
+}
+
+// Restore replays a backup of the named profile
+func (s *Scheduler) Restore(ctx context.Context, name, backup string, opts sqlscript.Options) (sqlscript.Summary, error) {
+	e, ok := s.entries[name]
+	if !ok {
+		return sqlscript.Summary{}, errors.New("backup profile not found")
+	}
+	if !e.busy.TryLock() {
+		return sqlscript.Summary{}, ErrBusy
+	}
+	defer e.busy.Unlock()
+	return Restore(ctx, s.resolver, e.profile, backup, opts)
+}
+
+// List returns the backups of the named profile, newest first
+func (s *Scheduler) List(name string) ([]Backup, error) {
+	e, ok := s.entries[name]
+	if !ok {
+		return nil, errors.New("backup profile not found")
+	}
+	return List(e.profile)
+}
@@ -0,0 +1,153 @@
+// Package connection resolves database connections other than the
+// session's active one, e.g. the target side of a diff or copy.
+package connection
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/dracory/weebase/shared/connguard"
+	"github.com/dracory/weebase/shared/constants"
+	"github.com/dracory/weebase/shared/dialect"
+	"github.com/dracory/weebase/shared/driver"
+	"github.com/dracory/weebase/shared/ratelimit"
+	"github.com/dracory/weebase/shared/secrets"
+	"github.com/dracory/weebase/shared/session"
+	"github.com/dracory/weebase/shared/types"
+)
+
+// Target is a driver/DSN pair to open
+type Target struct {
+	Driver string
+	DSN    string
+	// adHoc is set for a DSN the request supplied itself
+	adHoc bool
+}
+
+// Open opens the target as a *sql.DB; the caller must close it. An ad-hoc
+// target is limited like the connect action: it takes a connect attempt
+// of the request's client and reports whether the server turned it away.
+func (t Target) Open(ctx context.Context) (*sql.DB, error) {
+	if !t.adHoc {
+		return driver.OpenSQLDB(t.Driver, t.DSN)
+	}
+	if err := ratelimit.Connect(ctx); err != nil {
+		return nil, err
+	}
+	db, err := driver.OpenSQLDB(t.Driver, t.DSN)
+	ratelimit.Report(ctx, connguard.Server(t.Driver, t.DSN), err != nil)
+	return db, err
+}
+
+// AdHoc reports whether the request supplied the target's DSN itself
+func (t Target) AdHoc() bool {
+	return t.adHoc
+}
+
+// ErrUnknownProfile is returned for a connection profile ID that isn't
+// configured
+var ErrUnknownProfile = errors.New("unknown connection profile")
+
+// Profile returns the server-side connection profile with the given ID
+func Profile(cfg types.Config, id string) (types.ConnectionProfile, bool) {
+	for _, p := range cfg.ConnectionProfiles {
+		if p.ID == id {
+			return p, true
+		}
+	}
+	return types.ConnectionProfile{}, false
+}
+
+// ResolveProfile returns the driver and DSN of a server-side connection
+// profile with its secret references resolved. The DSN must not be stored
+// or sent anywhere; errors name references, never values.
+func ResolveProfile(ctx context.Context, cfg types.Config, id string) (string, string, error) {
+	p, ok := Profile(cfg, id)
+	if !ok {
+		return "", "", ErrUnknownProfile
+	}
+	dsn, err := secrets.Expand(ctx, cfg.SecretResolver, p.Driver, p.DSN)
+	if err != nil {
+		return "", "", err
+	}
+	return dialect.Normalize(p.Driver), dsn, nil
+}
+
+// FromForm reads "<prefix>profile_id", or "<prefix>driver" and
+// "<prefix>dsn", from the form. When all are empty the session's active
+// connection is returned. A profile is resolved on the server; explicit
+// connections require AllowAdHocConnections, an enabled driver and a DSN
+// the ConnectPolicy allows.
+func FromForm(ctx context.Context, cfg types.Config, sess *session.Session, form url.Values, prefix string) (Target, error) {
+	if id := strings.TrimSpace(form.Get(prefix + "profile_id")); id != "" {
+		drv, dsn, err := ResolveProfile(ctx, cfg, id)
+		if err != nil {
+			return Target{}, err
+		}
+		return Target{Driver: drv, DSN: dsn}, nil
+	}
+
+	drv := strings.TrimSpace(form.Get(prefix + "driver"))
+	dsn := strings.TrimSpace(form.Get(prefix + "dsn"))
+
+	if drv == "" && dsn == "" {
+		if sess == nil || sess.Conn == nil {
+			return Target{}, errors.New("not connected to database")
+		}
+		return Target{Driver: dialect.Normalize(sess.Conn.Driver), DSN: sess.Conn.DSN}, nil
+	}
+
+	if !cfg.AllowAdHocConnections {
+		return Target{}, errors.New("ad-hoc connections are disabled")
+	}
+	if !slices.Contains(cfg.EnabledDrivers, drv) {
+		return Target{}, errors.New("unsupported driver")
+	}
+	if dsn == "" {
+		return Target{}, errors.New(prefix + "dsn is required")
+	}
+	if err := cfg.ConnectPolicy.Check(ctx, drv, dsn); err != nil {
+		return Target{}, err
+	}
+
+	return Target{Driver: dialect.Normalize(drv), DSN: dsn, adHoc: true}, nil
+}
+
+// DatabaseName reads the database a DSN connects to, "" when it names none
+func DatabaseName(drv, dsn string) string {
+	switch dialect.Normalize(drv) {
+	case constants.DriverSQLite:
+		name, _, _ := strings.Cut(strings.TrimPrefix(dsn, "file:"), "?")
+		return name
+	case constants.DriverMySQL:
+		// user:pass@tcp(host)/name?params
+		i := strings.LastIndex(dsn, "/")
+		if i < 0 {
+			return ""
+		}
+		name, _, _ := strings.Cut(dsn[i+1:], "?")
+		return name
+	}
+
+	if u, err := url.Parse(dsn); err == nil && u.Scheme != "" && u.Host != "" {
+		if name := u.Query().Get("database"); name != "" {
+			return name
+		}
+		if name := u.Query().Get("dbname"); name != "" {
+			return name
+		}
+		return strings.TrimPrefix(u.Path, "/")
+	}
+	// key=value DSNs, space separated for PostgreSQL and ; for SQL Server
+	for _, field := range strings.FieldsFunc(dsn, func(r rune) bool { return r == ' ' || r == ';' }) {
+		key, value, ok := strings.Cut(field, "=")
+		if key = strings.ToLower(strings.TrimSpace(key)); ok && (key == "dbname" || key == "database") {
+			return strings.Trim(strings.TrimSpace(value), `'"`)
+		}
+	}
+	return ""
+}
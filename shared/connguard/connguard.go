@@ -0,0 +1,276 @@
+// Package connguard decides which ad-hoc connections may be opened, so
+// operators can't use weebase to reach hosts, ports or files it wasn't
+// meant to: hosts and ports are checked against allow and deny lists, host
+// names are resolved and their addresses checked against private ranges,
+// SQLite files are confined to root directories, and DSN parameters that
+// read local files or weaken authentication and secret references are
+// refused.
+//
+// Names are resolved when the connection is checked, not when the driver
+// dials, so a name whose addresses change in between isn't caught.
+package connguard
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/dracory/weebase/shared/glob"
+	"github.com/dracory/weebase/shared/secrets"
+)
+
+// ErrNotAllowed is returned, wrapped, for connections the policy refuses
+var ErrNotAllowed = errors.New("connection not allowed")
+
+// dangerousParams are DSN parameters that read local files or weaken
+// authentication, refused whatever the policy
+var dangerousParams = []string{
+	// PostgreSQL
+	"sslkey", "sslcert", "sslrootcert", "sslcrl", "sslcrldir", "passfile", "service", "servicefile",
+	// MySQL
+	"allowallfiles", "allowcleartextpasswords", "allowfallbacktoplaintext", "allowoldpasswords",
+	// SQL Server
+	"certificate", "krb5-configfile", "krb5-keytabfile", "krb5-credcachefile", "krb5conffile", "keytabfile", "krbcache",
+}
+
+// Resolver looks up the addresses of a host name
+type Resolver interface {
+	LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error)
+}
+
+// Policy restricts ad-hoc connections. Host entries are host name patterns
+// (case-insensitive, * and ?) or CIDR ranges; port entries are ports or
+// ranges such as 5432-5439. A nil Policy applies the checks that need no
+// configuration: dangerous parameters and link-local addresses, cloud
+// metadata endpoints among them, are always refused.
+type Policy struct {
+	// AllowHosts, when not empty, lists the only hosts that may be reached
+	AllowHosts []string
+	// DenyHosts lists hosts that may not be reached, even when allowed
+	DenyHosts []string
+	// AllowPorts, when not empty, lists the only ports that may be reached
+	AllowPorts []string
+	// DenyPorts lists ports that may not be reached
+	DenyPorts []string
+	// DenyPrivate refuses hosts resolving to loopback or private addresses,
+	// and Unix sockets, unless an AllowHosts CIDR range covers them
+	DenyPrivate bool
+	// SQLiteRoots, when not empty, are the directories SQLite files must
+	// be in
+	SQLiteRoots []string
+	// Resolver looks up host names; nil uses net.DefaultResolver
+	Resolver Resolver
+}
+
+// Validate checks the CIDR ranges and ports of the policy
+func (p *Policy) Validate() error {
+	for _, entry := range append(append([]string{}, p.AllowHosts...), p.DenyHosts...) {
+		if strings.Contains(entry, "/") {
+			if _, _, err := net.ParseCIDR(entry); err != nil {
+				return fmt.Errorf("invalid host range %q", entry)
+			}
+		}
+	}
+	for _, entry := range append(append([]string{}, p.AllowPorts...), p.DenyPorts...) {
+		if _, _, err := portRange(entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Check reports whether the DSN of driver may be opened, with an error
+// wrapping ErrNotAllowed when it may not
+func (p *Policy) Check(ctx context.Context, driver, dsn string) error {
+	if p == nil {
+		p = &Policy{}
+	}
+	// secrets are only resolved for server-configured profiles; resolved
+	// here they could be sent to a host of the operator's choosing
+	if secrets.HasReference(dsn) {
+		return fmt.Errorf("%w: secret references are only resolved in server-configured profiles", ErrNotAllowed)
+	}
+	t, err := Parse(driver, dsn)
+	if err != nil {
+		return err
+	}
+	for _, name := range dangerousParams {
+		if _, ok := t.Params[name]; ok {
+			return fmt.Errorf("%w: the %s parameter is not allowed", ErrNotAllowed, name)
+		}
+	}
+	if t.File != "" {
+		return p.checkFile(t.File)
+	}
+	for _, addr := range t.Addresses {
+		if err := p.checkAddress(ctx, addr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkFile confines a SQLite file to the roots. Symbolic links are
+// followed as far as the path exists, so a link can't lead out of a root.
+func (p *Policy) checkFile(file string) error {
+	if len(p.SQLiteRoots) == 0 {
+		return nil
+	}
+	path, err := resolvePath(file)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrNotAllowed, err)
+	}
+	for _, root := range p.SQLiteRoots {
+		root, err := resolvePath(root)
+		if err != nil {
+			continue
+		}
+		if rel, err := filepath.Rel(root, path); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: SQLite files must be in %s", ErrNotAllowed, strings.Join(p.SQLiteRoots, ", "))
+}
+
+// resolvePath makes path absolute and resolves the symbolic links of the
+// longest part of it that exists
+func resolvePath(path string) (string, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	rest := ""
+	for dir := path; ; dir = filepath.Dir(dir) {
+		if _, err := os.Lstat(dir); err == nil {
+			resolved, err := filepath.EvalSymlinks(dir)
+			if err != nil {
+				return "", err
+			}
+			return filepath.Join(resolved, rest), nil
+		}
+		if filepath.Dir(dir) == dir {
+			return path, nil
+		}
+		rest = filepath.Join(filepath.Base(dir), rest)
+	}
+}
+
+// checkAddress checks the port and host of one address, and every address
+// the host resolves to
+func (p *Policy) checkAddress(ctx context.Context, addr Address) error {
+	if len(p.AllowPorts) > 0 && !inPorts(p.AllowPorts, addr.Port) {
+		return fmt.Errorf("%w: port %d is not allowed", ErrNotAllowed, addr.Port)
+	}
+	if inPorts(p.DenyPorts, addr.Port) {
+		return fmt.Errorf("%w: port %d is denied", ErrNotAllowed, addr.Port)
+	}
+	if addr.Socket != "" {
+		if p.DenyPrivate || len(p.AllowHosts) > 0 {
+			return fmt.Errorf("%w: Unix sockets are not allowed", ErrNotAllowed)
+		}
+		return nil
+	}
+
+	host := strings.ToLower(strings.Trim(addr.Host, "[]"))
+	if nameIn(p.DenyHosts, host) {
+		return fmt.Errorf("%w: host %s is denied", ErrNotAllowed, host)
+	}
+	named := nameIn(p.AllowHosts, host)
+
+	ips, err := p.lookup(ctx, host)
+	if err != nil {
+		return fmt.Errorf("%w: cannot resolve host %s", ErrNotAllowed, host)
+	}
+	for _, ip := range ips {
+		ranged := ipIn(p.AllowHosts, ip)
+		switch {
+		case ipIn(p.DenyHosts, ip):
+			return fmt.Errorf("%w: host %s resolves to denied address %s", ErrNotAllowed, host, ip)
+		case len(p.AllowHosts) > 0 && !named && !ranged:
+			return fmt.Errorf("%w: host %s is not allowed", ErrNotAllowed, host)
+		case ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsUnspecified() || ip.IsMulticast():
+			return fmt.Errorf("%w: host %s resolves to link-local or special address %s", ErrNotAllowed, host, ip)
+		case p.DenyPrivate && !ranged && isPrivate(ip):
+			return fmt.Errorf("%w: host %s resolves to private address %s", ErrNotAllowed, host, ip)
+		}
+	}
+	return nil
+}
+
+// lookup returns the addresses of a host
+func (p *Policy) lookup(ctx context.Context, host string) ([]net.IP, error) {
+	if ip := net.ParseIP(host); ip != nil {
+		return []net.IP{ip}, nil
+	}
+	resolver := p.Resolver
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+	addrs, err := resolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	if len(addrs) == 0 {
+		return nil, errors.New("no addresses")
+	}
+	ips := make([]net.IP, len(addrs))
+	for i, a := range addrs {
+		ips[i] = a.IP
+	}
+	return ips, nil
+}
+
+// sharedRange is the carrier-grade NAT range, private in practice
+var _, sharedRange, _ = net.ParseCIDR("100.64.0.0/10")
+
+func isPrivate(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsPrivate() || sharedRange.Contains(ip)
+}
+
+// nameIn reports whether host matches a name pattern of entries
+func nameIn(entries []string, host string) bool {
+	for _, entry := range entries {
+		if !strings.Contains(entry, "/") && glob.Match(entry, host) {
+			return true
+		}
+	}
+	return false
+}
+
+// ipIn reports whether ip is in a CIDR range of entries
+func ipIn(entries []string, ip net.IP) bool {
+	for _, entry := range entries {
+		if _, ipnet, err := net.ParseCIDR(entry); err == nil && ipnet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func inPorts(entries []string, port int) bool {
+	for _, entry := range entries {
+		if lo, hi, err := portRange(entry); err == nil && port >= lo && port <= hi {
+			return true
+		}
+	}
+	return false
+}
+
+// portRange reads a port or a lo-hi range
+func portRange(entry string) (int, int, error) {
+	from, to, isRange := strings.Cut(strings.TrimSpace(entry), "-")
+	lo, err := strconv.Atoi(strings.TrimSpace(from))
+	hi := lo
+	if err == nil && isRange {
+		hi, err = strconv.Atoi(strings.TrimSpace(to))
+	}
+	if err != nil || lo < 1 || hi > 65535 || lo > hi {
+		return 0, 0, fmt.Errorf("invalid port %q", entry)
+	}
+	return lo, hi, nil
+}
@@ -0,0 +1,310 @@
+package connguard
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/dracory/weebase/shared/constants"
+	"github.com/dracory/weebase/shared/dialect"
+	"github.com/go-sql-driver/mysql"
+)
+
+// Address is a host and port a DSN connects to. Socket is set instead of
+// Host for Unix sockets.
+type Address struct {
+	Host   string
+	Port   int
+	Socket string
+}
+
+// Target is what a DSN reaches: the addresses of a server, or the file of
+// a SQLite database ("" for an in-memory one), and its parameters with
+// lower-case names
+type Target struct {
+	Addresses []Address
+	File      string
+	Params    map[string]string
+}
+
+// default ports of the server dialects
+var defaultPorts = map[string]int{
+	constants.DriverPostgres:  5432,
+	constants.DriverMySQL:     3306,
+	constants.DriverSQLServer: 1433,
+}
+
+// Parse reads what the DSN of driver reaches
+func Parse(driver, dsn string) (Target, error) {
+	switch drv := dialect.Normalize(driver); drv {
+	case constants.DriverSQLite:
+		return parseSQLite(dsn), nil
+	case constants.DriverPostgres:
+		return parsePostgres(dsn)
+	case constants.DriverMySQL:
+		return parseMySQL(dsn)
+	case constants.DriverSQLServer:
+		return parseSQLServer(dsn)
+	}
+	return Target{}, fmt.Errorf("unsupported driver: %s", driver)
+}
+
+// Server identifies what a DSN reaches without its credentials, so that
+// failed connects can be counted by server. A DSN that can't be parsed is
+// identified by its digest.
+func Server(driver, dsn string) string {
+	drv := dialect.Normalize(driver)
+	t, err := Parse(drv, dsn)
+	if err != nil {
+		sum := sha256.Sum256([]byte(dsn))
+		return drv + ":" + hex.EncodeToString(sum[:8])
+	}
+	if drv == constants.DriverSQLite {
+		return drv + ":" + t.File
+	}
+	addrs := make([]string, len(t.Addresses))
+	for i, a := range t.Addresses {
+		if a.Socket != "" {
+			addrs[i] = a.Socket
+		} else {
+			addrs[i] = net.JoinHostPort(a.Host, strconv.Itoa(a.Port))
+		}
+	}
+	return drv + ":" + strings.Join(addrs, ",")
+}
+
+// SQLiteFile returns the file a SQLite DSN opens, "" for an in-memory
+// database
+func SQLiteFile(dsn string) string {
+	return parseSQLite(dsn).File
+}
+
+// parseSQLite reads a file path or a file: URI
+func parseSQLite(dsn string) Target {
+	t := Target{Params: map[string]string{}}
+	path, query, _ := strings.Cut(dsn, "?")
+	if values, err := url.ParseQuery(query); err == nil {
+		for k := range values {
+			t.Params[strings.ToLower(k)] = values.Get(k)
+		}
+	}
+	if strings.HasPrefix(path, "file:") {
+		path = strings.TrimPrefix(path, "file:")
+		// file://host/path names a local file when host is empty or localhost
+		if rest, ok := strings.CutPrefix(path, "//"); ok {
+			if i := strings.Index(rest, "/"); i >= 0 {
+				path = rest[i:]
+			}
+		}
+		if p, err := url.PathUnescape(path); err == nil {
+			path = p
+		}
+	}
+	if path == ":memory:" || path == "" || t.Params["mode"] == "memory" {
+		path = ""
+	}
+	t.File = path
+	return t
+}
+
+// parsePostgres reads a postgres:// URL or a key=value DSN. host and port
+// may list several servers, tried in turn.
+func parsePostgres(dsn string) (Target, error) {
+	params := map[string]string{}
+	if strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://") {
+		u, err := url.Parse(dsn)
+		if err != nil {
+			return Target{}, fmt.Errorf("invalid DSN: %v", err)
+		}
+		var hosts, ports []string
+		for _, hp := range strings.Split(u.Host, ",") {
+			host, port := hp, ""
+			if h, p, err := net.SplitHostPort(hp); err == nil {
+				host, port = h, p
+			}
+			hosts, ports = append(hosts, host), append(ports, port)
+		}
+		params["host"], params["port"] = strings.Join(hosts, ","), strings.Join(ports, ",")
+		for k, v := range u.Query() {
+			params[strings.ToLower(k)] = v[0]
+		}
+	} else {
+		fields, err := keyValues(dsn)
+		if err != nil {
+			return Target{}, err
+		}
+		for k, v := range fields {
+			params[k] = v
+		}
+	}
+
+	hosts := strings.Split(params["host"], ",")
+	if addr := params["hostaddr"]; addr != "" {
+		hosts = strings.Split(addr, ",")
+	}
+	ports := strings.Split(params["port"], ",")
+	t := Target{Params: params}
+	for i, host := range hosts {
+		port := ports[0]
+		if i < len(ports) {
+			port = ports[i]
+		}
+		n, err := portNumber(port, defaultPorts[constants.DriverPostgres])
+		if err != nil {
+			return Target{}, err
+		}
+		switch {
+		case strings.HasPrefix(host, "/"):
+			t.Addresses = append(t.Addresses, Address{Socket: host, Port: n})
+		case host == "":
+			// libpq's default is the local socket
+			t.Addresses = append(t.Addresses, Address{Host: "localhost", Port: n})
+		default:
+			t.Addresses = append(t.Addresses, Address{Host: host, Port: n})
+		}
+	}
+	return t, nil
+}
+
+// keyValues reads a libpq key=value string, where values may be single
+// quoted with backslash escapes
+func keyValues(s string) (map[string]string, error) {
+	out := map[string]string{}
+	for s = strings.TrimSpace(s); s != ""; s = strings.TrimSpace(s) {
+		eq := strings.Index(s, "=")
+		if eq < 0 {
+			return nil, fmt.Errorf("invalid DSN: missing = after %q", s)
+		}
+		key := strings.ToLower(strings.TrimSpace(s[:eq]))
+		s = strings.TrimLeft(s[eq+1:], " ")
+		var value strings.Builder
+		if strings.HasPrefix(s, "'") {
+			i := 1
+			for ; i < len(s) && s[i] != '\''; i++ {
+				if s[i] == '\\' && i+1 < len(s) {
+					i++
+				}
+				value.WriteByte(s[i])
+			}
+			if i >= len(s) {
+				return nil, fmt.Errorf("invalid DSN: unterminated quoted value of %s", key)
+			}
+			s = s[i+1:]
+		} else {
+			end := strings.IndexAny(s, " \t\n")
+			if end < 0 {
+				end = len(s)
+			}
+			value.WriteString(s[:end])
+			s = s[end:]
+		}
+		out[key] = value.String()
+	}
+	return out, nil
+}
+
+// parseMySQL reads a DSN the way the MySQL driver does
+func parseMySQL(dsn string) (Target, error) {
+	cfg, err := mysql.ParseDSN(dsn)
+	if err != nil {
+		return Target{}, err
+	}
+	t := Target{Params: map[string]string{}}
+	for k, v := range cfg.Params {
+		t.Params[strings.ToLower(k)] = v
+	}
+	// the driver reads these into its config rather than Params
+	for name, on := range map[string]bool{
+		"allowallfiles":            cfg.AllowAllFiles,
+		"allowcleartextpasswords":  cfg.AllowCleartextPasswords,
+		"allowfallbacktoplaintext": cfg.AllowFallbackToPlaintext,
+		"allowoldpasswords":        cfg.AllowOldPasswords,
+	} {
+		if on {
+			t.Params[name] = "true"
+		}
+	}
+
+	switch cfg.Net {
+	case "unix":
+		t.Addresses = []Address{{Socket: cfg.Addr}}
+	case "tcp", "tcp6":
+		host, port, err := net.SplitHostPort(cfg.Addr)
+		if err != nil {
+			return Target{}, fmt.Errorf("invalid DSN address %q", cfg.Addr)
+		}
+		n, err := portNumber(port, defaultPorts[constants.DriverMySQL])
+		if err != nil {
+			return Target{}, err
+		}
+		t.Addresses = []Address{{Host: host, Port: n}}
+	default:
+		return Target{}, fmt.Errorf("unsupported network %q", cfg.Net)
+	}
+	return t, nil
+}
+
+// parseSQLServer reads a sqlserver:// URL or an ADO style
+// "server=host,port;user id=..." string
+func parseSQLServer(dsn string) (Target, error) {
+	params := map[string]string{}
+	var server, port string
+	if strings.HasPrefix(dsn, "sqlserver://") {
+		u, err := url.Parse(dsn)
+		if err != nil {
+			return Target{}, fmt.Errorf("invalid DSN: %v", err)
+		}
+		server, port = u.Hostname(), u.Port()
+		for k, v := range u.Query() {
+			params[strings.ToLower(k)] = v[0]
+		}
+	} else {
+		for _, field := range strings.Split(strings.TrimPrefix(dsn, "odbc:"), ";") {
+			key, value, ok := strings.Cut(field, "=")
+			if !ok {
+				continue
+			}
+			params[strings.ToLower(strings.TrimSpace(key))] = strings.Trim(strings.TrimSpace(value), "{}")
+		}
+		for _, key := range []string{"server", "data source", "address", "addr", "network address"} {
+			if v := params[key]; v != "" {
+				server = v
+				break
+			}
+		}
+		// server=host\instance,port
+		if host, p, ok := strings.Cut(server, ","); ok {
+			server, port = host, p
+		}
+		server, _, _ = strings.Cut(server, `\`)
+	}
+	if p := params["port"]; p != "" {
+		port = p
+	}
+	n, err := portNumber(port, defaultPorts[constants.DriverSQLServer])
+	if err != nil {
+		return Target{}, err
+	}
+	switch server {
+	case "", ".", "(local)":
+		server = "localhost"
+	}
+	return Target{Addresses: []Address{{Host: server, Port: n}}, Params: params}, nil
+}
+
+// portNumber reads a port, def when empty
+func portNumber(s string, def int) (int, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 1 || n > 65535 {
+		return 0, fmt.Errorf("invalid port %q", s)
+	}
+	return n, nil
+}
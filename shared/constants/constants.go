@@ -8,6 +8,15 @@ const (
 	DriverSQLServer = "sqlserver"
 )
 
+// Database object kinds reported by table listings
+const (
+	ObjectKindTable            = "table"
+	ObjectKindView             = "view"
+	ObjectKindMaterializedView = "materialized_view"
+	ObjectKindForeignTable     = "foreign_table"
+	ObjectKindSystem           = "system"
+)
+
 // Cookie names
 const (
 	CookieProfiles = "weebase_profiles"
@@ -28,6 +37,8 @@ const (
 	ActionApiInsertRow  = "api_insert_row"
 	ActionApiUpdateRow  = "api_update_row"
 	ActionApiDeleteRow  = "api_delete_row"
+	ActionApiRowChanges = "api_row_changes"
+	ActionApiRowUndo    = "api_row_undo"
 
 	// Profile management
 	ActionApiProfilesList = "api_profiles_list"
@@ -38,6 +49,61 @@ const (
 
 	// Table operations
 	ActionApiTablesList = "api_tables_list"
+	ActionApiTableInfo  = "api_table_info"
+
+	// View operations
+	ActionApiViewDefinition = "api_view_definition"
+	ActionApiViewCreate     = "api_view_create"
+	ActionApiViewDrop       = "api_view_drop"
+	ActionApiViewRefresh    = "api_view_refresh"
+
+	// Routine operations
+	ActionApiRoutinesList   = "api_routines_list"
+	ActionApiRoutineExecute = "api_routine_execute"
+
+	// PostgreSQL sequences and user-defined types
+	ActionApiSequencesList   = "api_sequences_list"
+	ActionApiSequenceSetval  = "api_sequence_setval"
+	ActionApiSequenceRestart = "api_sequence_restart"
+	ActionApiTypesList       = "api_types_list"
+	ActionApiEnumAddValue    = "api_enum_add_value"
+
+	// Schema and data comparison
+	ActionApiSchemaDiff = "api_schema_diff"
+	ActionApiDataDiff   = "api_data_diff"
+
+	// Migration files
+	ActionApiMigrationGenerate = "api_migration_generate"
+
+	// Data export
+	ActionApiExport = "api_export"
+	ActionApiDump   = "api_dump"
+
+	// Data import
+	ActionApiImport        = "api_import"
+	ActionApiImportPreview = "api_import_preview"
+	ActionApiSQLImport     = "api_sql_import"
+
+	// Data copy between connections
+	ActionApiTableCopy = "api_table_copy"
+
+	// Background jobs
+	ActionApiJobsList    = "api_jobs_list"
+	ActionApiJobStatus   = "api_job_status"
+	ActionApiJobDownload = "api_job_download"
+
+	// Scheduled backups
+	ActionApiBackupsList   = "api_backups_list"
+	ActionApiBackupCreate  = "api_backup_create"
+	ActionApiBackupRestore = "api_backup_restore"
+
+	// Audit log
+	ActionApiAuditSearch = "api_audit_search"
+
+	// Personal API tokens
+	ActionApiTokensList  = "api_tokens_list"
+	ActionApiTokenCreate = "api_token_create"
+	ActionApiTokenRevoke = "api_token_revoke"
 
 	// SQL operations
 	ActionApiSQLExecute = "api_sql_execute"
@@ -50,17 +116,26 @@ const (
 
 // Page actions
 const (
+	// Authentication
+	ActionAuthCallback = "auth_callback"
+
 	// Assets
 	ActionAssetCSS = "asset_css"
 	ActionAssetJS  = "asset_js"
 
 	// Pages
 	ActionPageHome        = "page_home"
+	ActionPageAudit       = "page_audit"
+	ActionPageChanges     = "page_changes"
+	ActionPageTokens      = "page_tokens"
 	ActionPageExport      = "page_export"
 	ActionPageImport      = "page_import"
+	ActionPageCopy        = "page_copy"
+	ActionPageBackups     = "page_backups"
 	ActionPageLogin       = "page_login"
 	ActionPageLogout      = "page_logout"
 	ActionPageProfiles    = "page_profiles"
+	ActionPageRoutines    = "page_routines"
 	ActionPageSQLExecute  = "page_sql_execute"
 	ActionPageServer      = "page_server"
 	ActionPageDatabase    = "page_database"
@@ -0,0 +1,672 @@
+// Package datadiff compares the rows of two tables that share a primary key,
+// on one connection or two. The source is read in key order and cut into
+// chunks; each chunk's key range is read from the target and the two sides
+// are hashed. Only ranges whose hashes differ are compared row by row, and
+// every difference can be written as the INSERT, UPDATE or DELETE statement
+// that brings the target in line with the source.
+//
+// Values are compared in a normalized text form (numbers without trailing
+// zeros, booleans as 1/0, times in UTC) so tables on different engines
+// compare equal when they hold the same data. Key ranges are bounded with the
+// target's own comparison, so text keys should sort the same on both sides.
+package datadiff
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/dracory/weebase/shared/constants"
+	"github.com/dracory/weebase/shared/dialect"
+	"github.com/dracory/weebase/shared/export"
+	"github.com/dracory/weebase/shared/introspect"
+)
+
+// Row difference kinds, seen from the source: an added row exists in the
+// source only, a removed row in the target only
+const (
+	KindAdded   = "added"
+	KindRemoved = "removed"
+	KindChanged = "changed"
+)
+
+// DefaultChunkSize is the number of source rows per key range when none is given
+const DefaultChunkSize = 1000
+
+// DefaultMaxRows is the number of row differences (and differing ranges)
+// reported in a Result when no limit is given
+const DefaultMaxRows = 1000
+
+// Endpoint is one side of a comparison. Driver must be normalized.
+type Endpoint struct {
+	DB     *sql.DB
+	Driver string
+	Schema string
+	Table  string
+}
+
+// Options controls a comparison
+type Options struct {
+	// ChunkSize is the number of source rows hashed together
+	ChunkSize int
+	// MaxRows caps the differences listed in the Result; all are still counted
+	MaxRows int
+	// Script, when set, receives the statements that reconcile the target,
+	// for every difference and not only the listed ones
+	Script io.Writer
+	// Progress, when set, is called after every key range
+	Progress func(Result)
+}
+
+// Range is a key range whose hashes differ. From is the exclusive lower
+// bound and To the inclusive upper bound; nil means unbounded.
+type Range struct {
+	From       []any  `json:"from"`
+	To         []any  `json:"to"`
+	SourceRows int64  `json:"source_rows"`
+	TargetRows int64  `json:"target_rows"`
+	SourceHash string `json:"source_hash"`
+	TargetHash string `json:"target_hash"`
+}
+
+// RowDiff is one row that differs. Key holds the primary key values in the
+// order of Result.Key; Changed lists the columns that differ in a changed row.
+type RowDiff struct {
+	Kind    string         `json:"kind"`
+	Key     []any          `json:"key"`
+	Changed []string       `json:"changed,omitempty"`
+	Source  map[string]any `json:"source,omitempty"`
+	Target  map[string]any `json:"target,omitempty"`
+	SQL     string         `json:"sql"`
+}
+
+// Result reports the differences found so far
+type Result struct {
+	Key     []string `json:"key"`
+	Columns []string `json:"columns"`
+	// SourceOnly and TargetOnly are columns that exist on one side only;
+	// they are left out of the comparison
+	SourceOnly []string  `json:"source_only"`
+	TargetOnly []string  `json:"target_only"`
+	Ranges     int64     `json:"ranges"`
+	SourceRows int64     `json:"source_rows"`
+	TargetRows int64     `json:"target_rows"`
+	Differing  []Range   `json:"differing_ranges"`
+	Added      int64     `json:"added"`
+	Removed    int64     `json:"removed"`
+	Changed    int64     `json:"changed"`
+	Rows       []RowDiff `json:"rows"`
+	// Truncated is set when more ranges or rows differ than were listed
+	Truncated bool  `json:"truncated"`
+	Elapsed   int64 `json:"elapsed_ms"`
+}
+
+// Identical reports whether no differences were found
+func (r Result) Identical() bool {
+	return r.Added == 0 && r.Removed == 0 && r.Changed == 0
+}
+
+// Run compares the rows of src and dst
+func Run(ctx context.Context, src, dst Endpoint, opts Options) (Result, error) {
+	started := time.Now()
+	result := Result{SourceOnly: []string{}, TargetOnly: []string{}, Differing: []Range{}, Rows: []RowDiff{}}
+	if opts.ChunkSize <= 0 {
+		opts.ChunkSize = DefaultChunkSize
+	}
+	if opts.MaxRows <= 0 {
+		opts.MaxRows = DefaultMaxRows
+	}
+	if src.Schema == "" {
+		src.Schema = dialect.DefaultSchema(src.Driver)
+	}
+	if dst.Schema == "" {
+		dst.Schema = dialect.DefaultSchema(dst.Driver)
+	}
+
+	d := &differ{src: src, dst: dst, opts: opts, result: &result}
+	if err := d.prepare(ctx); err != nil {
+		return result, err
+	}
+	report := func() {
+		result.Elapsed = time.Since(started).Milliseconds()
+		if opts.Progress != nil {
+			opts.Progress(result)
+		}
+	}
+
+	if err := d.writeScript(fmt.Sprintf("-- Reconcile %s with %s\n", d.dstName, d.srcName)); err != nil {
+		return result, err
+	}
+
+	query, args := selectSQL(src.Driver, d.srcName, d.srcColumns, d.srcKey, nil, nil)
+	rows, err := src.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return result, fmt.Errorf("failed to read source rows: %v", err)
+	}
+	defer rows.Close()
+	if d.srcTypes, err = export.Columns(rows); err != nil {
+		return result, err
+	}
+
+	var from []any
+	chunk := make([]row, 0, opts.ChunkSize)
+	for rows.Next() {
+		if err := ctx.Err(); err != nil {
+			return result, err
+		}
+		r, err := d.scan(rows, d.srcTypes)
+		if err != nil {
+			return result, fmt.Errorf("failed to read source rows: %v", err)
+		}
+		chunk = append(chunk, r)
+		if len(chunk) < opts.ChunkSize {
+			continue
+		}
+		if err := d.compareRange(ctx, from, chunk); err != nil {
+			return result, err
+		}
+		from = chunk[len(chunk)-1].key
+		chunk = make([]row, 0, opts.ChunkSize)
+		report()
+	}
+	if err := rows.Err(); err != nil {
+		return result, fmt.Errorf("failed to read source rows: %v", err)
+	}
+	if len(chunk) > 0 {
+		if err := d.compareRange(ctx, from, chunk); err != nil {
+			return result, err
+		}
+		from = chunk[len(chunk)-1].key
+	}
+	// whatever the target holds past the last source key
+	if err := d.compareTail(ctx, from); err != nil {
+		return result, err
+	}
+	if d.identityOn {
+		if err := d.writeScript("SET IDENTITY_INSERT " + d.dstName + " OFF;\n"); err != nil {
+			return result, err
+		}
+	}
+	report()
+	return result, nil
+}
+
+// row is a scanned row with its key values and digest
+type row struct {
+	key    []any
+	id     string
+	values []any
+	texts  []string
+	nulls  []bool
+	digest [sha256.Size]byte
+}
+
+type differ struct {
+	src, dst   Endpoint
+	opts       Options
+	result     *Result
+	srcName    string
+	dstName    string
+	srcColumns []string
+	dstColumns []string
+	srcKey     []string
+	dstKey     []string
+	keyIndex   []int
+	srcTypes   []export.Column
+	dstTypes   []export.Column
+	// identity is set when inserts on SQL Server write an identity column
+	identity   bool
+	identityOn bool
+}
+
+// prepare describes both tables, checks that their primary keys match and
+// picks the columns they have in common
+func (d *differ) prepare(ctx context.Context) error {
+	srcTable, err := introspect.DescribeTable(ctx, d.src.DB, d.src.Driver, d.src.Schema, d.src.Table)
+	if err != nil {
+		return fmt.Errorf("source: %v", err)
+	}
+	dstTable, err := introspect.DescribeTable(ctx, d.dst.DB, d.dst.Driver, d.dst.Schema, d.dst.Table)
+	if err != nil {
+		return fmt.Errorf("target: %v", err)
+	}
+	d.srcName = tableName(d.src)
+	d.dstName = tableName(d.dst)
+
+	srcKey := srcTable.PrimaryKey()
+	if len(srcKey) == 0 {
+		return errors.New("the source table has no primary key")
+	}
+	dstKey := dstTable.PrimaryKey()
+	if len(dstKey) != len(srcKey) {
+		return errors.New("the tables have different primary keys")
+	}
+	for i, k := range srcKey {
+		if !strings.EqualFold(k, dstKey[i]) {
+			return errors.New("the tables have different primary keys")
+		}
+	}
+
+	for _, c := range srcTable.Columns {
+		tc, ok := findColumn(dstTable, c.Name)
+		if !ok {
+			d.result.SourceOnly = append(d.result.SourceOnly, c.Name)
+			continue
+		}
+		d.srcColumns = append(d.srcColumns, c.Name)
+		d.dstColumns = append(d.dstColumns, tc.Name)
+		d.identity = d.identity || tc.AutoIncrement
+	}
+	for _, c := range dstTable.Columns {
+		if _, ok := findColumn(srcTable, c.Name); !ok {
+			d.result.TargetOnly = append(d.result.TargetOnly, c.Name)
+		}
+	}
+	d.identity = d.identity && d.dst.Driver == constants.DriverSQLServer
+
+	for i, k := range srcKey {
+		for j, c := range d.srcColumns {
+			if c == k {
+				d.keyIndex = append(d.keyIndex, j)
+				d.srcKey = append(d.srcKey, c)
+				d.dstKey = append(d.dstKey, d.dstColumns[j])
+			}
+		}
+		if len(d.keyIndex) != i+1 {
+			return fmt.Errorf("key column %s not found", k)
+		}
+	}
+	d.result.Key = d.srcKey
+	d.result.Columns = d.srcColumns
+	return nil
+}
+
+// compareRange compares a chunk of source rows with the target rows in the
+// range (from, last key of the chunk]
+func (d *differ) compareRange(ctx context.Context, from []any, chunk []row) error {
+	to := chunk[len(chunk)-1].key
+	targets, err := d.targetRows(ctx, from, to)
+	if err != nil {
+		return err
+	}
+	d.result.Ranges++
+	d.result.SourceRows += int64(len(chunk))
+	d.result.TargetRows += int64(len(targets))
+
+	srcHash, dstHash := rangeHash(chunk), rangeHash(targets)
+	if srcHash == dstHash {
+		return nil
+	}
+	d.addRange(Range{From: d.keyJSON(from), To: d.keyJSON(to), SourceRows: int64(len(chunk)), TargetRows: int64(len(targets)), SourceHash: srcHash, TargetHash: dstHash})
+
+	// drill down: match the rows of the range by key
+	byID := make(map[string]*row, len(targets))
+	for i := range targets {
+		byID[targets[i].id] = &targets[i]
+	}
+	for i := range chunk {
+		s := &chunk[i]
+		t, ok := byID[s.id]
+		if !ok {
+			if err := d.added(s); err != nil {
+				return err
+			}
+			continue
+		}
+		delete(byID, s.id)
+		if s.digest != t.digest {
+			if err := d.changed(s, t); err != nil {
+				return err
+			}
+		}
+	}
+	// removed rows in key order
+	for i := range targets {
+		if _, ok := byID[targets[i].id]; ok {
+			if err := d.removed(&targets[i]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// compareTail handles the target rows past the last source key; all of them
+// are removed, so they are streamed rather than held in memory
+func (d *differ) compareTail(ctx context.Context, from []any) error {
+	query, args := selectSQL(d.dst.Driver, d.dstName, d.dstColumns, d.dstKey, from, nil)
+	rows, err := d.dst.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to read target rows: %v", err)
+	}
+	defer rows.Close()
+	if err := d.targetTypes(rows); err != nil {
+		return err
+	}
+
+	d.result.Ranges++
+	rng := Range{From: d.keyJSON(from), SourceHash: rangeHash(nil)}
+	hash := sha256.New()
+	for rows.Next() {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		t, err := d.scan(rows, d.dstTypes)
+		if err != nil {
+			return fmt.Errorf("failed to read target rows: %v", err)
+		}
+		rng.TargetRows++
+		d.result.TargetRows++
+		hash.Write(t.digest[:])
+		if err := d.removed(&t); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read target rows: %v", err)
+	}
+	if rng.TargetRows > 0 {
+		rng.TargetHash = hex.EncodeToString(hash.Sum(nil))
+		d.addRange(rng)
+	}
+	return nil
+}
+
+// targetRows reads the target rows in the range (from, to]
+func (d *differ) targetRows(ctx context.Context, from, to []any) ([]row, error) {
+	query, args := selectSQL(d.dst.Driver, d.dstName, d.dstColumns, d.dstKey, from, to)
+	rows, err := d.dst.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read target rows: %v", err)
+	}
+	defer rows.Close()
+	if err := d.targetTypes(rows); err != nil {
+		return nil, err
+	}
+
+	var out []row
+	for rows.Next() {
+		t, err := d.scan(rows, d.dstTypes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read target rows: %v", err)
+		}
+		out = append(out, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read target rows: %v", err)
+	}
+	return out, nil
+}
+
+func (d *differ) targetTypes(rows *sql.Rows) error {
+	if d.dstTypes != nil {
+		return nil
+	}
+	var err error
+	d.dstTypes, err = export.Columns(rows)
+	return err
+}
+
+// scan reads one row and computes its digest over the normalized values
+func (d *differ) scan(rows *sql.Rows, columns []export.Column) (row, error) {
+	values := make([]any, len(columns))
+	ptrs := make([]any, len(values))
+	for i := range values {
+		ptrs[i] = &values[i]
+	}
+	if err := rows.Scan(ptrs...); err != nil {
+		return row{}, err
+	}
+
+	r := row{values: values, texts: make([]string, len(values)), nulls: make([]bool, len(values))}
+	h := sha256.New()
+	for i, v := range values {
+		r.texts[i], r.nulls[i] = normalize(v, columns[i])
+		writeField(h, r.texts[i], r.nulls[i])
+	}
+	copy(r.digest[:], h.Sum(nil))
+
+	var id strings.Builder
+	for _, i := range d.keyIndex {
+		r.key = append(r.key, keyArg(values[i]))
+		id.WriteString(r.texts[i])
+		id.WriteByte(0)
+	}
+	r.id = id.String()
+	return r, nil
+}
+
+func (d *differ) added(s *row) error {
+	d.result.Added++
+	stmt := d.insertSQL(s)
+	if d.identity && !d.identityOn {
+		d.identityOn = true
+		if err := d.writeScript("SET IDENTITY_INSERT " + d.dstName + " ON;\n"); err != nil {
+			return err
+		}
+	}
+	d.addRow(RowDiff{Kind: KindAdded, Key: d.keyJSON(s.key), Source: d.record(s, d.srcColumns, d.srcTypes), SQL: stmt})
+	return d.writeScript(stmt + "\n")
+}
+
+func (d *differ) removed(t *row) error {
+	d.result.Removed++
+	stmt := "DELETE FROM " + d.dstName + " WHERE " + d.keyCondition(t, d.dstTypes) + ";"
+	d.addRow(RowDiff{Kind: KindRemoved, Key: d.keyJSON(t.key), Target: d.record(t, d.dstColumns, d.dstTypes), SQL: stmt})
+	return d.writeScript(stmt + "\n")
+}
+
+func (d *differ) changed(s, t *row) error {
+	var changed, sets []string
+	for i := range s.texts {
+		if s.texts[i] == t.texts[i] && s.nulls[i] == t.nulls[i] {
+			continue
+		}
+		changed = append(changed, d.srcColumns[i])
+		sets = append(sets, dialect.QuoteIdent(d.dst.Driver, d.dstColumns[i])+" = "+export.Literal(d.dst.Driver, s.values[i], d.srcTypes[i]))
+	}
+	d.result.Changed++
+	stmt := "UPDATE " + d.dstName + " SET " + strings.Join(sets, ", ") + " WHERE " + d.keyCondition(t, d.dstTypes) + ";"
+	d.addRow(RowDiff{
+		Kind:    KindChanged,
+		Key:     d.keyJSON(s.key),
+		Changed: changed,
+		Source:  d.record(s, d.srcColumns, d.srcTypes),
+		Target:  d.record(t, d.dstColumns, d.dstTypes),
+		SQL:     stmt,
+	})
+	return d.writeScript(stmt + "\n")
+}
+
+func (d *differ) insertSQL(s *row) string {
+	names := make([]string, len(d.dstColumns))
+	values := make([]string, len(d.dstColumns))
+	for i, c := range d.dstColumns {
+		names[i] = dialect.QuoteIdent(d.dst.Driver, c)
+		values[i] = export.Literal(d.dst.Driver, s.values[i], d.srcTypes[i])
+	}
+	return "INSERT INTO " + d.dstName + " (" + strings.Join(names, ", ") + ") VALUES (" + strings.Join(values, ", ") + ");"
+}
+
+// keyCondition matches a target row by its primary key
+func (d *differ) keyCondition(t *row, columns []export.Column) string {
+	parts := make([]string, len(d.keyIndex))
+	for n, i := range d.keyIndex {
+		parts[n] = dialect.QuoteIdent(d.dst.Driver, d.dstColumns[i]) + " = " + export.Literal(d.dst.Driver, t.values[i], columns[i])
+	}
+	return strings.Join(parts, " AND ")
+}
+
+func (d *differ) record(r *row, names []string, columns []export.Column) map[string]any {
+	out := make(map[string]any, len(names))
+	for i, name := range names {
+		out[name] = export.JSONValue(r.values[i], columns[i])
+	}
+	return out
+}
+
+func (d *differ) keyJSON(key []any) []any {
+	if key == nil {
+		return nil
+	}
+	out := make([]any, len(key))
+	for i, v := range key {
+		out[i] = export.JSONValue(v, export.Column{})
+	}
+	return out
+}
+
+func (d *differ) addRange(r Range) {
+	if len(d.result.Differing) >= d.opts.MaxRows {
+		d.result.Truncated = true
+		return
+	}
+	d.result.Differing = append(d.result.Differing, r)
+}
+
+func (d *differ) addRow(r RowDiff) {
+	if len(d.result.Rows) >= d.opts.MaxRows {
+		d.result.Truncated = true
+		return
+	}
+	d.result.Rows = append(d.result.Rows, r)
+}
+
+func (d *differ) writeScript(s string) error {
+	if d.opts.Script == nil {
+		return nil
+	}
+	if _, err := io.WriteString(d.opts.Script, s); err != nil {
+		return fmt.Errorf("failed to write script: %v", err)
+	}
+	return nil
+}
+
+// selectSQL reads the columns of a table in key order, limited to the key
+// range (from, to] when the bounds are set
+func selectSQL(drv, table string, columns, key []string, from, to []any) (string, []any) {
+	quoted := make([]string, len(columns))
+	for i, c := range columns {
+		quoted[i] = dialect.QuoteIdent(drv, c)
+	}
+	order := make([]string, len(key))
+	for i, c := range key {
+		order[i] = dialect.QuoteIdent(drv, c)
+	}
+
+	var where []string
+	var args []any
+	if from != nil {
+		where = append(where, keyCompare(drv, key, from, ">", &args))
+	}
+	if to != nil {
+		where = append(where, keyCompare(drv, key, to, "<=", &args))
+	}
+	query := "SELECT " + strings.Join(quoted, ", ") + " FROM " + table
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	return query + " ORDER BY " + strings.Join(order, ", "), args
+}
+
+// keyCompare compares a (possibly composite) key with bound values. Row value
+// comparisons aren't available on SQL Server, so (a, b) > (x, y) is spelled
+// out as a > x OR (a = x AND b > y).
+func keyCompare(drv string, key []string, bound []any, op string, args *[]any) string {
+	strict := strings.TrimSuffix(op, "=")
+	bind := func(v any) string {
+		*args = append(*args, dialect.BindArg(drv, len(*args)+1, v))
+		return dialect.Placeholder(drv, len(*args))
+	}
+
+	var terms []string
+	for i := range key {
+		var parts []string
+		for j := 0; j < i; j++ {
+			parts = append(parts, dialect.QuoteIdent(drv, key[j])+" = "+bind(bound[j]))
+		}
+		o := strict
+		if i == len(key)-1 {
+			o = op
+		}
+		parts = append(parts, dialect.QuoteIdent(drv, key[i])+" "+o+" "+bind(bound[i]))
+		terms = append(terms, "("+strings.Join(parts, " AND ")+")")
+	}
+	return "(" + strings.Join(terms, " OR ") + ")"
+}
+
+// keyArg turns a scanned key value into a bind argument usable on either side
+func keyArg(v any) any {
+	if b, ok := v.([]byte); ok {
+		return string(b)
+	}
+	return v
+}
+
+// normalize renders a value in the form both sides are compared in
+func normalize(v any, column export.Column) (string, bool) {
+	switch x := v.(type) {
+	case bool:
+		if x {
+			return "1", false
+		}
+		return "0", false
+	case time.Time:
+		return x.UTC().Format(time.RFC3339Nano), false
+	}
+	text, null, numeric := export.FormatText(v, column)
+	if numeric && strings.Contains(text, ".") {
+		text = strings.TrimRight(strings.TrimRight(text, "0"), ".")
+	}
+	return text, null
+}
+
+// writeField adds a value to a row digest; the length prefix keeps
+// ("ab", "c") and ("a", "bc") apart
+func writeField(h hash.Hash, text string, null bool) {
+	var buf [9]byte
+	if null {
+		buf[0] = 1
+	}
+	binary.BigEndian.PutUint64(buf[1:], uint64(len(text)))
+	h.Write(buf[:])
+	h.Write([]byte(text))
+}
+
+// rangeHash combines the digests of a range's rows in key order
+func rangeHash(rows []row) string {
+	h := sha256.New()
+	for i := range rows {
+		h.Write(rows[i].digest[:])
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// findColumn matches a column by name, ignoring case as dialects differ in
+// how they fold unquoted names
+func findColumn(t introspect.Table, name string) (introspect.Column, bool) {
+	if c, ok := t.Column(name); ok {
+		return c, true
+	}
+	for _, c := range t.Columns {
+		if strings.EqualFold(c.Name, name) {
+			return c, true
+		}
+	}
+	return introspect.Column{}, false
+}
+
+func tableName(e Endpoint) string {
+	if e.Driver == constants.DriverSQLite {
+		return dialect.QuoteIdent(e.Driver, e.Table)
+	}
+	return dialect.QualifiedName(e.Driver, e.Schema, e.Table)
+}
@@ -0,0 +1,283 @@
+package dataimport
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/dracory/weebase/shared/dialect"
+	"github.com/dracory/weebase/shared/introspect"
+)
+
+// timeLayouts are tried in order when parsing dates and times from text
+var timeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05.999999999Z07:00",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02 15:04",
+	"2006-01-02",
+	"15:04:05.999999999",
+	"15:04",
+}
+
+// Coerce converts an imported value (a JSON value or CSV text) into an argument
+// the driver accepts for the column. Empty text is NULL for every type but text.
+// Dates and times are validated and passed on in ISO form so every dialect
+// parses them the same way.
+func Coerce(drv string, col introspect.Column, v any) (any, error) {
+	if v == nil {
+		return nil, nil
+	}
+
+	canonical := dialect.CanonicalType(drv, col.Type)
+	family, args, _ := strings.Cut(canonical, "(")
+	args = strings.TrimSuffix(args, ")")
+
+	if s, ok := v.(string); ok && strings.TrimSpace(s) == "" {
+		switch family {
+		case dialect.TypeText, dialect.TypeVarchar, dialect.TypeChar:
+		default:
+			return nil, nil
+		}
+	}
+
+	switch family {
+	case dialect.TypeInteger, dialect.TypeBigInt, dialect.TypeSmallInt:
+		return toInt(v)
+	case dialect.TypeBoolean:
+		return toBool(v)
+	case dialect.TypeDecimal:
+		f, err := toFloat(v)
+		if err != nil {
+			return nil, err
+		}
+		if n, ok := v.(json.Number); ok {
+			return n.String(), nil
+		}
+		if s, ok := v.(string); ok {
+			return strings.TrimSpace(s), nil
+		}
+		return strconv.FormatFloat(f, 'f', -1, 64), nil
+	case dialect.TypeReal, dialect.TypeDouble:
+		return toFloat(v)
+	case dialect.TypeDate, dialect.TypeTime, dialect.TypeTimestamp, dialect.TypeTimestampTZ:
+		return toTime(family, v)
+	case dialect.TypeJSON:
+		return toJSON(v)
+	case dialect.TypeBlob:
+		return toBytes(v)
+	case dialect.TypeUUID:
+		s, err := toText(v)
+		if err != nil {
+			return nil, err
+		}
+		if !isUUID(s) {
+			return nil, fmt.Errorf("invalid UUID: %q", s)
+		}
+		return s, nil
+	}
+
+	s, err := toText(v)
+	if err != nil {
+		return nil, err
+	}
+	if family == dialect.TypeVarchar || family == dialect.TypeChar {
+		if limit, err := strconv.Atoi(args); err == nil && utf8.RuneCountInString(s) > limit {
+			return nil, fmt.Errorf("value too long for %s (%d characters)", canonical, utf8.RuneCountInString(s))
+		}
+	}
+	return s, nil
+}
+
+func toInt(v any) (any, error) {
+	switch x := v.(type) {
+	case json.Number:
+		if n, err := x.Int64(); err == nil {
+			return n, nil
+		}
+		f, err := x.Float64()
+		if err != nil || f != math.Trunc(f) {
+			return nil, fmt.Errorf("not an integer: %s", x)
+		}
+		return int64(f), nil
+	case float64:
+		if x != math.Trunc(x) {
+			return nil, fmt.Errorf("not an integer: %v", x)
+		}
+		return int64(x), nil
+	case int64:
+		return x, nil
+	case bool:
+		if x {
+			return int64(1), nil
+		}
+		return int64(0), nil
+	case string:
+		n, err := strconv.ParseInt(strings.TrimSpace(x), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("not an integer: %q", x)
+		}
+		return n, nil
+	}
+	return nil, fmt.Errorf("cannot use %s as an integer", describe(v))
+}
+
+func toFloat(v any) (float64, error) {
+	switch x := v.(type) {
+	case json.Number:
+		return x.Float64()
+	case float64:
+		return x, nil
+	case int64:
+		return float64(x), nil
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(x), 64)
+		if err != nil {
+			return 0, fmt.Errorf("not a number: %q", x)
+		}
+		return f, nil
+	}
+	return 0, fmt.Errorf("cannot use %s as a number", describe(v))
+}
+
+func toBool(v any) (any, error) {
+	switch x := v.(type) {
+	case bool:
+		return x, nil
+	case json.Number:
+		switch x.String() {
+		case "0":
+			return false, nil
+		case "1":
+			return true, nil
+		}
+	case float64:
+		switch x {
+		case 0:
+			return false, nil
+		case 1:
+			return true, nil
+		}
+	case string:
+		switch strings.ToLower(strings.TrimSpace(x)) {
+		case "1", "t", "true", "y", "yes", "on":
+			return true, nil
+		case "0", "f", "false", "n", "no", "off":
+			return false, nil
+		}
+	}
+	return nil, fmt.Errorf("not a boolean: %s", describe(v))
+}
+
+func toTime(family string, v any) (any, error) {
+	s, ok := v.(string)
+	if !ok {
+		return nil, fmt.Errorf("cannot use %s as a date or time", describe(v))
+	}
+	s = strings.TrimSpace(s)
+	for _, layout := range timeLayouts {
+		t, err := time.Parse(layout, s)
+		if err != nil {
+			continue
+		}
+		switch family {
+		case dialect.TypeDate:
+			return t.Format("2006-01-02"), nil
+		case dialect.TypeTime:
+			return t.Format("15:04:05.999999999"), nil
+		case dialect.TypeTimestampTZ:
+			return t.Format(time.RFC3339Nano), nil
+		default:
+			return t.Format("2006-01-02 15:04:05.999999999"), nil
+		}
+	}
+	return nil, fmt.Errorf("unrecognised date/time: %q", s)
+}
+
+func toJSON(v any) (any, error) {
+	if s, ok := v.(string); ok {
+		if !json.Valid([]byte(s)) {
+			return nil, fmt.Errorf("invalid JSON: %q", s)
+		}
+		return s, nil
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+// toBytes accepts the "\x"-prefixed hex the exports write, or raw text
+func toBytes(v any) (any, error) {
+	s, ok := v.(string)
+	if !ok {
+		return nil, fmt.Errorf("cannot use %s as binary data", describe(v))
+	}
+	if hexText, ok := strings.CutPrefix(s, `\x`); ok {
+		b, err := hex.DecodeString(hexText)
+		if err != nil {
+			return nil, fmt.Errorf("invalid hex data: %v", err)
+		}
+		return b, nil
+	}
+	return []byte(s), nil
+}
+
+func toText(v any) (string, error) {
+	switch x := v.(type) {
+	case string:
+		return x, nil
+	case json.Number:
+		return x.String(), nil
+	case float64:
+		return strconv.FormatFloat(x, 'f', -1, 64), nil
+	case int64:
+		return strconv.FormatInt(x, 10), nil
+	case bool:
+		return strconv.FormatBool(x), nil
+	case map[string]any, []any:
+		b, err := json.Marshal(x)
+		return string(b), err
+	}
+	return fmt.Sprint(v), nil
+}
+
+func isUUID(s string) bool {
+	s = strings.Trim(s, "{}")
+	if len(s) != 36 {
+		return false
+	}
+	for i, r := range s {
+		if i == 8 || i == 13 || i == 18 || i == 23 {
+			if r != '-' {
+				return false
+			}
+			continue
+		}
+		if !strings.ContainsRune("0123456789abcdefABCDEF", r) {
+			return false
+		}
+	}
+	return true
+}
+
+func describe(v any) string {
+	switch v.(type) {
+	case map[string]any:
+		return "an object"
+	case []any:
+		return "an array"
+	case bool:
+		return "a boolean"
+	case json.Number, float64, int64:
+		return "a number"
+	}
+	return fmt.Sprintf("%q", fmt.Sprint(v))
+}
@@ -0,0 +1,287 @@
+package dataimport
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/unicode"
+	"golang.org/x/text/transform"
+)
+
+// CSV input encodings
+const (
+	EncodingUTF8        = "utf-8"
+	EncodingUTF16LE     = "utf-16le"
+	EncodingUTF16BE     = "utf-16be"
+	EncodingWindows1252 = "windows-1252"
+	EncodingISO88591    = "iso-8859-1"
+)
+
+// delimiters are the candidates tried when no delimiter is given
+var delimiters = []rune{',', ';', '\t', '|'}
+
+// sniffSize is how much of the input is looked at to detect the delimiter
+const sniffSize = 64 * 1024
+
+// CSVOptions configures the CSV reader
+type CSVOptions struct {
+	// Delimiter separates fields; zero detects it from the first lines
+	Delimiter rune
+	// Header takes field names from the first line; without it fields are
+	// named column_1, column_2, ...
+	Header bool
+	// Null, when set, is read as NULL wherever a field equals it exactly
+	Null     string
+	Encoding string
+}
+
+// DefaultCSVOptions detects the delimiter of UTF-8 input with a header line
+func DefaultCSVOptions() CSVOptions {
+	return CSVOptions{Header: true, Encoding: EncodingUTF8}
+}
+
+// CSVOptionsFromForm reads delimiter (detected when empty or "auto", "tab"
+// for a tab), header ("no" when there is none), null and encoding from
+// request parameters
+func CSVOptionsFromForm(form url.Values) CSVOptions {
+	opts := DefaultCSVOptions()
+	switch d := form.Get("delimiter"); d {
+	case "", "auto":
+	case "tab", `\t`:
+		opts.Delimiter = '\t'
+	default:
+		opts.Delimiter, _ = utf8.DecodeRuneInString(d)
+	}
+	opts.Header = form.Get("header") != "no"
+	opts.Null = form.Get("null")
+	if e := form.Get("encoding"); e != "" {
+		opts.Encoding = e
+	}
+	return opts
+}
+
+// FormatFromName guesses the import format from a file extension, JSON when unknown
+func FormatFromName(name string) string {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".csv", ".tsv", ".txt":
+		return FormatCSV
+	case ".ndjson", ".jsonl":
+		return FormatNDJSON
+	default:
+		return FormatJSON
+	}
+}
+
+// CSVReader reads records from delimited text, keyed by header name
+type CSVReader struct {
+	opts    CSVOptions
+	r       *csv.Reader
+	headers []string
+	first   []string
+	done    bool
+}
+
+// NewCSVReader decodes r, detects the delimiter when needed and reads the
+// header line so Headers is available before the first record
+func NewCSVReader(r io.Reader, opts CSVOptions) (*CSVReader, error) {
+	decoded, err := decodeReader(r, opts.Encoding)
+	if err != nil {
+		return nil, err
+	}
+	br := bufio.NewReaderSize(decoded, sniffSize)
+	if bom, err := br.Peek(3); err == nil && bytes.Equal(bom, []byte("\xEF\xBB\xBF")) {
+		br.Discard(3)
+	}
+	if opts.Delimiter == 0 {
+		sample, _ := br.Peek(sniffSize)
+		opts.Delimiter = DetectDelimiter(sample)
+	}
+	if opts.Delimiter == '"' || opts.Delimiter == '\r' || opts.Delimiter == '\n' {
+		return nil, errors.New("invalid CSV delimiter")
+	}
+
+	cr := csv.NewReader(br)
+	cr.Comma = opts.Delimiter
+	cr.FieldsPerRecord = -1
+	cr.LazyQuotes = true
+
+	reader := &CSVReader{opts: opts, r: cr}
+	line, err := cr.Read()
+	if err == io.EOF {
+		reader.done = true
+		return reader, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid CSV: %v", err)
+	}
+	if opts.Header {
+		reader.headers = headerNames(line)
+	} else {
+		reader.headers = headerNames(make([]string, len(line)))
+		reader.first = line
+	}
+	return reader, nil
+}
+
+// Headers returns the field names records are keyed by
+func (cr *CSVReader) Headers() []string {
+	return cr.headers
+}
+
+// Delimiter returns the delimiter in use, detected or given
+func (cr *CSVReader) Delimiter() rune {
+	return cr.opts.Delimiter
+}
+
+// Line reads the next line as raw fields, for previews
+func (cr *CSVReader) Line() ([]string, error) {
+	if cr.first != nil {
+		line := cr.first
+		cr.first = nil
+		return line, nil
+	}
+	if cr.done {
+		return nil, io.EOF
+	}
+	line, err := cr.r.Read()
+	if err == io.EOF {
+		cr.done = true
+		return nil, io.EOF
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid CSV: %v", err)
+	}
+	return line, nil
+}
+
+// Next returns the next line as a record. A line with a different number of
+// fields than the header is rejected rather than guessed at.
+func (cr *CSVReader) Next() (Record, error) {
+	line, err := cr.Line()
+	if err != nil {
+		return nil, err
+	}
+	if len(line) == 1 && strings.TrimSpace(line[0]) == "" && len(cr.headers) > 1 {
+		// encoding/csv skips empty lines but not ones holding only spaces
+		return cr.Next()
+	}
+	if len(line) != len(cr.headers) {
+		return nil, &RowError{Message: fmt.Sprintf("expected %d fields, got %d", len(cr.headers), len(line))}
+	}
+	record := make(Record, len(line))
+	for i, v := range line {
+		if cr.opts.Null != "" && v == cr.opts.Null {
+			record[cr.headers[i]] = nil
+			continue
+		}
+		record[cr.headers[i]] = v
+	}
+	return record, nil
+}
+
+// DetectDelimiter picks the candidate delimiter that splits the sample's
+// lines into the same number of fields most consistently, preferring more
+// fields; a comma when nothing fits better
+func DetectDelimiter(sample []byte) rune {
+	lines := strings.Split(strings.ReplaceAll(string(sample), "\r\n", "\n"), "\n")
+	if len(lines) > 1 {
+		// the last line may be cut off by the sample size
+		lines = lines[:len(lines)-1]
+	}
+	if len(lines) > 20 {
+		lines = lines[:20]
+	}
+
+	best, bestScore := ',', 0
+	for _, d := range delimiters {
+		counts := map[int]int{}
+		for _, line := range lines {
+			if strings.TrimSpace(line) == "" {
+				continue
+			}
+			counts[countOutsideQuotes(line, d)]++
+		}
+		fields, lineCount := 0, 0
+		for n, c := range counts {
+			if c > lineCount || (c == lineCount && n > fields) {
+				fields, lineCount = n, c
+			}
+		}
+		if fields == 0 {
+			continue
+		}
+		if score := lineCount*1000 + fields; score > bestScore {
+			best, bestScore = d, score
+		}
+	}
+	return best
+}
+
+func countOutsideQuotes(line string, d rune) int {
+	n, quoted := 0, false
+	for _, r := range line {
+		switch {
+		case r == '"':
+			quoted = !quoted
+		case r == d && !quoted:
+			n++
+		}
+	}
+	return n
+}
+
+// headerNames fills in blank header names and makes duplicates unique
+func headerNames(line []string) []string {
+	names := make([]string, len(line))
+	seen := map[string]int{}
+	for i, name := range line {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			name = fmt.Sprintf("column_%d", i+1)
+		}
+		if n := seen[name]; n > 0 {
+			seen[name] = n + 1
+			name = fmt.Sprintf("%s_%d", name, n+1)
+		} else {
+			seen[name] = 1
+		}
+		names[i] = name
+	}
+	return names
+}
+
+// decodeReader wraps r so that text in the given encoding reads as UTF-8.
+// UTF-16 input with a byte order mark is recognised whatever the setting.
+func decodeReader(r io.Reader, enc string) (io.Reader, error) {
+	var decoder *encoding.Decoder
+	switch strings.ToLower(enc) {
+	case "", EncodingUTF8, "utf8", "utf-8-bom":
+		br := bufio.NewReader(r)
+		if bom, err := br.Peek(2); err == nil && (bytes.Equal(bom, []byte{0xFF, 0xFE}) || bytes.Equal(bom, []byte{0xFE, 0xFF})) {
+			decoder = unicode.UTF16(unicode.LittleEndian, unicode.ExpectBOM).NewDecoder()
+			return transform.NewReader(br, decoder), nil
+		}
+		return br, nil
+	case EncodingUTF16LE:
+		decoder = unicode.UTF16(unicode.LittleEndian, unicode.UseBOM).NewDecoder()
+	case EncodingUTF16BE:
+		decoder = unicode.UTF16(unicode.BigEndian, unicode.UseBOM).NewDecoder()
+	case EncodingWindows1252, "cp1252":
+		decoder = charmap.Windows1252.NewDecoder()
+	case EncodingISO88591, "latin1":
+		decoder = charmap.ISO8859_1.NewDecoder()
+	default:
+		return nil, errors.New("unsupported encoding: " + enc)
+	}
+	return transform.NewReader(r, decoder), nil
+}
@@ -0,0 +1,496 @@
+// Package dataimport loads records from files (CSV, JSON, NDJSON) into an
+// existing table: fields are mapped to columns, values coerced to the column
+// types and rows inserted in batches inside a single transaction.
+package dataimport
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"github.com/dracory/weebase/shared/constants"
+	"github.com/dracory/weebase/shared/dialect"
+	"github.com/dracory/weebase/shared/introspect"
+)
+
+// Record is one imported row keyed by source field name
+type Record map[string]any
+
+// Reader yields records until io.EOF. A *RowError reports a record that
+// could not be read; the import records it and carries on.
+type Reader interface {
+	Next() (Record, error)
+}
+
+// RowError describes why a record was rejected
+type RowError struct {
+	// Row is the 1-based position of the record in the input
+	Row     int64  `json:"row"`
+	Column  string `json:"column,omitempty"`
+	Message string `json:"message"`
+}
+
+func (e *RowError) Error() string {
+	if e.Column != "" {
+		return fmt.Sprintf("row %d, column %s: %s", e.Row, e.Column, e.Message)
+	}
+	return fmt.Sprintf("row %d: %s", e.Row, e.Message)
+}
+
+// DefaultBatchSize is the number of rows per INSERT when none is given
+const DefaultBatchSize = 100
+
+// DefaultMaxErrors caps the row errors collected in a Result
+const DefaultMaxErrors = 100
+
+// Import modes
+const (
+	// ModeInsert adds the rows; key conflicts reject them
+	ModeInsert = "insert"
+	// ModeUpsert updates rows whose primary key already exists
+	ModeUpsert = "upsert"
+	// ModeReplace deletes every existing row first
+	ModeReplace = "replace"
+)
+
+// Options controls an import
+type Options struct {
+	Driver string
+	// Mode is one of the Mode constants; empty means ModeInsert
+	Mode string
+	// Mapping maps source fields to target columns. An empty target skips the
+	// field. Without a mapping fields load into the column of the same name.
+	Mapping   map[string]string
+	BatchSize int
+	// SkipErrors commits the rows that loaded and skips the rejected ones;
+	// otherwise any rejected row rolls the whole import back
+	SkipErrors bool
+	// DryRun validates and inserts every row, then rolls back
+	DryRun bool
+	// MaxErrors stops the import once that many rows were rejected
+	MaxErrors int
+	// IdentityInsert enables SET IDENTITY_INSERT on SQL Server so explicit
+	// values can be written to an identity column
+	IdentityInsert bool
+	// Progress, when set, is called after every batch
+	Progress func(Result)
+}
+
+// Result reports the outcome of an import
+type Result struct {
+	Rows     int64      `json:"rows"`
+	Inserted int64      `json:"inserted"`
+	Failed   int64      `json:"failed"`
+	Errors   []RowError `json:"errors"`
+	Ignored  []string   `json:"ignored_fields"`
+	// Deleted counts the rows removed by ModeReplace
+	Deleted   int64 `json:"deleted"`
+	DryRun    bool  `json:"dry_run"`
+	Committed bool  `json:"committed"`
+	// Truncated is set when the import stopped after MaxErrors rejected rows
+	Truncated bool `json:"truncated"`
+}
+
+// pending is a coerced row waiting for its batch
+type pending struct {
+	row    int64
+	values []any
+}
+
+type importer struct {
+	ctx     context.Context
+	tx      *sql.Tx
+	drv     string
+	table   introspect.Table
+	opts    Options
+	result  Result
+	key     []string
+	columns []string
+	batch   []pending
+	ignored map[string]bool
+	sp      int
+}
+
+// Run imports every record of r into table. Rows are only committed when the
+// import succeeds, or with SkipErrors set; the Result says which happened.
+func Run(ctx context.Context, db *sql.DB, table introspect.Table, r Reader, opts Options) (Result, error) {
+	im, err := newImporter(ctx, table, opts)
+	if err != nil {
+		return Result{}, err
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return Result{}, fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+	im.tx = tx
+
+	if im.opts.IdentityInsert && im.drv == constants.DriverSQLServer {
+		if _, err := tx.ExecContext(ctx, "SET IDENTITY_INSERT "+im.tableName()+" ON"); err != nil {
+			return im.result, fmt.Errorf("failed to enable identity insert: %v", err)
+		}
+	}
+	if im.opts.Mode == ModeReplace {
+		res, err := tx.ExecContext(ctx, "DELETE FROM "+im.tableName())
+		if err != nil {
+			return im.result, fmt.Errorf("failed to empty %s: %v", table.Name, err)
+		}
+		im.result.Deleted, _ = res.RowsAffected()
+	}
+	if err := im.run(r); err != nil {
+		return im.result, err
+	}
+
+	if im.opts.DryRun || (im.result.Failed > 0 && !im.opts.SkipErrors) {
+		return im.result, nil
+	}
+	if err := tx.Commit(); err != nil {
+		return im.result, fmt.Errorf("failed to commit: %v", err)
+	}
+	im.result.Committed = true
+	return im.result, nil
+}
+
+// Validate maps and coerces every record of r against table without touching
+// a database, for tables that don't exist yet. Constraint violations only
+// show up in a dry run with Run.
+func Validate(ctx context.Context, table introspect.Table, r Reader, opts Options) (Result, error) {
+	opts.DryRun = true
+	im, err := newImporter(ctx, table, opts)
+	if err != nil {
+		return Result{}, err
+	}
+	err = im.run(r)
+	return im.result, err
+}
+
+func newImporter(ctx context.Context, table introspect.Table, opts Options) (*importer, error) {
+	opts.Driver = dialect.Normalize(opts.Driver)
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = DefaultBatchSize
+	}
+	if opts.MaxErrors <= 0 {
+		opts.MaxErrors = DefaultMaxErrors
+	}
+	for field, column := range opts.Mapping {
+		if _, ok := table.Column(column); column != "" && !ok {
+			return nil, fmt.Errorf("field %s is mapped to unknown column %s", field, column)
+		}
+	}
+
+	im := &importer{
+		ctx:     ctx,
+		drv:     opts.Driver,
+		table:   table,
+		opts:    opts,
+		result:  Result{DryRun: opts.DryRun, Errors: []RowError{}, Ignored: []string{}},
+		ignored: map[string]bool{},
+	}
+	switch opts.Mode {
+	case "", ModeInsert:
+		im.opts.Mode = ModeInsert
+	case ModeUpsert:
+		im.key = table.PrimaryKey()
+		if len(im.key) == 0 {
+			return nil, fmt.Errorf("upsert needs a primary key on %s", table.Name)
+		}
+	case ModeReplace:
+	default:
+		return nil, fmt.Errorf("unsupported import mode: %s", opts.Mode)
+	}
+	return im, nil
+}
+
+func (im *importer) run(r Reader) error {
+	for {
+		if err := im.ctx.Err(); err != nil {
+			return err
+		}
+		record, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		im.result.Rows++
+		row := im.result.Rows
+
+		var rowErr *RowError
+		if errors.As(err, &rowErr) {
+			rowErr.Row = row
+			im.reject(*rowErr)
+		} else if err != nil {
+			return err
+		} else if columns, values, rowErr := im.convert(row, record); rowErr != nil {
+			im.reject(*rowErr)
+		} else {
+			if !slices.Equal(columns, im.columns) {
+				// rows with a different set of fields start a new INSERT
+				if err := im.flush(); err != nil {
+					return err
+				}
+				im.columns = columns
+			}
+			im.batch = append(im.batch, pending{row: row, values: values})
+			if len(im.batch) >= im.batchLimit() {
+				if err := im.flush(); err != nil {
+					return err
+				}
+			}
+		}
+
+		if im.result.Failed >= int64(im.opts.MaxErrors) {
+			im.result.Truncated = true
+			return nil
+		}
+	}
+	return im.flush()
+}
+
+// convert maps and coerces a record into insert columns and values
+func (im *importer) convert(row int64, record Record) ([]string, []any, *RowError) {
+	columns := []string{}
+	values := []any{}
+	for _, c := range im.table.Columns {
+		field, ok := im.fieldFor(c.Name, record)
+		if !ok {
+			continue
+		}
+		value, err := Coerce(im.drv, c, record[field])
+		if err != nil {
+			return nil, nil, &RowError{Row: row, Column: c.Name, Message: err.Error()}
+		}
+		columns = append(columns, c.Name)
+		values = append(values, value)
+	}
+	for field := range record {
+		if !im.mapped(field) && !im.ignored[field] {
+			im.ignored[field] = true
+			im.result.Ignored = append(im.result.Ignored, field)
+		}
+	}
+	if len(columns) == 0 {
+		return nil, nil, &RowError{Row: row, Message: "no fields map to a column"}
+	}
+	for _, k := range im.key {
+		if !slices.Contains(columns, k) {
+			return nil, nil, &RowError{Row: row, Column: k, Message: "primary key column is missing"}
+		}
+	}
+	return columns, values, nil
+}
+
+// fieldFor returns the record field that loads into column
+func (im *importer) fieldFor(column string, record Record) (string, bool) {
+	if im.opts.Mapping != nil {
+		for field, target := range im.opts.Mapping {
+			if target == column {
+				_, ok := record[field]
+				return field, ok
+			}
+		}
+		return "", false
+	}
+	if _, ok := record[column]; ok {
+		return column, true
+	}
+	for field := range record {
+		if strings.EqualFold(field, column) {
+			return field, true
+		}
+	}
+	return "", false
+}
+
+func (im *importer) mapped(field string) bool {
+	if im.opts.Mapping != nil {
+		return im.opts.Mapping[field] != ""
+	}
+	for _, c := range im.table.Columns {
+		if strings.EqualFold(c.Name, field) {
+			return true
+		}
+	}
+	return false
+}
+
+func (im *importer) reject(e RowError) {
+	im.result.Failed++
+	if len(im.result.Errors) < im.opts.MaxErrors {
+		im.result.Errors = append(im.result.Errors, e)
+	}
+}
+
+// batchLimit keeps a multi-row INSERT under the dialect's bind parameter limit
+func (im *importer) batchLimit() int {
+	maxParams := 65535
+	switch im.drv {
+	case constants.DriverSQLite:
+		maxParams = 999
+	case constants.DriverSQLServer:
+		// SQL Server also caps a VALUES list at 1000 rows
+		return max(1, min(im.opts.BatchSize, 1000, (2100-1)/max(1, len(im.columns))))
+	}
+	return max(1, min(im.opts.BatchSize, maxParams/max(1, len(im.columns))))
+}
+
+// flush inserts the pending batch. When the batch fails it is retried row by
+// row so the offending rows can be reported and, with SkipErrors, left out.
+func (im *importer) flush() error {
+	batch := im.batch
+	im.batch = nil
+	if len(batch) == 0 {
+		return nil
+	}
+	defer func() {
+		if im.opts.Progress != nil {
+			im.opts.Progress(im.result)
+		}
+	}()
+	if im.tx == nil {
+		// Validate only coerces
+		im.result.Inserted += int64(len(batch))
+		return nil
+	}
+
+	err := im.savepoint(func() error { return im.insert(batch) })
+	if err == nil {
+		im.result.Inserted += int64(len(batch))
+		return nil
+	}
+	if len(batch) == 1 {
+		im.reject(RowError{Row: batch[0].row, Message: err.Error()})
+		return nil
+	}
+	for _, p := range batch {
+		if err := im.savepoint(func() error { return im.insert([]pending{p}) }); err != nil {
+			im.reject(RowError{Row: p.row, Message: err.Error()})
+			continue
+		}
+		im.result.Inserted++
+	}
+	return nil
+}
+
+func (im *importer) insert(batch []pending) error {
+	names := make([]string, len(im.columns))
+	for i, c := range im.columns {
+		names[i] = dialect.QuoteIdent(im.drv, c)
+	}
+	upsert := im.opts.Mode == ModeUpsert
+
+	var sb strings.Builder
+	if upsert && im.drv == constants.DriverSQLServer {
+		sb.WriteString("MERGE INTO " + im.tableName() + " WITH (HOLDLOCK) AS target USING (VALUES ")
+	} else {
+		sb.WriteString("INSERT INTO " + im.tableName() + " (" + strings.Join(names, ", ") + ") VALUES ")
+	}
+	args := make([]any, 0, len(batch)*len(im.columns))
+	for i, p := range batch {
+		if i > 0 {
+			sb.WriteString(", ")
+		}
+		sb.WriteByte('(')
+		for j, v := range p.values {
+			if j > 0 {
+				sb.WriteString(", ")
+			}
+			args = append(args, dialect.BindArg(im.drv, len(args)+1, v))
+			sb.WriteString(dialect.Placeholder(im.drv, len(args)))
+		}
+		sb.WriteByte(')')
+	}
+	if upsert {
+		sb.WriteString(im.upsertClause(names))
+	}
+	_, err := im.tx.ExecContext(im.ctx, sb.String(), args...)
+	return err
+}
+
+// upsertClause finishes an INSERT (a MERGE on SQL Server) so that rows whose
+// key exists update the other columns instead
+func (im *importer) upsertClause(names []string) string {
+	keys, updates := []string{}, []string{}
+	for i, c := range im.columns {
+		if slices.Contains(im.key, c) {
+			keys = append(keys, names[i])
+		} else {
+			updates = append(updates, names[i])
+		}
+	}
+
+	set := make([]string, len(updates))
+	switch im.drv {
+	case constants.DriverMySQL:
+		for i, n := range updates {
+			set[i] = n + " = VALUES(" + n + ")"
+		}
+		if len(set) == 0 {
+			set = []string{keys[0] + " = " + keys[0]}
+		}
+		return " ON DUPLICATE KEY UPDATE " + strings.Join(set, ", ")
+	case constants.DriverSQLServer:
+		on := make([]string, len(keys))
+		for i, n := range keys {
+			on[i] = "target." + n + " = source." + n
+		}
+		sources := make([]string, len(names))
+		for i, n := range names {
+			sources[i] = "source." + n
+		}
+		clause := ") AS source (" + strings.Join(names, ", ") + ") ON " + strings.Join(on, " AND ")
+		if len(updates) > 0 {
+			for i, n := range updates {
+				set[i] = "target." + n + " = source." + n
+			}
+			clause += " WHEN MATCHED THEN UPDATE SET " + strings.Join(set, ", ")
+		}
+		return clause + " WHEN NOT MATCHED THEN INSERT (" + strings.Join(names, ", ") + ") VALUES (" + strings.Join(sources, ", ") + ");"
+	default:
+		if len(updates) == 0 {
+			return " ON CONFLICT (" + strings.Join(keys, ", ") + ") DO NOTHING"
+		}
+		for i, n := range updates {
+			set[i] = n + " = excluded." + n
+		}
+		return " ON CONFLICT (" + strings.Join(keys, ", ") + ") DO UPDATE SET " + strings.Join(set, ", ")
+	}
+}
+
+func (im *importer) tableName() string {
+	schema := im.table.Schema
+	if im.drv == constants.DriverSQLite {
+		schema = ""
+	}
+	return dialect.QualifiedName(im.drv, schema, im.table.Name)
+}
+
+// savepoint runs fn so that a failure only undoes fn's own work and leaves the
+// transaction usable (PostgreSQL aborts the whole transaction otherwise)
+func (im *importer) savepoint(fn func() error) error {
+	im.sp++
+	name := fmt.Sprintf("wb_import_%d", im.sp)
+	set, rollback, release := "SAVEPOINT "+name, "ROLLBACK TO SAVEPOINT "+name, "RELEASE SAVEPOINT "+name
+	if im.drv == constants.DriverSQLServer {
+		set, rollback, release = "SAVE TRANSACTION "+name, "ROLLBACK TRANSACTION "+name, ""
+	}
+
+	if _, err := im.tx.ExecContext(im.ctx, set); err != nil {
+		return err
+	}
+	if err := fn(); err != nil {
+		if _, rbErr := im.tx.ExecContext(im.ctx, rollback); rbErr != nil {
+			return fmt.Errorf("%v (rollback failed: %v)", err, rbErr)
+		}
+		return err
+	}
+	if release != "" {
+		if _, err := im.tx.ExecContext(im.ctx, release); err != nil {
+			return err
+		}
+	}
+	return nil
+}
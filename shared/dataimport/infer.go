@@ -0,0 +1,143 @@
+package dataimport
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/dracory/weebase/shared/dialect"
+)
+
+// InferredColumn is a column type guessed from sampled values
+type InferredColumn struct {
+	Name string `json:"name"`
+	// Canonical is the dialect neutral type family, see dialect.CanonicalType
+	Canonical string `json:"canonical"`
+	// Type is Canonical spelled for the target driver
+	Type     string `json:"type"`
+	Nullable bool   `json:"nullable"`
+}
+
+// InferColumns guesses a column type for every header from the sampled rows.
+// Empty values make a column nullable and are otherwise ignored; numbers with
+// leading zeros stay text so codes like zip numbers keep their zeros.
+func InferColumns(drv string, headers []string, rows [][]string) []InferredColumn {
+	columns := make([]InferredColumn, len(headers))
+	for i, name := range headers {
+		values := []string{}
+		nullable := false
+		for _, row := range rows {
+			if i >= len(row) || strings.TrimSpace(row[i]) == "" {
+				nullable = true
+				continue
+			}
+			values = append(values, strings.TrimSpace(row[i]))
+		}
+		canonical := inferType(values)
+		columns[i] = InferredColumn{
+			Name:      name,
+			Canonical: canonical,
+			Type:      dialect.RenderType(drv, canonical),
+			Nullable:  nullable || len(values) == 0,
+		}
+	}
+	return columns
+}
+
+func inferType(values []string) string {
+	if len(values) == 0 {
+		return dialect.TypeText
+	}
+	checks := []struct {
+		family string
+		match  func(string) bool
+	}{
+		{dialect.TypeInteger, func(s string) bool { n, ok := parseInt(s); return ok && n >= -1<<31 && n < 1<<31 }},
+		{dialect.TypeBigInt, func(s string) bool { _, ok := parseInt(s); return ok }},
+		{dialect.TypeBoolean, isBoolWord},
+		{dialect.TypeDate, func(s string) bool { return parsesAs(s, "2006-01-02") }},
+		{dialect.TypeTimestamp, func(s string) bool {
+			return parsesAs(s, "2006-01-02 15:04:05.999999999", "2006-01-02T15:04:05.999999999", "2006-01-02 15:04")
+		}},
+		{dialect.TypeTimestampTZ, func(s string) bool { return parsesAs(s, time.RFC3339Nano, "2006-01-02 15:04:05.999999999Z07:00") }},
+	}
+	for _, c := range checks {
+		if all(values, c.match) {
+			return c.family
+		}
+	}
+	if family, ok := inferDecimal(values); ok {
+		return family
+	}
+
+	longest := 0
+	for _, v := range values {
+		longest = max(longest, utf8.RuneCountInString(v))
+	}
+	if longest > 255 {
+		return dialect.TypeText
+	}
+	return dialect.TypeVarchar + "(255)"
+}
+
+// inferDecimal sizes a decimal type to fit every value; exponents make it a double
+func inferDecimal(values []string) (string, bool) {
+	digits, scale := 0, 0
+	for _, v := range values {
+		if _, err := strconv.ParseFloat(v, 64); err != nil || hasLeadingZero(v) {
+			return "", false
+		}
+		if strings.ContainsAny(v, "eE") {
+			return dialect.TypeDouble, true
+		}
+		whole, frac, _ := strings.Cut(strings.TrimLeft(v, "+-"), ".")
+		digits = max(digits, len(whole))
+		scale = max(scale, len(frac))
+	}
+	if digits+scale > 38 {
+		return dialect.TypeDouble, true
+	}
+	return fmt.Sprintf("%s(%d,%d)", dialect.TypeDecimal, max(18, digits+scale), scale), true
+}
+
+func parseInt(s string) (int64, bool) {
+	if hasLeadingZero(s) {
+		return 0, false
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	return n, err == nil
+}
+
+func hasLeadingZero(s string) bool {
+	s = strings.TrimLeft(s, "+-")
+	return len(s) > 1 && s[0] == '0' && s[1] != '.'
+}
+
+// isBoolWord leaves 0 and 1 out; a column of those is more likely a number
+func isBoolWord(s string) bool {
+	switch strings.ToLower(s) {
+	case "true", "false", "yes", "no", "t", "f", "y", "n":
+		return true
+	}
+	return false
+}
+
+func parsesAs(s string, layouts ...string) bool {
+	for _, layout := range layouts {
+		if _, err := time.Parse(layout, s); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+func all(values []string, match func(string) bool) bool {
+	for _, v := range values {
+		if !match(v) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,133 @@
+package dataimport
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// Formats understood by NewReader
+const (
+	FormatJSON   = "json"
+	FormatNDJSON = "ndjson"
+	FormatCSV    = "csv"
+)
+
+// NewReader creates a Reader for an input format; CSV is read with
+// DefaultCSVOptions, use NewCSVReader for anything else
+func NewReader(format string, r io.Reader) (Reader, error) {
+	switch format {
+	case FormatJSON, FormatNDJSON:
+		return NewJSONReader(r)
+	case FormatCSV:
+		return NewCSVReader(r, DefaultCSVOptions())
+	}
+	return nil, fmt.Errorf("unsupported import format: %s", format)
+}
+
+type jsonReader struct {
+	r     *bufio.Reader
+	dec   *json.Decoder
+	array bool
+	done  bool
+}
+
+// NewJSONReader reads records from a JSON array of objects or from
+// newline-delimited JSON, telling them apart by the first character.
+// Numbers are kept as json.Number so large integers survive.
+func NewJSONReader(r io.Reader) (Reader, error) {
+	br := bufio.NewReader(r)
+	// skip a UTF-8 byte order mark and leading whitespace
+	if bom, err := br.Peek(3); err == nil && bytes.Equal(bom, []byte("\xEF\xBB\xBF")) {
+		br.Discard(3)
+	}
+	for {
+		b, err := br.Peek(1)
+		if err == io.EOF {
+			return &jsonReader{done: true}, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if !bytes.ContainsAny(b, " \t\r\n") {
+			break
+		}
+		br.Discard(1)
+	}
+
+	jr := &jsonReader{r: br}
+	if b, _ := br.Peek(1); b[0] == '[' {
+		jr.array = true
+		jr.dec = json.NewDecoder(br)
+		jr.dec.UseNumber()
+		if _, err := jr.dec.Token(); err != nil {
+			return nil, fmt.Errorf("invalid JSON: %v", err)
+		}
+	}
+	return jr, nil
+}
+
+func (jr *jsonReader) Next() (Record, error) {
+	if jr.done {
+		return nil, io.EOF
+	}
+	if jr.array {
+		return jr.nextElement()
+	}
+	return jr.nextLine()
+}
+
+func (jr *jsonReader) nextElement() (Record, error) {
+	if !jr.dec.More() {
+		jr.done = true
+		if _, err := jr.dec.Token(); err != nil {
+			return nil, fmt.Errorf("invalid JSON: %v", err)
+		}
+		return nil, io.EOF
+	}
+	var v any
+	if err := jr.dec.Decode(&v); err != nil {
+		// the decoder cannot resynchronise inside an array
+		return nil, fmt.Errorf("invalid JSON: %v", err)
+	}
+	return toRecord(v)
+}
+
+func (jr *jsonReader) nextLine() (Record, error) {
+	for {
+		line, err := jr.r.ReadBytes('\n')
+		if err == io.EOF {
+			jr.done = true
+			if len(bytes.TrimSpace(line)) == 0 {
+				return nil, io.EOF
+			}
+		} else if err != nil {
+			return nil, err
+		}
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+
+		dec := json.NewDecoder(bytes.NewReader(line))
+		dec.UseNumber()
+		var v any
+		if err := dec.Decode(&v); err != nil {
+			return nil, &RowError{Message: "invalid JSON: " + err.Error()}
+		}
+		if dec.More() {
+			return nil, &RowError{Message: "invalid JSON: more than one value on the line"}
+		}
+		return toRecord(v)
+	}
+}
+
+func toRecord(v any) (Record, error) {
+	obj, ok := v.(map[string]any)
+	if !ok {
+		return nil, &RowError{Message: "expected a JSON object, got " + describe(v)}
+	}
+	return Record(obj), nil
+}
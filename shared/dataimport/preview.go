@@ -0,0 +1,94 @@
+package dataimport
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+)
+
+// InferRows is how many rows are sampled to infer column types
+const InferRows = 1000
+
+// Preview describes the start of an import file
+type Preview struct {
+	Format string `json:"format"`
+	// Delimiter is the CSV delimiter in use, detected or given
+	Delimiter string     `json:"delimiter,omitempty"`
+	Headers   []string   `json:"headers"`
+	Rows      [][]string `json:"rows"`
+	// Columns holds a type per header inferred from up to InferRows rows
+	Columns []InferredColumn `json:"columns"`
+}
+
+// NewPreview reads the first rows of r, returning up to show of them as text
+// along with the column types inferred for drv. JSON fields are listed in
+// the order they first appear, sorted within each record.
+func NewPreview(drv, format string, r io.Reader, opts CSVOptions, show int) (Preview, error) {
+	p := Preview{Format: format, Headers: []string{}, Rows: [][]string{}}
+	rows := [][]string{}
+
+	switch format {
+	case FormatCSV:
+		cr, err := NewCSVReader(r, opts)
+		if err != nil {
+			return p, err
+		}
+		p.Delimiter = string(cr.Delimiter())
+		p.Headers = cr.Headers()
+		for len(rows) < InferRows {
+			line, err := cr.Line()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return p, err
+			}
+			rows = append(rows, line)
+		}
+	case FormatJSON, FormatNDJSON:
+		jr, err := NewJSONReader(r)
+		if err != nil {
+			return p, err
+		}
+		records := []Record{}
+		for len(records) < InferRows {
+			record, err := jr.Next()
+			if err == io.EOF {
+				break
+			}
+			var rowErr *RowError
+			if errors.As(err, &rowErr) {
+				continue
+			}
+			if err != nil {
+				return p, err
+			}
+			records = append(records, record)
+			fields := make([]string, 0, len(record))
+			for field := range record {
+				if !slices.Contains(p.Headers, field) {
+					fields = append(fields, field)
+				}
+			}
+			sort.Strings(fields)
+			p.Headers = append(p.Headers, fields...)
+		}
+		for _, record := range records {
+			row := make([]string, len(p.Headers))
+			for i, field := range p.Headers {
+				if v := record[field]; v != nil {
+					row[i], _ = toText(v)
+				}
+			}
+			rows = append(rows, row)
+		}
+	default:
+		return p, fmt.Errorf("unsupported import format: %s", format)
+	}
+
+	p.Columns = InferColumns(drv, p.Headers, rows)
+	p.Rows = rows[:min(show, len(rows))]
+	return p, nil
+}
@@ -0,0 +1,379 @@
+// Package ddl renders CREATE/ALTER/DROP statements from introspected
+// structures, translating column types when source and target dialects differ.
+package ddl
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/dracory/weebase/shared/constants"
+	"github.com/dracory/weebase/shared/dialect"
+	"github.com/dracory/weebase/shared/introspect"
+)
+
+// Builder emits SQL in the To dialect for structures read from the From dialect
+type Builder struct {
+	From string
+	To   string
+}
+
+// New creates a Builder translating from one driver to another.
+// Pass the same driver twice to emit SQL for the database the structures came from.
+func New(from, to string) Builder {
+	return Builder{From: dialect.Normalize(from), To: dialect.Normalize(to)}
+}
+
+// SameDialect reports whether no type translation takes place
+func (b Builder) SameDialect() bool {
+	return b.From == b.To
+}
+
+func (b Builder) quote(ident string) string {
+	return dialect.QuoteIdent(b.To, ident)
+}
+
+func (b Builder) name(schema, name string) string {
+	if b.To == constants.DriverSQLite {
+		schema = ""
+	}
+	return dialect.QualifiedName(b.To, schema, name)
+}
+
+func (b Builder) quoteList(idents []string) string {
+	quoted := make([]string, len(idents))
+	for i, ident := range idents {
+		quoted[i] = b.quote(ident)
+	}
+	return strings.Join(quoted, ", ")
+}
+
+// ColumnType returns the column's type spelled for the target dialect
+func (b Builder) ColumnType(c introspect.Column) string {
+	return dialect.MapType(b.From, b.To, c.Type)
+}
+
+// ColumnDefinition renders "name type [identity] [NOT NULL] [DEFAULT ...]".
+// Auto-increment columns are rendered with the target's identity syntax;
+// on SQLite the caller gets "INTEGER PRIMARY KEY AUTOINCREMENT" when inlinePK is set.
+func (b Builder) ColumnDefinition(c introspect.Column, inlinePK bool) string {
+	typ := b.ColumnType(c)
+	parts := []string{b.quote(c.Name)}
+
+	if c.AutoIncrement {
+		switch b.To {
+		case constants.DriverPostgres:
+			parts = append(parts, typ, "GENERATED BY DEFAULT AS IDENTITY")
+		case constants.DriverMySQL:
+			parts = append(parts, typ, "AUTO_INCREMENT")
+		case constants.DriverSQLServer:
+			parts = append(parts, typ, "IDENTITY(1,1)")
+		case constants.DriverSQLite:
+			if inlinePK {
+				return b.quote(c.Name) + " INTEGER PRIMARY KEY AUTOINCREMENT"
+			}
+			parts = append(parts, typ)
+		}
+	} else {
+		parts = append(parts, typ)
+	}
+
+	if !c.Nullable {
+		parts = append(parts, "NOT NULL")
+	}
+	if !c.AutoIncrement && c.Default != nil {
+		if def, ok := b.portableDefault(*c.Default); ok {
+			parts = append(parts, "DEFAULT "+def)
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+var (
+	numericLiteral = regexp.MustCompile(`^-?\d+(\.\d+)?$`)
+	stringLiteral  = regexp.MustCompile(`^'(?:[^']|'')*'$`)
+	pgCast         = regexp.MustCompile(`::[a-zA-Z ]+(\(\d+(,\d+)?\))?(\[\])?$`)
+)
+
+// portableDefault returns a default expression usable in the target dialect.
+// Expressions are kept verbatim within one dialect; across dialects only
+// literals and the current timestamp survive.
+func (b Builder) portableDefault(def string) (string, bool) {
+	def = strings.TrimSpace(def)
+	if def == "" || strings.EqualFold(def, "NULL") {
+		return "", false
+	}
+	if b.SameDialect() {
+		return def, true
+	}
+
+	// SQL Server wraps defaults in parentheses, PostgreSQL appends casts
+	for strings.HasPrefix(def, "(") && strings.HasSuffix(def, ")") {
+		def = strings.TrimSpace(def[1 : len(def)-1])
+	}
+	def = pgCast.ReplaceAllString(def, "")
+
+	switch {
+	case numericLiteral.MatchString(def), stringLiteral.MatchString(def):
+		return def, true
+	case strings.EqualFold(def, "true"), strings.EqualFold(def, "false"):
+		if b.To == constants.DriverPostgres {
+			return strings.ToLower(def), true
+		}
+		if strings.EqualFold(def, "true") {
+			return "1", true
+		}
+		return "0", true
+	}
+
+	switch strings.ToLower(def) {
+	case "current_timestamp", "now()", "getdate()", "sysdatetime()", "current_timestamp()":
+		return "CURRENT_TIMESTAMP", true
+	}
+	return "", false
+}
+
+// CreateTable renders CREATE TABLE with columns, primary key, unique and
+// (same dialect only) check constraints. Foreign keys are left to AddConstraint
+// so tables can be created in any order, except on SQLite which cannot add
+// them later and gets them inline.
+func (b Builder) CreateTable(schema string, t introspect.Table) string {
+	pk := t.PrimaryKey()
+	inlinePK := b.To == constants.DriverSQLite && len(pk) == 1
+
+	lines := []string{}
+	inlined := false
+	for _, c := range t.Columns {
+		inline := inlinePK && c.Name == pk[0] && c.AutoIncrement
+		lines = append(lines, "  "+b.ColumnDefinition(c, inline))
+		inlined = inlined || inline
+	}
+
+	if len(pk) > 0 && !inlined {
+		lines = append(lines, "  PRIMARY KEY ("+b.quoteList(pk)+")")
+	}
+	for _, c := range t.Constraints {
+		switch c.Type {
+		case introspect.ConstraintUnique:
+			lines = append(lines, "  CONSTRAINT "+b.quote(c.Name)+" UNIQUE ("+b.quoteList(c.Columns)+")")
+		case introspect.ConstraintCheck:
+			if b.SameDialect() && c.Definition != "" {
+				lines = append(lines, "  CONSTRAINT "+b.quote(c.Name)+" "+checkClause(c.Definition))
+			}
+		case introspect.ConstraintForeignKey:
+			if b.To == constants.DriverSQLite {
+				lines = append(lines, "  "+b.foreignKeyClause(schema, c))
+			}
+		}
+	}
+
+	return "CREATE TABLE " + b.name(schema, t.Name) + " (\n" + strings.Join(lines, ",\n") + "\n)"
+}
+
+// checkClause accepts both "CHECK (expr)" (PostgreSQL) and "(expr)" (SQL Server)
+func checkClause(definition string) string {
+	if strings.HasPrefix(strings.ToUpper(strings.TrimSpace(definition)), "CHECK") {
+		return definition
+	}
+	return "CHECK " + definition
+}
+
+func (b Builder) foreignKeyClause(schema string, c introspect.Constraint) string {
+	refSchema := c.RefSchema
+	if refSchema == "" || !b.SameDialect() {
+		refSchema = schema
+	}
+	clause := "CONSTRAINT " + b.quote(c.Name) + " FOREIGN KEY (" + b.quoteList(c.Columns) + ") REFERENCES " + b.name(refSchema, c.RefTable)
+	if len(c.RefColumns) > 0 {
+		clause += " (" + b.quoteList(c.RefColumns) + ")"
+	}
+	if c.OnDelete != "" {
+		clause += " ON DELETE " + c.OnDelete
+	}
+	if c.OnUpdate != "" {
+		clause += " ON UPDATE " + c.OnUpdate
+	}
+	return clause
+}
+
+// DropTable renders DROP TABLE
+func (b Builder) DropTable(schema, table string) string {
+	return "DROP TABLE " + b.name(schema, table)
+}
+
+// DropTableIfExists renders DROP TABLE IF EXISTS. On PostgreSQL dependent
+// objects (foreign keys, views) are dropped with it.
+func (b Builder) DropTableIfExists(schema, table string) string {
+	stmt := "DROP TABLE IF EXISTS " + b.name(schema, table)
+	if b.To == constants.DriverPostgres {
+		stmt += " CASCADE"
+	}
+	return stmt
+}
+
+// AddColumn renders ALTER TABLE ... ADD COLUMN
+func (b Builder) AddColumn(schema, table string, c introspect.Column) string {
+	keyword := "ADD COLUMN "
+	if b.To == constants.DriverSQLServer {
+		keyword = "ADD "
+	}
+	return "ALTER TABLE " + b.name(schema, table) + " " + keyword + b.ColumnDefinition(c, false)
+}
+
+// DropColumn renders ALTER TABLE ... DROP COLUMN
+func (b Builder) DropColumn(schema, table, column string) string {
+	return "ALTER TABLE " + b.name(schema, table) + " DROP COLUMN " + b.quote(column)
+}
+
+// AlterColumn renders the statements that change a column's type, nullability
+// and default to match c. The second result is false when the target dialect
+// cannot alter columns in place (SQLite needs a table rebuild).
+func (b Builder) AlterColumn(schema, table string, c introspect.Column) ([]string, bool) {
+	tbl := b.name(schema, table)
+	col := b.quote(c.Name)
+	typ := b.ColumnType(c)
+
+	switch b.To {
+	case constants.DriverPostgres:
+		stmts := []string{fmt.Sprintf("ALTER TABLE %s ALTER COLUMN %s TYPE %s", tbl, col, typ)}
+		if c.Nullable {
+			stmts = append(stmts, fmt.Sprintf("ALTER TABLE %s ALTER COLUMN %s DROP NOT NULL", tbl, col))
+		} else {
+			stmts = append(stmts, fmt.Sprintf("ALTER TABLE %s ALTER COLUMN %s SET NOT NULL", tbl, col))
+		}
+		if def, ok := b.columnDefault(c); ok {
+			stmts = append(stmts, fmt.Sprintf("ALTER TABLE %s ALTER COLUMN %s SET DEFAULT %s", tbl, col, def))
+		} else if !c.AutoIncrement {
+			stmts = append(stmts, fmt.Sprintf("ALTER TABLE %s ALTER COLUMN %s DROP DEFAULT", tbl, col))
+		}
+		return stmts, true
+	case constants.DriverMySQL:
+		return []string{fmt.Sprintf("ALTER TABLE %s MODIFY COLUMN %s", tbl, b.ColumnDefinition(c, false))}, true
+	case constants.DriverSQLServer:
+		null := "NULL"
+		if !c.Nullable {
+			null = "NOT NULL"
+		}
+		// defaults are separate constraints on SQL Server and are left alone here
+		return []string{fmt.Sprintf("ALTER TABLE %s ALTER COLUMN %s %s %s", tbl, col, typ, null)}, true
+	}
+	return nil, false
+}
+
+func (b Builder) columnDefault(c introspect.Column) (string, bool) {
+	if c.AutoIncrement || c.Default == nil {
+		return "", false
+	}
+	return b.portableDefault(*c.Default)
+}
+
+// CreateIndex renders CREATE [UNIQUE] INDEX. Primary key indexes are skipped
+// (they come with the PRIMARY KEY constraint) and yield an empty string.
+func (b Builder) CreateIndex(schema, table string, ix introspect.Index) string {
+	if ix.Primary || len(ix.Columns) == 0 {
+		return ""
+	}
+	unique := ""
+	if ix.Unique {
+		unique = "UNIQUE "
+	}
+	return "CREATE " + unique + "INDEX " + b.quote(ix.Name) + " ON " + b.name(schema, table) + " (" + b.quoteList(ix.Columns) + ")"
+}
+
+// DropIndex renders DROP INDEX in the target dialect's form
+func (b Builder) DropIndex(schema, table, index string) string {
+	switch b.To {
+	case constants.DriverMySQL, constants.DriverSQLServer:
+		return "DROP INDEX " + b.quote(index) + " ON " + b.name(schema, table)
+	case constants.DriverPostgres:
+		return "DROP INDEX " + b.name(schema, index)
+	default:
+		return "DROP INDEX " + b.quote(index)
+	}
+}
+
+// AddConstraint renders ALTER TABLE ... ADD CONSTRAINT. The second result is
+// false on SQLite, which only accepts constraints in CREATE TABLE.
+func (b Builder) AddConstraint(schema, table string, c introspect.Constraint) (string, bool) {
+	if b.To == constants.DriverSQLite {
+		return "", false
+	}
+
+	prefix := "ALTER TABLE " + b.name(schema, table) + " ADD "
+	switch c.Type {
+	case introspect.ConstraintPrimaryKey:
+		return prefix + "CONSTRAINT " + b.quote(c.Name) + " PRIMARY KEY (" + b.quoteList(c.Columns) + ")", true
+	case introspect.ConstraintUnique:
+		return prefix + "CONSTRAINT " + b.quote(c.Name) + " UNIQUE (" + b.quoteList(c.Columns) + ")", true
+	case introspect.ConstraintForeignKey:
+		return prefix + b.foreignKeyClause(schema, c), true
+	case introspect.ConstraintCheck:
+		if !b.SameDialect() || c.Definition == "" {
+			return "", false
+		}
+		return prefix + "CONSTRAINT " + b.quote(c.Name) + " " + checkClause(c.Definition), true
+	}
+	return "", false
+}
+
+// DropConstraint renders the statement removing a constraint; false on SQLite
+func (b Builder) DropConstraint(schema, table string, c introspect.Constraint) (string, bool) {
+	tbl := b.name(schema, table)
+	switch b.To {
+	case constants.DriverSQLite:
+		return "", false
+	case constants.DriverMySQL:
+		switch c.Type {
+		case introspect.ConstraintPrimaryKey:
+			return "ALTER TABLE " + tbl + " DROP PRIMARY KEY", true
+		case introspect.ConstraintForeignKey:
+			return "ALTER TABLE " + tbl + " DROP FOREIGN KEY " + b.quote(c.Name), true
+		case introspect.ConstraintUnique:
+			return "ALTER TABLE " + tbl + " DROP INDEX " + b.quote(c.Name), true
+		default:
+			return "ALTER TABLE " + tbl + " DROP CHECK " + b.quote(c.Name), true
+		}
+	}
+	return "ALTER TABLE " + tbl + " DROP CONSTRAINT " + b.quote(c.Name), true
+}
+
+// CreateView renders CREATE VIEW (or CREATE MATERIALIZED VIEW on PostgreSQL)
+func (b Builder) CreateView(schema, view, definition string, materialized bool) string {
+	definition = strings.TrimRight(strings.TrimSpace(definition), ";")
+	kind := "VIEW "
+	if materialized && b.To == constants.DriverPostgres {
+		kind = "MATERIALIZED VIEW "
+	}
+	return "CREATE " + kind + b.name(schema, view) + " AS\n" + definition
+}
+
+// DropView renders DROP VIEW (or DROP MATERIALIZED VIEW on PostgreSQL)
+func (b Builder) DropView(schema, view string, materialized bool) string {
+	if materialized && b.To == constants.DriverPostgres {
+		return "DROP MATERIALIZED VIEW " + b.name(schema, view)
+	}
+	return "DROP VIEW " + b.name(schema, view)
+}
+
+// DropViewIfExists renders DROP [MATERIALIZED] VIEW IF EXISTS
+func (b Builder) DropViewIfExists(schema, view string, materialized bool) string {
+	return strings.Replace(b.DropView(schema, view, materialized), "VIEW ", "VIEW IF EXISTS ", 1)
+}
+
+// Script joins statements into a runnable script, one statement per paragraph.
+// Lines starting with "--" are emitted as comments without a terminator.
+func Script(stmts []string) string {
+	var sb strings.Builder
+	for _, s := range stmts {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		sb.WriteString(s)
+		if !strings.HasPrefix(s, "--") {
+			sb.WriteString(";")
+		}
+		sb.WriteString("\n\n")
+	}
+	return sb.String()
+}
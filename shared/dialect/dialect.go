@@ -0,0 +1,89 @@
+package dialect
+
+import (
+	"database/sql"
+	"strconv"
+	"strings"
+
+	"github.com/dracory/weebase/shared/constants"
+)
+
+// Normalize maps driver aliases (e.g. "pg", "sqlite3", "mssql") to the
+// canonical driver names declared in the constants package.
+func Normalize(driver string) string {
+	switch strings.ToLower(driver) {
+	case "postgres", "pg", "postgresql":
+		return constants.DriverPostgres
+	case "mysql", "mariadb":
+		return constants.DriverMySQL
+	case "sqlite", "sqlite3":
+		return constants.DriverSQLite
+	case "sqlserver", "mssql":
+		return constants.DriverSQLServer
+	default:
+		return strings.ToLower(driver)
+	}
+}
+
+// QuoteIdent quotes a (possibly schema-qualified) identifier for the given dialect.
+func QuoteIdent(driver, ident string) string {
+	parts := strings.Split(ident, ".")
+	for i, p := range parts {
+		switch Normalize(driver) {
+		case constants.DriverMySQL:
+			parts[i] = "`" + strings.ReplaceAll(p, "`", "``") + "`"
+		case constants.DriverPostgres, constants.DriverSQLite:
+			parts[i] = `"` + strings.ReplaceAll(p, `"`, `""`) + `"`
+		case constants.DriverSQLServer:
+			parts[i] = "[" + strings.ReplaceAll(p, "]", "]]") + "]"
+		}
+	}
+	return strings.Join(parts, ".")
+}
+
+// QualifiedName joins schema and name and quotes the result.
+// An empty schema yields just the quoted name.
+func QualifiedName(driver, schema, name string) string {
+	if schema == "" {
+		return QuoteIdent(driver, name)
+	}
+	return QuoteIdent(driver, schema) + "." + QuoteIdent(driver, name)
+}
+
+// SanitizeIdent checks if an identifier contains only safe characters
+func SanitizeIdent(s string) bool {
+	return s != "" && !strings.ContainsAny(s, " ;'\"`")
+}
+
+// DefaultSchema returns the schema assumed when none is given.
+// MySQL and SQLite have no separate schema namespace, so an empty string is returned.
+func DefaultSchema(driver string) string {
+	switch Normalize(driver) {
+	case constants.DriverPostgres:
+		return "public"
+	case constants.DriverSQLServer:
+		return "dbo"
+	default:
+		return ""
+	}
+}
+
+// Placeholder returns the n-th (1-based) bind parameter marker of the dialect
+func Placeholder(driver string, n int) string {
+	switch Normalize(driver) {
+	case constants.DriverPostgres:
+		return "$" + strconv.Itoa(n)
+	case constants.DriverSQLServer:
+		return "@p" + strconv.Itoa(n)
+	default:
+		return "?"
+	}
+}
+
+// BindArg wraps the n-th argument so it matches Placeholder; SQL Server binds by name
+func BindArg(driver string, n int, value any) any {
+	if Normalize(driver) == constants.DriverSQLServer {
+		return sql.Named("p"+strconv.Itoa(n), value)
+	}
+	return value
+}
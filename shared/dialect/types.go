@@ -0,0 +1,246 @@
+package dialect
+
+import (
+	"strings"
+
+	"github.com/dracory/weebase/shared/constants"
+)
+
+// Canonical type families used to translate column types between dialects.
+// Parameterised families carry their arguments, e.g. "varchar(255)" or "decimal(10,2)".
+const (
+	TypeInteger     = "integer"
+	TypeBigInt      = "bigint"
+	TypeSmallInt    = "smallint"
+	TypeBoolean     = "boolean"
+	TypeDecimal     = "decimal"
+	TypeReal        = "real"
+	TypeDouble      = "double"
+	TypeVarchar     = "varchar"
+	TypeChar        = "char"
+	TypeText        = "text"
+	TypeDate        = "date"
+	TypeTime        = "time"
+	TypeTimestamp   = "timestamp"
+	TypeTimestampTZ = "timestamptz"
+	TypeBlob        = "blob"
+	TypeJSON        = "json"
+	TypeUUID        = "uuid"
+)
+
+// splitType splits "numeric(10, 2) unsigned" into "numeric" and "10,2"
+func splitType(typ string) (string, string) {
+	t := strings.ToLower(strings.TrimSpace(typ))
+	args := ""
+	if open := strings.Index(t, "("); open >= 0 {
+		if end := strings.Index(t[open:], ")"); end > 0 {
+			args = strings.ReplaceAll(t[open+1:open+end], " ", "")
+			t = t[:open] + t[open+end+1:]
+		}
+	}
+	t = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(t), "unsigned"))
+	return strings.Join(strings.Fields(t), " "), args
+}
+
+// CanonicalType maps a driver-specific column type to a canonical family.
+// Types without a portable equivalent (arrays, enums, geometry, ...) map to text.
+func CanonicalType(driver, typ string) string {
+	if strings.HasSuffix(strings.TrimSpace(typ), "[]") {
+		return TypeText
+	}
+	base, args := splitType(typ)
+
+	switch base {
+	case "int", "integer", "int4", "mediumint", "serial", "serial4":
+		return TypeInteger
+	case "bigint", "int8", "bigserial", "serial8":
+		return TypeBigInt
+	case "smallint", "int2", "smallserial", "year":
+		return TypeSmallInt
+	case "tinyint":
+		if Normalize(driver) == constants.DriverMySQL && args == "1" {
+			return TypeBoolean
+		}
+		return TypeSmallInt
+	case "bool", "boolean", "bit":
+		if base == "bit" && args != "" && args != "1" {
+			return TypeBlob
+		}
+		return TypeBoolean
+	case "decimal", "numeric", "money", "smallmoney", "number":
+		if args == "" {
+			return TypeDecimal
+		}
+		return TypeDecimal + "(" + args + ")"
+	case "real", "float4":
+		return TypeReal
+	case "float", "double", "double precision", "float8":
+		return TypeDouble
+	case "varchar", "character varying", "nvarchar", "varchar2", "nvarchar2", "varying character", "national varchar":
+		if args == "" || args == "max" {
+			return TypeText
+		}
+		return TypeVarchar + "(" + args + ")"
+	case "char", "character", "nchar", "bpchar", "native character":
+		if args == "" {
+			args = "1"
+		}
+		return TypeChar + "(" + args + ")"
+	case "text", "tinytext", "mediumtext", "longtext", "ntext", "clob", "citext", "xml", "enum", "set":
+		return TypeText
+	case "date":
+		return TypeDate
+	case "time", "time without time zone", "timetz", "time with time zone":
+		return TypeTime
+	case "timestamp", "timestamp without time zone", "datetime", "datetime2", "smalldatetime":
+		return TypeTimestamp
+	case "timestamptz", "timestamp with time zone", "datetimeoffset":
+		return TypeTimestampTZ
+	case "bytea", "blob", "tinyblob", "mediumblob", "longblob", "binary", "varbinary", "image":
+		return TypeBlob
+	case "json", "jsonb":
+		return TypeJSON
+	case "uuid", "uniqueidentifier":
+		return TypeUUID
+	}
+
+	if Normalize(driver) == constants.DriverSQLite {
+		return sqliteAffinity(base)
+	}
+	return TypeText
+}
+
+// sqliteAffinity applies SQLite's column affinity rules to free-form declared types
+func sqliteAffinity(base string) string {
+	switch {
+	case base == "":
+		return TypeBlob
+	case strings.Contains(base, "int"):
+		return TypeInteger
+	case strings.Contains(base, "char"), strings.Contains(base, "clob"), strings.Contains(base, "text"):
+		return TypeText
+	case strings.Contains(base, "blob"):
+		return TypeBlob
+	case strings.Contains(base, "real"), strings.Contains(base, "floa"), strings.Contains(base, "doub"):
+		return TypeDouble
+	default:
+		return TypeDecimal
+	}
+}
+
+// RenderType spells a canonical type family in the given dialect
+func RenderType(driver, canonical string) string {
+	base, args := splitType(canonical)
+	withArgs := func(name, fallback string) string {
+		if args == "" {
+			args = fallback
+		}
+		if args == "" {
+			return name
+		}
+		return name + "(" + args + ")"
+	}
+
+	switch Normalize(driver) {
+	case constants.DriverPostgres:
+		switch base {
+		case TypeBoolean:
+			return "boolean"
+		case TypeDecimal:
+			return withArgs("numeric", "")
+		case TypeDouble:
+			return "double precision"
+		case TypeVarchar:
+			return withArgs("varchar", "255")
+		case TypeChar:
+			return withArgs("char", "1")
+		case TypeBlob:
+			return "bytea"
+		case TypeJSON:
+			return "jsonb"
+		case TypeInteger, TypeBigInt, TypeSmallInt, TypeReal, TypeText, TypeDate, TypeTime, TypeTimestamp, TypeTimestampTZ, TypeUUID:
+			return base
+		}
+	case constants.DriverMySQL:
+		switch base {
+		case TypeInteger:
+			return "int"
+		case TypeBoolean:
+			return "tinyint(1)"
+		case TypeDecimal:
+			return withArgs("decimal", "65,30")
+		case TypeReal:
+			return "float"
+		case TypeVarchar:
+			return withArgs("varchar", "255")
+		case TypeChar:
+			return withArgs("char", "1")
+		case TypeText, TypeJSON:
+			return "longtext"
+		case TypeTimestamp, TypeTimestampTZ:
+			return "datetime"
+		case TypeBlob:
+			return "longblob"
+		case TypeUUID:
+			return "char(36)"
+		case TypeBigInt, TypeSmallInt, TypeDouble, TypeDate, TypeTime:
+			return base
+		}
+	case constants.DriverSQLite:
+		switch base {
+		case TypeInteger, TypeBigInt, TypeSmallInt, TypeBoolean:
+			return "INTEGER"
+		case TypeDecimal:
+			return "NUMERIC"
+		case TypeReal, TypeDouble:
+			return "REAL"
+		case TypeDate:
+			return "DATE"
+		case TypeTimestamp, TypeTimestampTZ:
+			return "DATETIME"
+		case TypeBlob:
+			return "BLOB"
+		case TypeVarchar:
+			return withArgs("VARCHAR", "255")
+		default:
+			return "TEXT"
+		}
+	case constants.DriverSQLServer:
+		switch base {
+		case TypeInteger:
+			return "int"
+		case TypeBoolean:
+			return "bit"
+		case TypeDecimal:
+			return withArgs("decimal", "38,10")
+		case TypeDouble:
+			return "float"
+		case TypeVarchar:
+			return withArgs("nvarchar", "255")
+		case TypeChar:
+			return withArgs("nchar", "1")
+		case TypeText, TypeJSON:
+			return "nvarchar(max)"
+		case TypeTimestamp:
+			return "datetime2"
+		case TypeTimestampTZ:
+			return "datetimeoffset"
+		case TypeBlob:
+			return "varbinary(max)"
+		case TypeUUID:
+			return "uniqueidentifier"
+		case TypeBigInt, TypeSmallInt, TypeReal, TypeDate, TypeTime:
+			return base
+		}
+	}
+	return canonical
+}
+
+// MapType translates a column type from one dialect to another.
+// Types are returned unchanged when both drivers are the same dialect.
+func MapType(from, to, typ string) string {
+	if Normalize(from) == Normalize(to) {
+		return typ
+	}
+	return RenderType(to, CanonicalType(from, typ))
+}
@@ -1,9 +1,12 @@
 package driver
 
 import (
+	"context"
+	"database/sql"
 	"errors"
 	"fmt"
 
+	"github.com/dracory/weebase/shared/secrets"
 	"gorm.io/driver/mysql"
 	"gorm.io/driver/postgres"
 	"gorm.io/driver/sqlite"
@@ -49,3 +52,23 @@ func OpenDBWithDSN(driver, dsn string) (*gorm.DB, error) {
 		return nil, fmt.Errorf("unsupported driver: %s", driver)
 	}
 }
+
+// OpenSQLDB opens a database connection and returns the underlying *sql.DB.
+// The caller is responsible for closing it.
+func OpenSQLDB(driver, dsn string) (*sql.DB, error) {
+	db, err := OpenDBWithDSN(driver, dsn)
+	if err != nil {
+		return nil, err
+	}
+	return db.DB()
+}
+
+// OpenSQLDBWithSecrets resolves the secret references of a server-configured
+// DSN with r and opens it like OpenSQLDB
+func OpenSQLDBWithSecrets(ctx context.Context, r secrets.Resolver, driver, dsn string) (*sql.DB, error) {
+	dsn, err := secrets.Expand(ctx, r, driver, dsn)
+	if err != nil {
+		return nil, err
+	}
+	return OpenSQLDB(driver, dsn)
+}
@@ -0,0 +1,376 @@
+// Package dump writes a portable SQL script with the structure and data of a
+// database, or of selected tables, streaming rows straight from the cursor.
+package dump
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/dracory/weebase/shared/constants"
+	"github.com/dracory/weebase/shared/ddl"
+	"github.com/dracory/weebase/shared/dialect"
+	"github.com/dracory/weebase/shared/export"
+	"github.com/dracory/weebase/shared/introspect"
+)
+
+// Structure modes
+const (
+	// StructureDropCreate emits DROP ... IF EXISTS before every CREATE
+	StructureDropCreate = "drop_create"
+	// StructureCreate emits CREATE statements only
+	StructureCreate = "create"
+	// StructureNone leaves the structure out and dumps data only
+	StructureNone = "none"
+)
+
+// Options selects what goes into a dump
+type Options struct {
+	Schema string
+	// Tables limits the dump to these tables and views; empty means all of them
+	Tables []string
+	// NoData lists tables whose rows are left out
+	NoData    []string
+	Structure string
+	Data      bool
+	// BatchSize is the number of rows per INSERT statement
+	BatchSize int
+	// Progress, when set, is called as rows of a table are written
+	Progress func(table string, rows int64)
+	// Mask, when set, wraps the row writer of each table so sensitive
+	// columns are masked
+	Mask func(schema, table string, w export.RowWriter) export.RowWriter
+}
+
+// DefaultOptions dumps structure (with drops) and data of every table
+func DefaultOptions() Options {
+	return Options{Structure: StructureDropCreate, Data: true, BatchSize: export.DefaultBatchSize}
+}
+
+// Stats summarises a finished dump
+type Stats struct {
+	Tables int   `json:"tables"`
+	Views  int   `json:"views"`
+	Rows   int64 `json:"rows"`
+}
+
+// Dumper writes the dump of a set of tables and views described up front
+type Dumper struct {
+	db     *sql.DB
+	drv    string
+	schema string
+	opts   Options
+	tables []introspect.Table
+	views  []introspect.View
+}
+
+// Prepare introspects the objects selected by opts, failing early on unknown
+// tables so callers can report the error before any output is written.
+func Prepare(ctx context.Context, db *sql.DB, drv string, opts Options) (*Dumper, error) {
+	drv = dialect.Normalize(drv)
+	schema := opts.Schema
+	if schema == "" {
+		schema = dialect.DefaultSchema(drv)
+	}
+	if opts.Structure == "" {
+		opts.Structure = StructureDropCreate
+	}
+
+	tables, views, err := collect(ctx, db, drv, schema, opts.Tables)
+	if err != nil {
+		return nil, err
+	}
+	return &Dumper{
+		db:     db,
+		drv:    drv,
+		schema: schema,
+		opts:   opts,
+		tables: orderByDependencies(tables),
+		views:  views,
+	}, nil
+}
+
+// Write prepares and writes a dump in one go
+func Write(ctx context.Context, db *sql.DB, drv string, out io.Writer, opts Options) (Stats, error) {
+	d, err := Prepare(ctx, db, drv, opts)
+	if err != nil {
+		return Stats{}, err
+	}
+	return d.Write(ctx, out)
+}
+
+// Write dumps the prepared objects to out in this order: header settings,
+// DROP/CREATE TABLE, data as multi-row INSERTs, indexes, foreign keys and
+// finally views, so the script loads without tripping over constraints.
+func (d *Dumper) Write(ctx context.Context, out io.Writer) (Stats, error) {
+	db, drv, schema, opts := d.db, d.drv, d.schema, d.opts
+	tables, views := d.tables, d.views
+	stats := Stats{}
+
+	b := ddl.New(drv, drv)
+	bw := bufio.NewWriter(out)
+	emit := func(stmts ...string) error {
+		_, err := bw.WriteString(ddl.Script(stmts))
+		return err
+	}
+	structure := opts.Structure != StructureNone
+
+	header := []string{
+		"-- weebase SQL dump",
+		fmt.Sprintf("-- driver: %s", drv),
+		fmt.Sprintf("-- generated: %s", time.Now().UTC().Format(time.RFC3339)),
+	}
+	if schema != "" {
+		header = append(header, fmt.Sprintf("-- schema: %s", schema))
+	}
+	if err := emit(append(header, prologue(drv)...)...); err != nil {
+		return stats, err
+	}
+
+	if structure {
+		if opts.Structure == StructureDropCreate {
+			drops := []string{}
+			for _, v := range views {
+				drops = append(drops, b.DropViewIfExists(schema, v.Name, v.Materialized))
+			}
+			for i := len(tables) - 1; i >= 0; i-- {
+				drops = append(drops, b.DropTableIfExists(schema, tables[i].Name))
+			}
+			if err := emit(drops...); err != nil {
+				return stats, err
+			}
+		}
+		for _, t := range tables {
+			if err := emit(b.CreateTable(schema, t)); err != nil {
+				return stats, err
+			}
+		}
+	}
+
+	if opts.Data {
+		for _, t := range tables {
+			if slices.Contains(opts.NoData, t.Name) {
+				continue
+			}
+			if err := emit("-- data for " + t.Name); err != nil {
+				return stats, err
+			}
+			if err := bw.Flush(); err != nil {
+				return stats, err
+			}
+			n, err := writeData(ctx, db, drv, schema, t, out, opts)
+			stats.Rows += n
+			if err != nil {
+				return stats, fmt.Errorf("failed to dump rows of %s: %w", t.Name, err)
+			}
+			if _, err := bw.WriteString("\n"); err != nil {
+				return stats, err
+			}
+			if err := emit(ResetIdentity(drv, schema, t)...); err != nil {
+				return stats, err
+			}
+		}
+	}
+
+	if structure {
+		for _, t := range tables {
+			for _, ix := range t.Indexes {
+				if t.BacksConstraint(ix) {
+					continue
+				}
+				if err := emit(b.CreateIndex(schema, t.Name, ix)); err != nil {
+					return stats, err
+				}
+			}
+		}
+		for _, t := range tables {
+			for _, c := range t.Constraints {
+				if c.Type != introspect.ConstraintForeignKey {
+					continue
+				}
+				// SQLite received its foreign keys inline in CREATE TABLE
+				if stmt, ok := b.AddConstraint(schema, t.Name, c); ok {
+					if err := emit(stmt); err != nil {
+						return stats, err
+					}
+				}
+			}
+		}
+		for _, v := range views {
+			if err := emit(b.CreateView(schema, v.Name, v.Definition, v.Materialized)); err != nil {
+				return stats, err
+			}
+		}
+		stats.Views = len(views)
+	}
+	stats.Tables = len(tables)
+
+	if err := emit(epilogue(drv)...); err != nil {
+		return stats, err
+	}
+	return stats, bw.Flush()
+}
+
+// collect describes the requested tables and views; names that don't exist are reported
+func collect(ctx context.Context, db *sql.DB, drv, schema string, names []string) ([]introspect.Table, []introspect.View, error) {
+	objects, err := introspect.Objects(ctx, db, drv, schema)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	wanted := map[string]bool{}
+	for _, name := range names {
+		wanted[name] = true
+	}
+	missing := maps.Clone(wanted)
+
+	tables := []introspect.Table{}
+	views := []introspect.View{}
+	for _, o := range objects {
+		if len(wanted) > 0 && !wanted[o.Name] {
+			continue
+		}
+		delete(missing, o.Name)
+		switch o.Kind {
+		case constants.ObjectKindTable:
+			t, err := introspect.DescribeTable(ctx, db, drv, schema, o.Name)
+			if err != nil {
+				return nil, nil, err
+			}
+			tables = append(tables, t)
+		case constants.ObjectKindView, constants.ObjectKindMaterializedView:
+			definition, kind, err := introspect.ViewDefinition(ctx, db, drv, schema, o.Name)
+			if err != nil {
+				return nil, nil, err
+			}
+			views = append(views, introspect.View{
+				Name:         o.Name,
+				Materialized: kind == constants.ObjectKindMaterializedView,
+				Definition:   definition,
+			})
+		}
+	}
+	if len(missing) > 0 {
+		return nil, nil, fmt.Errorf("table not found: %s", strings.Join(slices.Sorted(maps.Keys(missing)), ", "))
+	}
+	return tables, views, nil
+}
+
+// writeData streams the rows of one table as INSERT statements
+func writeData(ctx context.Context, db *sql.DB, drv, schema string, t introspect.Table, out io.Writer, opts Options) (int64, error) {
+	query, args, err := export.Selection{Schema: schema, Table: t.Name}.SQL(drv)
+	if err != nil {
+		return 0, err
+	}
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	identity := false
+	for _, c := range t.Columns {
+		identity = identity || c.AutoIncrement
+	}
+	insertSchema := schema
+	if drv == constants.DriverSQLite {
+		// SQLite has no schemas to qualify the INSERT with
+		insertSchema = ""
+	}
+	var w export.RowWriter = export.NewSQLWriter(out, export.SQLOptions{
+		Driver:         drv,
+		Schema:         insertSchema,
+		Table:          t.Name,
+		BatchSize:      opts.BatchSize,
+		IdentityInsert: identity,
+	})
+
+	if opts.Mask != nil {
+		w = opts.Mask(schema, t.Name, w)
+	}
+
+	var progress export.ProgressFunc
+	if opts.Progress != nil {
+		progress = func(n int64) { opts.Progress(t.Name, n) }
+	}
+	return export.Stream(ctx, rows, w, progress)
+}
+
+// ResetIdentity moves PostgreSQL identity sequences past the loaded rows;
+// the other dialects advance their counters on explicit inserts
+func ResetIdentity(drv, schema string, t introspect.Table) []string {
+	if drv != constants.DriverPostgres {
+		return nil
+	}
+	stmts := []string{}
+	table := dialect.QualifiedName(drv, schema, t.Name)
+	for _, c := range t.Columns {
+		if !c.AutoIncrement {
+			continue
+		}
+		col := dialect.QuoteIdent(drv, c.Name)
+		stmts = append(stmts, fmt.Sprintf("SELECT setval(pg_get_serial_sequence(%s, %s), COALESCE(MAX(%s), 0) + 1, false) FROM %s",
+			export.StringLiteral(drv, table), export.StringLiteral(drv, c.Name), col, table))
+	}
+	return stmts
+}
+
+// prologue disables checks that would reject rows loaded before their parents
+func prologue(drv string) []string {
+	switch drv {
+	case constants.DriverMySQL:
+		return []string{"SET FOREIGN_KEY_CHECKS = 0", "SET NAMES utf8mb4"}
+	case constants.DriverSQLite:
+		return []string{"PRAGMA foreign_keys = OFF"}
+	}
+	return nil
+}
+
+func epilogue(drv string) []string {
+	switch drv {
+	case constants.DriverMySQL:
+		return []string{"SET FOREIGN_KEY_CHECKS = 1"}
+	case constants.DriverSQLite:
+		return []string{"PRAGMA foreign_keys = ON"}
+	}
+	return nil
+}
+
+// orderByDependencies sorts tables so every table comes after the tables its
+// foreign keys reference. Cycles keep their original order.
+func orderByDependencies(tables []introspect.Table) []introspect.Table {
+	index := map[string]int{}
+	for i, t := range tables {
+		index[t.Name] = i
+	}
+
+	ordered := make([]introspect.Table, 0, len(tables))
+	state := make([]int, len(tables)) // 0 unvisited, 1 visiting, 2 done
+	var visit func(i int)
+	visit = func(i int) {
+		if state[i] != 0 {
+			return
+		}
+		state[i] = 1
+		for _, c := range tables[i].Constraints {
+			if c.Type != introspect.ConstraintForeignKey {
+				continue
+			}
+			if j, ok := index[c.RefTable]; ok && j != i {
+				visit(j)
+			}
+		}
+		state[i] = 2
+		ordered = append(ordered, tables[i])
+	}
+	for i := range tables {
+		visit(i)
+	}
+	return ordered
+}
@@ -0,0 +1,204 @@
+package export
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net/url"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/unicode"
+	"golang.org/x/text/transform"
+)
+
+// CSV quoting modes
+const (
+	// QuoteMinimal quotes fields containing the delimiter, quotes or line breaks
+	QuoteMinimal = "minimal"
+	// QuoteAll quotes every non-NULL field
+	QuoteAll = "all"
+	// QuoteNonNumeric quotes every non-NULL field that isn't a number
+	QuoteNonNumeric = "nonnumeric"
+)
+
+// CSV output encodings
+const (
+	EncodingUTF8        = "utf-8"
+	EncodingUTF8BOM     = "utf-8-bom"
+	EncodingUTF16LE     = "utf-16le"
+	EncodingWindows1252 = "windows-1252"
+	EncodingISO88591    = "iso-8859-1"
+)
+
+// CSVOptions configures the CSV writer
+type CSVOptions struct {
+	Delimiter rune
+	Quoting   string
+	Header    bool
+	// Null is written (unquoted) for NULL values
+	Null     string
+	Encoding string
+}
+
+// DefaultCSVOptions returns comma-delimited, minimally quoted UTF-8 with a header row
+func DefaultCSVOptions() CSVOptions {
+	return CSVOptions{Delimiter: ',', Quoting: QuoteMinimal, Header: true, Encoding: EncodingUTF8}
+}
+
+type csvWriter struct {
+	opts    CSVOptions
+	out     *bufio.Writer
+	closer  io.Closer
+	columns []Column
+	line    strings.Builder
+}
+
+// NewCSVWriter creates a RowWriter producing CSV on out
+func NewCSVWriter(out io.Writer, opts CSVOptions) (RowWriter, error) {
+	if opts.Delimiter == 0 {
+		opts.Delimiter = ','
+	}
+	if opts.Delimiter == '"' || opts.Delimiter == '\r' || opts.Delimiter == '\n' {
+		return nil, errors.New("invalid CSV delimiter")
+	}
+	switch opts.Quoting {
+	case "":
+		opts.Quoting = QuoteMinimal
+	case QuoteMinimal, QuoteAll, QuoteNonNumeric:
+	default:
+		return nil, errors.New("unsupported CSV quoting: " + opts.Quoting)
+	}
+
+	w := &csvWriter{opts: opts}
+	target, closer, err := encodeWriter(out, opts.Encoding)
+	if err != nil {
+		return nil, err
+	}
+	w.out = bufio.NewWriterSize(target, 64*1024)
+	w.closer = closer
+	return w, nil
+}
+
+// encodeWriter wraps out so that UTF-8 written to it arrives in the requested encoding
+func encodeWriter(out io.Writer, enc string) (io.Writer, io.Closer, error) {
+	var encoder *encoding.Encoder
+	switch strings.ToLower(enc) {
+	case "", EncodingUTF8, "utf8":
+		return out, nil, nil
+	case EncodingUTF8BOM:
+		// the BOM itself is written by Begin, so nothing reaches out before the first row
+		return out, nil, nil
+	case EncodingUTF16LE:
+		encoder = unicode.UTF16(unicode.LittleEndian, unicode.UseBOM).NewEncoder()
+	case EncodingWindows1252, "cp1252":
+		encoder = encoding.ReplaceUnsupported(charmap.Windows1252.NewEncoder())
+	case EncodingISO88591, "latin1":
+		encoder = encoding.ReplaceUnsupported(charmap.ISO8859_1.NewEncoder())
+	default:
+		return nil, nil, errors.New("unsupported encoding: " + enc)
+	}
+	tw := transform.NewWriter(out, encoder)
+	return tw, tw, nil
+}
+
+func (w *csvWriter) Begin(columns []Column) error {
+	w.columns = columns
+	if strings.EqualFold(w.opts.Encoding, EncodingUTF8BOM) {
+		if _, err := w.out.WriteString("\uFEFF"); err != nil {
+			return err
+		}
+	}
+	if !w.opts.Header {
+		return nil
+	}
+	w.line.Reset()
+	for i, c := range columns {
+		if i > 0 {
+			w.line.WriteRune(w.opts.Delimiter)
+		}
+		w.writeField(c.Name, w.opts.Quoting != QuoteMinimal)
+	}
+	w.line.WriteByte('\n')
+	_, err := w.out.WriteString(w.line.String())
+	return err
+}
+
+func (w *csvWriter) Row(values []any) error {
+	w.line.Reset()
+	for i, v := range values {
+		if i > 0 {
+			w.line.WriteRune(w.opts.Delimiter)
+		}
+		text, null, numeric := FormatText(v, w.columns[i])
+		if null {
+			w.line.WriteString(w.opts.Null)
+			continue
+		}
+		force := w.opts.Quoting == QuoteAll || (w.opts.Quoting == QuoteNonNumeric && !numeric)
+		// an empty string must stay distinguishable from an empty NULL marker
+		if text == "" && w.opts.Null == "" {
+			force = true
+		}
+		w.writeField(text, force)
+	}
+	w.line.WriteByte('\n')
+	_, err := w.out.WriteString(w.line.String())
+	return err
+}
+
+func (w *csvWriter) End() error {
+	if err := w.out.Flush(); err != nil {
+		return err
+	}
+	if w.closer != nil {
+		return w.closer.Close()
+	}
+	return nil
+}
+
+func (w *csvWriter) writeField(field string, force bool) {
+	if !force && !w.needsQuotes(field) {
+		w.line.WriteString(field)
+		return
+	}
+	w.line.WriteByte('"')
+	w.line.WriteString(strings.ReplaceAll(field, `"`, `""`))
+	w.line.WriteByte('"')
+}
+
+// needsQuotes follows encoding/csv: quote when the field holds the delimiter,
+// a quote, a line break or starts with a space
+func (w *csvWriter) needsQuotes(field string) bool {
+	if field == "" {
+		return false
+	}
+	if field == `\.` || strings.ContainsRune(field, w.opts.Delimiter) || strings.ContainsAny(field, "\"\r\n") {
+		return true
+	}
+	return field[0] == ' ' || field[0] == '\t'
+}
+
+// CSVOptionsFromForm reads delimiter ("," by default, "tab" for a tab), quoting,
+// header ("no" to omit), null and encoding from request parameters
+func CSVOptionsFromForm(form url.Values) CSVOptions {
+	opts := DefaultCSVOptions()
+	switch d := form.Get("delimiter"); d {
+	case "":
+	case "tab", `\t`:
+		opts.Delimiter = '\t'
+	default:
+		opts.Delimiter, _ = utf8.DecodeRuneInString(d)
+	}
+	if q := form.Get("quoting"); q != "" {
+		opts.Quoting = q
+	}
+	opts.Header = form.Get("header") != "no"
+	opts.Null = form.Get("null")
+	if e := form.Get("encoding"); e != "" {
+		opts.Encoding = e
+	}
+	return opts
+}
@@ -0,0 +1,147 @@
+// Package export streams query results from a database cursor into file
+// formats (CSV, ...) without buffering the result set in memory.
+package export
+
+import (
+	"context"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Column describes an exported column
+type Column struct {
+	Name         string `json:"name"`
+	DatabaseType string `json:"database_type"`
+}
+
+// IsBinary reports whether the column holds raw bytes rather than text
+func (c Column) IsBinary() bool {
+	switch strings.ToUpper(c.DatabaseType) {
+	case "BYTEA", "BLOB", "TINYBLOB", "MEDIUMBLOB", "LONGBLOB", "BINARY", "VARBINARY", "IMAGE":
+		return true
+	}
+	return false
+}
+
+// RowWriter receives a result set one row at a time
+type RowWriter interface {
+	// Begin is called once with the result columns before any row
+	Begin(columns []Column) error
+	// Row receives the scanned values of one row; the slice is reused between calls
+	Row(values []any) error
+	// End is called after the last row and must flush any buffered output
+	End() error
+}
+
+// ProgressFunc is called periodically with the number of rows written so far
+type ProgressFunc func(rows int64)
+
+// progressEvery is how many rows pass between ProgressFunc calls
+const progressEvery = 1000
+
+// Columns returns the export columns of a result set
+func Columns(rows *sql.Rows) ([]Column, error) {
+	types, err := rows.ColumnTypes()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get columns: %v", err)
+	}
+	columns := make([]Column, len(types))
+	for i, t := range types {
+		columns[i] = Column{Name: t.Name(), DatabaseType: t.DatabaseTypeName()}
+	}
+	return columns, nil
+}
+
+// Stream copies every row of rows into w and returns the number of rows written.
+// The context is checked between rows so a disconnected client stops the export.
+func Stream(ctx context.Context, rows *sql.Rows, w RowWriter, progress ProgressFunc) (int64, error) {
+	columns, err := Columns(rows)
+	if err != nil {
+		return 0, err
+	}
+	if err := w.Begin(columns); err != nil {
+		return 0, err
+	}
+
+	values := make([]any, len(columns))
+	pointers := make([]any, len(columns))
+	for i := range values {
+		pointers[i] = &values[i]
+	}
+
+	var count int64
+	for rows.Next() {
+		if err := ctx.Err(); err != nil {
+			return count, err
+		}
+		if err := rows.Scan(pointers...); err != nil {
+			return count, fmt.Errorf("failed to scan row: %v", err)
+		}
+		if err := w.Row(values); err != nil {
+			return count, err
+		}
+		count++
+		if progress != nil && count%progressEvery == 0 {
+			progress(count)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return count, fmt.Errorf("error iterating rows: %v", err)
+	}
+	if progress != nil {
+		progress(count)
+	}
+	return count, w.End()
+}
+
+// FormatText renders a scanned value as text. Binary columns (and byte values
+// that aren't valid UTF-8) are hex encoded with a "\x" prefix, times use
+// RFC 3339. numeric reports whether the value is a number.
+func FormatText(v any, column Column) (text string, null bool, numeric bool) {
+	switch x := v.(type) {
+	case nil:
+		return "", true, false
+	case []byte:
+		if column.IsBinary() || !utf8.Valid(x) {
+			return `\x` + hex.EncodeToString(x), false, false
+		}
+		return string(x), false, looksNumeric(column, string(x))
+	case string:
+		return x, false, looksNumeric(column, x)
+	case int64:
+		return strconv.FormatInt(x, 10), false, true
+	case int32:
+		return strconv.FormatInt(int64(x), 10), false, true
+	case int:
+		return strconv.Itoa(x), false, true
+	case uint64:
+		return strconv.FormatUint(x, 10), false, true
+	case float64:
+		return strconv.FormatFloat(x, 'f', -1, 64), false, true
+	case float32:
+		return strconv.FormatFloat(float64(x), 'f', -1, 32), false, true
+	case bool:
+		return strconv.FormatBool(x), false, false
+	case time.Time:
+		return x.Format(time.RFC3339Nano), false, false
+	default:
+		return fmt.Sprint(x), false, false
+	}
+}
+
+// looksNumeric reports whether a textual value comes from a numeric column,
+// e.g. DECIMAL values that drivers return as strings
+func looksNumeric(column Column, s string) bool {
+	switch strings.ToUpper(column.DatabaseType) {
+	case "DECIMAL", "NUMERIC", "INT", "INTEGER", "BIGINT", "SMALLINT", "TINYINT", "MEDIUMINT",
+		"FLOAT", "DOUBLE", "REAL", "INT2", "INT4", "INT8", "FLOAT4", "FLOAT8", "MONEY":
+		_, err := strconv.ParseFloat(s, 64)
+		return err == nil
+	}
+	return false
+}
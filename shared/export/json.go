@@ -0,0 +1,94 @@
+package export
+
+import (
+	"bufio"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"unicode/utf8"
+)
+
+// JSONValue converts a scanned value to the form the API responds with:
+// text as strings, binary as "\x"-prefixed hex, everything else as the
+// driver returned it (numbers, booleans, times as RFC 3339, NULL as null).
+func JSONValue(v any, column Column) any {
+	if b, ok := v.([]byte); ok {
+		if column.IsBinary() || !utf8.Valid(b) {
+			return `\x` + hex.EncodeToString(b)
+		}
+		return string(b)
+	}
+	return v
+}
+
+type jsonWriter struct {
+	out     *bufio.Writer
+	ndjson  bool
+	columns []Column
+	keys    [][]byte
+	n       int64
+	line    []byte
+}
+
+// NewJSONWriter creates a RowWriter producing one JSON object per row, either
+// as a single JSON array or, with ndjson set, as newline-delimited JSON
+func NewJSONWriter(out io.Writer, ndjson bool) RowWriter {
+	return &jsonWriter{out: bufio.NewWriter(out), ndjson: ndjson}
+}
+
+func (w *jsonWriter) Begin(columns []Column) error {
+	w.columns = columns
+	w.keys = make([][]byte, len(columns))
+	for i, c := range columns {
+		key, err := json.Marshal(c.Name)
+		if err != nil {
+			return err
+		}
+		w.keys[i] = key
+	}
+	if !w.ndjson {
+		_, err := w.out.WriteString("[")
+		return err
+	}
+	return nil
+}
+
+// Row writes the object by hand so keys keep the column order
+func (w *jsonWriter) Row(values []any) error {
+	w.line = w.line[:0]
+	if !w.ndjson {
+		if w.n > 0 {
+			w.line = append(w.line, ',')
+		}
+		w.line = append(w.line, '\n')
+	}
+	w.line = append(w.line, '{')
+	for i, v := range values {
+		if i > 0 {
+			w.line = append(w.line, ',')
+		}
+		value, err := json.Marshal(JSONValue(v, w.columns[i]))
+		if err != nil {
+			return err
+		}
+		w.line = append(w.line, w.keys[i]...)
+		w.line = append(w.line, ':')
+		w.line = append(w.line, value...)
+	}
+	w.line = append(w.line, '}')
+	if w.ndjson {
+		w.line = append(w.line, '\n')
+	}
+	w.n++
+	_, err := w.out.Write(w.line)
+	return err
+}
+
+func (w *jsonWriter) End() error {
+	if !w.ndjson {
+		if _, err := w.out.WriteString("\n]\n"); err != nil {
+			return err
+		}
+	}
+	return w.out.Flush()
+}
@@ -0,0 +1,170 @@
+package export
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/dracory/weebase/shared/constants"
+	"github.com/dracory/weebase/shared/dialect"
+)
+
+// Filter is a single WHERE condition of a selection
+type Filter struct {
+	Column string `json:"column"`
+	Op     string `json:"op"`
+	Value  string `json:"value"`
+}
+
+// filterOps maps accepted operators to their SQL spelling
+var filterOps = map[string]string{
+	"=":           "=",
+	"!=":          "<>",
+	"<>":          "<>",
+	"<":           "<",
+	"<=":          "<=",
+	">":           ">",
+	">=":          ">=",
+	"like":        "LIKE",
+	"not like":    "NOT LIKE",
+	"is null":     "IS NULL",
+	"is not null": "IS NOT NULL",
+}
+
+// Selection is a table, or a filtered/paged slice of it, as shown when browsing rows
+type Selection struct {
+	Schema  string   `json:"schema"`
+	Table   string   `json:"table"`
+	Columns []string `json:"columns"`
+	Filters []Filter `json:"filters"`
+	OrderBy string   `json:"order_by"`
+	Desc    bool     `json:"desc"`
+	Limit   int      `json:"limit"`
+	Offset  int      `json:"offset"`
+}
+
+// SelectionFromForm reads a selection from request parameters:
+// schema, table, columns (comma separated), filter_column[], filter_op[],
+// filter_value[], order, order_dir, limit and offset (or page, as api_rows_browse takes it)
+func SelectionFromForm(form url.Values) Selection {
+	s := Selection{
+		Schema:  strings.TrimSpace(form.Get("schema")),
+		Table:   strings.TrimSpace(form.Get("table")),
+		OrderBy: strings.TrimSpace(form.Get("order")),
+		Desc:    strings.EqualFold(form.Get("order_dir"), "desc"),
+	}
+	for _, c := range strings.Split(form.Get("columns"), ",") {
+		if c = strings.TrimSpace(c); c != "" {
+			s.Columns = append(s.Columns, c)
+		}
+	}
+	ops := form["filter_op[]"]
+	values := form["filter_value[]"]
+	for i, c := range form["filter_column[]"] {
+		if strings.TrimSpace(c) == "" {
+			continue
+		}
+		f := Filter{Column: strings.TrimSpace(c), Op: "="}
+		if i < len(ops) {
+			f.Op = ops[i]
+		}
+		if i < len(values) {
+			f.Value = values[i]
+		}
+		s.Filters = append(s.Filters, f)
+	}
+	s.Limit, _ = strconv.Atoi(form.Get("limit"))
+	s.Offset, _ = strconv.Atoi(form.Get("offset"))
+	// accept the page parameter of api_rows_browse so a browsed page exports as shown
+	if page, _ := strconv.Atoi(form.Get("page")); page > 1 && s.Limit > 0 && form.Get("offset") == "" {
+		s.Offset = (page - 1) * s.Limit
+	}
+	return s
+}
+
+// SQL builds the SELECT statement and its arguments for the driver
+func (s Selection) SQL(drv string) (string, []any, error) {
+	drv = dialect.Normalize(drv)
+	if !dialect.SanitizeIdent(s.Table) || (s.Schema != "" && !dialect.SanitizeIdent(s.Schema)) {
+		return "", nil, errors.New("invalid table or schema identifier")
+	}
+
+	columns := "*"
+	if len(s.Columns) > 0 {
+		quoted := make([]string, len(s.Columns))
+		for i, c := range s.Columns {
+			if !dialect.SanitizeIdent(c) {
+				return "", nil, fmt.Errorf("invalid column identifier: %s", c)
+			}
+			quoted[i] = dialect.QuoteIdent(drv, c)
+		}
+		columns = strings.Join(quoted, ", ")
+	}
+
+	query := "SELECT " + columns + " FROM " + dialect.QualifiedName(drv, s.Schema, s.Table)
+
+	var (
+		conditions []string
+		args       []any
+	)
+	for _, f := range s.Filters {
+		op, ok := filterOps[strings.ToLower(strings.TrimSpace(f.Op))]
+		if !ok {
+			return "", nil, fmt.Errorf("unsupported filter operator: %s", f.Op)
+		}
+		if !dialect.SanitizeIdent(f.Column) {
+			return "", nil, fmt.Errorf("invalid column identifier: %s", f.Column)
+		}
+		condition := dialect.QuoteIdent(drv, f.Column) + " " + op
+		if op != "IS NULL" && op != "IS NOT NULL" {
+			condition += " " + dialect.Placeholder(drv, len(args)+1)
+			args = append(args, dialect.BindArg(drv, len(args)+1, f.Value))
+		}
+		conditions = append(conditions, condition)
+	}
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	order := ""
+	if s.OrderBy != "" {
+		if !dialect.SanitizeIdent(s.OrderBy) {
+			return "", nil, fmt.Errorf("invalid column identifier: %s", s.OrderBy)
+		}
+		order = " ORDER BY " + dialect.QuoteIdent(drv, s.OrderBy)
+		if s.Desc {
+			order += " DESC"
+		}
+	}
+
+	if s.Limit <= 0 && s.Offset <= 0 {
+		return query + order, args, nil
+	}
+
+	if drv == constants.DriverSQLServer {
+		if order == "" {
+			order = " ORDER BY (SELECT NULL)"
+		}
+		query += order + fmt.Sprintf(" OFFSET %d ROWS", max(s.Offset, 0))
+		if s.Limit > 0 {
+			query += fmt.Sprintf(" FETCH NEXT %d ROWS ONLY", s.Limit)
+		}
+		return query, args, nil
+	}
+
+	query += order
+	offset := max(s.Offset, 0)
+	switch {
+	case s.Limit > 0:
+		return query + fmt.Sprintf(" LIMIT %d OFFSET %d", s.Limit, offset), args, nil
+	case drv == constants.DriverMySQL:
+		// MySQL has no OFFSET without LIMIT; this is its documented "all rows" idiom
+		return query + fmt.Sprintf(" LIMIT %d, 18446744073709551615", offset), args, nil
+	case drv == constants.DriverSQLite:
+		return query + fmt.Sprintf(" LIMIT -1 OFFSET %d", offset), args, nil
+	default:
+		return query + fmt.Sprintf(" OFFSET %d", offset), args, nil
+	}
+}
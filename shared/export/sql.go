@@ -0,0 +1,192 @@
+package export
+
+import (
+	"bufio"
+	"encoding/hex"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/dracory/weebase/shared/constants"
+	"github.com/dracory/weebase/shared/dialect"
+)
+
+// DefaultBatchSize is the number of rows per INSERT statement when none is given
+const DefaultBatchSize = 100
+
+// maxSQLServerBatch is the row limit of a SQL Server VALUES list
+const maxSQLServerBatch = 1000
+
+// SQLOptions configures the INSERT writer
+type SQLOptions struct {
+	// Driver is the dialect the statements are written for
+	Driver string
+	Schema string
+	Table  string
+	// BatchSize is the number of rows per multi-row INSERT
+	BatchSize int
+	// IdentityInsert wraps the statements in SET IDENTITY_INSERT on SQL Server
+	// so explicit values can be written to an identity column
+	IdentityInsert bool
+}
+
+type sqlWriter struct {
+	opts   SQLOptions
+	out    *bufio.Writer
+	prefix string
+	cols   []Column
+	n      int
+	line   strings.Builder
+}
+
+// NewSQLWriter creates a RowWriter producing batched multi-row INSERT statements on out
+func NewSQLWriter(out io.Writer, opts SQLOptions) RowWriter {
+	opts.Driver = dialect.Normalize(opts.Driver)
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = DefaultBatchSize
+	}
+	if opts.Driver == constants.DriverSQLServer && opts.BatchSize > maxSQLServerBatch {
+		opts.BatchSize = maxSQLServerBatch
+	}
+	return &sqlWriter{opts: opts, out: bufio.NewWriter(out)}
+}
+
+func (w *sqlWriter) Begin(columns []Column) error {
+	w.cols = columns
+	names := make([]string, len(columns))
+	for i, c := range columns {
+		names[i] = dialect.QuoteIdent(w.opts.Driver, c.Name)
+	}
+	table := dialect.QualifiedName(w.opts.Driver, w.opts.Schema, w.opts.Table)
+	w.prefix = "INSERT INTO " + table + " (" + strings.Join(names, ", ") + ") VALUES\n"
+	return w.identityInsert("ON")
+}
+
+func (w *sqlWriter) Row(values []any) error {
+	w.line.Reset()
+	if w.n == 0 {
+		w.line.WriteString(w.prefix)
+	} else {
+		w.line.WriteString(",\n")
+	}
+	w.line.WriteByte('(')
+	for i, v := range values {
+		if i > 0 {
+			w.line.WriteString(", ")
+		}
+		w.line.WriteString(Literal(w.opts.Driver, v, w.cols[i]))
+	}
+	w.line.WriteByte(')')
+	w.n++
+	if w.n == w.opts.BatchSize {
+		w.line.WriteString(";\n")
+		w.n = 0
+	}
+	_, err := w.out.WriteString(w.line.String())
+	return err
+}
+
+func (w *sqlWriter) End() error {
+	if w.n > 0 {
+		if _, err := w.out.WriteString(";\n"); err != nil {
+			return err
+		}
+		w.n = 0
+	}
+	if err := w.identityInsert("OFF"); err != nil {
+		return err
+	}
+	return w.out.Flush()
+}
+
+func (w *sqlWriter) identityInsert(state string) error {
+	if !w.opts.IdentityInsert || w.opts.Driver != constants.DriverSQLServer {
+		return nil
+	}
+	table := dialect.QualifiedName(w.opts.Driver, w.opts.Schema, w.opts.Table)
+	_, err := w.out.WriteString("SET IDENTITY_INSERT " + table + " " + state + ";\n")
+	return err
+}
+
+// Literal renders a scanned value as a SQL literal for the driver.
+// Binary values become hex literals, booleans TRUE/FALSE on PostgreSQL and 1/0
+// elsewhere, and times are written without losing fractional seconds.
+func Literal(drv string, v any, column Column) string {
+	drv = dialect.Normalize(drv)
+	switch x := v.(type) {
+	case nil:
+		return "NULL"
+	case []byte:
+		if column.IsBinary() || !utf8.Valid(x) {
+			return binaryLiteral(drv, x)
+		}
+		return textLiteral(drv, string(x), column)
+	case string:
+		return textLiteral(drv, x, column)
+	case bool:
+		if drv == constants.DriverPostgres {
+			return strings.ToUpper(strconv.FormatBool(x))
+		}
+		if x {
+			return "1"
+		}
+		return "0"
+	case float64:
+		if math.IsNaN(x) || math.IsInf(x, 0) {
+			return StringLiteral(drv, strconv.FormatFloat(x, 'f', -1, 64))
+		}
+	case float32:
+		if math.IsNaN(float64(x)) || math.IsInf(float64(x), 0) {
+			return StringLiteral(drv, strconv.FormatFloat(float64(x), 'f', -1, 32))
+		}
+	case time.Time:
+		layout := "2006-01-02 15:04:05.999999999"
+		if drv == constants.DriverPostgres {
+			layout += "-07:00"
+		}
+		return StringLiteral(drv, x.Format(layout))
+	}
+
+	text, _, numeric := FormatText(v, column)
+	if numeric {
+		return text
+	}
+	return StringLiteral(drv, text)
+}
+
+// textLiteral keeps numbers that drivers return as text (e.g. DECIMAL) unquoted
+func textLiteral(drv, s string, column Column) string {
+	if looksNumeric(column, s) {
+		return s
+	}
+	return StringLiteral(drv, s)
+}
+
+// StringLiteral quotes s as a string literal. MySQL also needs backslashes
+// escaped, SQL Server gets an N prefix so non-Latin text survives.
+func StringLiteral(drv, s string) string {
+	s = strings.ReplaceAll(s, "'", "''")
+	switch dialect.Normalize(drv) {
+	case constants.DriverMySQL:
+		s = strings.ReplaceAll(s, `\`, `\\`)
+		s = strings.ReplaceAll(s, "\x00", `\0`)
+	case constants.DriverSQLServer:
+		return "N'" + s + "'"
+	}
+	return "'" + s + "'"
+}
+
+func binaryLiteral(drv string, b []byte) string {
+	h := hex.EncodeToString(b)
+	switch drv {
+	case constants.DriverPostgres:
+		return `'\x` + h + `'::bytea`
+	case constants.DriverSQLServer:
+		return "0x" + h
+	default:
+		return "X'" + h + "'"
+	}
+}
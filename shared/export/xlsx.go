@@ -0,0 +1,404 @@
+package export
+
+import (
+	"archive/zip"
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// XLSXMaxRows is the most rows a worksheet holds, header included
+const XLSXMaxRows = 1048576
+
+// xlsxMaxText is the most characters a cell holds
+const xlsxMaxText = 32767
+
+// xlsxMaxExact is the largest integer a spreadsheet number keeps exactly;
+// bigger values (usually ids) are written as text
+const xlsxMaxExact = 1e15
+
+// Cell styles, as indexes into cellXfs of styles.xml
+const (
+	xlsxStyleDefault = iota
+	xlsxStyleHeader
+	xlsxStyleDate
+	xlsxStyleDateTime
+)
+
+// xlsxTimeLayouts parse dates and times that drivers return as text
+var xlsxTimeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05.999999999Z07:00",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02",
+}
+
+// xlsxEpoch is day zero of spreadsheet date serials
+var xlsxEpoch = time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)
+
+// XLSXOptions configures the XLSX writer
+type XLSXOptions struct {
+	// SheetRows is the number of data rows per sheet before the rows continue
+	// on a new sheet; 0 or anything above XLSXMaxRows-1 means as many as fit
+	SheetRows int
+}
+
+// XLSXWorkbook streams an Office Open XML spreadsheet: each source gets its
+// own sheet and sheets are written one after the other, so memory use does
+// not grow with the number of rows. Close must be called once all sheets
+// are written.
+type XLSXWorkbook struct {
+	zw     *zip.Writer
+	opts   XLSXOptions
+	sheets []string
+	open   *xlsxSheet
+}
+
+// NewXLSXWorkbook creates a workbook written to out
+func NewXLSXWorkbook(out io.Writer, opts XLSXOptions) *XLSXWorkbook {
+	if opts.SheetRows <= 0 || opts.SheetRows > XLSXMaxRows-1 {
+		opts.SheetRows = XLSXMaxRows - 1
+	}
+	return &XLSXWorkbook{zw: zip.NewWriter(out), opts: opts}
+}
+
+// Sheet returns a RowWriter filling a new sheet with the given name. Rows
+// beyond the sheet limit continue on sheets named "name (2)", "name (3)"...
+func (wb *XLSXWorkbook) Sheet(name string) RowWriter {
+	return &xlsxSheet{wb: wb, name: name}
+}
+
+// Close writes the workbook parts that list the sheets and finishes the file
+func (wb *XLSXWorkbook) Close() error {
+	if wb.open != nil {
+		if err := wb.open.finish(); err != nil {
+			return err
+		}
+	}
+	if len(wb.sheets) == 0 {
+		// a workbook needs at least one sheet
+		if err := wb.Sheet("Sheet1").Begin(nil); err != nil {
+			return err
+		}
+		if err := wb.open.finish(); err != nil {
+			return err
+		}
+	}
+
+	var contentTypes, workbook, rels strings.Builder
+	contentTypes.WriteString(xmlHeader + `<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+		`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+		`<Default Extension="xml" ContentType="application/xml"/>` +
+		`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+		`<Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/>`)
+	workbook.WriteString(xmlHeader + `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" ` +
+		`xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets>`)
+	rels.WriteString(xmlHeader + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">`)
+	for i, name := range wb.sheets {
+		n := i + 1
+		fmt.Fprintf(&contentTypes, `<Override PartName="/xl/worksheets/sheet%d.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>`, n)
+		fmt.Fprintf(&workbook, `<sheet name="%s" sheetId="%d" r:id="rId%d"/>`, escapeXML(name), n, n)
+		fmt.Fprintf(&rels, `<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet%d.xml"/>`, n, n)
+	}
+	contentTypes.WriteString(`</Types>`)
+	workbook.WriteString(`</sheets></workbook>`)
+	fmt.Fprintf(&rels, `<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/></Relationships>`, len(wb.sheets)+1)
+
+	parts := []struct{ name, body string }{
+		{"[Content_Types].xml", contentTypes.String()},
+		{"_rels/.rels", xmlHeader + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+			`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+			`</Relationships>`},
+		{"xl/workbook.xml", workbook.String()},
+		{"xl/_rels/workbook.xml.rels", rels.String()},
+		{"xl/styles.xml", xlsxStyles},
+	}
+	for _, p := range parts {
+		f, err := wb.zw.Create(p.name)
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(f, p.body); err != nil {
+			return err
+		}
+	}
+	return wb.zw.Close()
+}
+
+// sheetName makes a unique, valid sheet name: at most 31 characters and none of []:*?/\
+func (wb *XLSXWorkbook) sheetName(name string, part int) string {
+	name = strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`[]:*?/\`, r) {
+			return '_'
+		}
+		return r
+	}, strings.Trim(name, "'"))
+	if name == "" {
+		name = "Sheet"
+	}
+	for n := part; ; n++ {
+		suffix := ""
+		if n > 1 {
+			suffix = fmt.Sprintf(" (%d)", n)
+		}
+		candidate := truncateRunes(name, 31-len(suffix)) + suffix
+		taken := false
+		for _, s := range wb.sheets {
+			taken = taken || strings.EqualFold(s, candidate)
+		}
+		if !taken {
+			return candidate
+		}
+	}
+}
+
+// xmlHeader starts every part of the package
+const xmlHeader = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` + "\n"
+
+// xlsxStyles defines the cell styles: default, bold header, date and date-time
+const xlsxStyles = xmlHeader + `<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">` +
+	`<numFmts count="1"><numFmt numFmtId="164" formatCode="yyyy-mm-dd hh:mm:ss"/></numFmts>` +
+	`<fonts count="2"><font><sz val="11"/><name val="Calibri"/></font><font><b/><sz val="11"/><name val="Calibri"/></font></fonts>` +
+	`<fills count="2"><fill><patternFill patternType="none"/></fill><fill><patternFill patternType="gray125"/></fill></fills>` +
+	`<borders count="1"><border><left/><right/><top/><bottom/><diagonal/></border></borders>` +
+	`<cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs>` +
+	`<cellXfs count="4">` +
+	`<xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/>` +
+	`<xf numFmtId="0" fontId="1" fillId="0" borderId="0" xfId="0" applyFont="1"/>` +
+	`<xf numFmtId="14" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>` +
+	`<xf numFmtId="164" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>` +
+	`</cellXfs>` +
+	`<cellStyles count="1"><cellStyle name="Normal" xfId="0" builtinId="0"/></cellStyles>` +
+	`</styleSheet>`
+
+type xlsxSheet struct {
+	wb      *XLSXWorkbook
+	name    string
+	columns []Column
+	refs    []string
+	part    int
+	out     *bufio.Writer
+	row     int
+}
+
+// NewXLSXWriter creates a RowWriter producing a workbook with a single
+// source on out; End closes the workbook
+func NewXLSXWriter(out io.Writer, sheet string, opts XLSXOptions) RowWriter {
+	wb := NewXLSXWorkbook(out, opts)
+	return &xlsxFile{RowWriter: wb.Sheet(sheet), wb: wb}
+}
+
+type xlsxFile struct {
+	RowWriter
+	wb *XLSXWorkbook
+}
+
+func (f *xlsxFile) End() error {
+	if err := f.RowWriter.End(); err != nil {
+		return err
+	}
+	return f.wb.Close()
+}
+
+func (s *xlsxSheet) Begin(columns []Column) error {
+	s.columns = columns
+	s.refs = make([]string, len(columns))
+	for i := range columns {
+		s.refs[i] = columnRef(i)
+	}
+	return s.start()
+}
+
+// start opens the next part of the sheet and writes its header row
+func (s *xlsxSheet) start() error {
+	wb := s.wb
+	if wb.open != nil {
+		if err := wb.open.finish(); err != nil {
+			return err
+		}
+	}
+	s.part++
+	name := wb.sheetName(s.name, s.part)
+	wb.sheets = append(wb.sheets, name)
+	f, err := wb.zw.Create(fmt.Sprintf("xl/worksheets/sheet%d.xml", len(wb.sheets)))
+	if err != nil {
+		return err
+	}
+	s.out = bufio.NewWriter(f)
+	s.row = 1
+	wb.open = s
+
+	s.out.WriteString(xmlHeader + `<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">`)
+	if len(s.columns) > 0 {
+		s.out.WriteString(`<sheetViews><sheetView workbookViewId="0">` +
+			`<pane ySplit="1" topLeftCell="A2" activePane="bottomLeft" state="frozen"/>` +
+			`<selection pane="bottomLeft"/></sheetView></sheetViews>`)
+		s.out.WriteString(`<cols>`)
+		for i, c := range s.columns {
+			width := min(max(utf8.RuneCountInString(c.Name)+2, 10), 60)
+			fmt.Fprintf(s.out, `<col min="%d" max="%d" width="%d" customWidth="1"/>`, i+1, i+1, width)
+		}
+		s.out.WriteString(`</cols>`)
+	}
+	s.out.WriteString(`<sheetData>`)
+	if len(s.columns) == 0 {
+		return nil
+	}
+	s.out.WriteString(`<row r="1">`)
+	for i, c := range s.columns {
+		s.inlineString(s.refs[i]+"1", c.Name, xlsxStyleHeader)
+	}
+	_, err = s.out.WriteString(`</row>`)
+	return err
+}
+
+func (s *xlsxSheet) Row(values []any) error {
+	if s.row > s.wb.opts.SheetRows {
+		if err := s.start(); err != nil {
+			return err
+		}
+	}
+	s.row++
+	r := strconv.Itoa(s.row)
+	fmt.Fprintf(s.out, `<row r="%s">`, r)
+	for i, v := range values {
+		s.cell(s.refs[i]+r, v, s.columns[i])
+	}
+	_, err := s.out.WriteString(`</row>`)
+	return err
+}
+
+func (s *xlsxSheet) End() error {
+	if s.wb.open != s {
+		return nil
+	}
+	return s.finish()
+}
+
+// finish closes the sheet's XML; the zip entry ends when the next one starts
+func (s *xlsxSheet) finish() error {
+	s.wb.open = nil
+	if _, err := s.out.WriteString(`</sheetData></worksheet>`); err != nil {
+		return err
+	}
+	return s.out.Flush()
+}
+
+// cell writes a value as a typed cell: numbers, booleans and dates keep
+// their type so spreadsheets can sort and sum them. NULL leaves the cell out.
+func (s *xlsxSheet) cell(ref string, v any, column Column) {
+	switch x := v.(type) {
+	case nil:
+		return
+	case bool:
+		b := "0"
+		if x {
+			b = "1"
+		}
+		fmt.Fprintf(s.out, `<c r="%s" t="b"><v>%s</v></c>`, ref, b)
+		return
+	case time.Time:
+		s.date(ref, x)
+		return
+	case float64:
+		if !math.IsNaN(x) && !math.IsInf(x, 0) {
+			fmt.Fprintf(s.out, `<c r="%s"><v>%s</v></c>`, ref, strconv.FormatFloat(x, 'g', -1, 64))
+			return
+		}
+	}
+
+	text, _, numeric := FormatText(v, column)
+	if numeric {
+		if f, err := strconv.ParseFloat(text, 64); err == nil && math.Abs(f) < xlsxMaxExact {
+			fmt.Fprintf(s.out, `<c r="%s"><v>%s</v></c>`, ref, text)
+			return
+		}
+	}
+	if isDateColumn(column) {
+		for _, layout := range xlsxTimeLayouts {
+			if t, err := time.Parse(layout, text); err == nil {
+				s.date(ref, t)
+				return
+			}
+		}
+	}
+	s.inlineString(ref, text, xlsxStyleDefault)
+}
+
+// date writes a time as a date serial, keeping its wall clock; times
+// before the spreadsheet epoch can't be represented and are kept as text
+func (s *xlsxSheet) date(ref string, t time.Time) {
+	wall := time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), time.UTC)
+	if wall.Before(xlsxEpoch.AddDate(0, 0, 61)) {
+		s.inlineString(ref, t.Format(time.RFC3339Nano), xlsxStyleDefault)
+		return
+	}
+	serial := wall.Sub(xlsxEpoch).Hours() / 24
+	style := xlsxStyleDateTime
+	if wall.Equal(wall.Truncate(24 * time.Hour)) {
+		style = xlsxStyleDate
+	}
+	fmt.Fprintf(s.out, `<c r="%s" s="%d"><v>%s</v></c>`, ref, style, strconv.FormatFloat(serial, 'f', -1, 64))
+}
+
+func (s *xlsxSheet) inlineString(ref, text string, style int) {
+	text = truncateRunes(text, xlsxMaxText)
+	if style != xlsxStyleDefault {
+		fmt.Fprintf(s.out, `<c r="%s" s="%d" t="inlineStr"><is><t xml:space="preserve">`, ref, style)
+	} else {
+		fmt.Fprintf(s.out, `<c r="%s" t="inlineStr"><is><t xml:space="preserve">`, ref)
+	}
+	s.out.WriteString(escapeXML(text))
+	s.out.WriteString(`</t></is></c>`)
+}
+
+// isDateColumn reports whether textual values of the column are dates or times
+func isDateColumn(column Column) bool {
+	switch strings.ToUpper(column.DatabaseType) {
+	case "DATE", "DATETIME", "DATETIME2", "SMALLDATETIME", "TIMESTAMP", "TIMESTAMPTZ":
+		return true
+	}
+	return false
+}
+
+// columnRef converts a 0-based column index to letters: 0 is A, 26 is AA
+func columnRef(i int) string {
+	ref := ""
+	for i++; i > 0; i = (i - 1) / 26 {
+		ref = string(rune('A'+(i-1)%26)) + ref
+	}
+	return ref
+}
+
+// escapeXML escapes markup characters and drops characters XML 1.0 forbids
+func escapeXML(s string) string {
+	var sb strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '&':
+			sb.WriteString("&amp;")
+		case r == '<':
+			sb.WriteString("&lt;")
+		case r == '>':
+			sb.WriteString("&gt;")
+		case r == '"':
+			sb.WriteString("&quot;")
+		case r == '\t' || r == '\n' || r == '\r' || (r >= 0x20 && r <= 0xD7FF) || (r >= 0xE000 && r <= 0xFFFD) || r >= 0x10000:
+			sb.WriteRune(r)
+		}
+	}
+	return sb.String()
+}
+
+func truncateRunes(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	return string([]rune(s)[:n])
+}
@@ -0,0 +1,54 @@
+// Package glob matches names against the * and ? patterns used throughout
+// the configuration: RBAC grants, masking rules, connection policies and
+// secret allow lists.
+package glob
+
+import "strings"
+
+// Match is a case-insensitive glob match where * matches any run of
+// characters, / included, and ? any single one
+func Match(pattern, s string) bool {
+	pattern, s = strings.ToLower(pattern), strings.ToLower(s)
+	px, sx := 0, 0
+	starPx, starSx := -1, -1
+	for px < len(pattern) || sx < len(s) {
+		if px < len(pattern) {
+			switch c := pattern[px]; c {
+			case '*':
+				starPx, starSx = px, sx+1
+				px++
+				continue
+			case '?':
+				if sx < len(s) {
+					px++
+					sx++
+					continue
+				}
+			default:
+				if sx < len(s) && s[sx] == c {
+					px++
+					sx++
+					continue
+				}
+			}
+		}
+		if starPx >= 0 && starSx <= len(s) {
+			px, sx = starPx+1, starSx
+			starSx++
+			continue
+		}
+		return false
+	}
+	return true
+}
+
+// MatchAny reports whether s matches one of the patterns; no patterns
+// match nothing
+func MatchAny(patterns []string, s string) bool {
+	for _, pattern := range patterns {
+		if Match(pattern, s) {
+			return true
+		}
+	}
+	return false
+}
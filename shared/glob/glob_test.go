@@ -0,0 +1,33 @@
+package glob
+
+import "testing"
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		pattern, s string
+		want       bool
+	}{
+		{"*", "", true},
+		{"orders", "ORDERS", true},
+		{"order?", "orders", true},
+		{"order?", "order", false},
+		{"*host=prod*", "user=a host=prod-db/x", true},
+		{"a*b*c", "axxbyyc", true},
+		{"a*b*c", "axxbyy", false},
+		{"", "x", false},
+	}
+	for _, tt := range tests {
+		if got := Match(tt.pattern, tt.s); got != tt.want {
+			t.Errorf("Match(%q, %q) = %v, want %v", tt.pattern, tt.s, got, tt.want)
+		}
+	}
+}
+
+func TestMatchAny(t *testing.T) {
+	if MatchAny(nil, "x") {
+		t.Error("expected no patterns to match nothing")
+	}
+	if !MatchAny([]string{"a*", "PG_*"}, "pg_password") {
+		t.Error("expected the second pattern to match")
+	}
+}
@@ -0,0 +1,172 @@
+package introspect
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+
+	"github.com/dracory/weebase/shared/constants"
+)
+
+// Object is a listed database relation together with its kind
+// (table, view, materialized_view, foreign_table or system)
+type Object struct {
+	Name string `json:"name"`
+	Kind string `json:"kind"`
+}
+
+// Objects lists tables, views, materialized views and foreign tables in a schema.
+// An empty schema means the driver's default (public, dbo or the current database).
+func Objects(ctx context.Context, db *sql.DB, drv, schema string) ([]Object, error) {
+	var (
+		query string
+		args  []any
+	)
+
+	switch drv {
+	case constants.DriverPostgres:
+		if schema == "" {
+			schema = "public"
+		}
+		query = `
+			SELECT c.relname,
+				CASE
+					WHEN n.nspname IN ('pg_catalog', 'information_schema') THEN 'system'
+					WHEN c.relkind = 'v' THEN 'view'
+					WHEN c.relkind = 'm' THEN 'materialized_view'
+					WHEN c.relkind = 'f' THEN 'foreign_table'
+					ELSE 'table'
+				END
+			FROM pg_catalog.pg_class c
+			JOIN pg_catalog.pg_namespace n ON n.oid = c.relnamespace
+			WHERE n.nspname = $1
+			AND c.relkind IN ('r', 'p', 'v', 'm', 'f')
+			ORDER BY c.relname`
+		args = []any{schema}
+	case constants.DriverMySQL:
+		query = `
+			SELECT table_name,
+				CASE table_type
+					WHEN 'VIEW' THEN 'view'
+					WHEN 'SYSTEM VIEW' THEN 'system'
+					ELSE 'table'
+				END
+			FROM information_schema.tables
+			WHERE table_schema = COALESCE(NULLIF(?, ''), DATABASE())
+			ORDER BY table_name`
+		args = []any{schema}
+	case constants.DriverSQLite:
+		query = `
+			SELECT name,
+				CASE
+					WHEN name LIKE 'sqlite_%' THEN 'system'
+					WHEN type = 'view' THEN 'view'
+					ELSE 'table'
+				END
+			FROM sqlite_master 
+			WHERE type IN ('table', 'view') 
+			AND name != 'migrations' 
+			ORDER BY name`
+	case constants.DriverSQLServer:
+		if schema == "" {
+			schema = "dbo"
+		}
+		query = `
+			SELECT o.name,
+				CASE
+					WHEN o.is_ms_shipped = 1 THEN 'system'
+					WHEN o.type = 'V' THEN 'view'
+					ELSE 'table'
+				END
+			FROM sys.objects o
+			JOIN sys.schemas s ON s.schema_id = o.schema_id
+			WHERE o.type IN ('U', 'V') AND s.name = @p1
+			ORDER BY o.name`
+		args = []any{sql.Named("p1", schema)}
+	default:
+		return nil, fmt.Errorf("unsupported database driver")
+	}
+
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query failed: %v", err)
+	}
+	defer rows.Close()
+
+	result := []Object{}
+	for rows.Next() {
+		var o Object
+		if err := rows.Scan(&o.Name, &o.Kind); err != nil {
+			return nil, fmt.Errorf("scan failed: %v", err)
+		}
+		result = append(result, o)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows error: %v", err)
+	}
+
+	return result, nil
+}
+
+// createViewPrefix matches the "CREATE VIEW name AS" head that SQLite and
+// SQL Server keep in their stored view text
+var createViewPrefix = regexp.MustCompile(`(?is)^\s*CREATE\s+(?:OR\s+ALTER\s+)?(?:TEMP\s+|TEMPORARY\s+)?VIEW\s+.+?\s+AS\s+`)
+
+// ViewDefinition returns the SELECT statement behind a view and its kind
+// (view or materialized_view)
+func ViewDefinition(ctx context.Context, db *sql.DB, drv, schema, view string) (string, string, error) {
+	var (
+		definition sql.NullString
+		kind       = constants.ObjectKindView
+		err        error
+	)
+
+	switch drv {
+	case constants.DriverPostgres:
+		if schema == "" {
+			schema = "public"
+		}
+		var relkind string
+		err = db.QueryRowContext(ctx, `
+			SELECT pg_catalog.pg_get_viewdef(c.oid, true), c.relkind::text
+			FROM pg_catalog.pg_class c
+			JOIN pg_catalog.pg_namespace n ON n.oid = c.relnamespace
+			WHERE n.nspname = $1 AND c.relname = $2 AND c.relkind IN ('v', 'm')`,
+			schema, view).Scan(&definition, &relkind)
+		if relkind == "m" {
+			kind = constants.ObjectKindMaterializedView
+		}
+	case constants.DriverMySQL:
+		err = db.QueryRowContext(ctx, `
+			SELECT view_definition
+			FROM information_schema.views
+			WHERE table_schema = COALESCE(NULLIF(?, ''), DATABASE()) AND table_name = ?`,
+			schema, view).Scan(&definition)
+	case constants.DriverSQLite:
+		err = db.QueryRowContext(ctx,
+			`SELECT sql FROM sqlite_master WHERE type = 'view' AND name = ?`,
+			view).Scan(&definition)
+	case constants.DriverSQLServer:
+		if schema == "" {
+			schema = "dbo"
+		}
+		err = db.QueryRowContext(ctx, `
+			SELECT OBJECT_DEFINITION(v.object_id)
+			FROM sys.views v
+			JOIN sys.schemas s ON v.schema_id = s.schema_id
+			WHERE s.name = @p1 AND v.name = @p2`,
+			sql.Named("p1", schema), sql.Named("p2", view)).Scan(&definition)
+	default:
+		return "", "", fmt.Errorf("unsupported database driver")
+	}
+
+	if err == sql.ErrNoRows {
+		return "", "", fmt.Errorf("view not found: %s", view)
+	}
+	if err != nil {
+		return "", "", fmt.Errorf("query failed: %v", err)
+	}
+
+	return createViewPrefix.ReplaceAllString(definition.String, ""), kind, nil
+}
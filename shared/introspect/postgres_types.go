@@ -0,0 +1,204 @@
+package introspect
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// Sequence describes a PostgreSQL sequence
+type Sequence struct {
+	Schema string `json:"schema"`
+	Name   string `json:"name"`
+	// CurrentValue is nil until nextval has been called at least once
+	CurrentValue *int64 `json:"current_value"`
+	Increment    int64  `json:"increment"`
+	StartValue   int64  `json:"start_value"`
+	MinValue     int64  `json:"min_value"`
+	MaxValue     int64  `json:"max_value"`
+	Cycle        bool   `json:"cycle"`
+	// OwnedBy is the "table.column" owning the sequence (serial/identity), if any
+	OwnedBy string `json:"owned_by"`
+}
+
+// EnumType describes a PostgreSQL enum type and its labels in sort order
+type EnumType struct {
+	Schema string   `json:"schema"`
+	Name   string   `json:"name"`
+	Labels []string `json:"labels"`
+}
+
+// CompositeAttribute is a single field of a composite type
+type CompositeAttribute struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// CompositeType describes a PostgreSQL composite type
+type CompositeType struct {
+	Schema     string               `json:"schema"`
+	Name       string               `json:"name"`
+	Attributes []CompositeAttribute `json:"attributes"`
+}
+
+// DomainType describes a PostgreSQL domain
+type DomainType struct {
+	Schema      string   `json:"schema"`
+	Name        string   `json:"name"`
+	BaseType    string   `json:"base_type"`
+	NotNull     bool     `json:"not_null"`
+	Default     *string  `json:"default"`
+	Constraints []string `json:"constraints"`
+}
+
+// PostgresSequences lists the sequences of a schema with their owning column
+func PostgresSequences(ctx context.Context, db *sql.DB, schema string) ([]Sequence, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT s.schemaname, s.sequencename, s.last_value, s.increment_by, s.start_value,
+			s.min_value, s.max_value, s.cycle,
+			COALESCE(tc.relname || '.' || a.attname, '')
+		FROM pg_catalog.pg_sequences s
+		JOIN pg_catalog.pg_namespace n ON n.nspname = s.schemaname
+		JOIN pg_catalog.pg_class c ON c.relnamespace = n.oid AND c.relname = s.sequencename
+		LEFT JOIN pg_catalog.pg_depend d ON d.objid = c.oid
+			AND d.classid = 'pg_catalog.pg_class'::regclass
+			AND d.refclassid = 'pg_catalog.pg_class'::regclass
+			AND d.deptype IN ('a', 'i')
+		LEFT JOIN pg_catalog.pg_class tc ON tc.oid = d.refobjid
+		LEFT JOIN pg_catalog.pg_attribute a ON a.attrelid = d.refobjid AND a.attnum = d.refobjsubid
+		WHERE s.schemaname = $1
+		ORDER BY s.sequencename`, schema)
+	if err != nil {
+		return nil, fmt.Errorf("query failed: %v", err)
+	}
+	defer rows.Close()
+
+	sequences := []Sequence{}
+	for rows.Next() {
+		var (
+			seq  Sequence
+			last sql.NullInt64
+		)
+		if err := rows.Scan(&seq.Schema, &seq.Name, &last, &seq.Increment, &seq.StartValue,
+			&seq.MinValue, &seq.MaxValue, &seq.Cycle, &seq.OwnedBy); err != nil {
+			return nil, fmt.Errorf("scan failed: %v", err)
+		}
+		if last.Valid {
+			seq.CurrentValue = &last.Int64
+		}
+		sequences = append(sequences, seq)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows error: %v", err)
+	}
+	return sequences, nil
+}
+
+// PostgresEnums lists the enum types of a schema
+func PostgresEnums(ctx context.Context, db *sql.DB, schema string) ([]EnumType, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT n.nspname, t.typname, e.enumlabel
+		FROM pg_catalog.pg_type t
+		JOIN pg_catalog.pg_namespace n ON n.oid = t.typnamespace
+		JOIN pg_catalog.pg_enum e ON e.enumtypid = t.oid
+		WHERE n.nspname = $1
+		ORDER BY t.typname, e.enumsortorder`, schema)
+	if err != nil {
+		return nil, fmt.Errorf("query failed: %v", err)
+	}
+	defer rows.Close()
+
+	enums := []EnumType{}
+	for rows.Next() {
+		var schemaName, name, label string
+		if err := rows.Scan(&schemaName, &name, &label); err != nil {
+			return nil, fmt.Errorf("scan failed: %v", err)
+		}
+		if len(enums) == 0 || enums[len(enums)-1].Name != name {
+			enums = append(enums, EnumType{Schema: schemaName, Name: name, Labels: []string{}})
+		}
+		enums[len(enums)-1].Labels = append(enums[len(enums)-1].Labels, label)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows error: %v", err)
+	}
+	return enums, nil
+}
+
+// PostgresComposites lists the standalone composite types of a schema
+// (composite types implicitly created for tables are excluded)
+func PostgresComposites(ctx context.Context, db *sql.DB, schema string) ([]CompositeType, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT n.nspname, t.typname, a.attname, pg_catalog.format_type(a.atttypid, a.atttypmod)
+		FROM pg_catalog.pg_type t
+		JOIN pg_catalog.pg_namespace n ON n.oid = t.typnamespace
+		JOIN pg_catalog.pg_class c ON c.oid = t.typrelid AND c.relkind = 'c'
+		JOIN pg_catalog.pg_attribute a ON a.attrelid = c.oid AND a.attnum > 0 AND NOT a.attisdropped
+		WHERE n.nspname = $1 AND t.typtype = 'c'
+		ORDER BY t.typname, a.attnum`, schema)
+	if err != nil {
+		return nil, fmt.Errorf("query failed: %v", err)
+	}
+	defer rows.Close()
+
+	composites := []CompositeType{}
+	for rows.Next() {
+		var (
+			schemaName, name string
+			attr             CompositeAttribute
+		)
+		if err := rows.Scan(&schemaName, &name, &attr.Name, &attr.Type); err != nil {
+			return nil, fmt.Errorf("scan failed: %v", err)
+		}
+		if len(composites) == 0 || composites[len(composites)-1].Name != name {
+			composites = append(composites, CompositeType{Schema: schemaName, Name: name, Attributes: []CompositeAttribute{}})
+		}
+		composites[len(composites)-1].Attributes = append(composites[len(composites)-1].Attributes, attr)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows error: %v", err)
+	}
+	return composites, nil
+}
+
+// PostgresDomains lists the domains of a schema with their CHECK constraints
+func PostgresDomains(ctx context.Context, db *sql.DB, schema string) ([]DomainType, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT n.nspname, t.typname, pg_catalog.format_type(t.typbasetype, t.typtypmod),
+			t.typnotnull, t.typdefault, COALESCE(pg_catalog.pg_get_constraintdef(c.oid), '')
+		FROM pg_catalog.pg_type t
+		JOIN pg_catalog.pg_namespace n ON n.oid = t.typnamespace
+		LEFT JOIN pg_catalog.pg_constraint c ON c.contypid = t.oid
+		WHERE n.nspname = $1 AND t.typtype = 'd'
+		ORDER BY t.typname, c.conname`, schema)
+	if err != nil {
+		return nil, fmt.Errorf("query failed: %v", err)
+	}
+	defer rows.Close()
+
+	domains := []DomainType{}
+	for rows.Next() {
+		var (
+			d          DomainType
+			def        sql.NullString
+			constraint string
+		)
+		if err := rows.Scan(&d.Schema, &d.Name, &d.BaseType, &d.NotNull, &def, &constraint); err != nil {
+			return nil, fmt.Errorf("scan failed: %v", err)
+		}
+		if len(domains) == 0 || domains[len(domains)-1].Name != d.Name {
+			if def.Valid {
+				d.Default = &def.String
+			}
+			d.Constraints = []string{}
+			domains = append(domains, d)
+		}
+		if constraint != "" {
+			domains[len(domains)-1].Constraints = append(domains[len(domains)-1].Constraints, constraint)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows error: %v", err)
+	}
+	return domains, nil
+}
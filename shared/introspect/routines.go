@@ -0,0 +1,188 @@
+// Package introspect reads database object metadata (routines, types, ...)
+// in a dialect-aware way so API handlers and other subsystems can share it.
+package introspect
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/dracory/weebase/shared/constants"
+)
+
+// Routine kinds
+const (
+	RoutineFunction  = "function"
+	RoutineProcedure = "procedure"
+)
+
+// Argument describes a single routine parameter
+type Argument struct {
+	Position int    `json:"position"`
+	Name     string `json:"name"`
+	Mode     string `json:"mode"`
+	Type     string `json:"type"`
+}
+
+// IsInput reports whether a value must be supplied by the caller for this argument
+func (a Argument) IsInput() bool {
+	return a.Mode != "OUT"
+}
+
+// IsOutput reports whether the routine returns a value through this argument
+func (a Argument) IsOutput() bool {
+	return a.Mode == "OUT" || a.Mode == "INOUT"
+}
+
+// Routine describes a stored function or procedure
+type Routine struct {
+	// SpecificName identifies an overload uniquely within its schema
+	SpecificName string     `json:"specific_name"`
+	Schema       string     `json:"schema"`
+	Name         string     `json:"name"`
+	Kind         string     `json:"kind"`
+	Arguments    []Argument `json:"arguments"`
+	ReturnType   string     `json:"return_type"`
+	Language     string     `json:"language"`
+	Body         string     `json:"body"`
+}
+
+// Routines lists the functions and procedures in a schema.
+// SQL Server only exposes procedures; SQLite has no routines and returns an empty list.
+func Routines(ctx context.Context, db *sql.DB, drv, schema string) ([]Routine, error) {
+	var (
+		routineQuery string
+		paramQuery   string
+		args         []any
+	)
+
+	switch drv {
+	case constants.DriverPostgres:
+		if schema == "" {
+			schema = "public"
+		}
+		routineQuery = `
+			SELECT p.proname || '_' || p.oid::text, n.nspname, p.proname,
+				CASE p.prokind WHEN 'p' THEN 'procedure' ELSE 'function' END,
+				COALESCE(pg_catalog.pg_get_function_result(p.oid), ''),
+				l.lanname,
+				COALESCE(p.prosrc, '')
+			FROM pg_catalog.pg_proc p
+			JOIN pg_catalog.pg_namespace n ON n.oid = p.pronamespace
+			JOIN pg_catalog.pg_language l ON l.oid = p.prolang
+			WHERE n.nspname = $1 AND p.prokind IN ('f', 'p')
+			ORDER BY p.proname, p.oid`
+		paramQuery = `
+			SELECT specific_name, ordinal_position, COALESCE(parameter_mode, 'IN'), COALESCE(parameter_name, ''),
+				CASE WHEN data_type IN ('USER-DEFINED', 'ARRAY') THEN udt_name ELSE data_type END
+			FROM information_schema.parameters
+			WHERE specific_schema = $1
+			ORDER BY specific_name, ordinal_position`
+		args = []any{schema}
+	case constants.DriverMySQL:
+		routineQuery = `
+			SELECT specific_name, routine_schema, routine_name, LOWER(routine_type),
+				COALESCE(dtd_identifier, ''), COALESCE(routine_body, 'SQL'), COALESCE(routine_definition, '')
+			FROM information_schema.routines
+			WHERE routine_schema = COALESCE(NULLIF(?, ''), DATABASE())
+			ORDER BY routine_name`
+		paramQuery = `
+			SELECT specific_name, ordinal_position, COALESCE(parameter_mode, 'IN'), COALESCE(parameter_name, ''), dtd_identifier
+			FROM information_schema.parameters
+			WHERE specific_schema = COALESCE(NULLIF(?, ''), DATABASE()) AND ordinal_position > 0
+			ORDER BY specific_name, ordinal_position`
+		args = []any{schema}
+	case constants.DriverSQLServer:
+		if schema == "" {
+			schema = "dbo"
+		}
+		routineQuery = `
+			SELECT CAST(p.object_id AS varchar(20)), s.name, p.name, 'procedure', '', 'SQL',
+				COALESCE(OBJECT_DEFINITION(p.object_id), '')
+			FROM sys.procedures p
+			JOIN sys.schemas s ON s.schema_id = p.schema_id
+			WHERE s.name = @p1
+			ORDER BY p.name`
+		paramQuery = `
+			SELECT CAST(pa.object_id AS varchar(20)), pa.parameter_id,
+				CASE WHEN pa.is_output = 1 THEN 'INOUT' ELSE 'IN' END,
+				pa.name, TYPE_NAME(pa.user_type_id)
+			FROM sys.parameters pa
+			JOIN sys.procedures p ON p.object_id = pa.object_id
+			JOIN sys.schemas s ON s.schema_id = p.schema_id
+			WHERE s.name = @p1 AND pa.parameter_id > 0
+			ORDER BY pa.object_id, pa.parameter_id`
+		args = []any{sql.Named("p1", schema)}
+	case constants.DriverSQLite:
+		return []Routine{}, nil
+	default:
+		return nil, fmt.Errorf("unsupported database driver")
+	}
+
+	routines := []Routine{}
+	index := map[string]int{}
+
+	rows, err := db.QueryContext(ctx, routineQuery, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query failed: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var rt Routine
+		if err := rows.Scan(&rt.SpecificName, &rt.Schema, &rt.Name, &rt.Kind, &rt.ReturnType, &rt.Language, &rt.Body); err != nil {
+			return nil, fmt.Errorf("scan failed: %v", err)
+		}
+		rt.Arguments = []Argument{}
+		index[rt.SpecificName] = len(routines)
+		routines = append(routines, rt)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows error: %v", err)
+	}
+
+	paramRows, err := db.QueryContext(ctx, paramQuery, args...)
+	if err != nil {
+		return nil, fmt.Errorf("parameter query failed: %v", err)
+	}
+	defer paramRows.Close()
+
+	for paramRows.Next() {
+		var (
+			specific string
+			arg      Argument
+		)
+		if err := paramRows.Scan(&specific, &arg.Position, &arg.Mode, &arg.Name, &arg.Type); err != nil {
+			return nil, fmt.Errorf("scan failed: %v", err)
+		}
+		arg.Name = strings.TrimPrefix(arg.Name, "@")
+		arg.Mode = strings.ToUpper(arg.Mode)
+		if i, ok := index[specific]; ok {
+			routines[i].Arguments = append(routines[i].Arguments, arg)
+		}
+	}
+	if err := paramRows.Err(); err != nil {
+		return nil, fmt.Errorf("rows error: %v", err)
+	}
+
+	return routines, nil
+}
+
+// FindRoutine looks up a routine by name. When several overloads share the name,
+// specificName selects one of them; otherwise the first match is returned.
+func FindRoutine(ctx context.Context, db *sql.DB, drv, schema, name, specificName string) (Routine, error) {
+	routines, err := Routines(ctx, db, drv, schema)
+	if err != nil {
+		return Routine{}, err
+	}
+	for _, rt := range routines {
+		if rt.Name != name {
+			continue
+		}
+		if specificName == "" || rt.SpecificName == specificName {
+			return rt, nil
+		}
+	}
+	return Routine{}, fmt.Errorf("routine not found: %s", name)
+}
@@ -0,0 +1,86 @@
+package introspect
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/dracory/weebase/shared/constants"
+	"github.com/dracory/weebase/shared/dialect"
+)
+
+// View is a view definition within a schema snapshot
+type View struct {
+	Name         string `json:"name"`
+	Materialized bool   `json:"materialized"`
+	Definition   string `json:"definition"`
+}
+
+// Schema is a point-in-time description of every table, view and routine in a schema
+type Schema struct {
+	Driver   string    `json:"driver"`
+	Name     string    `json:"name"`
+	Tables   []Table   `json:"tables"`
+	Views    []View    `json:"views"`
+	Routines []Routine `json:"routines"`
+}
+
+// Table returns the named table and whether it exists in the snapshot
+func (s Schema) Table(name string) (Table, bool) {
+	for _, t := range s.Tables {
+		if t.Name == name {
+			return t, true
+		}
+	}
+	return Table{}, false
+}
+
+// View returns the named view and whether it exists in the snapshot
+func (s Schema) View(name string) (View, bool) {
+	for _, v := range s.Views {
+		if v.Name == name {
+			return v, true
+		}
+	}
+	return View{}, false
+}
+
+// Snapshot introspects all user tables, views and routines of a schema.
+// System objects are skipped.
+func Snapshot(ctx context.Context, db *sql.DB, drv, schema string) (Schema, error) {
+	drv = dialect.Normalize(drv)
+	if schema == "" {
+		schema = dialect.DefaultSchema(drv)
+	}
+	s := Schema{Driver: drv, Name: schema, Tables: []Table{}, Views: []View{}}
+
+	objects, err := Objects(ctx, db, drv, schema)
+	if err != nil {
+		return s, err
+	}
+
+	for _, o := range objects {
+		switch o.Kind {
+		case constants.ObjectKindTable:
+			t, err := DescribeTable(ctx, db, drv, schema, o.Name)
+			if err != nil {
+				return s, err
+			}
+			s.Tables = append(s.Tables, t)
+		case constants.ObjectKindView, constants.ObjectKindMaterializedView:
+			definition, kind, err := ViewDefinition(ctx, db, drv, schema, o.Name)
+			if err != nil {
+				return s, err
+			}
+			s.Views = append(s.Views, View{
+				Name:         o.Name,
+				Materialized: kind == constants.ObjectKindMaterializedView,
+				Definition:   definition,
+			})
+		}
+	}
+
+	if s.Routines, err = Routines(ctx, db, drv, schema); err != nil {
+		return s, err
+	}
+	return s, nil
+}
@@ -0,0 +1,590 @@
+package introspect
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/dracory/weebase/shared/constants"
+	"github.com/dracory/weebase/shared/dialect"
+)
+
+// Constraint types as reported in Constraint.Type
+const (
+	ConstraintPrimaryKey = "PRIMARY KEY"
+	ConstraintForeignKey = "FOREIGN KEY"
+	ConstraintUnique     = "UNIQUE"
+	ConstraintCheck      = "CHECK"
+)
+
+// Column describes a table column. Type is the driver's own spelling
+// (e.g. "character varying(255)" on PostgreSQL, "varchar(255)" on MySQL).
+type Column struct {
+	Name          string  `json:"name"`
+	Position      int     `json:"position"`
+	Type          string  `json:"type"`
+	Nullable      bool    `json:"nullable"`
+	Default       *string `json:"default,omitempty"`
+	AutoIncrement bool    `json:"auto_increment"`
+}
+
+// Index describes a table index; expression indexes are reported
+// with the plain columns they reference only
+type Index struct {
+	Name    string   `json:"name"`
+	Columns []string `json:"columns"`
+	Unique  bool     `json:"unique"`
+	Primary bool     `json:"primary"`
+}
+
+// Constraint describes a primary key, foreign key, unique or check constraint.
+// Definition holds the database's own text and is mainly useful for CHECK.
+type Constraint struct {
+	Name       string   `json:"name"`
+	Type       string   `json:"type"`
+	Columns    []string `json:"columns"`
+	RefSchema  string   `json:"ref_schema,omitempty"`
+	RefTable   string   `json:"ref_table,omitempty"`
+	RefColumns []string `json:"ref_columns,omitempty"`
+	OnDelete   string   `json:"on_delete,omitempty"`
+	OnUpdate   string   `json:"on_update,omitempty"`
+	Definition string   `json:"definition,omitempty"`
+}
+
+// Table is the full structure of a table
+type Table struct {
+	Schema      string       `json:"schema"`
+	Name        string       `json:"name"`
+	Columns     []Column     `json:"columns"`
+	Indexes     []Index      `json:"indexes"`
+	Constraints []Constraint `json:"constraints"`
+}
+
+// PrimaryKey returns the primary key columns of the table, if any
+func (t Table) PrimaryKey() []string {
+	for _, c := range t.Constraints {
+		if c.Type == ConstraintPrimaryKey {
+			return c.Columns
+		}
+	}
+	for _, ix := range t.Indexes {
+		if ix.Primary {
+			return ix.Columns
+		}
+	}
+	return nil
+}
+
+// BacksConstraint reports whether an index exists only to back the primary key
+// or a constraint, and so is created along with it
+func (t Table) BacksConstraint(ix Index) bool {
+	if ix.Primary || strings.HasPrefix(ix.Name, "sqlite_autoindex_") {
+		return true
+	}
+	for _, c := range t.Constraints {
+		if c.Name == ix.Name {
+			return true
+		}
+	}
+	return false
+}
+
+// Column returns the named column and whether it exists
+func (t Table) Column(name string) (Column, bool) {
+	for _, c := range t.Columns {
+		if c.Name == name {
+			return c, true
+		}
+	}
+	return Column{}, false
+}
+
+// DescribeTable reads columns, indexes and constraints of a single table
+func DescribeTable(ctx context.Context, db *sql.DB, drv, schema, table string) (Table, error) {
+	if schema == "" {
+		schema = dialect.DefaultSchema(drv)
+	}
+	t := Table{Schema: schema, Name: table}
+
+	var err error
+	if t.Columns, err = tableColumns(ctx, db, drv, schema, table); err != nil {
+		return t, err
+	}
+	if len(t.Columns) == 0 {
+		return t, fmt.Errorf("table not found: %s", table)
+	}
+	if t.Indexes, err = tableIndexes(ctx, db, drv, schema, table); err != nil {
+		return t, err
+	}
+	if t.Constraints, err = tableConstraints(ctx, db, drv, schema, table); err != nil {
+		return t, err
+	}
+	if drv == constants.DriverSQLite {
+		// SQLite reports UNIQUE constraints only through their automatic indexes
+		for _, ix := range t.Indexes {
+			if ix.Unique && !ix.Primary && strings.HasPrefix(ix.Name, "sqlite_autoindex_") {
+				t.Constraints = append(t.Constraints, Constraint{Name: ix.Name, Type: ConstraintUnique, Columns: ix.Columns})
+			}
+		}
+	}
+	return t, nil
+}
+
+func tableColumns(ctx context.Context, db *sql.DB, drv, schema, table string) ([]Column, error) {
+	var (
+		query string
+		args  []any
+	)
+
+	switch drv {
+	case constants.DriverPostgres:
+		query = `
+			SELECT a.attname, a.attnum, pg_catalog.format_type(a.atttypid, a.atttypmod),
+				NOT a.attnotnull, pg_catalog.pg_get_expr(d.adbin, d.adrelid),
+				a.attidentity <> '' OR COALESCE(pg_catalog.pg_get_expr(d.adbin, d.adrelid), '') LIKE 'nextval(%'
+			FROM pg_catalog.pg_attribute a
+			JOIN pg_catalog.pg_class c ON c.oid = a.attrelid
+			JOIN pg_catalog.pg_namespace n ON n.oid = c.relnamespace
+			LEFT JOIN pg_catalog.pg_attrdef d ON d.adrelid = a.attrelid AND d.adnum = a.attnum
+			WHERE n.nspname = $1 AND c.relname = $2 AND a.attnum > 0 AND NOT a.attisdropped
+			ORDER BY a.attnum`
+		args = []any{schema, table}
+	case constants.DriverMySQL:
+		query = `
+			SELECT column_name, ordinal_position, column_type, is_nullable = 'YES',
+				column_default, extra LIKE '%auto_increment%'
+			FROM information_schema.columns
+			WHERE table_schema = COALESCE(NULLIF(?, ''), DATABASE()) AND table_name = ?
+			ORDER BY ordinal_position`
+		args = []any{schema, table}
+	case constants.DriverSQLite:
+		return sqliteColumns(ctx, db, table)
+	case constants.DriverSQLServer:
+		query = `
+			SELECT c.name, c.column_id,
+				t.name + CASE
+					WHEN t.name IN ('varchar', 'char', 'varbinary', 'binary') THEN
+						'(' + CASE WHEN c.max_length = -1 THEN 'max' ELSE CAST(c.max_length AS varchar(10)) END + ')'
+					WHEN t.name IN ('nvarchar', 'nchar') THEN
+						'(' + CASE WHEN c.max_length = -1 THEN 'max' ELSE CAST(c.max_length / 2 AS varchar(10)) END + ')'
+					WHEN t.name IN ('decimal', 'numeric') THEN
+						'(' + CAST(c.precision AS varchar(10)) + ',' + CAST(c.scale AS varchar(10)) + ')'
+					ELSE ''
+				END,
+				c.is_nullable, OBJECT_DEFINITION(c.default_object_id), c.is_identity
+			FROM sys.columns c
+			JOIN sys.types t ON t.user_type_id = c.user_type_id
+			JOIN sys.tables tb ON tb.object_id = c.object_id
+			JOIN sys.schemas s ON s.schema_id = tb.schema_id
+			WHERE s.name = @p1 AND tb.name = @p2
+			ORDER BY c.column_id`
+		args = []any{sql.Named("p1", schema), sql.Named("p2", table)}
+	default:
+		return nil, fmt.Errorf("unsupported database driver")
+	}
+
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read columns: %v", err)
+	}
+	defer rows.Close()
+
+	columns := []Column{}
+	for rows.Next() {
+		var (
+			c   Column
+			def sql.NullString
+		)
+		if err := rows.Scan(&c.Name, &c.Position, &c.Type, &c.Nullable, &def, &c.AutoIncrement); err != nil {
+			return nil, fmt.Errorf("failed to scan column: %v", err)
+		}
+		if def.Valid {
+			c.Default = &def.String
+		}
+		columns = append(columns, c)
+	}
+	return columns, rows.Err()
+}
+
+func sqliteColumns(ctx context.Context, db *sql.DB, table string) ([]Column, error) {
+	var createSQL sql.NullString
+	_ = db.QueryRowContext(ctx, `SELECT sql FROM sqlite_master WHERE type = 'table' AND name = ?`, table).Scan(&createSQL)
+	autoIncrement := strings.Contains(strings.ToUpper(createSQL.String), "AUTOINCREMENT")
+
+	rows, err := db.QueryContext(ctx, "PRAGMA table_info("+dialect.QuoteIdent(constants.DriverSQLite, table)+")")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read columns: %v", err)
+	}
+	defer rows.Close()
+
+	columns := []Column{}
+	pkCount := 0
+	for rows.Next() {
+		var (
+			cid, notNull, pk int
+			c                Column
+			def              sql.NullString
+		)
+		if err := rows.Scan(&cid, &c.Name, &c.Type, &notNull, &def, &pk); err != nil {
+			return nil, fmt.Errorf("failed to scan column: %v", err)
+		}
+		c.Position = cid + 1
+		c.Nullable = notNull == 0 && pk == 0
+		if def.Valid {
+			c.Default = &def.String
+		}
+		if pk > 0 {
+			pkCount++
+			// only a lone INTEGER PRIMARY KEY is a rowid alias
+			c.AutoIncrement = autoIncrement || strings.EqualFold(c.Type, "integer")
+		}
+		columns = append(columns, c)
+	}
+	if pkCount > 1 {
+		for i := range columns {
+			columns[i].AutoIncrement = false
+		}
+	}
+	return columns, rows.Err()
+}
+
+func tableIndexes(ctx context.Context, db *sql.DB, drv, schema, table string) ([]Index, error) {
+	var (
+		query string
+		args  []any
+	)
+
+	switch drv {
+	case constants.DriverPostgres:
+		query = `
+			SELECT i.relname, ix.indisunique, ix.indisprimary, a.attname
+			FROM pg_catalog.pg_index ix
+			JOIN pg_catalog.pg_class t ON t.oid = ix.indrelid
+			JOIN pg_catalog.pg_class i ON i.oid = ix.indexrelid
+			JOIN pg_catalog.pg_namespace n ON n.oid = t.relnamespace
+			CROSS JOIN LATERAL unnest(ix.indkey) WITH ORDINALITY AS k(attnum, ord)
+			JOIN pg_catalog.pg_attribute a ON a.attrelid = t.oid AND a.attnum = k.attnum
+			WHERE n.nspname = $1 AND t.relname = $2
+			ORDER BY i.relname, k.ord`
+		args = []any{schema, table}
+	case constants.DriverMySQL:
+		query = `
+			SELECT index_name, non_unique = 0, index_name = 'PRIMARY', column_name
+			FROM information_schema.statistics
+			WHERE table_schema = COALESCE(NULLIF(?, ''), DATABASE()) AND table_name = ?
+			ORDER BY index_name, seq_in_index`
+		args = []any{schema, table}
+	case constants.DriverSQLite:
+		return sqliteIndexes(ctx, db, table)
+	case constants.DriverSQLServer:
+		query = `
+			SELECT i.name, i.is_unique, i.is_primary_key, c.name
+			FROM sys.indexes i
+			JOIN sys.index_columns ic ON ic.object_id = i.object_id AND ic.index_id = i.index_id
+			JOIN sys.columns c ON c.object_id = ic.object_id AND c.column_id = ic.column_id
+			JOIN sys.tables t ON t.object_id = i.object_id
+			JOIN sys.schemas s ON s.schema_id = t.schema_id
+			WHERE s.name = @p1 AND t.name = @p2 AND i.type > 0 AND ic.is_included_column = 0
+			ORDER BY i.name, ic.key_ordinal`
+		args = []any{sql.Named("p1", schema), sql.Named("p2", table)}
+	default:
+		return nil, fmt.Errorf("unsupported database driver")
+	}
+
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read indexes: %v", err)
+	}
+	defer rows.Close()
+
+	indexes := []Index{}
+	for rows.Next() {
+		var (
+			name, column    string
+			unique, primary bool
+		)
+		if err := rows.Scan(&name, &unique, &primary, &column); err != nil {
+			return nil, fmt.Errorf("failed to scan index: %v", err)
+		}
+		if n := len(indexes); n > 0 && indexes[n-1].Name == name {
+			indexes[n-1].Columns = append(indexes[n-1].Columns, column)
+			continue
+		}
+		indexes = append(indexes, Index{Name: name, Columns: []string{column}, Unique: unique, Primary: primary})
+	}
+	return indexes, rows.Err()
+}
+
+func sqliteIndexes(ctx context.Context, db *sql.DB, table string) ([]Index, error) {
+	rows, err := db.QueryContext(ctx, "PRAGMA index_list("+dialect.QuoteIdent(constants.DriverSQLite, table)+")")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read indexes: %v", err)
+	}
+
+	indexes := []Index{}
+	for rows.Next() {
+		var (
+			seq, unique, partial int
+			name, origin         string
+		)
+		if err := rows.Scan(&seq, &name, &unique, &origin, &partial); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan index: %v", err)
+		}
+		indexes = append(indexes, Index{Name: name, Unique: unique == 1, Primary: origin == "pk"})
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range indexes {
+		cols, err := db.QueryContext(ctx, "PRAGMA index_info("+dialect.QuoteIdent(constants.DriverSQLite, indexes[i].Name)+")")
+		if err != nil {
+			return nil, fmt.Errorf("failed to read index columns: %v", err)
+		}
+		for cols.Next() {
+			var (
+				seqno, cid int
+				name       sql.NullString
+			)
+			if err := cols.Scan(&seqno, &cid, &name); err != nil {
+				cols.Close()
+				return nil, fmt.Errorf("failed to scan index column: %v", err)
+			}
+			if name.Valid {
+				indexes[i].Columns = append(indexes[i].Columns, name.String)
+			}
+		}
+		cols.Close()
+	}
+
+	// order by name so that results compare stably with other drivers
+	sort.Slice(indexes, func(i, j int) bool { return indexes[i].Name < indexes[j].Name })
+	return indexes, nil
+}
+
+func tableConstraints(ctx context.Context, db *sql.DB, drv, schema, table string) ([]Constraint, error) {
+	var (
+		query string
+		args  []any
+	)
+
+	switch drv {
+	case constants.DriverPostgres:
+		// Column lists are joined with a unit separator so names containing commas survive.
+		query = `
+			SELECT c.conname,
+				CASE c.contype WHEN 'p' THEN 'PRIMARY KEY' WHEN 'f' THEN 'FOREIGN KEY' WHEN 'u' THEN 'UNIQUE' ELSE 'CHECK' END,
+				array_to_string(ARRAY(
+					SELECT a.attname FROM unnest(c.conkey) WITH ORDINALITY AS k(attnum, ord)
+					JOIN pg_catalog.pg_attribute a ON a.attrelid = c.conrelid AND a.attnum = k.attnum
+					ORDER BY k.ord), chr(31)),
+				COALESCE(rn.nspname, ''), COALESCE(rt.relname, ''),
+				array_to_string(ARRAY(
+					SELECT a.attname FROM unnest(c.confkey) WITH ORDINALITY AS k(attnum, ord)
+					JOIN pg_catalog.pg_attribute a ON a.attrelid = c.confrelid AND a.attnum = k.attnum
+					ORDER BY k.ord), chr(31)),
+				CASE c.confdeltype WHEN 'c' THEN 'CASCADE' WHEN 'n' THEN 'SET NULL' WHEN 'd' THEN 'SET DEFAULT' WHEN 'r' THEN 'RESTRICT' ELSE '' END,
+				CASE c.confupdtype WHEN 'c' THEN 'CASCADE' WHEN 'n' THEN 'SET NULL' WHEN 'd' THEN 'SET DEFAULT' WHEN 'r' THEN 'RESTRICT' ELSE '' END,
+				pg_catalog.pg_get_constraintdef(c.oid, true)
+			FROM pg_catalog.pg_constraint c
+			JOIN pg_catalog.pg_class t ON t.oid = c.conrelid
+			JOIN pg_catalog.pg_namespace n ON n.oid = t.relnamespace
+			LEFT JOIN pg_catalog.pg_class rt ON rt.oid = c.confrelid
+			LEFT JOIN pg_catalog.pg_namespace rn ON rn.oid = rt.relnamespace
+			WHERE n.nspname = $1 AND t.relname = $2 AND c.contype IN ('p', 'f', 'u', 'c')
+			ORDER BY c.conname`
+		args = []any{schema, table}
+		return scanJoinedConstraints(ctx, db, query, args)
+	case constants.DriverMySQL:
+		query = `
+			SELECT tc.constraint_name, tc.constraint_type, kcu.column_name,
+				COALESCE(kcu.referenced_table_schema, ''), COALESCE(kcu.referenced_table_name, ''),
+				COALESCE(kcu.referenced_column_name, ''),
+				COALESCE(rc.delete_rule, ''), COALESCE(rc.update_rule, ''), ''
+			FROM information_schema.table_constraints tc
+			JOIN information_schema.key_column_usage kcu
+				ON kcu.constraint_schema = tc.constraint_schema
+				AND kcu.constraint_name = tc.constraint_name
+				AND kcu.table_name = tc.table_name
+			LEFT JOIN information_schema.referential_constraints rc
+				ON rc.constraint_schema = tc.constraint_schema
+				AND rc.constraint_name = tc.constraint_name
+			WHERE tc.table_schema = COALESCE(NULLIF(?, ''), DATABASE()) AND tc.table_name = ?
+			AND tc.constraint_type IN ('PRIMARY KEY', 'UNIQUE', 'FOREIGN KEY')
+			ORDER BY tc.constraint_name, kcu.ordinal_position`
+		args = []any{schema, table}
+	case constants.DriverSQLite:
+		return sqliteConstraints(ctx, db, table)
+	case constants.DriverSQLServer:
+		query = `
+			SELECT tc.constraint_name, tc.constraint_type, kcu.column_name, '', '', '', '', '', ''
+			FROM information_schema.table_constraints tc
+			JOIN information_schema.key_column_usage kcu
+				ON kcu.constraint_schema = tc.constraint_schema AND kcu.constraint_name = tc.constraint_name
+			WHERE tc.table_schema = @p1 AND tc.table_name = @p2
+			AND tc.constraint_type IN ('PRIMARY KEY', 'UNIQUE')
+			UNION ALL
+			SELECT fk.name, 'FOREIGN KEY', pc.name, rs.name, rt.name, rc.name,
+				REPLACE(fk.delete_referential_action_desc, '_', ' '),
+				REPLACE(fk.update_referential_action_desc, '_', ' '), ''
+			FROM sys.foreign_keys fk
+			JOIN sys.foreign_key_columns fkc ON fkc.constraint_object_id = fk.object_id
+			JOIN sys.tables t ON t.object_id = fk.parent_object_id
+			JOIN sys.schemas s ON s.schema_id = t.schema_id
+			JOIN sys.columns pc ON pc.object_id = fkc.parent_object_id AND pc.column_id = fkc.parent_column_id
+			JOIN sys.tables rt ON rt.object_id = fkc.referenced_object_id
+			JOIN sys.schemas rs ON rs.schema_id = rt.schema_id
+			JOIN sys.columns rc ON rc.object_id = fkc.referenced_object_id AND rc.column_id = fkc.referenced_column_id
+			WHERE s.name = @p1 AND t.name = @p2
+			UNION ALL
+			SELECT cc.name, 'CHECK', '', '', '', '', '', '', cc.definition
+			FROM sys.check_constraints cc
+			JOIN sys.tables t ON t.object_id = cc.parent_object_id
+			JOIN sys.schemas s ON s.schema_id = t.schema_id
+			WHERE s.name = @p1 AND t.name = @p2
+			ORDER BY 1`
+		args = []any{sql.Named("p1", schema), sql.Named("p2", table)}
+	default:
+		return nil, fmt.Errorf("unsupported database driver")
+	}
+
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read constraints: %v", err)
+	}
+	defer rows.Close()
+
+	constraints := []Constraint{}
+	for rows.Next() {
+		var c Constraint
+		var column, refColumn string
+		if err := rows.Scan(&c.Name, &c.Type, &column, &c.RefSchema, &c.RefTable, &refColumn, &c.OnDelete, &c.OnUpdate, &c.Definition); err != nil {
+			return nil, fmt.Errorf("failed to scan constraint: %v", err)
+		}
+		c.OnDelete, c.OnUpdate = noAction(c.OnDelete), noAction(c.OnUpdate)
+		n := len(constraints)
+		if n == 0 || constraints[n-1].Name != c.Name {
+			constraints = append(constraints, c)
+			n++
+		}
+		if column != "" {
+			constraints[n-1].Columns = append(constraints[n-1].Columns, column)
+		}
+		if refColumn != "" {
+			constraints[n-1].RefColumns = append(constraints[n-1].RefColumns, refColumn)
+		}
+	}
+	return constraints, rows.Err()
+}
+
+// scanJoinedConstraints scans constraint rows whose column lists arrive joined by chr(31)
+func scanJoinedConstraints(ctx context.Context, db *sql.DB, query string, args []any) ([]Constraint, error) {
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read constraints: %v", err)
+	}
+	defer rows.Close()
+
+	constraints := []Constraint{}
+	for rows.Next() {
+		var c Constraint
+		var columns, refColumns string
+		if err := rows.Scan(&c.Name, &c.Type, &columns, &c.RefSchema, &c.RefTable, &refColumns, &c.OnDelete, &c.OnUpdate, &c.Definition); err != nil {
+			return nil, fmt.Errorf("failed to scan constraint: %v", err)
+		}
+		c.Columns = splitNonEmpty(columns, "\x1f")
+		c.RefColumns = splitNonEmpty(refColumns, "\x1f")
+		constraints = append(constraints, c)
+	}
+	return constraints, rows.Err()
+}
+
+func sqliteConstraints(ctx context.Context, db *sql.DB, table string) ([]Constraint, error) {
+	constraints := []Constraint{}
+
+	// PRAGMA table_info reports the key position in the pk column; re-read it for ordering
+	rows, err := db.QueryContext(ctx, "PRAGMA table_info("+dialect.QuoteIdent(constants.DriverSQLite, table)+")")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read constraints: %v", err)
+	}
+	pk := map[int]string{}
+	for rows.Next() {
+		var (
+			cid, notNull, pos int
+			name, typ         string
+			def               sql.NullString
+		)
+		if err := rows.Scan(&cid, &name, &typ, &notNull, &def, &pos); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan column: %v", err)
+		}
+		if pos > 0 {
+			pk[pos] = name
+		}
+	}
+	rows.Close()
+	if len(pk) > 0 {
+		c := Constraint{Name: "pk_" + table, Type: ConstraintPrimaryKey}
+		for i := 1; i <= len(pk); i++ {
+			c.Columns = append(c.Columns, pk[i])
+		}
+		constraints = append(constraints, c)
+	}
+
+	fks, err := db.QueryContext(ctx, "PRAGMA foreign_key_list("+dialect.QuoteIdent(constants.DriverSQLite, table)+")")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read foreign keys: %v", err)
+	}
+	defer fks.Close()
+
+	byID := map[int]int{}
+	for fks.Next() {
+		var (
+			id, seq                            int
+			refTable, from, onUpdate, onDelete string
+			to                                 sql.NullString
+			match                              string
+		)
+		if err := fks.Scan(&id, &seq, &refTable, &from, &to, &onUpdate, &onDelete, &match); err != nil {
+			return nil, fmt.Errorf("failed to scan foreign key: %v", err)
+		}
+		i, ok := byID[id]
+		if !ok {
+			constraints = append(constraints, Constraint{
+				Name:     fmt.Sprintf("fk_%s_%d", table, id),
+				Type:     ConstraintForeignKey,
+				RefTable: refTable,
+				OnDelete: noAction(onDelete),
+				OnUpdate: noAction(onUpdate),
+			})
+			i = len(constraints) - 1
+			byID[id] = i
+		}
+		constraints[i].Columns = append(constraints[i].Columns, from)
+		// an omitted target column refers to the parent's primary key
+		if to.Valid && to.String != "" {
+			constraints[i].RefColumns = append(constraints[i].RefColumns, to.String)
+		}
+	}
+	return constraints, fks.Err()
+}
+
+// noAction maps the default referential action to an empty string
+// so that it compares equal across drivers
+func noAction(action string) string {
+	if strings.EqualFold(action, "NO ACTION") {
+		return ""
+	}
+	return strings.ToUpper(action)
+}
+
+func splitNonEmpty(s, sep string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, sep)
+}
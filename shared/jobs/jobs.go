@@ -0,0 +1,436 @@
+// Package jobs runs long operations, such as exports, imports, dumps and
+// table copies, in the background so they don't outrun HTTP timeouts. A
+// Runner executes them in a bounded worker pool, keeps their state in a
+// Store and their output files in an artifact directory until they expire.
+// The package also keeps uploaded files between the requests of an import.
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/dracory/weebase/shared/session"
+)
+
+// Job states
+const (
+	StateQueued    = "queued"
+	StateRunning   = "running"
+	StateDone      = "done"
+	StateFailed    = "failed"
+	StateCancelled = "cancelled"
+)
+
+// Job kinds
+const (
+	KindExport    = "export"
+	KindDump      = "dump"
+	KindImport    = "import"
+	KindSQLImport = "sql_import"
+	KindTableCopy = "table_copy"
+	KindDataDiff  = "data_diff"
+	KindBackup    = "backup"
+	KindRestore   = "restore"
+)
+
+// Defaults for Options
+const (
+	DefaultWorkers     = 2
+	DefaultArtifactTTL = time.Hour
+)
+
+// Status is the state of a background job
+type Status struct {
+	ID    string `json:"id"`
+	Kind  string `json:"kind"`
+	State string `json:"state"`
+	// Result is the latest progress report, and the outcome once finished
+	Result any    `json:"result"`
+	Error  string `json:"error,omitempty"`
+	// BytesRead and Size tell how far through its input the job is
+	BytesRead int64      `json:"bytes_read"`
+	Size      int64      `json:"size"`
+	Created   time.Time  `json:"created"`
+	Started   *time.Time `json:"started,omitempty"`
+	Finished  *time.Time `json:"finished,omitempty"`
+	// Artifact is the file the job produced, if any
+	Artifact *Artifact `json:"artifact,omitempty"`
+	// Expires is when the job and its artifact are removed
+	Expires *time.Time `json:"expires,omitempty"`
+}
+
+// Done tells whether the job reached a final state
+func (s Status) Done() bool {
+	return s.State == StateDone || s.State == StateFailed || s.State == StateCancelled
+}
+
+// Artifact describes the output file of a job
+type Artifact struct {
+	Name        string `json:"name"`
+	ContentType string `json:"content_type"`
+	Size        int64  `json:"size"`
+}
+
+// Options configures a Runner
+type Options struct {
+	// Workers is the number of jobs run at the same time (default 2)
+	Workers int
+	// ArtifactTTL is how long a finished job and its artifact are kept (default 1h)
+	ArtifactTTL time.Duration
+	// ArtifactDir holds the artifacts (default: weebase-jobs in the temp dir)
+	ArtifactDir string
+}
+
+// Spec describes a job to submit
+type Spec struct {
+	Kind  string
+	Owner string
+	// Input is read by the job and closed when it ends; it may be nil
+	Input io.ReadCloser
+	// Size is the length of Input, for progress reports
+	Size int64
+	Run  Func
+}
+
+// Func is the work of a job. It reads the task's input, reports progress
+// and may write an artifact; the value it returns becomes the job's result.
+type Func func(ctx context.Context, t *Task) (any, error)
+
+// Task is the view a running job has of itself
+type Task struct {
+	// Input is the job's input, empty when none was given
+	Input io.Reader
+
+	job  *job
+	file *os.File
+	dir  string
+}
+
+// Progress publishes an intermediate result
+func (t *Task) Progress(result any) {
+	t.job.mu.Lock()
+	t.job.status.Result = result
+	t.job.mu.Unlock()
+}
+
+// Artifact creates the output file of the job, offered for download under
+// name once the job is done. A job has at most one artifact.
+func (t *Task) Artifact(name, contentType string) (io.Writer, error) {
+	if t.file != nil {
+		return nil, errors.New("artifact already created")
+	}
+	f, err := os.CreateTemp(t.dir, "artifact-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create artifact: %v", err)
+	}
+	t.file = f
+	t.job.mu.Lock()
+	t.job.status.Artifact = &Artifact{Name: name, ContentType: contentType}
+	t.job.artifactPath = f.Name()
+	t.job.mu.Unlock()
+	return f, nil
+}
+
+// job is the live state of a queued or running job
+type job struct {
+	mu           sync.Mutex
+	owner        string
+	status       Status
+	artifactPath string
+	read         atomic.Int64
+	cancel       context.CancelFunc
+}
+
+func (j *job) record() Record {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	status := j.status
+	status.BytesRead = j.read.Load()
+	return Record{Status: status, Owner: j.owner, ArtifactPath: j.artifactPath}
+}
+
+// Runner runs jobs in a bounded worker pool
+type Runner struct {
+	store Store
+	ttl   time.Duration
+	dir   string
+	slots chan struct{}
+
+	mu   sync.Mutex
+	live map[string]*job
+}
+
+// NewRunner creates a Runner keeping job state in store. Jobs the store
+// still lists as queued or running were cut short by a restart and are
+// marked failed.
+func NewRunner(store Store, opts Options) *Runner {
+	if opts.Workers < 1 {
+		opts.Workers = DefaultWorkers
+	}
+	if opts.ArtifactTTL <= 0 {
+		opts.ArtifactTTL = DefaultArtifactTTL
+	}
+	if opts.ArtifactDir == "" {
+		opts.ArtifactDir = filepath.Join(os.TempDir(), "weebase-jobs")
+	}
+	r := &Runner{
+		store: store,
+		ttl:   opts.ArtifactTTL,
+		dir:   opts.ArtifactDir,
+		slots: make(chan struct{}, opts.Workers),
+		live:  map[string]*job{},
+	}
+
+	records, err := store.List(context.Background(), "")
+	if err != nil {
+		slog.Error("failed to read job store", slog.String("error", err.Error()))
+		return r
+	}
+	for _, rec := range records {
+		if rec.Done() {
+			continue
+		}
+		now := time.Now()
+		rec.State = StateFailed
+		rec.Error = "interrupted by a restart"
+		rec.Finished = &now
+		rec.Expires = r.expiry(now)
+		if err := store.Put(context.Background(), rec); err != nil {
+			slog.Error("failed to update job", slog.String("job", rec.ID), slog.String("error", err.Error()))
+		}
+	}
+	return r
+}
+
+// Submit queues a job and returns its id. The job starts once a worker is
+// free; its status is available from Get until the artifact TTL after it
+// finished.
+func (r *Runner) Submit(spec Spec) (string, error) {
+	input := spec.Input
+	if input == nil {
+		input = io.NopCloser(strings.NewReader(""))
+	}
+	if err := os.MkdirAll(r.dir, 0o700); err != nil {
+		input.Close()
+		return "", fmt.Errorf("failed to create artifact directory: %v", err)
+	}
+	r.sweep()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	j := &job{
+		owner:  spec.Owner,
+		cancel: cancel,
+		status: Status{ID: session.NewRandomID(), Kind: spec.Kind, State: StateQueued, Size: spec.Size, Created: time.Now()},
+	}
+	if err := r.store.Put(ctx, j.record()); err != nil {
+		cancel()
+		input.Close()
+		return "", fmt.Errorf("failed to store job: %v", err)
+	}
+	r.mu.Lock()
+	r.live[j.status.ID] = j
+	r.mu.Unlock()
+
+	go r.run(ctx, j, input, spec.Run)
+	return j.status.ID, nil
+}
+
+// run waits for a free worker, runs the job and stores its outcome
+func (r *Runner) run(ctx context.Context, j *job, input io.ReadCloser, fn Func) {
+	defer j.cancel()
+	defer input.Close()
+
+	task := &Task{Input: &countingReader{r: input, n: &j.read}, job: j, dir: r.dir}
+	var result any
+	var err error
+	select {
+	case r.slots <- struct{}{}:
+		now := time.Now()
+		j.mu.Lock()
+		j.status.State = StateRunning
+		j.status.Started = &now
+		j.mu.Unlock()
+		r.save(j)
+
+		result, err = fn(ctx, task)
+		<-r.slots
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	if task.file != nil {
+		size, statErr := task.file.Seek(0, io.SeekEnd)
+		if closeErr := task.file.Close(); statErr == nil {
+			statErr = closeErr
+		}
+		if err == nil && statErr != nil {
+			err = fmt.Errorf("failed to write artifact: %v", statErr)
+		}
+		j.mu.Lock()
+		j.status.Artifact.Size = size
+		j.mu.Unlock()
+	}
+
+	now := time.Now()
+	j.mu.Lock()
+	j.status.Result = result
+	j.status.Finished = &now
+	j.status.Expires = r.expiry(now)
+	switch {
+	case errors.Is(err, context.Canceled):
+		j.status.State = StateCancelled
+	case err != nil:
+		j.status.State = StateFailed
+		j.status.Error = err.Error()
+	default:
+		j.status.State = StateDone
+	}
+	if j.status.State != StateDone && j.artifactPath != "" {
+		// a partial file is no use to anyone
+		os.Remove(j.artifactPath)
+		j.artifactPath = ""
+		j.status.Artifact = nil
+	}
+	j.mu.Unlock()
+
+	r.save(j)
+	r.mu.Lock()
+	delete(r.live, j.status.ID)
+	r.mu.Unlock()
+}
+
+// save writes the live state of a job to the store
+func (r *Runner) save(j *job) {
+	rec := j.record()
+	if err := r.store.Put(context.Background(), rec); err != nil {
+		slog.Error("failed to store job", slog.String("job", rec.ID), slog.String("error", err.Error()))
+	}
+}
+
+// Get returns the status of a job of the given owner
+func (r *Runner) Get(owner, id string) (Status, bool) {
+	rec, ok := r.lookup(owner, id)
+	return rec.Status, ok
+}
+
+// lookup finds a job of the given owner, preferring its live state
+func (r *Runner) lookup(owner, id string) (Record, bool) {
+	r.mu.Lock()
+	j, ok := r.live[id]
+	r.mu.Unlock()
+	if ok {
+		if j.owner != owner {
+			return Record{}, false
+		}
+		return j.record(), true
+	}
+
+	rec, err := r.store.Get(context.Background(), id)
+	if err != nil {
+		if !errors.Is(err, ErrNotFound) {
+			slog.Error("failed to read job", slog.String("job", id), slog.String("error", err.Error()))
+		}
+		return Record{}, false
+	}
+	if rec.Owner != owner || r.expired(rec) {
+		return Record{}, false
+	}
+	return rec, true
+}
+
+// List returns the jobs of the given owner, newest first
+func (r *Runner) List(owner string) ([]Status, error) {
+	r.sweep()
+	records, err := r.store.List(context.Background(), owner)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(records, func(a, b int) bool { return records[a].Created.After(records[b].Created) })
+
+	out := make([]Status, 0, len(records))
+	for _, rec := range records {
+		if status, ok := r.Get(owner, rec.ID); ok {
+			out = append(out, status)
+		}
+	}
+	return out, nil
+}
+
+// Cancel stops a queued or running job by cancelling its context
+func (r *Runner) Cancel(owner, id string) bool {
+	r.mu.Lock()
+	j, ok := r.live[id]
+	r.mu.Unlock()
+	if !ok || j.owner != owner {
+		return false
+	}
+	j.cancel()
+	return true
+}
+
+// OpenArtifact opens the artifact of a finished job for reading
+func (r *Runner) OpenArtifact(owner, id string) (*os.File, Artifact, error) {
+	rec, ok := r.lookup(owner, id)
+	if !ok {
+		return nil, Artifact{}, errors.New("job not found or expired")
+	}
+	if rec.State != StateDone || rec.Artifact == nil || rec.ArtifactPath == "" {
+		return nil, Artifact{}, errors.New("job has no artifact to download")
+	}
+	f, err := os.Open(rec.ArtifactPath)
+	if err != nil {
+		return nil, Artifact{}, fmt.Errorf("failed to open artifact: %v", err)
+	}
+	return f, *rec.Artifact, nil
+}
+
+// expiry is when a job finished at t is removed
+func (r *Runner) expiry(t time.Time) *time.Time {
+	expires := t.Add(r.ttl)
+	return &expires
+}
+
+func (r *Runner) expired(rec Record) bool {
+	return rec.Expires != nil && rec.Expires.Before(time.Now())
+}
+
+// sweep drops expired jobs along with their artifacts
+func (r *Runner) sweep() {
+	records, err := r.store.List(context.Background(), "")
+	if err != nil {
+		slog.Error("failed to read job store", slog.String("error", err.Error()))
+		return
+	}
+	for _, rec := range records {
+		if !r.expired(rec) {
+			continue
+		}
+		if rec.ArtifactPath != "" {
+			os.Remove(rec.ArtifactPath)
+		}
+		if err := r.store.Delete(context.Background(), rec.ID); err != nil {
+			slog.Error("failed to delete job", slog.String("job", rec.ID), slog.String("error", err.Error()))
+		}
+	}
+}
+
+type countingReader struct {
+	r io.Reader
+	n *atomic.Int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n.Add(int64(n))
+	return n, err
+}
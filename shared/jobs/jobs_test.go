@@ -0,0 +1,139 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// wait polls a job until it reaches a final state
+func wait(t *testing.T, r *Runner, owner, id string) Status {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		status, ok := r.Get(owner, id)
+		if !ok {
+			t.Fatalf("job %s not found", id)
+		}
+		if status.Done() {
+			return status
+		}
+	}
+	t.Fatalf("job %s did not finish", id)
+	return Status{}
+}
+
+func TestRunner_BoundedPoolAndCancel(t *testing.T) {
+	r := NewRunner(NewMemoryStore(), Options{Workers: 1, ArtifactDir: t.TempDir()})
+
+	release := make(chan struct{})
+	first, err := r.Submit(Spec{Kind: KindExport, Owner: "a", Run: func(ctx context.Context, t *Task) (any, error) {
+		<-release
+		return "first", nil
+	}})
+	if err != nil {
+		t.Fatalf("submit failed: %v", err)
+	}
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if s, _ := r.Get("a", first); s.State == StateRunning {
+			break
+		}
+	}
+	ran := false
+	second, _ := r.Submit(Spec{Kind: KindExport, Owner: "a", Run: func(ctx context.Context, t *Task) (any, error) {
+		ran = true
+		return nil, nil
+	}})
+	time.Sleep(50 * time.Millisecond)
+	if s, _ := r.Get("a", second); s.State != StateQueued {
+		t.Fatalf("expected the second job to wait for a worker, got %s", s.State)
+	}
+	if r.Cancel("b", second) {
+		t.Errorf("another owner cancelled the job")
+	}
+	if !r.Cancel("a", second) {
+		t.Fatalf("failed to cancel the queued job")
+	}
+	if s := wait(t, r, "a", second); s.State != StateCancelled || ran {
+		t.Errorf("expected the queued job to be cancelled without running: %+v", s)
+	}
+
+	close(release)
+	if s := wait(t, r, "a", first); s.State != StateDone || s.Result != "first" {
+		t.Errorf("unexpected first job: %+v", s)
+	}
+}
+
+func TestRunner_Artifacts(t *testing.T) {
+	r := NewRunner(NewMemoryStore(), Options{ArtifactDir: t.TempDir()})
+
+	id, _ := r.Submit(Spec{Kind: KindDump, Owner: "a", Run: func(ctx context.Context, t *Task) (any, error) {
+		w, err := t.Artifact("dump.sql", "application/sql")
+		if err != nil {
+			return nil, err
+		}
+		fmt.Fprint(w, "SELECT 1;\n")
+		return nil, nil
+	}})
+	status := wait(t, r, "a", id)
+	if status.Artifact == nil || status.Artifact.Size != 10 || status.Expires == nil {
+		t.Fatalf("unexpected status: %+v", status)
+	}
+	f, artifact, err := r.OpenArtifact("a", id)
+	if err != nil || artifact.Name != "dump.sql" {
+		t.Fatalf("failed to open artifact: %v", err)
+	}
+	f.Close()
+	if _, _, err := r.OpenArtifact("b", id); err == nil {
+		t.Errorf("another owner opened the artifact")
+	}
+
+	// a failed job leaves no partial file behind
+	id, _ = r.Submit(Spec{Kind: KindDump, Owner: "a", Run: func(ctx context.Context, t *Task) (any, error) {
+		w, _ := t.Artifact("dump.sql", "application/sql")
+		fmt.Fprint(w, "partial")
+		return nil, errors.New("boom")
+	}})
+	if status := wait(t, r, "a", id); status.State != StateFailed || status.Error != "boom" || status.Artifact != nil {
+		t.Errorf("unexpected failed job: %+v", status)
+	}
+}
+
+func TestSQLiteStore_SurvivesRestart(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "jobs.db")
+	store, err := NewSQLiteStore(path)
+	if err != nil {
+		t.Fatalf("failed to open store: %v", err)
+	}
+	r := NewRunner(store, Options{ArtifactDir: dir})
+	done, _ := r.Submit(Spec{Kind: KindExport, Owner: "a", Run: func(ctx context.Context, t *Task) (any, error) {
+		return map[string]any{"rows": 2}, nil
+	}})
+	wait(t, r, "a", done)
+
+	// a job still running when the process stops
+	now := time.Now()
+	store.Put(context.Background(), Record{Owner: "a", Status: Status{ID: "stale", Kind: KindImport, State: StateRunning, Created: now, Started: &now}})
+	store.Close()
+
+	store, err = NewSQLiteStore(path)
+	if err != nil {
+		t.Fatalf("failed to reopen store: %v", err)
+	}
+	defer store.Close()
+	r = NewRunner(store, Options{ArtifactDir: dir})
+
+	list, err := r.List("a")
+	if err != nil || len(list) != 2 {
+		t.Fatalf("unexpected jobs after restart: %+v, %v", list, err)
+	}
+	if s, _ := r.Get("a", done); s.State != StateDone || s.Result.(map[string]any)["rows"] != float64(2) {
+		t.Errorf("unexpected finished job: %+v", s)
+	}
+	if s, _ := r.Get("a", "stale"); s.State != StateFailed || s.Error == "" {
+		t.Errorf("expected the interrupted job to be marked failed: %+v", s)
+	}
+}
@@ -0,0 +1,106 @@
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/dracory/weebase/shared/driver"
+)
+
+// SQLiteStore keeps job records in a SQLite database so finished jobs and
+// their artifacts survive a restart
+type SQLiteStore struct {
+	db *sql.DB
+}
+
+var _ Store = (*SQLiteStore)(nil)
+
+// NewSQLiteStore opens, and if needed creates, the job database at path
+func NewSQLiteStore(path string) (*SQLiteStore, error) {
+	db, err := driver.OpenSQLDB("sqlite", path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open job store: %v", err)
+	}
+	// one writer at a time keeps SQLite from reporting a locked database
+	db.SetMaxOpenConns(1)
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS weebase_jobs (
+		id TEXT PRIMARY KEY,
+		owner TEXT NOT NULL,
+		status TEXT NOT NULL,
+		artifact_path TEXT NOT NULL DEFAULT ''
+	)`)
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create job table: %v", err)
+	}
+	return &SQLiteStore{db: db}, nil
+}
+
+// Close closes the database
+func (s *SQLiteStore) Close() error {
+	return s.db.Close()
+}
+
+// Put implements Store
+func (s *SQLiteStore) Put(ctx context.Context, rec Record) error {
+	status, err := json.Marshal(rec.Status)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.ExecContext(ctx, `INSERT INTO weebase_jobs (id, owner, status, artifact_path) VALUES (?, ?, ?, ?)
+		ON CONFLICT(id) DO UPDATE SET owner = excluded.owner, status = excluded.status, artifact_path = excluded.artifact_path`,
+		rec.ID, rec.Owner, string(status), rec.ArtifactPath)
+	return err
+}
+
+// Get implements Store
+func (s *SQLiteStore) Get(ctx context.Context, id string) (Record, error) {
+	row := s.db.QueryRowContext(ctx, `SELECT owner, status, artifact_path FROM weebase_jobs WHERE id = ?`, id)
+	rec, err := scanRecord(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Record{}, ErrNotFound
+	}
+	return rec, err
+}
+
+// List implements Store
+func (s *SQLiteStore) List(ctx context.Context, owner string) ([]Record, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT owner, status, artifact_path FROM weebase_jobs WHERE ? = '' OR owner = ?`, owner, owner)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []Record{}
+	for rows.Next() {
+		rec, err := scanRecord(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, rec)
+	}
+	return out, rows.Err()
+}
+
+// Delete implements Store
+func (s *SQLiteStore) Delete(ctx context.Context, id string) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM weebase_jobs WHERE id = ?`, id)
+	return err
+}
+
+// scanRecord reads a record; the status column holds the Status as JSON,
+// so results come back as plain JSON values rather than their Go types
+func scanRecord(row interface{ Scan(...any) error }) (Record, error) {
+	var rec Record
+	var status string
+	if err := row.Scan(&rec.Owner, &status, &rec.ArtifactPath); err != nil {
+		return Record{}, err
+	}
+	if err := json.Unmarshal([]byte(status), &rec.Status); err != nil {
+		return Record{}, fmt.Errorf("invalid job record: %v", err)
+	}
+	return rec, nil
+}
@@ -0,0 +1,85 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// ErrNotFound is returned by a Store for an unknown job id
+var ErrNotFound = errors.New("job not found")
+
+// Record is the stored state of a job
+type Record struct {
+	Status
+	// Owner is the session that submitted the job
+	Owner string
+	// ArtifactPath is where the artifact is kept on disk
+	ArtifactPath string
+}
+
+// Store keeps the state of jobs. A Runner writes a record whenever a job
+// changes state; progress reports of running jobs are served from memory.
+type Store interface {
+	// Put creates or replaces the record of a job
+	Put(ctx context.Context, rec Record) error
+	// Get returns the record of a job, or ErrNotFound
+	Get(ctx context.Context, id string) (Record, error)
+	// List returns the records of an owner, or of every owner when empty
+	List(ctx context.Context, owner string) ([]Record, error)
+	// Delete removes the record of a job
+	Delete(ctx context.Context, id string) error
+}
+
+// MemoryStore keeps job records in memory; they are lost on restart
+type MemoryStore struct {
+	mu      sync.Mutex
+	records map[string]Record
+}
+
+var _ Store = (*MemoryStore)(nil)
+
+// NewMemoryStore creates an empty MemoryStore
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{records: map[string]Record{}}
+}
+
+// Put implements Store
+func (s *MemoryStore) Put(_ context.Context, rec Record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records[rec.ID] = rec
+	return nil
+}
+
+// Get implements Store
+func (s *MemoryStore) Get(_ context.Context, id string) (Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rec, ok := s.records[id]
+	if !ok {
+		return Record{}, ErrNotFound
+	}
+	return rec, nil
+}
+
+// List implements Store
+func (s *MemoryStore) List(_ context.Context, owner string) ([]Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := []Record{}
+	for _, rec := range s.records {
+		if owner == "" || rec.Owner == owner {
+			out = append(out, rec)
+		}
+	}
+	return out, nil
+}
+
+// Delete implements Store
+func (s *MemoryStore) Delete(_ context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.records, id)
+	return nil
+}
@@ -0,0 +1,94 @@
+package jobs
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/dracory/weebase/shared/session"
+)
+
+// UploadTTL is how long an upload is kept, from its preview until the
+// import that follows
+const UploadTTL = time.Hour
+
+// Upload is a file kept on disk between requests
+type Upload struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	Size int64  `json:"size"`
+
+	owner   string
+	path    string
+	created time.Time
+}
+
+// Uploads are handed between handlers that are created per request, so
+// they live at package level
+var (
+	uploadsMu sync.Mutex
+	uploads   = map[string]*Upload{}
+)
+
+// SaveUpload copies r to a temp file owned by the given session
+func SaveUpload(owner, name string, r io.Reader) (Upload, error) {
+	f, err := os.CreateTemp("", "weebase-import-*")
+	if err != nil {
+		return Upload{}, fmt.Errorf("failed to store upload: %v", err)
+	}
+	size, err := io.Copy(f, r)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return Upload{}, fmt.Errorf("failed to store upload: %v", err)
+	}
+
+	u := &Upload{ID: session.NewRandomID(), Name: name, Size: size, owner: owner, path: f.Name(), created: time.Now()}
+	uploadsMu.Lock()
+	defer uploadsMu.Unlock()
+	sweepUploads()
+	uploads[u.ID] = u
+	return *u, nil
+}
+
+// OpenUpload opens an upload of the given session for reading
+func OpenUpload(owner, id string) (*os.File, Upload, error) {
+	uploadsMu.Lock()
+	sweepUploads()
+	u, ok := uploads[id]
+	uploadsMu.Unlock()
+	if !ok || u.owner != owner {
+		return nil, Upload{}, errors.New("upload not found or expired")
+	}
+	f, err := os.Open(u.path)
+	if err != nil {
+		return nil, Upload{}, fmt.Errorf("failed to open upload: %v", err)
+	}
+	return f, *u, nil
+}
+
+// RemoveUpload deletes an upload once it is no longer needed
+func RemoveUpload(owner, id string) {
+	uploadsMu.Lock()
+	defer uploadsMu.Unlock()
+	if u, ok := uploads[id]; ok && u.owner == owner {
+		os.Remove(u.path)
+		delete(uploads, id)
+	}
+}
+
+// sweepUploads drops expired uploads; callers hold uploadsMu
+func sweepUploads() {
+	expired := time.Now().Add(-UploadTTL)
+	for id, u := range uploads {
+		if u.created.Before(expired) {
+			os.Remove(u.path)
+			delete(uploads, id)
+		}
+	}
+}
@@ -0,0 +1,288 @@
+// Package journal keeps the before and after image of every row edited
+// through the UI, so an edit can be undone. An undo only goes ahead while
+// the row still matches its after image, which keeps it from overwriting
+// changes made since.
+package journal
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/dracory/weebase/shared/dialect"
+)
+
+// Operations recorded in the journal
+const (
+	OpUpdate = "update"
+	OpDelete = "delete"
+)
+
+// DefaultLimit is how many changes List returns when the filter sets none
+const DefaultLimit = 100
+
+var (
+	// ErrNotFound is returned by a Store for an unknown change id
+	ErrNotFound = errors.New("change not found")
+	// ErrUndone is returned by MarkUndone for a change already undone
+	ErrUndone = errors.New("change already undone")
+)
+
+// Row is a row image, column name to value. Values are kept as their JSON
+// form, numbers as json.Number, so images compare and bind back the same
+// way after a round trip through a store.
+type Row map[string]any
+
+// Change is one edited row
+type Change struct {
+	ID        string    `json:"id"`
+	Time      time.Time `json:"time"`
+	Operator  string    `json:"operator,omitempty"`
+	SessionID string    `json:"session_id,omitempty"`
+	// Connection fingerprints the driver and DSN the row lives on, so the
+	// journal never holds connection credentials
+	Connection string `json:"connection"`
+	Driver     string `json:"driver"`
+	Schema     string `json:"schema,omitempty"`
+	Table      string `json:"table"`
+	Op         string `json:"op"`
+	// KeyColumn and KeyValue locate the row before the edit
+	KeyColumn string `json:"key_column"`
+	KeyValue  string `json:"key_value"`
+	// Before is the row before the edit; After is nil for deletes
+	Before   Row        `json:"before"`
+	After    Row        `json:"after,omitempty"`
+	UndoneAt *time.Time `json:"undone_at,omitempty"`
+	UndoneBy string     `json:"undone_by,omitempty"`
+}
+
+// NewChange starts the record of an edit of the row of table whose
+// keyColumn holds keyValue, on the connection of driver and dsn
+func NewChange(op, driver, dsn, schema, table, keyColumn, keyValue string) Change {
+	id := make([]byte, 16)
+	rand.Read(id)
+	return Change{
+		ID:         hex.EncodeToString(id),
+		Time:       time.Now().UTC(),
+		Connection: Fingerprint(driver, dsn),
+		Driver:     dialect.Normalize(driver),
+		Schema:     schema,
+		Table:      table,
+		Op:         op,
+		KeyColumn:  keyColumn,
+		KeyValue:   keyValue,
+	}
+}
+
+// AfterKey returns the key value of the row after the edit, which differs
+// from KeyValue when the edit changed the key column
+func (c Change) AfterKey() any {
+	if v, ok := c.After[c.KeyColumn]; ok {
+		return v
+	}
+	return c.KeyValue
+}
+
+// Filter selects changes; empty fields match anything
+type Filter struct {
+	Connection string
+	Schema     string
+	Table      string
+	Limit      int
+}
+
+func (f Filter) matches(c Change) bool {
+	return (f.Connection == "" || f.Connection == c.Connection) &&
+		(f.Schema == "" || f.Schema == c.Schema) &&
+		(f.Table == "" || f.Table == c.Table)
+}
+
+func (f Filter) limit() int {
+	if f.Limit <= 0 {
+		return DefaultLimit
+	}
+	return f.Limit
+}
+
+// Store keeps the journal
+type Store interface {
+	// Add records a change
+	Add(ctx context.Context, c Change) error
+	// Get returns a change, or ErrNotFound
+	Get(ctx context.Context, id string) (Change, error)
+	// List returns the changes matching f, newest first
+	List(ctx context.Context, f Filter) ([]Change, error)
+	// MarkUndone records that a change was undone, or returns ErrUndone
+	// when it already was
+	MarkUndone(ctx context.Context, id, by string, at time.Time) error
+}
+
+// MemoryStore keeps the journal in memory; it is lost on restart
+type MemoryStore struct {
+	mu      sync.Mutex
+	changes []Change
+}
+
+var _ Store = (*MemoryStore)(nil)
+
+// NewMemoryStore creates an empty MemoryStore
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{}
+}
+
+// Add implements Store
+func (s *MemoryStore) Add(_ context.Context, c Change) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.changes = append(s.changes, c)
+	return nil
+}
+
+// Get implements Store
+func (s *MemoryStore) Get(_ context.Context, id string) (Change, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, c := range s.changes {
+		if c.ID == id {
+			return c, nil
+		}
+	}
+	return Change{}, ErrNotFound
+}
+
+// List implements Store
+func (s *MemoryStore) List(_ context.Context, f Filter) ([]Change, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := []Change{}
+	for _, c := range slices.Backward(s.changes) {
+		if len(out) == f.limit() {
+			break
+		}
+		if f.matches(c) {
+			out = append(out, c)
+		}
+	}
+	return out, nil
+}
+
+// MarkUndone implements Store
+func (s *MemoryStore) MarkUndone(_ context.Context, id, by string, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, c := range s.changes {
+		if c.ID != id {
+			continue
+		}
+		if c.UndoneAt != nil {
+			return ErrUndone
+		}
+		s.changes[i].UndoneAt = &at
+		s.changes[i].UndoneBy = by
+		return nil
+	}
+	return ErrNotFound
+}
+
+// Fingerprint identifies a connection without keeping its DSN
+func Fingerprint(driver, dsn string) string {
+	sum := sha256.Sum256([]byte(dialect.Normalize(driver) + "\x00" + dsn))
+	return hex.EncodeToString(sum[:16])
+}
+
+// ScanRow reads the first row of rows as a row image, nil when there is
+// none. Text held in byte slices is kept as a string.
+func ScanRow(rows *sql.Rows) (Row, error) {
+	defer rows.Close()
+	cols, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	if !rows.Next() {
+		return nil, rows.Err()
+	}
+	values := make([]any, len(cols))
+	pointers := make([]any, len(cols))
+	for i := range values {
+		pointers[i] = &values[i]
+	}
+	if err := rows.Scan(pointers...); err != nil {
+		return nil, err
+	}
+	row := make(map[string]any, len(cols))
+	for i, col := range cols {
+		if b, ok := values[i].([]byte); ok && utf8.Valid(b) {
+			values[i] = string(b)
+		}
+		row[col] = values[i]
+	}
+	return normalize(row)
+}
+
+// normalize converts a row to its JSON form
+func normalize(row map[string]any) (Row, error) {
+	data, err := json.Marshal(row)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var out Row
+	if err := dec.Decode(&out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// Same reports whether two row images hold the same values
+func Same(a, b Row) bool {
+	return reflect.DeepEqual(a, b)
+}
+
+// Columns returns the columns of a row image in a stable order
+func (r Row) Columns() []string {
+	cols := make([]string, 0, len(r))
+	for col := range r {
+		cols = append(cols, col)
+	}
+	sort.Strings(cols)
+	return cols
+}
+
+// Values returns the values of the columns, bindable as query arguments
+func (r Row) Values(cols []string) []any {
+	values := make([]any, len(cols))
+	for i, col := range cols {
+		values[i] = bindable(r[col])
+	}
+	return values
+}
+
+// bindable turns a JSON value into one database/sql accepts
+func bindable(v any) any {
+	switch v := v.(type) {
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+		if f, err := v.Float64(); err == nil {
+			return f
+		}
+		return v.String()
+	case map[string]any, []any:
+		b, _ := json.Marshal(v)
+		return string(b)
+	}
+	return v
+}
@@ -0,0 +1,160 @@
+package journal
+
+import (
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dracory/weebase/shared/dialect"
+	"github.com/dracory/weebase/shared/driver"
+)
+
+func openTestDB(t *testing.T) (*sql.DB, string) {
+	path := filepath.Join(t.TempDir(), "data.db")
+	db, err := driver.OpenSQLDB("sqlite", path)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	_, err = db.Exec(`CREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT, score REAL, note TEXT);
+		INSERT INTO users VALUES (1, 'alice', 1.5, NULL), (2, 'bob', 2, 'x')`)
+	if err != nil {
+		t.Fatalf("seed: %v", err)
+	}
+	return db, path
+}
+
+func readRow(t *testing.T, db *sql.DB, id any) Row {
+	rows, err := db.Query(`SELECT * FROM users WHERE id = ?`, id)
+	if err != nil {
+		t.Fatalf("select: %v", err)
+	}
+	row, err := ScanRow(rows)
+	if err != nil {
+		t.Fatalf("scan: %v", err)
+	}
+	return row
+}
+
+// edit journals an update or delete of user 1 the way the row handlers do
+func edit(t *testing.T, db *sql.DB, path, op, statement string, args ...any) Change {
+	c := NewChange(op, "sqlite", path, "", "users", "id", "1")
+	c.Before = readRow(t, db, 1)
+	if _, err := db.Exec(statement, args...); err != nil {
+		t.Fatalf("edit: %v", err)
+	}
+	if op == OpUpdate {
+		c.After = readRow(t, db, 1)
+	}
+	return c
+}
+
+func TestUndoUpdate(t *testing.T) {
+	db, path := openTestDB(t)
+	before := readRow(t, db, 1)
+	c := edit(t, db, path, OpUpdate, `UPDATE users SET name = 'mallory', note = 'oops' WHERE id = 1`)
+
+	if _, _, err := Undo(t.Context(), db, c); err != nil {
+		t.Fatalf("Undo: %v", err)
+	}
+	if got := readRow(t, db, 1); !Same(got, before) {
+		t.Errorf("expected %v restored, got %v", before, got)
+	}
+}
+
+func TestUndoUpdateConflict(t *testing.T) {
+	db, path := openTestDB(t)
+	c := edit(t, db, path, OpUpdate, `UPDATE users SET name = 'mallory' WHERE id = 1`)
+	db.Exec(`UPDATE users SET score = 9 WHERE id = 1`)
+
+	if _, _, err := Undo(t.Context(), db, c); !errors.Is(err, ErrConflict) {
+		t.Fatalf("expected ErrConflict for a row changed since, got %v", err)
+	}
+	if got := readRow(t, db, 1); got["name"] != "mallory" {
+		t.Errorf("the row must be left alone, got %v", got)
+	}
+}
+
+func TestUndoDelete(t *testing.T) {
+	db, path := openTestDB(t)
+	before := readRow(t, db, 1)
+	c := edit(t, db, path, OpDelete, `DELETE FROM users WHERE id = 1`)
+
+	if _, _, err := Undo(t.Context(), db, c); err != nil {
+		t.Fatalf("Undo: %v", err)
+	}
+	if got := readRow(t, db, 1); !Same(got, before) {
+		t.Errorf("expected %v put back, got %v", before, got)
+	}
+
+	// the key is taken again, so a second undo is refused
+	if _, _, err := Undo(t.Context(), db, c); !errors.Is(err, ErrConflict) {
+		t.Errorf("expected ErrConflict, got %v", err)
+	}
+}
+
+func TestLockRow(t *testing.T) {
+	cases := map[string]string{
+		"postgres":  `SELECT * FROM "users" WHERE "id" = $1 FOR UPDATE`,
+		"mysql":     "SELECT * FROM `users` WHERE `id` = ? FOR UPDATE",
+		"sqlserver": `SELECT * FROM [users] WITH (UPDLOCK, HOLDLOCK) WHERE [id] = @p1`,
+		"sqlite":    `SELECT * FROM "users" WHERE "id" = ?`,
+	}
+	for driver, want := range cases {
+		got := lockRow(driver, dialect.QuoteIdent(driver, "users"), dialect.QuoteIdent(driver, "id"))
+		if got != want {
+			t.Errorf("%s: expected %s, got %s", driver, want, got)
+		}
+	}
+}
+
+func testStore(t *testing.T, s Store) {
+	ctx := t.Context()
+	older := NewChange(OpDelete, "sqlite", "a.db", "", "users", "id", "1")
+	older.Time = older.Time.Add(-time.Minute)
+	older.Before = Row{"id": "1"}
+	newer := NewChange(OpUpdate, "sqlite", "a.db", "", "orders", "id", "7")
+	other := NewChange(OpUpdate, "sqlite", "b.db", "", "users", "id", "2")
+	for _, c := range []Change{older, newer, other} {
+		if err := s.Add(ctx, c); err != nil {
+			t.Fatalf("Add: %v", err)
+		}
+	}
+
+	list, err := s.List(ctx, Filter{Connection: Fingerprint("sqlite3", "a.db")})
+	if err != nil || len(list) != 2 || list[0].ID != newer.ID {
+		t.Fatalf("expected the two changes of a.db newest first, got %v, %v", list, err)
+	}
+	if list, _ := s.List(ctx, Filter{Table: "users"}); len(list) != 2 {
+		t.Errorf("expected two changes of users, got %d", len(list))
+	}
+
+	if err := s.MarkUndone(ctx, older.ID, "alice", time.Now()); err != nil {
+		t.Fatalf("MarkUndone: %v", err)
+	}
+	if err := s.MarkUndone(ctx, older.ID, "bob", time.Now()); !errors.Is(err, ErrUndone) {
+		t.Errorf("expected ErrUndone, got %v", err)
+	}
+	got, err := s.Get(ctx, older.ID)
+	if err != nil || got.UndoneBy != "alice" || got.UndoneAt == nil || got.Before["id"] != "1" {
+		t.Errorf("unexpected change %+v, %v", got, err)
+	}
+	if _, err := s.Get(ctx, "missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	testStore(t, NewMemoryStore())
+}
+
+func TestSQLiteStore(t *testing.T) {
+	s, err := NewSQLiteStore(filepath.Join(t.TempDir(), "journal.db"))
+	if err != nil {
+		t.Fatalf("NewSQLiteStore: %v", err)
+	}
+	defer s.Close()
+	testStore(t, s)
+}
@@ -0,0 +1,135 @@
+package journal
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/dracory/weebase/shared/driver"
+)
+
+// SQLiteStore keeps the journal in a SQLite database so changes can be
+// undone after a restart
+type SQLiteStore struct {
+	db *sql.DB
+}
+
+var _ Store = (*SQLiteStore)(nil)
+
+// NewSQLiteStore opens, and if needed creates, the journal database at path
+func NewSQLiteStore(path string) (*SQLiteStore, error) {
+	db, err := driver.OpenSQLDB("sqlite", path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open journal: %v", err)
+	}
+	// one writer at a time keeps SQLite from reporting a locked database
+	db.SetMaxOpenConns(1)
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS weebase_journal (
+		id TEXT PRIMARY KEY,
+		ts INTEGER NOT NULL,
+		connection TEXT NOT NULL,
+		schema_name TEXT NOT NULL,
+		table_name TEXT NOT NULL,
+		undone INTEGER NOT NULL DEFAULT 0,
+		change TEXT NOT NULL
+	)`)
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create journal table: %v", err)
+	}
+	return &SQLiteStore{db: db}, nil
+}
+
+// Close closes the database
+func (s *SQLiteStore) Close() error {
+	return s.db.Close()
+}
+
+// Add implements Store
+func (s *SQLiteStore) Add(ctx context.Context, c Change) error {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.ExecContext(ctx, `INSERT INTO weebase_journal (id, ts, connection, schema_name, table_name, change) VALUES (?, ?, ?, ?, ?, ?)`,
+		c.ID, c.Time.UnixNano(), c.Connection, c.Schema, c.Table, string(data))
+	return err
+}
+
+// Get implements Store
+func (s *SQLiteStore) Get(ctx context.Context, id string) (Change, error) {
+	c, err := scanChange(s.db.QueryRowContext(ctx, `SELECT change FROM weebase_journal WHERE id = ?`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return Change{}, ErrNotFound
+	}
+	return c, err
+}
+
+// List implements Store
+func (s *SQLiteStore) List(ctx context.Context, f Filter) ([]Change, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT change FROM weebase_journal
+		WHERE (? = '' OR connection = ?) AND (? = '' OR schema_name = ?) AND (? = '' OR table_name = ?)
+		ORDER BY ts DESC LIMIT ?`,
+		f.Connection, f.Connection, f.Schema, f.Schema, f.Table, f.Table, f.limit())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []Change{}
+	for rows.Next() {
+		c, err := scanChange(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, c)
+	}
+	return out, rows.Err()
+}
+
+// MarkUndone implements Store. The undone flag is only set when it is
+// clear, so two undos racing each other can't both succeed.
+func (s *SQLiteStore) MarkUndone(ctx context.Context, id, by string, at time.Time) error {
+	c, err := s.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	c.UndoneAt, c.UndoneBy = &at, by
+	data, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	result, err := s.db.ExecContext(ctx, `UPDATE weebase_journal SET undone = 1, change = ? WHERE id = ? AND undone = 0`, string(data), id)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return ErrUndone
+	}
+	return nil
+}
+
+// scanChange reads a change stored as JSON
+func scanChange(row interface{ Scan(...any) error }) (Change, error) {
+	var data string
+	if err := row.Scan(&data); err != nil {
+		return Change{}, err
+	}
+	return decodeChange([]byte(data))
+}
+
+// decodeChange reads a change, keeping the numbers of its row images as
+// json.Number like ScanRow does
+func decodeChange(data []byte) (Change, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var c Change
+	if err := dec.Decode(&c); err != nil {
+		return Change{}, fmt.Errorf("invalid journal record: %v", err)
+	}
+	return c, nil
+}
@@ -0,0 +1,109 @@
+package journal
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/dracory/weebase/shared/constants"
+	"github.com/dracory/weebase/shared/dialect"
+)
+
+// ErrConflict is returned by Undo when the row no longer matches the after
+// image of the change
+var ErrConflict = errors.New("the row changed since the edit")
+
+// Undo restores the before image of c on db in one transaction: an update
+// is reverted only while the row still equals its after image, and a
+// deleted row is put back only while no row holds its key. The row is read
+// with lockRow, so no other edit can land between the check and the write.
+// It returns the statement it ran, for the audit log.
+func Undo(ctx context.Context, db *sql.DB, c Change) (string, []any, error) {
+	if c.UndoneAt != nil {
+		return "", nil, ErrUndone
+	}
+	table := dialect.QualifiedName(c.Driver, c.Schema, c.Table)
+	key := dialect.QuoteIdent(c.Driver, c.KeyColumn)
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return "", nil, err
+	}
+	defer tx.Rollback()
+
+	locate := c.KeyValue
+	if c.Op == OpUpdate {
+		locate = fmt.Sprint(bindable(c.AfterKey()))
+	}
+	rows, err := tx.QueryContext(ctx, lockRow(c.Driver, table, key), dialect.BindArg(c.Driver, 1, locate))
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to read the row: %v", err)
+	}
+	current, err := ScanRow(rows)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to read the row: %v", err)
+	}
+
+	cols := c.Before.Columns()
+	values := c.Before.Values(cols)
+	var statement string
+	var args []any
+	switch c.Op {
+	case OpUpdate:
+		if current == nil || !Same(current, c.After) {
+			return "", nil, ErrConflict
+		}
+		sets := make([]string, len(cols))
+		for i, col := range cols {
+			sets[i] = dialect.QuoteIdent(c.Driver, col) + " = " + dialect.Placeholder(c.Driver, i+1)
+		}
+		statement = "UPDATE " + table + " SET " + strings.Join(sets, ", ") + " WHERE " + key + " = " + dialect.Placeholder(c.Driver, len(cols)+1)
+		args = append(values, locate)
+	case OpDelete:
+		if current != nil {
+			return "", nil, ErrConflict
+		}
+		quoted := make([]string, len(cols))
+		marks := make([]string, len(cols))
+		for i, col := range cols {
+			quoted[i] = dialect.QuoteIdent(c.Driver, col)
+			marks[i] = dialect.Placeholder(c.Driver, i+1)
+		}
+		statement = "INSERT INTO " + table + " (" + strings.Join(quoted, ", ") + ") VALUES (" + strings.Join(marks, ", ") + ")"
+		args = values
+	default:
+		return "", nil, fmt.Errorf("unknown change %q", c.Op)
+	}
+
+	bound := make([]any, len(args))
+	for i, arg := range args {
+		bound[i] = dialect.BindArg(c.Driver, i+1, arg)
+	}
+	result, err := tx.ExecContext(ctx, statement, bound...)
+	if err != nil {
+		return statement, args, err
+	}
+	if n, err := result.RowsAffected(); err == nil && n != 1 {
+		return statement, args, ErrConflict
+	}
+	return statement, args, tx.Commit()
+}
+
+// lockRow builds the query reading the row with the given key for update.
+// Postgres and MySQL lock it with FOR UPDATE and SQL Server with update and
+// range locks, which also keep a deleted key from being taken meanwhile.
+// SQLite needs no hint: a write committed after the read makes the undo's
+// own write fail with a busy error instead of overwriting it.
+func lockRow(driver, table, key string) string {
+	where := " WHERE " + key + " = " + dialect.Placeholder(driver, 1)
+	switch dialect.Normalize(driver) {
+	case constants.DriverPostgres, constants.DriverMySQL:
+		return "SELECT * FROM " + table + where + " FOR UPDATE"
+	case constants.DriverSQLServer:
+		return "SELECT * FROM " + table + " WITH (UPDLOCK, HOLDLOCK)" + where
+	default:
+		return "SELECT * FROM " + table + where
+	}
+}
@@ -2,12 +2,14 @@ package layout
 
 import (
 	"html/template"
+	"strings"
 
 	hb "github.com/gouniverse/hb"
 )
 
-// buildNavbar creates a responsive Bootstrap 5 navbar component
-func buildNavbar(basePath string, safeMode bool) *hb.Tag {
+// buildNavbar creates a responsive Bootstrap 5 navbar component;
+// user is the signed-in operator, shown when set
+func buildNavbar(basePath string, safeMode bool, user string) *hb.Tag {
 	// Navbar toggler button
 	toggleButton := hb.NewTag("button").
 		Class("navbar-toggler").
@@ -57,7 +59,15 @@ func buildNavbar(basePath string, safeMode bool) *hb.Tag {
 		safeModeClass = "text-success"
 	}
 
-	safeModeIndicator := hb.NewTag("div").Class("d-flex").
+	indicators := hb.NewTag("div").Class("d-flex")
+	if user != "" {
+		indicators.Child(hb.NewTag("span").Class("navbar-text me-3").
+			Attr("title", "Signed in as "+user).
+			Child(hb.NewTag("i").Class("bi bi-person-circle me-1")).
+			Child(hb.Text(user)),
+		)
+	}
+	indicators.
 		Child(hb.NewTag("span").Class("navbar-text me-3").
 			Child(hb.NewTag("small").Child(hb.Text("Safe mode: "))).
 			Child(hb.NewTag("code").
@@ -72,7 +82,7 @@ func buildNavbar(basePath string, safeMode bool) *hb.Tag {
 		ID("navbarNav").
 		Children([]hb.TagInterface{
 			navMenuItems,
-			safeModeIndicator,
+			indicators,
 		})
 
 	// Navbar container
@@ -95,6 +105,11 @@ type Options struct {
 	BasePath        string
 	SafeModeDefault bool
 	MainHTML        string
+	// User is the signed-in operator shown in the navbar, if any
+	User string
+	// Denied lists the permissions the operator lacks; elements marked
+	// with data-permission set to one of them are hidden
+	Denied []string
 	// SidebarHTML, when provided, renders on the left similar to Adminer
 	// and Tailwind's "w-64" style width.
 	SidebarHTML  string
@@ -136,12 +151,15 @@ func RenderWith(o Options) template.HTML {
 		// Bootstrap 5 JS Bundle with Popper
 		hb.NewTag("script").Attr("src", "https://cdn.jsdelivr.net/npm/bootstrap@5.3.0/dist/js/bootstrap.bundle.min.js"),
 	}
+	if len(o.Denied) > 0 {
+		headChildren = append(headChildren, hb.Style(deniedCSS(o.Denied)))
+	}
 	if len(o.ExtraHead) > 0 {
 		headChildren = append(headChildren, o.ExtraHead...)
 	}
 
 	// Build the navbar
-	navbar := buildNavbar(o.BasePath, o.SafeModeDefault)
+	navbar := buildNavbar(o.BasePath, o.SafeModeDefault, o.User)
 	header := hb.NewTag("header").Child(navbar)
 
 	// Shell: sidebar + main content
@@ -191,3 +209,12 @@ func RenderWith(o Options) template.HTML {
 	// Wrap in <!doctype html>
 	return template.HTML("<!doctype html>" + html.ToHTML())
 }
+
+// deniedCSS hides the controls of the permissions the operator lacks
+func deniedCSS(denied []string) string {
+	selectors := make([]string, len(denied))
+	for i, perm := range denied {
+		selectors[i] = `[data-permission="` + perm + `"]`
+	}
+	return strings.Join(selectors, ",") + "{display:none!important}"
+}
@@ -0,0 +1,307 @@
+// Package masking hides sensitive column values from operators. Rules,
+// loaded from config, pick columns by connection profile, schema, table and
+// column name or type patterns and say how their values are masked.
+// Operators granted the unmask permission see the values as stored.
+//
+// The results of SQL queries come from no known table, so only column name
+// and type patterns pick their columns and an alias gets past a name
+// pattern: keep the sql permission from operators who mustn't see the data.
+//
+// Table copies, data diffs and backups write rows where masking them would
+// corrupt the copy, so they need the unmask permission on whatever the
+// rules cover instead.
+package masking
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/dracory/weebase/shared/export"
+	"github.com/dracory/weebase/shared/glob"
+)
+
+// Methods a rule masks values with
+const (
+	MethodRedact  = "redact"  // replace the value with Redacted
+	MethodPartial = "partial" // keep the last 4 characters, star the rest
+	MethodHash    = "hash"    // replace the value with a keyed hash of it
+	MethodNull    = "null"    // replace the value with NULL
+)
+
+// Redacted replaces redacted values
+const Redacted = "****"
+
+// partialKeep is how many trailing characters partial masking keeps
+const partialKeep = 4
+
+// Rule masks the columns matching it. Patterns are case-insensitive and may
+// use * and ?; empty Profiles, Schemas and Tables match anything. A column
+// matches when its name matches one of Columns or its database type one
+// of Types.
+type Rule struct {
+	Profiles []string `json:"profiles,omitempty"`
+	Schemas  []string `json:"schemas,omitempty"`
+	Tables   []string `json:"tables,omitempty"`
+	Columns  []string `json:"columns,omitempty"`
+	Types    []string `json:"types,omitempty"`
+	Method   string   `json:"method"`
+}
+
+// Rules are the masking rules; the first rule matching a column wins.
+// HashKey keys the hashes so masked values can't be looked up in a table
+// of hashed guesses.
+type Rules struct {
+	Rules   []Rule `json:"rules"`
+	HashKey string `json:"hash_key,omitempty"`
+}
+
+// Load reads a JSON rules file
+func Load(path string) (*Rules, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read masking rules: %v", err)
+	}
+	rules, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return rules, nil
+}
+
+// Parse reads JSON rules and validates them
+func Parse(data []byte) (*Rules, error) {
+	var rules Rules
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("invalid masking rules: %v", err)
+	}
+	if err := rules.Validate(); err != nil {
+		return nil, err
+	}
+	return &rules, nil
+}
+
+// Validate checks that every rule picks columns and has a known method
+func (rs *Rules) Validate() error {
+	for i, rule := range rs.Rules {
+		if len(rule.Columns) == 0 && len(rule.Types) == 0 {
+			return fmt.Errorf("masking rule %d: columns or types are required", i+1)
+		}
+		switch rule.Method {
+		case MethodRedact, MethodPartial, MethodHash, MethodNull:
+		default:
+			return fmt.Errorf("masking rule %d: unknown method %q", i+1, rule.Method)
+		}
+	}
+	return nil
+}
+
+// Masker masks the results read on one connection. A nil Masker masks
+// nothing.
+type Masker struct {
+	rules   *Rules
+	profile string
+	// unmasked reports whether the operator may see a table unmasked
+	unmasked func(schema, table string) bool
+}
+
+// NewMasker creates the Masker of a connection of profile; unmasked, when
+// set, lets an operator see a table unmasked. It returns nil when there are
+// no rules.
+func NewMasker(rules *Rules, profile string, unmasked func(schema, table string) bool) *Masker {
+	if rules == nil || len(rules.Rules) == 0 {
+		return nil
+	}
+	return &Masker{rules: rules, profile: profile, unmasked: unmasked}
+}
+
+// Func masks one value
+type Func func(v any) any
+
+// Columns returns the mask of each column of a result read from table, nil
+// for columns left alone, or nil when no column is masked. Results whose
+// table isn't known, such as those of SQL queries, pass an empty table:
+// schema and table patterns are then ignored so every rule applies, and
+// likewise for an empty schema.
+func (m *Masker) Columns(schema, table string, columns []export.Column) []Func {
+	if m == nil {
+		return nil
+	}
+	if m.unmasked != nil && m.unmasked(schema, table) {
+		return nil
+	}
+	var funcs []Func
+	for i, c := range columns {
+		rule := m.rule(schema, table, c)
+		if rule == nil {
+			continue
+		}
+		if funcs == nil {
+			funcs = make([]Func, len(columns))
+		}
+		funcs[i] = m.method(rule.Method, c)
+	}
+	return funcs
+}
+
+// rule returns the first rule matching a column
+func (m *Masker) rule(schema, table string, c export.Column) *Rule {
+	for i, rule := range m.rules.Rules {
+		if rule.appliesTo(m.profile, schema, table) && (matchSome(rule.Columns, c.Name) || matchSome(rule.Types, c.DatabaseType)) {
+			return &m.rules.Rules[i]
+		}
+	}
+	return nil
+}
+
+// appliesTo reports whether the rule may mask columns of table on a
+// connection of profile; an empty table or schema matches any
+func (rule Rule) appliesTo(profile, schema, table string) bool {
+	if !matchAny(rule.Profiles, profile) {
+		return false
+	}
+	if table != "" && !matchAny(rule.Tables, table) {
+		return false
+	}
+	return schema == "" || table == "" || matchAny(rule.Schemas, schema)
+}
+
+// Covers reports whether a rule may mask columns of table on a connection
+// of profile. The columns aren't known, so a rule picking columns by type
+// covers every table; an empty table stands for any table, as for the
+// results of a query. Actions that write rows where they can't be masked,
+// such as copies, backups and reconcile scripts, need the unmask
+// permission on what the rules cover.
+func (rs *Rules) Covers(profile, schema, table string) bool {
+	if rs == nil {
+		return false
+	}
+	for _, rule := range rs.Rules {
+		if rule.appliesTo(profile, schema, table) {
+			return true
+		}
+	}
+	return false
+}
+
+// Covers reports whether a rule may mask columns of table for this
+// operator, whose columns aren't known; see Rules.Covers
+func (m *Masker) Covers(schema, table string) bool {
+	if m == nil || (m.unmasked != nil && m.unmasked(schema, table)) {
+		return false
+	}
+	return m.rules.Covers(m.profile, schema, table)
+}
+
+// method returns the mask of a method. NULL stays NULL whatever the method.
+func (m *Masker) method(method string, c export.Column) Func {
+	switch method {
+	case MethodNull:
+		return func(any) any { return nil }
+	case MethodPartial:
+		return func(v any) any {
+			text, null, _ := export.FormatText(v, c)
+			if null {
+				return nil
+			}
+			return Partial(text)
+		}
+	case MethodHash:
+		return func(v any) any {
+			text, null, _ := export.FormatText(v, c)
+			if null {
+				return nil
+			}
+			return m.Hash(text)
+		}
+	}
+	return func(v any) any {
+		if v == nil {
+			return nil
+		}
+		return Redacted
+	}
+}
+
+// Partial stars all but the last 4 characters of s; shorter values are
+// starred whole
+func Partial(s string) string {
+	n := utf8.RuneCountInString(s)
+	if n <= partialKeep {
+		return strings.Repeat("*", n)
+	}
+	runes := []rune(s)
+	return strings.Repeat("*", n-partialKeep) + string(runes[n-partialKeep:])
+}
+
+// Hash returns the keyed hash of s. Equal values hash alike, so masked
+// columns can still be compared and joined on.
+func (m *Masker) Hash(s string) string {
+	mac := hmac.New(sha256.New, []byte(m.rules.HashKey))
+	mac.Write([]byte(s))
+	return hex.EncodeToString(mac.Sum(nil)[:16])
+}
+
+// Apply masks the values of one row in place
+func Apply(funcs []Func, values []any) {
+	for i, f := range funcs {
+		if f != nil {
+			values[i] = f(values[i])
+		}
+	}
+}
+
+// Writer wraps w so the rows of table are masked before they are written;
+// it returns w itself when m is nil
+func (m *Masker) Writer(schema, table string, w export.RowWriter) export.RowWriter {
+	if m == nil {
+		return w
+	}
+	return &writer{RowWriter: w, masker: m, schema: schema, table: table}
+}
+
+type writer struct {
+	export.RowWriter
+	masker        *Masker
+	schema, table string
+	funcs         []Func
+}
+
+func (w *writer) Begin(columns []export.Column) error {
+	w.funcs = w.masker.Columns(w.schema, w.table, columns)
+	return w.RowWriter.Begin(columns)
+}
+
+func (w *writer) Row(values []any) error {
+	Apply(w.funcs, values)
+	return w.RowWriter.Row(values)
+}
+
+func matchAny(patterns []string, s string) bool {
+	return len(patterns) == 0 || matchSome(patterns, s)
+}
+
+// matchSome reports whether s matches one of the patterns; no patterns
+// match nothing
+func matchSome(patterns []string, s string) bool {
+	return glob.MatchAny(patterns, s)
+}
+
+type ctxKey struct{}
+
+// WithMasker returns a copy of ctx carrying the Masker of the request
+func WithMasker(ctx context.Context, m *Masker) context.Context {
+	return context.WithValue(ctx, ctxKey{}, m)
+}
+
+// FromContext returns the Masker of the request, nil when nothing is masked
+func FromContext(ctx context.Context) *Masker {
+	m, _ := ctx.Value(ctxKey{}).(*Masker)
+	return m
+}
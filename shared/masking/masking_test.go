@@ -0,0 +1,161 @@
+package masking
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/dracory/weebase/shared/export"
+)
+
+const testRules = `{
+	"hash_key": "k",
+	"rules": [
+		{"profiles": ["prod"], "tables": ["users"], "columns": ["email"], "method": "hash"},
+		{"tables": ["users"], "columns": ["ssn", "card_*"], "method": "partial"},
+		{"schemas": ["hr"], "columns": ["salary"], "method": "null"},
+		{"types": ["bytea"], "method": "redact"}
+	]
+}`
+
+func newTestRules(t *testing.T) *Rules {
+	rules, err := Parse([]byte(testRules))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	return rules
+}
+
+func newTestMasker(t *testing.T, profile string, unmasked func(schema, table string) bool) *Masker {
+	return NewMasker(newTestRules(t), profile, unmasked)
+}
+
+func TestParseValidates(t *testing.T) {
+	for _, data := range []string{
+		`{"rules": [{"columns": ["x"], "method": "scramble"}]}`,
+		`{"rules": [{"tables": ["x"], "method": "null"}]}`,
+		`{"rules": 1}`,
+	} {
+		if _, err := Parse([]byte(data)); err == nil {
+			t.Errorf("expected %s to be rejected", data)
+		}
+	}
+}
+
+func TestColumns(t *testing.T) {
+	m := newTestMasker(t, "prod", nil)
+	columns := []export.Column{
+		{Name: "id", DatabaseType: "INTEGER"},
+		{Name: "Email", DatabaseType: "TEXT"},
+		{Name: "ssn", DatabaseType: "TEXT"},
+		{Name: "card_number", DatabaseType: "TEXT"},
+		{Name: "salary", DatabaseType: "NUMERIC"},
+		{Name: "photo", DatabaseType: "BYTEA"},
+	}
+
+	values := []any{int64(1), "alice@example.com", []byte("123-45-6789"), "4111111111111111", "5000", []byte{0xff}}
+	Apply(m.Columns("public", "users", columns), values)
+	want := []any{int64(1), m.Hash("alice@example.com"), "*******6789", "************1111", "5000", Redacted}
+	for i := range want {
+		if values[i] != want[i] {
+			t.Errorf("%s: got %v, want %v", columns[i].Name, values[i], want[i])
+		}
+	}
+
+	// a query's rows come from no known table, so every rule applies
+	values = []any{int64(1), "alice@example.com", "123", nil, "5000", nil}
+	Apply(m.Columns("", "", columns), values)
+	if values[2] != "***" || values[3] != nil || values[4] != nil {
+		t.Errorf("expected every rule to apply to a query, got %v", values)
+	}
+
+	if funcs := m.Columns("public", "orders", columns[:2]); funcs != nil {
+		t.Errorf("expected nothing masked in orders, got %v", funcs)
+	}
+	if funcs := newTestMasker(t, "dev", nil).Columns("public", "users", columns[:2]); funcs != nil {
+		t.Errorf("expected the prod rule to skip other profiles, got %v", funcs)
+	}
+}
+
+func TestUnmasked(t *testing.T) {
+	m := newTestMasker(t, "prod", func(schema, table string) bool { return table == "users" })
+	columns := []export.Column{{Name: "ssn"}}
+	if funcs := m.Columns("public", "users", columns); funcs != nil {
+		t.Errorf("expected users unmasked, got %v", funcs)
+	}
+	if funcs := m.Columns("", "", columns); funcs == nil {
+		t.Error("expected queries still masked")
+	}
+
+	var none *Masker
+	if funcs := none.Columns("public", "users", columns); funcs != nil {
+		t.Errorf("a nil Masker must mask nothing, got %v", funcs)
+	}
+	if NewMasker(&Rules{}, "prod", nil) != nil {
+		t.Error("expected no Masker without rules")
+	}
+}
+
+func TestCovers(t *testing.T) {
+	rules, err := Parse([]byte(`{"rules": [
+		{"profiles": ["prod"], "tables": ["users"], "columns": ["email"], "method": "hash"},
+		{"schemas": ["hr"], "tables": ["staff"], "columns": ["salary"], "method": "null"}
+	]}`))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	tests := []struct {
+		profile, schema, table string
+		want                   bool
+	}{
+		{"prod", "public", "users", true},
+		{"dev", "public", "users", false},
+		{"prod", "public", "orders", false},
+		{"dev", "hr", "staff", true},
+		{"dev", "public", "staff", false},
+		{"dev", "", "", true},
+	}
+	for _, tt := range tests {
+		if got := rules.Covers(tt.profile, tt.schema, tt.table); got != tt.want {
+			t.Errorf("Covers(%q, %q, %q) = %v, want %v", tt.profile, tt.schema, tt.table, got, tt.want)
+		}
+	}
+	if !newTestRules(t).Covers("dev", "public", "orders") {
+		t.Error("expected a type rule to cover every table")
+	}
+	var none *Rules
+	if none.Covers("prod", "public", "users") {
+		t.Error("nil rules must cover nothing")
+	}
+
+	m := NewMasker(rules, "prod", func(schema, table string) bool { return table == "users" })
+	if m.Covers("public", "users") {
+		t.Error("expected an unmasked table not to be covered")
+	}
+	if !m.Covers("hr", "staff") {
+		t.Error("expected the Masker to cover hr.staff")
+	}
+}
+
+func TestWriter(t *testing.T) {
+	m := newTestMasker(t, "", nil)
+	var buf bytes.Buffer
+	csv, err := export.NewCSVWriter(&buf, export.DefaultCSVOptions())
+	if err != nil {
+		t.Fatalf("NewCSVWriter: %v", err)
+	}
+	w := m.Writer("public", "users", csv)
+	columns := []export.Column{{Name: "id"}, {Name: "ssn"}}
+	if err := w.Begin(columns); err != nil {
+		t.Fatalf("Begin: %v", err)
+	}
+	if err := w.Row([]any{int64(7), "123456789"}); err != nil {
+		t.Fatalf("Row: %v", err)
+	}
+	if err := w.End(); err != nil {
+		t.Fatalf("End: %v", err)
+	}
+	if got := buf.String(); !strings.Contains(got, "*****6789") || strings.Contains(got, "123456789") {
+		t.Errorf("expected the ssn masked, got %q", got)
+	}
+}
@@ -0,0 +1,285 @@
+// Package migrations captures DDL as versioned up/down migration files in
+// golang-migrate or goose format, so changes made through weebase can be
+// committed alongside the services that apply them.
+package migrations
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/dracory/weebase/shared/constants"
+	"github.com/dracory/weebase/shared/dialect"
+)
+
+// Supported migration file formats
+const (
+	// FormatGolangMigrate writes <version>_<name>.up.sql and <version>_<name>.down.sql
+	FormatGolangMigrate = "golang-migrate"
+	// FormatGoose writes a single <version>_<name>.sql with goose annotations
+	FormatGoose = "goose"
+)
+
+// Migration is a versioned pair of up and down statements
+type Migration struct {
+	Version string   `json:"version"`
+	Name    string   `json:"name"`
+	Up      []string `json:"up"`
+	Down    []string `json:"down"`
+	// DownComplete is false when some up statements could not be reversed
+	// automatically and the down script needs a manual review
+	DownComplete bool `json:"down_complete"`
+}
+
+// File is a rendered migration file
+type File struct {
+	Name    string `json:"name"`
+	Content string `json:"content"`
+	// Path is set once the file has been written to disk
+	Path string `json:"path,omitempty"`
+}
+
+var nameCleaner = regexp.MustCompile(`[^a-z0-9]+`)
+
+// New creates a migration versioned by the current UTC time. When down is
+// empty it is derived from up for the given driver.
+func New(drv, name string, up, down []string) Migration {
+	m := Migration{
+		Version:      time.Now().UTC().Format("20060102150405"),
+		Name:         strings.Trim(nameCleaner.ReplaceAllString(strings.ToLower(name), "_"), "_"),
+		Up:           up,
+		Down:         down,
+		DownComplete: true,
+	}
+	if m.Name == "" {
+		m.Name = "migration"
+	}
+	if len(down) == 0 {
+		m.Down, m.DownComplete = DeriveDown(drv, up)
+	}
+	return m
+}
+
+// ValidFormat reports whether format names a supported migration format
+func ValidFormat(format string) bool {
+	return format == FormatGolangMigrate || format == FormatGoose
+}
+
+// Files renders the migration in the requested format
+func (m Migration) Files(format string) ([]File, error) {
+	base := m.Version + "_" + m.Name
+	switch format {
+	case FormatGolangMigrate, "":
+		return []File{
+			{Name: base + ".up.sql", Content: script(m.Up, false)},
+			{Name: base + ".down.sql", Content: script(m.Down, false)},
+		}, nil
+	case FormatGoose:
+		return []File{{
+			Name:    base + ".sql",
+			Content: "-- +goose Up\n" + script(m.Up, true) + "-- +goose Down\n" + script(m.Down, true),
+		}}, nil
+	}
+	return nil, fmt.Errorf("unsupported migration format: %s", format)
+}
+
+// script renders statements one per paragraph. With goose annotations,
+// statements containing semicolons are wrapped in StatementBegin/End.
+func script(stmts []string, goose bool) string {
+	var sb strings.Builder
+	for _, stmt := range stmts {
+		stmt = strings.TrimSpace(stmt)
+		if stmt == "" {
+			continue
+		}
+		if strings.HasPrefix(stmt, "--") {
+			sb.WriteString(stmt + "\n\n")
+			continue
+		}
+		if goose && strings.Contains(stmt, ";") {
+			sb.WriteString("-- +goose StatementBegin\n" + stmt + ";\n-- +goose StatementEnd\n\n")
+			continue
+		}
+		sb.WriteString(stmt + ";\n\n")
+	}
+	return sb.String()
+}
+
+// Write stores the files in dir, creating it when needed. Existing files are
+// never overwritten. The returned files carry their paths.
+func Write(dir string, files []File) ([]File, error) {
+	if strings.TrimSpace(dir) == "" {
+		return nil, errors.New("migrations directory is not configured")
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create migrations directory: %v", err)
+	}
+
+	written := make([]File, 0, len(files))
+	for _, f := range files {
+		path := filepath.Join(dir, f.Name)
+		fh, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if err != nil {
+			return written, fmt.Errorf("failed to create %s: %v", f.Name, err)
+		}
+		_, err = fh.WriteString(f.Content)
+		if cerr := fh.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return written, fmt.Errorf("failed to write %s: %v", f.Name, err)
+		}
+		f.Path = path
+		written = append(written, f)
+	}
+	return written, nil
+}
+
+// identifier matches a possibly qualified, possibly quoted identifier
+const identifier = "(?:\"[^\"]+\"|`[^`]+`|\\[[^\\]]+\\]|[\\w$]+)(?:\\.(?:\"[^\"]+\"|`[^`]+`|\\[[^\\]]+\\]|[\\w$]+))*"
+
+var (
+	createTable    = regexp.MustCompile(`(?is)^CREATE\s+(?:TEMP(?:ORARY)?\s+|UNLOGGED\s+)?TABLE\s+(?:IF\s+NOT\s+EXISTS\s+)?(` + identifier + `)`)
+	createIndex    = regexp.MustCompile(`(?is)^CREATE\s+(?:UNIQUE\s+)?(?:CLUSTERED\s+|NONCLUSTERED\s+)?INDEX\s+(?:CONCURRENTLY\s+)?(?:IF\s+NOT\s+EXISTS\s+)?(` + identifier + `)\s+ON\s+(?:ONLY\s+)?(` + identifier + `)`)
+	createView     = regexp.MustCompile(`(?is)^CREATE\s+(MATERIALIZED\s+)?VIEW\s+(?:IF\s+NOT\s+EXISTS\s+)?(` + identifier + `)`)
+	createObject   = regexp.MustCompile(`(?is)^CREATE\s+(SEQUENCE|TYPE|SCHEMA|DOMAIN)\s+(?:IF\s+NOT\s+EXISTS\s+)?(` + identifier + `)`)
+	addColumn      = regexp.MustCompile(`(?is)^ALTER\s+TABLE\s+(?:IF\s+EXISTS\s+)?(` + identifier + `)\s+ADD\s+(?:COLUMN\s+)?(?:IF\s+NOT\s+EXISTS\s+)?(` + identifier + `)`)
+	addConstraint  = regexp.MustCompile(`(?is)^ALTER\s+TABLE\s+(?:IF\s+EXISTS\s+)?(` + identifier + `)\s+ADD\s+CONSTRAINT\s+(` + identifier + `)\s+(PRIMARY\s+KEY|FOREIGN\s+KEY|UNIQUE|CHECK)`)
+	constraintWord = regexp.MustCompile(`(?i)^(CONSTRAINT|PRIMARY|FOREIGN|UNIQUE|CHECK|INDEX|KEY|FULLTEXT|SPATIAL)$`)
+)
+
+// DeriveDown reverses the up statements where the inverse is unambiguous
+// (CREATE TABLE/INDEX/VIEW/SEQUENCE/TYPE, ADD COLUMN, ADD CONSTRAINT), in
+// reverse order. Statements that cannot be reversed produce a "--" note and
+// a false second result.
+func DeriveDown(drv string, up []string) ([]string, bool) {
+	drv = dialect.Normalize(drv)
+	down := []string{}
+	complete := true
+
+	for i := len(up) - 1; i >= 0; i-- {
+		stmt := strings.TrimSpace(up[i])
+		if stmt == "" || strings.HasPrefix(stmt, "--") {
+			continue
+		}
+		if reverse, ok := reverseStatement(drv, stmt); ok {
+			down = append(down, reverse)
+			continue
+		}
+		complete = false
+		firstLine := strings.SplitN(stmt, "\n", 2)[0]
+		down = append(down, "-- TODO: no automatic down migration for: "+firstLine)
+	}
+	return down, complete
+}
+
+func reverseStatement(drv, stmt string) (string, bool) {
+	if m := createTable.FindStringSubmatch(stmt); m != nil {
+		return "DROP TABLE " + m[1], true
+	}
+	if m := createIndex.FindStringSubmatch(stmt); m != nil {
+		index, table := m[1], m[2]
+		switch drv {
+		case constants.DriverMySQL, constants.DriverSQLServer:
+			return "DROP INDEX " + index + " ON " + table, true
+		case constants.DriverPostgres:
+			// indexes live in their table's schema
+			if !strings.Contains(index, ".") {
+				if dot := lastDot(table); dot > 0 {
+					index = table[:dot] + "." + index
+				}
+			}
+		}
+		return "DROP INDEX " + index, true
+	}
+	if m := createView.FindStringSubmatch(stmt); m != nil {
+		// CREATE OR REPLACE would need the previous definition
+		if m[1] != "" {
+			return "DROP MATERIALIZED VIEW " + m[2], true
+		}
+		return "DROP VIEW " + m[2], true
+	}
+	if m := createObject.FindStringSubmatch(stmt); m != nil {
+		return "DROP " + strings.ToUpper(m[1]) + " " + m[2], true
+	}
+	if m := addConstraint.FindStringSubmatch(stmt); m != nil {
+		table, name := m[1], m[2]
+		kind := strings.ToUpper(strings.Join(strings.Fields(m[3]), " "))
+		switch drv {
+		case constants.DriverSQLite:
+			return "", false
+		case constants.DriverMySQL:
+			switch kind {
+			case "PRIMARY KEY":
+				return "ALTER TABLE " + table + " DROP PRIMARY KEY", true
+			case "FOREIGN KEY":
+				return "ALTER TABLE " + table + " DROP FOREIGN KEY " + name, true
+			case "UNIQUE":
+				return "ALTER TABLE " + table + " DROP INDEX " + name, true
+			default:
+				return "ALTER TABLE " + table + " DROP CHECK " + name, true
+			}
+		}
+		return "ALTER TABLE " + table + " DROP CONSTRAINT " + name, true
+	}
+	if m := addColumn.FindStringSubmatch(stmt); m != nil && !constraintWord.MatchString(m[2]) {
+		return "ALTER TABLE " + m[1] + " DROP COLUMN " + m[2], true
+	}
+	return "", false
+}
+
+// lastDot finds the schema separator in a qualified identifier, ignoring dots inside quotes
+func lastDot(ident string) int {
+	quote := rune(0)
+	last := -1
+	for i, ch := range ident {
+		switch {
+		case quote != 0:
+			if ch == quote {
+				quote = 0
+			}
+		case ch == '"' || ch == '`':
+			quote = ch
+		case ch == '[':
+			quote = ']'
+		case ch == '.':
+			last = i
+		}
+	}
+	return last
+}
+
+// Result describes captured migration files
+type Result struct {
+	Migration
+	Format string `json:"format"`
+	Files  []File `json:"files"`
+	// Written is true when the files were stored in the migrations directory;
+	// otherwise they are returned for download only
+	Written bool `json:"written"`
+}
+
+// Capture renders a migration and writes it to dir when one is configured
+func Capture(dir, format, drv, name string, up, down []string) (Result, error) {
+	if format == "" {
+		format = FormatGolangMigrate
+	}
+	m := New(drv, name, up, down)
+	files, err := m.Files(format)
+	if err != nil {
+		return Result{}, err
+	}
+
+	result := Result{Migration: m, Format: format, Files: files}
+	if strings.TrimSpace(dir) != "" {
+		if result.Files, err = Write(dir, files); err != nil {
+			return Result{}, err
+		}
+		result.Written = true
+	}
+	return result, nil
+}
@@ -0,0 +1,326 @@
+// Package ratelimit slows clients down: token buckets cap the requests of
+// each client address and each session, connect attempts get a stricter
+// bucket of their own, and repeated failed connects lock the client out
+// for a time that doubles with every further failure. Failures are kept
+// by the server they were made against, so connecting to one server
+// doesn't forgive the failures against another. It keeps weebase from
+// being used to try database passwords as fast as they can be sent.
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Rate allows Requests per Per, in bursts of up to Burst (Requests when
+// 0). A Rate without Requests doesn't limit.
+type Rate struct {
+	Requests int
+	Per      time.Duration
+	Burst    int
+}
+
+func (r Rate) burst() float64 {
+	if r.Burst > 0 {
+		return float64(r.Burst)
+	}
+	return float64(r.Requests)
+}
+
+// interval is the time one token takes to come back
+func (r Rate) interval() time.Duration {
+	return r.Per / time.Duration(r.Requests)
+}
+
+// Config sets the limits. Failed connects lock a client out once there
+// have been LockoutAfter of them in a row, first for Lockout and then
+// twice as long with every further failure, up to MaxLockout.
+type Config struct {
+	// IP limits every request of a client address
+	IP Rate
+	// Session limits every request of a session
+	Session Rate
+	// Connect limits the connect attempts of a client address
+	Connect      Rate
+	LockoutAfter int
+	Lockout      time.Duration
+	MaxLockout   time.Duration
+	// TrustProxy takes the client address from the X-Forwarded-For header
+	// set by the proxy in front of weebase
+	TrustProxy bool
+}
+
+// DefaultConfig returns the limits used when none are configured
+func DefaultConfig() Config {
+	return Config{
+		IP:           Rate{Requests: 600, Per: time.Minute},
+		Session:      Rate{Requests: 300, Per: time.Minute},
+		Connect:      Rate{Requests: 10, Per: time.Minute},
+		LockoutAfter: 5,
+		Lockout:      30 * time.Second,
+		MaxLockout:   time.Hour,
+	}
+}
+
+// Limiter enforces a Config; it is safe for concurrent use
+type Limiter struct {
+	cfg     Config
+	now     func() time.Time
+	ip      *buckets
+	session *buckets
+	connect *buckets
+
+	mu       sync.Mutex
+	failures map[string]*failure
+	swept    time.Time
+}
+
+// New creates a Limiter
+func New(cfg Config) *Limiter {
+	return &Limiter{
+		cfg:      cfg,
+		now:      time.Now,
+		ip:       newBuckets(cfg.IP),
+		session:  newBuckets(cfg.Session),
+		connect:  newBuckets(cfg.Connect),
+		failures: map[string]*failure{},
+	}
+}
+
+// Allow takes a request of the client address and session ("" when it has
+// none) out of their buckets. When it is refused, retry is how long until
+// it would be let through.
+func (l *Limiter) Allow(client, session string) (ok bool, retry time.Duration) {
+	now := l.now()
+	if ok, retry := l.ip.take(client, now); !ok {
+		return false, retry
+	}
+	if session == "" {
+		return true, 0
+	}
+	return l.session.take(session, now)
+}
+
+// AllowConnect takes a connect attempt of the client address, refusing it
+// while the client is locked out
+func (l *Limiter) AllowConnect(client string) (ok bool, retry time.Duration) {
+	now := l.now()
+	l.mu.Lock()
+	if f := l.failures[client]; f != nil && now.Before(f.until) {
+		l.mu.Unlock()
+		return false, f.until.Sub(now)
+	}
+	l.mu.Unlock()
+	return l.connect.take(client, now)
+}
+
+// ConnectFailed counts a failed connect of the client address to target,
+// locking it out once there have been too many to all targets together
+func (l *Limiter) ConnectFailed(client, target string) {
+	now := l.now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.sweepFailures(now)
+	f := l.failures[client]
+	if f == nil {
+		f = &failure{targets: map[string]int{}}
+		l.failures[client] = f
+	}
+	f.targets[target]++
+	f.count++
+	f.last = now
+	if l.cfg.LockoutAfter > 0 && f.count >= l.cfg.LockoutAfter {
+		f.until = now.Add(l.lockout(f.count - l.cfg.LockoutAfter))
+	}
+}
+
+// ConnectSucceeded forgets the failed connects of the client address to
+// target; its failures against other targets still count
+func (l *Limiter) ConnectSucceeded(client, target string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	f := l.failures[client]
+	if f == nil {
+		return
+	}
+	f.count -= f.targets[target]
+	delete(f.targets, target)
+	if f.count == 0 {
+		delete(l.failures, client)
+	} else if l.cfg.LockoutAfter <= 0 || f.count < l.cfg.LockoutAfter {
+		f.until = time.Time{}
+	}
+}
+
+// lockout is the lockout after the n-th failure past LockoutAfter
+func (l *Limiter) lockout(n int) time.Duration {
+	d := l.cfg.Lockout
+	for n = min(n, 30); n > 0 && (l.cfg.MaxLockout <= 0 || d < l.cfg.MaxLockout); n-- {
+		d *= 2
+	}
+	if l.cfg.MaxLockout > 0 && d > l.cfg.MaxLockout {
+		d = l.cfg.MaxLockout
+	}
+	return d
+}
+
+// sweepFailures forgets clients whose last failure is long past, at most
+// once a minute
+func (l *Limiter) sweepFailures(now time.Time) {
+	if now.Sub(l.swept) < time.Minute {
+		return
+	}
+	l.swept = now
+	keep := 2 * max(l.cfg.MaxLockout, l.cfg.Lockout, time.Hour)
+	for client, f := range l.failures {
+		if now.Sub(f.last) > keep && now.After(f.until) {
+			delete(l.failures, client)
+		}
+	}
+}
+
+type failure struct {
+	// count is the sum of targets, the failures by target
+	targets map[string]int
+	count   int
+	last    time.Time
+	until   time.Time
+}
+
+// buckets are the token buckets of one Rate, by key
+type buckets struct {
+	rate  Rate
+	mu    sync.Mutex
+	m     map[string]*bucket
+	swept time.Time
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func newBuckets(rate Rate) *buckets {
+	return &buckets{rate: rate, m: map[string]*bucket{}}
+}
+
+// take takes a token of key, or returns how long until there is one
+func (b *buckets) take(key string, now time.Time) (bool, time.Duration) {
+	if b.rate.Requests <= 0 || b.rate.Per <= 0 {
+		return true, 0
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.sweep(now)
+
+	interval := b.rate.interval()
+	k := b.m[key]
+	if k == nil {
+		k = &bucket{tokens: b.rate.burst(), last: now}
+		b.m[key] = k
+	}
+	k.tokens = math.Min(b.rate.burst(), k.tokens+float64(now.Sub(k.last))/float64(interval))
+	k.last = now
+	if k.tokens >= 1 {
+		k.tokens--
+		return true, 0
+	}
+	return false, time.Duration((1 - k.tokens) * float64(interval))
+}
+
+// sweep drops the buckets that have filled up again, at most once a
+// minute, so idle clients don't keep memory
+func (b *buckets) sweep(now time.Time) {
+	if now.Sub(b.swept) < time.Minute {
+		return
+	}
+	b.swept = now
+	full := time.Duration(b.rate.burst() * float64(b.rate.interval()))
+	for key, k := range b.m {
+		if now.Sub(k.last) > full {
+			delete(b.m, key)
+		}
+	}
+}
+
+// ClientAddress returns the address requests of r are limited by. IPv6
+// clients are limited by their /64 network, as one client usually holds
+// all of it.
+func (l *Limiter) ClientAddress(r *http.Request) string {
+	addr := r.RemoteAddr
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		addr = host
+	}
+	if l.cfg.TrustProxy {
+		// the last entry is the one added by the proxy in front of weebase
+		if fwd := r.Header.Values("X-Forwarded-For"); len(fwd) > 0 {
+			hops := strings.Split(fwd[len(fwd)-1], ",")
+			if hop := strings.TrimSpace(hops[len(hops)-1]); hop != "" {
+				addr = hop
+			}
+		}
+	}
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return addr
+	}
+	if ip.To4() == nil {
+		return ip.Mask(net.CIDRMask(64, 128)).String() + "/64"
+	}
+	return ip.String()
+}
+
+// ErrLimited is returned, wrapped, by Connect when the client may not
+// connect now
+var ErrLimited = errors.New("too many connect attempts")
+
+// gate is the limiter and client address of a request
+type gate struct {
+	limiter *Limiter
+	client  string
+}
+
+type ctxKey struct{}
+
+// WithClient returns a copy of ctx whose connects are limited by l as
+// those of the client address
+func WithClient(ctx context.Context, l *Limiter, client string) context.Context {
+	return context.WithValue(ctx, ctxKey{}, gate{limiter: l, client: client})
+}
+
+// Connect takes a connect attempt of the request's client, refusing it
+// while the client is locked out. Requests without a client are let
+// through. The connect action is admitted before its handler runs and
+// doesn't call it.
+func Connect(ctx context.Context) error {
+	g, ok := ctx.Value(ctxKey{}).(gate)
+	if !ok {
+		return nil
+	}
+	if ok, retry := g.limiter.AllowConnect(g.client); !ok {
+		return fmt.Errorf("%w, retry in %d seconds", ErrLimited, int(math.Ceil(retry.Seconds())))
+	}
+	return nil
+}
+
+// Report records the outcome of a connect of the request's client to
+// target, failed when the database turned it away. Requests without a
+// client are left alone.
+func Report(ctx context.Context, target string, failed bool) {
+	g, ok := ctx.Value(ctxKey{}).(gate)
+	if !ok {
+		return
+	}
+	if failed {
+		g.limiter.ConnectFailed(g.client, target)
+	} else {
+		g.limiter.ConnectSucceeded(g.client, target)
+	}
+}
@@ -0,0 +1,143 @@
+package ratelimit
+
+import (
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// clock is a settable time source
+type clock struct{ t time.Time }
+
+func (c *clock) now() time.Time          { return c.t }
+func (c *clock) advance(d time.Duration) { c.t = c.t.Add(d) }
+
+func newTestLimiter(cfg Config) (*Limiter, *clock) {
+	c := &clock{t: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)}
+	l := New(cfg)
+	l.now = c.now
+	return l, c
+}
+
+func TestAllow(t *testing.T) {
+	l, c := newTestLimiter(Config{
+		IP:      Rate{Requests: 3, Per: time.Minute},
+		Session: Rate{Requests: 2, Per: time.Minute},
+	})
+
+	for i := range 3 {
+		if ok, _ := l.Allow("1.2.3.4", ""); !ok {
+			t.Fatalf("request %d refused within the burst", i+1)
+		}
+	}
+	ok, retry := l.Allow("1.2.3.4", "")
+	if ok || retry != 20*time.Second {
+		t.Fatalf("expected a refusal with 20s to wait, got %v %v", ok, retry)
+	}
+	if ok, _ := l.Allow("5.6.7.8", ""); !ok {
+		t.Error("another client must have its own bucket")
+	}
+
+	c.advance(20 * time.Second)
+	if ok, _ := l.Allow("1.2.3.4", ""); !ok {
+		t.Error("expected a token back after 20s")
+	}
+
+	// the session bucket applies across client addresses
+	l.Allow("10.0.0.1", "s1")
+	l.Allow("10.0.0.2", "s1")
+	if ok, _ := l.Allow("10.0.0.3", "s1"); ok {
+		t.Error("expected the session limit to apply")
+	}
+}
+
+func TestConnectLockout(t *testing.T) {
+	l, c := newTestLimiter(Config{
+		Connect:      Rate{Requests: 100, Per: time.Minute},
+		LockoutAfter: 3,
+		Lockout:      time.Minute,
+		MaxLockout:   3 * time.Minute,
+	})
+
+	for range 2 {
+		l.ConnectFailed("1.2.3.4", "db-a")
+	}
+	if ok, _ := l.AllowConnect("1.2.3.4"); !ok {
+		t.Fatal("locked out before LockoutAfter failures")
+	}
+
+	for i, want := range []time.Duration{time.Minute, 2 * time.Minute, 3 * time.Minute, 3 * time.Minute} {
+		l.ConnectFailed("1.2.3.4", "db-a")
+		ok, retry := l.AllowConnect("1.2.3.4")
+		if ok || retry != want {
+			t.Fatalf("failure %d: expected a %v lockout, got %v %v", i+3, want, ok, retry)
+		}
+		c.advance(want)
+	}
+	if ok, _ := l.AllowConnect("1.2.3.4"); !ok {
+		t.Error("expected the lockout to end")
+	}
+
+	l.ConnectSucceeded("1.2.3.4", "db-a")
+	l.ConnectFailed("1.2.3.4", "db-a")
+	if ok, _ := l.AllowConnect("1.2.3.4"); !ok {
+		t.Error("a success must reset the failure count")
+	}
+}
+
+func TestConnectSucceededByTarget(t *testing.T) {
+	l, _ := newTestLimiter(Config{
+		Connect:      Rate{Requests: 100, Per: time.Minute},
+		LockoutAfter: 3,
+		Lockout:      time.Minute,
+	})
+
+	// failures against b.example.com aren't forgiven by connecting to a
+	// database the client does know the password of
+	l.ConnectFailed("1.2.3.4", "b.example.com")
+	l.ConnectFailed("1.2.3.4", "b.example.com")
+	l.ConnectFailed("1.2.3.4", "a.example.com")
+	l.ConnectSucceeded("1.2.3.4", "a.example.com")
+	if ok, _ := l.AllowConnect("1.2.3.4"); !ok {
+		t.Fatal("expected the lockout to end with the failures of a.example.com")
+	}
+	l.ConnectFailed("1.2.3.4", "b.example.com")
+	if ok, _ := l.AllowConnect("1.2.3.4"); ok {
+		t.Error("expected the failures against b.example.com to still count")
+	}
+}
+
+func TestConnect(t *testing.T) {
+	l, _ := newTestLimiter(Config{
+		Connect:      Rate{Requests: 100, Per: time.Minute},
+		LockoutAfter: 2,
+		Lockout:      time.Minute,
+	})
+	if err := Connect(t.Context()); err != nil {
+		t.Fatalf("a request without a client must not be limited, got %v", err)
+	}
+
+	ctx := WithClient(t.Context(), l, "1.2.3.4")
+	Report(ctx, "db", true)
+	if err := Connect(ctx); err != nil {
+		t.Fatalf("locked out before LockoutAfter failures: %v", err)
+	}
+	Report(ctx, "db", true)
+	if err := Connect(ctx); !errors.Is(err, ErrLimited) {
+		t.Errorf("expected ErrLimited, got %v", err)
+	}
+}
+
+func TestClientAddress(t *testing.T) {
+	r := httptest.NewRequest("GET", "/", nil)
+	r.RemoteAddr = "[2001:db8::1]:4000"
+	r.Header.Set("X-Forwarded-For", "9.9.9.9, 1.2.3.4")
+
+	if got := New(Config{}).ClientAddress(r); got != "2001:db8::/64" {
+		t.Errorf("expected the /64 of the peer, got %q", got)
+	}
+	if got := New(Config{TrustProxy: true}).ClientAddress(r); got != "1.2.3.4" {
+		t.Errorf("expected the address the proxy added, got %q", got)
+	}
+}
@@ -0,0 +1,130 @@
+package rbac
+
+import "github.com/dracory/weebase/shared/constants"
+
+// Rule is what an action requires of the operator
+type Rule struct {
+	// Permission is checked on the objects the action names; "" leaves the
+	// action open to every operator
+	Permission string
+	// Source, when set, is checked on the source_ side of actions that read
+	// from one connection and act on a target_ one; Permission then applies
+	// to the target_ side
+	Source string
+	// Backup scopes the action by the backup profile in the "profile" field
+	// instead of the session's connection
+	Backup bool
+	// Global actions aren't about any connection: the permission is
+	// checked on its own
+	Global bool
+	// Unmasked actions write rows out where they can't be masked, so they
+	// also need PermUnmask on whatever masking rules cover
+	Unmasked bool
+	// Executes marks SQL actions that may write whatever their input looks
+	// like, such as calling a routine; other SQL actions check their
+	// statements themselves
+	Executes bool
+}
+
+// Writes reports whether the action may change data or structure, so
+// read-only mode refuses it. Unclassified actions are assumed to.
+func (r Rule) Writes() bool {
+	switch r.Permission {
+	case PermEdit, PermDDL, PermImport, PermRestore, PermAll:
+		return true
+	}
+	return r.Executes
+}
+
+// actionRules classifies every routed action. Actions missing here are
+// only allowed to roles granted every permission, so new actions are
+// closed until they are classified.
+var actionRules = map[string]Rule{
+	// Session, profiles, jobs and API tokens are open: jobs and tokens are
+	// scoped to their owner and jobs were authorized when submitted
+	constants.ActionApiConnect:      {},
+	constants.ActionApiDisconnect:   {},
+	constants.ActionApiProfilesList: {},
+	constants.ActionApiProfilesSave: {},
+	constants.ActionApiJobsList:     {},
+	constants.ActionApiJobStatus:    {},
+	constants.ActionApiJobDownload:  {},
+	constants.ActionApiTokensList:   {},
+	constants.ActionApiTokenCreate:  {},
+	constants.ActionApiTokenRevoke:  {},
+	constants.ActionAssetCSS:        {},
+	constants.ActionAssetJS:         {},
+	constants.ActionPageHome:        {},
+	constants.ActionPageServer:      {},
+	constants.ActionPageLogin:       {},
+	constants.ActionPageLogout:      {},
+	constants.ActionPageProfiles:    {},
+	constants.ActionPageTokens:      {},
+
+	constants.ActionApiDatabasesList:  {Permission: PermBrowse},
+	constants.ActionApiSchemasList:    {Permission: PermBrowse},
+	constants.ActionApiTablesList:     {Permission: PermBrowse},
+	constants.ActionApiTableList:      {Permission: PermBrowse},
+	constants.ActionApiTableInfo:      {Permission: PermBrowse},
+	constants.ActionApiBrowseRows:     {Permission: PermBrowse},
+	constants.ActionApiRowView:        {Permission: PermBrowse},
+	constants.ActionApiViewDefinition: {Permission: PermBrowse},
+	constants.ActionApiRoutinesList:   {Permission: PermBrowse},
+	constants.ActionApiSequencesList:  {Permission: PermBrowse},
+	constants.ActionApiTypesList:      {Permission: PermBrowse},
+	constants.ActionApiImportPreview:  {Permission: PermBrowse},
+	constants.ActionApiSchemaDiff:     {Permission: PermBrowse, Source: PermBrowse},
+	constants.ActionApiDataDiff:       {Permission: PermBrowse, Source: PermBrowse, Unmasked: true},
+	constants.ActionPageDatabase:      {Permission: PermBrowse},
+	constants.ActionPageTable:         {Permission: PermBrowse},
+	constants.ActionPageRoutines:      {Permission: PermBrowse},
+	constants.ActionApiRowChanges:     {Permission: PermBrowse},
+	constants.ActionPageChanges:       {Permission: PermBrowse},
+
+	constants.ActionApiInsertRow: {Permission: PermEdit},
+	constants.ActionApiUpdateRow: {Permission: PermEdit},
+	constants.ActionApiDeleteRow: {Permission: PermEdit},
+	constants.ActionApiRowUndo:   {Permission: PermEdit},
+
+	constants.ActionApiSQLExecute:     {Permission: PermSQL},
+	constants.ActionApiSQLExplain:     {Permission: PermSQL},
+	constants.ActionApiSQLImport:      {Permission: PermSQL},
+	constants.ActionApiRoutineExecute: {Permission: PermSQL, Executes: true},
+	constants.ActionPageSQLExecute:    {Permission: PermSQL},
+
+	constants.ActionApiTableCreate:       {Permission: PermDDL},
+	constants.ActionApiViewCreate:        {Permission: PermDDL},
+	constants.ActionApiViewDrop:          {Permission: PermDDL},
+	constants.ActionApiViewRefresh:       {Permission: PermDDL},
+	constants.ActionApiSequenceSetval:    {Permission: PermDDL},
+	constants.ActionApiSequenceRestart:   {Permission: PermDDL},
+	constants.ActionApiEnumAddValue:      {Permission: PermDDL},
+	constants.ActionApiMigrationGenerate: {Permission: PermDDL},
+	constants.ActionPageTableCreate:      {Permission: PermDDL},
+
+	constants.ActionApiExport:  {Permission: PermExport},
+	constants.ActionApiDump:    {Permission: PermExport},
+	constants.ActionPageExport: {Permission: PermExport},
+
+	constants.ActionApiImport:    {Permission: PermImport},
+	constants.ActionApiTableCopy: {Permission: PermImport, Source: PermBrowse, Unmasked: true},
+	constants.ActionPageImport:   {Permission: PermImport},
+	constants.ActionPageCopy:     {Permission: PermImport},
+
+	constants.ActionApiBackupsList:   {Permission: PermBackup, Backup: true},
+	constants.ActionApiBackupCreate:  {Permission: PermBackup, Backup: true, Unmasked: true},
+	constants.ActionApiBackupRestore: {Permission: PermRestore, Backup: true, Unmasked: true},
+	constants.ActionPageBackups:      {Permission: PermBackup, Backup: true},
+
+	constants.ActionApiAuditSearch: {Permission: PermAudit, Global: true},
+	constants.ActionPageAudit:      {Permission: PermAudit, Global: true},
+}
+
+// ActionRule returns the rule of an action; unclassified actions require
+// every permission
+func ActionRule(action string) Rule {
+	if rule, ok := actionRules[action]; ok {
+		return rule
+	}
+	return Rule{Permission: PermAll}
+}
@@ -0,0 +1,282 @@
+// Package rbac decides what an operator may do. Roles grant permissions such
+// as browsing or editing rows, optionally scoped to connection profiles,
+// schemas and table patterns; a Policy, loaded from config, gives roles to
+// operators.
+package rbac
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/dracory/weebase/shared/auth"
+	"github.com/dracory/weebase/shared/glob"
+)
+
+// Permissions granted by roles
+const (
+	PermBrowse  = "browse"  // list objects and read rows
+	PermEdit    = "edit"    // insert, update and delete rows
+	PermSQL     = "sql"     // run arbitrary SQL, scripts and routines
+	PermDDL     = "ddl"     // create, alter and drop objects
+	PermExport  = "export"  // export and dump data
+	PermImport  = "import"  // import files and copy tables in
+	PermBackup  = "backup"  // list and take backups
+	PermRestore = "restore" // restore backups
+	PermAudit   = "audit"   // search the audit log
+	PermUnmask  = "unmask"  // see the columns of masking rules unmasked
+	PermAll     = "*"       // every permission
+)
+
+// Permissions lists every permission a role can be granted
+var Permissions = []string{PermBrowse, PermEdit, PermSQL, PermDDL, PermExport, PermImport, PermBackup, PermRestore, PermAudit, PermUnmask}
+
+// Grant gives permissions on the objects matching all of its patterns.
+// Patterns are case-insensitive and may use * and ?; an empty list matches
+// anything. Tables only narrow requests that name a table: requests that
+// don't (listing tables, running SQL) are only granted by grants without
+// Tables, except browse so the scoped tables can still be listed.
+type Grant struct {
+	Permissions []string `json:"permissions"`
+	Profiles    []string `json:"profiles,omitempty"`
+	Schemas     []string `json:"schemas,omitempty"`
+	Tables      []string `json:"tables,omitempty"`
+}
+
+// ProfileMatch names connections: a connection belongs to the profile when
+// its driver equals Driver (if set) and its DSN matches the DSN pattern
+type ProfileMatch struct {
+	Driver string `json:"driver,omitempty"`
+	DSN    string `json:"dsn"`
+}
+
+// Policy maps operators to roles. Users are looked up by name; DefaultRoles
+// apply to everyone, including anonymous operators when no authenticator
+// is configured.
+type Policy struct {
+	Profiles     map[string]ProfileMatch `json:"profiles,omitempty"`
+	Roles        map[string][]Grant      `json:"roles"`
+	Users        map[string][]string     `json:"users,omitempty"`
+	DefaultRoles []string                `json:"default_roles,omitempty"`
+}
+
+// Request is one permission check. Profile is the name of the connection's
+// profile ("" for connections matching none) and Table may be empty when
+// the action isn't about a single table.
+type Request struct {
+	Permission string
+	Profile    string
+	Schema     string
+	Table      string
+}
+
+// Load reads a JSON policy file
+func Load(path string) (*Policy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read RBAC policy: %v", err)
+	}
+	policy, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid RBAC policy file %s: %v", path, err)
+	}
+	return policy, nil
+}
+
+// Parse decodes and validates a JSON policy
+func Parse(data []byte) (*Policy, error) {
+	var policy Policy
+	if err := json.Unmarshal(data, &policy); err != nil {
+		return nil, err
+	}
+	if err := policy.Validate(); err != nil {
+		return nil, err
+	}
+	return &policy, nil
+}
+
+// Validate reports unknown permissions and references to undefined roles
+func (p *Policy) Validate() error {
+	for role, grants := range p.Roles {
+		for _, g := range grants {
+			if len(g.Permissions) == 0 {
+				return fmt.Errorf("role %q: grant without permissions", role)
+			}
+			for _, perm := range g.Permissions {
+				if perm != PermAll && !slices.Contains(Permissions, perm) {
+					return fmt.Errorf("role %q: unknown permission %q", role, perm)
+				}
+			}
+		}
+	}
+	for user, roles := range p.Users {
+		for _, role := range roles {
+			if _, ok := p.Roles[role]; !ok {
+				return fmt.Errorf("user %q: undefined role %q", user, role)
+			}
+		}
+	}
+	for _, role := range p.DefaultRoles {
+		if _, ok := p.Roles[role]; !ok {
+			return fmt.Errorf("default_roles: undefined role %q", role)
+		}
+	}
+	for name, m := range p.Profiles {
+		if m.DSN == "" {
+			return fmt.Errorf("profile %q: dsn pattern is required", name)
+		}
+	}
+	return nil
+}
+
+// RolesOf returns the roles of the operator: those it was authenticated
+// with, those the policy gives its name and the default roles, narrowed to
+// the roles of its API token scope
+func (p *Policy) RolesOf(user auth.User) []string {
+	roles := slices.Clone(user.Roles)
+	roles = append(roles, p.Users[user.Name]...)
+	roles = append(roles, p.DefaultRoles...)
+	if user.Scope != nil && len(user.Scope.Roles) > 0 {
+		roles = slices.DeleteFunc(roles, func(role string) bool {
+			return !slices.Contains(user.Scope.Roles, role)
+		})
+	}
+	return roles
+}
+
+// inScope reports whether the API token scope of the operator, if any,
+// covers the profile
+func inScope(user auth.User, profile string) bool {
+	return user.Scope == nil || len(user.Scope.Profiles) == 0 || slices.Contains(user.Scope.Profiles, profile)
+}
+
+// Allowed reports whether any role of the operator grants the request
+func (p *Policy) Allowed(user auth.User, req Request) bool {
+	if !inScope(user, req.Profile) {
+		return false
+	}
+	for _, role := range p.RolesOf(user) {
+		for _, g := range p.Roles[role] {
+			if g.allows(req) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Granted returns the permissions the operator holds on some object of the
+// profile, used to hide controls the operator can't use
+func (p *Policy) Granted(user auth.User, profile string) []string {
+	var granted []string
+	if !inScope(user, profile) {
+		return granted
+	}
+	for _, role := range p.RolesOf(user) {
+		for _, g := range p.Roles[role] {
+			if !matchAny(g.Profiles, profile) {
+				continue
+			}
+			for _, perm := range Permissions {
+				if g.has(perm) && !slices.Contains(granted, perm) {
+					granted = append(granted, perm)
+				}
+			}
+		}
+	}
+	return granted
+}
+
+// Holds reports whether the operator was granted perm on anything at all.
+// It is checked for actions about no connection profile, which an API
+// token narrowed to profiles doesn't cover.
+func (p *Policy) Holds(user auth.User, perm string) bool {
+	if !inScope(user, "") {
+		return false
+	}
+	for _, role := range p.RolesOf(user) {
+		for _, g := range p.Roles[role] {
+			if g.has(perm) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Profile names the profile of a connection, "" when it matches none.
+// Profiles are tried in name order so overlapping patterns resolve the
+// same way every time.
+func (p *Policy) Profile(driver, dsn string) string {
+	names := make([]string, 0, len(p.Profiles))
+	for name := range p.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		m := p.Profiles[name]
+		if m.Driver != "" && !strings.EqualFold(m.Driver, driver) {
+			continue
+		}
+		if glob.Match(m.DSN, dsn) {
+			return name
+		}
+	}
+	return ""
+}
+
+type ctxKey struct{}
+
+// WithGranted returns a copy of ctx carrying the permissions the operator
+// holds on the current connection
+func WithGranted(ctx context.Context, granted []string) context.Context {
+	return context.WithValue(ctx, ctxKey{}, granted)
+}
+
+// Denied returns the permissions the operator lacks on the current
+// connection; nil when no policy applies to the request
+func Denied(ctx context.Context) []string {
+	granted, ok := ctx.Value(ctxKey{}).([]string)
+	if !ok {
+		return nil
+	}
+	var denied []string
+	for _, perm := range Permissions {
+		if !slices.Contains(granted, perm) {
+			denied = append(denied, perm)
+		}
+	}
+	return denied
+}
+
+func (g Grant) has(perm string) bool {
+	return slices.Contains(g.Permissions, PermAll) || slices.Contains(g.Permissions, perm)
+}
+
+func (g Grant) allows(req Request) bool {
+	if !g.has(req.Permission) || !matchAny(g.Profiles, req.Profile) || !matchAny(g.Schemas, req.Schema) {
+		return false
+	}
+	if req.Table == "" {
+		return len(g.Tables) == 0 || req.Permission == PermBrowse
+	}
+	return matchAny(g.Tables, req.Table)
+}
+
+// matchAny reports whether s matches one of the patterns; no patterns
+// match anything
+func matchAny(patterns []string, s string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, pattern := range patterns {
+		if glob.Match(pattern, s) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,167 @@
+package rbac
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/dracory/weebase/shared/auth"
+	"github.com/dracory/weebase/shared/constants"
+)
+
+const testPolicy = `{
+	"profiles": {
+		"production": {"driver": "postgres", "dsn": "*host=prod-db*"},
+		"staging": {"dsn": "*staging*"}
+	},
+	"roles": {
+		"support": [{"permissions": ["browse"], "profiles": ["production"]}, {"permissions": ["browse", "export"], "profiles": ["staging"]}],
+		"billing": [{"permissions": ["browse", "edit"], "profiles": ["staging"], "schemas": ["public"], "tables": ["invoice*"]}],
+		"dba": [{"permissions": ["*"]}]
+	},
+	"users": {"alice": ["dba"], "bob": ["support"]}
+}`
+
+func loadTestPolicy(t *testing.T) *Policy {
+	policy, err := Parse([]byte(testPolicy))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	return policy
+}
+
+func TestPolicy_Allowed(t *testing.T) {
+	policy := loadTestPolicy(t)
+	alice := auth.User{Name: "alice"}
+	bob := auth.User{Name: "bob"}
+	carol := auth.User{Name: "carol", Roles: []string{"billing"}}
+	aliceStaging := auth.User{Name: "alice", Scope: &auth.Scope{Profiles: []string{"staging"}}}
+	carolSupport := auth.User{Name: "carol", Roles: []string{"billing"}, Scope: &auth.Scope{Roles: []string{"support"}}}
+
+	tests := []struct {
+		name string
+		user auth.User
+		req  Request
+		want bool
+	}{
+		{"support browses production", bob, Request{Permission: PermBrowse, Profile: "production", Schema: "public", Table: "orders"}, true},
+		{"support can't edit production", bob, Request{Permission: PermEdit, Profile: "production", Schema: "public", Table: "orders"}, false},
+		{"support can't run SQL on production", bob, Request{Permission: PermSQL, Profile: "production", Schema: "public"}, false},
+		{"support exports staging", bob, Request{Permission: PermExport, Profile: "staging", Table: "orders"}, true},
+		{"support has nothing on ad-hoc connections", bob, Request{Permission: PermBrowse}, false},
+		{"dba does anything", alice, Request{Permission: PermDDL, Profile: "production", Schema: "public", Table: "orders"}, true},
+		{"dba runs unclassified actions", alice, Request{Permission: PermAll}, true},
+		{"support can't run unclassified actions", bob, Request{Permission: PermAll, Profile: "production"}, false},
+		{"roles from the authenticator", carol, Request{Permission: PermEdit, Profile: "staging", Schema: "public", Table: "Invoices"}, true},
+		{"table pattern", carol, Request{Permission: PermEdit, Profile: "staging", Schema: "public", Table: "orders"}, false},
+		{"schema pattern", carol, Request{Permission: PermEdit, Profile: "staging", Schema: "audit", Table: "invoices"}, false},
+		{"table scoped grants list tables", carol, Request{Permission: PermBrowse, Profile: "staging", Schema: "public"}, true},
+		{"table scoped grants don't cover all tables", carol, Request{Permission: PermEdit, Profile: "staging", Schema: "public"}, false},
+		{"unknown users have no roles", auth.User{Name: "mallory"}, Request{Permission: PermBrowse, Profile: "staging"}, false},
+		{"token scoped to a profile", aliceStaging, Request{Permission: PermDDL, Profile: "staging", Table: "orders"}, true},
+		{"token scope leaves other profiles out", aliceStaging, Request{Permission: PermBrowse, Profile: "production", Table: "orders"}, false},
+		{"token scope leaves ad-hoc connections out", aliceStaging, Request{Permission: PermBrowse}, false},
+		{"token scope can't add roles", carolSupport, Request{Permission: PermBrowse, Profile: "staging", Table: "orders"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := policy.Allowed(tt.user, tt.req); got != tt.want {
+				t.Errorf("Allowed(%+v) = %v, want %v", tt.req, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPolicy_Profile(t *testing.T) {
+	policy := loadTestPolicy(t)
+
+	tests := []struct {
+		driver, dsn, want string
+	}{
+		{"postgres", "host=prod-db.internal user=app dbname=app", "production"},
+		{"mysql", "host=prod-db.internal user=app dbname=app", ""},
+		{"mysql", "app:pw@tcp(staging.internal:3306)/app?parseTime=true", "staging"},
+		{"sqlite", "file:/tmp/test.db", ""},
+	}
+	for _, tt := range tests {
+		if got := policy.Profile(tt.driver, tt.dsn); got != tt.want {
+			t.Errorf("Profile(%q, %q) = %q, want %q", tt.driver, tt.dsn, got, tt.want)
+		}
+	}
+}
+
+func TestPolicy_Granted(t *testing.T) {
+	policy := loadTestPolicy(t)
+	bob := auth.User{Name: "bob"}
+
+	if got := policy.Granted(bob, "production"); !slices.Equal(got, []string{PermBrowse}) {
+		t.Errorf("expected browse on production, got %v", got)
+	}
+	if got := policy.Granted(bob, ""); len(got) != 0 {
+		t.Errorf("expected nothing on ad-hoc connections, got %v", got)
+	}
+	if got := policy.Granted(auth.User{Name: "alice"}, ""); !slices.Equal(got, Permissions) {
+		t.Errorf("expected every permission for the dba, got %v", got)
+	}
+
+	ctx := WithGranted(context.Background(), policy.Granted(bob, "production"))
+	if denied := Denied(ctx); slices.Contains(denied, PermBrowse) || !slices.Contains(denied, PermEdit) {
+		t.Errorf("unexpected denied permissions %v", denied)
+	}
+	if denied := Denied(context.Background()); denied != nil {
+		t.Errorf("expected nothing denied without a policy, got %v", denied)
+	}
+}
+
+func TestPolicy_Holds(t *testing.T) {
+	policy := loadTestPolicy(t)
+	if !policy.Holds(auth.User{Name: "alice"}, PermAudit) {
+		t.Error("expected the dba to hold audit")
+	}
+	if policy.Holds(auth.User{Name: "bob"}, PermAudit) {
+		t.Error("expected support not to hold audit")
+	}
+	scoped := auth.User{Name: "alice", Scope: &auth.Scope{Profiles: []string{"staging"}}}
+	if policy.Holds(scoped, PermAudit) {
+		t.Error("expected a token narrowed to profiles to hold nothing global")
+	}
+}
+
+func TestParse_Invalid(t *testing.T) {
+	tests := map[string]string{
+		"unknown permission":  `{"roles": {"r": [{"permissions": ["drop"]}]}}`,
+		"empty grant":         `{"roles": {"r": [{}]}}`,
+		"undefined role":      `{"roles": {}, "users": {"bob": ["support"]}}`,
+		"undefined default":   `{"roles": {}, "default_roles": ["viewer"]}`,
+		"profile without dsn": `{"roles": {}, "profiles": {"p": {"driver": "postgres"}}}`,
+		"malformed":           `{"roles": [`,
+	}
+	for name, policy := range tests {
+		if _, err := Parse([]byte(policy)); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestActionRule(t *testing.T) {
+	if rule := ActionRule(constants.ActionApiConnect); rule.Permission != "" {
+		t.Errorf("expected connecting to be open, got %+v", rule)
+	}
+	if rule := ActionRule(constants.ActionApiTableCopy); rule.Permission != PermImport || rule.Source != PermBrowse || !rule.Unmasked {
+		t.Errorf("unexpected table copy rule %+v", rule)
+	}
+	if rule := ActionRule(constants.ActionApiExport); rule.Unmasked || rule.Writes() {
+		t.Errorf("exports are masked as they are written and only read, got %+v", rule)
+	}
+	for _, action := range []string{constants.ActionApiImport, constants.ActionApiUpdateRow, constants.ActionApiEnumAddValue, constants.ActionApiRoutineExecute, "api_something_new"} {
+		if !ActionRule(action).Writes() {
+			t.Errorf("expected %s to write", action)
+		}
+	}
+	if ActionRule(constants.ActionApiSQLExecute).Writes() {
+		t.Error("the SQL console checks its statements itself")
+	}
+	if rule := ActionRule("api_something_new"); rule.Permission != PermAll {
+		t.Errorf("expected unclassified actions to need every permission, got %+v", rule)
+	}
+}
@@ -0,0 +1,163 @@
+package schemadiff
+
+import (
+	"fmt"
+
+	"github.com/dracory/weebase/shared/ddl"
+	"github.com/dracory/weebase/shared/introspect"
+)
+
+// Options controls migration script generation
+type Options struct {
+	// DropRemoved emits DROP statements for objects that exist only in the target.
+	// Without it those objects are listed as comments.
+	DropRemoved bool
+}
+
+// Migration renders the statements that bring target in line with source,
+// in the target's dialect. Operations the target cannot express (e.g. altering
+// a column on SQLite) and routine changes, whose full definitions snapshots
+// don't hold, are emitted as "--" comments and returned as unresolved, so a
+// script applied as is may still leave differences behind.
+func Migration(d Diff, source, target introspect.Schema, opts Options) (stmts []string, unresolved []string) {
+	b := ddl.New(source.Driver, target.Driver)
+	schema := target.Name
+	stmts = []string{fmt.Sprintf("-- migrate %s schema %q to match %s schema %q", target.Driver, target.Name, source.Driver, source.Name)}
+
+	drop := func(stmt string) {
+		if opts.DropRemoved {
+			stmts = append(stmts, stmt)
+		} else {
+			stmts = append(stmts, "-- skipped (drop disabled): "+stmt)
+		}
+	}
+	unresolved = []string{}
+	unsupported := func(format string, args ...any) {
+		step := fmt.Sprintf(format, args...)
+		stmts = append(stmts, "-- manual step required: "+step)
+		unresolved = append(unresolved, step)
+	}
+
+	// views may depend on tables, so they go first and come back last
+	for _, name := range d.ViewsChanged {
+		v, _ := target.View(name)
+		stmts = append(stmts, b.DropView(schema, name, v.Materialized))
+	}
+	for _, name := range d.ViewsRemoved {
+		v, _ := target.View(name)
+		drop(b.DropView(schema, name, v.Materialized))
+	}
+
+	// constraints and indexes that go away, foreign keys first
+	for _, td := range d.TablesChanged {
+		for _, c := range td.ConstraintsRemoved {
+			if c.Type != introspect.ConstraintForeignKey {
+				continue
+			}
+			if stmt, ok := b.DropConstraint(schema, td.Name, c); ok {
+				stmts = append(stmts, stmt)
+			} else {
+				unsupported("drop constraint %s on %s (rebuild the table)", c.Name, td.Name)
+			}
+		}
+	}
+	for _, td := range d.TablesChanged {
+		for _, c := range td.ConstraintsRemoved {
+			if c.Type == introspect.ConstraintForeignKey {
+				continue
+			}
+			if stmt, ok := b.DropConstraint(schema, td.Name, c); ok {
+				stmts = append(stmts, stmt)
+			} else {
+				unsupported("drop constraint %s on %s (rebuild the table)", c.Name, td.Name)
+			}
+		}
+		for _, ix := range td.IndexesRemoved {
+			stmts = append(stmts, b.DropIndex(schema, td.Name, ix.Name))
+		}
+	}
+
+	for _, name := range d.TablesRemoved {
+		drop(b.DropTable(schema, name))
+	}
+
+	for _, name := range d.TablesAdded {
+		t, _ := source.Table(name)
+		stmts = append(stmts, b.CreateTable(schema, t))
+	}
+
+	for _, td := range d.TablesChanged {
+		for _, c := range td.ColumnsAdded {
+			stmts = append(stmts, b.AddColumn(schema, td.Name, c))
+		}
+		for _, cc := range td.ColumnsChanged {
+			alter, ok := b.AlterColumn(schema, td.Name, cc.Source)
+			if !ok {
+				unsupported("alter column %s.%s %v (rebuild the table)", td.Name, cc.Name, cc.Changes)
+				continue
+			}
+			stmts = append(stmts, alter...)
+		}
+		for _, c := range td.ColumnsRemoved {
+			drop(b.DropColumn(schema, td.Name, c.Name))
+		}
+	}
+
+	// indexes and constraints last, so every referenced table exists
+	for _, name := range d.TablesAdded {
+		t, _ := source.Table(name)
+		for _, ix := range t.Indexes {
+			if t.BacksConstraint(ix) {
+				continue
+			}
+			if stmt := b.CreateIndex(schema, name, ix); stmt != "" {
+				stmts = append(stmts, stmt)
+			}
+		}
+	}
+	for _, td := range d.TablesChanged {
+		for _, ix := range td.IndexesAdded {
+			if stmt := b.CreateIndex(schema, td.Name, ix); stmt != "" {
+				stmts = append(stmts, stmt)
+			}
+		}
+	}
+	for _, name := range d.TablesAdded {
+		t, _ := source.Table(name)
+		for _, c := range t.Constraints {
+			if c.Type != introspect.ConstraintForeignKey {
+				continue
+			}
+			// SQLite received its foreign keys inline in CREATE TABLE
+			if stmt, ok := b.AddConstraint(schema, name, c); ok {
+				stmts = append(stmts, stmt)
+			}
+		}
+	}
+	for _, td := range d.TablesChanged {
+		for _, c := range td.ConstraintsAdded {
+			if stmt, ok := b.AddConstraint(schema, td.Name, c); ok {
+				stmts = append(stmts, stmt)
+			} else {
+				unsupported("add %s constraint %s on %s", c.Type, c.Name, td.Name)
+			}
+		}
+	}
+
+	for _, name := range append(append([]string{}, d.ViewsAdded...), d.ViewsChanged...) {
+		v, _ := source.View(name)
+		stmts = append(stmts, b.CreateView(schema, name, v.Definition, v.Materialized))
+	}
+
+	for _, sig := range d.RoutinesAdded {
+		unsupported("create routine %s", sig)
+	}
+	for _, sig := range d.RoutinesChanged {
+		unsupported("update routine %s", sig)
+	}
+	for _, sig := range d.RoutinesRemoved {
+		unsupported("drop routine %s", sig)
+	}
+
+	return stmts, unresolved
+}
@@ -0,0 +1,46 @@
+package schemadiff
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/dracory/weebase/shared/introspect"
+)
+
+func TestMigration_RoutinesUnresolved(t *testing.T) {
+	arg := []introspect.Argument{{Position: 1, Name: "n", Mode: "IN", Type: "integer"}}
+	source := introspect.Schema{Driver: "postgres", Name: "public", Routines: []introspect.Routine{
+		{Name: "added", Kind: introspect.RoutineFunction, Arguments: arg, Body: "SELECT 1"},
+		{Name: "changed", Kind: introspect.RoutineFunction, Arguments: arg, Body: "SELECT n + 1"},
+		{Name: "same", Kind: introspect.RoutineFunction, Body: "SELECT 2"},
+	}}
+	target := introspect.Schema{Driver: "postgres", Name: "public", Routines: []introspect.Routine{
+		{Name: "changed", Kind: introspect.RoutineFunction, Arguments: arg, Body: "SELECT n"},
+		{Name: "removed", Kind: introspect.RoutineProcedure, Body: "BEGIN END"},
+		{Name: "same", Kind: introspect.RoutineFunction, Body: "select  2;"},
+	}}
+
+	d := Compare(source, target)
+	if d.Empty() {
+		t.Fatal("expected routine differences")
+	}
+	stmts, unresolved := Migration(d, source, target, Options{DropRemoved: true})
+
+	want := []string{"create routine added(integer)", "update routine changed(integer)", "drop routine removed()"}
+	if !reflect.DeepEqual(unresolved, want) {
+		t.Errorf("expected unresolved %v, got %v", want, unresolved)
+	}
+	for _, step := range want {
+		found := false
+		for _, stmt := range stmts {
+			found = found || stmt == "-- manual step required: "+step
+		}
+		if !found {
+			t.Errorf("expected the script to mention %q, got %v", step, stmts)
+		}
+	}
+
+	if _, unresolved := Migration(Compare(source, source), source, source, Options{}); len(unresolved) != 0 {
+		t.Errorf("expected nothing unresolved for identical schemas, got %v", unresolved)
+	}
+}
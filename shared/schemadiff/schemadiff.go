@@ -0,0 +1,292 @@
+// Package schemadiff compares two schema snapshots and renders the SQL
+// that brings the target in line with the source.
+package schemadiff
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/dracory/weebase/shared/dialect"
+	"github.com/dracory/weebase/shared/introspect"
+)
+
+// ColumnChange describes a column present on both sides with differing attributes
+type ColumnChange struct {
+	Name    string            `json:"name"`
+	Changes []string          `json:"changes"`
+	Source  introspect.Column `json:"source"`
+	Target  introspect.Column `json:"target"`
+}
+
+// TableDiff lists the differences within a table present on both sides
+type TableDiff struct {
+	Name               string                  `json:"name"`
+	ColumnsAdded       []introspect.Column     `json:"columns_added"`
+	ColumnsRemoved     []introspect.Column     `json:"columns_removed"`
+	ColumnsChanged     []ColumnChange          `json:"columns_changed"`
+	IndexesAdded       []introspect.Index      `json:"indexes_added"`
+	IndexesRemoved     []introspect.Index      `json:"indexes_removed"`
+	ConstraintsAdded   []introspect.Constraint `json:"constraints_added"`
+	ConstraintsRemoved []introspect.Constraint `json:"constraints_removed"`
+}
+
+func (t TableDiff) empty() bool {
+	return len(t.ColumnsAdded)+len(t.ColumnsRemoved)+len(t.ColumnsChanged)+
+		len(t.IndexesAdded)+len(t.IndexesRemoved)+
+		len(t.ConstraintsAdded)+len(t.ConstraintsRemoved) == 0
+}
+
+// Diff is the structured comparison of a source and a target schema.
+// "Added" means present in the source only, "removed" present in the target only.
+type Diff struct {
+	SourceDriver    string      `json:"source_driver"`
+	TargetDriver    string      `json:"target_driver"`
+	TablesAdded     []string    `json:"tables_added"`
+	TablesRemoved   []string    `json:"tables_removed"`
+	TablesChanged   []TableDiff `json:"tables_changed"`
+	ViewsAdded      []string    `json:"views_added"`
+	ViewsRemoved    []string    `json:"views_removed"`
+	ViewsChanged    []string    `json:"views_changed"`
+	RoutinesAdded   []string    `json:"routines_added"`
+	RoutinesRemoved []string    `json:"routines_removed"`
+	RoutinesChanged []string    `json:"routines_changed"`
+}
+
+// Empty reports whether both schemas are equivalent
+func (d Diff) Empty() bool {
+	return len(d.TablesAdded)+len(d.TablesRemoved)+len(d.TablesChanged)+
+		len(d.ViewsAdded)+len(d.ViewsRemoved)+len(d.ViewsChanged)+
+		len(d.RoutinesAdded)+len(d.RoutinesRemoved)+len(d.RoutinesChanged) == 0
+}
+
+// Compare diffs source against target. Column types are compared by
+// canonical family when the drivers differ, and defaults only within one dialect.
+func Compare(source, target introspect.Schema) Diff {
+	d := Diff{
+		SourceDriver:    source.Driver,
+		TargetDriver:    target.Driver,
+		TablesAdded:     []string{},
+		TablesRemoved:   []string{},
+		TablesChanged:   []TableDiff{},
+		ViewsAdded:      []string{},
+		ViewsRemoved:    []string{},
+		ViewsChanged:    []string{},
+		RoutinesAdded:   []string{},
+		RoutinesRemoved: []string{},
+		RoutinesChanged: []string{},
+	}
+	sameDialect := source.Driver == target.Driver
+
+	for _, st := range source.Tables {
+		tt, ok := target.Table(st.Name)
+		if !ok {
+			d.TablesAdded = append(d.TablesAdded, st.Name)
+			continue
+		}
+		if td := compareTable(st, tt, source.Driver, target.Driver); !td.empty() {
+			d.TablesChanged = append(d.TablesChanged, td)
+		}
+	}
+	for _, tt := range target.Tables {
+		if _, ok := source.Table(tt.Name); !ok {
+			d.TablesRemoved = append(d.TablesRemoved, tt.Name)
+		}
+	}
+
+	for _, sv := range source.Views {
+		tv, ok := target.View(sv.Name)
+		switch {
+		case !ok:
+			d.ViewsAdded = append(d.ViewsAdded, sv.Name)
+		case sv.Materialized != tv.Materialized || normalizeSQL(sv.Definition) != normalizeSQL(tv.Definition):
+			d.ViewsChanged = append(d.ViewsChanged, sv.Name)
+		}
+	}
+	for _, tv := range target.Views {
+		if _, ok := source.View(tv.Name); !ok {
+			d.ViewsRemoved = append(d.ViewsRemoved, tv.Name)
+		}
+	}
+
+	sourceRoutines := routinesBySignature(source.Routines)
+	targetRoutines := routinesBySignature(target.Routines)
+	for _, sig := range sortedKeys(sourceRoutines) {
+		sr := sourceRoutines[sig]
+		tr, ok := targetRoutines[sig]
+		switch {
+		case !ok:
+			d.RoutinesAdded = append(d.RoutinesAdded, sig)
+		case sameDialect && (normalizeSQL(sr.Body) != normalizeSQL(tr.Body) || !strings.EqualFold(sr.ReturnType, tr.ReturnType)):
+			d.RoutinesChanged = append(d.RoutinesChanged, sig)
+		}
+	}
+	for _, sig := range sortedKeys(targetRoutines) {
+		if _, ok := sourceRoutines[sig]; !ok {
+			d.RoutinesRemoved = append(d.RoutinesRemoved, sig)
+		}
+	}
+
+	return d
+}
+
+func compareTable(st, tt introspect.Table, sourceDriver, targetDriver string) TableDiff {
+	td := TableDiff{
+		Name:               st.Name,
+		ColumnsAdded:       []introspect.Column{},
+		ColumnsRemoved:     []introspect.Column{},
+		ColumnsChanged:     []ColumnChange{},
+		IndexesAdded:       []introspect.Index{},
+		IndexesRemoved:     []introspect.Index{},
+		ConstraintsAdded:   []introspect.Constraint{},
+		ConstraintsRemoved: []introspect.Constraint{},
+	}
+	sameDialect := sourceDriver == targetDriver
+
+	for _, sc := range st.Columns {
+		tc, ok := tt.Column(sc.Name)
+		if !ok {
+			td.ColumnsAdded = append(td.ColumnsAdded, sc)
+			continue
+		}
+		changes := []string{}
+		if !sameType(sourceDriver, sc.Type, targetDriver, tc.Type) {
+			changes = append(changes, "type")
+		}
+		if sc.Nullable != tc.Nullable {
+			changes = append(changes, "nullable")
+		}
+		if sameDialect && !sc.AutoIncrement && !tc.AutoIncrement && defaultText(sc.Default) != defaultText(tc.Default) {
+			changes = append(changes, "default")
+		}
+		if sc.AutoIncrement != tc.AutoIncrement {
+			changes = append(changes, "auto_increment")
+		}
+		if len(changes) > 0 {
+			td.ColumnsChanged = append(td.ColumnsChanged, ColumnChange{Name: sc.Name, Changes: changes, Source: sc, Target: tc})
+		}
+	}
+	for _, tc := range tt.Columns {
+		if _, ok := st.Column(tc.Name); !ok {
+			td.ColumnsRemoved = append(td.ColumnsRemoved, tc)
+		}
+	}
+
+	sourceIndexes := plainIndexes(st)
+	targetIndexes := plainIndexes(tt)
+	for key, ix := range sourceIndexes {
+		if _, ok := targetIndexes[key]; !ok {
+			td.IndexesAdded = append(td.IndexesAdded, ix)
+		}
+	}
+	for key, ix := range targetIndexes {
+		if _, ok := sourceIndexes[key]; !ok {
+			td.IndexesRemoved = append(td.IndexesRemoved, ix)
+		}
+	}
+	sort.Slice(td.IndexesAdded, func(i, j int) bool { return td.IndexesAdded[i].Name < td.IndexesAdded[j].Name })
+	sort.Slice(td.IndexesRemoved, func(i, j int) bool { return td.IndexesRemoved[i].Name < td.IndexesRemoved[j].Name })
+
+	sourceConstraints := constraintsBySignature(st, sameDialect)
+	targetConstraints := constraintsBySignature(tt, sameDialect)
+	for _, key := range sortedKeys(sourceConstraints) {
+		if _, ok := targetConstraints[key]; !ok {
+			td.ConstraintsAdded = append(td.ConstraintsAdded, sourceConstraints[key])
+		}
+	}
+	for _, key := range sortedKeys(targetConstraints) {
+		if _, ok := sourceConstraints[key]; !ok {
+			td.ConstraintsRemoved = append(td.ConstraintsRemoved, targetConstraints[key])
+		}
+	}
+
+	return td
+}
+
+func sameType(sourceDriver, sourceType, targetDriver, targetType string) bool {
+	if sourceDriver == targetDriver {
+		return strings.EqualFold(strings.Join(strings.Fields(sourceType), " "), strings.Join(strings.Fields(targetType), " "))
+	}
+	return dialect.CanonicalType(sourceDriver, sourceType) == dialect.CanonicalType(targetDriver, targetType)
+}
+
+func defaultText(def *string) string {
+	if def == nil {
+		return ""
+	}
+	return strings.TrimSpace(*def)
+}
+
+// plainIndexes keys the indexes that are not implied by a constraint by
+// uniqueness and column list, so renamed-but-identical indexes compare equal
+func plainIndexes(t introspect.Table) map[string]introspect.Index {
+	constraintNames := map[string]bool{}
+	for _, c := range t.Constraints {
+		constraintNames[c.Name] = true
+	}
+
+	result := map[string]introspect.Index{}
+	for _, ix := range t.Indexes {
+		if ix.Primary || constraintNames[ix.Name] || strings.HasPrefix(ix.Name, "sqlite_autoindex_") {
+			continue
+		}
+		key := strings.Join(ix.Columns, ",")
+		if ix.Unique {
+			key = "unique:" + key
+		}
+		result[key] = ix
+	}
+	return result
+}
+
+// constraintsBySignature keys constraints by what they enforce rather than by
+// name, since generated names differ between databases. CHECK constraints are
+// only comparable within one dialect and are keyed by name.
+func constraintsBySignature(t introspect.Table, sameDialect bool) map[string]introspect.Constraint {
+	result := map[string]introspect.Constraint{}
+	for _, c := range t.Constraints {
+		var key string
+		switch c.Type {
+		case introspect.ConstraintPrimaryKey, introspect.ConstraintUnique:
+			key = c.Type + "(" + strings.Join(c.Columns, ",") + ")"
+		case introspect.ConstraintForeignKey:
+			key = c.Type + "(" + strings.Join(c.Columns, ",") + ")->" + c.RefTable + "(" + strings.Join(c.RefColumns, ",") + ")" + c.OnDelete + "/" + c.OnUpdate
+		case introspect.ConstraintCheck:
+			if !sameDialect {
+				continue
+			}
+			key = c.Type + ":" + c.Name + ":" + normalizeSQL(c.Definition)
+		}
+		result[key] = c
+	}
+	return result
+}
+
+// routinesBySignature keys routines by name and input argument types,
+// which identifies overloads across databases
+func routinesBySignature(routines []introspect.Routine) map[string]introspect.Routine {
+	result := map[string]introspect.Routine{}
+	for _, r := range routines {
+		types := []string{}
+		for _, a := range r.Arguments {
+			if a.IsInput() {
+				types = append(types, strings.ToLower(a.Type))
+			}
+		}
+		result[r.Name+"("+strings.Join(types, ", ")+")"] = r
+	}
+	return result
+}
+
+// normalizeSQL collapses whitespace and case so formatting differences don't count
+func normalizeSQL(s string) string {
+	return strings.ToLower(strings.Join(strings.Fields(strings.TrimRight(strings.TrimSpace(s), ";")), " "))
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
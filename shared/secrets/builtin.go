@@ -0,0 +1,104 @@
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/dracory/weebase/shared/glob"
+)
+
+// DefaultCommandTimeout is how long a Command may run when it sets no
+// Timeout
+const DefaultCommandTimeout = 10 * time.Second
+
+// Env resolves environment variables whose names match an Allow pattern
+// (case-insensitive, * and ?)
+type Env struct {
+	Allow []string
+}
+
+// Resolve implements Resolver
+func (e Env) Resolve(_ context.Context, name string) (string, error) {
+	if !glob.MatchAny(e.Allow, name) {
+		return "", fmt.Errorf("%w: environment variable %s", ErrNotAllowed, name)
+	}
+	value, ok := os.LookupEnv(name)
+	if !ok {
+		return "", fmt.Errorf("environment variable %s is not set", name)
+	}
+	return value, nil
+}
+
+// Files resolves the contents of files in Dirs, such as Docker or
+// Kubernetes secret mounts. A trailing newline is dropped.
+type Files struct {
+	Dirs []string
+}
+
+// Resolve implements Resolver. Symbolic links are followed before the
+// path is checked, so a link can't lead out of the directories.
+func (f Files) Resolve(_ context.Context, path string) (string, error) {
+	if !filepath.IsAbs(path) {
+		return "", fmt.Errorf("secret file %s must be an absolute path", path)
+	}
+	resolved, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return "", fmt.Errorf("secret file %s: %w", path, errors.Unwrap(err))
+	}
+	allowed := false
+	for _, dir := range f.Dirs {
+		dir, err := filepath.EvalSymlinks(dir)
+		if err != nil {
+			continue
+		}
+		if rel, err := filepath.Rel(dir, resolved); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			allowed = true
+			break
+		}
+	}
+	if !allowed {
+		return "", fmt.Errorf("%w: file %s", ErrNotAllowed, path)
+	}
+	data, err := os.ReadFile(resolved)
+	if err != nil {
+		return "", fmt.Errorf("secret file %s: %w", path, errors.Unwrap(err))
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+// Command resolves secrets with a helper program, run as Path with Args
+// and the secret's name, which prints the secret on stdout. It isn't run
+// through a shell.
+type Command struct {
+	Path    string
+	Args    []string
+	Timeout time.Duration
+}
+
+// Resolve implements Resolver
+func (c Command) Resolve(ctx context.Context, name string) (string, error) {
+	timeout := c.Timeout
+	if timeout <= 0 {
+		timeout = DefaultCommandTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, c.Path, append(append([]string{}, c.Args...), name)...)
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("secret helper failed: %v: %s", err, msg)
+		}
+		return "", fmt.Errorf("secret helper failed: %v", err)
+	}
+	return strings.TrimRight(stdout.String(), "\r\n"), nil
+}
@@ -0,0 +1,109 @@
+// Package secrets keeps database passwords out of weebase's own files,
+// cookies and session. Connection fields and DSNs reference secrets as
+// ${scheme:name}, e.g. ${env:PG_PROD_PASSWORD} or ${file:/run/secrets/pg};
+// a Resolver looks them up each time a connection is opened, so only the
+// references are ever stored. References are only resolved in the
+// server-configured connection and backup profiles: in an ad-hoc
+// connection they would let an operator send the secret to a host of
+// their choosing.
+//
+// Operators write the references themselves, so the built-in schemes only
+// reach what they are configured for: environment variables matching
+// allowed patterns, files in allowed directories, and one helper command.
+package secrets
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/dracory/weebase/shared/constants"
+	"github.com/dracory/weebase/shared/dialect"
+)
+
+// ErrNotAllowed is returned, wrapped, for references a resolver may not
+// look up
+var ErrNotAllowed = errors.New("secret not allowed")
+
+// Resolver looks up the secret a reference names. The reference is what
+// stands between ${ and }, scheme included.
+type Resolver interface {
+	Resolve(ctx context.Context, ref string) (string, error)
+}
+
+// Func adapts a lookup function, e.g. of a vault client, to a Resolver
+type Func func(ctx context.Context, ref string) (string, error)
+
+// Resolve calls f
+func (f Func) Resolve(ctx context.Context, ref string) (string, error) {
+	return f(ctx, ref)
+}
+
+// Schemes dispatches references to the resolver of their scheme, which is
+// given the reference without it. An embedding application adds its own
+// schemes next to the built-in ones.
+type Schemes map[string]Resolver
+
+// Resolve implements Resolver
+func (s Schemes) Resolve(ctx context.Context, ref string) (string, error) {
+	scheme, name, ok := strings.Cut(ref, ":")
+	if !ok {
+		return "", fmt.Errorf("secret reference %q has no scheme", ref)
+	}
+	r, ok := s[scheme]
+	if !ok {
+		return "", fmt.Errorf("unknown secret scheme %q", scheme)
+	}
+	return r.Resolve(ctx, name)
+}
+
+// placeholder matches a ${scheme:name} reference
+var placeholder = regexp.MustCompile(`\$\{([A-Za-z][A-Za-z0-9+.-]*:[^}]*)\}`)
+
+// HasReference reports whether s references a secret
+func HasReference(s string) bool {
+	return placeholder.MatchString(s)
+}
+
+// Expand replaces the secret references of a DSN of driver with their
+// values, escaped for where they appear: URL encoded in URLs, and with
+// quotes and backslashes escaped in PostgreSQL key=value strings, where
+// references should be single quoted. A DSN without references is
+// returned as is; errors name the reference, never a value.
+func Expand(ctx context.Context, r Resolver, driver, dsn string) (string, error) {
+	if !strings.Contains(dsn, "${") {
+		return dsn, nil
+	}
+	escape := func(s string) string { return s }
+	switch {
+	case strings.Contains(dsn, "://"):
+		escape = func(s string) string { return strings.ReplaceAll(url.QueryEscape(s), "+", "%20") }
+	case dialect.Normalize(driver) == constants.DriverPostgres:
+		escape = strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace
+	}
+
+	var firstErr error
+	expanded := placeholder.ReplaceAllStringFunc(dsn, func(match string) string {
+		if firstErr != nil {
+			return match
+		}
+		ref := match[2 : len(match)-1]
+		if r == nil {
+			firstErr = fmt.Errorf("cannot resolve secret %s: no secret resolver is configured", ref)
+			return match
+		}
+		value, err := r.Resolve(ctx, ref)
+		if err != nil {
+			firstErr = fmt.Errorf("cannot resolve secret %s: %w", ref, err)
+			return match
+		}
+		return escape(value)
+	})
+	if firstErr != nil {
+		return "", firstErr
+	}
+	return expanded, nil
+}
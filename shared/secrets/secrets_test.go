@@ -0,0 +1,90 @@
+package secrets
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestExpand(t *testing.T) {
+	r := Schemes{"vault": Func(func(_ context.Context, name string) (string, error) {
+		if name == "pg/prod" {
+			return `p@ss w'rd`, nil
+		}
+		return "", errors.New("no such secret")
+	})}
+
+	tests := []struct{ driver, dsn, want string }{
+		{"postgres", "host=db user=app password='${vault:pg/prod}' dbname=x", `host=db user=app password='p@ss w\'rd' dbname=x`},
+		{"postgres", "postgres://app:${vault:pg/prod}@db/x", "postgres://app:p%40ss%20w%27rd@db/x"},
+		{"mysql", "app:${vault:pg/prod}@tcp(db)/x", "app:p@ss w'rd@tcp(db)/x"},
+		{"sqlserver", "sqlserver://app:${vault:pg/prod}@db?database=x", "sqlserver://app:p%40ss%20w%27rd@db?database=x"},
+		{"sqlite", "/data/app.db", "/data/app.db"},
+	}
+	for _, tt := range tests {
+		got, err := Expand(t.Context(), r, tt.driver, tt.dsn)
+		if err != nil || got != tt.want {
+			t.Errorf("Expand(%q) = %q, %v; want %q", tt.dsn, got, err, tt.want)
+		}
+	}
+
+	if _, err := Expand(t.Context(), r, "mysql", "app:${vault:other}@tcp(db)/x"); err == nil || !strings.Contains(err.Error(), "vault:other") {
+		t.Errorf("expected an error naming the reference, got %v", err)
+	}
+	if _, err := Expand(t.Context(), r, "mysql", "app:${env:HOME}@tcp(db)/x"); err == nil {
+		t.Error("expected an unknown scheme to fail")
+	}
+	if _, err := Expand(t.Context(), nil, "mysql", "app:${env:HOME}@tcp(db)/x"); err == nil {
+		t.Error("expected references to fail without a resolver")
+	}
+}
+
+func TestEnv(t *testing.T) {
+	t.Setenv("PG_PROD_PASSWORD", "s3cret")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "nope")
+	e := Env{Allow: []string{"PG_*"}}
+
+	if got, err := e.Resolve(t.Context(), "PG_PROD_PASSWORD"); err != nil || got != "s3cret" {
+		t.Errorf("Resolve = %q, %v", got, err)
+	}
+	if _, err := e.Resolve(t.Context(), "AWS_SECRET_ACCESS_KEY"); !errors.Is(err, ErrNotAllowed) {
+		t.Errorf("expected ErrNotAllowed, got %v", err)
+	}
+	if _, err := e.Resolve(t.Context(), "PG_UNSET"); err == nil {
+		t.Error("expected an unset variable to fail")
+	}
+}
+
+func TestFiles(t *testing.T) {
+	dir, outside := t.TempDir(), t.TempDir()
+	os.WriteFile(filepath.Join(dir, "pg"), []byte("s3cret\n"), 0o600)
+	os.WriteFile(filepath.Join(outside, "key"), []byte("nope"), 0o600)
+	os.Symlink(filepath.Join(outside, "key"), filepath.Join(dir, "escape"))
+	f := Files{Dirs: []string{dir}}
+
+	if got, err := f.Resolve(t.Context(), filepath.Join(dir, "pg")); err != nil || got != "s3cret" {
+		t.Errorf("Resolve = %q, %v", got, err)
+	}
+	for _, path := range []string{filepath.Join(outside, "key"), filepath.Join(dir, "escape"), filepath.Join(dir, "..", filepath.Base(outside), "key")} {
+		if _, err := f.Resolve(t.Context(), path); !errors.Is(err, ErrNotAllowed) {
+			t.Errorf("%s: expected ErrNotAllowed, got %v", path, err)
+		}
+	}
+	if _, err := f.Resolve(t.Context(), "pg"); err == nil {
+		t.Error("expected a relative path to fail")
+	}
+}
+
+func TestCommand(t *testing.T) {
+	c := Command{Path: "sh", Args: []string{"-c", `[ "$0" = pg/prod ] && echo s3cret || { echo "unknown $0" >&2; exit 1; }`}}
+
+	if got, err := c.Resolve(t.Context(), "pg/prod"); err != nil || got != "s3cret" {
+		t.Errorf("Resolve = %q, %v", got, err)
+	}
+	if _, err := c.Resolve(t.Context(), "other"); err == nil || !strings.Contains(err.Error(), "unknown other") {
+		t.Errorf("expected the helper's error, got %v", err)
+	}
+}
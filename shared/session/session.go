@@ -1,9 +1,11 @@
 package session
 
 import (
+	"context"
 	"crypto/rand"
 	"crypto/sha256"
 	"encoding/hex"
+	"log/slog"
 	"net/http"
 	"time"
 )
@@ -21,6 +23,8 @@ type Session struct {
 	CreatedAt time.Time `json:"created_at"`
 	Conn      *ActiveConnection `json:"conn,omitempty"`
 	CSRFToken string    `json:"csrf_token,omitempty"`
+	// User is the operator identified by the configured authenticator
+	User string `json:"user,omitempty"`
 }
 
 // ActiveConnection holds the per-session active DB connection.
@@ -29,6 +33,42 @@ type ActiveConnection struct {
 	Driver   string    `json:"driver"`
 	DSN      string    `json:"dsn"`
 	LastUsed time.Time `json:"last_used"`
+	// ProfileID names the server-side profile the connection was opened
+	// from. Only the ID is kept in the cookie; Driver and DSN are resolved
+	// again by the request's ProfileResolver each time the session is read.
+	ProfileID string `json:"profile_id,omitempty"`
+}
+
+// ProfileResolver resolves a server-side connection profile to its driver
+// and DSN, secrets included
+type ProfileResolver func(ctx context.Context, profileID string) (driver, dsn string, err error)
+
+type profileResolverKey struct{}
+
+// WithProfileResolver returns a copy of ctx carrying the resolver of
+// server-side connection profiles
+func WithProfileResolver(ctx context.Context, resolve ProfileResolver) context.Context {
+	return context.WithValue(ctx, profileResolverKey{}, resolve)
+}
+
+// resolveProfile fills in the driver and DSN of a profile connection. A
+// profile that can't be resolved leaves the session without a connection.
+func resolveProfile(r *http.Request, session *Session) {
+	if session.Conn == nil || session.Conn.ProfileID == "" {
+		return
+	}
+	resolve, _ := r.Context().Value(profileResolverKey{}).(ProfileResolver)
+	if resolve == nil {
+		session.Conn = nil
+		return
+	}
+	drv, dsn, err := resolve(r.Context(), session.Conn.ProfileID)
+	if err != nil {
+		slog.Error("failed to open connection profile", slog.String("profile", session.Conn.ProfileID), slog.String("error", err.Error()))
+		session.Conn = nil
+		return
+	}
+	session.Conn.Driver, session.Conn.DSN = drv, dsn
 }
 
 // NewRandomID generates a new random ID
@@ -53,6 +93,21 @@ func DecodeSessionData(encodedData string, key []byte) (map[string]interface{},
 	return decodeSessionData(encodedData, key)
 }
 
+// ID returns the ID of the request's session, "" when it has none. Unlike
+// EnsureSession it never starts one.
+func ID(r *http.Request, secret string) string {
+	c, err := r.Cookie(SessionCookieName)
+	if err != nil || c.Value == "" {
+		return ""
+	}
+	data, err := decodeSessionData(c.Value, getSessionKey(secret))
+	if err != nil {
+		return ""
+	}
+	id, _ := data["id"].(string)
+	return id
+}
+
 // EnsureSession returns the existing session from cookie or creates a new one.
 func EnsureSession(w http.ResponseWriter, r *http.Request, secret string) *Session {
 	key := getSessionKey(secret)
@@ -72,6 +127,10 @@ func EnsureSession(w http.ResponseWriter, r *http.Request, secret string) *Sessi
 					DSN:      connData["dsn"].(string),
 					LastUsed: time.Unix(int64(connData["last_used"].(float64)), 0),
 				}
+				if profileID, ok := connData["profile_id"].(string); ok {
+					session.Conn.ProfileID = profileID
+					resolveProfile(r, session)
+				}
 			}
 
 			// Load CSRF token if it exists
@@ -79,6 +138,10 @@ func EnsureSession(w http.ResponseWriter, r *http.Request, secret string) *Sessi
 				session.CSRFToken = csrfToken
 			}
 
+			if user, ok := data["user"].(string); ok {
+				session.User = user
+			}
+
 			return session
 		}
 	}
@@ -97,37 +160,55 @@ func EnsureSession(w http.ResponseWriter, r *http.Request, secret string) *Sessi
 
 // saveSessionToCookie saves the session data to an encrypted cookie
 func saveSessionToCookie(w http.ResponseWriter, r *http.Request, session *Session, key []byte) {
+	if cookie := sessionCookie(r, session, key); cookie != nil {
+		http.SetCookie(w, cookie)
+	}
+}
+
+// sessionCookie encodes the session into its cookie, or returns nil when
+// it can't be encoded or is too large
+func sessionCookie(r *http.Request, session *Session, key []byte) *http.Cookie {
 	sessionData := map[string]interface{}{
 		"id":         session.ID,
 		"created_at": session.CreatedAt.Unix(),
 	}
 
 	if session.Conn != nil {
-		sessionData["conn"] = map[string]interface{}{
+		conn := map[string]interface{}{
 			"id":        session.Conn.ID,
 			"driver":    session.Conn.Driver,
 			"dsn":       session.Conn.DSN,
 			"last_used": session.Conn.LastUsed.Unix(),
 		}
+		// a profile's DSN may hold resolved secrets, so only its ID is kept
+		if session.Conn.ProfileID != "" {
+			conn["driver"], conn["dsn"] = "", ""
+			conn["profile_id"] = session.Conn.ProfileID
+		}
+		sessionData["conn"] = conn
 	}
 
 	if session.CSRFToken != "" {
 		sessionData["csrf_token"] = session.CSRFToken
 	}
 
+	if session.User != "" {
+		sessionData["user"] = session.User
+	}
+
 	encoded, err := encodeSessionData(sessionData, key)
 	if err != nil {
 		// Log error but continue with empty session
-		return
+		return nil
 	}
 
 	// Ensure the cookie isn't too large
 	if len(encoded) > MaxCookieSize {
 		// Handle error: session too large
-		return
+		return nil
 	}
 
-	http.SetCookie(w, &http.Cookie{
+	return &http.Cookie{
 		Name:     SessionCookieName,
 		Value:    encoded,
 		Path:     "/",
@@ -135,7 +216,7 @@ func saveSessionToCookie(w http.ResponseWriter, r *http.Request, session *Sessio
 		Secure:   r.TLS != nil,
 		SameSite: http.SameSiteLaxMode,
 		MaxAge:   30 * 24 * 60 * 60, // 30 days
-	})
+	}
 }
 
 // SaveSession saves the session to the response cookie
@@ -143,6 +224,43 @@ func SaveSession(w http.ResponseWriter, r *http.Request, session *Session, secre
 	saveSessionToCookie(w, r, session, getSessionKey(secret))
 }
 
+// SaveSessionForRequest saves the session like SaveSession and returns a copy
+// of r carrying the new cookie, so handlers further down the chain read the
+// saved session rather than the one the client sent
+func SaveSessionForRequest(w http.ResponseWriter, r *http.Request, session *Session, secret string) *http.Request {
+	cookie := sessionCookie(r, session, getSessionKey(secret))
+	if cookie == nil {
+		return r
+	}
+	http.SetCookie(w, cookie)
+	return withCookie(r, cookie)
+}
+
+// ForRequest returns a copy of r carrying the session in place of the one
+// the client sent, without sending it back: the session lasts for the
+// request only, as for requests authenticated with an API token. A session
+// that can't be encoded leaves the request with none.
+func ForRequest(r *http.Request, session *Session, secret string) *http.Request {
+	return withCookie(r, sessionCookie(r, session, getSessionKey(secret)))
+}
+
+// withCookie returns a copy of r whose session cookie is replaced, or
+// removed when cookie is nil
+func withCookie(r *http.Request, cookie *http.Cookie) *http.Request {
+	r = r.Clone(r.Context())
+	cookies := r.Cookies()
+	r.Header.Del("Cookie")
+	for _, c := range cookies {
+		if c.Name != SessionCookieName {
+			r.AddCookie(c)
+		}
+	}
+	if cookie != nil {
+		r.AddCookie(&http.Cookie{Name: SessionCookieName, Value: cookie.Value})
+	}
+	return r
+}
+
 // DeleteSession removes the session cookie
 func DeleteSession(w http.ResponseWriter, r *http.Request) {
 	http.SetCookie(w, &http.Cookie{
@@ -0,0 +1,126 @@
+// Package sqlguard classifies SQL statements for safe mode and read-only checks.
+package sqlguard
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+
+	"github.com/dracory/weebase/shared/constants"
+	"github.com/dracory/weebase/shared/dialect"
+	"github.com/dracory/weebase/shared/sqlsplit"
+)
+
+// ErrNotReadOnly is returned by SingleReadOnly for anything but exactly one
+// read-only statement
+var ErrNotReadOnly = errors.New("only a single read-only statement is allowed")
+
+// normalize lower-cases the statement and strips leading whitespace and comments
+func normalize(query string) string {
+	q := strings.TrimSpace(query)
+	for {
+		switch {
+		case strings.HasPrefix(q, "--"):
+			if i := strings.IndexByte(q, '\n'); i >= 0 {
+				q = strings.TrimSpace(q[i+1:])
+				continue
+			}
+			return ""
+		case strings.HasPrefix(q, "/*") && !strings.HasPrefix(q, "/*!"):
+			if i := strings.Index(q, "*/"); i >= 0 {
+				q = strings.TrimSpace(q[i+2:])
+				continue
+			}
+			return ""
+		}
+		return strings.ToLower(q)
+	}
+}
+
+// IsReadOnly reports whether the statement only reads data
+func IsReadOnly(query string) bool {
+	q := normalize(query)
+	for _, prefix := range []string{"select", "show", "explain", "with", "values", "describe", "desc ", "pragma table_info"} {
+		if strings.HasPrefix(q, prefix) {
+			// a CTE may wrap a data-modifying statement
+			if prefix == "with" && containsWord(q, "insert", "update", "delete", "merge") {
+				return false
+			}
+			return true
+		}
+	}
+	return false
+}
+
+// IsDestructive reports whether the statement changes data or structure
+func IsDestructive(query string) bool {
+	q := normalize(query)
+	for _, prefix := range []string{"drop ", "alter ", "truncate ", "delete ", "update ", "insert ", "replace ", "merge ", "rename ", "grant ", "revoke "} {
+		if strings.HasPrefix(q, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// SingleReadOnly returns the one statement of query, without its trailing
+// delimiter, when it is read-only. The SQLite and SQL Server drivers run
+// every statement of a text, so checking how the text starts isn't enough.
+// Quotes are read the way drv reads them: only MySQL escapes with '\'.
+func SingleReadOnly(drv, query string) (string, error) {
+	sc := sqlsplit.NewScanner(strings.NewReader(query))
+	sc.BackslashEscapes = dialect.Normalize(drv) == constants.DriverMySQL
+	stmts := []string{}
+	for sc.Scan() {
+		stmts = append(stmts, sc.Statement().SQL)
+	}
+	if len(stmts) != 1 || !IsReadOnly(stmts[0]) {
+		return "", ErrNotReadOnly
+	}
+	return stmts[0], nil
+}
+
+// QueryReadOnly runs a query checked by SingleReadOnly, inside a read-only
+// transaction on PostgreSQL and MySQL, which have one. The other drivers
+// refuse or ignore the option. done closes the rows and ends the
+// transaction; it must be called once the rows are read.
+func QueryReadOnly(ctx context.Context, db *sql.DB, drv, query string, args ...any) (rows *sql.Rows, done func(), err error) {
+	switch dialect.Normalize(drv) {
+	case constants.DriverPostgres, constants.DriverMySQL:
+	default:
+		rows, err := db.QueryContext(ctx, query, args...)
+		if err != nil {
+			return nil, nil, err
+		}
+		return rows, func() { rows.Close() }, nil
+	}
+
+	tx, err := db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return nil, nil, err
+	}
+	rows, err = tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		tx.Rollback()
+		return nil, nil, err
+	}
+	return rows, func() {
+		rows.Close()
+		tx.Rollback()
+	}, nil
+}
+
+func containsWord(q string, words ...string) bool {
+	fields := strings.FieldsFunc(q, func(r rune) bool {
+		return !(r == '_' || r >= 'a' && r <= 'z' || r >= '0' && r <= '9')
+	})
+	for _, f := range fields {
+		for _, w := range words {
+			if f == w {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,71 @@
+package sqlguard
+
+import "testing"
+
+func TestClassification(t *testing.T) {
+	cases := []struct {
+		query       string
+		readOnly    bool
+		destructive bool
+	}{
+		{"SELECT 1", true, false},
+		{"  show tables", true, false},
+		{"EXPLAIN SELECT * FROM users", true, false},
+		{"WITH t AS (SELECT 1) SELECT * FROM t", true, false},
+		{"WITH gone AS (DELETE FROM users RETURNING *) SELECT * FROM gone", false, false},
+		{"with t as (select 1) insert into users select * from t", false, false},
+		{"VALUES (1)", true, false},
+		{"DESCRIBE users", true, false},
+		{"desc users", true, false},
+		{"PRAGMA table_info(users)", true, false},
+		{"PRAGMA journal_mode = DELETE", false, false},
+		{"-- note\nSELECT 1", true, false},
+		{"/* note */ DELETE FROM users", false, true},
+		{"DROP TABLE users", false, true},
+		{"TRUNCATE users", false, true},
+		{"UPDATE users SET a = 1", false, true},
+		{"REPLACE INTO users VALUES (1)", false, true},
+		{"MERGE INTO users USING src ON 1 = 1", false, true},
+		{"RENAME TABLE a TO b", false, true},
+		{"GRANT SELECT ON users TO bob", false, true},
+		{"REVOKE SELECT ON users FROM bob", false, true},
+		{"CREATE TABLE t (id int)", false, false},
+	}
+	for _, c := range cases {
+		if got := IsReadOnly(c.query); got != c.readOnly {
+			t.Errorf("IsReadOnly(%q) = %v, want %v", c.query, got, c.readOnly)
+		}
+		if got := IsDestructive(c.query); got != c.destructive {
+			t.Errorf("IsDestructive(%q) = %v, want %v", c.query, got, c.destructive)
+		}
+	}
+}
+
+func TestSingleReadOnly(t *testing.T) {
+	cases := []struct {
+		driver, query string
+		want          string
+		ok            bool
+	}{
+		{"sqlite", "SELECT 1", "SELECT 1", true},
+		{"sqlite", "  SELECT 1;\n", "SELECT 1", true},
+		{"sqlite", "-- note\nSELECT ';' FROM t;", "SELECT ';' FROM t", true},
+		{"sqlite", "SELECT 1; DELETE FROM u", "", false},
+		{"sqlite", "SELECT 1;; SELECT 2", "", false},
+		{"sqlite", "DELETE FROM u", "", false},
+		{"sqlite", "", "", false},
+		// a backslash doesn't escape the quote outside MySQL
+		{"postgres", `SELECT 'a\'; DELETE FROM u; --'`, "", false},
+		{"sqlserver", `SELECT 'a\'; DROP TABLE u; --'`, "", false},
+		{"mysql", `SELECT 'a\'; b'`, `SELECT 'a\'; b'`, true},
+	}
+	for _, c := range cases {
+		got, err := SingleReadOnly(c.driver, c.query)
+		if c.ok && (err != nil || got != c.want) {
+			t.Errorf("SingleReadOnly(%s, %q) = %q, %v, want %q", c.driver, c.query, got, err, c.want)
+		}
+		if !c.ok && err != ErrNotReadOnly {
+			t.Errorf("SingleReadOnly(%s, %q) = %q, %v, want ErrNotReadOnly", c.driver, c.query, got, err)
+		}
+	}
+}
@@ -0,0 +1,182 @@
+// Package sqlscript runs SQL scripts, such as dumps made by other tools,
+// statement by statement. Scripts are streamed from their reader, gzip
+// compressed or not, so files of any size run in constant memory.
+package sqlscript
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"time"
+	"unicode/utf8"
+
+	"github.com/dracory/weebase/shared/constants"
+	"github.com/dracory/weebase/shared/dialect"
+	"github.com/dracory/weebase/shared/sqlguard"
+	"github.com/dracory/weebase/shared/sqlsplit"
+)
+
+// DefaultMaxErrors caps the statement errors collected in a Summary
+const DefaultMaxErrors = 100
+
+// maxStatementText is how much of a failed statement is kept in its error
+const maxStatementText = 200
+
+// Options controls a script run
+type Options struct {
+	Driver string
+	// ContinueOnError runs the remaining statements after one fails;
+	// otherwise the run stops at the first failure
+	ContinueOnError bool
+	// ReadOnly rejects every statement that isn't read-only
+	ReadOnly bool
+	// SafeMode rejects destructive statements (DROP, DELETE, INSERT, ...)
+	SafeMode bool
+	// MaxErrors limits the errors kept in the Summary; the count goes on
+	MaxErrors int
+	// Progress, when set, is called after every statement
+	Progress func(Summary)
+	// Executing, when set, is called with every statement before it runs
+	Executing func(sql string)
+}
+
+// StatementError describes a statement that failed or was rejected
+type StatementError struct {
+	// Line is the 1-based line the statement starts on
+	Line      int    `json:"line"`
+	Statement string `json:"statement"`
+	Message   string `json:"message"`
+}
+
+// Summary reports how far a script got
+type Summary struct {
+	Executed     int64            `json:"executed"`
+	Failed       int64            `json:"failed"`
+	RowsAffected int64            `json:"rows_affected"`
+	Errors       []StatementError `json:"errors"`
+	// BytesRead counts the input as read, before decompression
+	BytesRead int64 `json:"bytes_read"`
+	// Stopped is set when the run ended at a failed statement
+	Stopped bool  `json:"stopped"`
+	Elapsed int64 `json:"elapsed_ms"`
+}
+
+// Run executes the statements of r on a single connection, so settings and
+// temporary tables made by one statement are seen by the next. The error is
+// only set when the script could not be read or the run was cancelled;
+// failed statements are reported in the Summary.
+func Run(ctx context.Context, db *sql.DB, r io.Reader, opts Options) (Summary, error) {
+	started := time.Now()
+	summary := Summary{Errors: []StatementError{}}
+	if opts.MaxErrors <= 0 {
+		opts.MaxErrors = DefaultMaxErrors
+	}
+	drv := dialect.Normalize(opts.Driver)
+
+	counter := &countingReader{r: r}
+	input, err := decompress(counter)
+	if err != nil {
+		return summary, err
+	}
+
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return summary, fmt.Errorf("failed to connect to database: %v", err)
+	}
+	defer conn.Close()
+
+	scanner := sqlsplit.NewScanner(input)
+	// only MySQL treats backslashes in strings as escapes
+	scanner.BackslashEscapes = drv == constants.DriverMySQL
+
+	report := func() {
+		summary.BytesRead = counter.n
+		summary.Elapsed = time.Since(started).Milliseconds()
+		if opts.Progress != nil {
+			opts.Progress(summary)
+		}
+	}
+	defer report()
+
+	for scanner.Scan() {
+		if err := ctx.Err(); err != nil {
+			return summary, err
+		}
+		stmt := scanner.Statement()
+
+		message := ""
+		switch {
+		case opts.ReadOnly && !sqlguard.IsReadOnly(stmt.SQL):
+			message = "write operations are not allowed in read-only mode"
+		case opts.SafeMode && sqlguard.IsDestructive(stmt.SQL):
+			message = "confirmation required for destructive operation"
+		default:
+			if opts.Executing != nil {
+				opts.Executing(stmt.SQL)
+			}
+			res, err := conn.ExecContext(ctx, stmt.SQL)
+			if ctx.Err() != nil {
+				return summary, ctx.Err()
+			}
+			if err != nil {
+				message = err.Error()
+			} else if n, err := res.RowsAffected(); err == nil && n > 0 {
+				summary.RowsAffected += n
+			}
+		}
+
+		if message == "" {
+			summary.Executed++
+			report()
+			continue
+		}
+		summary.Failed++
+		if len(summary.Errors) < opts.MaxErrors {
+			summary.Errors = append(summary.Errors, StatementError{Line: stmt.Line, Statement: abbreviate(stmt.SQL), Message: message})
+		}
+		if !opts.ContinueOnError {
+			summary.Stopped = true
+			return summary, nil
+		}
+		report()
+	}
+	if err := scanner.Err(); err != nil {
+		return summary, fmt.Errorf("failed to read script: %v", err)
+	}
+	return summary, nil
+}
+
+// decompress transparently unpacks gzip input, recognised by its magic number
+func decompress(r io.Reader) (io.Reader, error) {
+	br := bufio.NewReader(r)
+	if magic, err := br.Peek(2); err == nil && bytes.Equal(magic, []byte{0x1f, 0x8b}) {
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, fmt.Errorf("invalid gzip data: %v", err)
+		}
+		return zr, nil
+	}
+	return br, nil
+}
+
+func abbreviate(stmt string) string {
+	if utf8.RuneCountInString(stmt) <= maxStatementText {
+		return stmt
+	}
+	return string([]rune(stmt)[:maxStatementText]) + "..."
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
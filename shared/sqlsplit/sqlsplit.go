@@ -0,0 +1,302 @@
+// Package sqlsplit splits SQL scripts into individual statements without
+// loading the whole script into memory. It understands quoted strings and
+// identifiers, line and block comments, PostgreSQL dollar quoting, the MySQL
+// client's DELIMITER directive and SQL Server's GO batch separator.
+package sqlsplit
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"strings"
+	"unicode"
+)
+
+// maxDirectiveLine bounds how far ahead a line is inspected for a directive
+const maxDirectiveLine = 256
+
+// Statement is a single statement together with its position in the script
+type Statement struct {
+	SQL string
+	// Line is the 1-based line on which the statement starts
+	Line int
+	// Offset is the byte offset just past the statement, usable for
+	// progress reporting and for resuming after a failure
+	Offset int64
+}
+
+// Scanner reads statements one at a time from a reader
+type Scanner struct {
+	// BackslashEscapes treats '\' as an escape inside single-quoted strings
+	// (MySQL). Disable it for dialects with standard strings.
+	BackslashEscapes bool
+
+	r         *bufio.Reader
+	delimiter string
+	line      int
+	offset    int64
+	stmt      Statement
+	err       error
+}
+
+// NewScanner creates a Scanner reading from r
+func NewScanner(r io.Reader) *Scanner {
+	return &Scanner{BackslashEscapes: true, r: bufio.NewReaderSize(r, 64*1024), delimiter: ";", line: 1}
+}
+
+// Statement returns the statement read by the last successful call to Scan
+func (s *Scanner) Statement() Statement {
+	return s.stmt
+}
+
+// Err returns the first non-EOF read error
+func (s *Scanner) Err() error {
+	return s.err
+}
+
+// Offset returns the number of bytes consumed so far
+func (s *Scanner) Offset() int64 {
+	return s.offset
+}
+
+// Scan advances to the next non-empty statement and reports whether one was found
+func (s *Scanner) Scan() bool {
+	var sb strings.Builder
+	startLine := 0
+	atLineStart := s.offset == 0
+
+	emit := func() bool {
+		text := strings.TrimSpace(sb.String())
+		sb.Reset()
+		if text == "" {
+			startLine = 0
+			return false
+		}
+		s.stmt = Statement{SQL: text, Line: startLine, Offset: s.offset}
+		return true
+	}
+
+	for {
+		if atLineStart {
+			if directive, ok := s.lineDirective(); ok {
+				if strings.HasPrefix(directive, "DELIMITER ") {
+					s.delimiter = strings.TrimSpace(directive[len("DELIMITER "):])
+				}
+				if emit() {
+					return true
+				}
+				continue
+			}
+		}
+
+		ch, ok := s.read()
+		if !ok {
+			return emit()
+		}
+		atLineStart = ch == '\n'
+		if startLine == 0 && !unicode.IsSpace(ch) {
+			startLine = s.line
+		}
+
+		switch ch {
+		case '\'', '"', '`':
+			sb.WriteRune(ch)
+			s.copyQuoted(&sb, ch)
+			continue
+		case '[':
+			sb.WriteRune(ch)
+			s.copyQuoted(&sb, ']')
+			continue
+		case '-':
+			if next, ok := s.peek(); ok && next == '-' {
+				s.skipLineComment()
+				if strings.TrimSpace(sb.String()) == "" {
+					startLine = 0
+				} else {
+					sb.WriteRune('\n')
+				}
+				atLineStart = true
+				continue
+			}
+		case '/':
+			if next, ok := s.peek(); ok && next == '*' {
+				sb.WriteRune(ch)
+				s.copyBlockComment(&sb)
+				continue
+			}
+		case '$':
+			sb.WriteRune(ch)
+			s.copyDollarQuoted(&sb)
+			continue
+		}
+
+		sb.WriteRune(ch)
+		if strings.HasSuffix(sb.String(), s.delimiter) {
+			text := sb.String()
+			sb.Reset()
+			sb.WriteString(text[:len(text)-len(s.delimiter)])
+			if emit() {
+				return true
+			}
+		}
+	}
+}
+
+func (s *Scanner) read() (rune, bool) {
+	ch, size, err := s.r.ReadRune()
+	if err != nil {
+		if err != io.EOF {
+			s.err = err
+		}
+		return 0, false
+	}
+	s.offset += int64(size)
+	if ch == '\n' {
+		s.line++
+	}
+	return ch, true
+}
+
+func (s *Scanner) peek() (rune, bool) {
+	ch, _, err := s.r.ReadRune()
+	if err != nil {
+		return 0, false
+	}
+	_ = s.r.UnreadRune()
+	return ch, true
+}
+
+// lineDirective consumes the upcoming line when it is "GO" or
+// "DELIMITER x" and returns the directive in upper-cased keyword form
+func (s *Scanner) lineDirective() (string, bool) {
+	buf, _ := s.r.Peek(maxDirectiveLine)
+	end := bytes.IndexByte(buf, '\n')
+	if end < 0 {
+		if len(buf) == maxDirectiveLine {
+			return "", false
+		}
+		end = len(buf)
+	}
+
+	line := strings.TrimSpace(string(buf[:end]))
+	fields := strings.Fields(line)
+	var directive string
+	switch {
+	case len(fields) == 1 && strings.EqualFold(fields[0], "GO"):
+		directive = "GO"
+	case len(fields) == 2 && strings.EqualFold(fields[0], "DELIMITER"):
+		directive = "DELIMITER " + fields[1]
+	default:
+		return "", false
+	}
+
+	consumed := end
+	if end < len(buf) {
+		consumed++
+		s.line++
+	}
+	n, _ := s.r.Discard(consumed)
+	s.offset += int64(n)
+	return directive, true
+}
+
+// copyQuoted copies up to and including the closing quote. A doubled closing
+// quote is an escaped quote; backslash escapes are honoured in single quotes.
+func (s *Scanner) copyQuoted(sb *strings.Builder, closing rune) {
+	for {
+		ch, ok := s.read()
+		if !ok {
+			return
+		}
+		sb.WriteRune(ch)
+		if ch == '\\' && closing == '\'' && s.BackslashEscapes {
+			if next, ok := s.read(); ok {
+				sb.WriteRune(next)
+			}
+			continue
+		}
+		if ch == closing {
+			if next, ok := s.peek(); ok && next == closing {
+				s.read()
+				sb.WriteRune(next)
+				continue
+			}
+			return
+		}
+	}
+}
+
+// skipLineComment drops a "--" comment up to and including the newline
+func (s *Scanner) skipLineComment() {
+	for {
+		ch, ok := s.read()
+		if !ok || ch == '\n' {
+			return
+		}
+	}
+}
+
+// copyBlockComment keeps block comments, since MySQL uses /*! ... */ for
+// version-conditional statements. The opening '/' is already written.
+func (s *Scanner) copyBlockComment(sb *strings.Builder) {
+	s.read()
+	sb.WriteRune('*')
+	prev := rune(0)
+	for {
+		ch, ok := s.read()
+		if !ok {
+			return
+		}
+		sb.WriteRune(ch)
+		if prev == '*' && ch == '/' {
+			return
+		}
+		prev = ch
+	}
+}
+
+// copyDollarQuoted handles PostgreSQL $tag$ ... $tag$ strings. Anything else
+// starting with '$' (e.g. a $1 placeholder) is left for the caller.
+func (s *Scanner) copyDollarQuoted(sb *strings.Builder) {
+	buf, _ := s.r.Peek(64)
+	end := -1
+	for i, b := range buf {
+		if b == '$' {
+			end = i
+			break
+		}
+		if !(b == '_' || b >= 'a' && b <= 'z' || b >= 'A' && b <= 'Z' || i > 0 && b >= '0' && b <= '9') {
+			return
+		}
+	}
+	if end < 0 {
+		return
+	}
+
+	closing := "$" + string(buf[:end]) + "$"
+	for i := 0; i <= end; i++ {
+		ch, _ := s.read()
+		sb.WriteRune(ch)
+	}
+
+	for {
+		ch, ok := s.read()
+		if !ok {
+			return
+		}
+		sb.WriteRune(ch)
+		if ch == '$' && strings.HasSuffix(sb.String(), closing) {
+			return
+		}
+	}
+}
+
+// Split splits a script held in memory into statements
+func Split(script string) []string {
+	sc := NewScanner(strings.NewReader(script))
+	stmts := []string{}
+	for sc.Scan() {
+		stmts = append(stmts, sc.Statement().SQL)
+	}
+	return stmts
+}
@@ -0,0 +1,90 @@
+package sqlsplit_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/dracory/weebase/shared/sqlsplit"
+)
+
+func TestSplit(t *testing.T) {
+	tests := []struct {
+		name   string
+		script string
+		want   []string
+	}{
+		{
+			name:   "quoted delimiters",
+			script: "INSERT INTO a VALUES ('x;y', \"c;d\", `e;f`);\nSELECT [g;h] FROM t",
+			want:   []string{"INSERT INTO a VALUES ('x;y', \"c;d\", `e;f`)", "SELECT [g;h] FROM t"},
+		},
+		{
+			name:   "comments",
+			script: "-- header; with semicolon\nSELECT 1; /* keep; */ SELECT 2;\n-- trailing",
+			want:   []string{"SELECT 1", "/* keep; */ SELECT 2"},
+		},
+		{
+			name:   "dollar quoting",
+			script: "CREATE FUNCTION f() RETURNS int AS $body$ BEGIN RETURN 1; END; $body$ LANGUAGE plpgsql; SELECT $1;",
+			want:   []string{"CREATE FUNCTION f() RETURNS int AS $body$ BEGIN RETURN 1; END; $body$ LANGUAGE plpgsql", "SELECT $1"},
+		},
+		{
+			name:   "mysql delimiter",
+			script: "DELIMITER //\nCREATE PROCEDURE p() BEGIN SELECT 1; END//\nDELIMITER ;\nSELECT 2;",
+			want:   []string{"CREATE PROCEDURE p() BEGIN SELECT 1; END", "SELECT 2"},
+		},
+		{
+			name:   "go batches",
+			script: "SELECT 1\nGO\nSELECT 2\ngo\n",
+			want:   []string{"SELECT 1", "SELECT 2"},
+		},
+		{
+			name:   "escaped quotes",
+			script: `SELECT 'it''s; fine', 'back\'slash;'; SELECT 3`,
+			want:   []string{`SELECT 'it''s; fine', 'back\'slash;'`, "SELECT 3"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sqlsplit.Split(tt.script); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Split() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScanner_Positions(t *testing.T) {
+	script := "\nSELECT 1;\n-- note\nSELECT\n  2;"
+	sc := sqlsplit.NewScanner(strings.NewReader(script))
+
+	var lines []int
+	var last sqlsplit.Statement
+	for sc.Scan() {
+		last = sc.Statement()
+		lines = append(lines, last.Line)
+	}
+	if err := sc.Err(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(lines, []int{2, 4}) {
+		t.Errorf("expected statements on lines [2 4], got %v", lines)
+	}
+	if last.Offset != int64(len(script)) {
+		t.Errorf("expected final offset %d, got %d", len(script), last.Offset)
+	}
+}
+
+func TestScanner_StandardStrings(t *testing.T) {
+	sc := sqlsplit.NewScanner(strings.NewReader(`SELECT 'C:\'; SELECT 2;`))
+	sc.BackslashEscapes = false
+
+	var got []string
+	for sc.Scan() {
+		got = append(got, sc.Statement().SQL)
+	}
+	if want := []string{`SELECT 'C:\'`, "SELECT 2"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,517 @@
+// Package tablecopy copies a table, or the result of a query, from one
+// connection to another. A missing target table is created with its column
+// types translated between dialects; rows go in with COPY on PostgreSQL and
+// batched multi-row INSERTs elsewhere, all inside one target transaction.
+package tablecopy
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/dracory/weebase/shared/constants"
+	"github.com/dracory/weebase/shared/dataimport"
+	"github.com/dracory/weebase/shared/ddl"
+	"github.com/dracory/weebase/shared/dialect"
+	"github.com/dracory/weebase/shared/dump"
+	"github.com/dracory/weebase/shared/export"
+	"github.com/dracory/weebase/shared/introspect"
+	"github.com/dracory/weebase/shared/sqlguard"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/stdlib"
+)
+
+// Copy modes
+const (
+	// ModeAppend adds the rows to whatever the target holds
+	ModeAppend = "append"
+	// ModeTruncate empties the target first
+	ModeTruncate = "truncate"
+)
+
+// Copy methods as reported in Result.Method
+const (
+	MethodCopy   = "copy"
+	MethodInsert = "insert"
+)
+
+// DefaultBatchSize is the number of rows per INSERT when none is given
+const DefaultBatchSize = 500
+
+// progressEvery is how many rows pass between progress reports during COPY
+const progressEvery = 1000
+
+// Endpoint is one side of a copy. Driver must be normalized.
+type Endpoint struct {
+	DB     *sql.DB
+	Driver string
+	Schema string
+	Table  string
+}
+
+// Options controls a copy
+type Options struct {
+	// Query, when set, is copied instead of the source table; it must be read-only
+	Query string
+	// Mode is ModeAppend (the default) or ModeTruncate
+	Mode      string
+	BatchSize int
+	// Progress, when set, is called as rows are written
+	Progress func(Result)
+}
+
+// Result reports how far a copy got
+type Result struct {
+	// Total is the number of source rows, known up front for table sources only
+	Total  int64                 `json:"total"`
+	Rows   int64                 `json:"rows"`
+	Copied int64                 `json:"copied"`
+	Failed int64                 `json:"failed"`
+	Errors []dataimport.RowError `json:"errors"`
+	Method string                `json:"method"`
+	// Created is set when the target table was created, with its statement in SQL
+	Created   bool   `json:"created"`
+	SQL       string `json:"sql,omitempty"`
+	Committed bool   `json:"committed"`
+	Elapsed   int64  `json:"elapsed_ms"`
+}
+
+// Run copies the rows of src into dst. Rows that can't be converted to the
+// target column types are reported in the Result and roll the copy back; a
+// table created for the copy is dropped again when nothing was committed.
+func Run(ctx context.Context, src, dst Endpoint, opts Options) (Result, error) {
+	started := time.Now()
+	result := Result{Errors: []dataimport.RowError{}, Method: MethodInsert}
+	if dst.Driver == constants.DriverPostgres {
+		result.Method = MethodCopy
+	}
+	switch opts.Mode {
+	case "":
+		opts.Mode = ModeAppend
+	case ModeAppend, ModeTruncate:
+	default:
+		return result, fmt.Errorf("unsupported copy mode: %s", opts.Mode)
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = DefaultBatchSize
+	}
+	if src.Schema == "" {
+		src.Schema = dialect.DefaultSchema(src.Driver)
+	}
+	if dst.Schema == "" {
+		dst.Schema = dialect.DefaultSchema(dst.Driver)
+	}
+	report := func() {
+		result.Elapsed = time.Since(started).Milliseconds()
+		if opts.Progress != nil {
+			opts.Progress(result)
+		}
+	}
+
+	rows, done, shape, err := openSource(ctx, src, opts.Query, &result)
+	if err != nil {
+		return result, err
+	}
+	defer done()
+	columns, err := export.Columns(rows)
+	if err != nil {
+		return result, err
+	}
+
+	target, err := prepareTarget(ctx, src.Driver, dst, shape, &result)
+	if err != nil {
+		return result, err
+	}
+	for _, c := range shape.Columns {
+		if _, ok := findColumn(target, c.Name); !ok {
+			return result, fmt.Errorf("column %s does not exist in %s", c.Name, dst.Table)
+		}
+	}
+	if result.Created {
+		defer func() {
+			if !result.Committed {
+				dropTable(dst)
+			}
+		}()
+	}
+	report()
+
+	reader := &rowReader{rows: rows, columns: columns}
+	if dst.Driver == constants.DriverPostgres {
+		err = copyPostgres(ctx, dst, target, reader, opts, &result, report)
+	} else {
+		err = insertRows(ctx, dst, target, reader, opts, &result, report)
+	}
+	if err == nil && result.Committed {
+		for _, stmt := range dump.ResetIdentity(dst.Driver, dst.Schema, target) {
+			if _, err := dst.DB.ExecContext(ctx, stmt); err != nil {
+				return result, fmt.Errorf("failed to reset identity: %v", err)
+			}
+		}
+	}
+	report()
+	return result, err
+}
+
+// openSource starts reading the source rows and describes their columns
+// as a table, which is what the target is created from when missing. A
+// source query must be a single read-only statement, and runs in a
+// read-only transaction where the database has one. done closes the rows.
+func openSource(ctx context.Context, src Endpoint, query string, result *Result) (*sql.Rows, func(), introspect.Table, error) {
+	shape := introspect.Table{Schema: src.Schema, Name: src.Table}
+	if query == "" {
+		t, err := introspect.DescribeTable(ctx, src.DB, src.Driver, src.Schema, src.Table)
+		if err != nil {
+			return nil, nil, shape, fmt.Errorf("failed to read source table: %v", err)
+		}
+		shape = t
+		countSQL := "SELECT COUNT(*) FROM " + sourceName(src)
+		if err := src.DB.QueryRowContext(ctx, countSQL).Scan(&result.Total); err != nil {
+			return nil, nil, shape, fmt.Errorf("failed to count source rows: %v", err)
+		}
+		selection := export.Selection{Schema: src.Schema, Table: src.Table}
+		if src.Driver == constants.DriverSQLite {
+			selection.Schema = ""
+		}
+		query, args, err := selection.SQL(src.Driver)
+		if err != nil {
+			return nil, nil, shape, err
+		}
+		rows, err := src.DB.QueryContext(ctx, query, args...)
+		if err != nil {
+			return nil, nil, shape, fmt.Errorf("failed to read source rows: %v", err)
+		}
+		return rows, func() { rows.Close() }, shape, nil
+	}
+
+	stmt, err := sqlguard.SingleReadOnly(src.Driver, query)
+	if err != nil {
+		return nil, nil, shape, errors.New("the source query must be a single read-only statement")
+	}
+	rows, done, err := sqlguard.QueryReadOnly(ctx, src.DB, src.Driver, stmt)
+	if err != nil {
+		return nil, nil, shape, fmt.Errorf("source query failed: %v", err)
+	}
+	types, err := rows.ColumnTypes()
+	if err != nil {
+		done()
+		return nil, nil, shape, fmt.Errorf("failed to get columns: %v", err)
+	}
+	for i, ct := range types {
+		nullable, ok := ct.Nullable()
+		shape.Columns = append(shape.Columns, introspect.Column{
+			Name:     ct.Name(),
+			Position: i + 1,
+			Type:     columnType(ct),
+			Nullable: nullable || !ok,
+		})
+	}
+	return rows, done, shape, nil
+}
+
+// columnType spells a result column's type the way introspection would
+func columnType(ct *sql.ColumnType) string {
+	typ := strings.ToLower(ct.DatabaseTypeName())
+	switch {
+	case typ == "":
+		// SQLite expressions carry no declared type
+		return dialect.TypeText
+	case strings.Contains(typ, "("):
+	default:
+		if p, s, ok := ct.DecimalSize(); ok && p > 0 {
+			return fmt.Sprintf("%s(%d,%d)", typ, p, s)
+		}
+		if n, ok := ct.Length(); ok && n > 0 && n <= 65535 {
+			return fmt.Sprintf("%s(%d)", typ, n)
+		}
+	}
+	return typ
+}
+
+// prepareTarget describes the target table, creating it from the source
+// shape when it doesn't exist yet
+func prepareTarget(ctx context.Context, srcDriver string, dst Endpoint, shape introspect.Table, result *Result) (introspect.Table, error) {
+	objects, err := introspect.Objects(ctx, dst.DB, dst.Driver, dst.Schema)
+	if err != nil {
+		return introspect.Table{}, fmt.Errorf("failed to list target tables: %v", err)
+	}
+	exists := false
+	for _, o := range objects {
+		if o.Name == dst.Table {
+			if o.Kind != "table" {
+				return introspect.Table{}, fmt.Errorf("%s is a %s, not a table", dst.Table, strings.ReplaceAll(o.Kind, "_", " "))
+			}
+			exists = true
+		}
+	}
+
+	if !exists {
+		result.SQL = ddl.New(srcDriver, dst.Driver).CreateTable(dst.Schema, targetShape(shape, dst.Table))
+		if _, err := dst.DB.ExecContext(ctx, result.SQL); err != nil {
+			return introspect.Table{}, fmt.Errorf("error creating table: %v", err)
+		}
+		result.Created = true
+	}
+
+	target, err := introspect.DescribeTable(ctx, dst.DB, dst.Driver, dst.Schema, dst.Table)
+	if err != nil {
+		if result.Created {
+			dropTable(dst)
+		}
+		return target, fmt.Errorf("failed to read target table: %v", err)
+	}
+	return target, nil
+}
+
+// targetShape renames the source table for the target. Foreign keys are left
+// out since the tables they reference may not exist there.
+func targetShape(shape introspect.Table, name string) introspect.Table {
+	t := shape
+	t.Name = name
+	t.Indexes = nil
+	t.Constraints = nil
+	for _, c := range shape.Constraints {
+		if c.Type == introspect.ConstraintForeignKey {
+			continue
+		}
+		c.Name = constraintName(c, shape.Name, name)
+		t.Constraints = append(t.Constraints, c)
+	}
+	return t
+}
+
+// constraintName renames a constraint for the copied table so it doesn't clash
+// with the source's when both live in the same schema
+func constraintName(c introspect.Constraint, from, to string) string {
+	switch {
+	case strings.HasPrefix(c.Name, "sqlite_autoindex_"):
+		// SQLite's own names for unnamed UNIQUE constraints
+		return to + "_" + strings.Join(c.Columns, "_") + "_key"
+	case from == to:
+		return c.Name
+	case strings.Contains(c.Name, from):
+		return strings.Replace(c.Name, from, to, 1)
+	}
+	return to + "_" + c.Name
+}
+
+// insertRows loads the rows with batched INSERTs inside one transaction
+func insertRows(ctx context.Context, dst Endpoint, target introspect.Table, reader *rowReader, opts Options, result *Result, report func()) error {
+	mode := dataimport.ModeInsert
+	if opts.Mode == ModeTruncate {
+		mode = dataimport.ModeReplace
+	}
+	identity := false
+	for _, c := range target.Columns {
+		identity = identity || (c.AutoIncrement && reader.has(c.Name))
+	}
+
+	apply := func(r dataimport.Result) {
+		result.Rows = r.Rows
+		result.Copied = r.Inserted
+		result.Failed = r.Failed
+		result.Errors = r.Errors
+		result.Committed = r.Committed
+	}
+	r, err := dataimport.Run(ctx, dst.DB, target, reader, dataimport.Options{
+		Driver:         dst.Driver,
+		Mode:           mode,
+		BatchSize:      opts.BatchSize,
+		IdentityInsert: identity,
+		Progress: func(r dataimport.Result) {
+			apply(r)
+			report()
+		},
+	})
+	apply(r)
+	return err
+}
+
+// copyPostgres streams the rows with COPY FROM STDIN inside one transaction
+func copyPostgres(ctx context.Context, dst Endpoint, target introspect.Table, reader *rowReader, opts Options, result *Result, report func()) error {
+	conn, err := dst.DB.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to connect to database: %v", err)
+	}
+	defer conn.Close()
+
+	return conn.Raw(func(driverConn any) error {
+		sc, ok := driverConn.(*stdlib.Conn)
+		if !ok {
+			return fmt.Errorf("COPY needs the pgx driver, got %T", driverConn)
+		}
+		tx, err := sc.Conn().Begin(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to begin transaction: %v", err)
+		}
+		defer tx.Rollback(ctx)
+
+		if opts.Mode == ModeTruncate {
+			if _, err := tx.Exec(ctx, "TRUNCATE TABLE "+dialect.QualifiedName(dst.Driver, dst.Schema, dst.Table)); err != nil {
+				return fmt.Errorf("failed to empty %s: %v", dst.Table, err)
+			}
+		}
+
+		source := &copySource{reader: reader, target: target, result: result, report: report}
+		n, err := tx.CopyFrom(ctx, pgx.Identifier{dst.Schema, dst.Table}, reader.targetNames(target), source)
+		if source.rowErr != nil {
+			// a row that can't be converted aborts the COPY and the copy with it
+			result.Failed++
+			result.Errors = append(result.Errors, *source.rowErr)
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("COPY failed: %v", err)
+		}
+		if err := tx.Commit(ctx); err != nil {
+			return fmt.Errorf("failed to commit: %v", err)
+		}
+		result.Copied = n
+		result.Committed = true
+		return nil
+	})
+}
+
+// copySource feeds pgx's CopyFrom, coercing each row to the target columns
+type copySource struct {
+	reader *rowReader
+	target introspect.Table
+	result *Result
+	report func()
+	values []any
+	err    error
+	rowErr *dataimport.RowError
+}
+
+func (s *copySource) Next() bool {
+	record, err := s.reader.Next()
+	if err == io.EOF {
+		return false
+	}
+	if err != nil {
+		s.err = err
+		return false
+	}
+	s.result.Rows++
+	row := s.result.Rows
+
+	s.values = make([]any, len(s.reader.columns))
+	for i, c := range s.reader.columns {
+		col, _ := findColumn(s.target, c.Name)
+		v, err := dataimport.Coerce(constants.DriverPostgres, col, record[c.Name])
+		if err != nil {
+			s.rowErr = &dataimport.RowError{Row: row, Column: c.Name, Message: err.Error()}
+			return false
+		}
+		s.values[i] = v
+	}
+	if row%progressEvery == 0 {
+		s.result.Copied = row
+		s.report()
+	}
+	return true
+}
+
+func (s *copySource) Values() ([]any, error) {
+	return s.values, nil
+}
+
+func (s *copySource) Err() error {
+	if s.rowErr != nil {
+		return s.rowErr
+	}
+	return s.err
+}
+
+// rowReader turns source rows into import records. Values are passed on the
+// way the exports write them (text, "\x" hex for binary, RFC 3339 times) so
+// dataimport.Coerce can convert them to any target dialect.
+type rowReader struct {
+	rows    *sql.Rows
+	columns []export.Column
+}
+
+func (r *rowReader) Next() (dataimport.Record, error) {
+	if !r.rows.Next() {
+		if err := r.rows.Err(); err != nil {
+			return nil, fmt.Errorf("failed to read source rows: %v", err)
+		}
+		return nil, io.EOF
+	}
+	values := make([]any, len(r.columns))
+	ptrs := make([]any, len(values))
+	for i := range values {
+		ptrs[i] = &values[i]
+	}
+	if err := r.rows.Scan(ptrs...); err != nil {
+		return nil, fmt.Errorf("failed to read source rows: %v", err)
+	}
+
+	record := make(dataimport.Record, len(values))
+	for i, c := range r.columns {
+		v := export.JSONValue(values[i], c)
+		switch x := v.(type) {
+		case time.Time:
+			v = x.Format(time.RFC3339Nano)
+		case int32:
+			v = int64(x)
+		case float32:
+			v = float64(x)
+		}
+		record[c.Name] = v
+	}
+	return record, nil
+}
+
+func (r *rowReader) has(name string) bool {
+	for _, c := range r.columns {
+		if strings.EqualFold(c.Name, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// targetNames returns the target column for every source column, in source order
+func (r *rowReader) targetNames(target introspect.Table) []string {
+	names := make([]string, len(r.columns))
+	for i, c := range r.columns {
+		col, _ := findColumn(target, c.Name)
+		names[i] = col.Name
+	}
+	return names
+}
+
+// findColumn matches a source column to a target column, ignoring case as
+// dialects differ in how they fold unquoted names
+func findColumn(t introspect.Table, name string) (introspect.Column, bool) {
+	if c, ok := t.Column(name); ok {
+		return c, true
+	}
+	for _, c := range t.Columns {
+		if strings.EqualFold(c.Name, name) {
+			return c, true
+		}
+	}
+	return introspect.Column{}, false
+}
+
+func sourceName(src Endpoint) string {
+	if src.Driver == constants.DriverSQLite {
+		return dialect.QuoteIdent(src.Driver, src.Table)
+	}
+	return dialect.QualifiedName(src.Driver, src.Schema, src.Table)
+}
+
+// dropTable removes a table created for a copy that didn't commit
+func dropTable(dst Endpoint) {
+	schema := dst.Schema
+	if dst.Driver == constants.DriverSQLite {
+		schema = ""
+	}
+	dst.DB.ExecContext(context.Background(), ddl.New(dst.Driver, dst.Driver).DropTableIfExists(schema, dst.Table))
+}
@@ -0,0 +1,44 @@
+// Package testutil holds the helpers shared by the handler tests
+package testutil
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/dracory/weebase/shared/session"
+)
+
+// SessionSecret is the secret the handler tests configure
+const SessionSecret = "test-secret"
+
+// SessionCookie returns the cookie of a session connected to the SQLite
+// database at dbPath
+func SessionCookie(t testing.TB, dbPath string) *http.Cookie {
+	return SessionCookieWithID(t, "test-session", dbPath)
+}
+
+// SessionCookieWithID returns the cookie of the session with the given ID
+// connected to the SQLite database at dbPath
+func SessionCookieWithID(t testing.TB, id, dbPath string) *http.Cookie {
+	t.Helper()
+	sess := &session.Session{
+		ID:        id,
+		CreatedAt: time.Now(),
+		Conn: &session.ActiveConnection{
+			ID:       "test-connection",
+			Driver:   "sqlite3",
+			DSN:      dbPath,
+			LastUsed: time.Now(),
+		},
+	}
+	req := httptest.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+	session.SaveSession(w, req, sess, SessionSecret)
+	cookies := w.Result().Cookies()
+	if len(cookies) == 0 {
+		t.Fatal("failed to create session cookie")
+	}
+	return cookies[0]
+}
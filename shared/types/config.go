@@ -1,5 +1,20 @@
 package types
 
+import (
+	"time"
+
+	"github.com/dracory/weebase/shared/apitoken"
+	"github.com/dracory/weebase/shared/audit"
+	"github.com/dracory/weebase/shared/auth"
+	"github.com/dracory/weebase/shared/connguard"
+	"github.com/dracory/weebase/shared/jobs"
+	"github.com/dracory/weebase/shared/journal"
+	"github.com/dracory/weebase/shared/masking"
+	"github.com/dracory/weebase/shared/ratelimit"
+	"github.com/dracory/weebase/shared/rbac"
+	"github.com/dracory/weebase/shared/secrets"
+)
+
 // Config contains the configuration for web handlers
 type Config struct {
 	// HTTPPort is the port to listen on for HTTP requests
@@ -17,12 +32,135 @@ type Config struct {
 	// AllowAdHocConnections specifies if ad-hoc connections are allowed
 	AllowAdHocConnections bool
 
+	// RateLimit caps the requests of each client address and session and
+	// locks out clients whose connects keep failing. When nil, the
+	// ratelimit defaults apply; an empty Config limits nothing.
+	RateLimit *ratelimit.Config
+
+	// ConnectPolicy restricts the hosts, ports, files and DSN parameters
+	// of ad-hoc connections. When nil, only the checks that need no
+	// configuration apply.
+	ConnectPolicy *connguard.Policy
+
+	// SecretResolver looks up the ${scheme:name} secret references in the
+	// DSNs of connection and backup profiles each time one is opened, so
+	// their passwords needn't be kept in the configuration, the session or
+	// the browser. Ad-hoc connections may not use references. When nil,
+	// references are refused.
+	SecretResolver secrets.Resolver
+
+	// ConnectionProfiles are server-side connections operators open by
+	// their ID; only the ID is kept in the session
+	ConnectionProfiles []ConnectionProfile
+
 	// SafeModeDefault specifies if safe mode is enabled by default
 	SafeModeDefault bool
 
+	// ReadOnlyMode rejects statements that write data or change structure.
+	// Actions that write whatever their input are refused before they run;
+	// SQL consoles and scripts check each statement.
+	ReadOnlyMode bool
+
 	// SessionSecret is the secret used for session management
 	SessionSecret string
 
 	// SecureCookies specifies if cookies should be set with the Secure flag
 	SecureCookies bool
+
+	// Authenticator identifies the operator before any action runs.
+	// When nil, weebase is open to anyone who can reach it.
+	Authenticator auth.Authenticator
+
+	// APITokenStorePath is a SQLite file that keeps personal API tokens
+	// across restarts. When empty, tokens are kept in memory.
+	APITokenStorePath string
+
+	// APITokenMaxLifetime is how long a personal API token lasts at most;
+	// tokens created without an expiry end then. When zero,
+	// apitoken.DefaultMaxLifetime applies.
+	APITokenMaxLifetime time.Duration
+
+	// APITokens keeps the personal API tokens operators create for
+	// scripts; it takes precedence over APITokenStorePath. Tokens are
+	// only accepted when an Authenticator is configured.
+	APITokens apitoken.Store
+
+	// Policy restricts what each operator may do, checked before every
+	// action. When nil, every operator may do everything.
+	Policy *rbac.Policy
+
+	// AuditSink records every data-changing and SQL action. When nil,
+	// entries are written to the default slog logger.
+	AuditSink audit.Sink
+
+	// Masking hides sensitive column values from operators without the
+	// unmask permission. When nil, nothing is masked.
+	Masking *masking.Rules
+
+	// MigrationsDir is where captured DDL migration files are written.
+	// When empty, migration files are offered for download only.
+	MigrationsDir string
+
+	// MigrationsFormat is the default migration file format
+	// ("golang-migrate" or "goose")
+	MigrationsFormat string
+
+	// JobWorkers is how many background jobs run at the same time
+	JobWorkers int
+
+	// JobArtifactTTL is how long a finished job and its output file are
+	// kept for download
+	JobArtifactTTL time.Duration
+
+	// JobArtifactDir is where job output files are written.
+	// When empty, a weebase-jobs directory in the temp dir is used.
+	JobArtifactDir string
+
+	// JobStorePath is a SQLite file that keeps job state across restarts.
+	// When empty, job state is kept in memory.
+	JobStorePath string
+
+	// JobStore keeps job state; it takes precedence over JobStorePath
+	JobStore jobs.Store
+
+	// JournalStorePath is a SQLite file that keeps the row change journal
+	// across restarts. When empty, the journal is kept in memory.
+	JournalStorePath string
+
+	// Journal records the before and after image of rows edited through
+	// the UI so edits can be undone; it takes precedence over
+	// JournalStorePath
+	Journal journal.Store
+
+	// BackupProfiles are server-side connections backed up on a schedule
+	BackupProfiles []BackupProfile
+}
+
+// ConnectionProfile is a connection configured on the server. Its DSN may
+// reference secrets, which are resolved each time it is opened.
+type ConnectionProfile struct {
+	// ID identifies the profile in requests and the session
+	ID     string `json:"id"`
+	Name   string `json:"name"`
+	Driver string `json:"driver"`
+	DSN    string `json:"dsn"`
+}
+
+// BackupProfile is a connection that weebase backs up to local disk with
+// the SQL dump writer
+type BackupProfile struct {
+	// Name identifies the profile and prefixes its backup files
+	Name   string `json:"name"`
+	Driver string `json:"driver"`
+	DSN    string `json:"dsn"`
+	// Schema limits the backup to one schema; empty means the default one
+	Schema string `json:"schema"`
+	// Schedule is a five-field cron expression, such as "0 3 * * *".
+	// When empty the profile is only backed up on demand.
+	Schedule string `json:"schedule"`
+	// Dir is the directory the backups are written to
+	Dir string `json:"dir"`
+	// Retain is how many backups are kept; older ones are deleted.
+	// Zero keeps every backup.
+	Retain int `json:"retain"`
 }
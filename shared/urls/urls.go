@@ -35,6 +35,171 @@ func ApiTablesList(basePath string, params ...map[string]string) string {
 	return URL(basePath, constants.ActionApiTablesList, params...)
 }
 
+// ApiViewDefinition builds the URL for fetching a view definition
+func ApiViewDefinition(basePath string, params ...map[string]string) string {
+	return URL(basePath, constants.ActionApiViewDefinition, params...)
+}
+
+// ApiViewCreate builds the URL for creating or replacing a view
+func ApiViewCreate(basePath string, params ...map[string]string) string {
+	return URL(basePath, constants.ActionApiViewCreate, params...)
+}
+
+// ApiViewDrop builds the URL for dropping a view
+func ApiViewDrop(basePath string, params ...map[string]string) string {
+	return URL(basePath, constants.ActionApiViewDrop, params...)
+}
+
+// ApiViewRefresh builds the URL for refreshing a materialized view
+func ApiViewRefresh(basePath string, params ...map[string]string) string {
+	return URL(basePath, constants.ActionApiViewRefresh, params...)
+}
+
+// ApiRoutinesList builds the URL for listing routines
+func ApiRoutinesList(basePath string, params ...map[string]string) string {
+	return URL(basePath, constants.ActionApiRoutinesList, params...)
+}
+
+// ApiRoutineExecute builds the URL for executing a routine
+func ApiRoutineExecute(basePath string, params ...map[string]string) string {
+	return URL(basePath, constants.ActionApiRoutineExecute, params...)
+}
+
+// ApiTableInfo builds the URL for table column information
+func ApiTableInfo(basePath string, params ...map[string]string) string {
+	return URL(basePath, constants.ActionApiTableInfo, params...)
+}
+
+// ApiSequencesList builds the URL for listing sequences
+func ApiSequencesList(basePath string, params ...map[string]string) string {
+	return URL(basePath, constants.ActionApiSequencesList, params...)
+}
+
+// ApiSequenceSetval builds the URL for setting a sequence value
+func ApiSequenceSetval(basePath string, params ...map[string]string) string {
+	return URL(basePath, constants.ActionApiSequenceSetval, params...)
+}
+
+// ApiSequenceRestart builds the URL for restarting a sequence
+func ApiSequenceRestart(basePath string, params ...map[string]string) string {
+	return URL(basePath, constants.ActionApiSequenceRestart, params...)
+}
+
+// ApiTypesList builds the URL for listing user-defined types
+func ApiTypesList(basePath string, params ...map[string]string) string {
+	return URL(basePath, constants.ActionApiTypesList, params...)
+}
+
+// ApiEnumAddValue builds the URL for adding an enum label
+func ApiEnumAddValue(basePath string, params ...map[string]string) string {
+	return URL(basePath, constants.ActionApiEnumAddValue, params...)
+}
+
+// ApiSchemaDiff builds the URL for comparing two schemas
+func ApiSchemaDiff(basePath string, params ...map[string]string) string {
+	return URL(basePath, constants.ActionApiSchemaDiff, params...)
+}
+
+// ApiDataDiff builds the URL for comparing the rows of two tables
+func ApiDataDiff(basePath string, params ...map[string]string) string {
+	return URL(basePath, constants.ActionApiDataDiff, params...)
+}
+
+// ApiMigrationGenerate builds the URL for turning DDL into migration files
+func ApiMigrationGenerate(basePath string, params ...map[string]string) string {
+	return URL(basePath, constants.ActionApiMigrationGenerate, params...)
+}
+
+// ApiExport builds the URL for streaming a table, selection or query export
+func ApiExport(basePath string, params ...map[string]string) string {
+	return URL(basePath, constants.ActionApiExport, params...)
+}
+
+// ApiDump builds the URL for downloading a SQL dump
+func ApiDump(basePath string, params ...map[string]string) string {
+	return URL(basePath, constants.ActionApiDump, params...)
+}
+
+// ApiImport builds the URL for loading a file into a table
+func ApiImport(basePath string, params ...map[string]string) string {
+	return URL(basePath, constants.ActionApiImport, params...)
+}
+
+// ApiImportPreview builds the URL for uploading and previewing an import file
+func ApiImportPreview(basePath string, params ...map[string]string) string {
+	return URL(basePath, constants.ActionApiImportPreview, params...)
+}
+
+// ApiJobStatus builds the URL for polling, or cancelling, a background job
+func ApiJobStatus(basePath string, params ...map[string]string) string {
+	return URL(basePath, constants.ActionApiJobStatus, params...)
+}
+
+// ApiSQLImport builds the URL for running an uploaded SQL script
+func ApiSQLImport(basePath string, params ...map[string]string) string {
+	return URL(basePath, constants.ActionApiSQLImport, params...)
+}
+
+// ApiJobsList builds the URL for listing the background jobs of the session
+func ApiJobsList(basePath string, params ...map[string]string) string {
+	return URL(basePath, constants.ActionApiJobsList, params...)
+}
+
+// ApiJobDownload builds the URL for downloading the output of a finished job
+func ApiJobDownload(basePath string, params ...map[string]string) string {
+	return URL(basePath, constants.ActionApiJobDownload, params...)
+}
+
+// ApiBackupsList builds the URL for listing backup profiles and their backups
+func ApiBackupsList(basePath string, params ...map[string]string) string {
+	return URL(basePath, constants.ActionApiBackupsList, params...)
+}
+
+// ApiBackupCreate builds the URL for taking a backup of a profile
+func ApiBackupCreate(basePath string, params ...map[string]string) string {
+	return URL(basePath, constants.ActionApiBackupCreate, params...)
+}
+
+// ApiBackupRestore builds the URL for restoring a backup
+func ApiBackupRestore(basePath string, params ...map[string]string) string {
+	return URL(basePath, constants.ActionApiBackupRestore, params...)
+}
+
+// ApiTableCopy builds the URL for copying a table between connections
+func ApiTableCopy(basePath string, params ...map[string]string) string {
+	return URL(basePath, constants.ActionApiTableCopy, params...)
+}
+
+// ApiAuditSearch builds the URL for searching the audit log
+func ApiAuditSearch(basePath string, params ...map[string]string) string {
+	return URL(basePath, constants.ActionApiAuditSearch, params...)
+}
+
+// ApiTokensList builds the URL for listing the operator's API tokens
+func ApiTokensList(basePath string, params ...map[string]string) string {
+	return URL(basePath, constants.ActionApiTokensList, params...)
+}
+
+// ApiTokenCreate builds the URL for creating an API token
+func ApiTokenCreate(basePath string, params ...map[string]string) string {
+	return URL(basePath, constants.ActionApiTokenCreate, params...)
+}
+
+// ApiTokenRevoke builds the URL for revoking an API token
+func ApiTokenRevoke(basePath string, params ...map[string]string) string {
+	return URL(basePath, constants.ActionApiTokenRevoke, params...)
+}
+
+// ApiRowChanges builds the URL for listing the row change journal
+func ApiRowChanges(basePath string, params ...map[string]string) string {
+	return URL(basePath, constants.ActionApiRowChanges, params...)
+}
+
+// ApiRowUndo builds the URL for undoing a row change
+func ApiRowUndo(basePath string, params ...map[string]string) string {
+	return URL(basePath, constants.ActionApiRowUndo, params...)
+}
+
 // PageLogin builds the URL for the login page.
 func PageLogin(basePath string, params ...map[string]string) string {
 	return URL(basePath, constants.ActionPageLogin, params...)
@@ -49,6 +214,11 @@ func PageTable(basePath string, params ...map[string]string) string {
 	return URL(basePath, constants.ActionPageTable, params...)
 }
 
+// PageRoutines builds the URL for the routines browser page
+func PageRoutines(basePath string, params ...map[string]string) string {
+	return URL(basePath, constants.ActionPageRoutines, params...)
+}
+
 // PageTableCreate builds the page action URL for the Create Table page.
 func PageTableCreate(basePath string, params ...map[string]string) string {
 	return URL(basePath, constants.ActionPageTableCreate, params...)
@@ -82,6 +252,31 @@ func PageImport(basePath string, params ...map[string]string) string {
 	return URL(basePath, constants.ActionPageImport, params...)
 }
 
+// PageCopy builds the URL for the table copy page
+func PageCopy(basePath string, params ...map[string]string) string {
+	return URL(basePath, constants.ActionPageCopy, params...)
+}
+
+// PageBackups builds the URL for the backups page
+func PageBackups(basePath string, params ...map[string]string) string {
+	return URL(basePath, constants.ActionPageBackups, params...)
+}
+
+// PageAudit builds the URL for the audit log page
+func PageAudit(basePath string, params ...map[string]string) string {
+	return URL(basePath, constants.ActionPageAudit, params...)
+}
+
+// PageTokens builds the URL for the API tokens page
+func PageTokens(basePath string, params ...map[string]string) string {
+	return URL(basePath, constants.ActionPageTokens, params...)
+}
+
+// PageChanges builds the URL for the row changes page
+func PageChanges(basePath string, params ...map[string]string) string {
+	return URL(basePath, constants.ActionPageChanges, params...)
+}
+
 // PageExport builds the URL for the export page
 func PageExport(basePath string, params ...map[string]string) string {
 	return URL(basePath, constants.ActionPageExport, params...)